@@ -15,7 +15,7 @@
 package consumer
 
 import (
-	"fmt"
+	"strconv"
 	"sync"
 
 	"github.com/brutella/can"
@@ -25,7 +25,8 @@ import (
 // CAN bus consumer
 //
 // This consumer reads from a CAN interface. A message is generated for each
-// message
+// message. Messages are taken from the message pool to reduce allocations on
+// busy interfaces.
 //
 // Metadata
 //
@@ -53,6 +54,7 @@ import (
 type Can struct {
 	core.SimpleConsumer `gollumdoc:"embed_type"`
 	bus                 *can.Bus
+	frameBuffer         []byte
 	iface               string `config:"Interface"`
 	hasToSetMetadata    bool   `config:"SetMetadata" default:"false"`
 }
@@ -76,15 +78,27 @@ func (cons *Can) Enqueue(data []byte) {
 		metaData := core.Metadata{}
 		metaData.SetValue("iface", []byte(cons.iface))
 
-		cons.EnqueueWithMetadata(data, metaData)
+		cons.EnqueuePooled(data, metaData)
 	} else {
-		cons.SimpleConsumer.Enqueue(data)
+		cons.EnqueuePooled(data, nil)
 	}
 }
 
+// ProcessFrame converts a CAN frame to JSON and enqueues it. Frames are
+// processed one at a time by the bus, so the conversion buffer can be reused.
 func (cons *Can) ProcessFrame(frm can.Frame) {
-	str := fmt.Sprintf("{\"id\":%d,\"data\":\"%X\"}\n", frm.ID, frm.Data[:frm.Length])
-	cons.Enqueue([]byte(str))
+	const hexDigits = "0123456789ABCDEF"
+
+	buffer := append(cons.frameBuffer[:0], `{"id":`...)
+	buffer = strconv.AppendUint(buffer, uint64(frm.ID), 10)
+	buffer = append(buffer, `,"data":"`...)
+	for _, b := range frm.Data[:frm.Length] {
+		buffer = append(buffer, hexDigits[b>>4], hexDigits[b&0x0F])
+	}
+	buffer = append(buffer, "\"}\n"...)
+
+	cons.frameBuffer = buffer
+	cons.Enqueue(buffer)
 }
 
 // Consume listens to stdin.
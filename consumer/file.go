@@ -18,7 +18,10 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -55,6 +58,18 @@ const (
 // by sending a SIGHUP. A symlink to a file will automatically be reopened
 // if the underlying file is changed.
 //
+// Files compressed with gzip or zstd, e.g. by the Rotation/Compress setting of
+// producer.File, are decompressed transparently. As compressed files are not
+// expected to change, they are read once and not observed for new content.
+// Offsets of compressed files refer to the decompressed data.
+//
+// Lines belonging together, e.g. stack traces or pretty printed JSON, can be
+// grouped into one message by using the Multiline settings.
+//
+// In import mode all files matching File are read once from the start, one
+// after another, ordered by modification time. This can be used to replay
+// archived logs.
+//
 // Metadata
 //
 // *NOTE: The metadata will only set if the parameter `SetMetadata` is active.*
@@ -65,8 +80,9 @@ const (
 //
 // Parameters
 //
-// - File: This value is a mandatory setting and contains the name of the
-// file to read. This field supports glob patterns.
+// - Files: This value is a mandatory setting and contains the name of the
+// file to read. This field supports glob patterns. In import mode this may
+// also be a directory, in which case all files in it are read.
 // If the file pointed to is a symlink, changes to the symlink will be
 // detected. The file will be watched for changes, so active logfiles can
 // be scraped, too.
@@ -114,19 +130,58 @@ const (
 // performance impact on systems with high throughput.
 // By default this parameter is set to "false".
 //
+// - Multiline/Pattern: Defines a regular expression used to group lines into
+// one message. Lines are joined using the Delimiter. If empty, each line is
+// sent as a separate message.
+// By default this parameter is set to "".
+//
+// - Multiline/Mode: Defines how Multiline/Pattern is applied. In "start" mode
+// the pattern matches the first line of a message, e.g. a timestamp. In
+// "continue" mode the pattern matches lines that belong to the previous line,
+// e.g. indented lines of a stack trace.
+// By default this parameter is set to "start".
+//
+// - Multiline/TimeoutMs: Defines the time in milliseconds after which a
+// message is sent if no further lines have been read.
+// By default this parameter is set to "1000".
+//
+// - Multiline/MaxLines: Defines the maximum number of lines grouped into one
+// message. Additional lines start a new message.
+// By default this parameter is set to "1000".
+//
+// - Import: When set to true, all files are read once instead of being
+// observed for new content. DefaultOffset is ignored, files are read from
+// the start unless an offset file exists.
+// By default this parameter is set to "false".
+//
+// - ExitOnEOF: When set to true, gollum is shut down after all files have
+// been read in import mode.
+// By default this parameter is set to "true".
+//
 // Examples
 //
 // This example will read the `/var/log/system.log` file and create a message for each new entry.
 //
 //  FileIn:
 //    Type: consumer.File
-//    File: /var/log/*.log
+//    Files: /var/log/*.log
 //    DefaultOffset: newest
 //    OffsetFilePath: ""
 //    Delimiter: "\n"
 //    ObserveMode: poll
 //    PollingDelay: 100
 //
+// This example replays archived java logs, including rotated and compressed
+// files, and groups stack traces into one message per exception.
+//
+//  FileImport:
+//    Type: consumer.File
+//    Files: /archive/app
+//    Import: true
+//    Multiline:
+//      Pattern: "^\\s+(at |\\.\\.\\.)|^Caused by:"
+//      Mode: continue
+//
 type File struct {
 	core.SimpleConsumer `gollumdoc:"embed_type"`
 
@@ -139,9 +194,15 @@ type File struct {
 	observeMode      string        `config:"ObserveMode" default:"poll"`
 	hasToSetMetadata bool          `config:"SetMetadata" default:"false"`
 	defaultOffset    string        `config:"DefaultOffset" default:"newest"`
-
-	observedFiles *sync.Map
-	done          chan struct{}
+	multilineMode    string        `config:"Multiline/Mode" default:"start"`
+	multilineTimeout time.Duration `config:"Multiline/TimeoutMs" default:"1000" metric:"ms"`
+	multilineMax     int           `config:"Multiline/MaxLines" default:"1000"`
+	importMode       bool          `config:"Import" default:"false"`
+	exitOnEOF        bool          `config:"ExitOnEOF" default:"true"`
+
+	multilinePattern *regexp.Regexp
+	observedFiles    *sync.Map
+	done             chan struct{}
 }
 
 func init() {
@@ -164,6 +225,18 @@ func (cons *File) Configure(conf core.PluginConfigReader) {
 		cons.Logger.Warningf("Unknown observe mode '%s'. Using poll", cons.observeMode)
 		cons.observeMode = observeModePoll
 	}
+
+	if pattern := conf.GetString("Multiline/Pattern", ""); pattern != "" {
+		var err error
+		cons.multilinePattern, err = regexp.Compile(pattern)
+		conf.Errors.Push(err)
+	}
+
+	switch cons.multilineMode {
+	case multilineModeStart, multilineModeContinue:
+	default:
+		conf.Errors.Pushf("Unknown multiline mode '%s'", cons.multilineMode)
+	}
 }
 
 func (cons *File) newObservedFile(name string, stopIfNotExist bool) *observableFile {
@@ -177,7 +250,7 @@ func (cons *File) newObservedFile(name string, stopIfNotExist bool) *observableF
 
 	switch {
 	case cons.offsetFilePath != "":
-		offsetFileName = fmt.Sprintf("%s/%s.offset", cons.offsetFilePath, filepath.Base(cons.fileName))
+		offsetFileName = fmt.Sprintf("%s/%s.offset", cons.offsetFilePath, filepath.Base(name))
 		if offsetFileData, err := ioutil.ReadFile(offsetFileName); err != nil {
 			logger.WithError(err).Errorf("Failed to open offset file %s", offsetFileName)
 		} else {
@@ -188,7 +261,7 @@ func (cons *File) newObservedFile(name string, stopIfNotExist bool) *observableF
 			}
 		}
 
-	case defaultOffset == fileOffsetEnd:
+	case defaultOffset == fileOffsetEnd && !cons.importMode:
 		cursor.whence = io.SeekEnd
 
 	case defaultOffset == fileOffsetStart:
@@ -205,6 +278,7 @@ func (cons *File) newObservedFile(name string, stopIfNotExist bool) *observableF
 		retryDelay:     cons.retryDelay,
 		pollDelay:      cons.pollingDelay,
 		buffer:         tio.NewBufferedReader(fileBufferGrowSize, tio.BufferedReaderFlagDelimiter, 0, cons.delimiter),
+		delimiter:      []byte(cons.delimiter),
 		log:            logger,
 	}
 }
@@ -216,7 +290,13 @@ func (cons *File) observeFile(name string, stopIfNotExist bool) {
 	defer file.close()
 
 	cons.observedFiles.Store(name, file)
-	defer cons.observedFiles.Delete(name)
+	finished := false
+	defer func() {
+		// Files read completely are kept so that globs do not pick them up again
+		if !finished {
+			cons.observedFiles.Delete(name)
+		}
+	}()
 
 	enqueue := cons.Enqueue
 
@@ -231,14 +311,25 @@ func (cons *File) observeFile(name string, stopIfNotExist bool) {
 	}
 
 	if cons.offsetFilePath != "" {
+		enqueueMessage := enqueue
 		enqueue = func(data []byte) {
-			enqueue(data)
+			enqueueMessage(data)
 			file.storeOffset()
 		}
 	}
 
-	switch cons.observeMode {
-	case observeModeWatch:
+	if cons.multilinePattern != nil {
+		file.multiline = newFileMultiline(cons.multilinePattern, cons.multilineMode,
+			cons.multilineTimeout, cons.multilineMax, cons.delimiter, enqueue)
+		enqueue = file.multiline.add
+		// Send a pending record before the file is closed on shutdown
+		defer file.flush()
+	}
+
+	switch {
+	case cons.importMode || isCompressedFile(name):
+		finished = file.readToEnd(enqueue, cons.done)
+	case cons.observeMode == observeModeWatch:
 		file.observeFSNotify(enqueue, cons.done)
 	default:
 		file.observePoll(enqueue, cons.done)
@@ -277,11 +368,75 @@ func (cons *File) observeFiles() {
 	}
 }
 
+// globFilesByModTime returns all regular files matching the given glob
+// pattern ordered by modification time, so that rotated files are listed in
+// the order they were written. If pattern is a directory, all files in this
+// directory are returned.
+func globFilesByModTime(pattern string) ([]string, error) {
+	if stat, err := os.Stat(pattern); err == nil && stat.IsDir() {
+		pattern = filepath.Join(pattern, "*")
+	}
+
+	fileNames, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	modTimes := make(map[string]time.Time, len(fileNames))
+	regularFileNames := make([]string, 0, len(fileNames))
+	for _, name := range fileNames {
+		if stat, err := os.Stat(name); err == nil && stat.Mode().IsRegular() {
+			modTimes[name] = stat.ModTime()
+			regularFileNames = append(regularFileNames, name)
+		}
+	}
+
+	sort.SliceStable(regularFileNames, func(i, j int) bool {
+		a, b := regularFileNames[i], regularFileNames[j]
+		if modTimes[a].Equal(modTimes[b]) {
+			return a < b
+		}
+		return modTimes[a].Before(modTimes[b])
+	})
+	return regularFileNames, nil
+}
+
+func (cons *File) importFiles() {
+	defer cons.WorkerDone()
+
+	fileNames, err := globFilesByModTime(cons.fileName)
+	if err != nil {
+		cons.Logger.WithError(err).Errorf("Failed to evaluate glob '%s'", cons.fileName)
+		return
+	}
+
+	cons.Logger.Infof("Importing %d files", len(fileNames))
+	for _, name := range fileNames {
+		select {
+		default:
+		case <-cons.done:
+			return // exit requested
+		}
+
+		cons.AddWorker()
+		cons.observeFile(name, stopIfNotExist) // blocking
+	}
+
+	if cons.exitOnEOF {
+		cons.Logger.Info("Exit triggered by completed import.")
+		tgo.ShutdownCallback()
+	}
+}
+
 // Consume opens the given file(s) for reading
 func (cons *File) Consume(workers *sync.WaitGroup) {
 	go tgo.WithRecoverShutdown(func() {
 		cons.AddMainWorker(workers)
-		cons.observeFiles()
+		if cons.importMode {
+			cons.importFiles()
+		} else {
+			cons.observeFiles()
+		}
 	})
 
 	cons.ControlLoop()
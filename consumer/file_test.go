@@ -0,0 +1,185 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func readFileTestMessages(cons *File, name string) []string {
+	messages := []string{}
+	enqueue := func(data []byte) {
+		messages = append(messages, string(data))
+	}
+
+	file := cons.newObservedFile(name, stopIfNotExist)
+	defer file.close()
+
+	if cons.multilinePattern != nil {
+		file.multiline = newFileMultiline(cons.multilinePattern, cons.multilineMode,
+			cons.multilineTimeout, cons.multilineMax, cons.delimiter, enqueue)
+		enqueue = file.multiline.add
+	}
+
+	file.readToEnd(enqueue, make(chan struct{}))
+	return messages
+}
+
+func TestFileMultilineStart(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	var messages []string
+	multiline := newFileMultiline(regexp.MustCompile(`^\d{4}-`), multilineModeStart, time.Hour, 3, "\n", func(data []byte) {
+		messages = append(messages, string(data))
+	})
+
+	for _, line := range []string{"orphan", "2018-01-01 error", "  at a", "  at b", "  at c", "2018-01-02 ok"} {
+		multiline.add([]byte(line))
+	}
+	multiline.flushIdle()
+	expect.Equal(3, len(messages))
+
+	multiline.flush()
+	expect.Equal([]string{"orphan", "2018-01-01 error\n  at a\n  at b", "  at c", "2018-01-02 ok"}, messages)
+}
+
+func TestFileMultilineContinue(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	var messages []string
+	multiline := newFileMultiline(regexp.MustCompile(`^\s`), multilineModeContinue, 0, 100, "\n", func(data []byte) {
+		messages = append(messages, string(data))
+	})
+
+	for _, line := range []string{"{", "  \"a\": 1", "}", "next"} {
+		multiline.add([]byte(line))
+	}
+	multiline.flushIdle()
+	expect.Equal([]string{"{\n  \"a\": 1", "}", "next"}, messages)
+}
+
+func TestFileCompressed(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-file")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	content := []byte("first\nsecond\nlast without delimiter")
+
+	gzipped := new(bytes.Buffer)
+	gzipWriter := gzip.NewWriter(gzipped)
+	gzipWriter.Write(content)
+	gzipWriter.Close()
+	gzipName := filepath.Join(dir, "test.log.1.gz")
+	expect.NoError(ioutil.WriteFile(gzipName, gzipped.Bytes(), 0644))
+
+	zstdWriter, err := zstd.NewWriter(nil)
+	expect.NoError(err)
+	zstdName := filepath.Join(dir, "test.log.2.zst")
+	expect.NoError(ioutil.WriteFile(zstdName, zstdWriter.EncodeAll(content, nil), 0644))
+
+	plainName := filepath.Join(dir, "test.log")
+	expect.NoError(ioutil.WriteFile(plainName, content, 0644))
+
+	expect.True(isCompressedFile(gzipName))
+	expect.True(isCompressedFile(zstdName))
+	expect.False(isCompressedFile(plainName))
+
+	cons := newTestPlugin(expect, "consumer.File", "fileCompressed", map[string]interface{}{
+		"Files":          dir,
+		"Import":         true,
+		"OffsetFilePath": dir,
+	}).(*File)
+
+	expected := []string{"first", "second", "last without delimiter"}
+	expect.Equal(expected, readFileTestMessages(cons, gzipName))
+	expect.Equal(expected, readFileTestMessages(cons, zstdName))
+	expect.Equal(expected, readFileTestMessages(cons, plainName))
+}
+
+func TestFileImportOrder(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-file")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	for i, name := range []string{"c.log", "a.log", "b.log"} {
+		fileName := filepath.Join(dir, name)
+		expect.NoError(ioutil.WriteFile(fileName, []byte(name), 0644))
+		modTime := now.Add(time.Duration(i) * time.Minute)
+		expect.NoError(os.Chtimes(fileName, modTime, modTime))
+	}
+	expect.NoError(os.Mkdir(filepath.Join(dir, "subdir"), 0755))
+
+	fileNames, err := globFilesByModTime(dir)
+	expect.NoError(err)
+	expect.Equal([]string{
+		filepath.Join(dir, "c.log"),
+		filepath.Join(dir, "a.log"),
+		filepath.Join(dir, "b.log"),
+	}, fileNames)
+}
+
+func TestFileMultilineFlushOnStop(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-file")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "test.log")
+	expect.NoError(ioutil.WriteFile(name, []byte("2018-01-01 error\n  at a\n  at b\n"), 0644))
+
+	router := &httpTestRouter{streamID: core.GetStreamID("fileFlushOnStop")}
+	core.StreamRegistry.Register(router, router.streamID)
+
+	cons := newTestPlugin(expect, "consumer.File", "fileFlushOnStop", map[string]interface{}{
+		"Files":               name,
+		"Streams":             "fileFlushOnStop",
+		"DefaultOffset":       "oldest",
+		"PollingDelayMs":      10,
+		"Multiline/Pattern":   `^\d{4}-`,
+		"Multiline/TimeoutMs": 3600000,
+	}).(*File)
+
+	workers := new(sync.WaitGroup)
+	cons.SetWorkerWaitGroup(workers)
+	cons.AddWorker()
+	go cons.observeFile(name, stopIfNotExist)
+
+	time.Sleep(200 * time.Millisecond)
+	close(cons.done)
+	workers.Wait()
+
+	expect.Equal(1, len(router.messages))
+	if len(router.messages) == 1 {
+		expect.Equal("2018-01-01 error\n  at a\n  at b", string(router.messages[0].GetPayload()))
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"regexp"
+	"time"
+)
+
+const (
+	multilineModeStart    = "start"
+	multilineModeContinue = "continue"
+)
+
+// fileMultiline groups consecutive lines into one record. In "start" mode a
+// new record begins with each line matching the pattern, in "continue" mode
+// each line matching the pattern is appended to the previous record.
+// fileMultiline is not threadsafe.
+type fileMultiline struct {
+	pattern      *regexp.Regexp
+	continuation bool
+	timeout      time.Duration
+	maxLines     int
+	delimiter    []byte
+	enqueue      func([]byte)
+	record       []byte
+	lines        int
+	lastLine     time.Time
+}
+
+func newFileMultiline(pattern *regexp.Regexp, mode string, timeout time.Duration, maxLines int, delimiter string, enqueue func([]byte)) *fileMultiline {
+	return &fileMultiline{
+		pattern:      pattern,
+		continuation: mode == multilineModeContinue,
+		timeout:      timeout,
+		maxLines:     maxLines,
+		delimiter:    []byte(delimiter),
+		enqueue:      enqueue,
+	}
+}
+
+// add appends a line to the current record or starts a new one.
+func (ml *fileMultiline) add(line []byte) {
+	matches := ml.pattern.Match(line)
+	startsRecord := matches != ml.continuation
+
+	if ml.lines > 0 && (startsRecord || ml.lines >= ml.maxLines) {
+		ml.flush()
+	}
+
+	if ml.lines > 0 {
+		ml.record = append(ml.record, ml.delimiter...)
+	}
+	ml.record = append(ml.record, line...)
+	ml.lines++
+	ml.lastLine = time.Now()
+}
+
+// flush sends the current record, if any.
+func (ml *fileMultiline) flush() {
+	if ml.lines == 0 {
+		return
+	}
+	record := ml.record
+	ml.record = nil
+	ml.lines = 0
+	ml.enqueue(record)
+}
+
+// flushIdle sends the current record if no line has been added for longer
+// than the configured timeout.
+func (ml *fileMultiline) flushIdle() {
+	if ml.lines > 0 && time.Since(ml.lastLine) >= ml.timeout {
+		ml.flush()
+	}
+}
@@ -15,6 +15,8 @@
 package consumer
 
 import (
+	"bytes"
+	"compress/gzip"
 	"io"
 	"io/ioutil"
 	"os"
@@ -23,17 +25,34 @@ import (
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/klauspost/compress/zstd"
 	"github.com/sirupsen/logrus"
 	"github.com/trivago/tgo/tio"
 	"github.com/trivago/tgo/tsync"
 )
 
+const (
+	fileCompressionNone = ""
+	fileCompressionGzip = "gzip"
+	fileCompressionZstd = "zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
 type observableFile struct {
 	handle         *os.File
+	reader         io.Reader
+	decompressed   *countingReader
+	closeDecoder   func()
 	fileName       string
 	offsetFileName string
 	cursor         fileCursor
 	buffer         *tio.BufferedReader
+	delimiter      []byte
+	multiline      *fileMultiline
 	stopIfNotExist bool
 
 	lastStatCheck time.Time
@@ -47,13 +66,183 @@ type fileCursor struct {
 	offset int64
 }
 
+// countingReader counts the bytes read from a decompressed stream so that
+// offsets of compressed files can be stored.
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(data []byte) (int, error) {
+	n, err := r.reader.Read(data)
+	r.count += int64(n)
+	return n, err
+}
+
+// terminatedReader appends the delimiter to a stream that does not end with
+// it so that the last message of a file is not lost.
+type terminatedReader struct {
+	reader    io.Reader
+	delimiter []byte
+	tail      []byte
+	pending   []byte
+	eof       bool
+}
+
+func (r *terminatedReader) Read(data []byte) (int, error) {
+	if r.eof {
+		if len(r.pending) == 0 {
+			return 0, io.EOF
+		}
+		n := copy(data, r.pending)
+		r.pending = r.pending[n:]
+		return n, nil
+	}
+
+	n, err := r.reader.Read(data)
+	if n > 0 {
+		r.tail = append(r.tail, data[:n]...)
+		if len(r.tail) > len(r.delimiter) {
+			r.tail = r.tail[len(r.tail)-len(r.delimiter):]
+		}
+	}
+
+	if err == io.EOF {
+		r.eof = true
+		if len(r.tail) > 0 && !bytes.Equal(r.tail, r.delimiter) {
+			r.pending = r.delimiter
+		}
+		if n > 0 || len(r.pending) > 0 {
+			return n, nil
+		}
+	}
+	return n, err
+}
+
+// detectFileCompression returns the compression used by the given file based
+// on its magic bytes. The read position is reset to the start of the file.
+func detectFileCompression(handle *os.File) (string, error) {
+	magic := make([]byte, len(zstdMagic))
+	n, err := io.ReadFull(handle, magic)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return fileCompressionNone, err
+	}
+	if _, err := handle.Seek(0, io.SeekStart); err != nil {
+		return fileCompressionNone, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic[:n], gzipMagic):
+		return fileCompressionGzip, nil
+	case bytes.HasPrefix(magic[:n], zstdMagic):
+		return fileCompressionZstd, nil
+	default:
+		return fileCompressionNone, nil
+	}
+}
+
+// isCompressedFile returns true if the given file is gzip or zstd compressed.
+func isCompressedFile(fileName string) bool {
+	handle, err := os.Open(fileName)
+	if err != nil {
+		return false
+	}
+	defer handle.Close()
+
+	compression, _ := detectFileCompression(handle)
+	return compression != fileCompressionNone
+}
+
 func (fs *observableFile) close() error {
+	if fs.closeDecoder != nil {
+		fs.closeDecoder()
+		fs.closeDecoder = nil
+	}
 	if fs.handle != nil {
-		return fs.handle.Close()
+		err := fs.handle.Close()
+		fs.handle = nil
+		return err
+	}
+	return nil
+}
+
+// open opens the given file and moves to the current cursor position.
+// Compressed files are decompressed transparently. Offsets of compressed files
+// refer to the decompressed data.
+func (fs *observableFile) open(fileName string) error {
+	handle, err := os.OpenFile(fileName, os.O_RDONLY, 0444)
+	if err != nil {
+		return err
+	}
+
+	compression, err := detectFileCompression(handle)
+	if err != nil {
+		handle.Close()
+		return err
+	}
+
+	fs.handle = handle
+	fs.reader = handle
+	fs.decompressed = nil
+
+	var decoder io.Reader
+	switch compression {
+	case fileCompressionGzip:
+		gzipReader, err := gzip.NewReader(handle)
+		if err != nil {
+			fs.close()
+			return err
+		}
+		decoder = gzipReader
+		fs.closeDecoder = func() { gzipReader.Close() }
+
+	case fileCompressionZstd:
+		zstdReader, err := zstd.NewReader(handle)
+		if err != nil {
+			fs.close()
+			return err
+		}
+		decoder = zstdReader
+		fs.closeDecoder = zstdReader.Close
+
+	default:
+		if fs.cursor.offset, err = handle.Seek(fs.cursor.offset, fs.cursor.whence); err != nil {
+			fs.log.WithError(err).Warning("Failed to seek to given offset")
+		}
+		return nil // ### return, uncompressed ###
 	}
+
+	fs.decompressed = &countingReader{reader: decoder}
+	fs.reader = fs.decompressed
+
+	// Compressed files cannot seek, so data before the offset is skipped
+	switch fs.cursor.whence {
+	case io.SeekEnd:
+		_, err = io.Copy(ioutil.Discard, fs.reader)
+	default:
+		_, err = io.CopyN(ioutil.Discard, fs.reader, fs.cursor.offset)
+	}
+	if err != nil && err != io.EOF {
+		fs.log.WithError(err).Warning("Failed to skip to given offset")
+	}
+	fs.cursor.offset = fs.decompressed.count
 	return nil
 }
 
+// flush sends pending multiline records.
+func (fs *observableFile) flush() {
+	if fs.multiline != nil {
+		fs.multiline.flush()
+	}
+}
+
+// flushIdle sends pending multiline records after the multiline timeout.
+func (fs *observableFile) flushIdle() {
+	if fs.multiline != nil {
+		fs.multiline.flushIdle()
+	}
+}
+
 func (fs *observableFile) getActualFilename() string {
 	actualFileName := fs.fileName
 	if evalFileName, err := filepath.EvalSymlinks(actualFileName); err == nil {
@@ -86,7 +275,11 @@ func (fs *observableFile) hasRotated(currentName string) bool {
 }
 
 func (fs *observableFile) storeOffset() {
-	fs.cursor.offset, _ = fs.handle.Seek(0, io.SeekCurrent)
+	if fs.decompressed != nil {
+		fs.cursor.offset = fs.decompressed.count
+	} else {
+		fs.cursor.offset, _ = fs.handle.Seek(0, io.SeekCurrent)
+	}
 	offsetAsString := strconv.FormatInt(fs.cursor.offset, 10)
 	if err := ioutil.WriteFile(fs.offsetFileName, []byte(offsetAsString), 0644); err != nil {
 		fs.log.WithError(err).Error("Failed to store offset")
@@ -96,29 +289,23 @@ func (fs *observableFile) storeOffset() {
 func (fs *observableFile) scrape(fileName string, enqueue func([]byte), onRotate func()) {
 	// Try to open the current file
 	if fs.handle == nil {
-		handle, err := os.OpenFile(fileName, os.O_RDONLY, 0444)
-		if err != nil {
-			fs.log.Warning("Failed to open file")
+		if err := fs.open(fileName); err != nil {
+			fs.log.WithError(err).Warning("Failed to open file")
 			time.Sleep(fs.retryDelay)
 			return // wait between retries
 		}
-
-		if fs.cursor.offset, err = handle.Seek(fs.cursor.offset, fs.cursor.whence); err != nil {
-			fs.log.WithError(err).Warning("Failed to seek to given offset")
-		}
-		fs.handle = handle
 	}
 
 	// Try to scrape the file
-	err := fs.buffer.ReadAll(fs.handle, enqueue)
+	err := fs.buffer.ReadAll(fs.reader, enqueue)
 
 	switch err {
 	case nil:
 	case io.EOF:
 		if fs.hasRotated(fileName) {
 			fs.log.Info("File rotated")
-			fs.handle.Close()
-			fs.handle = nil
+			fs.flush()
+			fs.close()
 			fs.buffer.Reset(0)
 
 			fs.cursor.whence = io.SeekStart
@@ -128,12 +315,42 @@ func (fs *observableFile) scrape(fileName string, enqueue func([]byte), onRotate
 		}
 	default:
 		fs.log.WithError(err).Error("Failed to read file")
-		fs.handle.Close()
-		fs.handle = nil
+		fs.close()
 		fs.buffer.Reset(0)
 	}
 }
 
+// readToEnd reads the file once from the current cursor position to its end.
+// This is used for compressed files and in import mode. True is returned if
+// the file has been read completely.
+func (fs *observableFile) readToEnd(enqueue func([]byte), done <-chan struct{}) bool {
+	fs.log = fs.log.WithField("Reading", fs.fileName)
+	if err := fs.open(fs.fileName); err != nil {
+		fs.log.WithError(err).Error("Failed to open file")
+		return false
+	}
+
+	reader := &terminatedReader{reader: fs.reader, delimiter: fs.delimiter}
+	for {
+		select {
+		default:
+		case <-done:
+			return false // exit requested
+		}
+
+		switch err := fs.buffer.ReadAll(reader, enqueue); err {
+		case nil:
+		case io.EOF:
+			fs.flush()
+			fs.log.Info("File read completely")
+			return true
+		default:
+			fs.log.WithError(err).Error("Failed to read file")
+			return false
+		}
+	}
+}
+
 func (fs *observableFile) observePoll(enqueue func([]byte), done <-chan struct{}) {
 	spin := tsync.NewCustomSpinner(fs.pollDelay)
 	actualFileName := fs.getActualFilename()
@@ -163,6 +380,7 @@ func (fs *observableFile) observePoll(enqueue func([]byte), done <-chan struct{}
 		}
 
 		fs.scrape(actualFileName, enqueue, spin.Reset)
+		fs.flushIdle()
 		spin.Yield()
 	}
 }
@@ -176,6 +394,13 @@ func (fs *observableFile) observeFSNotify(enqueue func([]byte), done <-chan stru
 	defer notify.Close()
 	logger := fs.log
 
+	var idle <-chan time.Time
+	if fs.multiline != nil {
+		ticker := time.NewTicker(fs.multiline.timeout)
+		defer ticker.Stop()
+		idle = ticker.C
+	}
+
 	for {
 		select {
 		default:
@@ -226,6 +451,9 @@ func (fs *observableFile) observeFSNotify(enqueue func([]byte), done <-chan stru
 					})
 				}
 
+			case <-idle:
+				fs.flushIdle()
+
 			case err := <-notify.Errors:
 				fs.log.WithError(err).Error("Fsnotify reported an error")
 				rotated = true
@@ -0,0 +1,144 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"io"
+	"net"
+	"sync"
+
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/components"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// GRPC consumer
+//
+// This consumer accepts messages sent by producer.GRPC via the MessageService
+// defined in core/messageservice.proto. Messages are transferred in their
+// serialized form so that stream IDs, metadata, priority and timestamp are
+// preserved. Each batch is acknowledged after all of its messages have been
+// passed to gollum, so the sending producer is slowed down if this gollum
+// instance can not keep up.
+//
+// Parameters
+//
+// - Address: Defines the address to listen on.
+// By default this parameter is set to ":5890".
+//
+// - PreserveStreams: When set to true, messages are sent to the stream they
+// were assigned to when being sent by producer.GRPC. If set to false,
+// messages are sent to the streams configured by the "Streams" parameter.
+// By default this parameter is set to true.
+//
+// - MaxMessageSizeKB: Defines the maximum size of a batch that can be
+// received.
+// By default this parameter is set to 16384.
+//
+// Examples
+//
+// This example accepts mutual TLS secured connections from other gollum
+// instances.
+//
+//  GrpcIn:
+//    Type: consumer.GRPC
+//    Address: ":5890"
+//    TlsEnable: true
+//    TlsCertificateLocation: /etc/gollum/server.crt
+//    TlsKeyLocation: /etc/gollum/server.key
+//    TlsClientCaLocation: /etc/gollum/ca.crt
+//
+type GRPC struct {
+	core.SimpleConsumer `gollumdoc:"embed_type"`
+	TLS                 components.TLSServerConfig `gollumdoc:"embed_type"`
+	address             string                     `config:"Address" default:":5890"`
+	preserveStreams     bool                       `config:"PreserveStreams" default:"true"`
+	maxMessageSize      int                        `config:"MaxMessageSizeKB" default:"16384" metric:"kb"`
+	server              *grpc.Server
+}
+
+func init() {
+	core.TypeRegistry.Register(GRPC{})
+}
+
+// Configure initializes this consumer with values from a plugin config.
+func (cons *GRPC) Configure(conf core.PluginConfigReader) {
+	cons.SetStopCallback(cons.close)
+
+	options := []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(cons.maxMessageSize),
+	}
+	if tlsConfig := cons.TLS.GetConfig(); tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	cons.server = grpc.NewServer(options...)
+	core.RegisterMessageServiceServer(cons.server, cons)
+}
+
+// Forward implements the MessageService server interface
+func (cons *GRPC) Forward(stream core.MessageService_ForwardServer) error {
+	for {
+		batch, err := stream.Recv()
+		if err == io.EOF {
+			return nil // ### return, client closed stream ###
+		}
+		if err != nil {
+			return err // ### return, connection error ###
+		}
+
+		for _, serialized := range batch.GetMessages() {
+			msg := core.NewMessageFromSerialized(serialized)
+			if cons.preserveStreams {
+				cons.EnqueueMessage(msg)
+			} else {
+				cons.EnqueueWithMetadata(msg.GetPayload(), msg.TryGetMetadata())
+			}
+		}
+
+		ack := &core.SerializedMessageBatchAck{
+			Sequence: batch.Sequence,
+		}
+		if err := stream.Send(ack); err != nil {
+			return err // ### return, connection error ###
+		}
+	}
+}
+
+func (cons *GRPC) serve(listener net.Listener) {
+	defer cons.WorkerDone()
+
+	if err := cons.server.Serve(listener); err != nil && cons.IsActive() {
+		cons.Logger.WithError(err).Error("gRPC server stopped")
+	}
+}
+
+func (cons *GRPC) close() {
+	cons.server.Stop()
+}
+
+// Consume listens for connections of producer.GRPC
+func (cons *GRPC) Consume(workers *sync.WaitGroup) {
+	listener, err := net.Listen("tcp", cons.address)
+	if err != nil {
+		cons.Logger.WithError(err).Error("Failed to listen on ", cons.address)
+		return
+	}
+
+	cons.AddMainWorker(workers)
+	go cons.serve(listener)
+	cons.ControlLoop()
+}
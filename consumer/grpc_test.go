@@ -0,0 +1,36 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"testing"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestGRPCConfigure(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	cons := newTestPlugin(expect, "consumer.GRPC", "grpcDefault").(*GRPC)
+	expect.Equal(":5890", cons.address)
+	expect.True(cons.preserveStreams)
+	expect.Equal(16384<<10, cons.maxMessageSize)
+	expect.NotNil(cons.server)
+
+	_, err := tryNewTestPlugin("consumer.GRPC", "grpcTLS", map[string]interface{}{
+		"TlsEnable": true,
+	})
+	expect.NotNil(err)
+}
@@ -16,22 +16,42 @@ package consumer
 
 import (
 	"bytes"
+	"compress/gzip"
+	"crypto/subtle"
 	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/abbot/go-http-auth"
 	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/components"
 	"github.com/trivago/tgo/tnet"
 )
 
 // HTTP consumer plugin
 //
 // This consumer opens up an HTTP 1.1 server and processes the contents of any
-// incoming HTTP request.
+// incoming HTTP request. Request bodies may be gzip compressed if the
+// "Content-Encoding: gzip" header is set.
+//
+// Requests are answered with status 200 after all messages of a request have
+// been enqueued. If a producer listening to the target stream is blocked, the
+// request is rejected with status 429 so that clients can retry later.
+// Request bodies exceeding MaxBodySizeKB are rejected with status 413.
+//
+// Metadata
+//
+// - path: Contains the path of the request. This field is only set if Routes
+// is configured.
 //
 // Parameters
 //
@@ -48,17 +68,46 @@ import (
 // Gollum message. If false, relays only the HTTP request body and ignores
 // headers.
 //
+// - Split: Defines how a request body is split into messages. Set to "none"
+// to generate one message per request, "ndjson" to generate one message per
+// line, "json" to generate one message per element of a JSON array or "auto"
+// to choose by the request's Content-Type. Splitting requires WithHeaders to
+// be set to false.
+// By default this parameter is set to "none".
+//
+// - Routes: Defines a map of request paths to stream names. Messages from a
+// request to one of these paths are sent to the given stream. Requests to
+// other paths are rejected with status 404. If no routes are set, messages
+// from all paths are sent to the streams configured by the "Streams"
+// parameter.
+// By default this parameter is set to an empty map.
+//
 // - Htpasswd: Path to an htpasswd-formatted password file. If defined, turns
 // on HTTP Basic Authentication in the server.
 //
 // - BasicRealm: Defines the Authentication Realm for HTTP Basic Authentication.
 // Meaningful only in conjunction with Htpasswd.
 //
+// - BearerTokens: Defines a list of tokens accepted in an
+// "Authorization: Bearer" header. If Htpasswd is set, too, a request has to
+// pass one of both authentication methods.
+// By default this parameter is set to an empty list.
+//
+// - RetryAfterSec: Defines the value of the Retry-After header sent when a
+// request is rejected because of blocked producers.
+// By default this parameter is set to 1.
+//
+// - MaxBodySizeKB: Defines the maximum size of a request body in KB. The
+// limit applies to compressed and decompressed bodies.
+// By default this parameter is set to 4096.
+//
 // - Certificate: Path to an X509 formatted certificate file. If defined, turns on
 // SSL/TLS  support in the HTTP server. Requires PrivateKey to be set.
+// This parameter is deprecated, use TlsCertificateLocation instead.
 //
 // - PrivateKey: Path to an X509 formatted private key file. Meaningful only in
 // conjunction with Certificate.
+// This parameter is deprecated, use TlsKeyLocation instead.
 //
 // Examples
 //
@@ -70,13 +119,37 @@ import (
 //     Address: "localhost:9090"
 //     WithHeaders: false
 //
+// This example accepts NDJSON or JSON array batches from sensor gateways via
+// HTTPS and sends each record to the stream matching the request path.
+//
+//   "SensorGateway":
+//     Type: "consumer.HTTP"
+//     Address: ":8443"
+//     WithHeaders: false
+//     Split: auto
+//     BearerTokens:
+//       - "gateway-secret"
+//     TlsEnable: true
+//     TlsCertificateLocation: /etc/gollum/server.crt
+//     TlsKeyLocation: /etc/gollum/server.key
+//     Routes:
+//       /can: can
+//       /gps: gps
+//
 type HTTP struct {
 	core.SimpleConsumer `gollumdoc:"embed_type"`
-	address             string        `config:"Address" default:":80"`
-	readTimeoutSec      time.Duration `config:"ReadTimeoutSec" default:"3" metric:"sec"`
-	withHeaders         bool          `config:"WithHeaders" default:"true"`
-	htpasswd            string        `config:"Htpasswd"`
-	basicRealm          string        `config:"BasicRealm"`
+	TLS                 components.TLSServerConfig `gollumdoc:"embed_type"`
+	address             string                     `config:"Address" default:":80"`
+	readTimeoutSec      time.Duration              `config:"ReadTimeoutSec" default:"3" metric:"sec"`
+	withHeaders         bool                       `config:"WithHeaders" default:"true"`
+	split               string                     `config:"Split" default:"none"`
+	htpasswd            string                     `config:"Htpasswd"`
+	basicRealm          string                     `config:"BasicRealm"`
+	bearerTokens        []string                   `config:"BearerTokens"`
+	retryAfterSec       int                        `config:"RetryAfterSec" default:"1"`
+	maxBodySize         int                        `config:"MaxBodySizeKB" default:"4096" metric:"kb"`
+	routes              map[string]core.MessageStreamID
+	streams             []core.MessageStreamID
 	secrets             auth.SecretProvider
 	listen              *tnet.StopListener
 	certificate         *tls.Config
@@ -96,6 +169,22 @@ func (cons *HTTP) Configure(conf core.PluginConfigReader) {
 		cons.secrets = auth.HtpasswdFileProvider(cons.htpasswd)
 	}
 
+	cons.split = strings.ToLower(cons.split)
+	switch cons.split {
+	case "none", "ndjson", "json", "auto":
+	default:
+		conf.Errors.Pushf("Unknown split mode '%s'", cons.split)
+	}
+	if cons.split != "none" && cons.withHeaders {
+		conf.Errors.Pushf("Split requires WithHeaders to be set to false")
+	}
+
+	cons.streams = conf.GetStreamArray("Streams", []core.MessageStreamID{})
+	cons.routes = make(map[string]core.MessageStreamID)
+	for path, streamName := range conf.GetStringMap("Routes", map[string]string{}) {
+		cons.routes[normalizeHTTPPath(path)] = core.GetStreamID(streamName)
+	}
+
 	certificateFile := conf.GetString("Certificate", "")
 	keyFile := conf.GetString("PrivateKey", "")
 
@@ -105,7 +194,6 @@ func (cons *HTTP) Configure(conf core.PluginConfigReader) {
 		} else {
 
 			cons.certificate = new(tls.Config)
-			cons.certificate.NextProtos = []string{"http/1.1"}
 
 			keypair, err := tls.LoadX509KeyPair(certificateFile, keyFile)
 			if !conf.Errors.Push(err) {
@@ -113,51 +201,219 @@ func (cons *HTTP) Configure(conf core.PluginConfigReader) {
 			}
 		}
 	}
+
+	if tlsConfig := cons.TLS.GetConfig(); tlsConfig != nil {
+		if cons.certificate != nil {
+			conf.Errors.Pushf("Certificate and PrivateKey cannot be used together with TlsEnable")
+		}
+		cons.certificate = tlsConfig
+	}
+
+	if cons.certificate != nil {
+		cons.certificate.NextProtos = []string{"http/1.1"}
+	}
+}
+
+// normalizeHTTPPath makes sure a path starts with and does not end on "/"
+func normalizeHTTPPath(path string) string {
+	return "/" + strings.Trim(path, "/")
 }
 
 func (cons *HTTP) checkAuth(r *http.Request) bool {
-	a := &auth.BasicAuth{Realm: cons.basicRealm, Secrets: cons.secrets}
-	return a.CheckAuth(r) != ""
+	if len(cons.bearerTokens) > 0 {
+		header := r.Header.Get("Authorization")
+		if strings.HasPrefix(header, "Bearer ") {
+			token := []byte(strings.TrimPrefix(header, "Bearer "))
+			for _, expected := range cons.bearerTokens {
+				if subtle.ConstantTimeCompare(token, []byte(expected)) == 1 {
+					return true
+				}
+			}
+		}
+	}
+
+	if cons.htpasswd != "" {
+		a := &auth.BasicAuth{Realm: cons.basicRealm, Secrets: cons.secrets}
+		return a.CheckAuth(r) != ""
+	}
+
+	return false
+}
+
+// isBlocked returns true if any producer listening to the given stream is
+// blocked. If streamID is InvalidStreamID, the streams configured for this
+// consumer are checked.
+func (cons *HTTP) isBlocked(streamID core.MessageStreamID) bool {
+	streams := cons.streams
+	if streamID != core.InvalidStreamID {
+		streams = []core.MessageStreamID{streamID}
+	}
+
+	for _, streamID := range streams {
+		router, hasProducers := core.StreamRegistry.GetRouter(streamID).(interface {
+			GetProducers() []core.Producer
+		})
+		if !hasProducers {
+			continue
+		}
+		for _, prod := range router.GetProducers() {
+			if prod.IsBlocked() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// readBody reads the request body and decompresses it if required. The
+// returned status is used to answer failed requests. Bodies larger than
+// maxSize bytes before or after decompression are rejected with status 413.
+func readBody(resp http.ResponseWriter, req *http.Request, maxSize int64) ([]byte, int, error) {
+	data, err := ioutil.ReadAll(http.MaxBytesReader(resp, req.Body, maxSize))
+	if err != nil {
+		if int64(len(data)) >= maxSize {
+			return nil, http.StatusRequestEntityTooLarge, err
+		}
+		return nil, http.StatusBadRequest, err
+	}
+
+	if !strings.EqualFold(req.Header.Get("Content-Encoding"), "gzip") {
+		return data, http.StatusOK, nil // ### return, not compressed ###
+	}
+
+	gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	defer gzipReader.Close()
+
+	// Read one byte more than allowed to detect oversized content
+	if data, err = ioutil.ReadAll(io.LimitReader(gzipReader, maxSize+1)); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("Decompressed request body exceeds %d bytes", maxSize)
+	}
+	return data, http.StatusOK, nil
+}
+
+// splitBody splits a request body into records based on the given mode.
+func splitBody(body []byte, mode string, contentType string) ([][]byte, error) {
+	if mode == "auto" {
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		switch mediaType {
+		case "application/x-ndjson", "application/ndjson", "application/jsonl", "application/x-jsonlines":
+			mode = "ndjson"
+		case "application/json":
+			mode = "json"
+		default:
+			mode = "none"
+		}
+	}
+
+	switch mode {
+	case "ndjson":
+		records := [][]byte{}
+		for _, line := range bytes.Split(body, []byte("\n")) {
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				records = append(records, line)
+			}
+		}
+		return records, nil
+
+	case "json":
+		trimmed := bytes.TrimSpace(body)
+		if len(trimmed) == 0 || trimmed[0] != '[' {
+			return [][]byte{body}, nil // ### return, single document ###
+		}
+
+		elements := []json.RawMessage{}
+		if err := json.Unmarshal(trimmed, &elements); err != nil {
+			return nil, err
+		}
+		records := make([][]byte, len(elements))
+		for i, element := range elements {
+			records[i] = element
+		}
+		return records, nil
+
+	default:
+		return [][]byte{body}, nil
+	}
 }
 
 // requestHandler will handle a single web request.
 func (cons *HTTP) requestHandler(resp http.ResponseWriter, req *http.Request) {
-	if cons.htpasswd != "" {
+	if cons.htpasswd != "" || len(cons.bearerTokens) > 0 {
 		if !cons.checkAuth(req) {
 			resp.WriteHeader(http.StatusUnauthorized)
 			return
 		}
 	}
 
+	path := normalizeHTTPPath(req.URL.Path)
+	streamID := core.InvalidStreamID
+	if len(cons.routes) > 0 {
+		routeStreamID, isRouted := cons.routes[path]
+		if !isRouted {
+			resp.WriteHeader(http.StatusNotFound)
+			return // ### return, unknown path ###
+		}
+		streamID = routeStreamID
+	}
+
+	if cons.isBlocked(streamID) {
+		resp.Header().Set("Retry-After", strconv.Itoa(cons.retryAfterSec))
+		resp.WriteHeader(http.StatusTooManyRequests)
+		return // ### return, producers are blocked ###
+	}
+
+	// Read the message body
+	if req.Body == nil {
+		resp.WriteHeader(http.StatusBadRequest)
+		return // ### return, missing body ###
+	}
+
+	body, status, err := readBody(resp, req, int64(cons.maxBodySize))
+	req.Body.Close()
+	if err != nil {
+		resp.WriteHeader(status)
+		cons.Logger.Error(err)
+		return // ### return, missing body or bad write ###
+	}
+
+	var records [][]byte
 	if cons.withHeaders {
-		// Read the whole package
+		// Relay the whole request with the decompressed body
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+		req.Header.Del("Content-Encoding")
+
 		requestBuffer := bytes.NewBuffer(nil)
 		if err := req.Write(requestBuffer); err != nil {
 			resp.WriteHeader(http.StatusBadRequest)
 			cons.Logger.Error(err)
 			return // ### return, missing body or bad write ###
 		}
-
-		cons.Enqueue(requestBuffer.Bytes())
-		resp.WriteHeader(http.StatusOK)
+		records = [][]byte{requestBuffer.Bytes()}
 	} else {
-		// Read only the message body
-		if req.Body == nil {
-			resp.WriteHeader(http.StatusBadRequest)
-			return // ### return, missing body ###
-		}
-
-		body, err := ioutil.ReadAll(req.Body)
+		records, err = splitBody(body, cons.split, req.Header.Get("Content-Type"))
 		if err != nil {
 			resp.WriteHeader(http.StatusBadRequest)
-			cons.Logger.Error(err)
-			return // ### return, missing body or bad write ###
+			cons.Logger.WithError(err).Warning("Failed to split request body")
+			return // ### return, invalid body ###
 		}
-		defer req.Body.Close()
+	}
 
-		cons.Enqueue(body)
-		resp.WriteHeader(http.StatusOK)
+	for _, record := range records {
+		var metadata core.Metadata
+		if len(cons.routes) > 0 {
+			metadata = core.Metadata{}
+			metadata.SetValue("path", []byte(path))
+		}
+		cons.EnqueueWithStream(record, metadata, streamID)
 	}
+	resp.WriteHeader(http.StatusOK)
 }
 
 func (cons *HTTP) serve() {
@@ -170,14 +426,19 @@ func (cons *HTTP) serve() {
 		TLSConfig:   cons.certificate,
 	}
 
-	err := srv.Serve(cons.listen)
+	var err error
+	if cons.certificate != nil {
+		err = srv.ServeTLS(cons.listen, "", "")
+	} else {
+		err = srv.Serve(cons.listen)
+	}
 	if _, isStopRequest := err.(tnet.StopRequestError); err != nil && !isStopRequest {
 		cons.Logger.Error(err)
 	}
 }
 
 // Consume opens a new http server listen on specified ip and port (address)
-func (cons HTTP) Consume(workers *sync.WaitGroup) {
+func (cons *HTTP) Consume(workers *sync.WaitGroup) {
 	listen, err := tnet.NewStopListener(cons.address)
 	if err != nil {
 		cons.Logger.Error(err)
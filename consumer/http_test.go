@@ -0,0 +1,194 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/tgo/ttesting"
+)
+
+type httpTestRouter struct {
+	core.Router
+	streamID  core.MessageStreamID
+	producers []core.Producer
+	messages  []*core.Message
+}
+
+func (router *httpTestRouter) GetID() string                     { return "httpTestRouter" }
+func (router *httpTestRouter) GetStreamID() core.MessageStreamID { return router.streamID }
+func (router *httpTestRouter) GetProducers() []core.Producer     { return router.producers }
+func (router *httpTestRouter) Modulate(*core.Message) core.ModulateResult {
+	return core.ModulateResultContinue
+}
+func (router *httpTestRouter) Enqueue(msg *core.Message) error {
+	router.messages = append(router.messages, msg)
+	return nil
+}
+
+type httpTestProducer struct {
+	core.Producer
+	blocked bool
+}
+
+func (prod *httpTestProducer) IsBlocked() bool { return prod.blocked }
+
+func TestHTTPSplitBody(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	records, err := splitBody([]byte("{\"a\":1}\r\n\n{\"a\":2}\n"), "ndjson", "")
+	expect.NoError(err)
+	expect.Equal(2, len(records))
+	expect.Equal(`{"a":2}`, string(records[1]))
+
+	records, err = splitBody([]byte(` [{"a":1}, {"a":[2,3]}]`), "json", "")
+	expect.NoError(err)
+	expect.Equal(2, len(records))
+	expect.Equal(`{"a":[2,3]}`, string(records[1]))
+
+	records, err = splitBody([]byte(`{"a":1}`), "json", "")
+	expect.NoError(err)
+	expect.Equal(1, len(records))
+
+	_, err = splitBody([]byte(`[{"a":1}`), "json", "")
+	expect.NotNil(err)
+
+	records, err = splitBody([]byte("a\nb"), "auto", "application/x-ndjson; charset=utf-8")
+	expect.NoError(err)
+	expect.Equal(2, len(records))
+
+	records, err = splitBody([]byte("a\nb"), "auto", "text/plain")
+	expect.NoError(err)
+	expect.Equal(1, len(records))
+}
+
+func TestHTTPConfigure(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	_, err := tryNewTestPlugin("consumer.HTTP", "httpSplitWithHeaders", map[string]interface{}{
+		"Split": "ndjson",
+	})
+	expect.NotNil(err)
+
+	_, err = tryNewTestPlugin("consumer.HTTP", "httpTlsNoCert", map[string]interface{}{
+		"TlsEnable": true,
+	})
+	expect.NotNil(err)
+}
+
+func TestHTTPRequestHandler(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	producer := &httpTestProducer{}
+	router := &httpTestRouter{
+		streamID:  core.GetStreamID("httpTestCan"),
+		producers: []core.Producer{producer},
+	}
+	core.StreamRegistry.Register(router, router.streamID)
+
+	cons := newTestPlugin(expect, "consumer.HTTP", "httpHandler", map[string]interface{}{
+		"WithHeaders":  false,
+		"Split":        "auto",
+		"BearerTokens": []string{"secret"},
+		"Routes":       map[string]string{"/can": "httpTestCan"},
+	}).(*HTTP)
+
+	newRequest := func(path string, body []byte) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("Content-Type", "application/json")
+		return req
+	}
+
+	// Authentication
+	resp := httptest.NewRecorder()
+	req := newRequest("/can", []byte(`{}`))
+	req.Header.Set("Authorization", "Bearer wrong")
+	cons.requestHandler(resp, req)
+	expect.Equal(http.StatusUnauthorized, resp.Code)
+
+	// Unknown path
+	resp = httptest.NewRecorder()
+	cons.requestHandler(resp, newRequest("/gps", []byte(`{}`)))
+	expect.Equal(http.StatusNotFound, resp.Code)
+
+	// Gzip compressed JSON array
+	compressed := bytes.Buffer{}
+	writer := gzip.NewWriter(&compressed)
+	writer.Write([]byte(`[{"id":1},{"id":2}]`))
+	writer.Close()
+
+	resp = httptest.NewRecorder()
+	req = newRequest("/can/", compressed.Bytes())
+	req.Header.Set("Content-Encoding", "gzip")
+	cons.requestHandler(resp, req)
+	expect.Equal(http.StatusOK, resp.Code)
+	expect.Equal(2, len(router.messages))
+	expect.Equal(`{"id":2}`, router.messages[1].String())
+	expect.Equal("/can", router.messages[1].GetMetadata().GetValueString("path"))
+
+	// Backpressure
+	producer.blocked = true
+	resp = httptest.NewRecorder()
+	cons.requestHandler(resp, newRequest("/can", []byte(`{"id":3}`)))
+	expect.Equal(http.StatusTooManyRequests, resp.Code)
+	expect.Equal("1", resp.Header().Get("Retry-After"))
+	expect.Equal(2, len(router.messages))
+}
+
+func TestHTTPBodySizeLimit(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	router := &httpTestRouter{streamID: core.GetStreamID("httpTestLimit")}
+	core.StreamRegistry.Register(router, router.streamID)
+
+	cons := newTestPlugin(expect, "consumer.HTTP", "httpLimit", map[string]interface{}{
+		"Streams":       []string{"httpTestLimit"},
+		"WithHeaders":   false,
+		"MaxBodySizeKB": 1,
+	}).(*HTTP)
+
+	// Body within the limit, no path metadata without routes
+	resp := httptest.NewRecorder()
+	cons.requestHandler(resp, httptest.NewRequest(http.MethodPost, "/can", bytes.NewReader([]byte("rpm=9000"))))
+	expect.Equal(http.StatusOK, resp.Code)
+	expect.Equal(1, len(router.messages))
+	expect.Equal("rpm=9000", router.messages[0].String())
+	expect.Nil(router.messages[0].TryGetMetadata())
+
+	// Body exceeding the limit
+	resp = httptest.NewRecorder()
+	cons.requestHandler(resp, httptest.NewRequest(http.MethodPost, "/can", bytes.NewReader(make([]byte, 1025))))
+	expect.Equal(http.StatusRequestEntityTooLarge, resp.Code)
+
+	// Compressed body exceeding the limit after decompression
+	compressed := bytes.Buffer{}
+	writer := gzip.NewWriter(&compressed)
+	writer.Write(make([]byte, 1025))
+	writer.Close()
+	expect.Less(compressed.Len(), 1024)
+
+	resp = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/can", bytes.NewReader(compressed.Bytes()))
+	req.Header.Set("Content-Encoding", "gzip")
+	cons.requestHandler(resp, req)
+	expect.Equal(http.StatusRequestEntityTooLarge, resp.Code)
+	expect.Equal(1, len(router.messages))
+}
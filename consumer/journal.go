@@ -0,0 +1,389 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/tgo"
+)
+
+const (
+	journalOffsetOldest   = "oldest"
+	journalOffsetNewest   = "newest"
+	journalFieldMessage   = "MESSAGE"
+	journalFieldCursor    = "__CURSOR"
+	journalFieldRealtime  = "__REALTIME_TIMESTAMP"
+	journalMaxFieldLength = 1 << 26
+)
+
+// Journal consumer plugin
+//
+// The Journal consumer reads entries from the systemd journal. In contrast to
+// native.Systemd this consumer does not require cgo or libsystemd. Entries
+// are read by running journalctl with the export output format, so the
+// journalctl binary has to be available on the target system.
+//
+// The MESSAGE field of each entry is used as payload. All other journal fields
+// are added to the message metadata. Field names are converted to lower case
+// and leading underscores are removed, i.e. "_SYSTEMD_UNIT" is stored as
+// "systemd_unit".
+//
+// If journalctl exits, e.g. because the journal was vacuumed, it is restarted
+// after RetryDelaySec, continuing after the last entry read.
+//
+// Metadata
+//
+// - timestamp: The time the entry was written to the journal (set)
+//
+// - <field>: The value of each journal field, see Fields (set)
+//
+// Parameters
+//
+// - Units: Defines the systemd units to read entries from. If empty, entries
+// of all units are read.
+// By default this parameter is set to an empty list.
+//
+// - Priorities: Defines the priority or range of priorities entries must have,
+// e.g. "warning", "3" or "0..4". If empty, entries of all priorities are read.
+// By default this parameter is set to "".
+//
+// - Matches: Defines additional journal matches in the form "FIELD=value", e.g.
+// "_HOSTNAME=daq". Matches on different fields must all be fulfilled, matches
+// on the same field are alternatives.
+// By default this parameter is set to an empty list.
+//
+// - Fields: Defines the journal fields that are added to the metadata. If
+// empty, all fields are added.
+// By default this parameter is set to an empty list.
+//
+// - CursorFile: Defines a file to store the cursor of the last entry read. If
+// the consumer is restarted, reading continues after this entry. Set to "" to
+// disable.
+// By default this parameter is set to "".
+//
+// - DefaultOffset: Defines where to start reading if no cursor is stored. Valid
+// values are "oldest" and "newest".
+// By default this parameter is set to "newest".
+//
+// - Directory: Defines a directory containing journal files to read instead of
+// the system journal, e.g. a journal copied from another machine.
+// By default this parameter is set to "".
+//
+// - Follow: When set to true, the consumer waits for new entries. Otherwise
+// the consumer stops after the last entry has been read.
+// By default this parameter is set to true.
+//
+// - ExitOnEOF: When set to true, gollum shuts down after the last entry has
+// been read. This setting is only used if Follow is set to false.
+// By default this parameter is set to true.
+//
+// - RetryDelaySec: Defines the number of seconds to wait before restarting
+// journalctl after it exited.
+// By default this parameter is set to 3.
+//
+// - Journalctl: Defines the path to the journalctl binary.
+// By default this parameter is set to "journalctl".
+//
+// Examples
+//
+// This example reads all entries of the DAQ services with priority notice or
+// higher and continues where it stopped after a restart:
+//
+//  JournalIn:
+//    Type: consumer.Journal
+//    Streams: daq
+//    Units:
+//      - daq-logger.service
+//      - daq-telemetry.service
+//    Priorities: notice
+//    CursorFile: /var/lib/gollum/journal.cursor
+//    DefaultOffset: oldest
+//
+type Journal struct {
+	core.SimpleConsumer `gollumdoc:"embed_type"`
+
+	units         []string      `config:"Units"`
+	priorities    string        `config:"Priorities"`
+	matches       []string      `config:"Matches"`
+	fields        []string      `config:"Fields"`
+	cursorFile    string        `config:"CursorFile"`
+	defaultOffset string        `config:"DefaultOffset" default:"newest"`
+	directory     string        `config:"Directory"`
+	follow        bool          `config:"Follow" default:"true"`
+	exitOnEOF     bool          `config:"ExitOnEOF" default:"true"`
+	retryDelay    time.Duration `config:"RetryDelaySec" default:"3" metric:"s"`
+	journalctl    string        `config:"Journalctl" default:"journalctl"`
+
+	fieldFilter map[string]bool
+	cursor      string
+	done        chan struct{}
+}
+
+func init() {
+	core.TypeRegistry.Register(Journal{})
+}
+
+// Configure initializes this consumer with values from a plugin config.
+func (cons *Journal) Configure(conf core.PluginConfigReader) {
+	cons.done = make(chan struct{})
+	cons.SetStopCallback(func() {
+		close(cons.done)
+	})
+
+	cons.defaultOffset = strings.ToLower(cons.defaultOffset)
+	switch cons.defaultOffset {
+	case journalOffsetOldest, journalOffsetNewest:
+	default:
+		conf.Errors.Pushf("Unknown default offset '%s'", cons.defaultOffset)
+	}
+
+	for _, match := range cons.matches {
+		if !strings.Contains(match, "=") {
+			conf.Errors.Pushf("Invalid journal match '%s', expected FIELD=value", match)
+		}
+	}
+
+	if len(cons.fields) > 0 {
+		cons.fieldFilter = make(map[string]bool, len(cons.fields))
+		for _, field := range cons.fields {
+			cons.fieldFilter[strings.ToUpper(field)] = true
+		}
+	}
+
+	if cons.cursorFile != "" {
+		cursor, err := ioutil.ReadFile(cons.cursorFile)
+		switch {
+		case err == nil:
+			cons.cursor = strings.TrimSpace(string(cursor))
+		case !os.IsNotExist(err):
+			cons.Logger.WithError(err).Errorf("Failed to read cursor file %s", cons.cursorFile)
+		}
+	}
+}
+
+// journalctlArgs returns the journalctl arguments to read the configured
+// entries, starting after the last cursor read.
+func (cons *Journal) journalctlArgs() []string {
+	args := []string{"--output=export", "--quiet"}
+	if cons.follow {
+		args = append(args, "--follow")
+	}
+
+	switch {
+	case cons.cursor != "":
+		args = append(args, "--after-cursor="+cons.cursor, "--no-tail")
+	case cons.defaultOffset == journalOffsetOldest:
+		args = append(args, "--no-tail")
+	default:
+		args = append(args, "--lines=0")
+	}
+
+	if cons.directory != "" {
+		args = append(args, "--directory="+cons.directory)
+	}
+	for _, unit := range cons.units {
+		args = append(args, "--unit="+unit)
+	}
+	if cons.priorities != "" {
+		args = append(args, "--priority="+cons.priorities)
+	}
+	return append(args, cons.matches...)
+}
+
+// readJournalEntry reads one entry in the journal export format. Fields are
+// stored as "NAME=value" lines, fields containing binary data as the name
+// followed by a newline, a little endian 64 bit length, the data and another
+// newline. Entries are separated by an empty line.
+func readJournalEntry(reader *bufio.Reader) (map[string][]byte, error) {
+	entry := make(map[string][]byte)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			if err == io.EOF && len(line) == 0 {
+				if len(entry) > 0 {
+					return entry, nil
+				}
+				return nil, io.EOF
+			}
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+
+		line = line[:len(line)-1]
+		if len(line) == 0 {
+			if len(entry) > 0 {
+				return entry, nil
+			}
+			continue // skip leading empty lines
+		}
+
+		if idx := bytes.IndexByte(line, '='); idx >= 0 {
+			entry[string(line[:idx])] = append([]byte(nil), line[idx+1:]...)
+			continue
+		}
+
+		var length uint64
+		if err := binary.Read(reader, binary.LittleEndian, &length); err != nil {
+			return nil, fmt.Errorf("failed to read length of field %s: %s", line, err)
+		}
+		if length > journalMaxFieldLength {
+			return nil, fmt.Errorf("field %s exceeds maximum length (%d bytes)", line, length)
+		}
+
+		value := make([]byte, length+1)
+		if _, err := io.ReadFull(reader, value); err != nil {
+			return nil, fmt.Errorf("failed to read field %s: %s", line, err)
+		}
+		if value[length] != '\n' {
+			return nil, fmt.Errorf("field %s is not terminated by a newline", line)
+		}
+		entry[string(line)] = value[:length]
+	}
+}
+
+// journalMetadataKey converts a journal field name to a metadata key.
+func journalMetadataKey(field string) string {
+	return strings.ToLower(strings.TrimLeft(field, "_"))
+}
+
+func (cons *Journal) enqueueEntry(entry map[string][]byte) {
+	metadata := core.Metadata{}
+	if usec, err := strconv.ParseInt(string(entry[journalFieldRealtime]), 10, 64); err == nil {
+		metadata.SetTime("timestamp", time.Unix(0, usec*int64(time.Microsecond)))
+	}
+
+	for field, value := range entry {
+		if field == journalFieldMessage {
+			continue
+		}
+		if cons.fieldFilter != nil && !cons.fieldFilter[field] {
+			continue
+		}
+		metadata.SetValue(journalMetadataKey(field), value)
+	}
+
+	cons.EnqueueWithMetadata(entry[journalFieldMessage], metadata)
+
+	if cursor, ok := entry[journalFieldCursor]; ok {
+		cons.storeCursor(string(cursor))
+	}
+}
+
+func (cons *Journal) storeCursor(cursor string) {
+	cons.cursor = cursor
+	if cons.cursorFile == "" {
+		return
+	}
+	if err := ioutil.WriteFile(cons.cursorFile, []byte(cursor), 0644); err != nil {
+		cons.Logger.WithError(err).Error("Failed to store cursor")
+	}
+}
+
+// runJournalctl starts journalctl and enqueues all entries read until it
+// exits or the consumer is stopped.
+func (cons *Journal) runJournalctl() error {
+	cmd := exec.Command(cons.journalctl, cons.journalctlArgs()...)
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	exited := make(chan struct{})
+	defer close(exited)
+	go func() {
+		select {
+		case <-cons.done:
+			cmd.Process.Kill()
+		case <-exited:
+		}
+	}()
+
+	reader := bufio.NewReader(stdout)
+	for {
+		entry, err := readJournalEntry(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// The stream cannot be resynchronized, so restart at the last cursor
+			cmd.Process.Kill()
+			cmd.Wait()
+			return err
+		}
+		cons.enqueueEntry(entry)
+	}
+
+	if err := cmd.Wait(); err != nil {
+		select {
+		case <-cons.done:
+			return nil // killed on stop
+		default:
+		}
+		return fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func (cons *Journal) readJournal() {
+	defer cons.WorkerDone()
+
+	for {
+		err := cons.runJournalctl()
+		if err != nil {
+			cons.Logger.WithError(err).Error("Failed to read journal")
+		}
+
+		if !cons.follow && err == nil {
+			if cons.exitOnEOF {
+				tgo.ShutdownCallback()
+			}
+			return
+		}
+
+		select {
+		case <-cons.done:
+			return
+		case <-time.After(cons.retryDelay):
+		}
+	}
+}
+
+// Consume starts reading the journal
+func (cons *Journal) Consume(workers *sync.WaitGroup) {
+	cons.AddMainWorker(workers)
+	go tgo.WithRecoverShutdown(cons.readJournal)
+	cons.ControlLoop()
+}
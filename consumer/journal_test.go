@@ -0,0 +1,168 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func journalTestExport() []byte {
+	export := new(bytes.Buffer)
+	export.WriteString("__CURSOR=s=1;i=1\n")
+	export.WriteString("__REALTIME_TIMESTAMP=1531562400000000\n")
+	export.WriteString("_SYSTEMD_UNIT=daq-logger.service\n")
+	export.WriteString("PRIORITY=6\n")
+	export.WriteString("MESSAGE=logger started\n")
+	export.WriteString("\n")
+
+	binaryMessage := []byte("line one\nline two")
+	export.WriteString("__CURSOR=s=1;i=2\n")
+	export.WriteString("__REALTIME_TIMESTAMP=1531562401000000\n")
+	export.WriteString("_SYSTEMD_UNIT=daq-telemetry.service\n")
+	export.WriteString("MESSAGE\n")
+	binary.Write(export, binary.LittleEndian, uint64(len(binaryMessage)))
+	export.Write(binaryMessage)
+	export.WriteString("\n")
+	export.WriteString("PRIORITY=3\n")
+	export.WriteString("\n")
+	return export.Bytes()
+}
+
+func TestJournalReadEntry(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	reader := bufio.NewReader(bytes.NewReader(journalTestExport()))
+
+	entry, err := readJournalEntry(reader)
+	expect.NoError(err)
+	expect.Equal("logger started", string(entry["MESSAGE"]))
+	expect.Equal("daq-logger.service", string(entry["_SYSTEMD_UNIT"]))
+	expect.Equal("s=1;i=1", string(entry["__CURSOR"]))
+
+	entry, err = readJournalEntry(reader)
+	expect.NoError(err)
+	expect.Equal("line one\nline two", string(entry["MESSAGE"]))
+	expect.Equal("3", string(entry["PRIORITY"]))
+
+	_, err = readJournalEntry(reader)
+	expect.Equal(io.EOF, err)
+}
+
+func TestJournalReadEntryTruncated(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	// A final entry without separator is complete
+	reader := bufio.NewReader(strings.NewReader("MESSAGE=last\n"))
+	entry, err := readJournalEntry(reader)
+	expect.NoError(err)
+	expect.Equal("last", string(entry["MESSAGE"]))
+
+	reader = bufio.NewReader(strings.NewReader("MESSAGE=la"))
+	_, err = readJournalEntry(reader)
+	expect.Equal(io.ErrUnexpectedEOF, err)
+
+	reader = bufio.NewReader(strings.NewReader("MESSAGE\n\x10\x00\x00\x00\x00\x00\x00\x00short"))
+	_, err = readJournalEntry(reader)
+	expect.NotNil(err)
+}
+
+func TestJournalArgs(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	cons := newTestPlugin(expect, "consumer.Journal", "journalArgs", map[string]interface{}{
+		"Units":      []string{"daq-logger.service", "daq-telemetry.service"},
+		"Priorities": "0..4",
+		"Matches":    []string{"_HOSTNAME=daq"},
+	}).(*Journal)
+
+	args := strings.Join(cons.journalctlArgs(), " ")
+	expect.Equal("--output=export --quiet --follow --lines=0 --unit=daq-logger.service "+
+		"--unit=daq-telemetry.service --priority=0..4 _HOSTNAME=daq", args)
+
+	cons.storeCursor("s=1;i=2")
+	expect.Contains(cons.journalctlArgs(), "--after-cursor=s=1;i=2")
+	expect.Contains(cons.journalctlArgs(), "--no-tail")
+
+	_, err := tryNewTestPlugin("consumer.Journal", "journalArgsInvalid", map[string]interface{}{
+		"Matches": []string{"daq"},
+	})
+	expect.NotNil(err)
+}
+
+func TestJournalConsume(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	router := &httpTestRouter{streamID: core.GetStreamID("journalConsume")}
+	core.StreamRegistry.Register(router, router.streamID)
+
+	dir, err := ioutil.TempDir("", "gollum-journal")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	exportFile := filepath.Join(dir, "export")
+	argsFile := filepath.Join(dir, "args")
+	expect.NoError(ioutil.WriteFile(exportFile, journalTestExport(), 0644))
+
+	script := filepath.Join(dir, "journalctl")
+	expect.NoError(ioutil.WriteFile(script, []byte("#!/bin/sh\necho \"$@\" > "+argsFile+"\ncat "+exportFile+"\n"), 0755))
+
+	cursorFile := filepath.Join(dir, "journal.cursor")
+	settings := map[string]interface{}{
+		"Streams":       []string{"journalConsume"},
+		"Journalctl":    script,
+		"CursorFile":    cursorFile,
+		"DefaultOffset": "oldest",
+		"Follow":        false,
+		"Fields":        []string{"_SYSTEMD_UNIT", "PRIORITY"},
+	}
+
+	cons := newTestPlugin(expect, "consumer.Journal", "journalConsume", settings).(*Journal)
+	expect.NoError(cons.runJournalctl())
+
+	expect.Equal(2, len(router.messages))
+	expect.Equal("logger started", router.messages[0].String())
+	expect.Equal("line one\nline two", router.messages[1].String())
+
+	metadata := router.messages[1].GetMetadata()
+	expect.Equal("daq-telemetry.service", metadata.GetValueString("systemd_unit"))
+	expect.Equal("3", metadata.GetValueString("priority"))
+	expect.Equal("", metadata.GetValueString("cursor"))
+
+	timestamp := metadata.GetTime("timestamp")
+	expect.Equal(time.Date(2018, 7, 14, 10, 0, 1, 0, time.UTC).Unix(), timestamp.Unix())
+
+	cursor, err := ioutil.ReadFile(cursorFile)
+	expect.NoError(err)
+	expect.Equal("s=1;i=2", string(cursor))
+
+	// A restarted consumer continues after the stored cursor
+	restarted := newTestPlugin(expect, "consumer.Journal", "journalConsumeRestart", settings).(*Journal)
+	expect.NoError(restarted.runJournalctl())
+
+	args, err := ioutil.ReadFile(argsFile)
+	expect.NoError(err)
+	expect.True(strings.Contains(string(args), "--after-cursor=s=1;i=2"))
+}
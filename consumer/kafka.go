@@ -15,6 +15,7 @@
 package consumer
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
@@ -28,7 +29,6 @@ import (
 	"time"
 
 	kafka "github.com/Shopify/sarama"
-	cluster "github.com/bsm/sarama-cluster"
 	"github.com/trivago/gollum/core"
 	"github.com/trivago/tgo/tsync"
 )
@@ -43,6 +43,20 @@ const (
 // This consumer reads data from a kafka topic. It is based on the sarama
 // library; most settings are mapped to the settings from this library.
 //
+// If GroupId is set, the partitions of the topic are shared between all
+// consumers using the same group. Partitions are reassigned whenever a member
+// joins or leaves the group. The offset of a message is marked after the
+// message and all its copies have been released by the producers, i.e. after
+// they have been delivered, passed to a fallback or discarded. Offsets are
+// marked in order, so an offset is not marked before all messages read before
+// it have been released. Marked offsets are committed to kafka every
+// CommitIntervalMs and before partitions are revoked. Messages consumed after
+// the last commit are read again after a crash or a rebalance, i.e. delivery
+// is at-least-once. Assigned
+// partitions are exposed by the metrics "<id>.partitions" (number of assigned
+// partitions), "<id>.partition.<topic>.<partition>" (1 if assigned, 0
+// otherwise) and "<id>.rebalances".
+//
 // Metadata
 //
 // *NOTE: The metadata will only set if the parameter `SetMetadata` is active.*
@@ -51,6 +65,14 @@ const (
 //
 // - key: Contains the key of the kafka message
 //
+// - partition: Contains the partition the message was read from
+//
+// - offset: Contains the offset of the message within its partition
+//
+// - <HeaderPrefix><header>: Each record header is stored using its key
+// prefixed by HeaderPrefix. Headers that would overwrite one of the fields
+// above are ignored. Headers require kafka version 0.11 or newer.
+//
 // Parameters
 //
 // - Servers: Defines the list of all kafka brokers to initially connect to when
@@ -65,13 +87,26 @@ const (
 // By default this parameter is set to "gollum".
 //
 // - GroupId: Sets the consumer group of this consumer. If empty, consumer
-// groups are not used. This setting requires Kafka version >= 0.9.
+// groups are not used. If set, OffsetFile and Ordered are ignored.
+// This setting requires Kafka version >= 0.10.2.
 // By default this parameter is set to "".
 //
+// - GroupRebalanceStrategy: Defines how partitions are assigned to the members
+// of a consumer group. Valid values are "range", "roundrobin" and "sticky".
+// By default this parameter is set to "range".
+//
+// - CommitIntervalMs: Defines the interval in milliseconds in which marked
+// offsets are committed to the consumer group.
+// By default this parameter is set to 1000.
+//
+// - RetryDelaySec: Defines the number of seconds to wait before rejoining a
+// consumer group after an error.
+// By default this parameter is set to 3.
+//
 // - Version: Defines the kafka protocol version to use. Common values are 0.8.2,
-// 0.9.0 or 0.10.0. Values of the form "A.B" are allowed as well as "A.B.C"
-// and "A.B.C.D". If the version given is not known, the closest possible
-// version is chosen. If GroupId is set to a value < "0.9", "0.9.0.1" will be used.
+// 0.9.0, 0.10.0 or 2.0.0. Values of the form "A.B" are allowed as well as
+// "A.B.C" and "A.B.C.D". If the version given is not known, 0.8.2 is used.
+// If GroupId is set to a value < "0.10.2", "0.10.2.0" will be used.
 // By default this parameter is set to "0.8.2".
 //
 // - SetMetadata: When this value is set to "true", the fields mentioned in the metadata
@@ -79,6 +114,11 @@ const (
 // performance impact on systems with high throughput.
 // By default this parameter is set to "false".
 //
+// - HeaderPrefix: Defines a prefix added to the keys of record headers stored
+// as metadata. Use a prefix if headers may use the names of other metadata
+// fields like "topic" or "key".
+// By default this parameter is set to "".
+//
 // - DefaultOffset: Defines the initial offest when starting to read the topic.
 // Valid values are "oldest" and "newest". If OffsetFile
 // is defined and the file exists, the DefaultOffset parameter is ignored.
@@ -129,8 +169,8 @@ const (
 //
 // - PresistTimoutMs: Defines the interval in milliseconds in which data is
 // written to the OffsetFile. A short duration reduces the amount of duplicate
-// messages after a crash but increases I/O. When using GroupId this setting
-// controls the pause time after receiving errors.
+// messages after a crash but increases I/O. This setting is not used with
+// GroupId.
 // By default this parameter is set to 5000.
 //
 // - ElectRetries: Defines how many times to retry fetching the new master
@@ -195,13 +235,29 @@ const (
 //      - "kafka1:9092"
 //      - "kafka2:9092"
 //      - "kafka3:9092"
+//
+// This config shares the partitions of the topic "telemetry" between all
+// gollum instances using the group "pit".
+//
+//  kafkaIn:
+//    Type: consumer.Kafka
+//    Streams: telemetry
+//    Topic: telemetry
+//    GroupId: pit
+//    Version: "2.0.0"
+//    DefaultOffset: oldest
+//    SetMetadata: true
+//    Servers:
+//      - "kafka0:9092"
+//      - "kafka1:9092"
 type Kafka struct {
 	core.SimpleConsumer `gollumdoc:"embed_type"`
 	client              kafka.Client
 	consumer            kafka.Consumer
 	config              *kafka.Config
-	groupClient         *cluster.Client
-	groupConfig         *cluster.Config
+	consumerGroup       kafka.ConsumerGroup
+	groupHandler        *kafkaGroupHandler
+	stopGroup           context.CancelFunc
 	offsets             map[int32]*int64
 	servers             []string `config:"Servers"`
 	topic               string   `config:"Topic" default:"default"`
@@ -209,10 +265,13 @@ type Kafka struct {
 	offsetFile          string   `config:"OffsetFile"`
 	defaultOffset       int64
 	persistTimeout      time.Duration `config:"PresistTimoutMs" default:"5000" metric:"ms"`
+	commitInterval      time.Duration `config:"CommitIntervalMs" default:"1000" metric:"ms"`
+	retryDelay          time.Duration `config:"RetryDelaySec" default:"3" metric:"s"`
 	folderPermissions   os.FileMode   `config:"FolderPermissions" default:"0755"`
 	MaxPartitionID      int32
-	orderedRead         bool `config:"Ordered"`
-	hasToSetMetadata    bool `config:"SetMetadata" default:"false"`
+	orderedRead         bool   `config:"Ordered"`
+	hasToSetMetadata    bool   `config:"SetMetadata" default:"false"`
+	headerPrefix        string `config:"HeaderPrefix"`
 }
 
 func init() {
@@ -252,8 +311,12 @@ func (cons *Kafka) Configure(conf core.PluginConfigReader) {
 	case "1", "1.0", "1.0.0", "1.0.0.0":
 		cons.config.Version = kafka.V1_0_0_0
 	default:
-		cons.Logger.Warningf("Unknown kafka version given: %s. Falling back to 0.8.2", ver)
-		cons.config.Version = kafka.V0_8_2_2
+		if version, err := kafka.ParseKafkaVersion(ver); err == nil {
+			cons.config.Version = version
+		} else {
+			cons.Logger.Warningf("Unknown kafka version given: %s. Falling back to 0.8.2", ver)
+			cons.config.Version = kafka.V0_8_2_2
+		}
 	}
 
 	cons.config.Net.MaxOpenRequests = int(conf.GetInt("MaxOpenRequests", 5))
@@ -319,18 +382,6 @@ func (cons *Kafka) Configure(conf core.PluginConfigReader) {
 	cons.config.Consumer.Fetch.Default = int32(conf.GetInt("DefaultFetchSizeByte", 32768))
 	cons.config.Consumer.MaxWaitTime = time.Duration(conf.GetInt("FetchTimeoutMs", 250)) * time.Millisecond
 
-	if cons.group != "" {
-		cons.offsetFile = "" // forcibly ignore this option
-		switch cons.config.Version {
-		case kafka.V0_8_2_0, kafka.V0_8_2_1, kafka.V0_8_2_2:
-			cons.Logger.Warning("Invalid kafka version 0.8.x given, minimum is 0.9 for consumer groups, defaulting to 0.9.0.1")
-			cons.config.Version = kafka.V0_9_0_1
-		}
-
-		cons.groupConfig = cluster.NewConfig()
-		cons.groupConfig.Config = *cons.config
-	}
-
 	offsetValue := strings.ToLower(conf.GetString("DefaultOffset", kafkaOffsetNewest))
 	switch offsetValue {
 	case kafkaOffsetNewest:
@@ -343,6 +394,37 @@ func (cons *Kafka) Configure(conf core.PluginConfigReader) {
 		cons.defaultOffset, _ = strconv.ParseInt(offsetValue, 10, 64)
 	}
 
+	if cons.group != "" {
+		cons.offsetFile = "" // forcibly ignore this option
+		if !cons.config.Version.IsAtLeast(kafka.V0_10_2_0) {
+			cons.Logger.Warningf("Invalid kafka version %s given, minimum is 0.10.2 for consumer groups, defaulting to 0.10.2.0", cons.config.Version)
+			cons.config.Version = kafka.V0_10_2_0
+		}
+
+		switch strategy := strings.ToLower(conf.GetString("GroupRebalanceStrategy", "range")); strategy {
+		case "range":
+			cons.config.Consumer.Group.Rebalance.Strategy = kafka.BalanceStrategyRange
+		case "roundrobin":
+			cons.config.Consumer.Group.Rebalance.Strategy = kafka.BalanceStrategyRoundRobin
+		case "sticky":
+			cons.config.Consumer.Group.Rebalance.Strategy = kafka.BalanceStrategySticky
+		default:
+			conf.Errors.Pushf("Unknown rebalance strategy '%s'", strategy)
+		}
+
+		// Committed offsets take precedence, so only newest and oldest are
+		// meaningful as a starting point for new groups.
+		if cons.defaultOffset == kafka.OffsetOldest {
+			cons.config.Consumer.Offsets.Initial = kafka.OffsetOldest
+		}
+		cons.config.Consumer.Offsets.AutoCommit.Enable = true
+		cons.config.Consumer.Offsets.AutoCommit.Interval = cons.commitInterval
+		cons.config.Consumer.Return.Errors = true
+
+		cons.groupHandler = newKafkaGroupHandler(cons, core.NewMetricsRegistryForPlugin(cons))
+		cons.SetStopCallback(cons.closeGroup)
+	}
+
 	if cons.offsetFile != "" {
 		fileContents, err := ioutil.ReadFile(cons.offsetFile)
 		if err != nil {
@@ -369,51 +451,6 @@ func (cons *Kafka) Configure(conf core.PluginConfigReader) {
 	kafka.Logger = cons.Logger.WithField("Scope", "Sarama")
 }
 
-func (cons *Kafka) restartGroup() {
-	time.Sleep(cons.persistTimeout)
-	cons.readFromGroup()
-}
-
-// Main fetch loop for kafka events
-func (cons *Kafka) readFromGroup() {
-	consumer, err := cluster.NewConsumerFromClient(cons.groupClient, cons.group, []string{cons.topic})
-	if err != nil {
-		defer cons.restartGroup()
-		cons.Logger.Errorf("Restarting kafka consumer (%s:%s) - %s", cons.topic, cons.group, err.Error())
-		return // ### return, stop and retry ###
-	}
-
-	// Make sure we wait for all consumers to end
-	cons.AddWorker()
-	defer func() {
-		if !cons.groupClient.Closed() {
-			consumer.Close()
-		}
-		cons.WorkerDone()
-	}()
-
-	// Loop over worker
-	spin := tsync.NewSpinner(tsync.SpinPriorityLow)
-
-	for !cons.groupClient.Closed() {
-		select {
-		case event, ok := <-consumer.Messages():
-			if ok {
-				cons.enqueueEvent(event)
-				consumer.MarkOffset(event, "")
-			}
-
-		case err := <-consumer.Errors():
-			defer cons.restartGroup()
-			cons.Logger.Error("Kafka consumer error:", err)
-			return // ### return, try reconnect ###
-
-		default:
-			spin.Yield()
-		}
-	}
-}
-
 func (cons *Kafka) startConsumerForPartition(partitionID int32) kafka.PartitionConsumer {
 	for !cons.client.Closed() {
 		startOffset := atomic.LoadInt64(cons.offsets[partitionID])
@@ -464,7 +501,7 @@ func (cons *Kafka) readFromPartition(partitionID int32) {
 			}
 
 			atomic.StoreInt64(cons.offsets[partitionID], event.Offset)
-			cons.enqueueEvent(event)
+			cons.enqueueEvent(event, nil)
 
 		case err := <-partCons.Errors():
 			cons.Logger.Error("Kafka consumer error:", err)
@@ -502,7 +539,7 @@ func (cons *Kafka) readPartitions(partitions []int32) {
 			select {
 			case event := <-consumer.Messages():
 				atomic.StoreInt64(cons.offsets[partition], event.Offset)
-				cons.enqueueEvent(event)
+				cons.enqueueEvent(event, nil)
 
 			case err := <-consumer.Errors():
 				cons.Logger.Error("Kafka consumer error:", err)
@@ -520,16 +557,42 @@ func (cons *Kafka) readPartitions(partitions []int32) {
 	}
 }
 
-func (cons *Kafka) enqueueEvent(event *kafka.ConsumerMessage) {
-	if cons.hasToSetMetadata {
-		metaData := core.Metadata{}
+// getMetadata returns the metadata for the given event. Record headers
+// colliding with the kafka fields are ignored.
+func (cons *Kafka) getMetadata(event *kafka.ConsumerMessage) core.Metadata {
+	metaData := core.Metadata{}
+	metaData.SetValue("topic", []byte(event.Topic))
+	metaData.SetValue("key", event.Key)
+	metaData.SetInt("partition", int64(event.Partition))
+	metaData.SetInt("offset", event.Offset)
+
+	for _, header := range event.Headers {
+		if header == nil {
+			continue
+		}
+		key := cons.headerPrefix + string(header.Key)
+		if _, reserved := metaData[key]; reserved {
+			cons.Logger.Debugf("Ignoring record header %s as it collides with a metadata field", key)
+			continue
+		}
+		metaData.SetValue(key, header.Value)
+	}
+	return metaData
+}
 
-		metaData.SetValue("topic", []byte(event.Topic))
-		metaData.SetValue("key", event.Key)
+// enqueueEvent passes the given event to the streams of this consumer. If
+// onRelease is set, it is called once the message has been released by all
+// producers.
+func (cons *Kafka) enqueueEvent(event *kafka.ConsumerMessage, onRelease func()) {
+	var metaData core.Metadata
+	if cons.hasToSetMetadata {
+		metaData = cons.getMetadata(event)
+	}
 
-		cons.EnqueueWithMetadata(event.Value, metaData)
+	if onRelease != nil {
+		cons.EnqueueWithReleaseCallback(event.Value, metaData, onRelease)
 	} else {
-		cons.SimpleConsumer.Enqueue(event.Value)
+		cons.EnqueueWithMetadata(event.Value, metaData)
 	}
 }
 
@@ -565,12 +628,14 @@ func (cons *Kafka) startAllConsumers() error {
 	var err error
 
 	if cons.group != "" {
-		cons.groupClient, err = cluster.NewClient(cons.servers, cons.groupConfig)
+		cons.consumerGroup, err = kafka.NewConsumerGroup(cons.servers, cons.group, cons.config)
 		if err != nil {
 			return err
 		}
 
-		go cons.readFromGroup()
+		var ctx context.Context
+		ctx, cons.stopGroup = context.WithCancel(context.Background())
+		go cons.readFromGroup(ctx)
 		return nil // ### return, group processing ###
 	}
 
@@ -625,6 +690,11 @@ func (cons *Kafka) Consume(workers *sync.WaitGroup) {
 		return
 	}
 
+	if cons.consumerGroup != nil {
+		cons.ControlLoop()
+		return
+	}
+
 	defer func() {
 		cons.client.Close()
 		cons.dumpIndex()
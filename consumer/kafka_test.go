@@ -0,0 +1,213 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"context"
+	"testing"
+
+	kafka "github.com/Shopify/sarama"
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/tgo/ttesting"
+)
+
+type kafkaTestSession struct {
+	claims    map[string][]int32
+	marked    []int64
+	committed int
+	ctx       context.Context
+}
+
+func (session *kafkaTestSession) Claims() map[string][]int32 { return session.claims }
+func (session *kafkaTestSession) MemberID() string           { return "member" }
+func (session *kafkaTestSession) GenerationID() int32        { return 1 }
+func (session *kafkaTestSession) Commit()                    { session.committed++ }
+func (session *kafkaTestSession) Context() context.Context   { return session.ctx }
+
+func (session *kafkaTestSession) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+	session.marked = append(session.marked, offset)
+}
+
+func (session *kafkaTestSession) ResetOffset(topic string, partition int32, offset int64, metadata string) {
+}
+
+func (session *kafkaTestSession) MarkMessage(msg *kafka.ConsumerMessage, metadata string) {
+	session.MarkOffset(msg.Topic, msg.Partition, msg.Offset+1, metadata)
+}
+
+type kafkaTestClaim struct {
+	messages chan *kafka.ConsumerMessage
+}
+
+func (claim *kafkaTestClaim) Topic() string                           { return "telemetry" }
+func (claim *kafkaTestClaim) Partition() int32                        { return 2 }
+func (claim *kafkaTestClaim) InitialOffset() int64                    { return 0 }
+func (claim *kafkaTestClaim) HighWaterMarkOffset() int64              { return 0 }
+func (claim *kafkaTestClaim) Messages() <-chan *kafka.ConsumerMessage { return claim.messages }
+
+func TestKafkaGroupConfig(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	cons := newTestPlugin(expect, "consumer.Kafka", "kafkaGroupConfig", map[string]interface{}{
+		"GroupId":                "pit",
+		"OffsetFile":             "/tmp/kafka.offset",
+		"DefaultOffset":          "oldest",
+		"GroupRebalanceStrategy": "roundrobin",
+	}).(*Kafka)
+
+	expect.Equal("", cons.offsetFile)
+	expect.Equal(kafka.V0_10_2_0, cons.config.Version)
+	expect.Equal(kafka.OffsetOldest, cons.config.Consumer.Offsets.Initial)
+	expect.Equal(kafka.BalanceStrategyRoundRobin, cons.config.Consumer.Group.Rebalance.Strategy)
+	expect.True(cons.config.Consumer.Offsets.AutoCommit.Enable)
+
+	cons = newTestPlugin(expect, "consumer.Kafka", "kafkaGroupVersion", map[string]interface{}{
+		"GroupId": "pit",
+		"Version": "2.1.0",
+	}).(*Kafka)
+	expect.Equal(kafka.V2_1_0_0, cons.config.Version)
+
+	_, err := tryNewTestPlugin("consumer.Kafka", "kafkaGroupInvalid", map[string]interface{}{
+		"GroupId":                "pit",
+		"GroupRebalanceStrategy": "random",
+	})
+	expect.NotNil(err)
+}
+
+func TestKafkaGroupHandler(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	router := &httpTestRouter{streamID: core.GetStreamID("kafkaGroupHandler")}
+	core.StreamRegistry.Register(router, router.streamID)
+
+	cons := newTestPlugin(expect, "consumer.Kafka", "kafkaGroupHandler", map[string]interface{}{
+		"Streams":     []string{"kafkaGroupHandler"},
+		"GroupId":     "pit",
+		"SetMetadata": true,
+	}).(*Kafka)
+	handler := cons.groupHandler
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	session := &kafkaTestSession{
+		claims: map[string][]int32{"telemetry": {0, 2}},
+		ctx:    ctx,
+	}
+
+	expect.NoError(handler.Setup(session))
+	expect.Equal(int64(2), handler.assigned.Value())
+	expect.Equal(int64(1), handler.rebalances.Count())
+	expect.Equal(int64(1), handler.partitionGauge("telemetry", 2).Value())
+
+	claim := &kafkaTestClaim{messages: make(chan *kafka.ConsumerMessage, 2)}
+	claim.messages <- &kafka.ConsumerMessage{
+		Topic:     "telemetry",
+		Partition: 2,
+		Offset:    41,
+		Key:       []byte("car"),
+		Value:     []byte("rpm=9000"),
+		Headers:   []*kafka.RecordHeader{{Key: []byte("sensor"), Value: []byte("engine")}},
+	}
+	claim.messages <- &kafka.ConsumerMessage{Topic: "telemetry", Partition: 2, Offset: 42, Value: []byte("rpm=9100")}
+	close(claim.messages)
+
+	expect.NoError(handler.ConsumeClaim(session, claim))
+	expect.Equal(2, len(router.messages))
+	expect.Equal(0, len(session.marked))
+
+	// Offsets are marked in order once the messages have been released
+	router.messages[1].Release()
+	expect.Equal(0, len(session.marked))
+	router.messages[0].Release()
+	expect.Equal([]int64{43}, session.marked)
+
+	metadata := router.messages[0].GetMetadata()
+	expect.Equal("rpm=9000", router.messages[0].String())
+	expect.Equal("engine", metadata.GetValueString("sensor"))
+	expect.Equal("car", metadata.GetValueString("key"))
+	expect.Equal("telemetry", metadata.GetValueString("topic"))
+	expect.Equal(int64(2), metadata.GetInt("partition"))
+	expect.Equal(int64(41), metadata.GetInt("offset"))
+
+	expect.NoError(handler.Cleanup(session))
+	expect.Equal(1, session.committed)
+	expect.Equal(int64(0), handler.assigned.Value())
+	expect.Equal(int64(0), handler.partitionGauge("telemetry", 2).Value())
+}
+
+func TestKafkaOffsetTracker(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	marked := []int64{}
+	tracker := newKafkaOffsetTracker(func(offset int64) {
+		marked = append(marked, offset)
+	})
+
+	release1 := tracker.track(1)
+	release2 := tracker.track(2)
+	release5 := tracker.track(5)
+
+	release2()
+	expect.Equal(0, len(marked))
+
+	release1()
+	expect.Equal([]int64{3}, marked)
+
+	release6 := tracker.track(6)
+	release6()
+	expect.Equal([]int64{3}, marked)
+
+	release5()
+	expect.Equal([]int64{3, 7}, marked)
+}
+
+func TestKafkaHeaderMetadata(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	event := &kafka.ConsumerMessage{
+		Topic:     "telemetry",
+		Partition: 2,
+		Offset:    41,
+		Key:       []byte("car"),
+		Headers: []*kafka.RecordHeader{
+			{Key: []byte("topic"), Value: []byte("spoofed")},
+			{Key: []byte("offset"), Value: []byte("0")},
+			{Key: []byte("sensor"), Value: []byte("engine")},
+		},
+	}
+
+	// Headers must not overwrite the kafka fields
+	cons := newTestPlugin(expect, "consumer.Kafka", "kafkaHeaderMetadata", map[string]interface{}{
+		"SetMetadata": true,
+	}).(*Kafka)
+
+	metadata := cons.getMetadata(event)
+	expect.Equal("telemetry", metadata.GetValueString("topic"))
+	expect.Equal(int64(41), metadata.GetInt("offset"))
+	expect.Equal("engine", metadata.GetValueString("sensor"))
+
+	cons = newTestPlugin(expect, "consumer.Kafka", "kafkaHeaderPrefix", map[string]interface{}{
+		"SetMetadata":  true,
+		"HeaderPrefix": "header.",
+	}).(*Kafka)
+
+	metadata = cons.getMetadata(event)
+	expect.Equal("telemetry", metadata.GetValueString("topic"))
+	expect.Equal("spoofed", metadata.GetValueString("header.topic"))
+	expect.Equal("0", metadata.GetValueString("header.offset"))
+	expect.Equal("engine", metadata.GetValueString("header.sensor"))
+	expect.Equal("", metadata.GetValueString("sensor"))
+}
@@ -0,0 +1,201 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	kafka "github.com/Shopify/sarama"
+	"github.com/rcrowley/go-metrics"
+)
+
+// kafkaGroupHandler implements sarama.ConsumerGroupHandler for consumer.Kafka
+// and keeps track of the partitions assigned to this group member.
+type kafkaGroupHandler struct {
+	cons       *Kafka
+	registry   metrics.Registry
+	assigned   metrics.Gauge
+	rebalances metrics.Counter
+	partitions map[string]metrics.Gauge
+	guard      sync.Mutex
+}
+
+func newKafkaGroupHandler(cons *Kafka, registry metrics.Registry) *kafkaGroupHandler {
+	return &kafkaGroupHandler{
+		cons:       cons,
+		registry:   registry,
+		assigned:   metrics.GetOrRegisterGauge("partitions", registry),
+		rebalances: metrics.GetOrRegisterCounter("rebalances", registry),
+		partitions: make(map[string]metrics.Gauge),
+	}
+}
+
+func (handler *kafkaGroupHandler) partitionGauge(topic string, partition int32) metrics.Gauge {
+	name := fmt.Sprintf("partition.%s.%d", topic, partition)
+	gauge, known := handler.partitions[name]
+	if !known {
+		gauge = metrics.GetOrRegisterGauge(name, handler.registry)
+		handler.partitions[name] = gauge
+	}
+	return gauge
+}
+
+// Setup is called at the beginning of a new session, after partitions have
+// been assigned to this member.
+func (handler *kafkaGroupHandler) Setup(session kafka.ConsumerGroupSession) error {
+	handler.guard.Lock()
+	defer handler.guard.Unlock()
+
+	handler.rebalances.Inc(1)
+	numAssigned := 0
+	for topic, partitions := range session.Claims() {
+		for _, partition := range partitions {
+			handler.partitionGauge(topic, partition).Update(1)
+		}
+		numAssigned += len(partitions)
+	}
+	handler.assigned.Update(int64(numAssigned))
+
+	handler.cons.Logger.Infof("Joined group %s as %s (generation %d) with partitions %v",
+		handler.cons.group, session.MemberID(), session.GenerationID(), session.Claims())
+	return nil
+}
+
+// Cleanup is called at the end of a session, after all ConsumeClaim calls have
+// returned and before partitions are revoked.
+func (handler *kafkaGroupHandler) Cleanup(session kafka.ConsumerGroupSession) error {
+	// Make sure the next owner of a partition continues after the last
+	// message passed on by this member.
+	session.Commit()
+
+	handler.guard.Lock()
+	defer handler.guard.Unlock()
+
+	for _, gauge := range handler.partitions {
+		gauge.Update(0)
+	}
+	handler.assigned.Update(0)
+	return nil
+}
+
+// ConsumeClaim reads the messages of one assigned partition. The offset of a
+// message is marked after the message has been released by all producers.
+// Messages released after the session ended are not marked and will be read
+// again by the next owner of the partition.
+func (handler *kafkaGroupHandler) ConsumeClaim(session kafka.ConsumerGroupSession, claim kafka.ConsumerGroupClaim) error {
+	offsets := newKafkaOffsetTracker(func(offset int64) {
+		session.MarkOffset(claim.Topic(), claim.Partition(), offset, "")
+	})
+
+	for {
+		select {
+		case event, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			handler.cons.enqueueEvent(event, offsets.track(event.Offset))
+
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+// kafkaOffsetTracker marks the offsets of one partition in the order the
+// messages have been read. An offset is marked once the message and all
+// messages read before it have been released.
+type kafkaOffsetTracker struct {
+	pending  []int64
+	released map[int64]bool
+	mark     func(offset int64)
+	guard    sync.Mutex
+}
+
+func newKafkaOffsetTracker(mark func(offset int64)) *kafkaOffsetTracker {
+	return &kafkaOffsetTracker{
+		released: make(map[int64]bool),
+		mark:     mark,
+	}
+}
+
+// track adds the offset of a message that has been read and returns the
+// function to call once the message has been released.
+func (tracker *kafkaOffsetTracker) track(offset int64) func() {
+	tracker.guard.Lock()
+	tracker.pending = append(tracker.pending, offset)
+	tracker.guard.Unlock()
+
+	return func() {
+		tracker.release(offset)
+	}
+}
+
+// release marks the offset following the last message of an uninterrupted
+// sequence of released messages.
+func (tracker *kafkaOffsetTracker) release(offset int64) {
+	tracker.guard.Lock()
+	defer tracker.guard.Unlock()
+
+	tracker.released[offset] = true
+	next := int64(-1)
+	for len(tracker.pending) > 0 && tracker.released[tracker.pending[0]] {
+		delete(tracker.released, tracker.pending[0])
+		next = tracker.pending[0] + 1
+		tracker.pending = tracker.pending[1:]
+	}
+
+	if next >= 0 {
+		tracker.mark(next)
+	}
+}
+
+// Main fetch loop for consumer groups. Consume has to be called again after
+// each rebalance.
+func (cons *Kafka) readFromGroup(ctx context.Context) {
+	cons.AddWorker()
+	defer cons.WorkerDone()
+
+	go func() {
+		for err := range cons.consumerGroup.Errors() {
+			cons.Logger.WithError(err).Error("Kafka consumer group error")
+		}
+	}()
+
+	for ctx.Err() == nil {
+		err := cons.consumerGroup.Consume(ctx, []string{cons.topic}, cons.groupHandler)
+		if err == nil || ctx.Err() != nil {
+			continue // ### continue, rebalance or stop ###
+		}
+
+		cons.Logger.WithError(err).Errorf("Restarting kafka consumer (%s:%s)", cons.topic, cons.group)
+		select {
+		case <-ctx.Done():
+		case <-time.After(cons.retryDelay):
+		}
+	}
+}
+
+func (cons *Kafka) closeGroup() {
+	if cons.consumerGroup == nil {
+		return
+	}
+	cons.stopGroup()
+	if err := cons.consumerGroup.Close(); err != nil {
+		cons.Logger.WithError(err).Error("Failed to close kafka consumer group")
+	}
+}
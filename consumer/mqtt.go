@@ -0,0 +1,161 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/components"
+)
+
+// MQTT consumer
+//
+// This consumer subscribes to one or more topics of an MQTT broker. Topic
+// filters may contain the MQTT wildcards "+" and "#". Each filter can be
+// mapped to a separate stream. Subscriptions are renewed automatically when
+// the connection to the broker is reestablished.
+//
+// Depending on the broker, messages matching multiple overlapping filters (e.g.
+// "sensors/+/temperature" and "sensors/#") are delivered once per matching
+// filter and are therefore enqueued multiple times. Use non-overlapping
+// filters to avoid duplicates.
+//
+// Metadata
+//
+// - topic: Contains the topic the message was published to
+//
+// - qos: Contains the quality of service level the message was received with
+//
+// - retained: Set to "true" if the message was retained by the broker
+//
+// Parameters
+//
+// - Topics: Defines a map of topic filters to subscribe to. The value of each
+// filter is the name of the stream messages matching this filter are sent to.
+// If the stream name is empty, messages are sent to the streams configured
+// by the "Streams" parameter.
+// By default this parameter is set to "#: ''" i.e. all topics are consumed.
+//
+// - QoS: Defines the quality of service level to subscribe with. Valid values
+// are 0 (at most once), 1 (at least once) and 2 (exactly once).
+// By default this parameter is set to 1.
+//
+// Examples
+//
+// This example sends temperature and humidity readings of all sensors to
+// separate streams. Status messages are sent to the "sensors" stream. The
+// filters do not overlap so that every message is enqueued only once.
+//
+//  MqttIn:
+//    Type: consumer.MQTT
+//    Streams: sensors
+//    Address: "ssl://broker:8883"
+//    Username: gollum
+//    Password: secret
+//    TlsEnable: true
+//    TlsCaLocation: /etc/ssl/broker-ca.pem
+//    Topics:
+//      "sensors/+/temperature": temperature
+//      "sensors/+/humidity": humidity
+//      "status/#": ""
+//
+type MQTT struct {
+	core.SimpleConsumer `gollumdoc:"embed_type"`
+	Client              components.MQTTClient `gollumdoc:"embed_type"`
+	qos                 int                   `config:"QoS" default:"1"`
+	topics              map[string]core.MessageStreamID
+	client              mqtt.Client
+}
+
+func init() {
+	core.TypeRegistry.Register(MQTT{})
+}
+
+// Configure initializes this consumer with values from a plugin config.
+func (cons *MQTT) Configure(conf core.PluginConfigReader) {
+	cons.SetStopCallback(cons.close)
+	conf.Errors.Push(components.ValidateMQTTQoS(cons.qos))
+
+	cons.topics = make(map[string]core.MessageStreamID)
+	for filter, streamName := range conf.GetStringMap("Topics", map[string]string{"#": ""}) {
+		if streamName == "" {
+			cons.topics[filter] = core.InvalidStreamID
+		} else {
+			cons.topics[filter] = core.GetStreamID(streamName)
+		}
+	}
+
+	options := cons.Client.GetClientOptions()
+	options.SetOnConnectHandler(cons.subscribe)
+	options.SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+		cons.Logger.WithError(err).Warning("Connection to broker lost")
+	})
+}
+
+func (cons *MQTT) subscribe(client mqtt.Client) {
+	cons.Logger.Debug("Connected to ", cons.Client.GetAddress())
+
+	for filter, streamID := range cons.topics {
+		token := client.Subscribe(filter, byte(cons.qos), cons.newHandler(streamID))
+		if err := components.WaitMQTTToken(token, cons.GetShutdownTimeout()*5); err != nil {
+			cons.Logger.WithError(err).Errorf("Failed to subscribe to %s", filter)
+		}
+	}
+}
+
+func (cons *MQTT) newHandler(streamID core.MessageStreamID) mqtt.MessageHandler {
+	return func(_ mqtt.Client, message mqtt.Message) {
+		metadata := core.Metadata{}
+		metadata.SetValue("topic", []byte(message.Topic()))
+		metadata.SetInt("qos", int64(message.Qos()))
+		metadata.SetBool("retained", message.Retained())
+
+		if streamID == core.InvalidStreamID {
+			cons.EnqueueWithMetadata(message.Payload(), metadata)
+		} else {
+			cons.EnqueueWithStream(message.Payload(), metadata, streamID)
+		}
+	}
+}
+
+func (cons *MQTT) connect() {
+	if cons.IsStopping() {
+		return // ### return, shutting down ###
+	}
+
+	token := cons.client.Connect()
+	if err := components.WaitMQTTToken(token, 0); err != nil {
+		cons.Logger.WithError(err).Error("Failed to connect to ", cons.Client.GetAddress())
+		time.AfterFunc(cons.GetShutdownTimeout()*10, cons.connect)
+	}
+}
+
+func (cons *MQTT) close() {
+	if cons.client.IsConnected() {
+		cons.client.Disconnect(uint(cons.GetShutdownTimeout() / time.Millisecond))
+	}
+}
+
+// Consume connects to the broker and subscribes to all configured topics
+func (cons *MQTT) Consume(workers *sync.WaitGroup) {
+	cons.SetWorkerWaitGroup(workers)
+	cons.client = mqtt.NewClient(cons.Client.GetClientOptions())
+
+	go cons.connect()
+	cons.ControlLoop()
+}
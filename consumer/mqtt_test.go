@@ -0,0 +1,141 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/components"
+	"github.com/trivago/gollum/core/components/mqtttest"
+	"github.com/trivago/tgo/ttesting"
+)
+
+type mqttTestRouter struct {
+	core.Router
+	streamID core.MessageStreamID
+	messages chan *core.Message
+}
+
+func newMQTTTestRouter(stream string) *mqttTestRouter {
+	router := &mqttTestRouter{
+		streamID: core.GetStreamID(stream),
+		messages: make(chan *core.Message, 10),
+	}
+	core.StreamRegistry.Register(router, router.streamID)
+	return router
+}
+
+func (router *mqttTestRouter) GetID() string                     { return "mqttTestRouter" }
+func (router *mqttTestRouter) GetStreamID() core.MessageStreamID { return router.streamID }
+func (router *mqttTestRouter) GetProducers() []core.Producer     { return nil }
+func (router *mqttTestRouter) Modulate(*core.Message) core.ModulateResult {
+	return core.ModulateResultContinue
+}
+func (router *mqttTestRouter) Enqueue(msg *core.Message) error {
+	router.messages <- msg
+	return nil
+}
+
+func (router *mqttTestRouter) receive(t *testing.T) *core.Message {
+	select {
+	case msg := <-router.messages:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("No message received on ", router.streamID.GetName())
+		return nil
+	}
+}
+
+func TestMQTTTopics(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	cons := newTestPlugin(expect, "consumer.MQTT", "mqttTopics", map[string]interface{}{
+		"Topics": map[string]string{
+			"sensors/+/temperature": "temperature",
+			"status/#":              "",
+		},
+	}).(*MQTT)
+	expect.Equal(2, len(cons.topics))
+	expect.Equal(core.GetStreamID("temperature"), cons.topics["sensors/+/temperature"])
+	expect.Equal(core.InvalidStreamID, cons.topics["status/#"])
+	expect.Equal("gollum-mqttTopics", cons.Client.GetClientOptions().ClientID)
+}
+
+func TestMQTTDefaultTopics(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	cons := newTestPlugin(expect, "consumer.MQTT", "mqttDefault").(*MQTT)
+	expect.Equal(1, len(cons.topics))
+	expect.Equal(core.InvalidStreamID, cons.topics["#"])
+}
+
+func TestMQTTConsume(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	broker := mqtttest.NewBroker(expect)
+	defer broker.Close()
+
+	temperature := newMQTTTestRouter("mqttTestTemperature")
+	status := newMQTTTestRouter("mqttTestStatus")
+
+	publisher := mqtt.NewClient(mqtt.NewClientOptions().AddBroker(broker.Address()).SetClientID("mqttPublisher"))
+	expect.NoError(components.WaitMQTTToken(publisher.Connect(), time.Second))
+	defer publisher.Disconnect(0)
+
+	// Retained messages are sent by the broker as soon as the consumer subscribed
+	expect.NoError(components.WaitMQTTToken(publisher.Publish("sensors/kitchen/temperature", 1, true, "21.5"), time.Second))
+	expect.NoError(components.WaitMQTTToken(publisher.Publish("status/kitchen", 1, true, "online"), time.Second))
+
+	cons := newTestPlugin(expect, "consumer.MQTT", "mqttConsume", map[string]interface{}{
+		"Address": broker.Address(),
+		"Streams": "mqttTestStatus",
+		"Topics": map[string]string{
+			"sensors/+/temperature": "mqttTestTemperature",
+			"status/#":              "",
+		},
+	}).(*MQTT)
+
+	cons.client = mqtt.NewClient(cons.Client.GetClientOptions())
+	expect.NoError(components.WaitMQTTToken(cons.client.Connect(), time.Second))
+	defer cons.client.Disconnect(0)
+
+	msg := temperature.receive(t)
+	expect.Equal("21.5", msg.String())
+	expect.Equal(temperature.streamID, msg.GetStreamID())
+	expect.Equal("sensors/kitchen/temperature", msg.GetMetadata().GetValueString("topic"))
+	expect.True(msg.GetMetadata().GetBool("retained"))
+
+	msg = status.receive(t)
+	expect.Equal("online", msg.String())
+	expect.Equal(status.streamID, msg.GetStreamID())
+
+	// Messages not matching any filter are not consumed
+	expect.NoError(components.WaitMQTTToken(publisher.Publish("sensors/kitchen/humidity", 1, false, "40"), time.Second))
+	expect.NoError(components.WaitMQTTToken(publisher.Publish("sensors/garden/temperature", 1, false, "12.0"), time.Second))
+
+	msg = temperature.receive(t)
+	expect.Equal("12.0", msg.String())
+	expect.Equal("sensors/garden/temperature", msg.GetMetadata().GetValueString("topic"))
+	expect.False(msg.GetMetadata().GetBool("retained"))
+	qos, hasQoS := msg.GetMetadata().TryGetInt("qos")
+	expect.True(hasQoS)
+	expect.Equal(int64(0), qos)
+
+	expect.Equal(0, len(temperature.messages))
+	expect.Equal(0, len(status.messages))
+}
@@ -0,0 +1,222 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/components"
+	"github.com/trivago/tgo"
+	"github.com/trivago/tgo/tnet"
+)
+
+// Multicast consumer plugin
+//
+// The multicast consumer receives UDP datagrams sent to a multicast group or
+// to a broadcast or unicast address. It is the counterpart of
+// producer.Multicast and allows several receivers to get the same data
+// without a server in between.
+//
+// If Framing is set to "sequence", each datagram is expected to carry the
+// header written by producer.Multicast. Messages split into several datagrams
+// are reassembled and the sequence numbers are used to detect lost messages.
+//
+// Metadata
+//
+// - source: Contains the address of the sender
+//
+// - sender: Contains the id of the sending producer (only set when Framing is
+// "sequence")
+//
+// - sequence: Contains the sequence number of the message (only set when
+// Framing is "sequence")
+//
+// - gap: Contains the number of messages missed between the previous message
+// of the same sender and this message (only set when Framing is "sequence")
+//
+// Parameters
+//
+// - Address: Defines the address to listen on. If the host is a multicast
+// group, the group is joined. Otherwise the given address is bound, e.g.
+// ":5880" to receive broadcasts.
+// By default this parameter is set to "239.255.0.1:5880".
+//
+// - Interface: Defines the name of the network interface used to join the
+// multicast group. If empty, the system default is used.
+// By default this parameter is set to "".
+//
+// - Framing: Defines how datagrams are interpreted. Set to "sequence" to read
+// the header written by producer.Multicast or to "none" to treat each datagram
+// as a message.
+// By default this parameter is set to "sequence".
+//
+// - ReassemblyTimeoutMs: Defines the time to wait for missing parts of a split
+// message before the parts received so far are discarded.
+// By default this parameter is set to 1000.
+//
+// - ReadBufferSizeKB: Defines the size of the socket's receive buffer.
+// By default this parameter is set to 1024.
+//
+// - ReadTimeoutSec: Defines the number of seconds to wait for data before
+// checking for shutdown. This setting affects the maximum shutdown duration of
+// this consumer.
+// By default this parameter is set to 1.
+//
+// Examples
+//
+// This example receives live telemetry on all pit laptops via wifi.
+//
+//  TelemetryIn:
+//    Type: consumer.Multicast
+//    Streams: telemetry
+//    Address: "239.255.0.1:5880"
+//    Interface: wlan0
+//
+type Multicast struct {
+	core.SimpleConsumer `gollumdoc:"embed_type"`
+	address             string        `config:"Address" default:"239.255.0.1:5880"`
+	interfaceName       string        `config:"Interface"`
+	framing             string        `config:"Framing" default:"sequence"`
+	reassemblyTimeout   time.Duration `config:"ReassemblyTimeoutMs" default:"1000" metric:"ms"`
+	readBufferSize      int           `config:"ReadBufferSizeKB" default:"1024" metric:"kb"`
+	readTimeout         time.Duration `config:"ReadTimeoutSec" default:"1" metric:"sec"`
+	udpAddress          *net.UDPAddr
+	networkInterface    *net.Interface
+	conn                *net.UDPConn
+}
+
+func init() {
+	core.TypeRegistry.Register(Multicast{})
+}
+
+// Configure initializes this consumer with values from a plugin config.
+func (cons *Multicast) Configure(conf core.PluginConfigReader) {
+	cons.SetStopCallback(cons.close)
+
+	switch cons.framing {
+	case "sequence", "none":
+	default:
+		conf.Errors.Pushf("Unknown framing '%s'", cons.framing)
+	}
+
+	_, address := tnet.ParseAddress(cons.address, "udp")
+	udpAddress, err := net.ResolveUDPAddr("udp", address)
+	if conf.Errors.Push(err) {
+		return
+	}
+	cons.udpAddress = udpAddress
+
+	if cons.interfaceName != "" {
+		cons.networkInterface, err = net.InterfaceByName(cons.interfaceName)
+		conf.Errors.Push(err)
+	}
+}
+
+func (cons *Multicast) listen() (*net.UDPConn, error) {
+	network := "udp4"
+	if cons.udpAddress.IP.To4() == nil && cons.udpAddress.IP != nil {
+		network = "udp6"
+	}
+
+	if cons.udpAddress.IP.IsMulticast() {
+		return net.ListenMulticastUDP(network, cons.networkInterface, cons.udpAddress)
+	}
+	return net.ListenUDP(network, cons.udpAddress)
+}
+
+func (cons *Multicast) read() {
+	defer cons.WorkerDone()
+
+	assembler := components.NewDatagramAssembler(cons.reassemblyTimeout)
+	buffer := make([]byte, 65536)
+
+	for cons.IsActive() {
+		cons.conn.SetReadDeadline(time.Now().Add(cons.readTimeout))
+		size, source, err := cons.conn.ReadFromUDP(buffer)
+
+		if expired := assembler.Expire(); expired > 0 {
+			cons.Logger.Warningf("Discarded %d incomplete messages", expired)
+		}
+
+		if err != nil {
+			if netErr, isNetErr := err.(net.Error); isNetErr && netErr.Timeout() {
+				continue // ### continue, no data ###
+			}
+			if cons.IsActive() {
+				cons.Logger.WithError(err).Error("Failed to read from ", cons.address)
+				time.Sleep(cons.readTimeout)
+			}
+			continue
+		}
+
+		cons.handleDatagram(assembler, buffer[:size], source)
+	}
+}
+
+func (cons *Multicast) handleDatagram(assembler *components.DatagramAssembler, datagram []byte, source *net.UDPAddr) {
+	metadata := core.Metadata{}
+	metadata.SetValue("source", []byte(source.String()))
+
+	if cons.framing == "none" {
+		cons.EnqueueWithMetadata(datagram, metadata)
+		return // ### return, no framing ###
+	}
+
+	header, chunk, err := components.ParseDatagram(datagram)
+	if err != nil {
+		cons.Logger.WithError(err).Warning("Invalid datagram from ", source)
+		return // ### return, invalid datagram ###
+	}
+
+	payload, gap, complete := assembler.Add(header, chunk)
+	if !complete {
+		return // ### return, waiting for more chunks ###
+	}
+
+	if gap > 0 {
+		cons.Logger.Debugf("Missed %d messages from %s", gap, source)
+	}
+
+	metadata.SetValue("sender", []byte(strconv.FormatUint(uint64(header.Sender), 16)))
+	metadata.SetInt("sequence", int64(header.Sequence))
+	metadata.SetInt("gap", int64(gap))
+	cons.EnqueueWithMetadata(payload, metadata)
+}
+
+func (cons *Multicast) close() {
+	if cons.conn != nil {
+		cons.conn.Close()
+	}
+}
+
+// Consume joins the multicast group and reads datagrams
+func (cons *Multicast) Consume(workers *sync.WaitGroup) {
+	conn, err := cons.listen()
+	if err != nil {
+		cons.Logger.WithError(err).Error("Failed to listen to ", cons.address)
+		return // ### return, could not listen ###
+	}
+
+	conn.SetReadBuffer(cons.readBufferSize)
+	cons.conn = conn
+
+	cons.AddMainWorker(workers)
+	go tgo.WithRecoverShutdown(cons.read)
+	cons.ControlLoop()
+}
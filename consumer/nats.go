@@ -0,0 +1,243 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/nats-io/nats.go"
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/components"
+)
+
+// NATS consumer
+//
+// This consumer subscribes to one or more subjects of a NATS server. Subjects
+// may contain the NATS wildcards "*" and ">". Each subject can be mapped to a
+// separate stream. Optionally messages can be consumed from JetStream using
+// durable consumers. JetStream messages are acknowledged after they have been
+// passed to gollum.
+//
+// Metadata
+//
+// - subject: Contains the subject the message was published to
+//
+// - reply: Contains the reply subject of the message if set
+//
+// All message headers are set as metadata, too. If a header has multiple
+// values, only the first one is used.
+//
+// Parameters
+//
+// - Subjects: Defines a map of subjects to subscribe to. The value of each
+// subject is the name of the stream messages of this subject are sent to. If
+// the stream name is empty, messages are sent to the streams configured by
+// the "Streams" parameter.
+// By default this parameter is set to ">: ''" i.e. all subjects are consumed.
+//
+// - Queue: Defines the queue group to join. Messages are distributed between
+// all members of a queue group. If this is empty, no queue group is used.
+// By default this parameter is set to "".
+//
+// - JetStream: When set to true, messages are consumed via JetStream. A
+// JetStream stream has to be configured for the subjects used.
+// By default this parameter is set to false.
+//
+// - Durable: Defines the name of the durable JetStream consumer to use. If
+// multiple subjects are set, one consumer per subject is created. Its name is
+// suffixed by the subject with "." replaced by "_", "*" by "any" and ">" by
+// "all", e.g. "pit-car_any_rpm" for the subject "car.*.rpm".
+// If this is empty, an ephemeral consumer is created.
+// By default this parameter is set to "".
+//
+// Examples
+//
+// This example reads all car telemetry from a durable JetStream consumer.
+//
+//  NatsIn:
+//    Type: consumer.NATS
+//    Address: "nats://pit-laptop:4222"
+//    JetStream: true
+//    Durable: pit
+//    Subjects:
+//      "car.>": telemetry
+//
+type NATS struct {
+	core.SimpleConsumer `gollumdoc:"embed_type"`
+	Client              components.NATSClient `gollumdoc:"embed_type"`
+	queue               string                `config:"Queue"`
+	jetStream           bool                  `config:"JetStream" default:"false"`
+	durable             string                `config:"Durable"`
+	subjects            map[string]core.MessageStreamID
+	durables            map[string]string
+	conn                *nats.Conn
+	connGuard           sync.Mutex
+}
+
+func init() {
+	core.TypeRegistry.Register(NATS{})
+}
+
+// Configure initializes this consumer with values from a plugin config.
+func (cons *NATS) Configure(conf core.PluginConfigReader) {
+	cons.SetStopCallback(cons.close)
+
+	cons.subjects = make(map[string]core.MessageStreamID)
+	for subject, streamName := range conf.GetStringMap("Subjects", map[string]string{">": ""}) {
+		if streamName == "" {
+			cons.subjects[subject] = core.InvalidStreamID
+		} else {
+			cons.subjects[subject] = core.GetStreamID(streamName)
+		}
+	}
+
+	// Durable names are derived from the subject so that each subject keeps
+	// its consumer (and position) between restarts.
+	cons.durables = make(map[string]string)
+	if cons.durable != "" {
+		subjectByName := make(map[string]string)
+		for subject := range cons.subjects {
+			name := cons.durable
+			if len(cons.subjects) > 1 {
+				name = natsDurableName(cons.durable, subject)
+			}
+			if other, exists := subjectByName[name]; exists {
+				conf.Errors.Pushf("Subjects %s and %s result in the same durable name %s", other, subject, name)
+			}
+			subjectByName[name] = subject
+			cons.durables[subject] = name
+		}
+	}
+}
+
+var natsDurableReplacer = strings.NewReplacer(".", "_", "*", "any", ">", "all")
+
+// natsDurableName returns the name of the durable consumer for the given
+// subject. Characters not allowed in consumer names are replaced.
+func natsDurableName(durable string, subject string) string {
+	name := natsDurableReplacer.Replace(subject)
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '/' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, name)
+	return durable + "-" + name
+}
+
+func (cons *NATS) newHandler(streamID core.MessageStreamID) nats.MsgHandler {
+	return func(msg *nats.Msg) {
+		metadata := core.Metadata{}
+		components.NATSHeaderToMetadata(msg.Header, metadata)
+		metadata.SetValue("subject", []byte(msg.Subject))
+		if msg.Reply != "" {
+			metadata.SetValue("reply", []byte(msg.Reply))
+		}
+
+		if streamID == core.InvalidStreamID {
+			cons.EnqueueWithMetadata(msg.Data, metadata)
+		} else {
+			cons.EnqueueWithStream(msg.Data, metadata, streamID)
+		}
+
+		if cons.jetStream {
+			if err := msg.Ack(); err != nil {
+				cons.Logger.WithError(err).Errorf("Failed to acknowledge message on %s", msg.Subject)
+			}
+		}
+	}
+}
+
+func (cons *NATS) subscribe(conn *nats.Conn) error {
+	var js nats.JetStreamContext
+	if cons.jetStream {
+		var err error
+		if js, err = conn.JetStream(); err != nil {
+			return err
+		}
+	}
+
+	for subject, streamID := range cons.subjects {
+		handler := cons.newHandler(streamID)
+
+		var err error
+		switch {
+		case !cons.jetStream:
+			_, err = conn.QueueSubscribe(subject, cons.queue, handler)
+
+		default:
+			options := []nats.SubOpt{nats.ManualAck()}
+			if name, isDurable := cons.durables[subject]; isDurable {
+				options = append(options, nats.Durable(name))
+			}
+			_, err = js.QueueSubscribe(subject, cons.queue, handler, options...)
+		}
+
+		if err != nil {
+			return fmt.Errorf("Failed to subscribe to %s: %s", subject, err.Error())
+		}
+	}
+	return nil
+}
+
+func (cons *NATS) connect() {
+	if cons.IsStopping() {
+		return // ### return, shutting down ###
+	}
+
+	conn, err := cons.Client.Connect(cons.Logger)
+	if err == nil {
+		if err = cons.subscribe(conn); err != nil {
+			conn.Close()
+		}
+	}
+
+	if err != nil {
+		cons.Logger.WithError(err).Error("Failed to connect to ", cons.Client.GetAddress())
+		time.AfterFunc(cons.Client.GetReconnectDelay(), cons.connect)
+		return // ### return, retry ###
+	}
+
+	cons.connGuard.Lock()
+	defer cons.connGuard.Unlock()
+	if cons.IsStopping() {
+		conn.Close()
+		return // ### return, stopped while connecting ###
+	}
+
+	cons.conn = conn
+	cons.Logger.Debug("Connected to ", conn.ConnectedUrl())
+}
+
+func (cons *NATS) close() {
+	cons.connGuard.Lock()
+	defer cons.connGuard.Unlock()
+
+	if cons.conn != nil {
+		cons.conn.Close()
+	}
+}
+
+// Consume connects to the server and subscribes to all configured subjects
+func (cons *NATS) Consume(workers *sync.WaitGroup) {
+	cons.SetWorkerWaitGroup(workers)
+
+	go cons.connect()
+	cons.ControlLoop()
+}
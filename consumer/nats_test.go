@@ -0,0 +1,67 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"testing"
+
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestNATSSubjects(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	cons := newTestPlugin(expect, "consumer.NATS", "natsSubjects", map[string]interface{}{
+		"Subjects": map[string]string{
+			"car.*.rpm": "rpm",
+			"car.>":     "",
+		},
+	}).(*NATS)
+	expect.Equal(2, len(cons.subjects))
+	expect.Equal(core.GetStreamID("rpm"), cons.subjects["car.*.rpm"])
+	expect.Equal(core.InvalidStreamID, cons.subjects["car.>"])
+
+	cons = newTestPlugin(expect, "consumer.NATS", "natsDefault").(*NATS)
+	expect.Equal(core.InvalidStreamID, cons.subjects[">"])
+}
+
+func TestNATSDurableNames(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	cons := newTestPlugin(expect, "consumer.NATS", "natsDurables", map[string]interface{}{
+		"Durable": "pit",
+		"Subjects": map[string]string{
+			"car.*.rpm": "rpm",
+			"car.>":     "",
+		},
+	}).(*NATS)
+	expect.Equal("pit-car_any_rpm", cons.durables["car.*.rpm"])
+	expect.Equal("pit-car_all", cons.durables["car.>"])
+
+	cons = newTestPlugin(expect, "consumer.NATS", "natsDurable", map[string]interface{}{
+		"Durable": "pit",
+	}).(*NATS)
+	expect.Equal("pit", cons.durables[">"])
+
+	_, err := tryNewTestPlugin("consumer.NATS", "natsDurableCollision", map[string]interface{}{
+		"Durable": "pit",
+		"Subjects": map[string]string{
+			"car.rpm": "",
+			"car_rpm": "",
+		},
+	})
+	expect.NotNil(err)
+}
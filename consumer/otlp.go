@@ -0,0 +1,451 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/components"
+	"github.com/trivago/gollum/core/otlp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// OTLP consumer
+//
+// This consumer accepts OpenTelemetry logs and metrics sent via OTLP over gRPC
+// or HTTP. HTTP requests may be sent as binary protobuf or as JSON encoded
+// protobuf and may be gzip compressed. Each log record and each metric data
+// point is converted to a separate message. Resource attributes as well as
+// log record and data point attributes are stored as metadata.
+// Traces are not supported.
+//
+// Log records use the record body as payload. String and byte bodies are
+// used as-is, all other bodies are converted to JSON.
+// Metric data points use the value as payload. For histograms and summaries
+// the sum of all observations is used as value.
+//
+// Parameters
+//
+// - GrpcAddress: Defines the address to listen on for OTLP/gRPC requests.
+// Set to "" to disable gRPC.
+// By default this parameter is set to ":4317".
+//
+// - HttpAddress: Defines the address to listen on for OTLP/HTTP requests.
+// Requests have to be sent to the paths "/v1/logs" and "/v1/metrics".
+// Set to "" to disable HTTP.
+// By default this parameter is set to ":4318".
+//
+// - LogsStream: Defines the stream log records are sent to. If this is empty,
+// log records are sent to the streams configured by "Streams".
+// By default this parameter is set to "".
+//
+// - MetricsStream: Defines the stream metric data points are sent to. If this
+// is empty, data points are sent to the streams configured by "Streams".
+// By default this parameter is set to "".
+//
+// - MaxMessageSizeKB: Defines the maximum size of a single request. The limit
+// applies to compressed and decompressed HTTP requests. Larger HTTP requests
+// are rejected with status 413.
+// By default this parameter is set to 4096.
+//
+// Metadata
+//
+// All resource attributes and log record or data point attributes are stored
+// with their original key. Attributes of a record or data point overwrite
+// resource attributes with the same key.
+//
+// - scope: The name of the instrumentation scope (if set)
+//
+// - time: The timestamp of the log record or data point (if set)
+//
+// - severity: The severity text of a log record. If the record has no severity
+// text, the name of the severity number is used (e.g. "WARN").
+//
+// - name: The name of the metric
+//
+// - unit: The unit of the metric (if set)
+//
+// - type: The type of the metric ("gauge", "sum", "histogram" or "summary")
+//
+// - count: The number of observations of a histogram or summary data point
+//
+// Examples
+//
+// This example accepts OTLP from other services and sends logs and metrics to
+// separate streams.
+//
+//  OtlpIn:
+//    Type: consumer.OTLP
+//    Streams: otlp
+//    LogsStream: logs
+//    MetricsStream: metrics
+//
+type OTLP struct {
+	core.SimpleConsumer `gollumdoc:"embed_type"`
+	TLS                 components.TLSServerConfig `gollumdoc:"embed_type"`
+	grpcAddress         string                     `config:"GrpcAddress" default:":4317"`
+	httpAddress         string                     `config:"HttpAddress" default:":4318"`
+	logsStreamID        core.MessageStreamID       `config:"LogsStream"`
+	metricsStreamID     core.MessageStreamID       `config:"MetricsStream"`
+	maxMessageSize      int                        `config:"MaxMessageSizeKB" default:"4096" metric:"kb"`
+	grpcServer          *grpc.Server
+	httpServer          *http.Server
+}
+
+// otlpLogsService implements the OTLP LogsService for consumer.OTLP
+type otlpLogsService struct {
+	cons *OTLP
+}
+
+// otlpMetricsService implements the OTLP MetricsService for consumer.OTLP
+type otlpMetricsService struct {
+	cons *OTLP
+}
+
+func init() {
+	core.TypeRegistry.Register(OTLP{})
+}
+
+// Configure initializes this consumer with values from a plugin config.
+func (cons *OTLP) Configure(conf core.PluginConfigReader) {
+	cons.SetStopCallback(cons.close)
+
+	if cons.grpcAddress == "" && cons.httpAddress == "" {
+		conf.Errors.Pushf("Either GrpcAddress or HttpAddress has to be set")
+	}
+
+	options := []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(cons.maxMessageSize),
+	}
+	if tlsConfig := cons.TLS.GetConfig(); tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	cons.grpcServer = grpc.NewServer(options...)
+	otlp.RegisterLogsServiceServer(cons.grpcServer, otlpLogsService{cons})
+	otlp.RegisterMetricsServiceServer(cons.grpcServer, otlpMetricsService{cons})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/logs", cons.handleLogs)
+	mux.HandleFunc("/v1/metrics", cons.handleMetrics)
+	cons.httpServer = &http.Server{Handler: mux}
+}
+
+// Export implements the OTLP LogsService server interface
+func (service otlpLogsService) Export(ctx context.Context, req *otlp.ExportLogsServiceRequest) (*otlp.ExportLogsServiceResponse, error) {
+	service.cons.enqueueLogs(req.GetResourceLogs())
+	return &otlp.ExportLogsServiceResponse{}, nil
+}
+
+// Export implements the OTLP MetricsService server interface
+func (service otlpMetricsService) Export(ctx context.Context, req *otlp.ExportMetricsServiceRequest) (*otlp.ExportMetricsServiceResponse, error) {
+	service.cons.enqueueMetrics(req.GetResourceMetrics())
+	return &otlp.ExportMetricsServiceResponse{}, nil
+}
+
+func (cons *OTLP) enqueueLogs(resourceLogs []*otlp.ResourceLogs) {
+	convertOTLPLogs(resourceLogs, func(payload []byte, metadata core.Metadata) {
+		cons.EnqueueWithStream(payload, metadata, cons.logsStreamID)
+	})
+}
+
+func (cons *OTLP) enqueueMetrics(resourceMetrics []*otlp.ResourceMetrics) {
+	convertOTLPMetrics(resourceMetrics, func(payload []byte, metadata core.Metadata) {
+		cons.EnqueueWithStream(payload, metadata, cons.metricsStreamID)
+	})
+}
+
+// convertOTLPLogs calls enqueue for each log record
+func convertOTLPLogs(resourceLogs []*otlp.ResourceLogs, enqueue func([]byte, core.Metadata)) {
+	for _, resource := range resourceLogs {
+		resourceMetadata := core.Metadata{}
+		otlp.AttributesToMetadata(resource.GetResource().GetAttributes(), resourceMetadata)
+
+		for _, scope := range resource.GetScopeLogs() {
+			for _, record := range scope.GetLogRecords() {
+				metadata := resourceMetadata.Clone()
+				if name := scope.GetScope().GetName(); name != "" {
+					metadata.SetValue("scope", []byte(name))
+				}
+				otlp.AttributesToMetadata(record.GetAttributes(), metadata)
+
+				timestamp := record.GetTimeUnixNano()
+				if timestamp == 0 {
+					timestamp = record.GetObservedTimeUnixNano()
+				}
+				if timestamp != 0 {
+					metadata.SetTime("time", otlp.UnixNanoToTime(timestamp))
+				}
+
+				severity := record.GetSeverityText()
+				if severity == "" {
+					severity = otlp.SeverityName(record.GetSeverityNumber())
+				}
+				if severity != "" {
+					metadata.SetValue("severity", []byte(severity))
+				}
+
+				var payload []byte
+				if body := record.GetBody(); body != nil {
+					payload = body.ToBytes()
+				}
+				enqueue(payload, metadata)
+			}
+		}
+	}
+}
+
+// convertOTLPMetrics calls enqueue for each metric data point
+func convertOTLPMetrics(resourceMetrics []*otlp.ResourceMetrics, enqueue func([]byte, core.Metadata)) {
+	for _, resource := range resourceMetrics {
+		resourceMetadata := core.Metadata{}
+		otlp.AttributesToMetadata(resource.GetResource().GetAttributes(), resourceMetadata)
+
+		for _, scope := range resource.GetScopeMetrics() {
+			for _, metric := range scope.GetMetrics() {
+				metricMetadata := resourceMetadata.Clone()
+				if name := scope.GetScope().GetName(); name != "" {
+					metricMetadata.SetValue("scope", []byte(name))
+				}
+				metricMetadata.SetValue("name", []byte(metric.GetName()))
+				if unit := metric.GetUnit(); unit != "" {
+					metricMetadata.SetValue("unit", []byte(unit))
+				}
+
+				switch {
+				case metric.GetGauge() != nil:
+					metricMetadata.SetValue("type", []byte("gauge"))
+					convertOTLPNumberDataPoints(metric.GetGauge().GetDataPoints(), metricMetadata, enqueue)
+
+				case metric.GetSum() != nil:
+					metricMetadata.SetValue("type", []byte("sum"))
+					convertOTLPNumberDataPoints(metric.GetSum().GetDataPoints(), metricMetadata, enqueue)
+
+				case metric.GetHistogram() != nil:
+					metricMetadata.SetValue("type", []byte("histogram"))
+					for _, point := range metric.GetHistogram().GetDataPoints() {
+						convertOTLPDataPoint(strconv.FormatFloat(point.GetSum(), 'f', -1, 64),
+							point.GetCount(), point.GetTimeUnixNano(), point.GetAttributes(), metricMetadata, enqueue)
+					}
+
+				case metric.GetSummary() != nil:
+					metricMetadata.SetValue("type", []byte("summary"))
+					for _, point := range metric.GetSummary().GetDataPoints() {
+						convertOTLPDataPoint(strconv.FormatFloat(point.GetSum(), 'f', -1, 64),
+							point.GetCount(), point.GetTimeUnixNano(), point.GetAttributes(), metricMetadata, enqueue)
+					}
+				}
+			}
+		}
+	}
+}
+
+func convertOTLPNumberDataPoints(points []*otlp.NumberDataPoint, metricMetadata core.Metadata, enqueue func([]byte, core.Metadata)) {
+	for _, point := range points {
+		var value string
+		switch point.GetValue().(type) {
+		case *otlp.NumberDataPoint_AsInt:
+			value = strconv.FormatInt(point.GetAsInt(), 10)
+		default:
+			value = strconv.FormatFloat(point.GetAsDouble(), 'f', -1, 64)
+		}
+		convertOTLPDataPoint(value, 0, point.GetTimeUnixNano(), point.GetAttributes(), metricMetadata, enqueue)
+	}
+}
+
+func convertOTLPDataPoint(value string, count uint64, timestamp uint64, attributes []*otlp.KeyValue, metricMetadata core.Metadata, enqueue func([]byte, core.Metadata)) {
+	metadata := metricMetadata.Clone()
+	otlp.AttributesToMetadata(attributes, metadata)
+	if timestamp != 0 {
+		metadata.SetTime("time", otlp.UnixNanoToTime(timestamp))
+	}
+	if count != 0 {
+		metadata.SetInt("count", int64(count))
+	}
+	enqueue([]byte(value), metadata)
+}
+
+// readRequest decodes the body of an OTLP/HTTP request into the given
+// message. The media type of the request is returned. Requests exceeding
+// the maximum message size, before or after decompression, are rejected.
+func (cons *OTLP) readRequest(resp http.ResponseWriter, req *http.Request, message proto.Message) (string, int, error) {
+	if req.Method != http.MethodPost {
+		return "", http.StatusMethodNotAllowed, nil
+	}
+
+	contentType := "application/x-protobuf"
+	if header := req.Header.Get("Content-Type"); header != "" {
+		mediaType, _, err := mime.ParseMediaType(header)
+		if err != nil {
+			return "", http.StatusUnsupportedMediaType, err
+		}
+		contentType = mediaType
+	}
+
+	maxSize := int64(cons.maxMessageSize)
+	data, err := ioutil.ReadAll(http.MaxBytesReader(resp, req.Body, maxSize))
+	if err != nil {
+		if int64(len(data)) >= maxSize {
+			return "", http.StatusRequestEntityTooLarge, err
+		}
+		return "", http.StatusBadRequest, err
+	}
+
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return "", http.StatusBadRequest, err
+		}
+		defer reader.Close()
+
+		// Read one byte more than allowed to detect oversized content
+		if data, err = ioutil.ReadAll(io.LimitReader(reader, maxSize+1)); err != nil {
+			return "", http.StatusBadRequest, err
+		}
+		if int64(len(data)) > maxSize {
+			return "", http.StatusRequestEntityTooLarge, fmt.Errorf("Decompressed request exceeds %d bytes", maxSize)
+		}
+	}
+
+	switch contentType {
+	case "application/json":
+		unmarshaler := jsonpb.Unmarshaler{AllowUnknownFields: true}
+		err = unmarshaler.Unmarshal(bytes.NewReader(data), message)
+	case "application/x-protobuf":
+		err = proto.Unmarshal(data, message)
+	default:
+		return "", http.StatusUnsupportedMediaType, nil
+	}
+
+	if err != nil {
+		return "", http.StatusBadRequest, err
+	}
+	return contentType, http.StatusOK, nil
+}
+
+// writeResponse encodes an OTLP/HTTP response using the given content type
+func (cons *OTLP) writeResponse(resp http.ResponseWriter, contentType string, message proto.Message) {
+	var data []byte
+	if contentType == "application/json" {
+		marshaler := jsonpb.Marshaler{}
+		encoded, err := marshaler.MarshalToString(message)
+		if err != nil {
+			cons.Logger.WithError(err).Error("Failed to encode response")
+		}
+		data = []byte(encoded)
+	} else {
+		data, _ = proto.Marshal(message)
+	}
+
+	resp.Header().Set("Content-Type", contentType)
+	resp.WriteHeader(http.StatusOK)
+	resp.Write(data)
+}
+
+func (cons *OTLP) handleLogs(resp http.ResponseWriter, req *http.Request) {
+	request := new(otlp.ExportLogsServiceRequest)
+	contentType, status, err := cons.readRequest(resp, req, request)
+	if status != http.StatusOK {
+		if err != nil {
+			cons.Logger.WithError(err).Warning("Failed to read logs request")
+		}
+		resp.WriteHeader(status)
+		return // ### return, invalid request ###
+	}
+
+	cons.enqueueLogs(request.GetResourceLogs())
+	cons.writeResponse(resp, contentType, &otlp.ExportLogsServiceResponse{})
+}
+
+func (cons *OTLP) handleMetrics(resp http.ResponseWriter, req *http.Request) {
+	request := new(otlp.ExportMetricsServiceRequest)
+	contentType, status, err := cons.readRequest(resp, req, request)
+	if status != http.StatusOK {
+		if err != nil {
+			cons.Logger.WithError(err).Warning("Failed to read metrics request")
+		}
+		resp.WriteHeader(status)
+		return // ### return, invalid request ###
+	}
+
+	cons.enqueueMetrics(request.GetResourceMetrics())
+	cons.writeResponse(resp, contentType, &otlp.ExportMetricsServiceResponse{})
+}
+
+func (cons *OTLP) serveGRPC(listener net.Listener) {
+	defer cons.WorkerDone()
+
+	if err := cons.grpcServer.Serve(listener); err != nil && cons.IsActive() {
+		cons.Logger.WithError(err).Error("OTLP gRPC server stopped")
+	}
+}
+
+func (cons *OTLP) serveHTTP(listener net.Listener) {
+	defer cons.WorkerDone()
+
+	if err := cons.httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+		cons.Logger.WithError(err).Error("OTLP HTTP server stopped")
+	}
+}
+
+func (cons *OTLP) close() {
+	cons.grpcServer.Stop()
+	cons.httpServer.Close()
+}
+
+// Consume listens for OTLP requests
+func (cons *OTLP) Consume(workers *sync.WaitGroup) {
+	cons.SetWorkerWaitGroup(workers)
+
+	if cons.grpcAddress != "" {
+		listener, err := net.Listen("tcp", cons.grpcAddress)
+		if err != nil {
+			cons.Logger.WithError(err).Error("Failed to listen on ", cons.grpcAddress)
+		} else {
+			cons.AddWorker()
+			go cons.serveGRPC(listener)
+		}
+	}
+
+	if cons.httpAddress != "" {
+		listener, err := net.Listen("tcp", cons.httpAddress)
+		if err != nil {
+			cons.Logger.WithError(err).Error("Failed to listen on ", cons.httpAddress)
+		} else {
+			if tlsConfig := cons.TLS.GetConfig(); tlsConfig != nil {
+				listener = tls.NewListener(listener, tlsConfig)
+			}
+			cons.AddWorker()
+			go cons.serveHTTP(listener)
+		}
+	}
+
+	cons.ControlLoop()
+}
@@ -0,0 +1,235 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/otlp"
+	"github.com/trivago/tgo/ttesting"
+)
+
+type otlpTestMessage struct {
+	payload  string
+	metadata core.Metadata
+}
+
+func newOTLPTestConsumer(expect ttesting.Expect, id string) *OTLP {
+	return newTestPlugin(expect, "consumer.OTLP", id, map[string]interface{}{
+		"LogsStream": "logs",
+	}).(*OTLP)
+}
+
+func newOTLPTestString(value string) *otlp.AnyValue {
+	return &otlp.AnyValue{Value: &otlp.AnyValue_StringValue{StringValue: value}}
+}
+
+func TestOTLPConfigure(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	cons := newOTLPTestConsumer(expect, "otlpConfigure")
+	expect.Equal(core.GetStreamID("logs"), cons.logsStreamID)
+	expect.Equal(core.InvalidStreamID, cons.metricsStreamID)
+
+	_, err := tryNewTestPlugin("consumer.OTLP", "otlpNoAddress", map[string]interface{}{
+		"GrpcAddress": "",
+		"HttpAddress": "",
+	})
+	expect.NotNil(err)
+}
+
+func TestOTLPConvertLogs(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	timestamp := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	resourceLogs := []*otlp.ResourceLogs{{
+		Resource: &otlp.Resource{
+			Attributes: []*otlp.KeyValue{
+				{Key: "service.name", Value: newOTLPTestString("telemetry")},
+				{Key: "car", Value: newOTLPTestString("LR 19")},
+			},
+		},
+		ScopeLogs: []*otlp.ScopeLogs{{
+			Scope: &otlp.InstrumentationScope{Name: "can"},
+			LogRecords: []*otlp.LogRecord{
+				{
+					TimeUnixNano:   uint64(timestamp.UnixNano()),
+					SeverityNumber: otlp.SeverityNumber_SEVERITY_NUMBER_WARN,
+					Body:           newOTLPTestString("oil temperature high"),
+					Attributes: []*otlp.KeyValue{
+						{Key: "car", Value: newOTLPTestString("LR 20")},
+						{Key: "temp", Value: &otlp.AnyValue{Value: &otlp.AnyValue_IntValue{IntValue: 130}}},
+					},
+				},
+				{
+					SeverityText: "info",
+					Body: &otlp.AnyValue{Value: &otlp.AnyValue_KvlistValue{KvlistValue: &otlp.KeyValueList{
+						Values: []*otlp.KeyValue{{Key: "lap", Value: &otlp.AnyValue{Value: &otlp.AnyValue_IntValue{IntValue: 3}}}},
+					}}},
+				},
+			},
+		}},
+	}}
+
+	messages := []otlpTestMessage{}
+	convertOTLPLogs(resourceLogs, func(payload []byte, metadata core.Metadata) {
+		messages = append(messages, otlpTestMessage{string(payload), metadata})
+	})
+
+	expect.Equal(2, len(messages))
+	expect.Equal("oil temperature high", messages[0].payload)
+	expect.Equal("telemetry", messages[0].metadata.GetValueString("service.name"))
+	expect.Equal("LR 20", messages[0].metadata.GetValueString("car"))
+	expect.Equal(int64(130), messages[0].metadata.GetInt("temp"))
+	expect.Equal("can", messages[0].metadata.GetValueString("scope"))
+	expect.Equal("WARN", messages[0].metadata.GetValueString("severity"))
+	expect.True(timestamp.Equal(messages[0].metadata.GetTime("time")))
+
+	expect.Equal(`{"lap":3}`, messages[1].payload)
+	expect.Equal("LR 19", messages[1].metadata.GetValueString("car"))
+	expect.Equal("info", messages[1].metadata.GetValueString("severity"))
+	_, hasTime := messages[1].metadata.TryGet("time")
+	expect.False(hasTime)
+}
+
+func TestOTLPConvertMetrics(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	resourceMetrics := []*otlp.ResourceMetrics{{
+		Resource: &otlp.Resource{
+			Attributes: []*otlp.KeyValue{{Key: "car", Value: newOTLPTestString("LR 19")}},
+		},
+		ScopeMetrics: []*otlp.ScopeMetrics{{
+			Metrics: []*otlp.Metric{
+				{
+					Name: "rpm",
+					Data: &otlp.Metric_Gauge{Gauge: &otlp.Gauge{DataPoints: []*otlp.NumberDataPoint{
+						{Value: &otlp.NumberDataPoint_AsInt{AsInt: 3000}},
+						{Value: &otlp.NumberDataPoint_AsInt{AsInt: 3500}},
+					}}},
+				},
+				{
+					Name: "fuel",
+					Unit: "l",
+					Data: &otlp.Metric_Sum{Sum: &otlp.Sum{DataPoints: []*otlp.NumberDataPoint{
+						{Value: &otlp.NumberDataPoint_AsDouble{AsDouble: 12.5}},
+					}}},
+				},
+				{
+					Name: "lap_time",
+					Data: &otlp.Metric_Histogram{Histogram: &otlp.Histogram{DataPoints: []*otlp.HistogramDataPoint{
+						{Count: 3, Sum: 270.25},
+					}}},
+				},
+			},
+		}},
+	}}
+
+	messages := []otlpTestMessage{}
+	convertOTLPMetrics(resourceMetrics, func(payload []byte, metadata core.Metadata) {
+		messages = append(messages, otlpTestMessage{string(payload), metadata})
+	})
+
+	expect.Equal(4, len(messages))
+	expect.Equal("3000", messages[0].payload)
+	expect.Equal("3500", messages[1].payload)
+	expect.Equal("rpm", messages[1].metadata.GetValueString("name"))
+	expect.Equal("gauge", messages[1].metadata.GetValueString("type"))
+	expect.Equal("LR 19", messages[1].metadata.GetValueString("car"))
+
+	expect.Equal("12.5", messages[2].payload)
+	expect.Equal("sum", messages[2].metadata.GetValueString("type"))
+	expect.Equal("l", messages[2].metadata.GetValueString("unit"))
+
+	expect.Equal("270.25", messages[3].payload)
+	expect.Equal("histogram", messages[3].metadata.GetValueString("type"))
+	expect.Equal(int64(3), messages[3].metadata.GetInt("count"))
+}
+
+func TestOTLPReadRequest(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	cons := newOTLPTestConsumer(expect, "otlpReadRequest")
+
+	// OTLP/JSON uses lowerCamelCase names and encodes 64 bit integers as strings
+	body := `{"resourceLogs":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"telemetry"}}]},
+		"scopeLogs":[{"logRecords":[{"timeUnixNano":"1714564800000000000","severityNumber":9,
+		"traceId":"5b8efff798038103d269b633813fc60c","body":{"stringValue":"started"}}]}]}]}`
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/logs", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	request := new(otlp.ExportLogsServiceRequest)
+	contentType, status, err := cons.readRequest(httptest.NewRecorder(), req, request)
+	expect.NoError(err)
+	expect.Equal(http.StatusOK, status)
+	expect.Equal("application/json", contentType)
+
+	record := request.GetResourceLogs()[0].GetScopeLogs()[0].GetLogRecords()[0]
+	expect.Equal(uint64(1714564800000000000), record.GetTimeUnixNano())
+	expect.Equal(otlp.SeverityNumber_SEVERITY_NUMBER_INFO, record.GetSeverityNumber())
+	expect.Equal("started", record.GetBody().GetStringValue())
+
+	// Binary protobuf, gzip compressed
+	data, err := proto.Marshal(request)
+	expect.NoError(err)
+
+	compressed := bytes.NewBuffer(nil)
+	writer := gzip.NewWriter(compressed)
+	writer.Write(data)
+	writer.Close()
+
+	req = httptest.NewRequest(http.MethodPost, "/v1/logs", compressed)
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "gzip")
+
+	decoded := new(otlp.ExportLogsServiceRequest)
+	contentType, status, err = cons.readRequest(httptest.NewRecorder(), req, decoded)
+	expect.NoError(err)
+	expect.Equal(http.StatusOK, status)
+	expect.Equal("application/x-protobuf", contentType)
+	expect.True(proto.Equal(request, decoded))
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/logs", nil)
+	_, status, _ = cons.readRequest(httptest.NewRecorder(), req, decoded)
+	expect.Equal(http.StatusMethodNotAllowed, status)
+
+	req = httptest.NewRequest(http.MethodPost, "/v1/logs", strings.NewReader("rpm=3000"))
+	req.Header.Set("Content-Type", "text/plain")
+	_, status, _ = cons.readRequest(httptest.NewRecorder(), req, decoded)
+	expect.Equal(http.StatusUnsupportedMediaType, status)
+
+	// Requests exceeding the size limit before or after decompression
+	req = httptest.NewRequest(http.MethodPost, "/v1/logs", bytes.NewReader(make([]byte, cons.maxMessageSize+1)))
+	_, status, _ = cons.readRequest(httptest.NewRecorder(), req, decoded)
+	expect.Equal(http.StatusRequestEntityTooLarge, status)
+
+	compressed.Reset()
+	writer = gzip.NewWriter(compressed)
+	writer.Write(make([]byte, cons.maxMessageSize+1))
+	writer.Close()
+
+	req = httptest.NewRequest(http.MethodPost, "/v1/logs", compressed)
+	req.Header.Set("Content-Encoding", "gzip")
+	_, status, _ = cons.readRequest(httptest.NewRecorder(), req, decoded)
+	expect.Equal(http.StatusRequestEntityTooLarge, status)
+}
@@ -0,0 +1,435 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/pcap"
+	"github.com/trivago/tgo"
+	"golang.org/x/net/bpf"
+)
+
+const (
+	pcapEmitPacket  = "packet"
+	pcapEmitPayload = "payload"
+	pcapEmitStream  = "stream"
+)
+
+// pcapSource is a capture file or live capture socket. Live sources return a
+// nil packet if no packet arrived within the read timeout.
+type pcapSource interface {
+	pcap.Reader
+	Close() error
+}
+
+// Pcap consumer plugin
+//
+// The Pcap consumer captures network traffic without requiring libpcap. Live
+// capture uses AF_PACKET raw sockets and is only available on linux. Capture
+// files in pcap or pcapng format can be read on all platforms, e.g. to replay
+// captures in tests.
+//
+// Depending on the Emit setting, messages contain complete packets including
+// the link layer header, the TCP or UDP payload of each packet or reassembled
+// TCP payloads. Reassembled payloads are sent when the sender sets the PSH
+// flag, the connection is closed, StreamMaxSizeKB is reached or the connection
+// is idle for StreamTimeoutMs.
+//
+// Metadata
+//
+// - timestamp: Capture time of the (first) packet
+//
+// - interface: Name of the capture interface, if known
+//
+// - length: Original length of the packet (packet mode only)
+//
+// - src_mac, dst_mac: Ethernet addresses, if available
+//
+// - ip_version: 4 or 6
+//
+// - src_ip, dst_ip: IP addresses
+//
+// - protocol: IP protocol, e.g. "tcp", "udp" or "icmp"
+//
+// - ttl: IPv4 time to live or IPv6 hop limit
+//
+// - src_port, dst_port: TCP or UDP ports
+//
+// - tcp_flags: TCP flags in tcpdump notation, e.g. "S." (packet and payload mode only)
+//
+// - tcp_seq, tcp_ack: TCP sequence and acknowledgement numbers
+//
+// Parameters
+//
+// - Interface: Defines the network interface to capture on. Either Interface
+// or Files has to be set.
+// By default this parameter is set to "".
+//
+// - Files: Defines the capture file(s) to read. This field supports glob
+// patterns and directories. Files are read ordered by modification time.
+// By default this parameter is set to "".
+//
+// - Filter: Defines a compiled BPF program as printed by "tcpdump -dd" or
+// "tcpdump -ddd", e.g. `tcpdump -i eth0 -ddd "udp port 5880"`. For capture
+// files the program is evaluated in user space. If empty, all packets are
+// captured.
+// By default this parameter is set to "".
+//
+// - Promiscuous: When set to true, the interface is switched to promiscuous
+// mode to capture traffic not addressed to this host.
+// By default this parameter is set to false.
+//
+// - SnapLen: Defines the maximum number of bytes captured per packet.
+// By default this parameter is set to 65535.
+//
+// - Emit: Defines the message content. Set to "packet" for complete packets,
+// "payload" for the TCP or UDP payload of each packet or "stream" for
+// reassembled TCP payloads. Packets without payload are skipped in payload and
+// stream mode.
+// By default this parameter is set to "packet".
+//
+// - StreamTimeoutMs: Defines the time after which buffered data of an idle TCP
+// connection is sent in stream mode.
+// By default this parameter is set to 5000.
+//
+// - StreamMaxSizeKB: Defines the maximum size of a reassembled payload in
+// stream mode.
+// By default this parameter is set to 1024.
+//
+// - Speed: Defines the replay speed for capture files relative to the capture
+// timing. A value of 0 reads files as fast as possible.
+// By default this parameter is set to 0.
+//
+// - ReadTimeoutMs: Defines the timeout of a single read from a live capture
+// socket.
+// By default this parameter is set to 500.
+//
+// - RetryDelaySec: Defines the time to wait before a live capture socket is
+// reopened after a read error, e.g. because the interface went down.
+// By default this parameter is set to 3.
+//
+// - ExitOnEOF: When set to true, gollum is shut down after all capture files
+// have been read.
+// By default this parameter is set to true.
+//
+// Examples
+//
+// This example captures the payload of all IPv4 packets. The filter was
+// created by running `tcpdump -i wlan0 -ddd ip`.
+//
+//  CaptureTelemetry:
+//    Type: consumer.Pcap
+//    Streams: captured
+//    Interface: wlan0
+//    Emit: payload
+//    Filter: |
+//      4
+//      40 0 0 12
+//      21 0 1 2048
+//      6 0 0 262144
+//      6 0 0 0
+//
+// This example replays the HTTP requests of a capture file at original speed.
+//
+//  ReplayCapture:
+//    Type: consumer.Pcap
+//    Streams: captured
+//    Files: testdata/session.pcapng
+//    Emit: stream
+//    Speed: 1
+//
+type Pcap struct {
+	core.SimpleConsumer `gollumdoc:"embed_type"`
+	interfaceName       string        `config:"Interface"`
+	fileName            string        `config:"Files"`
+	promiscuous         bool          `config:"Promiscuous" default:"false"`
+	snapLen             int           `config:"SnapLen" default:"65535"`
+	emit                string        `config:"Emit" default:"packet"`
+	streamTimeout       time.Duration `config:"StreamTimeoutMs" default:"5000" metric:"ms"`
+	streamMaxSize       int           `config:"StreamMaxSizeKB" default:"1024" metric:"kb"`
+	readTimeout         time.Duration `config:"ReadTimeoutMs" default:"500" metric:"ms"`
+	retryDelay          time.Duration `config:"RetryDelaySec" default:"3" metric:"s"`
+	exitOnEOF           bool          `config:"ExitOnEOF" default:"true"`
+	speed               float64
+	program             []bpf.RawInstruction
+	filter              *pcap.Filter
+	assembler           *pcap.StreamAssembler
+	done                chan struct{}
+}
+
+func init() {
+	core.TypeRegistry.Register(Pcap{})
+}
+
+// Configure initializes this consumer with values from a plugin config.
+func (cons *Pcap) Configure(conf core.PluginConfigReader) {
+	cons.done = make(chan struct{})
+	cons.SetStopCallback(func() {
+		close(cons.done)
+	})
+
+	if (cons.interfaceName == "") == (cons.fileName == "") {
+		conf.Errors.Pushf("Either Interface or Files has to be set")
+	}
+
+	switch cons.emit {
+	case pcapEmitPacket, pcapEmitPayload:
+	case pcapEmitStream:
+		cons.assembler = pcap.NewStreamAssembler(cons.streamTimeout, cons.streamMaxSize)
+	default:
+		conf.Errors.Pushf("Unknown emit mode '%s'", cons.emit)
+	}
+
+	if filter := strings.TrimSpace(conf.GetString("Filter", "")); filter != "" {
+		var err error
+		if cons.program, err = pcap.ParseFilter(filter); conf.Errors.Push(err) {
+			return
+		}
+		if cons.fileName != "" {
+			cons.filter, err = pcap.NewFilter(cons.program)
+			conf.Errors.Push(err)
+		}
+	}
+
+	switch speed := conf.GetValue("Speed", 0).(type) {
+	case float64:
+		cons.speed = speed
+	case int:
+		cons.speed = float64(speed)
+	default:
+		conf.Errors.Pushf("Speed must be a number")
+	}
+}
+
+func (cons *Pcap) newMetadata(packet *pcap.Packet, header pcap.Decoded, decoded bool) core.Metadata {
+	metadata := core.Metadata{}
+	metadata.SetTime("timestamp", packet.Timestamp)
+	if packet.Interface != "" {
+		metadata.SetValue("interface", []byte(packet.Interface))
+	}
+	if !decoded {
+		return metadata
+	}
+
+	if header.SrcMAC != nil {
+		metadata.SetValue("src_mac", []byte(header.SrcMAC.String()))
+		metadata.SetValue("dst_mac", []byte(header.DstMAC.String()))
+	}
+
+	metadata.SetInt("ip_version", int64(header.IPVersion))
+	metadata.SetValue("src_ip", []byte(header.SrcIP.String()))
+	metadata.SetValue("dst_ip", []byte(header.DstIP.String()))
+	metadata.SetValue("protocol", []byte(header.ProtocolName()))
+	metadata.SetInt("ttl", int64(header.TTL))
+
+	if header.Protocol == pcap.ProtocolTCP || header.Protocol == pcap.ProtocolUDP {
+		metadata.SetInt("src_port", int64(header.SrcPort))
+		metadata.SetInt("dst_port", int64(header.DstPort))
+	}
+	if header.Protocol == pcap.ProtocolTCP {
+		metadata.SetInt("tcp_seq", int64(header.Seq))
+		metadata.SetInt("tcp_ack", int64(header.Ack))
+		if cons.emit != pcapEmitStream {
+			metadata.SetValue("tcp_flags", []byte(header.FlagNames()))
+		}
+	}
+	return metadata
+}
+
+func (cons *Pcap) enqueueStreams(packet *pcap.Packet, streams []pcap.Stream) {
+	for _, stream := range streams {
+		streamPacket := *packet
+		streamPacket.Timestamp = stream.Timestamp
+		cons.EnqueueWithMetadata(stream.Payload, cons.newMetadata(&streamPacket, stream.Header, true))
+	}
+}
+
+func (cons *Pcap) processPacket(packet *pcap.Packet) {
+	if cons.filter != nil && !cons.filter.Matches(packet.Data) {
+		return // ### return, filtered ###
+	}
+
+	header, err := pcap.Decode(packet.LinkType, packet.Data)
+	decoded := err == nil
+
+	switch cons.emit {
+	case pcapEmitPacket:
+		metadata := cons.newMetadata(packet, header, decoded)
+		metadata.SetInt("length", int64(packet.OriginalLength))
+		cons.EnqueueWithMetadata(packet.Data, metadata)
+
+	case pcapEmitPayload:
+		if decoded && !header.Fragment && len(header.Payload) > 0 &&
+			(header.Protocol == pcap.ProtocolTCP || header.Protocol == pcap.ProtocolUDP) {
+			cons.EnqueueWithMetadata(header.Payload, cons.newMetadata(packet, header, true))
+		}
+
+	case pcapEmitStream:
+		cons.enqueueStreams(packet, cons.assembler.Expire(packet.Timestamp))
+		if decoded {
+			cons.enqueueStreams(packet, cons.assembler.Add(header, packet.Timestamp))
+		}
+	}
+}
+
+// readSource processes all packets of a source until it ends or fails. False
+// is returned if the consumer is stopped.
+func (cons *Pcap) readSource(source pcapSource, clock *replayClock) bool {
+	for {
+		select {
+		default:
+		case <-cons.done:
+			return false // exit requested
+		}
+
+		packet, err := source.ReadPacket()
+		switch {
+		case err == io.EOF:
+			return true // ### return, end of source ###
+		case err != nil:
+			cons.Logger.WithError(err).Error("Failed to read packet")
+			return true // ### return, source failed ###
+		}
+
+		if packet == nil {
+			// Live capture without traffic
+			if cons.assembler != nil {
+				cons.enqueueStreams(&pcap.Packet{Interface: cons.interfaceName}, cons.assembler.Expire(time.Now()))
+			}
+			continue
+		}
+
+		if clock != nil {
+			if delay := clock.delay(packet.Timestamp); delay > 0 {
+				select {
+				case <-time.After(delay):
+				case <-cons.done:
+					return false // exit requested
+				}
+			}
+		}
+		cons.processPacket(packet)
+	}
+}
+
+func (cons *Pcap) readFiles() {
+	defer cons.WorkerDone()
+
+	fileNames, err := globFilesByModTime(cons.fileName)
+	if err != nil {
+		cons.Logger.WithError(err).Errorf("Failed to evaluate glob '%s'", cons.fileName)
+		return
+	}
+
+	clock := &replayClock{speed: cons.speed}
+	for _, name := range fileNames {
+		file, err := os.Open(name)
+		if err != nil {
+			cons.Logger.WithError(err).Error("Failed to open ", name)
+			continue
+		}
+
+		cons.Logger.Info("Reading ", name)
+		source, err := newPcapFileSource(file)
+		if err != nil {
+			cons.Logger.WithError(err).Error("Failed to read ", name)
+			file.Close()
+			continue
+		}
+
+		active := cons.readSource(source, clock)
+		source.Close()
+		if !active {
+			return // ### return, stopped ###
+		}
+	}
+
+	if cons.assembler != nil {
+		cons.enqueueStreams(&pcap.Packet{}, cons.assembler.Flush())
+	}
+
+	if cons.exitOnEOF {
+		cons.Logger.Info("Exit triggered by EOF.")
+		tgo.ShutdownCallback()
+	}
+}
+
+func (cons *Pcap) capture() {
+	defer cons.WorkerDone()
+
+	source, err := newPcapLiveSource(cons.interfaceName, cons.promiscuous, cons.snapLen, cons.program, cons.readTimeout)
+	if err != nil {
+		cons.Logger.WithError(err).Error("Failed to capture on ", cons.interfaceName)
+		return
+	}
+
+	for {
+		active := cons.readSource(source, nil)
+		source.Close()
+		if !active {
+			return // ### return, stopped ###
+		}
+
+		// Reopen the socket after read errors until the consumer is stopped
+		for {
+			select {
+			case <-time.After(cons.retryDelay):
+			case <-cons.done:
+				return // exit requested
+			}
+
+			cons.Logger.Info("Reopening capture on ", cons.interfaceName)
+			if source, err = newPcapLiveSource(cons.interfaceName, cons.promiscuous, cons.snapLen, cons.program, cons.readTimeout); err == nil {
+				break
+			}
+			cons.Logger.WithError(err).Error("Failed to capture on ", cons.interfaceName)
+		}
+	}
+}
+
+// Consume starts capturing or reading capture files
+func (cons *Pcap) Consume(workers *sync.WaitGroup) {
+	cons.AddMainWorker(workers)
+	if cons.fileName != "" {
+		go tgo.WithRecoverShutdown(cons.readFiles)
+	} else {
+		go tgo.WithRecoverShutdown(cons.capture)
+	}
+	cons.ControlLoop()
+}
+
+// pcapFileSource wraps a capture file reader.
+type pcapFileSource struct {
+	pcap.Reader
+	file *os.File
+}
+
+func newPcapFileSource(file *os.File) (pcapSource, error) {
+	reader, err := pcap.NewFileReader(file)
+	if err != nil {
+		return nil, err
+	}
+	return &pcapFileSource{Reader: reader, file: file}, nil
+}
+
+func (source *pcapFileSource) Close() error {
+	return source.file.Close()
+}
@@ -0,0 +1,135 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build linux
+
+package consumer
+
+import (
+	"net"
+	"time"
+	"unsafe"
+
+	"github.com/trivago/gollum/core/pcap"
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+// pcapLiveSource captures packets from an AF_PACKET raw socket.
+type pcapLiveSource struct {
+	fd       int
+	linkType pcap.LinkType
+	iface    string
+	buffer   []byte
+}
+
+// htons converts a value to network byte order.
+func htons(value uint16) uint16 {
+	probe := uint16(1)
+	if *(*byte)(unsafe.Pointer(&probe)) == 0 {
+		return value // big endian host
+	}
+	return value<<8 | value>>8
+}
+
+func newPcapLiveSource(ifaceName string, promiscuous bool, snapLen int, program []bpf.RawInstruction, readTimeout time.Duration) (pcapSource, error) {
+	iface, err := net.InterfaceByName(ifaceName)
+	if err != nil {
+		return nil, err
+	}
+
+	protocol := htons(unix.ETH_P_ALL)
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, int(protocol))
+	if err != nil {
+		return nil, err
+	}
+
+	source := &pcapLiveSource{
+		fd:       fd,
+		linkType: pcap.LinkTypeEthernet,
+		iface:    ifaceName,
+		buffer:   make([]byte, snapLen),
+	}
+
+	// Interfaces without link layer address, e.g. tunnels, deliver IP packets
+	if len(iface.HardwareAddr) == 0 && iface.Flags&net.FlagLoopback == 0 {
+		source.linkType = pcap.LinkTypeRaw
+	}
+
+	if err := source.configure(iface, protocol, promiscuous, program, readTimeout); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	return source, nil
+}
+
+func (source *pcapLiveSource) configure(iface *net.Interface, protocol uint16, promiscuous bool, program []bpf.RawInstruction, readTimeout time.Duration) error {
+	// The filter is attached before binding so that no unfiltered packets are
+	// received.
+	if len(program) > 0 {
+		filter := make([]unix.SockFilter, len(program))
+		for i, instruction := range program {
+			filter[i] = unix.SockFilter{Code: instruction.Op, Jt: instruction.Jt, Jf: instruction.Jf, K: instruction.K}
+		}
+		fprog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+		if err := unix.SetsockoptSockFprog(source.fd, unix.SOL_SOCKET, unix.SO_ATTACH_FILTER, &fprog); err != nil {
+			return err
+		}
+	}
+
+	if err := unix.Bind(source.fd, &unix.SockaddrLinklayer{Protocol: protocol, Ifindex: iface.Index}); err != nil {
+		return err
+	}
+
+	if promiscuous {
+		mreq := unix.PacketMreq{Ifindex: int32(iface.Index), Type: unix.PACKET_MR_PROMISC}
+		if err := unix.SetsockoptPacketMreq(source.fd, unix.SOL_PACKET, unix.PACKET_ADD_MEMBERSHIP, &mreq); err != nil {
+			return err
+		}
+	}
+
+	timeout := unix.NsecToTimeval(readTimeout.Nanoseconds())
+	return unix.SetsockoptTimeval(source.fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &timeout)
+}
+
+// ReadPacket returns the next captured packet or nil if no packet arrived
+// within the read timeout.
+func (source *pcapLiveSource) ReadPacket() (*pcap.Packet, error) {
+	size, _, err := unix.Recvfrom(source.fd, source.buffer, unix.MSG_TRUNC)
+	switch err {
+	case nil:
+	case unix.EAGAIN, unix.EINTR:
+		return nil, nil
+	default:
+		return nil, err
+	}
+
+	captured := size
+	if captured > len(source.buffer) {
+		captured = len(source.buffer)
+	}
+
+	return &pcap.Packet{
+		Timestamp:      time.Now(),
+		LinkType:       source.linkType,
+		Interface:      source.iface,
+		Data:           append([]byte(nil), source.buffer[:captured]...),
+		OriginalLength: size,
+	}, nil
+}
+
+// Close closes the capture socket.
+func (source *pcapLiveSource) Close() error {
+	return unix.Close(source.fd)
+}
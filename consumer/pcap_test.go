@@ -0,0 +1,145 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/tgo/ttesting"
+)
+
+// newPcapTestFile writes a capture file with UDP packets using raw IPv4 link
+// type.
+func newPcapTestFile(expect ttesting.Expect, payloads ...string) string {
+	content := make([]byte, 24)
+	binary.LittleEndian.PutUint32(content[0:], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint32(content[16:], 65535)
+	binary.LittleEndian.PutUint32(content[20:], 101)
+
+	for i, payload := range payloads {
+		packet := make([]byte, 28, 28+len(payload))
+		packet[0] = 0x45
+		binary.BigEndian.PutUint16(packet[2:], uint16(28+len(payload)))
+		packet[8] = 64
+		packet[9] = 17
+		copy(packet[12:], []byte{192, 168, 0, 10})
+		copy(packet[16:], []byte{239, 255, 0, 1})
+		binary.BigEndian.PutUint16(packet[20:], 5000)
+		binary.BigEndian.PutUint16(packet[22:], 5880)
+		binary.BigEndian.PutUint16(packet[24:], uint16(8+len(payload)))
+		packet = append(packet, payload...)
+
+		record := make([]byte, 16)
+		binary.LittleEndian.PutUint32(record[0:], 1500000000)
+		binary.LittleEndian.PutUint32(record[4:], uint32(i))
+		binary.LittleEndian.PutUint32(record[8:], uint32(len(packet)))
+		binary.LittleEndian.PutUint32(record[12:], uint32(len(packet)))
+		content = append(content, record...)
+		content = append(content, packet...)
+	}
+
+	dir, err := ioutil.TempDir("", "gollum-pcap")
+	expect.NoError(err)
+	fileName := filepath.Join(dir, "capture.pcap")
+	expect.NoError(ioutil.WriteFile(fileName, content, 0644))
+	return fileName
+}
+
+func TestPcapConfigure(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	_, err := tryNewTestPlugin("consumer.Pcap", "pcapNoSource")
+	expect.NotNil(err)
+
+	_, err = tryNewTestPlugin("consumer.Pcap", "pcapInvalidFilter", map[string]interface{}{
+		"Files":  "capture.pcap",
+		"Filter": "1 2 3",
+	})
+	expect.NotNil(err)
+}
+
+func TestPcapFilePayload(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	router := &httpTestRouter{streamID: core.GetStreamID("pcapFilePayload")}
+	core.StreamRegistry.Register(router, router.streamID)
+
+	fileName := newPcapTestFile(expect, "rpm=3000", "rpm=3100")
+	defer os.RemoveAll(filepath.Dir(fileName))
+
+	cons := newTestPlugin(expect, "consumer.Pcap", "pcapFilePayload", map[string]interface{}{
+		"Files":   fileName,
+		"Emit":    "payload",
+		"Streams": []string{"pcapFilePayload"},
+		// tcpdump -y RAW -ddd "udp"
+		"Filter": "7\n48 0 0 0\n84 0 0 240\n21 0 3 64\n48 0 0 9\n21 0 1 17\n6 0 0 262144\n6 0 0 0",
+	}).(*Pcap)
+
+	file, err := os.Open(fileName)
+	expect.NoError(err)
+	defer file.Close()
+
+	source, err := newPcapFileSource(file)
+	expect.NoError(err)
+	expect.True(cons.readSource(source, nil))
+
+	expect.Equal(2, len(router.messages))
+	msg := router.messages[1]
+	expect.Equal("rpm=3100", msg.String())
+
+	metadata := msg.GetMetadata()
+	expect.Equal("192.168.0.10", metadata.GetValueString("src_ip"))
+	expect.Equal("239.255.0.1", metadata.GetValueString("dst_ip"))
+	expect.Equal("udp", metadata.GetValueString("protocol"))
+	expect.Equal(int64(5880), metadata.GetInt("dst_port"))
+	expect.Equal(int64(1500000000000001000), metadata.GetTime("timestamp").UnixNano())
+}
+
+func TestPcapFileTruncated(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	router := &httpTestRouter{streamID: core.GetStreamID("pcapFileTruncated")}
+	core.StreamRegistry.Register(router, router.streamID)
+
+	fileName := newPcapTestFile(expect, "rpm=3000", "rpm=3100")
+	defer os.RemoveAll(filepath.Dir(fileName))
+
+	content, err := ioutil.ReadFile(fileName)
+	expect.NoError(err)
+	expect.NoError(ioutil.WriteFile(fileName, content[:len(content)-4], 0644))
+
+	cons := newTestPlugin(expect, "consumer.Pcap", "pcapFileTruncated", map[string]interface{}{
+		"Files":   fileName,
+		"Emit":    "payload",
+		"Streams": []string{"pcapFileTruncated"},
+	}).(*Pcap)
+
+	file, err := os.Open(fileName)
+	expect.NoError(err)
+	defer file.Close()
+
+	// Read errors end the source after the packets read so far
+	source, err := newPcapFileSource(file)
+	expect.NoError(err)
+	expect.True(cons.readSource(source, nil))
+
+	expect.Equal(1, len(router.messages))
+	expect.Equal("rpm=3000", router.messages[0].String())
+}
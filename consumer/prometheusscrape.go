@@ -0,0 +1,192 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/components"
+)
+
+// PrometheusScrape consumer
+//
+// This consumer periodically scrapes Prometheus metrics endpoints and
+// generates a message for each sample. The text exposition format and the
+// protobuf format are supported. Summaries and histograms are split into
+// their individual samples (e.g. "_sum", "_count" and "_bucket") in the same
+// way Prometheus does. The payload of each message is the sample value.
+//
+// Parameters
+//
+// - Targets: Defines a list of URLs to scrape.
+// By default this parameter is set to "http://localhost:9100/metrics".
+//
+// - IntervalSec: Defines the interval between two scrapes.
+// By default this parameter is set to 15.
+//
+// - TimeoutMs: Defines the maximum time a single scrape may take.
+// By default this parameter is set to 10000.
+//
+// - BearerToken: Defines a token sent in the Authorization header.
+// By default this parameter is set to "".
+//
+// Metadata
+//
+// All labels of a sample are stored with their original name. Labels named
+// "name", "target" or "time" are stored as "exported_<label>" so that they
+// do not collide with the fields below.
+//
+// - name: The name of the metric
+//
+// - target: The URL the sample has been scraped from
+//
+// - time: The timestamp of the sample. If the target did not provide a
+// timestamp, the time of the scrape is used.
+//
+// Examples
+//
+// This example scrapes the metrics of a local node exporter every 30 seconds.
+//
+//  NodeMetrics:
+//    Type: consumer.PrometheusScrape
+//    Streams: metrics
+//    Targets:
+//      - "http://localhost:9100/metrics"
+//    IntervalSec: 30
+//
+type PrometheusScrape struct {
+	core.SimpleConsumer `gollumdoc:"embed_type"`
+	TLS                 components.TLSConfig `gollumdoc:"embed_type"`
+	targets             []string             `config:"Targets" default:"http://localhost:9100/metrics"`
+	interval            time.Duration        `config:"IntervalSec" default:"15" metric:"sec"`
+	timeout             time.Duration        `config:"TimeoutMs" default:"10000" metric:"ms"`
+	bearerToken         string               `config:"BearerToken"`
+	client              http.Client
+}
+
+func init() {
+	core.TypeRegistry.Register(PrometheusScrape{})
+}
+
+// Configure initializes this consumer with values from a plugin config.
+func (cons *PrometheusScrape) Configure(conf core.PluginConfigReader) {
+	if len(cons.targets) == 0 {
+		conf.Errors.Pushf("At least one target has to be set")
+	}
+	if cons.interval <= 0 {
+		conf.Errors.Pushf("IntervalSec must be larger than 0")
+	}
+
+	cons.client.Timeout = cons.timeout
+	if tlsConfig := cons.TLS.GetConfig(); tlsConfig != nil {
+		cons.client.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+	}
+}
+
+// scrape reads all samples from the given target and passes them to enqueue
+func (cons *PrometheusScrape) scrape(target string, enqueue func([]byte, core.Metadata)) error {
+	request, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Accept", string(expfmt.FmtProtoDelim)+";q=0.7,"+string(expfmt.FmtText)+";q=0.3,*/*;q=0.1")
+	request.Header.Set("User-Agent", "gollum/"+core.GetVersionString())
+	if cons.bearerToken != "" {
+		request.Header.Set("Authorization", "Bearer "+cons.bearerToken)
+	}
+
+	scrapeTime := time.Now()
+	response, err := cons.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", target, response.Status)
+	}
+
+	format := expfmt.ResponseFormat(response.Header)
+	if format == expfmt.FmtUnknown {
+		format = expfmt.FmtText
+	}
+
+	decoder := &expfmt.SampleDecoder{
+		Dec: expfmt.NewDecoder(response.Body, format),
+		Opts: &expfmt.DecodeOptions{
+			Timestamp: model.TimeFromUnixNano(scrapeTime.UnixNano()),
+		},
+	}
+
+	for {
+		var samples model.Vector
+		if err := decoder.Decode(&samples); err != nil {
+			if err == io.EOF {
+				return nil // ### return, done ###
+			}
+			return err
+		}
+
+		for _, sample := range samples {
+			metadata := make(core.Metadata, len(sample.Metric)+2)
+			for name, value := range sample.Metric {
+				switch name {
+				case model.MetricNameLabel:
+				case "name", "target", "time":
+					metadata.SetValue("exported_"+string(name), []byte(value))
+				default:
+					metadata.SetValue(string(name), []byte(value))
+				}
+			}
+			metadata.SetValue("name", []byte(sample.Metric[model.MetricNameLabel]))
+			metadata.SetValue("target", []byte(target))
+			metadata.SetTime("time", sample.Timestamp.Time())
+
+			enqueue([]byte(strconv.FormatFloat(float64(sample.Value), 'f', -1, 64)), metadata)
+		}
+	}
+}
+
+func (cons *PrometheusScrape) scrapeAll() {
+	cons.AddWorker()
+	defer cons.WorkerDone()
+
+	wg := new(sync.WaitGroup)
+	for _, target := range cons.targets {
+		wg.Add(1)
+		go func(target string) {
+			defer wg.Done()
+			if err := cons.scrape(target, cons.EnqueueWithMetadata); err != nil {
+				cons.Logger.WithError(err).Warning("Failed to scrape ", target)
+			}
+		}(target)
+	}
+	wg.Wait()
+}
+
+// Consume scrapes all targets periodically
+func (cons *PrometheusScrape) Consume(workers *sync.WaitGroup) {
+	cons.SetWorkerWaitGroup(workers)
+	cons.TickerControlLoop(cons.interval, cons.scrapeAll)
+}
@@ -0,0 +1,79 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/tgo/ttesting"
+)
+
+const prometheusTestMetrics = `# HELP engine_rpm Engine speed
+# TYPE engine_rpm gauge
+engine_rpm{car="19",cylinder="all",target="front"} 3000
+# TYPE lap_time_seconds summary
+lap_time_seconds{quantile="0.5"} 92.5
+lap_time_seconds_sum 270.25
+lap_time_seconds_count 3
+# TYPE pit_stops_total counter
+pit_stops_total 2 1714564800000
+`
+
+func TestPrometheusScrape(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expect.Equal("Bearer secret", r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write([]byte(prometheusTestMetrics))
+	}))
+	defer server.Close()
+
+	cons := newTestPlugin(expect, "consumer.PrometheusScrape", "prometheusScrape", map[string]interface{}{
+		"Targets":     []string{server.URL},
+		"BearerToken": "secret",
+	}).(*PrometheusScrape)
+
+	// Metric families are not returned in a defined order
+	payloads := make(map[string]string)
+	metadata := make(map[string]core.Metadata)
+	err := cons.scrape(server.URL, func(payload []byte, meta core.Metadata) {
+		name := meta.GetValueString("name")
+		payloads[name] = string(payload)
+		metadata[name] = meta
+	})
+	expect.NoError(err)
+
+	expect.Equal(map[string]string{
+		"engine_rpm":             "3000",
+		"lap_time_seconds":       "92.5",
+		"lap_time_seconds_sum":   "270.25",
+		"lap_time_seconds_count": "3",
+		"pit_stops_total":        "2",
+	}, payloads)
+	expect.Equal("19", metadata["engine_rpm"].GetValueString("car"))
+	expect.Equal("all", metadata["engine_rpm"].GetValueString("cylinder"))
+	expect.Equal(server.URL, metadata["engine_rpm"].GetValueString("target"))
+	expect.Equal("front", metadata["engine_rpm"].GetValueString("exported_target"))
+
+	expect.Equal("0.5", metadata["lap_time_seconds"].GetValueString("quantile"))
+	expect.Equal(int64(1714564800000000000), metadata["pit_stops_total"].GetTime("time").UnixNano())
+
+	err = cons.scrape(server.URL+"/missing\x7f", func([]byte, core.Metadata) {})
+	expect.NotNil(err)
+}
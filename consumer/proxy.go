@@ -21,6 +21,7 @@ import (
 	"sync"
 
 	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/components"
 	"github.com/trivago/tgo"
 	"github.com/trivago/tgo/tio"
 	"github.com/trivago/tgo/tnet"
@@ -32,6 +33,8 @@ import (
 // allows reverse communication, too. Producers which require this kind of
 // communication can access message.GetSource to write data back to the client
 // sending the message. See producer.Proxy as an example target producer.
+// Connections can be secured by TLS. If TlsClientCaLocation is set, clients
+// have to authenticate with a certificate.
 //
 // Parameters
 //
@@ -88,8 +91,22 @@ import (
 //    Partitioner: binary
 //    Size: 8
 //
+// This example does the same using mutual TLS.
+//
+//  proxyTlsReceive:
+//    Type: consumer.Proxy
+//    Streams: proxyData
+//    Address: ":5880"
+//    Partitioner: binary
+//    Size: 8
+//    TlsEnable: true
+//    TlsCertificateLocation: /etc/gollum/pit.crt
+//    TlsKeyLocation: /etc/gollum/pit.key
+//    TlsClientCaLocation: /etc/gollum/cars-ca.pem
+//
 type Proxy struct {
 	core.SimpleConsumer `gollumdoc:"embed_type"`
+	TLS                 components.TLSServerConfig `gollumdoc:"embed_type"`
 	listen              io.Closer
 	protocol            string
 	address             string
@@ -167,12 +184,12 @@ func (cons *Proxy) accept() {
 
 // Consume listens to a given socket.
 func (cons *Proxy) Consume(workers *sync.WaitGroup) {
-	var err error
-
-	if cons.listen, err = net.Listen(cons.protocol, cons.address); err != nil {
+	listener, err := net.Listen(cons.protocol, cons.address)
+	if err != nil {
 		cons.Logger.Error("Connection error: ", err)
 		return
 	}
+	cons.listen = cons.TLS.Listener(listener)
 
 	go tgo.WithRecoverShutdown(func() {
 		cons.AddMainWorker(workers)
@@ -0,0 +1,339 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/tgo/tnet"
+)
+
+const (
+	redisModeStream     = "stream"
+	redisModeSubscribe  = "subscribe"
+	redisModePSubscribe = "psubscribe"
+	redisModeList       = "list"
+)
+
+// Redis consumer
+//
+// This consumer reads messages from a redis server. Messages can be read from
+// redis streams using consumer groups, from pub/sub channels or from lists.
+// Together with the "stream" or "list" storage of producer.Redis this allows
+// using redis as a persistent buffer between gollum instances.
+//
+// Metadata
+//
+// - key: Contains the name of the stream, channel or list the message was
+// read from
+//
+// - id: Contains the id of the stream entry (stream mode only)
+//
+// - pattern: Contains the pattern that matched the channel (psubscribe mode
+// only)
+//
+// In stream mode all fields of an entry except "PayloadField" are set as
+// metadata, too.
+//
+// Parameters
+//
+// - Address: Defines the address of the redis server to connect to.
+// This can either be any ip address and port like "localhost:6379" or a file
+// like "unix:///var/redis.socket".
+// By default this is set to ":6379".
+//
+// - Password: Defines the password used to authenticate.
+// By default this is set to "".
+//
+// - Database: Defines the redis database to connect to.
+// By default this is set to 0.
+//
+// - Mode: Defines how messages are read. Valid values are "stream" (XREADGROUP),
+// "subscribe" (SUBSCRIBE), "psubscribe" (PSUBSCRIBE) and "list" (BLPOP).
+// By default this is set to "stream".
+//
+// - Keys: Defines the streams, channels, channel patterns or lists to read from.
+// By default this is set to ["default"].
+//
+// - Group: Defines the consumer group used in stream mode. The group is created
+// if it does not exist. Entries are acknowledged after they have been passed
+// to gollum.
+// By default this is set to "gollum".
+//
+// - ConsumerName: Defines the name of this consumer inside the consumer group.
+// If this is empty, the plugin id is used.
+// By default this is set to "".
+//
+// - StartID: Defines the id to start reading from when the consumer group is
+// created. Use "0" to read all existing entries or "$" to read only new ones.
+// By default this is set to "$".
+//
+// - PayloadField: Defines the stream entry field used as message payload. If
+// an entry does not contain this field, all fields are sent as a JSON object.
+// By default this is set to "payload".
+//
+// - BatchSize: Defines the maximum number of stream entries read at once.
+// By default this is set to 100.
+//
+// - BlockTimeoutMs: Defines the maximum time to wait for new data before
+// checking for shutdown or reconnecting.
+// By default this is set to 1000.
+//
+// - ReconnectDelayMs: Defines the time to wait before retrying after an error.
+// By default this is set to 1000.
+//
+// Examples
+//
+// This example reads entries written by producer.Redis with "stream" storage.
+//
+//  RedisIn:
+//    Type: consumer.Redis
+//    Streams: telemetry
+//    Address: "pit-server:6379"
+//    Mode: stream
+//    Keys:
+//      - telemetry
+//    Group: pit
+//    StartID: "0"
+//
+type Redis struct {
+	core.SimpleConsumer `gollumdoc:"embed_type"`
+	address             string
+	protocol            string
+	password            string        `config:"Password"`
+	database            int           `config:"Database" default:"0"`
+	keys                []string      `config:"Keys" default:"default"`
+	group               string        `config:"Group" default:"gollum"`
+	consumerName        string        `config:"ConsumerName"`
+	startID             string        `config:"StartID" default:"$"`
+	payloadField        string        `config:"PayloadField" default:"payload"`
+	batchSize           int64         `config:"BatchSize" default:"100"`
+	blockTimeout        time.Duration `config:"BlockTimeoutMs" default:"1000" metric:"ms"`
+	reconnectDelay      time.Duration `config:"ReconnectDelayMs" default:"1000" metric:"ms"`
+	mode                string
+	client              *redis.Client
+}
+
+func init() {
+	core.TypeRegistry.Register(Redis{})
+}
+
+// Configure initializes this consumer with values from a plugin config.
+func (cons *Redis) Configure(conf core.PluginConfigReader) {
+	cons.protocol, cons.address = tnet.ParseAddress(conf.GetString("Address", ":6379"), "tcp")
+
+	if cons.consumerName == "" {
+		cons.consumerName = conf.GetID()
+	}
+	if len(cons.keys) == 0 {
+		conf.Errors.Pushf("At least one key has to be set")
+	}
+
+	cons.mode = strings.ToLower(conf.GetString("Mode", redisModeStream))
+	switch cons.mode {
+	case redisModeStream, redisModeSubscribe, redisModePSubscribe, redisModeList:
+	default:
+		conf.Errors.Pushf("Mode must be one of stream, subscribe, psubscribe or list")
+	}
+}
+
+// newStreamMessage converts a stream entry to a payload and metadata
+func (cons *Redis) newStreamMessage(stream string, entry redis.XMessage) ([]byte, core.Metadata, error) {
+	metadata := core.Metadata{}
+	metadata.SetValue("key", []byte(stream))
+	metadata.SetValue("id", []byte(entry.ID))
+
+	payload, hasPayload := entry.Values[cons.payloadField]
+	if !hasPayload {
+		data, err := json.Marshal(entry.Values)
+		return data, metadata, err
+	}
+
+	for key, value := range entry.Values {
+		if key != cons.payloadField {
+			metadata.SetValue(key, []byte(redisValueToString(value)))
+		}
+	}
+	return []byte(redisValueToString(payload)), metadata, nil
+}
+
+func redisValueToString(value interface{}) string {
+	if stringValue, isString := value.(string); isString {
+		return stringValue
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+func (cons *Redis) createGroups() error {
+	for _, stream := range cons.keys {
+		// MKSTREAM is not supported by the client, so create the group via a
+		// generic command to allow groups on streams that do not exist yet.
+		err := cons.client.Do("xgroup", "create", stream, cons.group, cons.startID, "mkstream").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cons *Redis) readStreams() error {
+	if err := cons.createGroups(); err != nil {
+		return err
+	}
+
+	// Read pending entries first, e.g. after a crash, then new ones
+	streams := make([]string, 0, len(cons.keys)*2)
+	streams = append(streams, cons.keys...)
+	for range cons.keys {
+		streams = append(streams, "0")
+	}
+
+	for cons.IsActive() {
+		result, err := cons.client.XReadGroup(&redis.XReadGroupArgs{
+			Group:    cons.group,
+			Consumer: cons.consumerName,
+			Streams:  streams,
+			Count:    cons.batchSize,
+			Block:    cons.blockTimeout,
+		}).Result()
+
+		switch {
+		case err == redis.Nil:
+			continue // ### continue, timeout ###
+		case err != nil:
+			return err // ### return, reconnect ###
+		}
+
+		for _, stream := range result {
+			ids := make([]string, 0, len(stream.Messages))
+			for _, entry := range stream.Messages {
+				payload, metadata, err := cons.newStreamMessage(stream.Stream, entry)
+				if err != nil {
+					cons.Logger.WithError(err).Errorf("Failed to read entry %s of %s", entry.ID, stream.Stream)
+				} else {
+					cons.EnqueueWithMetadata(payload, metadata)
+				}
+				ids = append(ids, entry.ID)
+			}
+
+			if len(ids) > 0 {
+				if err := cons.client.XAck(stream.Stream, cons.group, ids...).Err(); err != nil {
+					return err // ### return, reconnect ###
+				}
+				continue
+			}
+
+			// Switch to new entries once all pending ones have been read
+			for idx, key := range cons.keys {
+				if key == stream.Stream {
+					streams[len(cons.keys)+idx] = ">"
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (cons *Redis) readChannels() error {
+	var pubsub *redis.PubSub
+	if cons.mode == redisModePSubscribe {
+		pubsub = cons.client.PSubscribe(cons.keys...)
+	} else {
+		pubsub = cons.client.Subscribe(cons.keys...)
+	}
+	defer pubsub.Close()
+
+	for cons.IsActive() {
+		reply, err := pubsub.ReceiveTimeout(cons.blockTimeout)
+		if err != nil {
+			if netErr, isNetErr := err.(interface{ Timeout() bool }); isNetErr && netErr.Timeout() {
+				continue // ### continue, timeout ###
+			}
+			return err // ### return, reconnect ###
+		}
+
+		msg, isMessage := reply.(*redis.Message)
+		if !isMessage {
+			continue // ### continue, subscription or pong ###
+		}
+
+		metadata := core.Metadata{}
+		metadata.SetValue("key", []byte(msg.Channel))
+		if msg.Pattern != "" {
+			metadata.SetValue("pattern", []byte(msg.Pattern))
+		}
+		cons.EnqueueWithMetadata([]byte(msg.Payload), metadata)
+	}
+	return nil
+}
+
+func (cons *Redis) readLists() error {
+	for cons.IsActive() {
+		result, err := cons.client.BLPop(cons.blockTimeout, cons.keys...).Result()
+		switch {
+		case err == redis.Nil:
+			continue // ### continue, timeout ###
+		case err != nil:
+			return err // ### return, reconnect ###
+		}
+
+		metadata := core.Metadata{}
+		metadata.SetValue("key", []byte(result[0]))
+		cons.EnqueueWithMetadata([]byte(result[1]), metadata)
+	}
+	return nil
+}
+
+func (cons *Redis) read() {
+	defer cons.WorkerDone()
+	defer cons.client.Close()
+
+	for cons.IsActive() {
+		var err error
+		switch cons.mode {
+		case redisModeStream:
+			err = cons.readStreams()
+		case redisModeList:
+			err = cons.readLists()
+		default:
+			err = cons.readChannels()
+		}
+
+		if err != nil && cons.IsActive() {
+			cons.Logger.WithError(err).Error("Redis: read failed")
+			time.Sleep(cons.reconnectDelay)
+		}
+	}
+}
+
+// Consume connects to redis and starts reading messages
+func (cons *Redis) Consume(workers *sync.WaitGroup) {
+	cons.client = redis.NewClient(&redis.Options{
+		Addr:     cons.address,
+		Network:  cons.protocol,
+		Password: cons.password,
+		DB:       cons.database,
+	})
+
+	cons.AddMainWorker(workers)
+	go cons.read()
+	cons.ControlLoop()
+}
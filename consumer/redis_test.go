@@ -0,0 +1,59 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"testing"
+
+	"github.com/go-redis/redis"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestRedisStreamMessage(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	cons := newTestPlugin(expect, "consumer.Redis", "redisStreamMessage", map[string]interface{}{
+		"Keys": []string{"telemetry"},
+	}).(*Redis)
+
+	expect.Equal("redisStreamMessage", cons.consumerName)
+	expect.Equal([]string{"telemetry"}, cons.keys)
+
+	payload, metadata, err := cons.newStreamMessage("telemetry", redis.XMessage{
+		ID:     "1-0",
+		Values: map[string]interface{}{"payload": "3000", "sensor": "rpm"},
+	})
+	expect.NoError(err)
+	expect.Equal("3000", string(payload))
+	expect.Equal("telemetry", metadata.GetValueString("key"))
+	expect.Equal("1-0", metadata.GetValueString("id"))
+	expect.Equal("rpm", metadata.GetValueString("sensor"))
+
+	payload, metadata, err = cons.newStreamMessage("telemetry", redis.XMessage{
+		ID:     "2-0",
+		Values: map[string]interface{}{"rpm": "3000"},
+	})
+	expect.NoError(err)
+	expect.Equal(`{"rpm":"3000"}`, string(payload))
+	expect.Equal("2-0", metadata.GetValueString("id"))
+}
+
+func TestRedisInvalidMode(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	_, err := tryNewTestPlugin("consumer.Redis", "redisInvalidMode", map[string]interface{}{
+		"Mode": "queue",
+	})
+	expect.NotNil(err)
+}
@@ -0,0 +1,381 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"encoding/base64"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/tgo"
+	"github.com/trivago/tgo/tio"
+)
+
+const (
+	replayEncodingBase64 = "base64"
+	replayEncodingNone   = "none"
+)
+
+// Replay consumer plugin
+//
+// The Replay consumer reads messages serialized by format.Serialize, e.g. files
+// written by producer.Spooling or by producer.File, and sends them again using
+// the original timing between messages. Stream IDs, metadata, priority and
+// creation time of each message are restored.
+//
+// The replay can be paused and resumed via the plugin control channel. On unix
+// systems sending SIGUSR2 to gollum toggles between pause and resume for all
+// consumers.
+//
+// Parameters
+//
+// - Files: Defines the file(s) to replay. This field supports glob patterns and
+// directories. Files are replayed ordered by modification time.
+// By default this parameter is set to "".
+//
+// - Encoding: Defines how serialized messages are encoded. Set to "base64"
+// for files written by producer.Spooling or by producer.File using
+// format.Serialize followed by format.Base64Encode. Set to "none" for raw
+// serialized messages. In this case the Delimiter must not appear within the
+// serialized data.
+// By default this parameter is set to "base64".
+//
+// - Delimiter: Defines the delimiter sequence expected after each message.
+// By default this parameter is set to "\n".
+//
+// - Speed: Defines the replay speed relative to the original timing. A value
+// of 2 replays twice as fast, a value of 0 replays as fast as possible.
+// By default this parameter is set to 1.
+//
+// - StartTime: Defines where to start the replay. This can be an RFC3339
+// timestamp or a duration like "90s" relative to the first message. Messages
+// created before this time are skipped. If empty, all messages are replayed.
+// By default this parameter is set to "".
+//
+// - Loop: When set to true, the replay restarts after the last message.
+// By default this parameter is set to false.
+//
+// - Paused: When set to true, the replay starts paused and has to be resumed
+// via the control channel.
+// By default this parameter is set to false.
+//
+// - KeepStreams: When set to true, messages are sent to the stream they were
+// recorded on. Otherwise messages are sent to the streams configured for this
+// consumer.
+// By default this parameter is set to true.
+//
+// - ExitOnEOF: When set to true, gollum is shut down after the replay has
+// finished. This setting has no effect if Loop is enabled.
+// By default this parameter is set to true.
+//
+// Examples
+//
+// This example replays a recorded session at real speed, starting 10 minutes
+// into the session and restarting once finished.
+//
+//  SessionReplay:
+//    Type: consumer.Replay
+//    Files: /data/sessions/2018-07-14
+//    StartTime: 10m
+//    Speed: 1
+//    Loop: true
+//
+type Replay struct {
+	core.SimpleConsumer `gollumdoc:"embed_type"`
+	fileName            string `config:"Files"`
+	encoding            string `config:"Encoding" default:"base64"`
+	delimiter           string `config:"Delimiter" default:"\n"`
+	loop                bool   `config:"Loop" default:"false"`
+	keepStreams         bool   `config:"KeepStreams" default:"true"`
+	exitOnEOF           bool   `config:"ExitOnEOF" default:"true"`
+	speed               float64
+	startTime           time.Time
+	startOffset         time.Duration
+
+	pauseGuard   *sync.Mutex
+	paused       bool
+	resumed      chan struct{}
+	pauseChanged chan struct{}
+	done         chan struct{}
+}
+
+func init() {
+	core.TypeRegistry.Register(Replay{})
+}
+
+// Configure initializes this consumer with values from a plugin config.
+func (cons *Replay) Configure(conf core.PluginConfigReader) {
+	cons.done = make(chan struct{})
+	cons.pauseGuard = new(sync.Mutex)
+	cons.pauseChanged = make(chan struct{}, 1)
+
+	cons.SetStopCallback(func() {
+		close(cons.done)
+	})
+	cons.SetPauseCallback(cons.pause)
+	cons.SetResumeCallback(cons.resume)
+
+	if cons.fileName == "" {
+		conf.Errors.Pushf("Files must be set")
+	}
+
+	switch cons.encoding {
+	case replayEncodingBase64, replayEncodingNone:
+	default:
+		conf.Errors.Pushf("Unknown encoding '%s'", cons.encoding)
+	}
+
+	switch speed := conf.GetValue("Speed", 1.0).(type) {
+	case float64:
+		cons.speed = speed
+	case int:
+		cons.speed = float64(speed)
+	case string:
+		var err error
+		cons.speed, err = strconv.ParseFloat(speed, 64)
+		conf.Errors.Push(err)
+	default:
+		conf.Errors.Pushf("Speed must be a number")
+	}
+
+	if cons.speed < 0 {
+		conf.Errors.Pushf("Speed must not be negative")
+	}
+
+	if startTime := conf.GetString("StartTime", ""); startTime != "" {
+		if offset, err := time.ParseDuration(startTime); err == nil {
+			cons.startOffset = offset
+		} else if cons.startTime, err = time.Parse(time.RFC3339, startTime); err != nil {
+			conf.Errors.Pushf("StartTime '%s' is neither a duration nor an RFC3339 timestamp", startTime)
+		}
+	}
+
+	if conf.GetBool("Paused", false) {
+		cons.pause()
+	}
+}
+
+func (cons *Replay) pause() {
+	cons.pauseGuard.Lock()
+	defer cons.pauseGuard.Unlock()
+
+	if !cons.paused {
+		cons.Logger.Info("Replay paused")
+		cons.paused = true
+		cons.resumed = make(chan struct{})
+		select {
+		case cons.pauseChanged <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (cons *Replay) resume() {
+	cons.pauseGuard.Lock()
+	defer cons.pauseGuard.Unlock()
+
+	if cons.paused {
+		cons.Logger.Info("Replay resumed")
+		cons.paused = false
+		close(cons.resumed)
+	}
+}
+
+// waitWhilePaused blocks while the replay is paused and returns the time
+// spent waiting. False is returned if the consumer is stopped.
+func (cons *Replay) waitWhilePaused() (time.Duration, bool) {
+	cons.pauseGuard.Lock()
+	paused, resumed := cons.paused, cons.resumed
+	cons.pauseGuard.Unlock()
+
+	if !paused {
+		return 0, true
+	}
+
+	start := time.Now()
+	select {
+	case <-resumed:
+		return time.Since(start), true
+	case <-cons.done:
+		return time.Since(start), false
+	}
+}
+
+// replayClock maps message creation times to the time they are replayed at.
+type replayClock struct {
+	speed       float64
+	firstMsg    time.Time
+	firstReplay time.Time
+}
+
+// delay returns the time to wait before a message created at the given time
+// is sent.
+func (clock *replayClock) delay(created time.Time) time.Duration {
+	if clock.speed == 0 {
+		return 0
+	}
+	if clock.firstMsg.IsZero() {
+		clock.firstMsg = created
+		clock.firstReplay = time.Now()
+		return 0
+	}
+
+	offset := time.Duration(float64(created.Sub(clock.firstMsg)) / clock.speed)
+	return time.Until(clock.firstReplay.Add(offset))
+}
+
+// wait blocks until the given message is due. False is returned if the
+// consumer is stopped.
+func (cons *Replay) wait(clock *replayClock, msg *core.Message) bool {
+	for {
+		pausedFor, active := cons.waitWhilePaused()
+		if !active {
+			return false
+		}
+		clock.firstReplay = clock.firstReplay.Add(pausedFor)
+
+		delay := clock.delay(msg.GetCreationTime())
+		if delay <= 0 {
+			return true
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+			return true
+		case <-cons.pauseChanged:
+			timer.Stop() // re-evaluate pause state
+		case <-cons.done:
+			timer.Stop()
+			return false
+		}
+	}
+}
+
+func (cons *Replay) decode(data []byte) (*core.Message, error) {
+	if cons.encoding == replayEncodingBase64 {
+		decoded := make([]byte, base64.StdEncoding.DecodedLen(len(data)))
+		size, err := base64.StdEncoding.Decode(decoded, data)
+		if err != nil {
+			return nil, err
+		}
+		data = decoded[:size]
+	}
+	return core.DeserializeMessage(data)
+}
+
+// replayFile sends all messages of the given file. False is returned if the
+// consumer is stopped.
+func (cons *Replay) replayFile(name string, clock *replayClock) bool {
+	file, err := os.Open(name)
+	if err != nil {
+		cons.Logger.WithError(err).Error("Failed to open ", name)
+		return true // ### return, continue with next file ###
+	}
+	defer file.Close()
+
+	cons.Logger.Info("Replaying ", name)
+	reader := &terminatedReader{reader: file, delimiter: []byte(cons.delimiter)}
+	buffer := tio.NewBufferedReader(fileBufferGrowSize, tio.BufferedReaderFlagDelimiter, 0, cons.delimiter)
+
+	for {
+		data, _, err := buffer.ReadOne(reader)
+		if data != nil && len(data) > 0 {
+			if !cons.replayMessage(data, clock) {
+				return false // ### return, stopped ###
+			}
+		}
+
+		switch err {
+		case nil:
+		case io.EOF:
+			return true // ### return, done ###
+		default:
+			cons.Logger.WithError(err).Error("Failed to read ", name)
+			return true // ### return, continue with next file ###
+		}
+	}
+}
+
+func (cons *Replay) replayMessage(data []byte, clock *replayClock) bool {
+	msg, err := cons.decode(data)
+	if err != nil {
+		cons.Logger.WithError(err).Warning("Failed to decode message")
+		return true // ### return, skip message ###
+	}
+
+	created := msg.GetCreationTime()
+	if clock.firstMsg.IsZero() && cons.startTime.IsZero() && cons.startOffset > 0 {
+		// Relative start times refer to the first message in the replay
+		cons.startTime = created.Add(cons.startOffset)
+	}
+	if created.Before(cons.startTime) {
+		return true // ### return, skip message ###
+	}
+
+	if !cons.wait(clock, msg) {
+		return false // ### return, stopped ###
+	}
+
+	if !cons.keepStreams {
+		msg.SetStreamID(core.InvalidStreamID)
+	}
+	cons.EnqueueMessage(msg)
+	return true
+}
+
+func (cons *Replay) replay() {
+	defer cons.WorkerDone()
+
+	for {
+		fileNames, err := globFilesByModTime(cons.fileName)
+		if err != nil {
+			cons.Logger.WithError(err).Errorf("Failed to evaluate glob '%s'", cons.fileName)
+			return
+		}
+		if len(fileNames) == 0 {
+			cons.Logger.Warningf("No files found for '%s'", cons.fileName)
+		}
+
+		clock := &replayClock{speed: cons.speed}
+		for _, name := range fileNames {
+			if !cons.replayFile(name, clock) {
+				return // ### return, stopped ###
+			}
+		}
+
+		if !cons.loop || len(fileNames) == 0 {
+			break
+		}
+		cons.Logger.Info("Restarting replay")
+	}
+
+	cons.Logger.Info("Replay finished")
+	if cons.exitOnEOF && !cons.loop {
+		cons.Logger.Info("Exit triggered by finished replay.")
+		tgo.ShutdownCallback()
+	}
+}
+
+// Consume starts replaying the configured files
+func (cons *Replay) Consume(workers *sync.WaitGroup) {
+	cons.AddMainWorker(workers)
+	go tgo.WithRecoverShutdown(cons.replay)
+	cons.ControlLoop()
+}
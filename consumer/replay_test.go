@@ -0,0 +1,135 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func writeReplayTestFile(expect ttesting.Expect, streamID core.MessageStreamID, start time.Time) string {
+	dir, err := ioutil.TempDir("", "gollum-replay")
+	expect.NoError(err)
+
+	content := []byte{}
+	for i, payload := range []string{"first", "second", "third"} {
+		msg := core.NewMessage(nil, []byte(payload), core.Metadata{"lap": []byte(payload)}, streamID)
+		serialized := msg.ToSerializedMessage()
+		serialized.Timestamp = proto.Int64(start.Add(time.Duration(i) * 100 * time.Millisecond).UnixNano())
+
+		data, err := proto.Marshal(serialized)
+		expect.NoError(err)
+		content = append(content, base64.StdEncoding.EncodeToString(data)...)
+		content = append(content, '\n')
+	}
+
+	fileName := filepath.Join(dir, "session.log")
+	expect.NoError(ioutil.WriteFile(fileName, content, 0644))
+	return fileName
+}
+
+func TestReplayTiming(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	router := &httpTestRouter{streamID: core.GetStreamID("replayTiming")}
+	core.StreamRegistry.Register(router, router.streamID)
+
+	start := time.Date(2018, 7, 14, 10, 0, 0, 0, time.UTC)
+	fileName := writeReplayTestFile(expect, router.streamID, start)
+	defer os.RemoveAll(filepath.Dir(fileName))
+
+	cons := newTestPlugin(expect, "consumer.Replay", "replayTiming", map[string]interface{}{
+		"Files": fileName,
+		"Speed": 2,
+	}).(*Replay)
+
+	began := time.Now()
+	expect.True(cons.replayFile(fileName, &replayClock{speed: cons.speed}))
+	elapsed := time.Since(began)
+
+	expect.Geq(int64(elapsed), int64(90*time.Millisecond))
+	expect.Less(int64(elapsed), int64(time.Second))
+
+	expect.Equal(3, len(router.messages))
+	expect.Equal("third", router.messages[2].String())
+	expect.Equal("third", router.messages[2].GetMetadata().GetValueString("lap"))
+	expect.Equal(start.Add(200*time.Millisecond).UnixNano(), router.messages[2].GetCreationTime().UnixNano())
+}
+
+func TestReplayStartTime(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	router := &httpTestRouter{streamID: core.GetStreamID("replayStartTime")}
+	core.StreamRegistry.Register(router, router.streamID)
+
+	fileName := writeReplayTestFile(expect, router.streamID, time.Now())
+	defer os.RemoveAll(filepath.Dir(fileName))
+
+	cons := newTestPlugin(expect, "consumer.Replay", "replayStartTime", map[string]interface{}{
+		"Files":     fileName,
+		"StartTime": "150ms",
+	}).(*Replay)
+
+	expect.True(cons.replayFile(fileName, &replayClock{speed: cons.speed}))
+	expect.Equal(1, len(router.messages))
+	expect.Equal("third", router.messages[0].String())
+}
+
+func TestReplayPause(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	router := &httpTestRouter{streamID: core.GetStreamID("replayPause")}
+	core.StreamRegistry.Register(router, router.streamID)
+
+	fileName := writeReplayTestFile(expect, router.streamID, time.Now())
+	defer os.RemoveAll(filepath.Dir(fileName))
+
+	cons := newTestPlugin(expect, "consumer.Replay", "replayPause", map[string]interface{}{
+		"Files":  fileName,
+		"Speed":  0,
+		"Paused": true,
+	}).(*Replay)
+
+	done := make(chan bool)
+	go func() {
+		done <- cons.replayFile(fileName, &replayClock{speed: cons.speed})
+	}()
+
+	select {
+	case <-done:
+		t.Error("Replay finished while paused")
+		return
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cons.resume()
+	expect.True(<-done)
+	expect.Equal(3, len(router.messages))
+
+	cons.pause()
+	go func() {
+		done <- cons.replayFile(fileName, &replayClock{speed: cons.speed})
+	}()
+	close(cons.done)
+	expect.False(<-done)
+}
@@ -15,6 +15,7 @@
 package consumer
 
 import (
+	"crypto/tls"
 	"fmt"
 	"io"
 	"net"
@@ -24,6 +25,7 @@ import (
 	"time"
 
 	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/components"
 	"github.com/trivago/tgo"
 	"github.com/trivago/tgo/tio"
 	"github.com/trivago/tgo/tnet"
@@ -37,7 +39,8 @@ const (
 //
 // The socket consumer reads messages as-is from a given network or filesystem
 // socket. Messages are separated from the stream by using a specific partitioner
-// method.
+// method. TCP and unix sockets can be secured by TLS. If TlsClientCaLocation is
+// set, clients have to authenticate with a certificate.
 //
 // Parameters
 //
@@ -107,8 +110,22 @@ const (
 //    Partitioner: fixed
 //    Size: 256
 //
+// This example accepts newline separated messages via TLS from clients
+// presenting a certificate signed by the given CA:
+//
+//  socketTlsIn:
+//    Type: consumer.Socket
+//    Address: "tcp://0.0.0.0:5880"
+//    Acknowledge: "OK"
+//    TlsEnable: true
+//    TlsCertificateLocation: /etc/gollum/pit.crt
+//    TlsKeyLocation: /etc/gollum/pit.key
+//    TlsClientCaLocation: /etc/gollum/cars-ca.pem
+//    TlsMinVersion: "1.2"
+//
 type Socket struct {
 	core.SimpleConsumer `gollumdoc:"embed_type"`
+	TLS                 components.TLSServerConfig `gollumdoc:"embed_type"`
 	listener            io.Closer
 	protocol            string
 	address             string
@@ -129,14 +146,19 @@ func init() {
 
 // Configure initializes this consumer with values from a plugin config.
 func (cons *Socket) Configure(conf core.PluginConfigReader) {
-	if len(cons.acknowledge) > 0 && cons.protocol == "udp" {
-		conf.Errors.Pushf("UDP sockets do not support acknowledgment.")
-	}
-
 	address := conf.GetString("Address", "tcp://0.0.0.0:5880")
 	cons.protocol, cons.address = tnet.ParseAddress(address, "tcp")
 	cons.flags = 0
 
+	if cons.protocol == "udp" {
+		if len(cons.acknowledge) > 0 {
+			conf.Errors.Pushf("UDP sockets do not support acknowledgment.")
+		}
+		if cons.TLS.Enabled {
+			conf.Errors.Pushf("UDP sockets do not support TLS.")
+		}
+	}
+
 	partitioner := conf.GetString("Partitioner", "delimiter")
 	switch strings.ToLower(partitioner) {
 	case "binary_be":
@@ -226,6 +248,7 @@ func (cons *Socket) listen() {
 			}
 
 			if err == nil {
+				socket = cons.TLS.Listener(socket)
 				cons.listener = socket
 				forceClose = new(bool) // new trigger for all clients from this listener
 				cons.Logger.Debugf("Listening to %s", cons.address)
@@ -264,6 +287,15 @@ func (cons *Socket) readFromClientConnection(conn net.Conn, forceClose *bool) {
 		cons.Logger.Debugf("Closed client connection to %s on %s", conn.RemoteAddr(), cons.address)
 		cons.WorkerDone()
 	}()
+
+	if tlsConn, isTLS := conn.(*tls.Conn); isTLS {
+		tlsConn.SetDeadline(time.Now().Add(cons.readTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			cons.Logger.WithError(err).Warningf("TLS handshake with %s failed", conn.RemoteAddr())
+			return // ### return, handshake failed ###
+		}
+	}
+
 	cons.readFromConnection(conn, forceClose)
 }
 
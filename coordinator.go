@@ -39,9 +39,10 @@ const (
 )
 
 const (
-	signalNone = signalType(iota)
-	signalExit = signalType(iota)
-	signalRoll = signalType(iota)
+	signalNone  = signalType(iota)
+	signalExit  = signalType(iota)
+	signalRoll  = signalType(iota)
+	signalPause = signalType(iota)
 )
 
 type coordinatorState byte
@@ -58,6 +59,7 @@ type Coordinator struct {
 	logConsumer    *core.LogConsumer
 	state          coordinatorState
 	signal         chan os.Signal
+	paused         bool
 }
 
 // NewCoordinator creates a new multplexer
@@ -175,6 +177,17 @@ func (co *Coordinator) Run() {
 				producer.Control() <- core.PluginControlRoll
 			}
 
+		case signalPause:
+			// The pause signal toggles between pausing and resuming consumers
+			command := core.PluginControlPause
+			if co.paused {
+				command = core.PluginControlResume
+			}
+			co.paused = !co.paused
+			for _, consumer := range co.consumers {
+				consumer.Control() <- command
+			}
+
 		default:
 		}
 	}
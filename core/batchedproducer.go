@@ -64,6 +64,7 @@ func (prod *BatchedProducer) Configure(conf PluginConfigReader) {
 // by the producer main loop. A timeout value != nil will overwrite the channel
 // timeout value for this call.
 func (prod *BatchedProducer) Enqueue(msg *Message, timeout time.Duration) {
+	msg = prod.detach(msg)
 	defer prod.enqueuePanicHandling(msg)
 
 	// Don't accept messages if we are shutting down
@@ -76,8 +77,9 @@ func (prod *BatchedProducer) Enqueue(msg *Message, timeout time.Duration) {
 		return
 	}
 
-	prod.appendMessage(msg)
+	// The message may be flushed and released as soon as it is appended
 	MessageTrace(msg, prod.GetID(), "Enqueued by batched producer")
+	prod.appendMessage(msg)
 }
 
 // appendMessage append a message to the batch at enqueuing
@@ -17,6 +17,7 @@ package core
 import (
 	"time"
 
+	"github.com/rcrowley/go-metrics"
 	"github.com/trivago/tgo"
 )
 
@@ -27,9 +28,17 @@ import (
 //
 // Parameters
 //
-// - Channel: This value defines the capacity of the message buffer.
+// - Channel: This value defines the capacity of the message buffer. The
+// buffer holds one queue per message priority. Messages of a higher priority
+// are always processed first. All queues share this capacity.
 // By default this parameter is set to "8192".
 //
+// - PriorityShedding: When set to true, messages of a higher priority replace
+// queued messages of the lowest priority if the buffer is full. Replaced
+// messages are discarded. When set to false, the ChannelTimeoutMs setting
+// applies to all messages.
+// By default this parameter is set to "true".
+//
 // - ChannelTimeoutMs: This value defines a timeout for each message
 // before the message will discarded. To disable the timeout, set this
 // parameter to 0.
@@ -38,7 +47,7 @@ import (
 //
 type BufferedProducer struct {
 	DirectProducer `gollumdoc:"embed_type"`
-	messages       MessageQueue
+	messages       *PriorityMessageQueue
 	channelTimeout time.Duration `config:"ChannelTimeoutMs" default:"0" metric:"ms"`
 }
 
@@ -46,7 +55,17 @@ type BufferedProducer struct {
 func (prod *BufferedProducer) Configure(conf PluginConfigReader) {
 	prod.onPrepareStop = prod.DefaultDrain
 	prod.onStop = prod.DefaultClose
-	prod.messages = NewMessageQueue(int(conf.GetInt("Channel", 8192)))
+	prod.messages = NewPriorityMessageQueue(
+		int(conf.GetInt("Channel", 8192)),
+		conf.GetBool("PriorityShedding", true))
+
+	metricsRegistry := NewMetricsRegistry(conf.GetID())
+	for _, priority := range []MessagePriority{MessagePriorityLow, MessagePriorityNormal, MessagePriorityHigh, MessagePriorityCritical} {
+		priority := priority
+		metricsRegistry.GetOrRegister("queued."+priority.String(), metrics.NewFunctionalGauge(func() int64 {
+			return int64(prod.messages.GetNumQueuedWithPriority(priority))
+		}))
+	}
 }
 
 // GetQueueTimeout returns the duration this producer will block before a
@@ -60,6 +79,7 @@ func (prod *BufferedProducer) GetQueueTimeout() time.Duration {
 // by the producer main loop. A timeout value != nil will overwrite the channel
 // timeout value for this call.
 func (prod *BufferedProducer) Enqueue(msg *Message, timeout time.Duration) {
+	msg = prod.detach(msg)
 	defer prod.enqueuePanicHandling(msg)
 
 	// Don't accept messages if we are shutting down
@@ -78,7 +98,16 @@ func (prod *BufferedProducer) Enqueue(msg *Message, timeout time.Duration) {
 		usedTimeout = timeout
 	}
 
-	switch prod.messages.Push(msg, usedTimeout) {
+	// The message may be processed and released as soon as it is queued
+	priority := msg.GetPriority()
+	MessageTrace(msg, prod.GetID(), "Enqueued by buffered producer")
+
+	state, shed := prod.messages.Push(msg, usedTimeout)
+	if shed != nil {
+		DiscardMessage(shed, prod.GetID(), "Shed by higher priority message")
+	}
+
+	switch state {
 	case MessageQueueTimeout:
 		prod.TryFallback(msg)
 		prod.setState(PluginStateWaiting)
@@ -86,12 +115,13 @@ func (prod *BufferedProducer) Enqueue(msg *Message, timeout time.Duration) {
 	case MessageQueueDiscard:
 		MetricMessagesDiscarded.Inc(1)
 		prod.setState(PluginStateWaiting)
+		msg.Release()
+		return // ### return, message dropped ###
 
 	default:
+		priority.GetMetric().Enqueued.Inc(1)
 		prod.setState(PluginStateActive)
 	}
-
-	MessageTrace(msg, prod.GetID(), "Enqueued by buffered producer")
 }
 
 // DefaultDrain is the function registered to onPrepareStop by default.
@@ -179,6 +209,10 @@ func (prod *BufferedProducer) messageLoop(onMessage func(*Message)) {
 	for prod.IsActive() {
 		msg, more := prod.messages.Pop()
 		if more {
+			// The queue has room again after a message has been taken out.
+			// Only leave the waiting state so that a concurrent shutdown is
+			// not reverted.
+			prod.runState.CompareAndSetState(PluginStateWaiting, PluginStateActive)
 			onMessage(msg)
 		}
 	}
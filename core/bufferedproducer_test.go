@@ -50,7 +50,7 @@ func getMockBufferedProducer() mockBufferedProducer {
 					Logger:          logrus.WithField("Scope", "test"),
 				},
 			},
-			messages:       NewMessageQueue(2),
+			messages:       NewPriorityMessageQueue(2, true),
 			channelTimeout: 500 * time.Millisecond,
 		},
 	}
@@ -184,7 +184,7 @@ func TestProducerCloseMessageChannel(t *testing.T) {
 	mockP.Enqueue(msgToSend, time.Duration(0))
 	mockP.CloseMessageChannel(handleMessageFail)
 
-	mockP.messages = NewMessageQueue(2)
+	mockP.messages = NewPriorityMessageQueue(2, true)
 	mockP.Enqueue(msgToSend, time.Duration(0))
 	mockP.CloseMessageChannel(handleMessage)
 }
@@ -226,7 +226,7 @@ func TestProducerMessageLoop(t *testing.T) {
 	expect := ttesting.NewExpect(t)
 	mockP := getMockBufferedProducer()
 	mockP.setState(PluginStateActive)
-	mockP.messages = NewMessageQueue(10)
+	mockP.messages = NewPriorityMessageQueue(10, true)
 	msgData := "test Message loop"
 	msg := new(Message)
 	msg.data.payload = []byte(msgData)
@@ -285,3 +285,56 @@ func TestProducerControlLoop(t *testing.T) {
 	expect.Equal(atomic.LoadInt32(roll), int32(1))
 
 }
+
+type mockPayloadModulator struct{}
+
+func (mod mockPayloadModulator) Modulate(msg *Message) ModulateResult {
+	msg.StorePayload([]byte("modulated"))
+	return ModulateResultContinue
+}
+
+func TestProducerDetachesSharedMessage(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockP := getMockBufferedProducer()
+	mockP.setState(PluginStateActive)
+
+	msg := NewPooledMessage(nil, []byte("shared"), nil, 1)
+	msg.Acquire()
+
+	// Producers without modulators use the shared message
+	mockP.Enqueue(msg, time.Second)
+	queued, _ := mockP.messages.Pop()
+	expect.Equal(msg, queued)
+	queued.Release()
+
+	// Producers with modulators modify a copy
+	msg.Acquire()
+	mockP.modulators = ModulatorArray{mockPayloadModulator{}}
+	mockP.Enqueue(msg, time.Second)
+	queued, _ = mockP.messages.Pop()
+	expect.False(msg == queued)
+	expect.Equal("modulated", queued.String())
+	expect.Equal("shared", msg.String())
+	queued.Release()
+
+	msg.Release()
+	expect.False(msg.IsPooled())
+}
+
+func TestProducerLeavesWaitingState(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockP := getMockBufferedProducer()
+
+	msg := NewMessage(nil, []byte("ProdWaitingTest"), nil, 1)
+	state, _ := mockP.messages.Push(msg, time.Second)
+	expect.Equal(MessageQueueOk, state)
+
+	mockP.setState(PluginStateWaiting)
+	expect.NonBlocking(2*time.Second, func() {
+		mockP.messageLoop(func(msg *Message) {
+			expect.Equal(PluginStateActive, mockP.GetState())
+			mockP.setState(PluginStateStopping)
+		})
+	})
+	expect.Equal(PluginStateStopping, mockP.GetState())
+}
@@ -0,0 +1,204 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package components
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+const (
+	// DatagramHeaderSize is the size of the header prepended to each datagram
+	// by NewDatagrams.
+	DatagramHeaderSize = 20
+
+	datagramMagic   = 0x474d // "GM"
+	datagramVersion = 1
+)
+
+// DatagramHeader is prepended to each datagram sent by the multicast plugins.
+// It allows receivers to detect missing messages by their sequence number and
+// to reassemble messages that were split into several datagrams.
+//
+// The header is encoded in big endian as magic (2 bytes, "GM"), version
+// (1 byte), flags (1 byte, reserved), sender (4 bytes), sequence (8 bytes),
+// chunk index (2 bytes) and chunk count (2 bytes).
+type DatagramHeader struct {
+	Sender     uint32
+	Sequence   uint64
+	ChunkIndex uint16
+	ChunkCount uint16
+}
+
+// NewDatagrams splits a payload into datagrams of at most maxSize bytes,
+// including the header. An error is returned if the payload requires more
+// chunks than can be encoded.
+func NewDatagrams(sender uint32, sequence uint64, payload []byte, maxSize int) ([][]byte, error) {
+	chunkSize := maxSize - DatagramHeaderSize
+	if chunkSize <= 0 {
+		return nil, fmt.Errorf("Datagram size must be larger than %d bytes", DatagramHeaderSize)
+	}
+
+	numChunks := (len(payload) + chunkSize - 1) / chunkSize
+	if numChunks == 0 {
+		numChunks = 1
+	}
+	if numChunks > 0xffff {
+		return nil, fmt.Errorf("Payload of %d bytes requires too many datagrams", len(payload))
+	}
+
+	datagrams := make([][]byte, 0, numChunks)
+	for i := 0; i < numChunks; i++ {
+		end := (i + 1) * chunkSize
+		if end > len(payload) {
+			end = len(payload)
+		}
+		chunk := payload[i*chunkSize : end]
+
+		datagram := make([]byte, DatagramHeaderSize+len(chunk))
+		binary.BigEndian.PutUint16(datagram[0:], datagramMagic)
+		datagram[2] = datagramVersion
+		binary.BigEndian.PutUint32(datagram[4:], sender)
+		binary.BigEndian.PutUint64(datagram[8:], sequence)
+		binary.BigEndian.PutUint16(datagram[16:], uint16(i))
+		binary.BigEndian.PutUint16(datagram[18:], uint16(numChunks))
+		copy(datagram[DatagramHeaderSize:], chunk)
+
+		datagrams = append(datagrams, datagram)
+	}
+	return datagrams, nil
+}
+
+// ParseDatagram returns the header and the payload chunk of a datagram
+// created by NewDatagrams.
+func ParseDatagram(datagram []byte) (DatagramHeader, []byte, error) {
+	header := DatagramHeader{}
+	if len(datagram) < DatagramHeaderSize || binary.BigEndian.Uint16(datagram) != datagramMagic {
+		return header, nil, fmt.Errorf("Datagram does not contain a valid header")
+	}
+	if datagram[2] != datagramVersion {
+		return header, nil, fmt.Errorf("Unsupported datagram version %d", datagram[2])
+	}
+
+	header.Sender = binary.BigEndian.Uint32(datagram[4:])
+	header.Sequence = binary.BigEndian.Uint64(datagram[8:])
+	header.ChunkIndex = binary.BigEndian.Uint16(datagram[16:])
+	header.ChunkCount = binary.BigEndian.Uint16(datagram[18:])
+
+	if header.ChunkCount == 0 || header.ChunkIndex >= header.ChunkCount {
+		return header, nil, fmt.Errorf("Invalid chunk %d of %d", header.ChunkIndex, header.ChunkCount)
+	}
+	return header, datagram[DatagramHeaderSize:], nil
+}
+
+// DatagramAssembler reassembles messages from datagrams created by
+// NewDatagrams and tracks sequence numbers per sender to detect gaps.
+// DatagramAssembler is not threadsafe.
+type DatagramAssembler struct {
+	timeout time.Duration
+	pending map[datagramKey]*datagramParts
+	last    map[uint32]uint64
+}
+
+type datagramKey struct {
+	sender   uint32
+	sequence uint64
+}
+
+type datagramParts struct {
+	chunks   [][]byte
+	received int
+	created  time.Time
+}
+
+// NewDatagramAssembler creates a new assembler that discards incomplete
+// messages after the given timeout.
+func NewDatagramAssembler(timeout time.Duration) *DatagramAssembler {
+	return &DatagramAssembler{
+		timeout: timeout,
+		pending: make(map[datagramKey]*datagramParts),
+		last:    make(map[uint32]uint64),
+	}
+}
+
+// Add adds a datagram and returns the complete payload if all chunks of the
+// message have been received. In this case the number of messages missing
+// between the previous and this message of the same sender is returned as
+// well. Messages arriving out of order report no gap.
+func (assembler *DatagramAssembler) Add(header DatagramHeader, chunk []byte) (payload []byte, gap uint64, complete bool) {
+	if header.ChunkCount == 1 {
+		return chunk, assembler.track(header), true
+	}
+
+	key := datagramKey{sender: header.Sender, sequence: header.Sequence}
+	parts, exists := assembler.pending[key]
+	if !exists {
+		parts = &datagramParts{
+			chunks:  make([][]byte, header.ChunkCount),
+			created: time.Now(),
+		}
+		assembler.pending[key] = parts
+	}
+
+	if int(header.ChunkIndex) >= len(parts.chunks) || parts.chunks[header.ChunkIndex] != nil {
+		return nil, 0, false // ### return, invalid or duplicate chunk ###
+	}
+
+	parts.chunks[header.ChunkIndex] = append([]byte(nil), chunk...)
+	parts.received++
+	if parts.received < len(parts.chunks) {
+		return nil, 0, false // ### return, incomplete ###
+	}
+
+	delete(assembler.pending, key)
+	size := 0
+	for _, part := range parts.chunks {
+		size += len(part)
+	}
+	payload = make([]byte, 0, size)
+	for _, part := range parts.chunks {
+		payload = append(payload, part...)
+	}
+	return payload, assembler.track(header), true
+}
+
+// Expire removes incomplete messages older than the configured timeout and
+// returns the number of removed messages.
+func (assembler *DatagramAssembler) Expire() int {
+	expired := 0
+	deadline := time.Now().Add(-assembler.timeout)
+	for key, parts := range assembler.pending {
+		if parts.created.Before(deadline) {
+			delete(assembler.pending, key)
+			expired++
+		}
+	}
+	return expired
+}
+
+func (assembler *DatagramAssembler) track(header DatagramHeader) uint64 {
+	last, known := assembler.last[header.Sender]
+	switch {
+	case !known:
+		assembler.last[header.Sender] = header.Sequence
+		return 0
+	case header.Sequence <= last:
+		return 0 // out of order or duplicate
+	default:
+		assembler.last[header.Sender] = header.Sequence
+		return header.Sequence - last - 1
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package components
+
+import (
+	"testing"
+	"time"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestDatagramChunking(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	payload := []byte("0123456789abcdefghij")
+	datagrams, err := NewDatagrams(7, 42, payload, DatagramHeaderSize+8)
+	expect.NoError(err)
+	expect.Equal(3, len(datagrams))
+
+	assembler := NewDatagramAssembler(time.Second)
+	for i := len(datagrams) - 1; i >= 0; i-- {
+		header, chunk, err := ParseDatagram(datagrams[i])
+		expect.NoError(err)
+		expect.Equal(uint32(7), header.Sender)
+		expect.Equal(uint64(42), header.Sequence)
+		expect.Equal(uint16(3), header.ChunkCount)
+
+		result, gap, complete := assembler.Add(header, chunk)
+		expect.Equal(i == 0, complete)
+		if complete {
+			expect.Equal(string(payload), string(result))
+			expect.Equal(uint64(0), gap)
+		}
+	}
+
+	_, err = NewDatagrams(7, 43, payload, DatagramHeaderSize)
+	expect.NotNil(err)
+
+	_, _, err = ParseDatagram([]byte("no header"))
+	expect.NotNil(err)
+}
+
+func TestDatagramGaps(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	assembler := NewDatagramAssembler(time.Second)
+
+	add := func(sender uint32, sequence uint64) uint64 {
+		datagrams, err := NewDatagrams(sender, sequence, []byte("data"), 1400)
+		expect.NoError(err)
+		header, chunk, err := ParseDatagram(datagrams[0])
+		expect.NoError(err)
+		_, gap, complete := assembler.Add(header, chunk)
+		expect.True(complete)
+		return gap
+	}
+
+	expect.Equal(uint64(0), add(1, 10))
+	expect.Equal(uint64(0), add(1, 11))
+	expect.Equal(uint64(3), add(1, 15))
+	expect.Equal(uint64(0), add(1, 13)) // out of order
+	expect.Equal(uint64(0), add(2, 100))
+	expect.Equal(uint64(1), add(2, 102))
+}
+
+func TestDatagramExpire(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	assembler := NewDatagramAssembler(0)
+
+	datagrams, err := NewDatagrams(1, 1, []byte("0123456789"), DatagramHeaderSize+5)
+	expect.NoError(err)
+	header, chunk, err := ParseDatagram(datagrams[0])
+	expect.NoError(err)
+
+	_, _, complete := assembler.Add(header, chunk)
+	expect.False(complete)
+
+	time.Sleep(time.Millisecond)
+	expect.Equal(1, assembler.Expire())
+	expect.Equal(0, assembler.Expire())
+}
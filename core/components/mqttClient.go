@@ -0,0 +1,145 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package components
+
+import (
+	"fmt"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/trivago/gollum/core"
+)
+
+// MQTTClient component
+//
+// The MQTTClient is a helper component to handle connection settings shared
+// by MQTT consumers and producers.
+//
+// Parameters
+//
+// - Address: Defines the broker to connect to. Supported schemes are "tcp",
+// "ssl", "tls", "ws" and "wss".
+// By default this parameter is set to "tcp://localhost:1883".
+//
+// - ClientID: Defines the client id used when connecting to the broker. If
+// this is empty, the plugin id prefixed with "gollum-" is used.
+// By default this parameter is set to "".
+//
+// - Username: Defines the username used for authentication.
+// By default this parameter is set to "".
+//
+// - Password: Defines the password used for authentication.
+// By default this parameter is set to "".
+//
+// - CleanSession: When set to false, the broker keeps subscriptions and
+// queued QoS 1 and 2 messages for this client id while it is disconnected.
+// By default this parameter is set to true.
+//
+// - KeepAliveSec: Defines the interval in which keep alive messages are sent
+// to the broker.
+// By default this parameter is set to 30.
+//
+// - ConnectTimeoutMs: Defines the maximum time to wait for a connection to be
+// established.
+// By default this parameter is set to 10000.
+//
+// - WillTopic: Defines the topic the broker publishes the last will message
+// to if this client disconnects unexpectedly. If this is empty, no last will
+// is set.
+// By default this parameter is set to "".
+//
+// - WillMessage: Defines the payload of the last will message.
+// By default this parameter is set to "".
+//
+// - WillQoS: Defines the quality of service level of the last will message.
+// By default this parameter is set to 0.
+//
+// - WillRetain: When set to true, the last will message is retained by the
+// broker.
+// By default this parameter is set to false.
+//
+type MQTTClient struct {
+	TLS            TLSConfig     `gollumdoc:"embed_type"`
+	address        string        `config:"Address" default:"tcp://localhost:1883"`
+	clientID       string        `config:"ClientID"`
+	username       string        `config:"Username"`
+	password       string        `config:"Password"`
+	cleanSession   bool          `config:"CleanSession" default:"true"`
+	keepAlive      time.Duration `config:"KeepAliveSec" default:"30" metric:"sec"`
+	connectTimeout time.Duration `config:"ConnectTimeoutMs" default:"10000" metric:"ms"`
+	willTopic      string        `config:"WillTopic"`
+	willMessage    string        `config:"WillMessage"`
+	willQoS        int           `config:"WillQoS" default:"0"`
+	willRetain     bool          `config:"WillRetain" default:"false"`
+	options        *mqtt.ClientOptions
+}
+
+// Configure method for interface implementation
+func (client *MQTTClient) Configure(conf core.PluginConfigReader) {
+	if client.clientID == "" {
+		client.clientID = "gollum-" + conf.GetID()
+	}
+	conf.Errors.Push(ValidateMQTTQoS(client.willQoS))
+
+	client.options = mqtt.NewClientOptions().
+		AddBroker(client.address).
+		SetClientID(client.clientID).
+		SetCleanSession(client.cleanSession).
+		SetKeepAlive(client.keepAlive).
+		SetConnectTimeout(client.connectTimeout).
+		SetAutoReconnect(true)
+
+	if client.username != "" {
+		client.options.SetUsername(client.username)
+		client.options.SetPassword(client.password)
+	}
+	if tlsConfig := client.TLS.GetConfig(); tlsConfig != nil {
+		client.options.SetTLSConfig(tlsConfig)
+	}
+	if client.willTopic != "" {
+		client.options.SetWill(client.willTopic, client.willMessage, byte(client.willQoS), client.willRetain)
+	}
+}
+
+// GetClientOptions returns the options to create a client with. The options
+// may be modified before creating a client, e.g. to set handlers.
+func (client *MQTTClient) GetClientOptions() *mqtt.ClientOptions {
+	return client.options
+}
+
+// GetAddress returns the address of the broker to connect to
+func (client *MQTTClient) GetAddress() string {
+	return client.address
+}
+
+// ValidateMQTTQoS returns an error if the given value is not a valid MQTT
+// quality of service level.
+func ValidateMQTTQoS(qos int) error {
+	if qos < 0 || qos > 2 {
+		return fmt.Errorf("Invalid QoS level %d. Only 0, 1 and 2 are supported", qos)
+	}
+	return nil
+}
+
+// WaitMQTTToken waits for an MQTT operation to finish and returns its error.
+// If timeout is 0, this function waits forever.
+func WaitMQTTToken(token mqtt.Token, timeout time.Duration) error {
+	if timeout == 0 {
+		token.Wait()
+	} else if !token.WaitTimeout(timeout) {
+		return fmt.Errorf("MQTT operation timed out after %s", timeout)
+	}
+	return token.Error()
+}
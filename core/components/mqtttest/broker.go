@@ -0,0 +1,242 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mqtttest provides a minimal MQTT broker for testing.
+package mqtttest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+// Broker is a minimal MQTT 3.1.1 broker supporting QoS 0, 1 and 2 publishing
+// and retained messages. Messages are forwarded with QoS 0. The broker is
+// meant to be used by tests of MQTT based plugins only.
+type Broker struct {
+	listener net.Listener
+	guard    sync.Mutex
+	subs     map[*brokerConn][]string
+	retained map[string][]byte
+}
+
+type brokerConn struct {
+	conn  net.Conn
+	guard sync.Mutex
+}
+
+// NewBroker starts a broker listening on a random local port.
+func NewBroker(expect ttesting.Expect) *Broker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	expect.NoError(err)
+
+	broker := &Broker{
+		listener: listener,
+		subs:     make(map[*brokerConn][]string),
+		retained: make(map[string][]byte),
+	}
+	go broker.accept()
+	return broker
+}
+
+// Address returns the URL clients can connect to.
+func (broker *Broker) Address() string {
+	return "tcp://" + broker.listener.Addr().String()
+}
+
+func (broker *Broker) accept() {
+	for {
+		conn, err := broker.listener.Accept()
+		if err != nil {
+			return
+		}
+		go broker.serve(&brokerConn{conn: conn})
+	}
+}
+
+func (conn *brokerConn) write(header byte, body []byte) {
+	packet := []byte{header}
+	for length := len(body); ; {
+		digit := byte(length % 128)
+		if length /= 128; length > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if length == 0 {
+			break
+		}
+	}
+
+	conn.guard.Lock()
+	defer conn.guard.Unlock()
+	conn.conn.Write(append(packet, body...))
+}
+
+func readString(data []byte) (string, []byte) {
+	length := binary.BigEndian.Uint16(data)
+	return string(data[2 : 2+length]), data[2+length:]
+}
+
+func matchTopic(filter, topic string) bool {
+	filterParts := strings.Split(filter, "/")
+	topicParts := strings.Split(topic, "/")
+	for i, part := range filterParts {
+		switch {
+		case part == "#":
+			return true
+		case i >= len(topicParts):
+			return false
+		case part != "+" && part != topicParts[i]:
+			return false
+		}
+	}
+	return len(filterParts) == len(topicParts)
+}
+
+// newPublishPacket returns the header and body of a QoS 0 PUBLISH packet.
+func newPublishPacket(topic string, payload []byte, retained bool) (byte, []byte) {
+	body := append([]byte{byte(len(topic) >> 8), byte(len(topic))}, topic...)
+	body = append(body, payload...)
+	header := byte(0x30)
+	if retained {
+		header |= 0x01
+	}
+	return header, body
+}
+
+func (broker *Broker) forward(topic string, payload []byte) {
+	header, body := newPublishPacket(topic, payload, false)
+
+	broker.guard.Lock()
+	defer broker.guard.Unlock()
+	for conn, filters := range broker.subs {
+		for _, filter := range filters {
+			if matchTopic(filter, topic) {
+				conn.write(header, body)
+				break
+			}
+		}
+	}
+}
+
+func (broker *Broker) serve(conn *brokerConn) {
+	defer func() {
+		broker.guard.Lock()
+		delete(broker.subs, conn)
+		broker.guard.Unlock()
+		conn.conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn.conn)
+	for {
+		header, err := reader.ReadByte()
+		if err != nil {
+			return
+		}
+		length, multiplier := 0, 1
+		for {
+			digit, err := reader.ReadByte()
+			if err != nil {
+				return
+			}
+			length += int(digit&0x7F) * multiplier
+			multiplier *= 128
+			if digit&0x80 == 0 {
+				break
+			}
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return
+		}
+
+		switch header >> 4 {
+		case 1: // CONNECT
+			conn.write(0x20, []byte{0, 0})
+
+		case 3: // PUBLISH
+			qos := (header >> 1) & 0x03
+			topic, rest := readString(body)
+			var packetID []byte
+			if qos > 0 {
+				packetID, rest = rest[:2], rest[2:]
+			}
+			payload := append([]byte{}, rest...)
+
+			if header&0x01 != 0 {
+				broker.guard.Lock()
+				broker.retained[topic] = payload
+				broker.guard.Unlock()
+			}
+			broker.forward(topic, payload)
+
+			switch qos {
+			case 1:
+				conn.write(0x40, packetID)
+			case 2:
+				conn.write(0x50, packetID)
+			}
+
+		case 6: // PUBREL
+			conn.write(0x70, body[:2])
+
+		case 8: // SUBSCRIBE
+			packetID, rest := body[:2], body[2:]
+			granted := []byte{}
+			filters := []string{}
+			for len(rest) > 0 {
+				var filter string
+				filter, rest = readString(rest)
+				filters = append(filters, filter)
+				granted = append(granted, 0)
+				rest = rest[1:]
+			}
+
+			// Only retained messages matching the new filters are sent
+			broker.guard.Lock()
+			broker.subs[conn] = append(broker.subs[conn], filters...)
+			retained := make(map[string][]byte, len(broker.retained))
+			for topic, payload := range broker.retained {
+				for _, filter := range filters {
+					if matchTopic(filter, topic) {
+						retained[topic] = payload
+						break
+					}
+				}
+			}
+			broker.guard.Unlock()
+
+			conn.write(0x90, append(packetID, granted...))
+			for topic, payload := range retained {
+				conn.write(newPublishPacket(topic, payload, true))
+			}
+
+		case 12: // PINGREQ
+			conn.write(0xD0, nil)
+
+		case 14: // DISCONNECT
+			return
+		}
+	}
+}
+
+// Close stops accepting new connections.
+func (broker *Broker) Close() {
+	broker.listener.Close()
+}
@@ -0,0 +1,155 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package components
+
+import (
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/sirupsen/logrus"
+	"github.com/trivago/gollum/core"
+)
+
+// NATSClient component
+//
+// The NATSClient is a helper component to handle connection settings shared
+// by NATS consumers and producers.
+//
+// Parameters
+//
+// - Address: Defines the NATS server(s) to connect to. Multiple servers can
+// be given as comma separated list.
+// By default this parameter is set to "nats://localhost:4222".
+//
+// - Name: Defines the client name reported to the server. If this is empty,
+// the plugin id prefixed with "gollum-" is used.
+// By default this parameter is set to "".
+//
+// - Username: Defines the username used for authentication.
+// By default this parameter is set to "".
+//
+// - Password: Defines the password used for authentication.
+// By default this parameter is set to "".
+//
+// - Token: Defines the token used for authentication. This is ignored if
+// Username is set.
+// By default this parameter is set to "".
+//
+// - ConnectTimeoutMs: Defines the maximum time to wait for a connection to be
+// established.
+// By default this parameter is set to 2000.
+//
+// - ReconnectDelayMs: Defines the time to wait between reconnect attempts.
+// The client reconnects forever.
+// By default this parameter is set to 2000.
+//
+type NATSClient struct {
+	TLS            TLSConfig     `gollumdoc:"embed_type"`
+	address        string        `config:"Address" default:"nats://localhost:4222"`
+	name           string        `config:"Name"`
+	username       string        `config:"Username"`
+	password       string        `config:"Password"`
+	token          string        `config:"Token"`
+	connectTimeout time.Duration `config:"ConnectTimeoutMs" default:"2000" metric:"ms"`
+	reconnectDelay time.Duration `config:"ReconnectDelayMs" default:"2000" metric:"ms"`
+}
+
+// Configure method for interface implementation
+func (client *NATSClient) Configure(conf core.PluginConfigReader) {
+	if client.name == "" {
+		client.name = "gollum-" + conf.GetID()
+	}
+}
+
+// GetAddress returns the address of the server(s) to connect to
+func (client *NATSClient) GetAddress() string {
+	return client.address
+}
+
+// GetReconnectDelay returns the time to wait between reconnect attempts
+func (client *NATSClient) GetReconnectDelay() time.Duration {
+	return client.reconnectDelay
+}
+
+// Connect creates a new connection to the configured server(s). Connection
+// state changes are reported to the given logger.
+func (client *NATSClient) Connect(logger logrus.FieldLogger) (*nats.Conn, error) {
+	options := []nats.Option{
+		nats.Name(client.name),
+		nats.Timeout(client.connectTimeout),
+		nats.ReconnectWait(client.reconnectDelay),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				logger.WithError(err).Warning("Connection to server lost")
+			}
+		}),
+		nats.ReconnectHandler(func(conn *nats.Conn) {
+			logger.Info("Reconnected to ", conn.ConnectedUrl())
+		}),
+	}
+
+	switch {
+	case client.username != "":
+		options = append(options, nats.UserInfo(client.username, client.password))
+	case client.token != "":
+		options = append(options, nats.Token(client.token))
+	}
+
+	if tlsConfig := client.TLS.GetConfig(); tlsConfig != nil {
+		options = append(options, nats.Secure(tlsConfig))
+	}
+
+	return nats.Connect(client.address, options...)
+}
+
+// NATSHeaderToMetadata copies all header values to the given metadata. If a
+// header has multiple values, only the first value is copied.
+func NATSHeaderToMetadata(header nats.Header, metadata core.Metadata) {
+	for key, values := range header {
+		if len(values) > 0 {
+			metadata.SetValue(key, []byte(values[0]))
+		}
+	}
+}
+
+// MetadataToNATSHeader creates a header from the given metadata keys. If no
+// keys are given, all metadata values are copied. Keys that are not set or
+// empty are skipped. Nil is returned if no header value has been set.
+func MetadataToNATSHeader(metadata core.Metadata, keys []string) nats.Header {
+	if len(metadata) == 0 {
+		return nil
+	}
+
+	header := nats.Header{}
+	if len(keys) == 0 {
+		for key := range metadata {
+			if value := metadata.GetValueString(key); value != "" {
+				header[key] = []string{value}
+			}
+		}
+	} else {
+		for _, key := range keys {
+			if value := metadata.GetValueString(key); value != "" {
+				header[key] = []string{value}
+			}
+		}
+	}
+
+	if len(header) == 0 {
+		return nil
+	}
+	return header
+}
@@ -0,0 +1,41 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package components
+
+import (
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestNATSHeaderMetadata(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	metadata := core.Metadata{}
+	NATSHeaderToMetadata(nats.Header{"sensor": {"rpm", "speed"}, "lap": {"12"}}, metadata)
+	expect.Equal("rpm", metadata.GetValueString("sensor"))
+	expect.Equal("12", metadata.GetValueString("lap"))
+
+	header := MetadataToNATSHeader(metadata, nil)
+	expect.Equal(nats.Header{"sensor": {"rpm"}, "lap": {"12"}}, header)
+
+	header = MetadataToNATSHeader(metadata, []string{"lap", "driver"})
+	expect.Equal(nats.Header{"lap": {"12"}}, header)
+
+	expect.Nil(MetadataToNATSHeader(metadata, []string{"driver"}))
+	expect.Nil(MetadataToNATSHeader(nil, nil))
+}
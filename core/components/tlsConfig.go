@@ -0,0 +1,318 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package components
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/tgo/tcontainer"
+)
+
+// TLSConfig defines TLS settings for client connections
+//
+// Parameters
+//
+// - TlsEnable: Enables TLS encrypted connections.
+// By default this parameter is set to false.
+//
+// - TlsKeyLocation: Defines the path to a PEM formatted private key used for
+// client certificate authentication. Requires TlsCertificateLocation to be set.
+// By default this parameter is set to "".
+//
+// - TlsCertificateLocation: Defines the path to a PEM formatted certificate
+// used for client certificate authentication. Requires TlsKeyLocation to be
+// set.
+// By default this parameter is set to "".
+//
+// - TlsCaLocation: Defines the path to PEM formatted CA certificate(s) used
+// to verify the server's certificate. If this is empty, the system's
+// certificate pool is used.
+// By default this parameter is set to "".
+//
+// - TlsServerName: Defines the hostname expected in the server's certificate.
+// If this is empty, the hostname used for connecting is expected.
+// By default this parameter is set to "".
+//
+// - TlsInsecureSkipVerify: Disables verification of the server's certificate
+// chain and host name. This should only be used for testing.
+// By default this parameter is set to false.
+//
+// - TlsMinVersion: Defines the minimum TLS version accepted. Valid values are
+// "1.0", "1.1", "1.2" and "1.3". If empty, the go default is used.
+// By default this parameter is set to "".
+//
+type TLSConfig struct {
+	Enabled bool `config:"TlsEnable" default:"false"`
+	config  *tls.Config
+}
+
+// Configure method for interface implementation
+func (t *TLSConfig) Configure(conf core.PluginConfigReader) {
+	keyFile := conf.GetString("TlsKeyLocation", "")
+	certFile := conf.GetString("TlsCertificateLocation", "")
+	caFile := conf.GetString("TlsCaLocation", "")
+	serverName := conf.GetString("TlsServerName", "")
+	skipVerify := conf.GetBool("TlsInsecureSkipVerify", false)
+	minVersion := conf.GetString("TlsMinVersion", "")
+
+	if !t.Enabled {
+		return // ### return, TLS disabled ###
+	}
+
+	config, err := NewTLSConfig(certFile, keyFile, caFile)
+	if conf.Errors.Push(err) {
+		return
+	}
+
+	if config.MinVersion, err = ParseTLSVersion(minVersion); conf.Errors.Push(err) {
+		return
+	}
+
+	config.ServerName = serverName
+	config.InsecureSkipVerify = skipVerify
+	t.config = config
+}
+
+// GetConfig returns the TLS configuration to use for connections or nil if
+// TLS is disabled.
+func (t *TLSConfig) GetConfig() *tls.Config {
+	return t.config
+}
+
+// Client wraps an established connection to the given address into a TLS
+// client connection and performs the handshake within the given timeout.
+// If TlsServerName is not set, the host of address is expected in the
+// server's certificate. If TLS is disabled, conn is returned as-is.
+func (t *TLSConfig) Client(conn net.Conn, address string, timeout time.Duration) (net.Conn, error) {
+	if t.config == nil {
+		return conn, nil // ### return, TLS disabled ###
+	}
+
+	config := t.config
+	if config.ServerName == "" {
+		config = config.Clone()
+		if host, _, err := net.SplitHostPort(address); err == nil {
+			config.ServerName = host
+		} else {
+			config.ServerName = address
+		}
+	}
+
+	tlsConn := tls.Client(conn, config)
+	if timeout > 0 {
+		tlsConn.SetDeadline(time.Now().Add(timeout))
+		defer tlsConn.SetDeadline(time.Time{})
+	}
+
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// NewTLSConfig creates a TLS configuration from a certificate/key pair and
+// a CA file. Each of these files is optional but certificate and key have to
+// be set together.
+func NewTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	config := new(tls.Config)
+
+	switch {
+	case certFile != "" && keyFile != "":
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+
+	case certFile != "" || keyFile != "":
+		return nil, fmt.Errorf("TLS certificate and key have to be set together")
+	}
+
+	if caFile != "" {
+		caCertPool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = caCertPool
+	}
+
+	return config, nil
+}
+
+// ParseTLSVersion converts a version string like "1.2" to the matching
+// tls.VersionTLS* constant. An empty string returns 0, i.e. the go default.
+func ParseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "":
+		return 0, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("Unknown TLS version %s", version)
+	}
+}
+
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	caCert, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	caCertPool := x509.NewCertPool()
+	if !caCertPool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("No valid certificates found in %s", caFile)
+	}
+	return caCertPool, nil
+}
+
+// TLSServerConfig defines TLS settings for listening sockets
+//
+// Parameters
+//
+// - TlsEnable: Enables TLS encrypted connections.
+// By default this parameter is set to false.
+//
+// - TlsKeyLocation: Defines the path to the PEM formatted private key of the
+// server. Required if TLS is enabled.
+// By default this parameter is set to "".
+//
+// - TlsCertificateLocation: Defines the path to the PEM formatted certificate
+// of the server. Required if TLS is enabled.
+// By default this parameter is set to "".
+//
+// - TlsClientCaLocation: Defines the path to PEM formatted CA certificate(s)
+// used to verify client certificates. If this is set, clients have to present
+// a valid certificate (mutual TLS).
+// By default this parameter is set to "".
+//
+// - TlsMinVersion: Defines the minimum TLS version accepted. Valid values are
+// "1.0", "1.1", "1.2" and "1.3". If empty, the go default is used.
+// By default this parameter is set to "".
+//
+// - TlsSniCertificates: Defines a map of server names to certificates used
+// for clients requesting that server name via SNI. Each entry requires a
+// "Certificate" and a "Key" path to PEM formatted files. Server names are
+// matched case-insensitive. Clients requesting unknown or no server names
+// receive the certificate set by TlsCertificateLocation.
+// By default this parameter is empty.
+//
+type TLSServerConfig struct {
+	Enabled bool `config:"TlsEnable" default:"false"`
+	config  *tls.Config
+}
+
+// Configure method for interface implementation
+func (t *TLSServerConfig) Configure(conf core.PluginConfigReader) {
+	keyFile := conf.GetString("TlsKeyLocation", "")
+	certFile := conf.GetString("TlsCertificateLocation", "")
+	clientCaFile := conf.GetString("TlsClientCaLocation", "")
+	minVersion := conf.GetString("TlsMinVersion", "")
+	sniCertificates := conf.GetMap("TlsSniCertificates", tcontainer.NewMarshalMap())
+
+	if !t.Enabled {
+		return // ### return, TLS disabled ###
+	}
+
+	if certFile == "" || keyFile == "" {
+		conf.Errors.Pushf("TlsCertificateLocation and TlsKeyLocation are required when TLS is enabled")
+		return
+	}
+
+	config, err := NewTLSConfig(certFile, keyFile, "")
+	if conf.Errors.Push(err) {
+		return
+	}
+
+	if config.MinVersion, err = ParseTLSVersion(minVersion); conf.Errors.Push(err) {
+		return
+	}
+
+	if clientCaFile != "" {
+		clientCAs, err := loadCertPool(clientCaFile)
+		if conf.Errors.Push(err) {
+			return
+		}
+		config.ClientCAs = clientCAs
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	if len(sniCertificates) > 0 {
+		certificates, err := loadSNICertificates(sniCertificates)
+		if conf.Errors.Push(err) {
+			return
+		}
+		config.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			// A nil certificate makes the server use config.Certificates
+			return certificates[strings.ToLower(hello.ServerName)], nil
+		}
+	}
+
+	t.config = config
+}
+
+// loadSNICertificates loads the certificate/key pairs of a server name to
+// files map as used by TlsSniCertificates. Server names are converted to
+// lowercase.
+func loadSNICertificates(files tcontainer.MarshalMap) (map[string]*tls.Certificate, error) {
+	certificates := make(map[string]*tls.Certificate, len(files))
+	for serverName, value := range files {
+		pair, err := tcontainer.ConvertToMarshalMap(value, strings.ToLower)
+		if err != nil {
+			return nil, fmt.Errorf("TlsSniCertificates for %s must be a map", serverName)
+		}
+
+		certFile, _ := pair.String("certificate")
+		keyFile, _ := pair.String("key")
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("TlsSniCertificates for %s requires Certificate and Key", serverName)
+		}
+
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		certificates[strings.ToLower(serverName)] = &cert
+	}
+	return certificates, nil
+}
+
+// GetConfig returns the TLS configuration to use for listeners or nil if
+// TLS is disabled.
+func (t *TLSServerConfig) GetConfig() *tls.Config {
+	return t.config
+}
+
+// Listener wraps the given listener so that accepted connections use TLS.
+// If TLS is disabled, listener is returned as-is.
+func (t *TLSServerConfig) Listener(listener net.Listener) net.Listener {
+	if t.config == nil {
+		return listener
+	}
+	return tls.NewListener(listener, t.config)
+}
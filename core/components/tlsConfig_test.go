@@ -0,0 +1,258 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package components
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/tgo/ttesting"
+)
+
+// writeTestCertificate creates a certificate signed by parent (self signed if
+// parent is nil) and writes certificate and key to dir.
+func writeTestCertificate(expect ttesting.Expect, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	expect.NoError(err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	expect.NoError(err)
+	cert, err := x509.ParseCertificate(der)
+	expect.NoError(err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	expect.NoError(err)
+
+	expect.NoError(ioutil.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	expect.NoError(ioutil.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return cert, key
+}
+
+func newTestConfigReader(settings map[string]interface{}) core.PluginConfigReader {
+	config := core.NewPluginConfig("", "tlsTest")
+	for key, value := range settings {
+		config.Override(key, value)
+	}
+	return core.NewPluginConfigReader(&config)
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	version, err := ParseTLSVersion("1.2")
+	expect.NoError(err)
+	expect.Equal(uint16(tls.VersionTLS12), version)
+
+	version, err = ParseTLSVersion("")
+	expect.NoError(err)
+	expect.Equal(uint16(0), version)
+
+	_, err = ParseTLSVersion("2.0")
+	expect.NotNil(err)
+}
+
+func TestTLSMutualAuthentication(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-tls")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	ca, caKey := writeTestCertificate(expect, dir, "ca", nil, nil)
+	writeTestCertificate(expect, dir, "server", ca, caKey)
+	writeTestCertificate(expect, dir, "client", ca, caKey)
+
+	server := TLSServerConfig{Enabled: true}
+	reader := newTestConfigReader(map[string]interface{}{
+		"TlsCertificateLocation": filepath.Join(dir, "server.crt"),
+		"TlsKeyLocation":         filepath.Join(dir, "server.key"),
+		"TlsClientCaLocation":    filepath.Join(dir, "ca.crt"),
+		"TlsMinVersion":          "1.2",
+	})
+	server.Configure(reader)
+	expect.NoError(reader.Errors.OrNil())
+	expect.Equal(uint16(tls.VersionTLS12), server.GetConfig().MinVersion)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	expect.NoError(err)
+	listener = server.Listener(listener)
+	defer listener.Close()
+
+	received := make(chan string, 2)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			data, _ := ioutil.ReadAll(conn)
+			received <- string(data)
+			conn.Close()
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	address := "localhost:" + port
+
+	// Client with certificate
+	client := TLSConfig{Enabled: true}
+	reader = newTestConfigReader(map[string]interface{}{
+		"TlsCertificateLocation": filepath.Join(dir, "client.crt"),
+		"TlsKeyLocation":         filepath.Join(dir, "client.key"),
+		"TlsCaLocation":          filepath.Join(dir, "ca.crt"),
+	})
+	client.Configure(reader)
+	expect.NoError(reader.Errors.OrNil())
+
+	conn, err := net.Dial("tcp", address)
+	expect.NoError(err)
+	conn, err = client.Client(conn, address, time.Second)
+	expect.NoError(err)
+	conn.Write([]byte("lap 12"))
+	conn.Close()
+	expect.Equal("lap 12", <-received)
+
+	// Client without certificate is rejected by the server
+	anonymous := TLSConfig{Enabled: true}
+	reader = newTestConfigReader(map[string]interface{}{
+		"TlsCaLocation": filepath.Join(dir, "ca.crt"),
+	})
+	anonymous.Configure(reader)
+	expect.NoError(reader.Errors.OrNil())
+
+	conn, err = net.Dial("tcp", address)
+	expect.NoError(err)
+	if conn, err = anonymous.Client(conn, address, time.Second); err == nil {
+		// TLS 1.3 reports the missing certificate on the first read
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, err = conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+	expect.NotNil(err)
+	<-received
+
+	// Disabled TLS returns the connection as-is
+	plain := TLSConfig{}
+	rawConn, err := net.Dial("tcp", address)
+	expect.NoError(err)
+	conn, err = plain.Client(rawConn, address, time.Second)
+	expect.NoError(err)
+	expect.Equal(rawConn, conn)
+	conn.Close()
+}
+
+func TestTLSServerNameIndication(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-tls")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	ca, caKey := writeTestCertificate(expect, dir, "ca", nil, nil)
+	writeTestCertificate(expect, dir, "default", ca, caKey)
+	writeTestCertificate(expect, dir, "pit", ca, caKey)
+
+	server := TLSServerConfig{Enabled: true}
+	reader := newTestConfigReader(map[string]interface{}{
+		"TlsCertificateLocation": filepath.Join(dir, "default.crt"),
+		"TlsKeyLocation":         filepath.Join(dir, "default.key"),
+		"TlsSniCertificates": map[string]interface{}{
+			"Pit.Example.com": map[string]interface{}{
+				"Certificate": filepath.Join(dir, "pit.crt"),
+				"Key":         filepath.Join(dir, "pit.key"),
+			},
+		},
+	})
+	server.Configure(reader)
+	expect.NoError(reader.Errors.OrNil())
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	expect.NoError(err)
+	listener = server.Listener(listener)
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	getServerCertificate := func(serverName string) string {
+		client := TLSConfig{Enabled: true}
+		reader := newTestConfigReader(map[string]interface{}{
+			"TlsServerName":         serverName,
+			"TlsInsecureSkipVerify": true,
+		})
+		client.Configure(reader)
+		expect.NoError(reader.Errors.OrNil())
+
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		expect.NoError(err)
+		conn, err = client.Client(conn, listener.Addr().String(), time.Second)
+		expect.NoError(err)
+		defer conn.Close()
+		return conn.(*tls.Conn).ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+
+	expect.Equal("pit", getServerCertificate("pit.example.com"))
+	expect.Equal("default", getServerCertificate("garage.example.com"))
+
+	// Entries without a key are rejected
+	invalid := TLSServerConfig{Enabled: true}
+	reader = newTestConfigReader(map[string]interface{}{
+		"TlsCertificateLocation": filepath.Join(dir, "default.crt"),
+		"TlsKeyLocation":         filepath.Join(dir, "default.key"),
+		"TlsSniCertificates": map[string]interface{}{
+			"pit.example.com": map[string]interface{}{
+				"Certificate": filepath.Join(dir, "pit.crt"),
+			},
+		},
+	})
+	invalid.Configure(reader)
+	expect.NotNil(reader.Errors.OrNil())
+}
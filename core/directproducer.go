@@ -37,6 +37,7 @@ func (prod *DirectProducer) Configure(conf PluginConfigReader) {
 // by the producer main loop. A timeout value != nil will overwrite the channel
 // timeout value for this call.
 func (prod *DirectProducer) Enqueue(msg *Message, timeout time.Duration) {
+	msg = prod.detach(msg)
 	defer prod.enqueuePanicHandling(msg)
 
 	// Don't accept messages if we are shutting down
@@ -49,8 +50,9 @@ func (prod *DirectProducer) Enqueue(msg *Message, timeout time.Duration) {
 		return
 	}
 
-	prod.onMessage(msg)
+	// The message is released by onMessage
 	MessageTrace(msg, prod.GetID(), "Enqueued by direct producer")
+	prod.onMessage(msg)
 }
 
 // MessageControlLoop provides a producer main loop that is sufficient for most
@@ -15,16 +15,21 @@
 package core
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/sirupsen/logrus"
+	"github.com/trivago/tgo/tcontainer"
 )
 
 // MessageData is a container for the message payload, streamID and an optional message key
 // The struct is used by Message.data for the current message data and orig for the original message data
 type MessageData struct {
-	payload  []byte
-	metadata Metadata
+	payload       []byte
+	metadata      Metadata
+	document      tcontainer.MarshalMap
+	documentDirty bool
 }
 
 // Message is a container used for storing the internal state of messages.
@@ -37,6 +42,12 @@ type Message struct {
 	origStreamID MessageStreamID
 	source       MessageSource
 	timestamp    int64
+	priority     MessagePriority
+	buffer       []byte
+	recycle      func([]byte)
+	refs         int32
+	tracker      *messageTracker
+	pooled       bool
 }
 
 // NewMessage creates a new message from a given data stream by copying data.
@@ -46,6 +57,7 @@ func NewMessage(source MessageSource, data []byte, metadata Metadata, streamID M
 		streamID:     streamID,
 		origStreamID: streamID,
 		timestamp:    time.Now().UnixNano(),
+		refs:         1,
 	}
 
 	msg.data.payload = getPayloadCopy(data)
@@ -113,6 +125,17 @@ func (msg *Message) SetlStreamIDAsOriginal(streamID MessageStreamID) {
 	msg.origStreamID = streamID
 }
 
+// GetPriority returns the priority of this message.
+func (msg *Message) GetPriority() MessagePriority {
+	return msg.priority
+}
+
+// SetPriority changes the priority of this message. The priority is used by
+// producers to decide which queued message is processed or dropped first.
+func (msg *Message) SetPriority(priority MessagePriority) {
+	msg.priority = priority
+}
+
 // GetSource returns the message's source (can be nil).
 func (msg *Message) GetSource() MessageSource {
 	return msg.source
@@ -120,18 +143,54 @@ func (msg *Message) GetSource() MessageSource {
 
 // String implements the stringer interface
 func (msg *Message) String() string {
-	return string(msg.data.payload)
+	return string(msg.GetPayload())
 }
 
-// GetPayload returns the stored data
+// GetPayload returns the stored data. If the payload has been changed via
+// StoreDocument, the document is serialized before returning.
 func (msg *Message) GetPayload() []byte {
+	msg.data.syncPayload()
 	return msg.data.payload
 }
 
+// GetDocument returns the payload parsed as a JSON object. The parsed document
+// is cached so that consecutive calls (e.g. by a chain of JSON based
+// formatters) do not have to parse the payload again. If the returned
+// document is modified, StoreDocument has to be called to update the payload.
+// The cache is invalidated when the payload is changed via StorePayload.
+// Documents of shared messages (see Acquire) are not cached and must not be
+// modified.
+func (msg *Message) GetDocument() (tcontainer.MarshalMap, error) {
+	if msg.data.document == nil {
+		document := tcontainer.NewMarshalMap()
+		if err := json.Unmarshal(msg.data.payload, &document); err != nil {
+			return nil, err
+		}
+		if msg.IsShared() {
+			return document, nil // ### return, not cached ###
+		}
+		msg.data.document = document
+	}
+	return msg.data.document, nil
+}
+
+// StoreDocument replaces the payload with the given JSON object. The document
+// is not serialized before the payload is accessed or the modulator chain
+// processing this message has finished. The document must not be modified
+// after this call unless StoreDocument is called again.
+func (msg *Message) StoreDocument(document tcontainer.MarshalMap) {
+	msg.data.document = document
+	msg.data.documentDirty = true
+}
+
 // GetMetadata returns the current Metadata. If no metadata is present, the
-// metadata map will be created by this call.
+// metadata map will be created by this call. Shared messages (see Acquire)
+// return an empty map that is not stored in this case.
 func (msg *Message) GetMetadata() Metadata {
 	if msg.data.metadata == nil {
+		if msg.IsShared() {
+			return make(Metadata) // ### return, read-only ###
+		}
 		msg.data.metadata = make(Metadata)
 	}
 	return msg.data.metadata
@@ -146,6 +205,9 @@ func (msg *Message) TryGetMetadata() Metadata {
 // StorePayload copies data into the hold data buffer. If the buffer can hold
 // data it is resized, otherwise a new buffer will be allocated.
 func (msg *Message) StorePayload(data []byte) {
+	msg.data.document = nil
+	msg.data.documentDirty = false
+
 	if len(data) <= cap(msg.data.payload) {
 		msg.data.payload = msg.data.payload[:len(data)]
 		copy(msg.data.payload, data)
@@ -155,36 +217,42 @@ func (msg *Message) StorePayload(data []byte) {
 }
 
 // Clone returns a copy of this message, i.e. the payload is duplicated.
-// The created timestamp is copied, too.
+// The created timestamp is copied, too. Clones of pooled messages are pooled,
+// too and have to be released separately.
 func (msg *Message) Clone() *Message {
-	clone := *msg
-
-	clone.data.payload = make([]byte, len(msg.data.payload))
+	msg.data.syncPayload()
+	clone := msg.newClone(len(msg.data.payload))
 	copy(clone.data.payload, msg.data.payload)
 
-	return &clone
+	return clone
 }
 
 // CloneOriginal returns a copy of this message with the original payload and
 // stream. If FreezeOriginal has not been called before it will be at this point
-// so that all subsequential calls will use the same original.
+// so that all subsequential calls will use the same original. Shared messages
+// (see Acquire) are not frozen, their current payload is used instead.
 func (msg *Message) CloneOriginal() *Message {
-	if msg.orig == nil {
-		msg.FreezeOriginal()
+	orig := msg.orig
+	if orig == nil {
+		if msg.IsShared() {
+			orig = &msg.data
+		} else {
+			msg.FreezeOriginal()
+			orig = msg.orig
+		}
 	}
 
-	clone := *msg
-	clone.data.payload = make([]byte, len(msg.orig.payload))
-	copy(clone.data.payload, msg.orig.payload)
+	clone := msg.newClone(len(orig.payload))
+	copy(clone.data.payload, orig.payload)
 
-	if msg.orig.metadata == nil {
-		clone.data.metadata = msg.orig.metadata.Clone()
+	if orig.metadata == nil {
+		clone.data.metadata = orig.metadata.Clone()
 	} else {
 		clone.data.metadata = nil
 	}
 
 	clone.SetStreamID(msg.origStreamID)
-	return &clone
+	return clone
 }
 
 // FreezeOriginal will take the current state of the message and store it as
@@ -198,6 +266,7 @@ func (msg *Message) FreezeOriginal() {
 		return
 	}
 
+	msg.data.syncPayload()
 	var metadata Metadata
 	if msg.data.metadata != nil {
 		metadata = msg.data.metadata.Clone()
@@ -214,25 +283,27 @@ func (msg *Message) FreezeOriginal() {
 // serialized data is based on the current message state and does not preserve
 // the original data created by FreezeOriginal.
 func (msg *Message) Serialize() ([]byte, error) {
+	return proto.Marshal(msg.ToSerializedMessage())
+}
+
+// ToSerializedMessage converts the message into its protobuf representation
+// as used by Serialize.
+func (msg *Message) ToSerializedMessage() *SerializedMessage {
+	msg.data.syncPayload()
 	serializable := &SerializedMessage{
 		StreamID:     proto.Uint64(uint64(msg.GetStreamID())),
 		PrevStreamID: proto.Uint64(uint64(msg.GetPrevStreamID())),
 		OrigStreamID: proto.Uint64(uint64(msg.GetOrigStreamID())),
 		Timestamp:    proto.Int64(msg.timestamp),
-		Data: &SerializedMessageData{
-			Data:     msg.data.payload,
-			Metadata: msg.data.metadata,
-		},
+		Priority:     proto.Int32(int32(msg.priority)),
+		Data:         msg.data.serialize(),
 	}
 
 	if msg.orig != nil {
-		serializable.Original = &SerializedMessageData{
-			Data:     msg.orig.payload,
-			Metadata: msg.orig.metadata,
-		}
+		serializable.Original = msg.orig.serialize()
 	}
 
-	return proto.Marshal(serializable)
+	return serializable
 }
 
 // DeserializeMessage generates a message from a byte array produced by
@@ -243,24 +314,61 @@ func DeserializeMessage(data []byte) (*Message, error) {
 	if err := proto.Unmarshal(data, serializable); err != nil {
 		return nil, err
 	}
+	return NewMessageFromSerialized(serializable), nil
+}
 
+// NewMessageFromSerialized generates a message from its protobuf
+// representation as created by Message.ToSerializedMessage.
+func NewMessageFromSerialized(serializable *SerializedMessage) *Message {
 	msg := &Message{
 		streamID:     MessageStreamID(serializable.GetStreamID()),
 		prevStreamID: MessageStreamID(serializable.GetPrevStreamID()),
 		origStreamID: MessageStreamID(serializable.GetOrigStreamID()),
 		timestamp:    serializable.GetTimestamp(),
+		priority:     MessagePriority(serializable.GetPriority()),
+		refs:         1,
 	}
 
 	if msgData := serializable.GetData(); msgData != nil {
-		msg.data.payload = msgData.GetData()
-		msg.data.metadata = msgData.GetMetadata()
+		msg.data.deserialize(msgData)
 	}
 
 	if msgOrigData := serializable.GetOriginal(); msgOrigData != nil {
 		msg.orig = new(MessageData)
-		msg.orig.payload = msgOrigData.GetData()
-		msg.orig.metadata = msgOrigData.GetMetadata()
+		msg.orig.deserialize(msgOrigData)
+	}
+
+	return msg
+}
+
+// syncPayload serializes a modified document back to the payload. The
+// document stays cached as it still matches the payload afterwards.
+func (data *MessageData) syncPayload() {
+	if !data.documentDirty {
+		return
+	}
+
+	data.documentDirty = false
+	payload, err := json.Marshal(data.document)
+	if err != nil {
+		logrus.WithError(err).Warning("Failed to serialize message document")
+		data.document = nil
+		return
 	}
+	data.payload = payload
+}
+
+// serialize converts the message data to its protobuf representation.
+func (data *MessageData) serialize() *SerializedMessageData {
+	serialized := &SerializedMessageData{
+		Data: data.payload,
+	}
+	serialized.Metadata, serialized.TypedMetadata = data.metadata.serialize()
+	return serialized
+}
 
-	return msg, nil
+// deserialize restores the message data from its protobuf representation.
+func (data *MessageData) deserialize(serialized *SerializedMessageData) {
+	data.payload = serialized.GetData()
+	data.metadata = deserializeMetadata(serialized.GetMetadata(), serialized.GetTypedMetadata())
 }
@@ -1,16 +1,6 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // source: message.proto
 
-/*
-Package core is a generated protocol buffer package.
-
-It is generated from these files:
-	message.proto
-
-It has these top-level messages:
-	SerializedMessageData
-	SerializedMessage
-*/
 package core
 
 import proto "github.com/golang/protobuf/proto"
@@ -28,16 +18,116 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
+type SerializedMetadataValue struct {
+	Int                  *int64                              `protobuf:"varint,1,opt,name=Int" json:"Int,omitempty"`
+	Float                *float64                            `protobuf:"fixed64,2,opt,name=Float" json:"Float,omitempty"`
+	Bool                 *bool                               `protobuf:"varint,3,opt,name=Bool" json:"Bool,omitempty"`
+	Time                 *int64                              `protobuf:"varint,4,opt,name=Time" json:"Time,omitempty"`
+	Metadata             map[string][]byte                   `protobuf:"bytes,5,rep,name=Metadata" json:"Metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	TypedMetadata        map[string]*SerializedMetadataValue `protobuf:"bytes,6,rep,name=TypedMetadata" json:"TypedMetadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	XXX_NoUnkeyedLiteral struct{}                            `json:"-"`
+	XXX_unrecognized     []byte                              `json:"-"`
+	XXX_sizecache        int32                               `json:"-"`
+}
+
+func (m *SerializedMetadataValue) Reset()         { *m = SerializedMetadataValue{} }
+func (m *SerializedMetadataValue) String() string { return proto.CompactTextString(m) }
+func (*SerializedMetadataValue) ProtoMessage()    {}
+func (*SerializedMetadataValue) Descriptor() ([]byte, []int) {
+	return fileDescriptor_message_43a5b8e870340e0c, []int{0}
+}
+func (m *SerializedMetadataValue) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SerializedMetadataValue.Unmarshal(m, b)
+}
+func (m *SerializedMetadataValue) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SerializedMetadataValue.Marshal(b, m, deterministic)
+}
+func (dst *SerializedMetadataValue) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SerializedMetadataValue.Merge(dst, src)
+}
+func (m *SerializedMetadataValue) XXX_Size() int {
+	return xxx_messageInfo_SerializedMetadataValue.Size(m)
+}
+func (m *SerializedMetadataValue) XXX_DiscardUnknown() {
+	xxx_messageInfo_SerializedMetadataValue.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SerializedMetadataValue proto.InternalMessageInfo
+
+func (m *SerializedMetadataValue) GetInt() int64 {
+	if m != nil && m.Int != nil {
+		return *m.Int
+	}
+	return 0
+}
+
+func (m *SerializedMetadataValue) GetFloat() float64 {
+	if m != nil && m.Float != nil {
+		return *m.Float
+	}
+	return 0
+}
+
+func (m *SerializedMetadataValue) GetBool() bool {
+	if m != nil && m.Bool != nil {
+		return *m.Bool
+	}
+	return false
+}
+
+func (m *SerializedMetadataValue) GetTime() int64 {
+	if m != nil && m.Time != nil {
+		return *m.Time
+	}
+	return 0
+}
+
+func (m *SerializedMetadataValue) GetMetadata() map[string][]byte {
+	if m != nil {
+		return m.Metadata
+	}
+	return nil
+}
+
+func (m *SerializedMetadataValue) GetTypedMetadata() map[string]*SerializedMetadataValue {
+	if m != nil {
+		return m.TypedMetadata
+	}
+	return nil
+}
+
 type SerializedMessageData struct {
-	Data             []byte            `protobuf:"bytes,1,req,name=Data" json:"Data,omitempty"`
-	Metadata         map[string][]byte `protobuf:"bytes,2,rep,name=Metadata" json:"Metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
-	XXX_unrecognized []byte            `json:"-"`
+	Data                 []byte                              `protobuf:"bytes,1,req,name=Data" json:"Data,omitempty"`
+	Metadata             map[string][]byte                   `protobuf:"bytes,2,rep,name=Metadata" json:"Metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	TypedMetadata        map[string]*SerializedMetadataValue `protobuf:"bytes,3,rep,name=TypedMetadata" json:"TypedMetadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	XXX_NoUnkeyedLiteral struct{}                            `json:"-"`
+	XXX_unrecognized     []byte                              `json:"-"`
+	XXX_sizecache        int32                               `json:"-"`
+}
+
+func (m *SerializedMessageData) Reset()         { *m = SerializedMessageData{} }
+func (m *SerializedMessageData) String() string { return proto.CompactTextString(m) }
+func (*SerializedMessageData) ProtoMessage()    {}
+func (*SerializedMessageData) Descriptor() ([]byte, []int) {
+	return fileDescriptor_message_43a5b8e870340e0c, []int{1}
+}
+func (m *SerializedMessageData) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SerializedMessageData.Unmarshal(m, b)
+}
+func (m *SerializedMessageData) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SerializedMessageData.Marshal(b, m, deterministic)
+}
+func (dst *SerializedMessageData) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SerializedMessageData.Merge(dst, src)
+}
+func (m *SerializedMessageData) XXX_Size() int {
+	return xxx_messageInfo_SerializedMessageData.Size(m)
+}
+func (m *SerializedMessageData) XXX_DiscardUnknown() {
+	xxx_messageInfo_SerializedMessageData.DiscardUnknown(m)
 }
 
-func (m *SerializedMessageData) Reset()                    { *m = SerializedMessageData{} }
-func (m *SerializedMessageData) String() string            { return proto.CompactTextString(m) }
-func (*SerializedMessageData) ProtoMessage()               {}
-func (*SerializedMessageData) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+var xxx_messageInfo_SerializedMessageData proto.InternalMessageInfo
 
 func (m *SerializedMessageData) GetData() []byte {
 	if m != nil {
@@ -53,20 +143,49 @@ func (m *SerializedMessageData) GetMetadata() map[string][]byte {
 	return nil
 }
 
+func (m *SerializedMessageData) GetTypedMetadata() map[string]*SerializedMetadataValue {
+	if m != nil {
+		return m.TypedMetadata
+	}
+	return nil
+}
+
 type SerializedMessage struct {
-	StreamID         *uint64                `protobuf:"varint,1,req,name=StreamID" json:"StreamID,omitempty"`
-	Data             *SerializedMessageData `protobuf:"bytes,2,req,name=Data" json:"Data,omitempty"`
-	PrevStreamID     *uint64                `protobuf:"varint,3,opt,name=PrevStreamID" json:"PrevStreamID,omitempty"`
-	OrigStreamID     *uint64                `protobuf:"varint,4,opt,name=OrigStreamID" json:"OrigStreamID,omitempty"`
-	Timestamp        *int64                 `protobuf:"varint,5,opt,name=Timestamp" json:"Timestamp,omitempty"`
-	Original         *SerializedMessageData `protobuf:"bytes,6,opt,name=Original" json:"Original,omitempty"`
-	XXX_unrecognized []byte                 `json:"-"`
+	StreamID             *uint64                `protobuf:"varint,1,req,name=StreamID" json:"StreamID,omitempty"`
+	Data                 *SerializedMessageData `protobuf:"bytes,2,req,name=Data" json:"Data,omitempty"`
+	PrevStreamID         *uint64                `protobuf:"varint,3,opt,name=PrevStreamID" json:"PrevStreamID,omitempty"`
+	OrigStreamID         *uint64                `protobuf:"varint,4,opt,name=OrigStreamID" json:"OrigStreamID,omitempty"`
+	Timestamp            *int64                 `protobuf:"varint,5,opt,name=Timestamp" json:"Timestamp,omitempty"`
+	Original             *SerializedMessageData `protobuf:"bytes,6,opt,name=Original" json:"Original,omitempty"`
+	Priority             *int32                 `protobuf:"zigzag32,7,opt,name=Priority" json:"Priority,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}               `json:"-"`
+	XXX_unrecognized     []byte                 `json:"-"`
+	XXX_sizecache        int32                  `json:"-"`
 }
 
-func (m *SerializedMessage) Reset()                    { *m = SerializedMessage{} }
-func (m *SerializedMessage) String() string            { return proto.CompactTextString(m) }
-func (*SerializedMessage) ProtoMessage()               {}
-func (*SerializedMessage) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+func (m *SerializedMessage) Reset()         { *m = SerializedMessage{} }
+func (m *SerializedMessage) String() string { return proto.CompactTextString(m) }
+func (*SerializedMessage) ProtoMessage()    {}
+func (*SerializedMessage) Descriptor() ([]byte, []int) {
+	return fileDescriptor_message_43a5b8e870340e0c, []int{2}
+}
+func (m *SerializedMessage) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SerializedMessage.Unmarshal(m, b)
+}
+func (m *SerializedMessage) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SerializedMessage.Marshal(b, m, deterministic)
+}
+func (dst *SerializedMessage) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SerializedMessage.Merge(dst, src)
+}
+func (m *SerializedMessage) XXX_Size() int {
+	return xxx_messageInfo_SerializedMessage.Size(m)
+}
+func (m *SerializedMessage) XXX_DiscardUnknown() {
+	xxx_messageInfo_SerializedMessage.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SerializedMessage proto.InternalMessageInfo
 
 func (m *SerializedMessage) GetStreamID() uint64 {
 	if m != nil && m.StreamID != nil {
@@ -110,30 +229,51 @@ func (m *SerializedMessage) GetOriginal() *SerializedMessageData {
 	return nil
 }
 
+func (m *SerializedMessage) GetPriority() int32 {
+	if m != nil && m.Priority != nil {
+		return *m.Priority
+	}
+	return 0
+}
+
 func init() {
+	proto.RegisterType((*SerializedMetadataValue)(nil), "serializedMetadataValue")
+	proto.RegisterMapType((map[string][]byte)(nil), "serializedMetadataValue.MetadataEntry")
+	proto.RegisterMapType((map[string]*SerializedMetadataValue)(nil), "serializedMetadataValue.TypedMetadataEntry")
 	proto.RegisterType((*SerializedMessageData)(nil), "serializedMessageData")
+	proto.RegisterMapType((map[string][]byte)(nil), "serializedMessageData.MetadataEntry")
+	proto.RegisterMapType((map[string]*SerializedMetadataValue)(nil), "serializedMessageData.TypedMetadataEntry")
 	proto.RegisterType((*SerializedMessage)(nil), "serializedMessage")
 }
 
-func init() { proto.RegisterFile("message.proto", fileDescriptor0) }
-
-var fileDescriptor0 = []byte{
-	// 269 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x8f, 0x41, 0x4b, 0xc3, 0x40,
-	0x10, 0x85, 0x99, 0x4d, 0x5a, 0xd2, 0x69, 0x0a, 0xba, 0xa8, 0x84, 0xe2, 0x61, 0x09, 0x1e, 0x16,
-	0x0f, 0x39, 0xe4, 0x24, 0x7a, 0x11, 0xa9, 0x07, 0x0f, 0x45, 0x59, 0x3d, 0x79, 0x5b, 0xec, 0x50,
-	0x16, 0x93, 0xa6, 0x6c, 0xd6, 0x42, 0xfd, 0x49, 0xfe, 0x3f, 0xef, 0xb2, 0x4d, 0x5d, 0x2d, 0x16,
-	0x4f, 0x3b, 0xf3, 0xe6, 0x9b, 0x9d, 0xf7, 0x70, 0x54, 0x53, 0xdb, 0xea, 0x39, 0x15, 0x4b, 0xdb,
-	0xb8, 0x26, 0xff, 0x00, 0x3c, 0x6e, 0xc9, 0x1a, 0x5d, 0x99, 0x77, 0x9a, 0x4d, 0xbb, 0xd9, 0x44,
-	0x3b, 0xcd, 0x39, 0xc6, 0xfe, 0xcd, 0x40, 0x30, 0x99, 0xaa, 0x4d, 0xcd, 0xaf, 0x31, 0x99, 0x92,
-	0xd3, 0x33, 0xaf, 0x33, 0x11, 0xc9, 0x61, 0x79, 0x56, 0xec, 0xdd, 0x2e, 0xbe, 0xb1, 0xdb, 0x85,
-	0xb3, 0x6b, 0x15, 0xb6, 0xc6, 0x57, 0x38, 0xda, 0x19, 0xf1, 0x03, 0x8c, 0x5e, 0x69, 0x9d, 0x81,
-	0x00, 0x39, 0x50, 0xbe, 0xe4, 0x47, 0xd8, 0x5b, 0xe9, 0xea, 0x8d, 0x32, 0x26, 0x40, 0xa6, 0xaa,
-	0x6b, 0x2e, 0xd9, 0x05, 0xe4, 0x9f, 0x80, 0x87, 0x7f, 0xce, 0xf1, 0x31, 0x26, 0x8f, 0xce, 0x92,
-	0xae, 0xef, 0x26, 0x1b, 0xb3, 0xb1, 0x0a, 0x3d, 0x3f, 0xdf, 0x86, 0x60, 0x82, 0xc9, 0x61, 0x79,
-	0xb2, 0xdf, 0xec, 0x36, 0x5c, 0x8e, 0xe9, 0x83, 0xa5, 0x55, 0xf8, 0x2b, 0x12, 0x20, 0x63, 0xb5,
-	0xa3, 0x79, 0xe6, 0xde, 0x9a, 0x79, 0x60, 0xe2, 0x8e, 0xf9, 0xad, 0xf1, 0x53, 0x1c, 0x3c, 0x99,
-	0x9a, 0x5a, 0xa7, 0xeb, 0x65, 0xd6, 0x13, 0x20, 0x23, 0xf5, 0x23, 0xf0, 0x12, 0x13, 0x4f, 0x9b,
-	0x85, 0xae, 0xb2, 0xbe, 0x80, 0x7f, 0x5c, 0x05, 0xee, 0xa6, 0xff, 0x1c, 0xbf, 0x34, 0x96, 0xbe,
-	0x02, 0x00, 0x00, 0xff, 0xff, 0xc4, 0xc6, 0x18, 0xde, 0xbc, 0x01, 0x00, 0x00,
+func init() { proto.RegisterFile("message.proto", fileDescriptor_message_43a5b8e870340e0c) }
+
+var fileDescriptor_message_43a5b8e870340e0c = []byte{
+	// 401 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xd4, 0x93, 0x4f, 0x6b, 0xdb, 0x30,
+	0x18, 0xc6, 0x91, 0xec, 0x64, 0xce, 0x9b, 0x04, 0x16, 0xb1, 0x3f, 0x22, 0xec, 0x20, 0xc2, 0x18,
+	0xde, 0x06, 0x3e, 0xf8, 0x34, 0xb6, 0xcb, 0x08, 0xd9, 0x20, 0x87, 0x92, 0x54, 0x0d, 0x3d, 0xe4,
+	0x26, 0x1a, 0x11, 0x4c, 0xed, 0x38, 0xc8, 0x6a, 0xc0, 0xfd, 0x16, 0x3d, 0xf6, 0x93, 0xf5, 0xeb,
+	0x14, 0xc9, 0x89, 0x63, 0x37, 0x71, 0xef, 0x3d, 0xf9, 0x7d, 0x5f, 0x3f, 0xfa, 0x49, 0xcf, 0x23,
+	0x04, 0xfd, 0x44, 0x66, 0x99, 0x58, 0xcb, 0x60, 0xab, 0x52, 0x9d, 0x8e, 0x1e, 0x1d, 0xf8, 0x9c,
+	0x49, 0x15, 0x89, 0x38, 0xba, 0x97, 0xab, 0x0b, 0xa9, 0xc5, 0x4a, 0x68, 0x71, 0x2d, 0xe2, 0x3b,
+	0x49, 0xde, 0x83, 0x33, 0xdd, 0x68, 0x8a, 0x18, 0xf2, 0x1d, 0x6e, 0x4a, 0xf2, 0x01, 0x5a, 0xff,
+	0xe3, 0x54, 0x68, 0x8a, 0x19, 0xf2, 0x11, 0x2f, 0x1a, 0x42, 0xc0, 0x1d, 0xa7, 0x69, 0x4c, 0x1d,
+	0x86, 0x7c, 0x8f, 0xdb, 0xda, 0xcc, 0x16, 0x51, 0x22, 0xa9, 0x6b, 0x17, 0xdb, 0x9a, 0x8c, 0xc1,
+	0x3b, 0x6c, 0x40, 0x5b, 0xcc, 0xf1, 0xbb, 0xe1, 0xb7, 0xa0, 0x61, 0xef, 0xe0, 0xd0, 0xfd, 0xdb,
+	0x68, 0x95, 0xf3, 0x72, 0x1d, 0xb9, 0x84, 0xfe, 0x22, 0xdf, 0x1e, 0xd5, 0xb4, 0x6d, 0x41, 0x3f,
+	0x1b, 0x41, 0x35, 0x75, 0x41, 0xab, 0x13, 0x86, 0x7f, 0xa0, 0x5f, 0xfb, 0x6f, 0x7c, 0xdf, 0xca,
+	0xdc, 0xfa, 0xee, 0x70, 0x53, 0x1a, 0xdf, 0x3b, 0x43, 0xb3, 0xbe, 0x7b, 0xbc, 0x68, 0x7e, 0xe3,
+	0x5f, 0x68, 0xb8, 0x04, 0x72, 0xba, 0xc3, 0x19, 0x42, 0x50, 0x25, 0x74, 0x43, 0xda, 0x74, 0xde,
+	0x0a, 0x7b, 0xf4, 0x84, 0xe1, 0x63, 0x55, 0x66, 0xef, 0x6d, 0x62, 0x52, 0x20, 0xe0, 0x9a, 0x2f,
+	0x45, 0x0c, 0xfb, 0x3d, 0x6e, 0x6b, 0xf2, 0xb7, 0x92, 0x2e, 0xb6, 0xa1, 0x7c, 0x0d, 0xce, 0xae,
+	0x6e, 0xcc, 0x76, 0xf6, 0x32, 0x5b, 0xc7, 0x62, 0xbe, 0x37, 0x60, 0xde, 0x70, 0xb2, 0x0f, 0x18,
+	0x06, 0x27, 0xa6, 0xc8, 0x10, 0xbc, 0x2b, 0xad, 0xa4, 0x48, 0xa6, 0x13, 0x9b, 0xac, 0xcb, 0xcb,
+	0x9e, 0xfc, 0xd8, 0x27, 0x8e, 0x19, 0xf6, 0xbb, 0xe1, 0xa7, 0xf3, 0x91, 0xec, 0x6f, 0x62, 0x04,
+	0xbd, 0xb9, 0x92, 0xbb, 0x92, 0x65, 0xde, 0x85, 0xcb, 0x6b, 0x33, 0xa3, 0x99, 0xa9, 0x68, 0x5d,
+	0x6a, 0xdc, 0x42, 0x53, 0x9d, 0x91, 0x2f, 0xd0, 0x31, 0xef, 0x26, 0xd3, 0x22, 0xd9, 0xd2, 0x96,
+	0x7d, 0x48, 0xc7, 0x01, 0x09, 0xc1, 0x33, 0xea, 0x68, 0x23, 0x62, 0xda, 0x66, 0xe8, 0x95, 0x53,
+	0x95, 0x3a, 0xe3, 0x70, 0xae, 0xa2, 0x54, 0x45, 0x3a, 0xa7, 0xef, 0x18, 0xf2, 0x07, 0xbc, 0xec,
+	0xc7, 0xed, 0xa5, 0x7b, 0x93, 0x2a, 0xf9, 0x3c, 0x00, 0x40, 0xf7, 0xe6, 0x6c, 0x21, 0x04, 0x00,
+	0x00,
 }
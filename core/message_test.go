@@ -237,3 +237,93 @@ func TestMessageSerialize(t *testing.T) {
 	expect.Equal(readMessage.orig.payload, testMessage.orig.payload)
 	expect.Equal(readMessage.orig.metadata, testMessage.orig.metadata)
 }
+
+func TestMessageSerializeTypedMetadata(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	testMessage := NewMessage(nil, []byte("typed"), nil, 1)
+	now := time.Unix(0, time.Now().UnixNano())
+
+	meta := testMessage.GetMetadata()
+	meta.SetValue("bytes", []byte("value"))
+	meta.SetInt("int", 42)
+	meta.SetFloat("float", 3.5)
+	meta.SetBool("bool", true)
+	meta.SetTime("time", now)
+	meta.SetMap("map", Metadata{
+		"id":    int64(0x1F0),
+		"empty": Metadata{},
+	})
+
+	data, err := testMessage.Serialize()
+	expect.NoError(err)
+
+	readMessage, err := DeserializeMessage(data)
+	expect.NoError(err)
+
+	readMeta := readMessage.GetMetadata()
+	expect.Equal("value", readMeta.GetValueString("bytes"))
+	expect.Equal(int64(42), readMeta["int"])
+	expect.Equal(3.5, readMeta["float"])
+	expect.Equal(true, readMeta["bool"])
+	expect.True(now.Equal(readMeta.GetTime("time")))
+
+	nested, isMap := readMeta.TryGetMap("map")
+	expect.True(isMap)
+	expect.Equal(int64(0x1F0), nested["id"])
+	expect.Equal(Metadata{}, nested.GetMap("empty"))
+}
+
+func TestMessageDocument(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	msg := NewMessage(nil, []byte(`{"rpm":3000}`), nil, 1)
+
+	document, err := msg.GetDocument()
+	expect.NoError(err)
+	expect.Equal(float64(3000), document["rpm"])
+
+	// Consecutive calls return the cached document
+	document["gear"] = "3"
+	cached, err := msg.GetDocument()
+	expect.NoError(err)
+	expect.Equal("3", cached["gear"])
+
+	// Storing the document defers serialization until the payload is read
+	msg.StoreDocument(document)
+	expect.True(msg.data.documentDirty)
+	expect.Equal(`{"gear":"3","rpm":3000}`, string(msg.GetPayload()))
+	expect.False(msg.data.documentDirty)
+
+	// Clones do not share the document
+	clone := msg.Clone()
+	expect.Nil(clone.data.document)
+	expect.Equal(`{"gear":"3","rpm":3000}`, clone.String())
+
+	// Byte level changes invalidate the cache
+	msg.StorePayload([]byte(`{"rpm":4000}`))
+	expect.Nil(msg.data.document)
+
+	document, err = msg.GetDocument()
+	expect.NoError(err)
+	expect.Equal(float64(4000), document["rpm"])
+
+	msg.StorePayload([]byte("no json"))
+	_, err = msg.GetDocument()
+	expect.NotNil(err)
+}
+
+func TestMessageSerializePriority(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	msg := NewMessage(nil, []byte("oil pressure low"), nil, 1)
+	expect.Equal(MessagePriorityNormal, msg.GetPriority())
+
+	msg.SetPriority(MessagePriorityCritical)
+	expect.Equal(MessagePriorityCritical, msg.Clone().GetPriority())
+
+	data, err := msg.Serialize()
+	expect.NoError(err)
+
+	restored, err := DeserializeMessage(data)
+	expect.NoError(err)
+	expect.Equal(MessagePriorityCritical, restored.GetPriority())
+}
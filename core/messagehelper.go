@@ -1,5 +1,11 @@
 package core
 
+import (
+	"encoding/json"
+
+	"github.com/trivago/tgo/tcontainer"
+)
+
 // GetAppliedContent is a func() to get message content from payload or meta data
 // for later handling by plugins
 type GetAppliedContent func(msg *Message) []byte
@@ -38,9 +44,55 @@ func GetAppliedContentSetFunction(applyTo string) SetAppliedContent {
 
 	return func(msg *Message, content []byte) {
 		if content == nil {
-			msg.data.payload = msg.data.payload[:0]
+			msg.StorePayload(msg.data.payload[:0])
 		} else {
 			msg.StorePayload(content)
 		}
 	}
 }
+
+// GetAppliedDocument is a func() to get message content parsed as JSON object
+// from payload or meta data for later handling by plugins
+type GetAppliedDocument func(msg *Message) (tcontainer.MarshalMap, error)
+
+// SetAppliedDocument is a func() to store a JSON object to payload or meta data
+type SetAppliedDocument func(msg *Message, document tcontainer.MarshalMap) error
+
+// GetAppliedDocumentGetFunction returns a GetAppliedDocument function. When
+// applied to the payload, the parsed document is cached by the message (see
+// Message.GetDocument).
+func GetAppliedDocumentGetFunction(applyTo string) GetAppliedDocument {
+	if applyTo != "" {
+		return func(msg *Message) (tcontainer.MarshalMap, error) {
+			document := tcontainer.NewMarshalMap()
+			content := GetAppliedContentGetFunction(applyTo)(msg)
+			err := json.Unmarshal(content, &document)
+			return document, err
+		}
+	}
+
+	return func(msg *Message) (tcontainer.MarshalMap, error) {
+		return msg.GetDocument()
+	}
+}
+
+// GetAppliedDocumentSetFunction returns a SetAppliedDocument function. When
+// applied to the payload, serialization is deferred (see
+// Message.StoreDocument).
+func GetAppliedDocumentSetFunction(applyTo string) SetAppliedDocument {
+	if applyTo != "" {
+		return func(msg *Message, document tcontainer.MarshalMap) error {
+			content, err := json.Marshal(document)
+			if err != nil {
+				return err
+			}
+			msg.GetMetadata().SetValue(applyTo, content)
+			return nil
+		}
+	}
+
+	return func(msg *Message, document tcontainer.MarshalMap) error {
+		msg.StoreDocument(document)
+		return nil
+	}
+}
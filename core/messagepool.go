@@ -0,0 +1,224 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxPooledBufferSize is the maximum capacity of a payload buffer that is
+// kept by a pooled message after it has been released. Larger buffers are
+// left to the garbage collector so that a single large message does not
+// increase the memory footprint of the pool permanently.
+const maxPooledBufferSize = 64 * 1024
+
+var messagePool = sync.Pool{
+	New: func() interface{} {
+		return new(Message)
+	},
+}
+
+// NewPooledMessage works like NewMessage but takes the message from a pool of
+// released messages. The data is copied into the payload buffer of the pooled
+// message, so that no allocation is required if the buffer is large enough.
+// The message is returned to the pool as soon as Release has been called as
+// often as Acquire plus one. Messages that are never released are collected
+// by the garbage collector as usual.
+func NewPooledMessage(source MessageSource, data []byte, metadata Metadata, streamID MessageStreamID) *Message {
+	msg := newPooledMessage(source, metadata, streamID)
+	msg.buffer = getPayloadBuffer(msg.buffer, len(data))
+	copy(msg.buffer, data)
+	msg.data.payload = msg.buffer
+	return msg
+}
+
+// NewPooledMessageWithBuffer works like NewPooledMessage but does not copy
+// the given buffer. The message takes ownership of buffer until it has been
+// released. After that the buffer is passed to recycle so that the caller can
+// reuse it. Recycle may be nil in which case the buffer is kept by the
+// message pool.
+func NewPooledMessageWithBuffer(source MessageSource, buffer []byte, metadata Metadata, streamID MessageStreamID, recycle func([]byte)) *Message {
+	msg := newPooledMessage(source, metadata, streamID)
+	msg.buffer = buffer
+	msg.recycle = recycle
+	msg.data.payload = buffer
+	return msg
+}
+
+func newPooledMessage(source MessageSource, metadata Metadata, streamID MessageStreamID) *Message {
+	msg := messagePool.Get().(*Message)
+	msg.source = source
+	msg.streamID = streamID
+	msg.origStreamID = streamID
+	msg.timestamp = time.Now().UnixNano()
+	msg.refs = 1
+	msg.pooled = true
+
+	if len(metadata) > 0 {
+		msg.data.metadata = metadata
+	}
+	return msg
+}
+
+// IsPooled returns true if this message will be returned to the message pool
+// when it is released.
+func (msg *Message) IsPooled() bool {
+	return msg.pooled
+}
+
+// Acquire adds an owner to this message. Plugins that pass the same message
+// to multiple owners (see router.Broadcast) have to call Acquire for each
+// additional owner. Each owner calls Release when done. Owners must not modify
+// a shared message, Detach returns a copy that can be modified.
+func (msg *Message) Acquire() {
+	atomic.AddInt32(&msg.refs, 1)
+}
+
+// SetReleaseCallback registers a function that is called as soon as this
+// message and all copies created from it (e.g. by Clone, Detach or
+// CloneOriginal) have been released, i.e. once every producer delivered,
+// dropped or discarded the message. The callback may be called from any go
+// routine. This function has to be called before the message is routed.
+func (msg *Message) SetReleaseCallback(onRelease func()) {
+	msg.tracker = &messageTracker{refs: 1, onRelease: onRelease}
+}
+
+// IsShared returns true if this message has more than one owner.
+func (msg *Message) IsShared() bool {
+	return atomic.LoadInt32(&msg.refs) > 1
+}
+
+// Detach returns a message that is owned by the caller only. If this message
+// is shared with other owners, a copy including the metadata is returned and
+// the caller's reference to this message is released.
+func (msg *Message) Detach() *Message {
+	if !msg.IsShared() {
+		return msg
+	}
+
+	clone := msg.Clone()
+	if msg.data.metadata != nil {
+		clone.data.metadata = msg.data.metadata.Clone()
+	}
+	msg.Release()
+	return clone
+}
+
+// Release removes an owner from this message. When the last owner releases a
+// pooled message, the message is reset and returned to the pool. The message,
+// its payload and its metadata must not be accessed by the caller after this
+// call. Releasing a message more often than it has been acquired has no
+// effect. Calling this function on a message that is not pooled only updates
+// the number of owners.
+func (msg *Message) Release() {
+	for {
+		refs := atomic.LoadInt32(&msg.refs)
+		if refs <= 0 {
+			return // ### return, already released ###
+		}
+		if atomic.CompareAndSwapInt32(&msg.refs, refs, refs-1) {
+			if refs > 1 {
+				return // ### return, still referenced ###
+			}
+			break
+		}
+	}
+
+	msg.tracker.release()
+	if !msg.pooled {
+		return // ### return, not pooled ###
+	}
+
+	buffer := msg.buffer
+	if msg.recycle != nil {
+		msg.recycle(buffer)
+		buffer = nil
+	} else if cap(buffer) > maxPooledBufferSize {
+		buffer = nil
+	}
+
+	*msg = Message{}
+	msg.buffer = buffer[:0]
+	messagePool.Put(msg)
+}
+
+// newClone returns a copy of all fields of this message except for payload
+// and the parsed document. Pooled messages produce pooled clones.
+func (msg *Message) newClone(payloadSize int) *Message {
+	var clone *Message
+	var buffer []byte
+	if msg.pooled {
+		clone = messagePool.Get().(*Message)
+		buffer = clone.buffer
+	} else {
+		clone = new(Message)
+	}
+
+	// The reference counter may be changed concurrently, so the message is
+	// not copied as a whole
+	*clone = Message{
+		data:         MessageData{metadata: msg.data.metadata},
+		orig:         msg.orig,
+		streamID:     msg.streamID,
+		prevStreamID: msg.prevStreamID,
+		origStreamID: msg.origStreamID,
+		source:       msg.source,
+		timestamp:    msg.timestamp,
+		priority:     msg.priority,
+		refs:         1,
+		tracker:      msg.tracker.acquire(),
+		pooled:       msg.pooled,
+	}
+
+	clone.buffer = getPayloadBuffer(buffer, payloadSize)
+	clone.data.payload = clone.buffer
+	return clone
+}
+
+// getPayloadBuffer returns a buffer of the given size. The passed buffer is
+// reused if its capacity is sufficient.
+func getPayloadBuffer(buffer []byte, size int) []byte {
+	if buffer != nil && cap(buffer) >= size {
+		return buffer[:size]
+	}
+	return make([]byte, size)
+}
+
+// messageTracker counts the messages created from a message passed to
+// SetReleaseCallback that have not been released yet.
+type messageTracker struct {
+	refs      int32
+	onRelease func()
+}
+
+// acquire adds a message to the tracker and returns the tracker. Calling this
+// function on a nil tracker returns nil.
+func (tracker *messageTracker) acquire() *messageTracker {
+	if tracker != nil {
+		atomic.AddInt32(&tracker.refs, 1)
+	}
+	return tracker
+}
+
+// release removes a message from the tracker and calls onRelease when the
+// last message has been released. Calling this function on a nil tracker has
+// no effect.
+func (tracker *messageTracker) release() {
+	if tracker != nil && atomic.AddInt32(&tracker.refs, -1) == 0 {
+		tracker.onRelease()
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+var benchmarkPayload = []byte(`{"id":291,"data":"0102030405060708"}`)
+
+func TestPooledMessage(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	data := []byte("test")
+	msg := NewPooledMessage(nil, data, nil, 1)
+	expect.True(msg.IsPooled())
+	expect.Equal("test", msg.String())
+	expect.Equal(MessageStreamID(1), msg.GetOrigStreamID())
+
+	// Data has to be copied
+	data[0] = 'b'
+	expect.Equal("test", msg.String())
+
+	clone := msg.Clone()
+	expect.True(clone.IsPooled())
+	expect.Equal("test", clone.String())
+
+	msg.Release()
+	expect.False(msg.IsPooled())
+	expect.Equal(0, len(msg.GetPayload()))
+
+	// Released twice is ignored
+	msg.Release()
+	expect.Equal("test", clone.String())
+	clone.Release()
+}
+
+func TestPooledMessageWithBuffer(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	var recycled []byte
+	buffer := []byte("test")
+
+	msg := NewPooledMessageWithBuffer(nil, buffer, nil, 1, func(data []byte) {
+		recycled = data
+	})
+
+	buffer[0] = 'b'
+	expect.Equal("best", msg.String())
+
+	clone := msg.Clone()
+	msg.Release()
+	expect.Equal("best", string(recycled))
+	expect.Equal(&buffer[0], &recycled[0])
+
+	// Clones own their buffer
+	expect.Equal("best", clone.String())
+	clone.Release()
+}
+
+func TestUnpooledMessageRelease(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	msg := NewMessage(nil, []byte("test"), nil, 1)
+	expect.False(msg.IsPooled())
+
+	msg.Release()
+	expect.Equal("test", msg.String())
+	expect.False(msg.Clone().IsPooled())
+}
+
+func TestSharedPooledMessage(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	msg := NewPooledMessage(nil, []byte("test"), nil, 1)
+	expect.False(msg.IsShared())
+
+	msg.Acquire()
+	expect.True(msg.IsShared())
+
+	// The message stays valid until the last owner released it
+	msg.Release()
+	expect.False(msg.IsShared())
+	expect.True(msg.IsPooled())
+	expect.Equal("test", msg.String())
+
+	msg.Release()
+	expect.False(msg.IsPooled())
+	expect.Equal(0, len(msg.GetPayload()))
+
+	// Released more often than acquired is ignored
+	msg.Release()
+	expect.False(msg.IsPooled())
+}
+
+func TestSharedPooledMessageParallelRelease(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	const numOwners = 8
+	msg := NewPooledMessage(nil, []byte("test"), nil, 1)
+	for i := 1; i < numOwners; i++ {
+		msg.Acquire()
+	}
+
+	start := sync.WaitGroup{}
+	done := sync.WaitGroup{}
+	start.Add(1)
+	done.Add(numOwners)
+	for i := 0; i < numOwners; i++ {
+		go func() {
+			defer done.Done()
+			start.Wait()
+			msg.Release()
+		}()
+	}
+
+	start.Done()
+	done.Wait()
+	expect.False(msg.IsPooled())
+}
+
+func TestMessageDetach(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	msg := NewPooledMessage(nil, []byte("test"), Metadata{"key": "value"}, 1)
+	expect.Equal(msg, msg.Detach())
+
+	msg.Acquire()
+	detached := msg.Detach()
+	expect.False(msg == detached)
+	expect.False(msg.IsShared())
+	expect.False(detached.IsShared())
+
+	// Changes to the copy must not be visible to other owners
+	detached.StorePayload([]byte("changed"))
+	detached.GetMetadata().SetValue("key", []byte("changed"))
+	expect.Equal("test", msg.String())
+	expect.Equal("value", msg.GetMetadata().GetValueString("key"))
+	expect.Equal("changed", detached.String())
+	expect.Equal("changed", detached.GetMetadata().GetValueString("key"))
+
+	msg.Release()
+	expect.False(msg.IsPooled())
+	expect.Equal("changed", detached.String())
+	detached.Release()
+}
+
+func TestMessageReleaseCallback(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	numCalls := 0
+	msg := NewPooledMessage(nil, []byte("test"), nil, 1)
+	msg.SetReleaseCallback(func() { numCalls++ })
+
+	clone := msg.Clone()
+	orig := msg.CloneOriginal()
+	clone.Release()
+	orig.Release()
+	expect.Equal(0, numCalls)
+
+	// Detaching releases the shared message but tracks the copy
+	msg.Acquire()
+	detached := msg.Detach()
+	expect.False(msg == detached)
+	msg.Release()
+	expect.Equal(0, numCalls)
+
+	detached.Release()
+	expect.Equal(1, numCalls)
+
+	// Released messages do not call the callback again
+	detached.Release()
+	msg.Release()
+	expect.Equal(1, numCalls)
+}
+
+func TestSharedMessageIsNotModifiedByReads(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	msg := NewMessage(nil, []byte(`{"a":1}`), nil, 1)
+	msg.Acquire()
+
+	_, err := msg.GetDocument()
+	expect.NoError(err)
+	expect.Nil(msg.data.document)
+
+	msg.GetMetadata()
+	expect.Nil(msg.TryGetMetadata())
+
+	orig := msg.CloneOriginal()
+	expect.Equal(`{"a":1}`, orig.String())
+	expect.Nil(msg.orig)
+}
+
+func BenchmarkNewMessage(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		msg := NewMessage(nil, benchmarkPayload, nil, InvalidStreamID)
+		msg.Release()
+	}
+}
+
+func BenchmarkNewPooledMessage(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		msg := NewPooledMessage(nil, benchmarkPayload, nil, InvalidStreamID)
+		msg.Release()
+	}
+}
+
+func BenchmarkNewPooledMessageWithBuffer(b *testing.B) {
+	buffer := make([]byte, len(benchmarkPayload))
+	recycle := func(data []byte) { buffer = data }
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		copy(buffer, benchmarkPayload)
+		msg := NewPooledMessageWithBuffer(nil, buffer, nil, InvalidStreamID, recycle)
+		msg.Release()
+	}
+}
+
+func BenchmarkMessageClone(b *testing.B) {
+	msg := NewMessage(nil, benchmarkPayload, nil, InvalidStreamID)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		clone := msg.Clone()
+		clone.Release()
+	}
+}
+
+func BenchmarkPooledMessageClone(b *testing.B) {
+	msg := NewPooledMessage(nil, benchmarkPayload, nil, InvalidStreamID)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		clone := msg.Clone()
+		clone.Release()
+	}
+}
+
+func BenchmarkPooledMessageParallel(b *testing.B) {
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			msg := NewPooledMessage(nil, benchmarkPayload, nil, InvalidStreamID)
+			msg.Release()
+		}
+	})
+}
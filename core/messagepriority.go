@@ -0,0 +1,97 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// MessagePriority defines the order in which queued messages are processed
+// by producers. Messages with a higher priority are processed first and are
+// dropped last under backpressure.
+type MessagePriority int8
+
+const (
+	// MessagePriorityLow is used for bulk data that may be dropped first
+	MessagePriorityLow = MessagePriority(-1)
+	// MessagePriorityNormal is the default priority of all messages
+	MessagePriorityNormal = MessagePriority(0)
+	// MessagePriorityHigh is used for data that should bypass normal traffic
+	MessagePriorityHigh = MessagePriority(1)
+	// MessagePriorityCritical is used for safety relevant data
+	MessagePriorityCritical = MessagePriority(2)
+
+	// numMessagePriorities is the number of priority levels
+	numMessagePriorities = int(MessagePriorityCritical-MessagePriorityLow) + 1
+)
+
+// PriorityMetric holds per-priority metrics objects
+type PriorityMetric struct {
+	Enqueued  metrics.Counter
+	Discarded metrics.Counter
+	Shed      metrics.Counter
+}
+
+var (
+	// Has to be index parallel to MessagePriority.index()
+	priorityToName = []string{
+		"low",
+		"normal",
+		"high",
+		"critical",
+	}
+
+	// Has to be index parallel to MessagePriority.index()
+	// This is filled by the metrics initialization function
+	priorityToMetric = make([]*PriorityMetric, numMessagePriorities)
+)
+
+// ParseMessagePriority converts a priority name into a MessagePriority.
+// Valid names are "low", "normal", "high" and "critical".
+func ParseMessagePriority(name string) (MessagePriority, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for idx, priorityName := range priorityToName {
+		if name == priorityName {
+			return MessagePriority(idx) + MessagePriorityLow, nil
+		}
+	}
+	return MessagePriorityNormal, fmt.Errorf("Unknown message priority '%s'", name)
+}
+
+// String returns the name of the priority
+func (prio MessagePriority) String() string {
+	return priorityToName[prio.index()]
+}
+
+// GetMetric returns the metrics handles for this priority.
+func (prio MessagePriority) GetMetric() *PriorityMetric {
+	return priorityToMetric[prio.index()]
+}
+
+// index returns a 0 based index for this priority. Priorities out of range
+// are clamped to the closest valid priority.
+func (prio MessagePriority) index() int {
+	switch {
+	case prio < MessagePriorityLow:
+		return 0
+	case prio > MessagePriorityCritical:
+		return numMessagePriorities - 1
+	default:
+		return int(prio - MessagePriorityLow)
+	}
+}
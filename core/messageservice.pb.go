@@ -0,0 +1,245 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: messageservice.proto
+
+package core
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type SerializedMessageBatch struct {
+	Sequence             *uint64              `protobuf:"varint,1,req,name=Sequence" json:"Sequence,omitempty"`
+	Messages             []*SerializedMessage `protobuf:"bytes,2,rep,name=Messages" json:"Messages,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *SerializedMessageBatch) Reset()         { *m = SerializedMessageBatch{} }
+func (m *SerializedMessageBatch) String() string { return proto.CompactTextString(m) }
+func (*SerializedMessageBatch) ProtoMessage()    {}
+func (*SerializedMessageBatch) Descriptor() ([]byte, []int) {
+	return fileDescriptor_messageservice_7d07ad8310d6676e, []int{0}
+}
+func (m *SerializedMessageBatch) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SerializedMessageBatch.Unmarshal(m, b)
+}
+func (m *SerializedMessageBatch) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SerializedMessageBatch.Marshal(b, m, deterministic)
+}
+func (dst *SerializedMessageBatch) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SerializedMessageBatch.Merge(dst, src)
+}
+func (m *SerializedMessageBatch) XXX_Size() int {
+	return xxx_messageInfo_SerializedMessageBatch.Size(m)
+}
+func (m *SerializedMessageBatch) XXX_DiscardUnknown() {
+	xxx_messageInfo_SerializedMessageBatch.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SerializedMessageBatch proto.InternalMessageInfo
+
+func (m *SerializedMessageBatch) GetSequence() uint64 {
+	if m != nil && m.Sequence != nil {
+		return *m.Sequence
+	}
+	return 0
+}
+
+func (m *SerializedMessageBatch) GetMessages() []*SerializedMessage {
+	if m != nil {
+		return m.Messages
+	}
+	return nil
+}
+
+type SerializedMessageBatchAck struct {
+	Sequence             *uint64  `protobuf:"varint,1,req,name=Sequence" json:"Sequence,omitempty"`
+	Error                *string  `protobuf:"bytes,2,opt,name=Error" json:"Error,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SerializedMessageBatchAck) Reset()         { *m = SerializedMessageBatchAck{} }
+func (m *SerializedMessageBatchAck) String() string { return proto.CompactTextString(m) }
+func (*SerializedMessageBatchAck) ProtoMessage()    {}
+func (*SerializedMessageBatchAck) Descriptor() ([]byte, []int) {
+	return fileDescriptor_messageservice_7d07ad8310d6676e, []int{1}
+}
+func (m *SerializedMessageBatchAck) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SerializedMessageBatchAck.Unmarshal(m, b)
+}
+func (m *SerializedMessageBatchAck) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SerializedMessageBatchAck.Marshal(b, m, deterministic)
+}
+func (dst *SerializedMessageBatchAck) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SerializedMessageBatchAck.Merge(dst, src)
+}
+func (m *SerializedMessageBatchAck) XXX_Size() int {
+	return xxx_messageInfo_SerializedMessageBatchAck.Size(m)
+}
+func (m *SerializedMessageBatchAck) XXX_DiscardUnknown() {
+	xxx_messageInfo_SerializedMessageBatchAck.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SerializedMessageBatchAck proto.InternalMessageInfo
+
+func (m *SerializedMessageBatchAck) GetSequence() uint64 {
+	if m != nil && m.Sequence != nil {
+		return *m.Sequence
+	}
+	return 0
+}
+
+func (m *SerializedMessageBatchAck) GetError() string {
+	if m != nil && m.Error != nil {
+		return *m.Error
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterType((*SerializedMessageBatch)(nil), "serializedMessageBatch")
+	proto.RegisterType((*SerializedMessageBatchAck)(nil), "serializedMessageBatchAck")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// MessageServiceClient is the client API for MessageService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type MessageServiceClient interface {
+	Forward(ctx context.Context, opts ...grpc.CallOption) (MessageService_ForwardClient, error)
+}
+
+type messageServiceClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewMessageServiceClient(cc *grpc.ClientConn) MessageServiceClient {
+	return &messageServiceClient{cc}
+}
+
+func (c *messageServiceClient) Forward(ctx context.Context, opts ...grpc.CallOption) (MessageService_ForwardClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_MessageService_serviceDesc.Streams[0], "/MessageService/Forward", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &messageServiceForwardClient{stream}
+	return x, nil
+}
+
+type MessageService_ForwardClient interface {
+	Send(*SerializedMessageBatch) error
+	Recv() (*SerializedMessageBatchAck, error)
+	grpc.ClientStream
+}
+
+type messageServiceForwardClient struct {
+	grpc.ClientStream
+}
+
+func (x *messageServiceForwardClient) Send(m *SerializedMessageBatch) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *messageServiceForwardClient) Recv() (*SerializedMessageBatchAck, error) {
+	m := new(SerializedMessageBatchAck)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// MessageServiceServer is the server API for MessageService service.
+type MessageServiceServer interface {
+	Forward(MessageService_ForwardServer) error
+}
+
+func RegisterMessageServiceServer(s *grpc.Server, srv MessageServiceServer) {
+	s.RegisterService(&_MessageService_serviceDesc, srv)
+}
+
+func _MessageService_Forward_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MessageServiceServer).Forward(&messageServiceForwardServer{stream})
+}
+
+type MessageService_ForwardServer interface {
+	Send(*SerializedMessageBatchAck) error
+	Recv() (*SerializedMessageBatch, error)
+	grpc.ServerStream
+}
+
+type messageServiceForwardServer struct {
+	grpc.ServerStream
+}
+
+func (x *messageServiceForwardServer) Send(m *SerializedMessageBatchAck) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *messageServiceForwardServer) Recv() (*SerializedMessageBatch, error) {
+	m := new(SerializedMessageBatch)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+var _MessageService_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "MessageService",
+	HandlerType: (*MessageServiceServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Forward",
+			Handler:       _MessageService_Forward_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "messageservice.proto",
+}
+
+func init() {
+	proto.RegisterFile("messageservice.proto", fileDescriptor_messageservice_7d07ad8310d6676e)
+}
+
+var fileDescriptor_messageservice_7d07ad8310d6676e = []byte{
+	// 184 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0x12, 0xc9, 0x4d, 0x2d, 0x2e,
+	0x4e, 0x4c, 0x4f, 0x2d, 0x4e, 0x2d, 0x2a, 0xcb, 0x4c, 0x4e, 0xd5, 0x2b, 0x28, 0xca, 0x2f, 0xc9,
+	0x97, 0xe2, 0x85, 0x8a, 0x42, 0xb8, 0x4a, 0x29, 0x5c, 0x62, 0xc5, 0xa9, 0x45, 0x99, 0x89, 0x39,
+	0x99, 0x55, 0xa9, 0x29, 0xbe, 0x10, 0x29, 0xa7, 0xc4, 0x92, 0xe4, 0x0c, 0x21, 0x29, 0x2e, 0x8e,
+	0xe0, 0xd4, 0xc2, 0xd2, 0xd4, 0xbc, 0xe4, 0x54, 0x09, 0x46, 0x05, 0x26, 0x0d, 0x96, 0x20, 0x38,
+	0x5f, 0x48, 0x8f, 0x8b, 0x03, 0xaa, 0xb6, 0x58, 0x82, 0x49, 0x81, 0x59, 0x83, 0xdb, 0x48, 0x48,
+	0x0f, 0xc3, 0x98, 0x20, 0xb8, 0x1a, 0x25, 0x5f, 0x2e, 0x49, 0xec, 0xb6, 0x38, 0x26, 0x67, 0xe3,
+	0xb5, 0x48, 0x84, 0x8b, 0xd5, 0xb5, 0xa8, 0x28, 0xbf, 0x48, 0x82, 0x49, 0x81, 0x51, 0x83, 0x33,
+	0x08, 0xc2, 0x31, 0x0a, 0xe1, 0xe2, 0x83, 0x1a, 0x12, 0x0c, 0xf1, 0x9b, 0x90, 0x13, 0x17, 0xbb,
+	0x5b, 0x7e, 0x51, 0x79, 0x62, 0x51, 0x8a, 0x90, 0xb8, 0x1e, 0x76, 0xab, 0xa4, 0xa4, 0xf4, 0x70,
+	0xba, 0x41, 0x83, 0xd1, 0x80, 0xd1, 0x89, 0x2d, 0x8a, 0x25, 0x39, 0xbf, 0x28, 0x15, 0x30, 0x00,
+	0xb6, 0xcc, 0xa0, 0xc2, 0x38, 0x01, 0x00, 0x00,
+}
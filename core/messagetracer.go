@@ -146,8 +146,8 @@ func (mt *messageTracer) newMessageDump(msg *Message, comment string) messageDum
 	// prepare meta data
 	if metadata := msg.TryGetMetadata(); metadata != nil {
 		dump.Metadata = map[string]string{}
-		for k, v := range metadata {
-			dump.Metadata[k] = string(v)
+		for k := range metadata {
+			dump.Metadata[k] = metadata.GetValueString(k)
 		}
 	}
 
@@ -14,8 +14,22 @@
 
 package core
 
-// Metadata is a map for optional meta data which can set by consumers and modulators
-type Metadata map[string][]byte
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Metadata is a map for optional meta data which can set by consumers and modulators.
+// Values are stored as byte slices by default. Typed values (int64, float64,
+// bool, time.Time and nested Metadata) can be stored by using the typed
+// setters. The byte based getters convert typed values to their string
+// representation so that plugins unaware of types keep working.
+type Metadata map[string]interface{}
 
 // SetValue set a key value pair at meta data
 func (meta Metadata) SetValue(key string, value []byte) {
@@ -33,9 +47,10 @@ func (meta Metadata) TrySetValue(key string, value []byte) bool {
 
 // GetValue returns a meta data value by key. This function returns a value if
 // key is not set, too. In that case it will return an empty byte array.
+// Typed values are converted to their string representation.
 func (meta Metadata) GetValue(key string) []byte {
 	if value, isSet := meta[key]; isSet {
-		return value
+		return metadataValueToBytes(value)
 	}
 
 	return []byte{}
@@ -45,7 +60,7 @@ func (meta Metadata) GetValue(key string) []byte {
 // if the key was set or not.
 func (meta Metadata) TryGetValue(key string) ([]byte, bool) {
 	if value, isSet := meta[key]; isSet {
-		return value, true
+		return metadataValueToBytes(value), true
 	}
 	return []byte{}, false
 }
@@ -61,6 +76,176 @@ func (meta Metadata) TryGetValueString(key string) (string, bool) {
 	return string(data), exists
 }
 
+// Set stores a value of any type. Values are normalized to one of the types
+// supported by Metadata, i.e. integers are stored as int64, strings as byte
+// slices and so on. Types not directly supported are stored using their
+// fmt.Sprint representation.
+func (meta Metadata) Set(key string, value interface{}) {
+	meta[key] = normalizeMetadataValue(value)
+}
+
+// TryGet returns the value stored for the given key without any conversion.
+// The second return value denotes if the key was set or not.
+func (meta Metadata) TryGet(key string) (interface{}, bool) {
+	value, isSet := meta[key]
+	return value, isSet
+}
+
+// CopyValue stores a copy of the value of key "from" at key "to". The type
+// of the value is preserved. If "from" is not set, false is returned.
+func (meta Metadata) CopyValue(from string, to string) bool {
+	value, isSet := meta[from]
+	if isSet {
+		meta[to] = cloneMetadataValue(value)
+	}
+	return isSet
+}
+
+// SetInt stores an int64 value
+func (meta Metadata) SetInt(key string, value int64) {
+	meta[key] = value
+}
+
+// GetInt returns the value of key as int64. If the key is not set or cannot
+// be converted, 0 is returned.
+func (meta Metadata) GetInt(key string) int64 {
+	value, _ := meta.TryGetInt(key)
+	return value
+}
+
+// TryGetInt returns the value of key as int64. Byte values are parsed, float
+// values are truncated and time values are returned as unix nanoseconds.
+// The second return value is false if the key is not set or the value cannot
+// be converted.
+func (meta Metadata) TryGetInt(key string) (int64, bool) {
+	switch value := meta[key].(type) {
+	case int64:
+		return value, true
+	case float64:
+		return int64(value), true
+	case time.Time:
+		return value.UnixNano(), true
+	case []byte:
+		if intValue, err := strconv.ParseInt(string(value), 10, 64); err == nil {
+			return intValue, true
+		}
+		if floatValue, err := strconv.ParseFloat(string(value), 64); err == nil {
+			return int64(floatValue), true
+		}
+	}
+	return 0, false
+}
+
+// SetFloat stores a float64 value
+func (meta Metadata) SetFloat(key string, value float64) {
+	meta[key] = value
+}
+
+// GetFloat returns the value of key as float64. If the key is not set or
+// cannot be converted, 0 is returned.
+func (meta Metadata) GetFloat(key string) float64 {
+	value, _ := meta.TryGetFloat(key)
+	return value
+}
+
+// TryGetFloat returns the value of key as float64. Byte values are parsed.
+// The second return value is false if the key is not set or the value cannot
+// be converted.
+func (meta Metadata) TryGetFloat(key string) (float64, bool) {
+	switch value := meta[key].(type) {
+	case float64:
+		return value, true
+	case int64:
+		return float64(value), true
+	case []byte:
+		if floatValue, err := strconv.ParseFloat(string(value), 64); err == nil {
+			return floatValue, true
+		}
+	}
+	return 0, false
+}
+
+// SetBool stores a bool value
+func (meta Metadata) SetBool(key string, value bool) {
+	meta[key] = value
+}
+
+// GetBool returns the value of key as bool. If the key is not set or cannot
+// be converted, false is returned.
+func (meta Metadata) GetBool(key string) bool {
+	value, _ := meta.TryGetBool(key)
+	return value
+}
+
+// TryGetBool returns the value of key as bool. Byte values are parsed using
+// strconv.ParseBool, numeric values are true if not 0.
+// The second return value is false if the key is not set or the value cannot
+// be converted.
+func (meta Metadata) TryGetBool(key string) (bool, bool) {
+	switch value := meta[key].(type) {
+	case bool:
+		return value, true
+	case int64:
+		return value != 0, true
+	case float64:
+		return value != 0, true
+	case []byte:
+		if boolValue, err := strconv.ParseBool(string(value)); err == nil {
+			return boolValue, true
+		}
+	}
+	return false, false
+}
+
+// SetTime stores a time.Time value
+func (meta Metadata) SetTime(key string, value time.Time) {
+	meta[key] = value
+}
+
+// GetTime returns the value of key as time.Time. If the key is not set or
+// cannot be converted, the zero time is returned.
+func (meta Metadata) GetTime(key string) time.Time {
+	value, _ := meta.TryGetTime(key)
+	return value
+}
+
+// TryGetTime returns the value of key as time.Time. Byte values are parsed
+// using the RFC3339 format, integer values are treated as unix nanoseconds.
+// The second return value is false if the key is not set or the value cannot
+// be converted.
+func (meta Metadata) TryGetTime(key string) (time.Time, bool) {
+	switch value := meta[key].(type) {
+	case time.Time:
+		return value, true
+	case int64:
+		return time.Unix(0, value), true
+	case []byte:
+		if timeValue, err := time.Parse(time.RFC3339Nano, string(value)); err == nil {
+			return timeValue, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// SetMap stores a nested metadata map
+func (meta Metadata) SetMap(key string, value Metadata) {
+	meta[key] = value
+}
+
+// GetMap returns a nested metadata map. If the key is not set or does not
+// contain a map, nil is returned.
+func (meta Metadata) GetMap(key string) Metadata {
+	value, _ := meta.TryGetMap(key)
+	return value
+}
+
+// TryGetMap returns a nested metadata map. The second return value is false
+// if the key is not set or does not contain a map.
+func (meta Metadata) TryGetMap(key string) (Metadata, bool) {
+	value, isMap := meta[key].(Metadata)
+	return value, isMap
+}
+
 // Delete removes the given key from the map
 func (meta Metadata) Delete(key string) {
 	delete(meta, key)
@@ -70,9 +255,203 @@ func (meta Metadata) Delete(key string) {
 func (meta Metadata) Clone() (clone Metadata) {
 	clone = Metadata{}
 	for k, v := range meta {
-		vCopy := make([]byte, len(v))
-		copy(vCopy, v)
-		clone[k] = vCopy
+		clone[k] = cloneMetadataValue(v)
 	}
 	return
 }
+
+// MarshalJSON writes the metadata map as a JSON object. Byte values are
+// written as strings, time values are written in RFC3339 format.
+func (meta Metadata) MarshalJSON() ([]byte, error) {
+	keys := make([]string, 0, len(meta))
+	for key := range meta {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	buffer := bytes.NewBufferString("{")
+	for i, key := range keys {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+
+		keyJSON, _ := json.Marshal(key)
+		buffer.Write(keyJSON)
+		buffer.WriteByte(':')
+
+		var valueJSON []byte
+		var err error
+		switch value := meta[key].(type) {
+		case []byte:
+			valueJSON, err = json.Marshal(string(value))
+		case time.Time:
+			valueJSON, err = json.Marshal(value.Format(time.RFC3339Nano))
+		default:
+			valueJSON, err = json.Marshal(value)
+		}
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(valueJSON)
+	}
+	buffer.WriteByte('}')
+
+	return buffer.Bytes(), nil
+}
+
+func metadataValueToBytes(value interface{}) []byte {
+	switch value := value.(type) {
+	case []byte:
+		return value
+	case int64:
+		return strconv.AppendInt(nil, value, 10)
+	case float64:
+		return strconv.AppendFloat(nil, value, 'g', -1, 64)
+	case bool:
+		return strconv.AppendBool(nil, value)
+	case time.Time:
+		return []byte(value.Format(time.RFC3339Nano))
+	case Metadata:
+		data, _ := value.MarshalJSON()
+		return data
+	case nil:
+		return []byte{}
+	default:
+		return []byte(fmt.Sprint(value))
+	}
+}
+
+func normalizeMetadataValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case []byte, int64, float64, bool, time.Time, Metadata:
+		return value
+	case string:
+		return []byte(value)
+	case int:
+		return int64(value)
+	case int8:
+		return int64(value)
+	case int16:
+		return int64(value)
+	case int32:
+		return int64(value)
+	case uint:
+		return normalizeMetadataUint(uint64(value))
+	case uint8:
+		return int64(value)
+	case uint16:
+		return int64(value)
+	case uint32:
+		return int64(value)
+	case uint64:
+		return normalizeMetadataUint(value)
+	case float32:
+		return float64(value)
+	case map[string]interface{}:
+		nested := make(Metadata, len(value))
+		for k, v := range value {
+			nested[k] = normalizeMetadataValue(v)
+		}
+		return nested
+	default:
+		return []byte(fmt.Sprint(value))
+	}
+}
+
+// normalizeMetadataUint stores unsigned values as int64 if possible. Values
+// exceeding the int64 range are stored as decimal string to keep them exact.
+func normalizeMetadataUint(value uint64) interface{} {
+	if value > math.MaxInt64 {
+		return strconv.AppendUint(nil, value, 10)
+	}
+	return int64(value)
+}
+
+func cloneMetadataValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case []byte:
+		valueCopy := make([]byte, len(value))
+		copy(valueCopy, value)
+		return valueCopy
+	case Metadata:
+		return value.Clone()
+	default:
+		return value
+	}
+}
+
+// serialize splits the metadata map into a byte value map and a typed value
+// map as used by SerializedMessageData. Values not stored by one of the
+// setters (e.g. strings or ints assigned to the map directly) are normalized
+// first.
+func (meta Metadata) serialize() (map[string][]byte, map[string]*SerializedMetadataValue) {
+	var values map[string][]byte
+	var typedValues map[string]*SerializedMetadataValue
+
+	for key, value := range meta {
+		value = normalizeMetadataValue(value)
+		if data, isBytes := value.([]byte); isBytes {
+			if values == nil {
+				values = make(map[string][]byte)
+			}
+			values[key] = data
+			continue
+		}
+
+		if typedValues == nil {
+			typedValues = make(map[string]*SerializedMetadataValue)
+		}
+
+		serialized := new(SerializedMetadataValue)
+		switch value := value.(type) {
+		case int64:
+			serialized.Int = &value
+		case float64:
+			serialized.Float = &value
+		case bool:
+			serialized.Bool = &value
+		case time.Time:
+			nanos := value.UnixNano()
+			serialized.Time = &nanos
+		case Metadata:
+			serialized.Metadata, serialized.TypedMetadata = value.serialize()
+		}
+		typedValues[key] = serialized
+	}
+
+	return values, typedValues
+}
+
+// deserializeMetadata restores a metadata map from the maps written by
+// Metadata.serialize. If both maps are empty, nil is returned.
+func deserializeMetadata(values map[string][]byte, typedValues map[string]*SerializedMetadataValue) Metadata {
+	if len(values) == 0 && len(typedValues) == 0 {
+		return nil
+	}
+
+	meta := make(Metadata, len(values)+len(typedValues))
+	for key, value := range values {
+		meta[key] = value
+	}
+
+	for key, value := range typedValues {
+		switch {
+		case value.Int != nil:
+			meta[key] = value.GetInt()
+		case value.Float != nil:
+			meta[key] = value.GetFloat()
+		case value.Bool != nil:
+			meta[key] = value.GetBool()
+		case value.Time != nil:
+			meta[key] = time.Unix(0, value.GetTime())
+		default:
+			nested := deserializeMetadata(value.GetMetadata(), value.GetTypedMetadata())
+			if nested == nil {
+				nested = Metadata{}
+			}
+			meta[key] = nested
+		}
+	}
+
+	return meta
+}
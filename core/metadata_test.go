@@ -15,8 +15,10 @@
 package core
 
 import (
+	"math"
 	"github.com/trivago/tgo/ttesting"
 	"testing"
+	"time"
 )
 
 func TestMetadataSetGet(t *testing.T) {
@@ -58,3 +60,85 @@ func TestMetadataSetGet(t *testing.T) {
 	_, exists = meta2.TryGetValue("foo")
 	expect.True(exists)
 }
+
+func TestMetadataTyped(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	meta := make(Metadata)
+	timestamp := time.Date(2018, 5, 12, 10, 30, 0, 0, time.UTC)
+
+	meta.SetInt("int", 42)
+	meta.SetFloat("float", 0.5)
+	meta.SetBool("bool", true)
+	meta.SetTime("time", timestamp)
+	meta.SetMap("map", Metadata{"nested": []byte("value")})
+	meta.SetValue("intString", []byte("1337"))
+
+	// Typed access
+	expect.Equal(int64(42), meta.GetInt("int"))
+	expect.Equal(0.5, meta.GetFloat("float"))
+	expect.True(meta.GetBool("bool"))
+	expect.Equal(timestamp, meta.GetTime("time"))
+	expect.Equal("value", meta.GetMap("map").GetValueString("nested"))
+
+	// Byte values and other types are converted
+	expect.Equal(int64(1337), meta.GetInt("intString"))
+	expect.Equal(float64(42), meta.GetFloat("int"))
+
+	_, isInt := meta.TryGetInt("bool")
+	expect.False(isInt)
+
+	_, isMap := meta.TryGetMap("int")
+	expect.False(isMap)
+
+	// Byte based access stays compatible
+	expect.Equal("42", meta.GetValueString("int"))
+	expect.Equal("0.5", meta.GetValueString("float"))
+	expect.Equal("true", meta.GetValueString("bool"))
+	expect.Equal("2018-05-12T10:30:00Z", meta.GetValueString("time"))
+	expect.Equal(`{"nested":"value"}`, meta.GetValueString("map"))
+
+	// Generic setter normalizes types
+	meta.Set("normalized", 8)
+	expect.Equal(int64(8), meta["normalized"])
+	meta.Set("normalizedString", "text")
+	expect.Equal([]byte("text"), meta["normalizedString"])
+	meta.Set("normalizedUint", uint64(math.MaxUint64))
+	expect.Equal("18446744073709551615", meta.GetValueString("normalizedUint"))
+	meta.Set("normalizedSmallUint", uint64(7))
+	expect.Equal(int64(7), meta["normalizedSmallUint"])
+
+	// Clones and copies are deep
+	clone := meta.Clone()
+	clone.GetMap("map").SetValue("nested", []byte("changed"))
+	expect.Equal("value", meta.GetMap("map").GetValueString("nested"))
+
+	expect.True(meta.CopyValue("int", "intCopy"))
+	expect.Equal(int64(42), meta["intCopy"])
+	expect.False(meta.CopyValue("unknown", "unknownCopy"))
+}
+
+func TestMetadataSerializeNormalizes(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	// Values assigned to the map directly bypass the setters
+	meta := Metadata{
+		"string": "text",
+		"int":    7,
+		"list":   []string{"a", "b"},
+		"map":    map[string]interface{}{"nested": "value"},
+	}
+
+	msg := NewMessage(nil, []byte("payload"), meta, 1)
+	data, err := msg.Serialize()
+	expect.NoError(err)
+
+	restored, err := DeserializeMessage(data)
+	expect.NoError(err)
+
+	restoredMeta := restored.GetMetadata()
+	expect.Equal([]byte("text"), restoredMeta["string"])
+	expect.Equal(int64(7), restoredMeta["int"])
+	expect.Equal([]byte("[a b]"), restoredMeta["list"])
+	expect.Equal("value", restoredMeta.GetMap("map").GetValueString("nested"))
+}
@@ -104,6 +104,16 @@ func init() {
 	stateToMetric[PluginStateStopping] = MetricPluginsStopping
 	stateToMetric[PluginStateDead] = MetricPluginsDead
 
+	priorityMetricsRegistry := NewMetricsRegistry("priority")
+	for idx, name := range priorityToName {
+		metric := &PriorityMetric{
+			Enqueued:  metrics.NewRegisteredCounter(name+".enqueued", priorityMetricsRegistry),
+			Discarded: metrics.NewRegisteredCounter(name+".discarded", priorityMetricsRegistry),
+			Shed:      metrics.NewRegisteredCounter(name+".shed", priorityMetricsRegistry),
+		}
+		priorityToMetric[idx] = metric
+	}
+
 	metrics.RegisterRuntimeMemStats(MetricsRegistry)
 
 	// Populate constant values
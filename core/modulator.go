@@ -57,14 +57,18 @@ const (
 )
 
 // Modulate calls Modulate on every Modulator in the array and react according
-// to the definition of each ModulateResult state.
+// to the definition of each ModulateResult state. If a modulator changed the
+// message's document (see Message.StoreDocument) the payload is updated after
+// the last modulator has been called.
 func (modulators ModulatorArray) Modulate(msg *Message) ModulateResult {
 	action := ModulateResultContinue
 	for _, modulator := range modulators {
 		switch modRes := modulator.Modulate(msg); modRes {
 		case ModulateResultDiscard, ModulateResultFallback:
+			msg.data.syncPayload()
 			return modRes // ### return, break modulator calls ###
 		}
 	}
+	msg.data.syncPayload()
 	return action
 }
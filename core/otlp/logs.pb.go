@@ -0,0 +1,407 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: otlp/logs.proto
+
+package otlp
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type SeverityNumber int32
+
+const (
+	SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED SeverityNumber = 0
+	SeverityNumber_SEVERITY_NUMBER_TRACE       SeverityNumber = 1
+	SeverityNumber_SEVERITY_NUMBER_TRACE2      SeverityNumber = 2
+	SeverityNumber_SEVERITY_NUMBER_TRACE3      SeverityNumber = 3
+	SeverityNumber_SEVERITY_NUMBER_TRACE4      SeverityNumber = 4
+	SeverityNumber_SEVERITY_NUMBER_DEBUG       SeverityNumber = 5
+	SeverityNumber_SEVERITY_NUMBER_DEBUG2      SeverityNumber = 6
+	SeverityNumber_SEVERITY_NUMBER_DEBUG3      SeverityNumber = 7
+	SeverityNumber_SEVERITY_NUMBER_DEBUG4      SeverityNumber = 8
+	SeverityNumber_SEVERITY_NUMBER_INFO        SeverityNumber = 9
+	SeverityNumber_SEVERITY_NUMBER_INFO2       SeverityNumber = 10
+	SeverityNumber_SEVERITY_NUMBER_INFO3       SeverityNumber = 11
+	SeverityNumber_SEVERITY_NUMBER_INFO4       SeverityNumber = 12
+	SeverityNumber_SEVERITY_NUMBER_WARN        SeverityNumber = 13
+	SeverityNumber_SEVERITY_NUMBER_WARN2       SeverityNumber = 14
+	SeverityNumber_SEVERITY_NUMBER_WARN3       SeverityNumber = 15
+	SeverityNumber_SEVERITY_NUMBER_WARN4       SeverityNumber = 16
+	SeverityNumber_SEVERITY_NUMBER_ERROR       SeverityNumber = 17
+	SeverityNumber_SEVERITY_NUMBER_ERROR2      SeverityNumber = 18
+	SeverityNumber_SEVERITY_NUMBER_ERROR3      SeverityNumber = 19
+	SeverityNumber_SEVERITY_NUMBER_ERROR4      SeverityNumber = 20
+	SeverityNumber_SEVERITY_NUMBER_FATAL       SeverityNumber = 21
+	SeverityNumber_SEVERITY_NUMBER_FATAL2      SeverityNumber = 22
+	SeverityNumber_SEVERITY_NUMBER_FATAL3      SeverityNumber = 23
+	SeverityNumber_SEVERITY_NUMBER_FATAL4      SeverityNumber = 24
+)
+
+var SeverityNumber_name = map[int32]string{
+	0:  "SEVERITY_NUMBER_UNSPECIFIED",
+	1:  "SEVERITY_NUMBER_TRACE",
+	2:  "SEVERITY_NUMBER_TRACE2",
+	3:  "SEVERITY_NUMBER_TRACE3",
+	4:  "SEVERITY_NUMBER_TRACE4",
+	5:  "SEVERITY_NUMBER_DEBUG",
+	6:  "SEVERITY_NUMBER_DEBUG2",
+	7:  "SEVERITY_NUMBER_DEBUG3",
+	8:  "SEVERITY_NUMBER_DEBUG4",
+	9:  "SEVERITY_NUMBER_INFO",
+	10: "SEVERITY_NUMBER_INFO2",
+	11: "SEVERITY_NUMBER_INFO3",
+	12: "SEVERITY_NUMBER_INFO4",
+	13: "SEVERITY_NUMBER_WARN",
+	14: "SEVERITY_NUMBER_WARN2",
+	15: "SEVERITY_NUMBER_WARN3",
+	16: "SEVERITY_NUMBER_WARN4",
+	17: "SEVERITY_NUMBER_ERROR",
+	18: "SEVERITY_NUMBER_ERROR2",
+	19: "SEVERITY_NUMBER_ERROR3",
+	20: "SEVERITY_NUMBER_ERROR4",
+	21: "SEVERITY_NUMBER_FATAL",
+	22: "SEVERITY_NUMBER_FATAL2",
+	23: "SEVERITY_NUMBER_FATAL3",
+	24: "SEVERITY_NUMBER_FATAL4",
+}
+var SeverityNumber_value = map[string]int32{
+	"SEVERITY_NUMBER_UNSPECIFIED": 0,
+	"SEVERITY_NUMBER_TRACE":       1,
+	"SEVERITY_NUMBER_TRACE2":      2,
+	"SEVERITY_NUMBER_TRACE3":      3,
+	"SEVERITY_NUMBER_TRACE4":      4,
+	"SEVERITY_NUMBER_DEBUG":       5,
+	"SEVERITY_NUMBER_DEBUG2":      6,
+	"SEVERITY_NUMBER_DEBUG3":      7,
+	"SEVERITY_NUMBER_DEBUG4":      8,
+	"SEVERITY_NUMBER_INFO":        9,
+	"SEVERITY_NUMBER_INFO2":       10,
+	"SEVERITY_NUMBER_INFO3":       11,
+	"SEVERITY_NUMBER_INFO4":       12,
+	"SEVERITY_NUMBER_WARN":        13,
+	"SEVERITY_NUMBER_WARN2":       14,
+	"SEVERITY_NUMBER_WARN3":       15,
+	"SEVERITY_NUMBER_WARN4":       16,
+	"SEVERITY_NUMBER_ERROR":       17,
+	"SEVERITY_NUMBER_ERROR2":      18,
+	"SEVERITY_NUMBER_ERROR3":      19,
+	"SEVERITY_NUMBER_ERROR4":      20,
+	"SEVERITY_NUMBER_FATAL":       21,
+	"SEVERITY_NUMBER_FATAL2":      22,
+	"SEVERITY_NUMBER_FATAL3":      23,
+	"SEVERITY_NUMBER_FATAL4":      24,
+}
+
+func (x SeverityNumber) String() string {
+	return proto.EnumName(SeverityNumber_name, int32(x))
+}
+func (SeverityNumber) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_logs_e7341ff728e99687, []int{0}
+}
+
+type LogsData struct {
+	ResourceLogs         []*ResourceLogs `protobuf:"bytes,1,rep,name=resource_logs,json=resourceLogs,proto3" json:"resource_logs,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
+}
+
+func (m *LogsData) Reset()         { *m = LogsData{} }
+func (m *LogsData) String() string { return proto.CompactTextString(m) }
+func (*LogsData) ProtoMessage()    {}
+func (*LogsData) Descriptor() ([]byte, []int) {
+	return fileDescriptor_logs_e7341ff728e99687, []int{0}
+}
+func (m *LogsData) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_LogsData.Unmarshal(m, b)
+}
+func (m *LogsData) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_LogsData.Marshal(b, m, deterministic)
+}
+func (dst *LogsData) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_LogsData.Merge(dst, src)
+}
+func (m *LogsData) XXX_Size() int {
+	return xxx_messageInfo_LogsData.Size(m)
+}
+func (m *LogsData) XXX_DiscardUnknown() {
+	xxx_messageInfo_LogsData.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_LogsData proto.InternalMessageInfo
+
+func (m *LogsData) GetResourceLogs() []*ResourceLogs {
+	if m != nil {
+		return m.ResourceLogs
+	}
+	return nil
+}
+
+type ResourceLogs struct {
+	Resource             *Resource    `protobuf:"bytes,1,opt,name=resource,proto3" json:"resource,omitempty"`
+	ScopeLogs            []*ScopeLogs `protobuf:"bytes,2,rep,name=scope_logs,json=scopeLogs,proto3" json:"scope_logs,omitempty"`
+	SchemaUrl            string       `protobuf:"bytes,3,opt,name=schema_url,json=schemaUrl,proto3" json:"schema_url,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
+	XXX_unrecognized     []byte       `json:"-"`
+	XXX_sizecache        int32        `json:"-"`
+}
+
+func (m *ResourceLogs) Reset()         { *m = ResourceLogs{} }
+func (m *ResourceLogs) String() string { return proto.CompactTextString(m) }
+func (*ResourceLogs) ProtoMessage()    {}
+func (*ResourceLogs) Descriptor() ([]byte, []int) {
+	return fileDescriptor_logs_e7341ff728e99687, []int{1}
+}
+func (m *ResourceLogs) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ResourceLogs.Unmarshal(m, b)
+}
+func (m *ResourceLogs) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ResourceLogs.Marshal(b, m, deterministic)
+}
+func (dst *ResourceLogs) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ResourceLogs.Merge(dst, src)
+}
+func (m *ResourceLogs) XXX_Size() int {
+	return xxx_messageInfo_ResourceLogs.Size(m)
+}
+func (m *ResourceLogs) XXX_DiscardUnknown() {
+	xxx_messageInfo_ResourceLogs.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ResourceLogs proto.InternalMessageInfo
+
+func (m *ResourceLogs) GetResource() *Resource {
+	if m != nil {
+		return m.Resource
+	}
+	return nil
+}
+
+func (m *ResourceLogs) GetScopeLogs() []*ScopeLogs {
+	if m != nil {
+		return m.ScopeLogs
+	}
+	return nil
+}
+
+func (m *ResourceLogs) GetSchemaUrl() string {
+	if m != nil {
+		return m.SchemaUrl
+	}
+	return ""
+}
+
+type ScopeLogs struct {
+	Scope                *InstrumentationScope `protobuf:"bytes,1,opt,name=scope,proto3" json:"scope,omitempty"`
+	LogRecords           []*LogRecord          `protobuf:"bytes,2,rep,name=log_records,json=logRecords,proto3" json:"log_records,omitempty"`
+	SchemaUrl            string                `protobuf:"bytes,3,opt,name=schema_url,json=schemaUrl,proto3" json:"schema_url,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}              `json:"-"`
+	XXX_unrecognized     []byte                `json:"-"`
+	XXX_sizecache        int32                 `json:"-"`
+}
+
+func (m *ScopeLogs) Reset()         { *m = ScopeLogs{} }
+func (m *ScopeLogs) String() string { return proto.CompactTextString(m) }
+func (*ScopeLogs) ProtoMessage()    {}
+func (*ScopeLogs) Descriptor() ([]byte, []int) {
+	return fileDescriptor_logs_e7341ff728e99687, []int{2}
+}
+func (m *ScopeLogs) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ScopeLogs.Unmarshal(m, b)
+}
+func (m *ScopeLogs) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ScopeLogs.Marshal(b, m, deterministic)
+}
+func (dst *ScopeLogs) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ScopeLogs.Merge(dst, src)
+}
+func (m *ScopeLogs) XXX_Size() int {
+	return xxx_messageInfo_ScopeLogs.Size(m)
+}
+func (m *ScopeLogs) XXX_DiscardUnknown() {
+	xxx_messageInfo_ScopeLogs.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ScopeLogs proto.InternalMessageInfo
+
+func (m *ScopeLogs) GetScope() *InstrumentationScope {
+	if m != nil {
+		return m.Scope
+	}
+	return nil
+}
+
+func (m *ScopeLogs) GetLogRecords() []*LogRecord {
+	if m != nil {
+		return m.LogRecords
+	}
+	return nil
+}
+
+func (m *ScopeLogs) GetSchemaUrl() string {
+	if m != nil {
+		return m.SchemaUrl
+	}
+	return ""
+}
+
+type LogRecord struct {
+	TimeUnixNano           uint64         `protobuf:"fixed64,1,opt,name=time_unix_nano,json=timeUnixNano,proto3" json:"time_unix_nano,omitempty"`
+	ObservedTimeUnixNano   uint64         `protobuf:"fixed64,11,opt,name=observed_time_unix_nano,json=observedTimeUnixNano,proto3" json:"observed_time_unix_nano,omitempty"`
+	SeverityNumber         SeverityNumber `protobuf:"varint,2,opt,name=severity_number,json=severityNumber,proto3,enum=opentelemetry.proto.logs.v1.SeverityNumber" json:"severity_number,omitempty"`
+	SeverityText           string         `protobuf:"bytes,3,opt,name=severity_text,json=severityText,proto3" json:"severity_text,omitempty"`
+	Body                   *AnyValue      `protobuf:"bytes,5,opt,name=body,proto3" json:"body,omitempty"`
+	Attributes             []*KeyValue    `protobuf:"bytes,6,rep,name=attributes,proto3" json:"attributes,omitempty"`
+	DroppedAttributesCount uint32         `protobuf:"varint,7,opt,name=dropped_attributes_count,json=droppedAttributesCount,proto3" json:"dropped_attributes_count,omitempty"`
+	Flags                  uint32         `protobuf:"fixed32,8,opt,name=flags,proto3" json:"flags,omitempty"`
+	XXX_NoUnkeyedLiteral   struct{}       `json:"-"`
+	XXX_unrecognized       []byte         `json:"-"`
+	XXX_sizecache          int32          `json:"-"`
+}
+
+func (m *LogRecord) Reset()         { *m = LogRecord{} }
+func (m *LogRecord) String() string { return proto.CompactTextString(m) }
+func (*LogRecord) ProtoMessage()    {}
+func (*LogRecord) Descriptor() ([]byte, []int) {
+	return fileDescriptor_logs_e7341ff728e99687, []int{3}
+}
+func (m *LogRecord) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_LogRecord.Unmarshal(m, b)
+}
+func (m *LogRecord) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_LogRecord.Marshal(b, m, deterministic)
+}
+func (dst *LogRecord) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_LogRecord.Merge(dst, src)
+}
+func (m *LogRecord) XXX_Size() int {
+	return xxx_messageInfo_LogRecord.Size(m)
+}
+func (m *LogRecord) XXX_DiscardUnknown() {
+	xxx_messageInfo_LogRecord.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_LogRecord proto.InternalMessageInfo
+
+func (m *LogRecord) GetTimeUnixNano() uint64 {
+	if m != nil {
+		return m.TimeUnixNano
+	}
+	return 0
+}
+
+func (m *LogRecord) GetObservedTimeUnixNano() uint64 {
+	if m != nil {
+		return m.ObservedTimeUnixNano
+	}
+	return 0
+}
+
+func (m *LogRecord) GetSeverityNumber() SeverityNumber {
+	if m != nil {
+		return m.SeverityNumber
+	}
+	return SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED
+}
+
+func (m *LogRecord) GetSeverityText() string {
+	if m != nil {
+		return m.SeverityText
+	}
+	return ""
+}
+
+func (m *LogRecord) GetBody() *AnyValue {
+	if m != nil {
+		return m.Body
+	}
+	return nil
+}
+
+func (m *LogRecord) GetAttributes() []*KeyValue {
+	if m != nil {
+		return m.Attributes
+	}
+	return nil
+}
+
+func (m *LogRecord) GetDroppedAttributesCount() uint32 {
+	if m != nil {
+		return m.DroppedAttributesCount
+	}
+	return 0
+}
+
+func (m *LogRecord) GetFlags() uint32 {
+	if m != nil {
+		return m.Flags
+	}
+	return 0
+}
+
+func init() {
+	proto.RegisterType((*LogsData)(nil), "opentelemetry.proto.logs.v1.LogsData")
+	proto.RegisterType((*ResourceLogs)(nil), "opentelemetry.proto.logs.v1.ResourceLogs")
+	proto.RegisterType((*ScopeLogs)(nil), "opentelemetry.proto.logs.v1.ScopeLogs")
+	proto.RegisterType((*LogRecord)(nil), "opentelemetry.proto.logs.v1.LogRecord")
+	proto.RegisterEnum("opentelemetry.proto.logs.v1.SeverityNumber", SeverityNumber_name, SeverityNumber_value)
+}
+
+func init() { proto.RegisterFile("otlp/logs.proto", fileDescriptor_logs_e7341ff728e99687) }
+
+var fileDescriptor_logs_e7341ff728e99687 = []byte{
+	// 662 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x95, 0x5f, 0x6f, 0xd3, 0x30,
+	0x14, 0xc5, 0xc9, 0xba, 0x76, 0xed, 0xed, 0x9f, 0x79, 0x5e, 0xb7, 0x85, 0x4d, 0x88, 0x6a, 0x20,
+	0x28, 0x20, 0x15, 0x2d, 0x29, 0x12, 0x12, 0x4f, 0xdd, 0x96, 0x4d, 0x15, 0x23, 0x43, 0x5e, 0x3b,
+	0xc4, 0x5e, 0xa2, 0xb4, 0x35, 0xa5, 0x52, 0x12, 0x57, 0x8e, 0x53, 0xb5, 0x1f, 0x0d, 0x21, 0xf1,
+	0xc2, 0x17, 0x43, 0x71, 0xd3, 0xd2, 0x4d, 0xf1, 0xb6, 0x37, 0xfb, 0xfe, 0xee, 0x39, 0xf7, 0xd8,
+	0x56, 0x14, 0xd8, 0x64, 0xc2, 0x1b, 0xbf, 0xf7, 0xd8, 0x30, 0x6c, 0x8c, 0x39, 0x13, 0x0c, 0x1f,
+	0xb0, 0x31, 0x0d, 0x04, 0xf5, 0xa8, 0x4f, 0x05, 0x9f, 0xcd, 0x8b, 0x0d, 0xc9, 0x27, 0x47, 0xfb,
+	0x5b, 0xb2, 0xbb, 0xcf, 0x7c, 0x9f, 0x05, 0x73, 0xb4, 0xbf, 0x2d, 0x4b, 0x9c, 0x86, 0x2c, 0xe2,
+	0x7d, 0x3a, 0x2f, 0x1e, 0xde, 0x40, 0xfe, 0x82, 0x0d, 0xc3, 0x53, 0x57, 0xb8, 0xd8, 0x86, 0xf2,
+	0x82, 0x3a, 0xb1, 0x8f, 0xae, 0xd5, 0x32, 0xf5, 0xa2, 0xf1, 0xa6, 0x71, 0xcf, 0xa0, 0x06, 0x49,
+	0x14, 0xb1, 0x0b, 0x29, 0xf1, 0x95, 0xdd, 0xe1, 0x6f, 0x0d, 0x4a, 0xab, 0x18, 0x5b, 0x90, 0x5f,
+	0x34, 0xe8, 0x5a, 0x4d, 0x53, 0x7a, 0x2f, 0x33, 0xae, 0xf8, 0x93, 0xa5, 0x14, 0x5b, 0x00, 0x61,
+	0x9f, 0x8d, 0x93, 0x90, 0x6b, 0x32, 0xe4, 0xab, 0x7b, 0x43, 0x5e, 0xc5, 0xed, 0x32, 0x61, 0x21,
+	0x5c, 0x2c, 0xf1, 0xb3, 0xd8, 0xe6, 0x27, 0xf5, 0x5d, 0x27, 0xe2, 0x9e, 0x9e, 0xa9, 0x69, 0xf5,
+	0x02, 0x29, 0xcc, 0x2b, 0x5d, 0xee, 0x1d, 0xfe, 0xd1, 0xa0, 0xb0, 0xd4, 0xe1, 0x36, 0x64, 0xa5,
+	0x32, 0xc9, 0x6d, 0xa6, 0x8e, 0x4b, 0xae, 0x7b, 0x72, 0xd4, 0x68, 0x07, 0xa1, 0xe0, 0x91, 0x4f,
+	0x03, 0xe1, 0x8a, 0x11, 0x0b, 0xa4, 0x0f, 0x99, 0x3b, 0xe0, 0x73, 0x28, 0x7a, 0x6c, 0xe8, 0x70,
+	0xda, 0x67, 0x7c, 0xf0, 0xb8, 0xfc, 0x17, 0x6c, 0x48, 0x64, 0x3b, 0x01, 0x6f, 0xb1, 0x7c, 0xf0,
+	0x00, 0xbf, 0x32, 0x50, 0x58, 0x0a, 0xf1, 0x4b, 0xa8, 0x88, 0x91, 0x4f, 0x9d, 0x28, 0x18, 0x4d,
+	0x9d, 0xc0, 0x0d, 0x98, 0x3c, 0x49, 0x8e, 0x94, 0xe2, 0x6a, 0x37, 0x18, 0x4d, 0x6d, 0x37, 0x60,
+	0xf8, 0x03, 0xec, 0xb1, 0x5e, 0x48, 0xf9, 0x84, 0x0e, 0x9c, 0x3b, 0xed, 0x45, 0xd9, 0x5e, 0x5d,
+	0xe0, 0xce, 0xaa, 0xac, 0x03, 0x9b, 0x21, 0x9d, 0x50, 0x3e, 0x12, 0x33, 0x27, 0x88, 0xfc, 0x1e,
+	0xe5, 0xfa, 0x5a, 0x4d, 0xab, 0x57, 0x8c, 0x77, 0xf7, 0x3f, 0x4b, 0xa2, 0xb1, 0xa5, 0x84, 0x54,
+	0xc2, 0x5b, 0x7b, 0xfc, 0x02, 0xca, 0x4b, 0x57, 0x41, 0xa7, 0x22, 0x39, 0x62, 0x69, 0x51, 0xec,
+	0xd0, 0xa9, 0xc0, 0x9f, 0x60, 0xbd, 0xc7, 0x06, 0x33, 0x3d, 0x2b, 0xdf, 0xe5, 0xf5, 0x03, 0xef,
+	0xd2, 0x0a, 0x66, 0xd7, 0xae, 0x17, 0x51, 0x22, 0x45, 0xf8, 0x1c, 0xc0, 0x15, 0x82, 0x8f, 0x7a,
+	0x91, 0xa0, 0xa1, 0x9e, 0xab, 0x65, 0x1e, 0x61, 0xf1, 0x99, 0x26, 0x16, 0x2b, 0x52, 0xfc, 0x11,
+	0xf4, 0x01, 0x67, 0xe3, 0x31, 0x1d, 0x38, 0xff, 0xab, 0x4e, 0x9f, 0x45, 0x81, 0xd0, 0x37, 0x6a,
+	0x5a, 0xbd, 0x4c, 0x76, 0x13, 0xde, 0x5a, 0xe2, 0x93, 0x98, 0xe2, 0x2a, 0x64, 0x7f, 0x78, 0xee,
+	0x30, 0xd4, 0xf3, 0x35, 0xad, 0xbe, 0x41, 0xe6, 0x9b, 0xb7, 0x7f, 0xb3, 0x50, 0xb9, 0x7d, 0x3b,
+	0xf8, 0x39, 0x1c, 0x5c, 0x59, 0xd7, 0x16, 0x69, 0x77, 0xbe, 0x3b, 0x76, 0xf7, 0xcb, 0xb1, 0x45,
+	0x9c, 0xae, 0x7d, 0xf5, 0xd5, 0x3a, 0x69, 0x9f, 0xb5, 0xad, 0x53, 0xf4, 0x04, 0x3f, 0x85, 0x9d,
+	0xbb, 0x0d, 0x1d, 0xd2, 0x3a, 0xb1, 0x90, 0x86, 0xf7, 0x61, 0x37, 0x15, 0x19, 0x68, 0x4d, 0xc9,
+	0x4c, 0x94, 0x51, 0xb2, 0x26, 0x5a, 0x4f, 0x1b, 0x77, 0x6a, 0x1d, 0x77, 0xcf, 0x51, 0x36, 0x4d,
+	0x26, 0x91, 0x81, 0x72, 0x4a, 0x66, 0xa2, 0x0d, 0x25, 0x6b, 0xa2, 0x3c, 0xd6, 0xa1, 0x7a, 0x97,
+	0xb5, 0xed, 0xb3, 0x4b, 0x54, 0x48, 0x0b, 0x12, 0x13, 0x03, 0x81, 0x0a, 0x99, 0xa8, 0xa8, 0x42,
+	0x4d, 0x54, 0x4a, 0x1b, 0xf5, 0xad, 0x45, 0x6c, 0x54, 0x4e, 0x13, 0xc5, 0xc4, 0x40, 0x15, 0x15,
+	0x32, 0xd1, 0xa6, 0x0a, 0x35, 0x11, 0x4a, 0x43, 0x16, 0x21, 0x97, 0x04, 0x6d, 0xa5, 0x5d, 0x86,
+	0x44, 0x06, 0xc2, 0x4a, 0x66, 0xa2, 0x6d, 0x25, 0x6b, 0xa2, 0x6a, 0xda, 0xb8, 0xb3, 0x56, 0xa7,
+	0x75, 0x81, 0x76, 0xd2, 0x64, 0x12, 0x19, 0x68, 0x57, 0xc9, 0x4c, 0xb4, 0xa7, 0x64, 0x4d, 0xa4,
+	0x1f, 0xe7, 0x6e, 0xd6, 0xe3, 0x7f, 0x4e, 0x2f, 0x27, 0xbf, 0x21, 0xf3, 0xdf, 0x00, 0x83, 0x79,
+	0xaa, 0x48, 0xc3, 0x06, 0x00, 0x00,
+}
@@ -0,0 +1,251 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: otlp/logs_service.proto
+
+package otlp
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type ExportLogsServiceRequest struct {
+	ResourceLogs         []*ResourceLogs `protobuf:"bytes,1,rep,name=resource_logs,json=resourceLogs,proto3" json:"resource_logs,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
+}
+
+func (m *ExportLogsServiceRequest) Reset()         { *m = ExportLogsServiceRequest{} }
+func (m *ExportLogsServiceRequest) String() string { return proto.CompactTextString(m) }
+func (*ExportLogsServiceRequest) ProtoMessage()    {}
+func (*ExportLogsServiceRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_logs_service_83b9cb355563306b, []int{0}
+}
+func (m *ExportLogsServiceRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ExportLogsServiceRequest.Unmarshal(m, b)
+}
+func (m *ExportLogsServiceRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ExportLogsServiceRequest.Marshal(b, m, deterministic)
+}
+func (dst *ExportLogsServiceRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ExportLogsServiceRequest.Merge(dst, src)
+}
+func (m *ExportLogsServiceRequest) XXX_Size() int {
+	return xxx_messageInfo_ExportLogsServiceRequest.Size(m)
+}
+func (m *ExportLogsServiceRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ExportLogsServiceRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ExportLogsServiceRequest proto.InternalMessageInfo
+
+func (m *ExportLogsServiceRequest) GetResourceLogs() []*ResourceLogs {
+	if m != nil {
+		return m.ResourceLogs
+	}
+	return nil
+}
+
+type ExportLogsServiceResponse struct {
+	PartialSuccess       *ExportLogsPartialSuccess `protobuf:"bytes,1,opt,name=partial_success,json=partialSuccess,proto3" json:"partial_success,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}                  `json:"-"`
+	XXX_unrecognized     []byte                    `json:"-"`
+	XXX_sizecache        int32                     `json:"-"`
+}
+
+func (m *ExportLogsServiceResponse) Reset()         { *m = ExportLogsServiceResponse{} }
+func (m *ExportLogsServiceResponse) String() string { return proto.CompactTextString(m) }
+func (*ExportLogsServiceResponse) ProtoMessage()    {}
+func (*ExportLogsServiceResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_logs_service_83b9cb355563306b, []int{1}
+}
+func (m *ExportLogsServiceResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ExportLogsServiceResponse.Unmarshal(m, b)
+}
+func (m *ExportLogsServiceResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ExportLogsServiceResponse.Marshal(b, m, deterministic)
+}
+func (dst *ExportLogsServiceResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ExportLogsServiceResponse.Merge(dst, src)
+}
+func (m *ExportLogsServiceResponse) XXX_Size() int {
+	return xxx_messageInfo_ExportLogsServiceResponse.Size(m)
+}
+func (m *ExportLogsServiceResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ExportLogsServiceResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ExportLogsServiceResponse proto.InternalMessageInfo
+
+func (m *ExportLogsServiceResponse) GetPartialSuccess() *ExportLogsPartialSuccess {
+	if m != nil {
+		return m.PartialSuccess
+	}
+	return nil
+}
+
+type ExportLogsPartialSuccess struct {
+	RejectedLogRecords   int64    `protobuf:"varint,1,opt,name=rejected_log_records,json=rejectedLogRecords,proto3" json:"rejected_log_records,omitempty"`
+	ErrorMessage         string   `protobuf:"bytes,2,opt,name=error_message,json=errorMessage,proto3" json:"error_message,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ExportLogsPartialSuccess) Reset()         { *m = ExportLogsPartialSuccess{} }
+func (m *ExportLogsPartialSuccess) String() string { return proto.CompactTextString(m) }
+func (*ExportLogsPartialSuccess) ProtoMessage()    {}
+func (*ExportLogsPartialSuccess) Descriptor() ([]byte, []int) {
+	return fileDescriptor_logs_service_83b9cb355563306b, []int{2}
+}
+func (m *ExportLogsPartialSuccess) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ExportLogsPartialSuccess.Unmarshal(m, b)
+}
+func (m *ExportLogsPartialSuccess) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ExportLogsPartialSuccess.Marshal(b, m, deterministic)
+}
+func (dst *ExportLogsPartialSuccess) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ExportLogsPartialSuccess.Merge(dst, src)
+}
+func (m *ExportLogsPartialSuccess) XXX_Size() int {
+	return xxx_messageInfo_ExportLogsPartialSuccess.Size(m)
+}
+func (m *ExportLogsPartialSuccess) XXX_DiscardUnknown() {
+	xxx_messageInfo_ExportLogsPartialSuccess.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ExportLogsPartialSuccess proto.InternalMessageInfo
+
+func (m *ExportLogsPartialSuccess) GetRejectedLogRecords() int64 {
+	if m != nil {
+		return m.RejectedLogRecords
+	}
+	return 0
+}
+
+func (m *ExportLogsPartialSuccess) GetErrorMessage() string {
+	if m != nil {
+		return m.ErrorMessage
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterType((*ExportLogsServiceRequest)(nil), "opentelemetry.proto.collector.logs.v1.ExportLogsServiceRequest")
+	proto.RegisterType((*ExportLogsServiceResponse)(nil), "opentelemetry.proto.collector.logs.v1.ExportLogsServiceResponse")
+	proto.RegisterType((*ExportLogsPartialSuccess)(nil), "opentelemetry.proto.collector.logs.v1.ExportLogsPartialSuccess")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// LogsServiceClient is the client API for LogsService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type LogsServiceClient interface {
+	Export(ctx context.Context, in *ExportLogsServiceRequest, opts ...grpc.CallOption) (*ExportLogsServiceResponse, error)
+}
+
+type logsServiceClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewLogsServiceClient(cc *grpc.ClientConn) LogsServiceClient {
+	return &logsServiceClient{cc}
+}
+
+func (c *logsServiceClient) Export(ctx context.Context, in *ExportLogsServiceRequest, opts ...grpc.CallOption) (*ExportLogsServiceResponse, error) {
+	out := new(ExportLogsServiceResponse)
+	err := c.cc.Invoke(ctx, "/opentelemetry.proto.collector.logs.v1.LogsService/Export", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// LogsServiceServer is the server API for LogsService service.
+type LogsServiceServer interface {
+	Export(context.Context, *ExportLogsServiceRequest) (*ExportLogsServiceResponse, error)
+}
+
+func RegisterLogsServiceServer(s *grpc.Server, srv LogsServiceServer) {
+	s.RegisterService(&_LogsService_serviceDesc, srv)
+}
+
+func _LogsService_Export_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExportLogsServiceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogsServiceServer).Export(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/opentelemetry.proto.collector.logs.v1.LogsService/Export",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogsServiceServer).Export(ctx, req.(*ExportLogsServiceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _LogsService_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "opentelemetry.proto.collector.logs.v1.LogsService",
+	HandlerType: (*LogsServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Export",
+			Handler:    _LogsService_Export_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "otlp/logs_service.proto",
+}
+
+func init() {
+	proto.RegisterFile("otlp/logs_service.proto", fileDescriptor_logs_service_83b9cb355563306b)
+}
+
+var fileDescriptor_logs_service_83b9cb355563306b = []byte{
+	// 301 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x92, 0xcf, 0x4a, 0x03, 0x31,
+	0x10, 0xc6, 0x8d, 0x95, 0x82, 0x69, 0x6b, 0x21, 0x08, 0xae, 0x3d, 0x95, 0x15, 0xa1, 0x5e, 0xa2,
+	0xae, 0x0f, 0xa0, 0x08, 0xde, 0xaa, 0x48, 0x7a, 0xf3, 0xb2, 0xac, 0xe9, 0xb0, 0xb6, 0xa4, 0x9d,
+	0x74, 0x92, 0x2d, 0xfa, 0x00, 0x1e, 0x7d, 0x04, 0xdf, 0x55, 0xd2, 0x54, 0x6d, 0xa1, 0x82, 0x7a,
+	0x9c, 0x3f, 0xdf, 0xef, 0x9b, 0x6f, 0x37, 0xfc, 0x00, 0xbd, 0xb1, 0xa7, 0x06, 0x4b, 0x97, 0x3b,
+	0xa0, 0xf9, 0x48, 0x83, 0xb4, 0x84, 0x1e, 0xc5, 0x31, 0x5a, 0x98, 0x7a, 0x30, 0x30, 0x01, 0x4f,
+	0x2f, 0xb1, 0x29, 0x35, 0x1a, 0x03, 0xda, 0x23, 0xc9, 0xa0, 0x90, 0xf3, 0xf3, 0x4e, 0xfb, 0x4b,
+	0x1f, 0x57, 0xd2, 0x31, 0x4f, 0x6e, 0x9e, 0x2d, 0x92, 0xef, 0x63, 0xe9, 0x06, 0x11, 0xa9, 0x60,
+	0x56, 0x81, 0xf3, 0xe2, 0x8e, 0xb7, 0x08, 0x1c, 0x56, 0xa4, 0x21, 0x0f, 0x92, 0x84, 0x75, 0x6b,
+	0xbd, 0x46, 0x76, 0x22, 0x37, 0x79, 0x2d, 0x1d, 0xa4, 0x5a, 0x2a, 0x02, 0x4f, 0x35, 0x69, 0xa5,
+	0x4a, 0x5f, 0x19, 0x3f, 0xdc, 0x60, 0xe6, 0x2c, 0x4e, 0x1d, 0x88, 0x27, 0xde, 0xb6, 0x05, 0xf9,
+	0x51, 0x61, 0x72, 0x57, 0x69, 0x0d, 0x2e, 0xf8, 0xb1, 0x5e, 0x23, 0xbb, 0x94, 0xbf, 0xca, 0x26,
+	0xbf, 0xd1, 0xf7, 0x91, 0x33, 0x88, 0x18, 0xb5, 0x67, 0xd7, 0xea, 0x74, 0xc6, 0x93, 0x9f, 0x76,
+	0xc5, 0x19, 0xdf, 0x27, 0x18, 0x83, 0xf6, 0x30, 0x0c, 0x99, 0x73, 0x02, 0x8d, 0x34, 0x8c, 0xa7,
+	0xd4, 0x94, 0xf8, 0x9c, 0xf5, 0xb1, 0x54, 0x71, 0x22, 0x8e, 0x78, 0x0b, 0x88, 0x90, 0xf2, 0x09,
+	0x38, 0x57, 0x94, 0x90, 0x6c, 0x77, 0x59, 0x6f, 0x57, 0x35, 0x17, 0xcd, 0xdb, 0xd8, 0xcb, 0xde,
+	0x19, 0x6f, 0xac, 0x84, 0x16, 0x6f, 0x8c, 0xd7, 0xe3, 0x0d, 0xe2, 0xef, 0xf1, 0xd6, 0x7f, 0x53,
+	0xe7, 0xea, 0xff, 0x80, 0xf8, 0xe9, 0xd3, 0xad, 0xeb, 0xfa, 0xc3, 0x4e, 0x78, 0x19, 0x8f, 0xf5,
+	0x85, 0xf8, 0xe2, 0x63, 0x00, 0x9f, 0x9b, 0xec, 0x3b, 0x68, 0x02, 0x00, 0x00,
+}
@@ -0,0 +1,1017 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: otlp/metrics.proto
+
+package otlp
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type AggregationTemporality int32
+
+const (
+	AggregationTemporality_AGGREGATION_TEMPORALITY_UNSPECIFIED AggregationTemporality = 0
+	AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA       AggregationTemporality = 1
+	AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE  AggregationTemporality = 2
+)
+
+var AggregationTemporality_name = map[int32]string{
+	0: "AGGREGATION_TEMPORALITY_UNSPECIFIED",
+	1: "AGGREGATION_TEMPORALITY_DELTA",
+	2: "AGGREGATION_TEMPORALITY_CUMULATIVE",
+}
+var AggregationTemporality_value = map[string]int32{
+	"AGGREGATION_TEMPORALITY_UNSPECIFIED": 0,
+	"AGGREGATION_TEMPORALITY_DELTA":       1,
+	"AGGREGATION_TEMPORALITY_CUMULATIVE":  2,
+}
+
+func (x AggregationTemporality) String() string {
+	return proto.EnumName(AggregationTemporality_name, int32(x))
+}
+func (AggregationTemporality) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_metrics_7c6fb670203b3320, []int{0}
+}
+
+type MetricsData struct {
+	ResourceMetrics      []*ResourceMetrics `protobuf:"bytes,1,rep,name=resource_metrics,json=resourceMetrics,proto3" json:"resource_metrics,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
+	XXX_unrecognized     []byte             `json:"-"`
+	XXX_sizecache        int32              `json:"-"`
+}
+
+func (m *MetricsData) Reset()         { *m = MetricsData{} }
+func (m *MetricsData) String() string { return proto.CompactTextString(m) }
+func (*MetricsData) ProtoMessage()    {}
+func (*MetricsData) Descriptor() ([]byte, []int) {
+	return fileDescriptor_metrics_7c6fb670203b3320, []int{0}
+}
+func (m *MetricsData) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_MetricsData.Unmarshal(m, b)
+}
+func (m *MetricsData) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_MetricsData.Marshal(b, m, deterministic)
+}
+func (dst *MetricsData) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MetricsData.Merge(dst, src)
+}
+func (m *MetricsData) XXX_Size() int {
+	return xxx_messageInfo_MetricsData.Size(m)
+}
+func (m *MetricsData) XXX_DiscardUnknown() {
+	xxx_messageInfo_MetricsData.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MetricsData proto.InternalMessageInfo
+
+func (m *MetricsData) GetResourceMetrics() []*ResourceMetrics {
+	if m != nil {
+		return m.ResourceMetrics
+	}
+	return nil
+}
+
+type ResourceMetrics struct {
+	Resource             *Resource       `protobuf:"bytes,1,opt,name=resource,proto3" json:"resource,omitempty"`
+	ScopeMetrics         []*ScopeMetrics `protobuf:"bytes,2,rep,name=scope_metrics,json=scopeMetrics,proto3" json:"scope_metrics,omitempty"`
+	SchemaUrl            string          `protobuf:"bytes,3,opt,name=schema_url,json=schemaUrl,proto3" json:"schema_url,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
+}
+
+func (m *ResourceMetrics) Reset()         { *m = ResourceMetrics{} }
+func (m *ResourceMetrics) String() string { return proto.CompactTextString(m) }
+func (*ResourceMetrics) ProtoMessage()    {}
+func (*ResourceMetrics) Descriptor() ([]byte, []int) {
+	return fileDescriptor_metrics_7c6fb670203b3320, []int{1}
+}
+func (m *ResourceMetrics) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ResourceMetrics.Unmarshal(m, b)
+}
+func (m *ResourceMetrics) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ResourceMetrics.Marshal(b, m, deterministic)
+}
+func (dst *ResourceMetrics) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ResourceMetrics.Merge(dst, src)
+}
+func (m *ResourceMetrics) XXX_Size() int {
+	return xxx_messageInfo_ResourceMetrics.Size(m)
+}
+func (m *ResourceMetrics) XXX_DiscardUnknown() {
+	xxx_messageInfo_ResourceMetrics.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ResourceMetrics proto.InternalMessageInfo
+
+func (m *ResourceMetrics) GetResource() *Resource {
+	if m != nil {
+		return m.Resource
+	}
+	return nil
+}
+
+func (m *ResourceMetrics) GetScopeMetrics() []*ScopeMetrics {
+	if m != nil {
+		return m.ScopeMetrics
+	}
+	return nil
+}
+
+func (m *ResourceMetrics) GetSchemaUrl() string {
+	if m != nil {
+		return m.SchemaUrl
+	}
+	return ""
+}
+
+type ScopeMetrics struct {
+	Scope                *InstrumentationScope `protobuf:"bytes,1,opt,name=scope,proto3" json:"scope,omitempty"`
+	Metrics              []*Metric             `protobuf:"bytes,2,rep,name=metrics,proto3" json:"metrics,omitempty"`
+	SchemaUrl            string                `protobuf:"bytes,3,opt,name=schema_url,json=schemaUrl,proto3" json:"schema_url,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}              `json:"-"`
+	XXX_unrecognized     []byte                `json:"-"`
+	XXX_sizecache        int32                 `json:"-"`
+}
+
+func (m *ScopeMetrics) Reset()         { *m = ScopeMetrics{} }
+func (m *ScopeMetrics) String() string { return proto.CompactTextString(m) }
+func (*ScopeMetrics) ProtoMessage()    {}
+func (*ScopeMetrics) Descriptor() ([]byte, []int) {
+	return fileDescriptor_metrics_7c6fb670203b3320, []int{2}
+}
+func (m *ScopeMetrics) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ScopeMetrics.Unmarshal(m, b)
+}
+func (m *ScopeMetrics) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ScopeMetrics.Marshal(b, m, deterministic)
+}
+func (dst *ScopeMetrics) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ScopeMetrics.Merge(dst, src)
+}
+func (m *ScopeMetrics) XXX_Size() int {
+	return xxx_messageInfo_ScopeMetrics.Size(m)
+}
+func (m *ScopeMetrics) XXX_DiscardUnknown() {
+	xxx_messageInfo_ScopeMetrics.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ScopeMetrics proto.InternalMessageInfo
+
+func (m *ScopeMetrics) GetScope() *InstrumentationScope {
+	if m != nil {
+		return m.Scope
+	}
+	return nil
+}
+
+func (m *ScopeMetrics) GetMetrics() []*Metric {
+	if m != nil {
+		return m.Metrics
+	}
+	return nil
+}
+
+func (m *ScopeMetrics) GetSchemaUrl() string {
+	if m != nil {
+		return m.SchemaUrl
+	}
+	return ""
+}
+
+type Metric struct {
+	Name        string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Description string `protobuf:"bytes,2,opt,name=description,proto3" json:"description,omitempty"`
+	Unit        string `protobuf:"bytes,3,opt,name=unit,proto3" json:"unit,omitempty"`
+	// Types that are valid to be assigned to Data:
+	//	*Metric_Gauge
+	//	*Metric_Sum
+	//	*Metric_Histogram
+	//	*Metric_Summary
+	Data                 isMetric_Data `protobuf_oneof:"data"`
+	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
+	XXX_unrecognized     []byte        `json:"-"`
+	XXX_sizecache        int32         `json:"-"`
+}
+
+func (m *Metric) Reset()         { *m = Metric{} }
+func (m *Metric) String() string { return proto.CompactTextString(m) }
+func (*Metric) ProtoMessage()    {}
+func (*Metric) Descriptor() ([]byte, []int) {
+	return fileDescriptor_metrics_7c6fb670203b3320, []int{3}
+}
+func (m *Metric) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Metric.Unmarshal(m, b)
+}
+func (m *Metric) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Metric.Marshal(b, m, deterministic)
+}
+func (dst *Metric) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Metric.Merge(dst, src)
+}
+func (m *Metric) XXX_Size() int {
+	return xxx_messageInfo_Metric.Size(m)
+}
+func (m *Metric) XXX_DiscardUnknown() {
+	xxx_messageInfo_Metric.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Metric proto.InternalMessageInfo
+
+func (m *Metric) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Metric) GetDescription() string {
+	if m != nil {
+		return m.Description
+	}
+	return ""
+}
+
+func (m *Metric) GetUnit() string {
+	if m != nil {
+		return m.Unit
+	}
+	return ""
+}
+
+type isMetric_Data interface {
+	isMetric_Data()
+}
+
+type Metric_Gauge struct {
+	Gauge *Gauge `protobuf:"bytes,5,opt,name=gauge,proto3,oneof"`
+}
+
+type Metric_Sum struct {
+	Sum *Sum `protobuf:"bytes,7,opt,name=sum,proto3,oneof"`
+}
+
+type Metric_Histogram struct {
+	Histogram *Histogram `protobuf:"bytes,9,opt,name=histogram,proto3,oneof"`
+}
+
+type Metric_Summary struct {
+	Summary *Summary `protobuf:"bytes,11,opt,name=summary,proto3,oneof"`
+}
+
+func (*Metric_Gauge) isMetric_Data() {}
+
+func (*Metric_Sum) isMetric_Data() {}
+
+func (*Metric_Histogram) isMetric_Data() {}
+
+func (*Metric_Summary) isMetric_Data() {}
+
+func (m *Metric) GetData() isMetric_Data {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func (m *Metric) GetGauge() *Gauge {
+	if x, ok := m.GetData().(*Metric_Gauge); ok {
+		return x.Gauge
+	}
+	return nil
+}
+
+func (m *Metric) GetSum() *Sum {
+	if x, ok := m.GetData().(*Metric_Sum); ok {
+		return x.Sum
+	}
+	return nil
+}
+
+func (m *Metric) GetHistogram() *Histogram {
+	if x, ok := m.GetData().(*Metric_Histogram); ok {
+		return x.Histogram
+	}
+	return nil
+}
+
+func (m *Metric) GetSummary() *Summary {
+	if x, ok := m.GetData().(*Metric_Summary); ok {
+		return x.Summary
+	}
+	return nil
+}
+
+// XXX_OneofFuncs is for the internal use of the proto package.
+func (*Metric) XXX_OneofFuncs() (func(msg proto.Message, b *proto.Buffer) error, func(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error), func(msg proto.Message) (n int), []interface{}) {
+	return _Metric_OneofMarshaler, _Metric_OneofUnmarshaler, _Metric_OneofSizer, []interface{}{
+		(*Metric_Gauge)(nil),
+		(*Metric_Sum)(nil),
+		(*Metric_Histogram)(nil),
+		(*Metric_Summary)(nil),
+	}
+}
+
+func _Metric_OneofMarshaler(msg proto.Message, b *proto.Buffer) error {
+	m := msg.(*Metric)
+	// data
+	switch x := m.Data.(type) {
+	case *Metric_Gauge:
+		b.EncodeVarint(5<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Gauge); err != nil {
+			return err
+		}
+	case *Metric_Sum:
+		b.EncodeVarint(7<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Sum); err != nil {
+			return err
+		}
+	case *Metric_Histogram:
+		b.EncodeVarint(9<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Histogram); err != nil {
+			return err
+		}
+	case *Metric_Summary:
+		b.EncodeVarint(11<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Summary); err != nil {
+			return err
+		}
+	case nil:
+	default:
+		return fmt.Errorf("Metric.Data has unexpected type %T", x)
+	}
+	return nil
+}
+
+func _Metric_OneofUnmarshaler(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error) {
+	m := msg.(*Metric)
+	switch tag {
+	case 5: // data.gauge
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(Gauge)
+		err := b.DecodeMessage(msg)
+		m.Data = &Metric_Gauge{msg}
+		return true, err
+	case 7: // data.sum
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(Sum)
+		err := b.DecodeMessage(msg)
+		m.Data = &Metric_Sum{msg}
+		return true, err
+	case 9: // data.histogram
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(Histogram)
+		err := b.DecodeMessage(msg)
+		m.Data = &Metric_Histogram{msg}
+		return true, err
+	case 11: // data.summary
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(Summary)
+		err := b.DecodeMessage(msg)
+		m.Data = &Metric_Summary{msg}
+		return true, err
+	default:
+		return false, nil
+	}
+}
+
+func _Metric_OneofSizer(msg proto.Message) (n int) {
+	m := msg.(*Metric)
+	// data
+	switch x := m.Data.(type) {
+	case *Metric_Gauge:
+		s := proto.Size(x.Gauge)
+		n += 1 // tag and wire
+		n += proto.SizeVarint(uint64(s))
+		n += s
+	case *Metric_Sum:
+		s := proto.Size(x.Sum)
+		n += 1 // tag and wire
+		n += proto.SizeVarint(uint64(s))
+		n += s
+	case *Metric_Histogram:
+		s := proto.Size(x.Histogram)
+		n += 1 // tag and wire
+		n += proto.SizeVarint(uint64(s))
+		n += s
+	case *Metric_Summary:
+		s := proto.Size(x.Summary)
+		n += 1 // tag and wire
+		n += proto.SizeVarint(uint64(s))
+		n += s
+	case nil:
+	default:
+		panic(fmt.Sprintf("proto: unexpected type %T in oneof", x))
+	}
+	return n
+}
+
+type Gauge struct {
+	DataPoints           []*NumberDataPoint `protobuf:"bytes,1,rep,name=data_points,json=dataPoints,proto3" json:"data_points,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
+	XXX_unrecognized     []byte             `json:"-"`
+	XXX_sizecache        int32              `json:"-"`
+}
+
+func (m *Gauge) Reset()         { *m = Gauge{} }
+func (m *Gauge) String() string { return proto.CompactTextString(m) }
+func (*Gauge) ProtoMessage()    {}
+func (*Gauge) Descriptor() ([]byte, []int) {
+	return fileDescriptor_metrics_7c6fb670203b3320, []int{4}
+}
+func (m *Gauge) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Gauge.Unmarshal(m, b)
+}
+func (m *Gauge) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Gauge.Marshal(b, m, deterministic)
+}
+func (dst *Gauge) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Gauge.Merge(dst, src)
+}
+func (m *Gauge) XXX_Size() int {
+	return xxx_messageInfo_Gauge.Size(m)
+}
+func (m *Gauge) XXX_DiscardUnknown() {
+	xxx_messageInfo_Gauge.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Gauge proto.InternalMessageInfo
+
+func (m *Gauge) GetDataPoints() []*NumberDataPoint {
+	if m != nil {
+		return m.DataPoints
+	}
+	return nil
+}
+
+type Sum struct {
+	DataPoints             []*NumberDataPoint     `protobuf:"bytes,1,rep,name=data_points,json=dataPoints,proto3" json:"data_points,omitempty"`
+	AggregationTemporality AggregationTemporality `protobuf:"varint,2,opt,name=aggregation_temporality,json=aggregationTemporality,proto3,enum=opentelemetry.proto.metrics.v1.AggregationTemporality" json:"aggregation_temporality,omitempty"`
+	IsMonotonic            bool                   `protobuf:"varint,3,opt,name=is_monotonic,json=isMonotonic,proto3" json:"is_monotonic,omitempty"`
+	XXX_NoUnkeyedLiteral   struct{}               `json:"-"`
+	XXX_unrecognized       []byte                 `json:"-"`
+	XXX_sizecache          int32                  `json:"-"`
+}
+
+func (m *Sum) Reset()         { *m = Sum{} }
+func (m *Sum) String() string { return proto.CompactTextString(m) }
+func (*Sum) ProtoMessage()    {}
+func (*Sum) Descriptor() ([]byte, []int) {
+	return fileDescriptor_metrics_7c6fb670203b3320, []int{5}
+}
+func (m *Sum) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Sum.Unmarshal(m, b)
+}
+func (m *Sum) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Sum.Marshal(b, m, deterministic)
+}
+func (dst *Sum) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Sum.Merge(dst, src)
+}
+func (m *Sum) XXX_Size() int {
+	return xxx_messageInfo_Sum.Size(m)
+}
+func (m *Sum) XXX_DiscardUnknown() {
+	xxx_messageInfo_Sum.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Sum proto.InternalMessageInfo
+
+func (m *Sum) GetDataPoints() []*NumberDataPoint {
+	if m != nil {
+		return m.DataPoints
+	}
+	return nil
+}
+
+func (m *Sum) GetAggregationTemporality() AggregationTemporality {
+	if m != nil {
+		return m.AggregationTemporality
+	}
+	return AggregationTemporality_AGGREGATION_TEMPORALITY_UNSPECIFIED
+}
+
+func (m *Sum) GetIsMonotonic() bool {
+	if m != nil {
+		return m.IsMonotonic
+	}
+	return false
+}
+
+type Histogram struct {
+	DataPoints             []*HistogramDataPoint  `protobuf:"bytes,1,rep,name=data_points,json=dataPoints,proto3" json:"data_points,omitempty"`
+	AggregationTemporality AggregationTemporality `protobuf:"varint,2,opt,name=aggregation_temporality,json=aggregationTemporality,proto3,enum=opentelemetry.proto.metrics.v1.AggregationTemporality" json:"aggregation_temporality,omitempty"`
+	XXX_NoUnkeyedLiteral   struct{}               `json:"-"`
+	XXX_unrecognized       []byte                 `json:"-"`
+	XXX_sizecache          int32                  `json:"-"`
+}
+
+func (m *Histogram) Reset()         { *m = Histogram{} }
+func (m *Histogram) String() string { return proto.CompactTextString(m) }
+func (*Histogram) ProtoMessage()    {}
+func (*Histogram) Descriptor() ([]byte, []int) {
+	return fileDescriptor_metrics_7c6fb670203b3320, []int{6}
+}
+func (m *Histogram) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Histogram.Unmarshal(m, b)
+}
+func (m *Histogram) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Histogram.Marshal(b, m, deterministic)
+}
+func (dst *Histogram) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Histogram.Merge(dst, src)
+}
+func (m *Histogram) XXX_Size() int {
+	return xxx_messageInfo_Histogram.Size(m)
+}
+func (m *Histogram) XXX_DiscardUnknown() {
+	xxx_messageInfo_Histogram.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Histogram proto.InternalMessageInfo
+
+func (m *Histogram) GetDataPoints() []*HistogramDataPoint {
+	if m != nil {
+		return m.DataPoints
+	}
+	return nil
+}
+
+func (m *Histogram) GetAggregationTemporality() AggregationTemporality {
+	if m != nil {
+		return m.AggregationTemporality
+	}
+	return AggregationTemporality_AGGREGATION_TEMPORALITY_UNSPECIFIED
+}
+
+type Summary struct {
+	DataPoints           []*SummaryDataPoint `protobuf:"bytes,1,rep,name=data_points,json=dataPoints,proto3" json:"data_points,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}            `json:"-"`
+	XXX_unrecognized     []byte              `json:"-"`
+	XXX_sizecache        int32               `json:"-"`
+}
+
+func (m *Summary) Reset()         { *m = Summary{} }
+func (m *Summary) String() string { return proto.CompactTextString(m) }
+func (*Summary) ProtoMessage()    {}
+func (*Summary) Descriptor() ([]byte, []int) {
+	return fileDescriptor_metrics_7c6fb670203b3320, []int{7}
+}
+func (m *Summary) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Summary.Unmarshal(m, b)
+}
+func (m *Summary) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Summary.Marshal(b, m, deterministic)
+}
+func (dst *Summary) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Summary.Merge(dst, src)
+}
+func (m *Summary) XXX_Size() int {
+	return xxx_messageInfo_Summary.Size(m)
+}
+func (m *Summary) XXX_DiscardUnknown() {
+	xxx_messageInfo_Summary.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Summary proto.InternalMessageInfo
+
+func (m *Summary) GetDataPoints() []*SummaryDataPoint {
+	if m != nil {
+		return m.DataPoints
+	}
+	return nil
+}
+
+type NumberDataPoint struct {
+	Attributes        []*KeyValue `protobuf:"bytes,7,rep,name=attributes,proto3" json:"attributes,omitempty"`
+	StartTimeUnixNano uint64      `protobuf:"fixed64,2,opt,name=start_time_unix_nano,json=startTimeUnixNano,proto3" json:"start_time_unix_nano,omitempty"`
+	TimeUnixNano      uint64      `protobuf:"fixed64,3,opt,name=time_unix_nano,json=timeUnixNano,proto3" json:"time_unix_nano,omitempty"`
+	// Types that are valid to be assigned to Value:
+	//	*NumberDataPoint_AsDouble
+	//	*NumberDataPoint_AsInt
+	Value                isNumberDataPoint_Value `protobuf_oneof:"value"`
+	Flags                uint32                  `protobuf:"varint,8,opt,name=flags,proto3" json:"flags,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}                `json:"-"`
+	XXX_unrecognized     []byte                  `json:"-"`
+	XXX_sizecache        int32                   `json:"-"`
+}
+
+func (m *NumberDataPoint) Reset()         { *m = NumberDataPoint{} }
+func (m *NumberDataPoint) String() string { return proto.CompactTextString(m) }
+func (*NumberDataPoint) ProtoMessage()    {}
+func (*NumberDataPoint) Descriptor() ([]byte, []int) {
+	return fileDescriptor_metrics_7c6fb670203b3320, []int{8}
+}
+func (m *NumberDataPoint) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_NumberDataPoint.Unmarshal(m, b)
+}
+func (m *NumberDataPoint) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_NumberDataPoint.Marshal(b, m, deterministic)
+}
+func (dst *NumberDataPoint) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_NumberDataPoint.Merge(dst, src)
+}
+func (m *NumberDataPoint) XXX_Size() int {
+	return xxx_messageInfo_NumberDataPoint.Size(m)
+}
+func (m *NumberDataPoint) XXX_DiscardUnknown() {
+	xxx_messageInfo_NumberDataPoint.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_NumberDataPoint proto.InternalMessageInfo
+
+func (m *NumberDataPoint) GetAttributes() []*KeyValue {
+	if m != nil {
+		return m.Attributes
+	}
+	return nil
+}
+
+func (m *NumberDataPoint) GetStartTimeUnixNano() uint64 {
+	if m != nil {
+		return m.StartTimeUnixNano
+	}
+	return 0
+}
+
+func (m *NumberDataPoint) GetTimeUnixNano() uint64 {
+	if m != nil {
+		return m.TimeUnixNano
+	}
+	return 0
+}
+
+type isNumberDataPoint_Value interface {
+	isNumberDataPoint_Value()
+}
+
+type NumberDataPoint_AsDouble struct {
+	AsDouble float64 `protobuf:"fixed64,4,opt,name=as_double,json=asDouble,proto3,oneof"`
+}
+
+type NumberDataPoint_AsInt struct {
+	AsInt int64 `protobuf:"fixed64,6,opt,name=as_int,json=asInt,proto3,oneof"`
+}
+
+func (*NumberDataPoint_AsDouble) isNumberDataPoint_Value() {}
+
+func (*NumberDataPoint_AsInt) isNumberDataPoint_Value() {}
+
+func (m *NumberDataPoint) GetValue() isNumberDataPoint_Value {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
+func (m *NumberDataPoint) GetAsDouble() float64 {
+	if x, ok := m.GetValue().(*NumberDataPoint_AsDouble); ok {
+		return x.AsDouble
+	}
+	return 0
+}
+
+func (m *NumberDataPoint) GetAsInt() int64 {
+	if x, ok := m.GetValue().(*NumberDataPoint_AsInt); ok {
+		return x.AsInt
+	}
+	return 0
+}
+
+func (m *NumberDataPoint) GetFlags() uint32 {
+	if m != nil {
+		return m.Flags
+	}
+	return 0
+}
+
+// XXX_OneofFuncs is for the internal use of the proto package.
+func (*NumberDataPoint) XXX_OneofFuncs() (func(msg proto.Message, b *proto.Buffer) error, func(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error), func(msg proto.Message) (n int), []interface{}) {
+	return _NumberDataPoint_OneofMarshaler, _NumberDataPoint_OneofUnmarshaler, _NumberDataPoint_OneofSizer, []interface{}{
+		(*NumberDataPoint_AsDouble)(nil),
+		(*NumberDataPoint_AsInt)(nil),
+	}
+}
+
+func _NumberDataPoint_OneofMarshaler(msg proto.Message, b *proto.Buffer) error {
+	m := msg.(*NumberDataPoint)
+	// value
+	switch x := m.Value.(type) {
+	case *NumberDataPoint_AsDouble:
+		b.EncodeVarint(4<<3 | proto.WireFixed64)
+		b.EncodeFixed64(math.Float64bits(x.AsDouble))
+	case *NumberDataPoint_AsInt:
+		b.EncodeVarint(6<<3 | proto.WireFixed64)
+		b.EncodeFixed64(uint64(x.AsInt))
+	case nil:
+	default:
+		return fmt.Errorf("NumberDataPoint.Value has unexpected type %T", x)
+	}
+	return nil
+}
+
+func _NumberDataPoint_OneofUnmarshaler(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error) {
+	m := msg.(*NumberDataPoint)
+	switch tag {
+	case 4: // value.as_double
+		if wire != proto.WireFixed64 {
+			return true, proto.ErrInternalBadWireType
+		}
+		x, err := b.DecodeFixed64()
+		m.Value = &NumberDataPoint_AsDouble{math.Float64frombits(x)}
+		return true, err
+	case 6: // value.as_int
+		if wire != proto.WireFixed64 {
+			return true, proto.ErrInternalBadWireType
+		}
+		x, err := b.DecodeFixed64()
+		m.Value = &NumberDataPoint_AsInt{int64(x)}
+		return true, err
+	default:
+		return false, nil
+	}
+}
+
+func _NumberDataPoint_OneofSizer(msg proto.Message) (n int) {
+	m := msg.(*NumberDataPoint)
+	// value
+	switch x := m.Value.(type) {
+	case *NumberDataPoint_AsDouble:
+		n += 1 // tag and wire
+		n += 8
+	case *NumberDataPoint_AsInt:
+		n += 1 // tag and wire
+		n += 8
+	case nil:
+	default:
+		panic(fmt.Sprintf("proto: unexpected type %T in oneof", x))
+	}
+	return n
+}
+
+type HistogramDataPoint struct {
+	Attributes           []*KeyValue `protobuf:"bytes,9,rep,name=attributes,proto3" json:"attributes,omitempty"`
+	StartTimeUnixNano    uint64      `protobuf:"fixed64,2,opt,name=start_time_unix_nano,json=startTimeUnixNano,proto3" json:"start_time_unix_nano,omitempty"`
+	TimeUnixNano         uint64      `protobuf:"fixed64,3,opt,name=time_unix_nano,json=timeUnixNano,proto3" json:"time_unix_nano,omitempty"`
+	Count                uint64      `protobuf:"fixed64,4,opt,name=count,proto3" json:"count,omitempty"`
+	Sum                  float64     `protobuf:"fixed64,5,opt,name=sum,proto3" json:"sum,omitempty"`
+	BucketCounts         []uint64    `protobuf:"fixed64,6,rep,packed,name=bucket_counts,json=bucketCounts,proto3" json:"bucket_counts,omitempty"`
+	ExplicitBounds       []float64   `protobuf:"fixed64,7,rep,packed,name=explicit_bounds,json=explicitBounds,proto3" json:"explicit_bounds,omitempty"`
+	Flags                uint32      `protobuf:"varint,10,opt,name=flags,proto3" json:"flags,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
+}
+
+func (m *HistogramDataPoint) Reset()         { *m = HistogramDataPoint{} }
+func (m *HistogramDataPoint) String() string { return proto.CompactTextString(m) }
+func (*HistogramDataPoint) ProtoMessage()    {}
+func (*HistogramDataPoint) Descriptor() ([]byte, []int) {
+	return fileDescriptor_metrics_7c6fb670203b3320, []int{9}
+}
+func (m *HistogramDataPoint) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_HistogramDataPoint.Unmarshal(m, b)
+}
+func (m *HistogramDataPoint) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_HistogramDataPoint.Marshal(b, m, deterministic)
+}
+func (dst *HistogramDataPoint) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_HistogramDataPoint.Merge(dst, src)
+}
+func (m *HistogramDataPoint) XXX_Size() int {
+	return xxx_messageInfo_HistogramDataPoint.Size(m)
+}
+func (m *HistogramDataPoint) XXX_DiscardUnknown() {
+	xxx_messageInfo_HistogramDataPoint.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_HistogramDataPoint proto.InternalMessageInfo
+
+func (m *HistogramDataPoint) GetAttributes() []*KeyValue {
+	if m != nil {
+		return m.Attributes
+	}
+	return nil
+}
+
+func (m *HistogramDataPoint) GetStartTimeUnixNano() uint64 {
+	if m != nil {
+		return m.StartTimeUnixNano
+	}
+	return 0
+}
+
+func (m *HistogramDataPoint) GetTimeUnixNano() uint64 {
+	if m != nil {
+		return m.TimeUnixNano
+	}
+	return 0
+}
+
+func (m *HistogramDataPoint) GetCount() uint64 {
+	if m != nil {
+		return m.Count
+	}
+	return 0
+}
+
+func (m *HistogramDataPoint) GetSum() float64 {
+	if m != nil {
+		return m.Sum
+	}
+	return 0
+}
+
+func (m *HistogramDataPoint) GetBucketCounts() []uint64 {
+	if m != nil {
+		return m.BucketCounts
+	}
+	return nil
+}
+
+func (m *HistogramDataPoint) GetExplicitBounds() []float64 {
+	if m != nil {
+		return m.ExplicitBounds
+	}
+	return nil
+}
+
+func (m *HistogramDataPoint) GetFlags() uint32 {
+	if m != nil {
+		return m.Flags
+	}
+	return 0
+}
+
+type SummaryDataPoint struct {
+	Attributes           []*KeyValue `protobuf:"bytes,7,rep,name=attributes,proto3" json:"attributes,omitempty"`
+	StartTimeUnixNano    uint64      `protobuf:"fixed64,2,opt,name=start_time_unix_nano,json=startTimeUnixNano,proto3" json:"start_time_unix_nano,omitempty"`
+	TimeUnixNano         uint64      `protobuf:"fixed64,3,opt,name=time_unix_nano,json=timeUnixNano,proto3" json:"time_unix_nano,omitempty"`
+	Count                uint64      `protobuf:"fixed64,4,opt,name=count,proto3" json:"count,omitempty"`
+	Sum                  float64     `protobuf:"fixed64,5,opt,name=sum,proto3" json:"sum,omitempty"`
+	Flags                uint32      `protobuf:"varint,8,opt,name=flags,proto3" json:"flags,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
+}
+
+func (m *SummaryDataPoint) Reset()         { *m = SummaryDataPoint{} }
+func (m *SummaryDataPoint) String() string { return proto.CompactTextString(m) }
+func (*SummaryDataPoint) ProtoMessage()    {}
+func (*SummaryDataPoint) Descriptor() ([]byte, []int) {
+	return fileDescriptor_metrics_7c6fb670203b3320, []int{10}
+}
+func (m *SummaryDataPoint) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SummaryDataPoint.Unmarshal(m, b)
+}
+func (m *SummaryDataPoint) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SummaryDataPoint.Marshal(b, m, deterministic)
+}
+func (dst *SummaryDataPoint) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SummaryDataPoint.Merge(dst, src)
+}
+func (m *SummaryDataPoint) XXX_Size() int {
+	return xxx_messageInfo_SummaryDataPoint.Size(m)
+}
+func (m *SummaryDataPoint) XXX_DiscardUnknown() {
+	xxx_messageInfo_SummaryDataPoint.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SummaryDataPoint proto.InternalMessageInfo
+
+func (m *SummaryDataPoint) GetAttributes() []*KeyValue {
+	if m != nil {
+		return m.Attributes
+	}
+	return nil
+}
+
+func (m *SummaryDataPoint) GetStartTimeUnixNano() uint64 {
+	if m != nil {
+		return m.StartTimeUnixNano
+	}
+	return 0
+}
+
+func (m *SummaryDataPoint) GetTimeUnixNano() uint64 {
+	if m != nil {
+		return m.TimeUnixNano
+	}
+	return 0
+}
+
+func (m *SummaryDataPoint) GetCount() uint64 {
+	if m != nil {
+		return m.Count
+	}
+	return 0
+}
+
+func (m *SummaryDataPoint) GetSum() float64 {
+	if m != nil {
+		return m.Sum
+	}
+	return 0
+}
+
+func (m *SummaryDataPoint) GetFlags() uint32 {
+	if m != nil {
+		return m.Flags
+	}
+	return 0
+}
+
+func init() {
+	proto.RegisterType((*MetricsData)(nil), "opentelemetry.proto.metrics.v1.MetricsData")
+	proto.RegisterType((*ResourceMetrics)(nil), "opentelemetry.proto.metrics.v1.ResourceMetrics")
+	proto.RegisterType((*ScopeMetrics)(nil), "opentelemetry.proto.metrics.v1.ScopeMetrics")
+	proto.RegisterType((*Metric)(nil), "opentelemetry.proto.metrics.v1.Metric")
+	proto.RegisterType((*Gauge)(nil), "opentelemetry.proto.metrics.v1.Gauge")
+	proto.RegisterType((*Sum)(nil), "opentelemetry.proto.metrics.v1.Sum")
+	proto.RegisterType((*Histogram)(nil), "opentelemetry.proto.metrics.v1.Histogram")
+	proto.RegisterType((*Summary)(nil), "opentelemetry.proto.metrics.v1.Summary")
+	proto.RegisterType((*NumberDataPoint)(nil), "opentelemetry.proto.metrics.v1.NumberDataPoint")
+	proto.RegisterType((*HistogramDataPoint)(nil), "opentelemetry.proto.metrics.v1.HistogramDataPoint")
+	proto.RegisterType((*SummaryDataPoint)(nil), "opentelemetry.proto.metrics.v1.SummaryDataPoint")
+	proto.RegisterEnum("opentelemetry.proto.metrics.v1.AggregationTemporality", AggregationTemporality_name, AggregationTemporality_value)
+}
+
+func init() { proto.RegisterFile("otlp/metrics.proto", fileDescriptor_metrics_7c6fb670203b3320) }
+
+var fileDescriptor_metrics_7c6fb670203b3320 = []byte{
+	// 877 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xcc, 0x56, 0x4d, 0x6f, 0xdb, 0x36,
+	0x18, 0xb6, 0xec, 0x58, 0x8e, 0x5f, 0xe7, 0xc3, 0xe5, 0x82, 0x56, 0x28, 0x90, 0x41, 0x55, 0xb6,
+	0xc6, 0x1b, 0x06, 0x67, 0x4d, 0x81, 0xed, 0x34, 0x60, 0x4e, 0xe2, 0xd9, 0xc2, 0x92, 0x34, 0x65,
+	0xec, 0x02, 0x2d, 0x06, 0x08, 0xb4, 0xcc, 0xb9, 0xc4, 0x44, 0xd2, 0x10, 0xa9, 0x20, 0xf9, 0x07,
+	0x3b, 0xec, 0x17, 0xed, 0xb4, 0xf3, 0x6e, 0xfb, 0x0b, 0xbb, 0xee, 0xb2, 0x9f, 0x30, 0x88, 0xb2,
+	0x62, 0xd7, 0x73, 0x62, 0x1f, 0x7a, 0xc8, 0x4d, 0x7c, 0xf8, 0x3c, 0x2f, 0x9f, 0xf7, 0x83, 0x84,
+	0x00, 0x49, 0x1d, 0x8d, 0x0f, 0x38, 0xd5, 0x31, 0x0b, 0x55, 0x73, 0x1c, 0x4b, 0x2d, 0xd1, 0xa7,
+	0x72, 0x4c, 0x85, 0xa6, 0x11, 0x4d, 0xe1, 0x9b, 0x0c, 0x6c, 0xe6, 0x94, 0xab, 0x17, 0x4f, 0x1f,
+	0x19, 0x4d, 0x28, 0x39, 0x97, 0x22, 0xdb, 0x7d, 0xfa, 0x89, 0x81, 0x62, 0xaa, 0x64, 0x12, 0x87,
+	0x34, 0x03, 0x3d, 0x06, 0xb5, 0xb3, 0x4c, 0x75, 0x42, 0x34, 0x41, 0xef, 0xa0, 0x9e, 0x13, 0x82,
+	0x49, 0x34, 0xc7, 0x72, 0x4b, 0x8d, 0xda, 0xe1, 0x41, 0xf3, 0xfe, 0x13, 0x9b, 0x78, 0xa2, 0x9b,
+	0x84, 0xc3, 0xdb, 0xf1, 0x87, 0x80, 0xf7, 0xa7, 0x05, 0xdb, 0x73, 0x24, 0xd4, 0x86, 0xf5, 0x9c,
+	0xe6, 0x58, 0xae, 0xd5, 0xa8, 0x1d, 0x7e, 0xb1, 0xf0, 0x9c, 0x5b, 0xd7, 0x33, 0x07, 0xe1, 0x5b,
+	0x29, 0x7a, 0x0d, 0x9b, 0x2a, 0x94, 0xe3, 0xa9, 0xe7, 0xa2, 0xf1, 0xfc, 0xd5, 0x32, 0xcf, 0x97,
+	0xa9, 0x28, 0x37, 0xbc, 0xa1, 0x66, 0x56, 0x68, 0x17, 0x40, 0x85, 0xef, 0x29, 0x27, 0x41, 0x12,
+	0x47, 0x4e, 0xc9, 0xb5, 0x1a, 0x55, 0x5c, 0xcd, 0x90, 0x7e, 0x1c, 0x79, 0xbf, 0x5b, 0xb0, 0x31,
+	0xab, 0x46, 0x3e, 0x94, 0x8d, 0x7e, 0x92, 0xc6, 0xcb, 0x85, 0x47, 0x4f, 0xfa, 0x71, 0xf5, 0xa2,
+	0xe9, 0x0b, 0xa5, 0xe3, 0x84, 0x53, 0xa1, 0x89, 0x66, 0x52, 0x98, 0x50, 0x38, 0x8b, 0x80, 0xbe,
+	0x87, 0xca, 0x87, 0x79, 0x3c, 0x5f, 0x96, 0x47, 0x66, 0x02, 0x57, 0xf8, 0x6a, 0xe6, 0xff, 0x2e,
+	0x82, 0x9d, 0x49, 0x10, 0x82, 0x35, 0x41, 0x78, 0xe6, 0xba, 0x8a, 0xcd, 0x37, 0x72, 0xa1, 0x36,
+	0xa4, 0x2a, 0x8c, 0xd9, 0x38, 0xb5, 0xe6, 0x14, 0xcd, 0xd6, 0x2c, 0x94, 0xaa, 0x12, 0xc1, 0xf4,
+	0x24, 0xb2, 0xf9, 0x46, 0xdf, 0x41, 0x79, 0x44, 0x92, 0x11, 0x75, 0xca, 0xa6, 0x00, 0x9f, 0x2f,
+	0xf3, 0xdc, 0x49, 0xc9, 0xdd, 0x02, 0xce, 0x54, 0xe8, 0x5b, 0x28, 0xa9, 0x84, 0x3b, 0x15, 0x23,
+	0xde, 0x5b, 0xda, 0xb8, 0x84, 0x77, 0x0b, 0x38, 0x55, 0x20, 0x1f, 0xaa, 0xef, 0x99, 0xd2, 0x72,
+	0x14, 0x13, 0xee, 0x54, 0xef, 0x99, 0xa1, 0x19, 0x79, 0x37, 0x17, 0x74, 0x0b, 0x78, 0xaa, 0x46,
+	0xc7, 0x50, 0x51, 0x09, 0xe7, 0x24, 0xbe, 0x71, 0x6a, 0x26, 0xd0, 0xfe, 0x0a, 0x3e, 0x52, 0x7a,
+	0xb7, 0x80, 0x73, 0xe5, 0x91, 0x0d, 0x6b, 0x43, 0xa2, 0x89, 0xf7, 0x16, 0xca, 0x26, 0x45, 0x74,
+	0x01, 0xb5, 0x14, 0x08, 0xc6, 0x92, 0x09, 0xbd, 0xf2, 0x75, 0x3a, 0x4f, 0xf8, 0x80, 0xc6, 0xe9,
+	0xa5, 0xbc, 0x48, 0x75, 0x18, 0x86, 0xf9, 0xa7, 0xf2, 0xfe, 0xb1, 0xa0, 0x74, 0x99, 0xf0, 0x8f,
+	0x1f, 0x19, 0x49, 0x78, 0x42, 0x46, 0xa3, 0x98, 0x8e, 0xcc, 0x54, 0x06, 0x9a, 0xf2, 0xb1, 0x8c,
+	0x49, 0xc4, 0xf4, 0x8d, 0x19, 0x83, 0xad, 0xc3, 0x6f, 0x96, 0x45, 0x6f, 0x4d, 0xe5, 0xbd, 0xa9,
+	0x1a, 0x3f, 0x26, 0x0b, 0x71, 0xf4, 0x0c, 0x36, 0x98, 0x0a, 0xb8, 0x14, 0x52, 0x4b, 0xc1, 0x42,
+	0x33, 0x51, 0xeb, 0xb8, 0xc6, 0xd4, 0x59, 0x0e, 0x79, 0x7f, 0x59, 0x50, 0xbd, 0x6d, 0x18, 0xba,
+	0x5c, 0x94, 0xf3, 0xe1, 0xca, 0x0d, 0x7f, 0x18, 0x69, 0x7b, 0x3f, 0x41, 0x65, 0x32, 0x3a, 0xe8,
+	0xf5, 0xa2, 0x84, 0xbe, 0x5e, 0x71, 0xf0, 0x16, 0xcf, 0xc7, 0xaf, 0x45, 0xd8, 0x9e, 0xeb, 0x32,
+	0xea, 0x00, 0x10, 0xad, 0x63, 0x36, 0x48, 0x34, 0x55, 0x4e, 0xc5, 0x2d, 0xdd, 0x39, 0xde, 0xd3,
+	0x47, 0xea, 0x47, 0x7a, 0xf3, 0x86, 0x44, 0x09, 0xc5, 0x33, 0x52, 0x74, 0x00, 0x3b, 0x4a, 0x93,
+	0x58, 0x07, 0x9a, 0x71, 0x1a, 0x24, 0x82, 0x5d, 0x07, 0x82, 0x08, 0x69, 0x0a, 0x65, 0xe3, 0x47,
+	0x66, 0xaf, 0xc7, 0x38, 0xed, 0x0b, 0x76, 0x7d, 0x4e, 0x84, 0x44, 0x9f, 0xc1, 0xd6, 0x1c, 0xb5,
+	0x64, 0xa8, 0x1b, 0x7a, 0x96, 0xb5, 0x0b, 0x55, 0xa2, 0x82, 0xa1, 0x4c, 0x06, 0x11, 0x75, 0xd6,
+	0x5c, 0xab, 0x61, 0x75, 0x0b, 0x78, 0x9d, 0xa8, 0x13, 0x83, 0xa0, 0x27, 0x60, 0x13, 0x15, 0x30,
+	0xa1, 0x1d, 0xdb, 0xb5, 0x1a, 0xf5, 0xf4, 0xdd, 0x20, 0xca, 0x17, 0x1a, 0xed, 0x40, 0xf9, 0xe7,
+	0x88, 0x8c, 0x94, 0xb3, 0xee, 0x5a, 0x8d, 0x4d, 0x9c, 0x2d, 0x8e, 0x2a, 0x50, 0xbe, 0x4a, 0x9d,
+	0x7b, 0x7f, 0x14, 0x01, 0xfd, 0xbf, 0xf9, 0x73, 0xd5, 0xa8, 0x3e, 0xb8, 0x6a, 0xec, 0x40, 0x39,
+	0x94, 0x89, 0xd0, 0xa6, 0x12, 0x36, 0xce, 0x16, 0xa8, 0x9e, 0xbd, 0x91, 0xe9, 0x03, 0x6b, 0x65,
+	0x8f, 0xdf, 0x1e, 0x6c, 0x0e, 0x92, 0xf0, 0x17, 0xaa, 0x03, 0xc3, 0x50, 0x8e, 0xed, 0x96, 0xd2,
+	0x60, 0x19, 0x78, 0x6c, 0x30, 0xb4, 0x0f, 0xdb, 0xf4, 0x7a, 0x1c, 0xb1, 0x90, 0xe9, 0x60, 0x20,
+	0x13, 0x31, 0xcc, 0xfa, 0x6f, 0xe1, 0xad, 0x1c, 0x3e, 0x32, 0xe8, 0xb4, 0x96, 0x30, 0x53, 0x4b,
+	0xef, 0x5f, 0x0b, 0xea, 0xf3, 0xe3, 0xf6, 0xe0, 0xc7, 0x69, 0xd5, 0x02, 0x2e, 0x1c, 0x9f, 0x2f,
+	0x7f, 0xb3, 0xe0, 0xf1, 0xe2, 0x1b, 0x8d, 0xf6, 0x61, 0xaf, 0xd5, 0xe9, 0xe0, 0x76, 0xa7, 0xd5,
+	0xf3, 0x5f, 0x9d, 0x07, 0xbd, 0xf6, 0xd9, 0xc5, 0x2b, 0xdc, 0x3a, 0xf5, 0x7b, 0x6f, 0x83, 0xfe,
+	0xf9, 0xe5, 0x45, 0xfb, 0xd8, 0xff, 0xc1, 0x6f, 0x9f, 0xd4, 0x0b, 0xe8, 0x19, 0xec, 0xde, 0x45,
+	0x3c, 0x69, 0x9f, 0xf6, 0x5a, 0x75, 0x0b, 0x3d, 0x07, 0xef, 0x2e, 0xca, 0x71, 0xff, 0xac, 0x7f,
+	0xda, 0xea, 0xf9, 0x6f, 0xda, 0xf5, 0xe2, 0x91, 0xfd, 0x6e, 0x2d, 0xfd, 0x77, 0x1b, 0xd8, 0xa6,
+	0xa2, 0x2f, 0xff, 0x1b, 0x00, 0x99, 0x94, 0x80, 0x7d, 0x11, 0x0a, 0x00, 0x00,
+}
@@ -0,0 +1,251 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: otlp/metrics_service.proto
+
+package otlp
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type ExportMetricsServiceRequest struct {
+	ResourceMetrics      []*ResourceMetrics `protobuf:"bytes,1,rep,name=resource_metrics,json=resourceMetrics,proto3" json:"resource_metrics,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
+	XXX_unrecognized     []byte             `json:"-"`
+	XXX_sizecache        int32              `json:"-"`
+}
+
+func (m *ExportMetricsServiceRequest) Reset()         { *m = ExportMetricsServiceRequest{} }
+func (m *ExportMetricsServiceRequest) String() string { return proto.CompactTextString(m) }
+func (*ExportMetricsServiceRequest) ProtoMessage()    {}
+func (*ExportMetricsServiceRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_metrics_service_683cf68b97a396de, []int{0}
+}
+func (m *ExportMetricsServiceRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ExportMetricsServiceRequest.Unmarshal(m, b)
+}
+func (m *ExportMetricsServiceRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ExportMetricsServiceRequest.Marshal(b, m, deterministic)
+}
+func (dst *ExportMetricsServiceRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ExportMetricsServiceRequest.Merge(dst, src)
+}
+func (m *ExportMetricsServiceRequest) XXX_Size() int {
+	return xxx_messageInfo_ExportMetricsServiceRequest.Size(m)
+}
+func (m *ExportMetricsServiceRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ExportMetricsServiceRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ExportMetricsServiceRequest proto.InternalMessageInfo
+
+func (m *ExportMetricsServiceRequest) GetResourceMetrics() []*ResourceMetrics {
+	if m != nil {
+		return m.ResourceMetrics
+	}
+	return nil
+}
+
+type ExportMetricsServiceResponse struct {
+	PartialSuccess       *ExportMetricsPartialSuccess `protobuf:"bytes,1,opt,name=partial_success,json=partialSuccess,proto3" json:"partial_success,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}                     `json:"-"`
+	XXX_unrecognized     []byte                       `json:"-"`
+	XXX_sizecache        int32                        `json:"-"`
+}
+
+func (m *ExportMetricsServiceResponse) Reset()         { *m = ExportMetricsServiceResponse{} }
+func (m *ExportMetricsServiceResponse) String() string { return proto.CompactTextString(m) }
+func (*ExportMetricsServiceResponse) ProtoMessage()    {}
+func (*ExportMetricsServiceResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_metrics_service_683cf68b97a396de, []int{1}
+}
+func (m *ExportMetricsServiceResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ExportMetricsServiceResponse.Unmarshal(m, b)
+}
+func (m *ExportMetricsServiceResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ExportMetricsServiceResponse.Marshal(b, m, deterministic)
+}
+func (dst *ExportMetricsServiceResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ExportMetricsServiceResponse.Merge(dst, src)
+}
+func (m *ExportMetricsServiceResponse) XXX_Size() int {
+	return xxx_messageInfo_ExportMetricsServiceResponse.Size(m)
+}
+func (m *ExportMetricsServiceResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ExportMetricsServiceResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ExportMetricsServiceResponse proto.InternalMessageInfo
+
+func (m *ExportMetricsServiceResponse) GetPartialSuccess() *ExportMetricsPartialSuccess {
+	if m != nil {
+		return m.PartialSuccess
+	}
+	return nil
+}
+
+type ExportMetricsPartialSuccess struct {
+	RejectedDataPoints   int64    `protobuf:"varint,1,opt,name=rejected_data_points,json=rejectedDataPoints,proto3" json:"rejected_data_points,omitempty"`
+	ErrorMessage         string   `protobuf:"bytes,2,opt,name=error_message,json=errorMessage,proto3" json:"error_message,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ExportMetricsPartialSuccess) Reset()         { *m = ExportMetricsPartialSuccess{} }
+func (m *ExportMetricsPartialSuccess) String() string { return proto.CompactTextString(m) }
+func (*ExportMetricsPartialSuccess) ProtoMessage()    {}
+func (*ExportMetricsPartialSuccess) Descriptor() ([]byte, []int) {
+	return fileDescriptor_metrics_service_683cf68b97a396de, []int{2}
+}
+func (m *ExportMetricsPartialSuccess) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ExportMetricsPartialSuccess.Unmarshal(m, b)
+}
+func (m *ExportMetricsPartialSuccess) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ExportMetricsPartialSuccess.Marshal(b, m, deterministic)
+}
+func (dst *ExportMetricsPartialSuccess) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ExportMetricsPartialSuccess.Merge(dst, src)
+}
+func (m *ExportMetricsPartialSuccess) XXX_Size() int {
+	return xxx_messageInfo_ExportMetricsPartialSuccess.Size(m)
+}
+func (m *ExportMetricsPartialSuccess) XXX_DiscardUnknown() {
+	xxx_messageInfo_ExportMetricsPartialSuccess.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ExportMetricsPartialSuccess proto.InternalMessageInfo
+
+func (m *ExportMetricsPartialSuccess) GetRejectedDataPoints() int64 {
+	if m != nil {
+		return m.RejectedDataPoints
+	}
+	return 0
+}
+
+func (m *ExportMetricsPartialSuccess) GetErrorMessage() string {
+	if m != nil {
+		return m.ErrorMessage
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterType((*ExportMetricsServiceRequest)(nil), "opentelemetry.proto.collector.metrics.v1.ExportMetricsServiceRequest")
+	proto.RegisterType((*ExportMetricsServiceResponse)(nil), "opentelemetry.proto.collector.metrics.v1.ExportMetricsServiceResponse")
+	proto.RegisterType((*ExportMetricsPartialSuccess)(nil), "opentelemetry.proto.collector.metrics.v1.ExportMetricsPartialSuccess")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// MetricsServiceClient is the client API for MetricsService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type MetricsServiceClient interface {
+	Export(ctx context.Context, in *ExportMetricsServiceRequest, opts ...grpc.CallOption) (*ExportMetricsServiceResponse, error)
+}
+
+type metricsServiceClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewMetricsServiceClient(cc *grpc.ClientConn) MetricsServiceClient {
+	return &metricsServiceClient{cc}
+}
+
+func (c *metricsServiceClient) Export(ctx context.Context, in *ExportMetricsServiceRequest, opts ...grpc.CallOption) (*ExportMetricsServiceResponse, error) {
+	out := new(ExportMetricsServiceResponse)
+	err := c.cc.Invoke(ctx, "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MetricsServiceServer is the server API for MetricsService service.
+type MetricsServiceServer interface {
+	Export(context.Context, *ExportMetricsServiceRequest) (*ExportMetricsServiceResponse, error)
+}
+
+func RegisterMetricsServiceServer(s *grpc.Server, srv MetricsServiceServer) {
+	s.RegisterService(&_MetricsService_serviceDesc, srv)
+}
+
+func _MetricsService_Export_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExportMetricsServiceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).Export(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).Export(ctx, req.(*ExportMetricsServiceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _MetricsService_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "opentelemetry.proto.collector.metrics.v1.MetricsService",
+	HandlerType: (*MetricsServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Export",
+			Handler:    _MetricsService_Export_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "otlp/metrics_service.proto",
+}
+
+func init() {
+	proto.RegisterFile("otlp/metrics_service.proto", fileDescriptor_metrics_service_683cf68b97a396de)
+}
+
+var fileDescriptor_metrics_service_683cf68b97a396de = []byte{
+	// 303 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x92, 0xc1, 0x4a, 0x03, 0x31,
+	0x10, 0x86, 0x8d, 0x95, 0x82, 0xa9, 0xb6, 0x12, 0x3c, 0x94, 0xd6, 0x43, 0x59, 0x2f, 0x7b, 0x4a,
+	0xb5, 0xbe, 0x81, 0x58, 0x6f, 0x85, 0x92, 0xde, 0x7a, 0x09, 0x31, 0x1d, 0x64, 0x65, 0xbb, 0x89,
+	0x93, 0x69, 0xb1, 0x2f, 0xe1, 0xdd, 0x77, 0xf0, 0x21, 0x65, 0x37, 0x2b, 0xba, 0x50, 0x44, 0xf4,
+	0xb8, 0xff, 0xcc, 0xff, 0xfd, 0x33, 0x3b, 0xe1, 0x03, 0x47, 0xb9, 0x1f, 0xaf, 0x81, 0x30, 0xb3,
+	0x41, 0x07, 0xc0, 0x6d, 0x66, 0x41, 0x7a, 0x74, 0xe4, 0x44, 0xea, 0x3c, 0x14, 0x04, 0x39, 0x94,
+	0xe5, 0x5d, 0x14, 0xa5, 0x75, 0x79, 0x0e, 0x96, 0x1c, 0xca, 0xda, 0x24, 0xb7, 0xd7, 0x03, 0xf1,
+	0x9d, 0x12, 0x1b, 0x93, 0x1d, 0x1f, 0x4e, 0x5f, 0xbc, 0x43, 0x9a, 0x45, 0x79, 0x11, 0xd9, 0x0a,
+	0x9e, 0x37, 0x10, 0x48, 0x2c, 0xf9, 0x19, 0x42, 0x70, 0x1b, 0xb4, 0xa0, 0x6b, 0x63, 0x9f, 0x8d,
+	0x5a, 0x69, 0x67, 0x32, 0x96, 0xfb, 0x72, 0xbf, 0xd2, 0xa4, 0xaa, 0x7d, 0x35, 0x58, 0xf5, 0xb0,
+	0x29, 0x24, 0xaf, 0x8c, 0x5f, 0xec, 0xcf, 0x0e, 0xde, 0x15, 0x01, 0x44, 0xc1, 0x7b, 0xde, 0x20,
+	0x65, 0x26, 0xd7, 0x61, 0x63, 0x2d, 0x84, 0x32, 0x9b, 0xa5, 0x9d, 0xc9, 0x54, 0xfe, 0x76, 0x67,
+	0xd9, 0x08, 0x98, 0x47, 0xda, 0x22, 0xc2, 0x54, 0xd7, 0x37, 0xbe, 0x13, 0xe2, 0xc3, 0x1f, 0xda,
+	0xc5, 0x15, 0x3f, 0x47, 0x78, 0x02, 0x4b, 0xb0, 0xd2, 0x2b, 0x43, 0x46, 0x7b, 0x97, 0x15, 0x14,
+	0x67, 0x6a, 0x29, 0xf1, 0x59, 0xbb, 0x33, 0x64, 0xe6, 0x55, 0x45, 0x5c, 0xf2, 0x53, 0x40, 0x74,
+	0xa8, 0xd7, 0x10, 0x82, 0x79, 0x84, 0xfe, 0xe1, 0x88, 0xa5, 0xc7, 0xea, 0xa4, 0x12, 0x67, 0x51,
+	0x9b, 0xbc, 0x33, 0xde, 0x6d, 0xfe, 0x00, 0xf1, 0xc6, 0x78, 0x3b, 0x4e, 0x22, 0xfe, 0xba, 0x6a,
+	0xf3, 0x8e, 0x83, 0xfb, 0xff, 0x62, 0xe2, 0x49, 0x92, 0x83, 0xdb, 0xf6, 0xf2, 0xa8, 0x7c, 0x46,
+	0x0f, 0xed, 0x0a, 0x71, 0xf3, 0x31, 0x00, 0x4c, 0xc3, 0x1d, 0x5c, 0x9b, 0x02, 0x00, 0x00,
+}
@@ -0,0 +1,188 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package otlp contains the subset of the OpenTelemetry protocol (OTLP) used
+// by consumer.OTLP and producer.OTLP as well as helpers to convert between
+// OTLP attributes and gollum metadata.
+package otlp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/trivago/gollum/core"
+)
+
+// ToInterface converts the value to its go representation. Arrays and key
+// value lists are converted to []interface{} and map[string]interface{}.
+func (value *AnyValue) ToInterface() interface{} {
+	switch value.GetValue().(type) {
+	case *AnyValue_StringValue:
+		return value.GetStringValue()
+	case *AnyValue_BoolValue:
+		return value.GetBoolValue()
+	case *AnyValue_IntValue:
+		return value.GetIntValue()
+	case *AnyValue_DoubleValue:
+		return value.GetDoubleValue()
+	case *AnyValue_BytesValue:
+		return value.GetBytesValue()
+	case *AnyValue_ArrayValue:
+		values := value.GetArrayValue().GetValues()
+		array := make([]interface{}, len(values))
+		for i, item := range values {
+			array[i] = item.ToInterface()
+		}
+		return array
+	case *AnyValue_KvlistValue:
+		values := value.GetKvlistValue().GetValues()
+		kvlist := make(map[string]interface{}, len(values))
+		for _, kv := range values {
+			kvlist[kv.GetKey()] = kv.GetValue().ToInterface()
+		}
+		return kvlist
+	default:
+		return nil
+	}
+}
+
+// ToBytes converts the value to a byte slice. Strings and bytes are returned
+// as-is, other values are converted to their JSON representation.
+func (value *AnyValue) ToBytes() []byte {
+	switch data := value.ToInterface().(type) {
+	case nil:
+		return []byte{}
+	case string:
+		return []byte(data)
+	case []byte:
+		return data
+	default:
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return []byte(fmt.Sprint(data))
+		}
+		return encoded
+	}
+}
+
+// NewAnyValue converts a metadata value to an AnyValue.
+func NewAnyValue(value interface{}) *AnyValue {
+	switch value := value.(type) {
+	case []byte:
+		return &AnyValue{Value: &AnyValue_StringValue{StringValue: string(value)}}
+	case string:
+		return &AnyValue{Value: &AnyValue_StringValue{StringValue: value}}
+	case int64:
+		return &AnyValue{Value: &AnyValue_IntValue{IntValue: value}}
+	case float64:
+		return &AnyValue{Value: &AnyValue_DoubleValue{DoubleValue: value}}
+	case bool:
+		return &AnyValue{Value: &AnyValue_BoolValue{BoolValue: value}}
+	case time.Time:
+		return &AnyValue{Value: &AnyValue_StringValue{StringValue: value.Format(time.RFC3339Nano)}}
+	case core.Metadata:
+		return &AnyValue{Value: &AnyValue_KvlistValue{KvlistValue: &KeyValueList{Values: MetadataToAttributes(value, nil)}}}
+	default:
+		return &AnyValue{Value: &AnyValue_StringValue{StringValue: fmt.Sprint(value)}}
+	}
+}
+
+// AttributesToMetadata stores the given attributes in metadata. Arrays are
+// stored as JSON encoded strings, key value lists as nested metadata.
+func AttributesToMetadata(attributes []*KeyValue, metadata core.Metadata) {
+	for _, attribute := range attributes {
+		switch value := attribute.GetValue().ToInterface().(type) {
+		case nil:
+			continue
+		case []interface{}:
+			metadata.SetValue(attribute.GetKey(), attribute.GetValue().ToBytes())
+		default:
+			metadata.Set(attribute.GetKey(), value)
+		}
+	}
+}
+
+// MetadataToAttributes converts the given metadata keys to attributes. If
+// keys is empty, all metadata keys are converted.
+func MetadataToAttributes(metadata core.Metadata, keys []string) []*KeyValue {
+	if len(keys) == 0 {
+		keys = make([]string, 0, len(metadata))
+		for key := range metadata {
+			keys = append(keys, key)
+		}
+	}
+
+	attributes := make([]*KeyValue, 0, len(keys))
+	for _, key := range keys {
+		if value, isSet := metadata.TryGet(key); isSet {
+			attributes = append(attributes, &KeyValue{
+				Key:   key,
+				Value: NewAnyValue(value),
+			})
+		}
+	}
+	return attributes
+}
+
+// SeverityName returns the short name of a severity number, e.g. "INFO" or
+// "ERROR2". An empty string is returned for unspecified severities.
+func SeverityName(severity SeverityNumber) string {
+	if severity <= SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED || severity > SeverityNumber_SEVERITY_NUMBER_FATAL4 {
+		return ""
+	}
+
+	names := [...]string{"TRACE", "DEBUG", "INFO", "WARN", "ERROR", "FATAL"}
+	name := names[(severity-1)/4]
+	if level := (severity-1)%4 + 1; level > 1 {
+		name += strconv.Itoa(int(level))
+	}
+	return name
+}
+
+// ParseSeverity returns the severity number matching the given name. Common
+// alternative names like "warning" or "critical" are supported. If the name
+// is not known SEVERITY_NUMBER_UNSPECIFIED is returned.
+func ParseSeverity(name string) SeverityNumber {
+	switch strings.ToUpper(name) {
+	case "TRACE":
+		return SeverityNumber_SEVERITY_NUMBER_TRACE
+	case "DEBUG":
+		return SeverityNumber_SEVERITY_NUMBER_DEBUG
+	case "INFO", "INFORMATIONAL", "NOTICE":
+		return SeverityNumber_SEVERITY_NUMBER_INFO
+	case "WARN", "WARNING":
+		return SeverityNumber_SEVERITY_NUMBER_WARN
+	case "ERROR", "ERR":
+		return SeverityNumber_SEVERITY_NUMBER_ERROR
+	case "FATAL", "CRITICAL", "CRIT", "ALERT", "EMERGENCY", "EMERG", "PANIC":
+		return SeverityNumber_SEVERITY_NUMBER_FATAL
+	default:
+		if number, isKnown := SeverityNumber_value["SEVERITY_NUMBER_"+strings.ToUpper(name)]; isKnown {
+			return SeverityNumber(number)
+		}
+		return SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED
+	}
+}
+
+// UnixNanoToTime converts an OTLP timestamp to time.Time. If the timestamp
+// is not set, the zero time is returned.
+func UnixNanoToTime(timestamp uint64) time.Time {
+	if timestamp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(timestamp))
+}
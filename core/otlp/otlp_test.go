@@ -0,0 +1,69 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"testing"
+
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestSeverity(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	expect.Equal("", SeverityName(SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED))
+	expect.Equal("TRACE", SeverityName(SeverityNumber_SEVERITY_NUMBER_TRACE))
+	expect.Equal("INFO", SeverityName(SeverityNumber_SEVERITY_NUMBER_INFO))
+	expect.Equal("ERROR3", SeverityName(SeverityNumber_SEVERITY_NUMBER_ERROR3))
+	expect.Equal("FATAL4", SeverityName(SeverityNumber_SEVERITY_NUMBER_FATAL4))
+
+	expect.Equal(SeverityNumber_SEVERITY_NUMBER_WARN, ParseSeverity("warning"))
+	expect.Equal(SeverityNumber_SEVERITY_NUMBER_FATAL, ParseSeverity("crit"))
+	expect.Equal(SeverityNumber_SEVERITY_NUMBER_DEBUG2, ParseSeverity("debug2"))
+	expect.Equal(SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED, ParseSeverity("loud"))
+}
+
+func TestAttributes(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	metadata := core.Metadata{
+		"car":   []byte("LR 19"),
+		"lap":   int64(3),
+		"speed": 81.5,
+		"pit":   false,
+	}
+
+	attributes := MetadataToAttributes(metadata, []string{"car", "lap", "speed", "pit", "unknown"})
+	expect.Equal(4, len(attributes))
+	expect.Equal("LR 19", attributes[0].GetValue().GetStringValue())
+	expect.Equal(int64(3), attributes[1].GetValue().GetIntValue())
+	expect.Equal(81.5, attributes[2].GetValue().GetDoubleValue())
+
+	attributes = append(attributes, &KeyValue{
+		Key: "tyres",
+		Value: &AnyValue{Value: &AnyValue_ArrayValue{ArrayValue: &ArrayValue{
+			Values: []*AnyValue{NewAnyValue("soft"), NewAnyValue("medium")},
+		}}},
+	})
+
+	decoded := core.Metadata{}
+	AttributesToMetadata(attributes, decoded)
+	expect.Equal("LR 19", decoded.GetValueString("car"))
+	expect.Equal(int64(3), decoded.GetInt("lap"))
+	expect.Equal(81.5, decoded.GetFloat("speed"))
+	expect.False(decoded.GetBool("pit"))
+	expect.Equal(`["soft","medium"]`, decoded.GetValueString("tyres"))
+}
@@ -0,0 +1,86 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: otlp/resource.proto
+
+package otlp
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type Resource struct {
+	Attributes             []*KeyValue `protobuf:"bytes,1,rep,name=attributes,proto3" json:"attributes,omitempty"`
+	DroppedAttributesCount uint32      `protobuf:"varint,2,opt,name=dropped_attributes_count,json=droppedAttributesCount,proto3" json:"dropped_attributes_count,omitempty"`
+	XXX_NoUnkeyedLiteral   struct{}    `json:"-"`
+	XXX_unrecognized       []byte      `json:"-"`
+	XXX_sizecache          int32       `json:"-"`
+}
+
+func (m *Resource) Reset()         { *m = Resource{} }
+func (m *Resource) String() string { return proto.CompactTextString(m) }
+func (*Resource) ProtoMessage()    {}
+func (*Resource) Descriptor() ([]byte, []int) {
+	return fileDescriptor_resource_c41fc85b8ba921b8, []int{0}
+}
+func (m *Resource) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Resource.Unmarshal(m, b)
+}
+func (m *Resource) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Resource.Marshal(b, m, deterministic)
+}
+func (dst *Resource) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Resource.Merge(dst, src)
+}
+func (m *Resource) XXX_Size() int {
+	return xxx_messageInfo_Resource.Size(m)
+}
+func (m *Resource) XXX_DiscardUnknown() {
+	xxx_messageInfo_Resource.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Resource proto.InternalMessageInfo
+
+func (m *Resource) GetAttributes() []*KeyValue {
+	if m != nil {
+		return m.Attributes
+	}
+	return nil
+}
+
+func (m *Resource) GetDroppedAttributesCount() uint32 {
+	if m != nil {
+		return m.DroppedAttributesCount
+	}
+	return 0
+}
+
+func init() {
+	proto.RegisterType((*Resource)(nil), "opentelemetry.proto.resource.v1.Resource")
+}
+
+func init() { proto.RegisterFile("otlp/resource.proto", fileDescriptor_resource_c41fc85b8ba921b8) }
+
+var fileDescriptor_resource_c41fc85b8ba921b8 = []byte{
+	// 172 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0x12, 0xce, 0x2f, 0xc9, 0x29,
+	0xd0, 0x2f, 0x4a, 0x2d, 0xce, 0x2f, 0x2d, 0x4a, 0x4e, 0xd5, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17,
+	0x92, 0xcf, 0x2f, 0x48, 0xcd, 0x2b, 0x49, 0xcd, 0x49, 0xcd, 0x4d, 0x2d, 0x29, 0xaa, 0x84, 0x08,
+	0xea, 0xc1, 0xd5, 0x94, 0x19, 0x4a, 0x09, 0x82, 0x75, 0x25, 0xe7, 0xe7, 0xe6, 0xe6, 0xe7, 0x41,
+	0xa4, 0x95, 0x7a, 0x19, 0xb9, 0x38, 0x82, 0xa0, 0x4a, 0x84, 0xdc, 0xb9, 0xb8, 0x12, 0x4b, 0x4a,
+	0x8a, 0x32, 0x93, 0x4a, 0x4b, 0x52, 0x8b, 0x25, 0x18, 0x15, 0x98, 0x35, 0xb8, 0x8d, 0xd4, 0xf5,
+	0xb0, 0x99, 0x0a, 0x35, 0xa3, 0xcc, 0x50, 0xcf, 0x3b, 0xb5, 0x32, 0x2c, 0x31, 0xa7, 0x34, 0x35,
+	0x08, 0x49, 0xab, 0x90, 0x05, 0x97, 0x44, 0x4a, 0x51, 0x7e, 0x41, 0x41, 0x6a, 0x4a, 0x3c, 0x42,
+	0x34, 0x3e, 0x39, 0xbf, 0x34, 0xaf, 0x44, 0x82, 0x49, 0x81, 0x51, 0x83, 0x37, 0x48, 0x0c, 0x2a,
+	0xef, 0x08, 0x97, 0x76, 0x06, 0xc9, 0x3a, 0xb1, 0x45, 0xb1, 0x80, 0x1c, 0x99, 0xc4, 0x06, 0xb6,
+	0xc7, 0x18, 0x30, 0x00, 0x34, 0xa5, 0x52, 0x51, 0xe9, 0x00, 0x00, 0x00,
+}
@@ -0,0 +1,284 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// IP protocol numbers decoded by Decode
+const (
+	ProtocolICMP   = uint8(1)
+	ProtocolTCP    = uint8(6)
+	ProtocolUDP    = uint8(17)
+	ProtocolICMPv6 = uint8(58)
+)
+
+// TCP header flags
+const (
+	FlagFIN = uint8(1 << iota)
+	FlagSYN
+	FlagRST
+	FlagPSH
+	FlagACK
+	FlagURG
+)
+
+const (
+	etherTypeIPv4 = 0x0800
+	etherTypeIPv6 = 0x86dd
+	etherTypeVLAN = 0x8100
+	etherTypeQinQ = 0x88a8
+)
+
+// Decoded contains the link, network and transport layer headers of a
+// packet. Transport layer fields are only set for TCP and UDP packets.
+type Decoded struct {
+	SrcMAC    net.HardwareAddr
+	DstMAC    net.HardwareAddr
+	IPVersion int
+	SrcIP     net.IP
+	DstIP     net.IP
+	Protocol  uint8
+	TTL       uint8
+	Fragment  bool
+	SrcPort   uint16
+	DstPort   uint16
+	Seq       uint32
+	Ack       uint32
+	Flags     uint8
+	Payload   []byte
+}
+
+// ProtocolName returns the name of the IP protocol, e.g. "tcp".
+func (packet Decoded) ProtocolName() string {
+	switch packet.Protocol {
+	case ProtocolICMP:
+		return "icmp"
+	case ProtocolTCP:
+		return "tcp"
+	case ProtocolUDP:
+		return "udp"
+	case ProtocolICMPv6:
+		return "icmpv6"
+	default:
+		return strconv.Itoa(int(packet.Protocol))
+	}
+}
+
+// FlagNames returns the TCP flags in tcpdump notation, e.g. "S." for SYN+ACK.
+func (packet Decoded) FlagNames() string {
+	names := []byte{}
+	for _, flag := range []struct {
+		bit  uint8
+		name byte
+	}{{FlagFIN, 'F'}, {FlagSYN, 'S'}, {FlagRST, 'R'}, {FlagPSH, 'P'}, {FlagURG, 'U'}, {FlagACK, '.'}} {
+		if packet.Flags&flag.bit != 0 {
+			names = append(names, flag.name)
+		}
+	}
+	return string(names)
+}
+
+// Decode parses the headers of a packet with the given link type. The payload
+// of the decoded packet references data. Packets that are not IPv4 or IPv6
+// return an error.
+func Decode(linkType LinkType, data []byte) (Decoded, error) {
+	packet := Decoded{}
+
+	switch linkType {
+	case LinkTypeEthernet:
+		if len(data) < 14 {
+			return packet, fmt.Errorf("Truncated ethernet header")
+		}
+		packet.DstMAC = net.HardwareAddr(data[0:6])
+		packet.SrcMAC = net.HardwareAddr(data[6:12])
+		etherType := binary.BigEndian.Uint16(data[12:])
+		data = data[14:]
+
+		for etherType == etherTypeVLAN || etherType == etherTypeQinQ {
+			if len(data) < 4 {
+				return packet, fmt.Errorf("Truncated VLAN header")
+			}
+			etherType = binary.BigEndian.Uint16(data[2:])
+			data = data[4:]
+		}
+		if etherType != etherTypeIPv4 && etherType != etherTypeIPv6 {
+			return packet, fmt.Errorf("Unsupported ether type 0x%04x", etherType)
+		}
+
+	case LinkTypeLinuxSLL:
+		if len(data) < 16 {
+			return packet, fmt.Errorf("Truncated SLL header")
+		}
+		data = data[16:]
+
+	case LinkTypeNull, LinkTypeLoop:
+		if len(data) < 4 {
+			return packet, fmt.Errorf("Truncated loopback header")
+		}
+		data = data[4:]
+
+	case LinkTypeRaw, LinkTypeIPv4, LinkTypeIPv6:
+
+	default:
+		return packet, fmt.Errorf("Unsupported link type %d", linkType)
+	}
+
+	if len(data) == 0 {
+		return packet, fmt.Errorf("Missing network layer")
+	}
+
+	var err error
+	switch data[0] >> 4 {
+	case 4:
+		data, err = packet.decodeIPv4(data)
+	case 6:
+		data, err = packet.decodeIPv6(data)
+	default:
+		return packet, fmt.Errorf("Unsupported IP version %d", data[0]>>4)
+	}
+	if err != nil {
+		return packet, err
+	}
+
+	packet.Payload = data
+	if packet.Fragment {
+		return packet, nil // ### return, no transport layer header ###
+	}
+
+	switch packet.Protocol {
+	case ProtocolTCP:
+		err = packet.decodeTCP()
+	case ProtocolUDP:
+		err = packet.decodeUDP()
+	}
+	return packet, err
+}
+
+func (packet *Decoded) decodeIPv4(data []byte) ([]byte, error) {
+	if len(data) < 20 {
+		return nil, fmt.Errorf("Truncated IPv4 header")
+	}
+
+	headerLen := int(data[0]&0x0f) * 4
+	totalLen := int(binary.BigEndian.Uint16(data[2:]))
+	if headerLen < 20 || len(data) < headerLen {
+		return nil, fmt.Errorf("Invalid IPv4 header length %d", headerLen)
+	}
+
+	packet.IPVersion = 4
+	packet.TTL = data[8]
+	packet.Protocol = data[9]
+	packet.SrcIP = net.IP(data[12:16])
+	packet.DstIP = net.IP(data[16:20])
+
+	fragment := binary.BigEndian.Uint16(data[6:])
+	packet.Fragment = fragment&0x2000 != 0 || fragment&0x1fff != 0
+
+	// Remove ethernet padding
+	if totalLen >= headerLen && totalLen < len(data) {
+		data = data[:totalLen]
+	}
+	return data[headerLen:], nil
+}
+
+func (packet *Decoded) decodeIPv6(data []byte) ([]byte, error) {
+	if len(data) < 40 {
+		return nil, fmt.Errorf("Truncated IPv6 header")
+	}
+
+	packet.IPVersion = 6
+	packet.TTL = data[7]
+	packet.SrcIP = net.IP(data[8:24])
+	packet.DstIP = net.IP(data[24:40])
+
+	payloadLen := int(binary.BigEndian.Uint16(data[4:]))
+	nextHeader := data[6]
+	data = data[40:]
+	if payloadLen > 0 && payloadLen < len(data) {
+		data = data[:payloadLen]
+	}
+
+	// Skip extension headers
+	for {
+		switch nextHeader {
+		case 0, 43, 60: // hop-by-hop, routing, destination options
+			if len(data) < 8 {
+				return nil, fmt.Errorf("Truncated IPv6 extension header")
+			}
+			extLen := (int(data[1]) + 1) * 8
+			if len(data) < extLen {
+				return nil, fmt.Errorf("Truncated IPv6 extension header")
+			}
+			nextHeader = data[0]
+			data = data[extLen:]
+
+		case 44: // fragment
+			if len(data) < 8 {
+				return nil, fmt.Errorf("Truncated IPv6 fragment header")
+			}
+			fragment := binary.BigEndian.Uint16(data[2:])
+			packet.Fragment = fragment&0x0001 != 0 || fragment&0xfff8 != 0
+			nextHeader = data[0]
+			data = data[8:]
+
+		default:
+			packet.Protocol = nextHeader
+			return data, nil
+		}
+	}
+}
+
+func (packet *Decoded) decodeTCP() error {
+	data := packet.Payload
+	if len(data) < 20 {
+		return fmt.Errorf("Truncated TCP header")
+	}
+
+	headerLen := int(data[12]>>4) * 4
+	if headerLen < 20 || len(data) < headerLen {
+		return fmt.Errorf("Invalid TCP header length %d", headerLen)
+	}
+
+	packet.SrcPort = binary.BigEndian.Uint16(data[0:])
+	packet.DstPort = binary.BigEndian.Uint16(data[2:])
+	packet.Seq = binary.BigEndian.Uint32(data[4:])
+	packet.Ack = binary.BigEndian.Uint32(data[8:])
+	packet.Flags = data[13] & 0x3f
+	packet.Payload = data[headerLen:]
+	return nil
+}
+
+func (packet *Decoded) decodeUDP() error {
+	data := packet.Payload
+	if len(data) < 8 {
+		return fmt.Errorf("Truncated UDP header")
+	}
+
+	packet.SrcPort = binary.BigEndian.Uint16(data[0:])
+	packet.DstPort = binary.BigEndian.Uint16(data[2:])
+
+	length := int(binary.BigEndian.Uint16(data[4:]))
+	data = data[8:]
+	if length >= 8 && length-8 < len(data) {
+		data = data[:length-8]
+	}
+	packet.Payload = data
+	return nil
+}
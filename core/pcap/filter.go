@@ -0,0 +1,87 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"golang.org/x/net/bpf"
+)
+
+var filterNumbers = regexp.MustCompile(`0[xX][0-9a-fA-F]+|\d+`)
+
+// ParseFilter parses a compiled BPF program as printed by "tcpdump -dd" or
+// "tcpdump -ddd".
+func ParseFilter(source string) ([]bpf.RawInstruction, error) {
+	tokens := filterNumbers.FindAllString(source, -1)
+	numbers := make([]uint64, len(tokens))
+	for i, token := range tokens {
+		number, err := strconv.ParseUint(token, 0, 32)
+		if err != nil {
+			return nil, err
+		}
+		numbers[i] = number
+	}
+
+	// "tcpdump -ddd" prints the number of instructions first
+	if len(numbers)%4 == 1 && numbers[0] == uint64(len(numbers)/4) {
+		numbers = numbers[1:]
+	}
+	if len(numbers) == 0 || len(numbers)%4 != 0 {
+		return nil, fmt.Errorf("Filter is not a valid BPF program")
+	}
+
+	program := make([]bpf.RawInstruction, 0, len(numbers)/4)
+	for i := 0; i < len(numbers); i += 4 {
+		if numbers[i] > 0xffff || numbers[i+1] > 0xff || numbers[i+2] > 0xff {
+			return nil, fmt.Errorf("Invalid BPF instruction %d", i/4)
+		}
+		program = append(program, bpf.RawInstruction{
+			Op: uint16(numbers[i]),
+			Jt: uint8(numbers[i+1]),
+			Jf: uint8(numbers[i+2]),
+			K:  uint32(numbers[i+3]),
+		})
+	}
+	return program, nil
+}
+
+// Filter applies a BPF program to captured packets in user space, e.g. when
+// reading capture files.
+type Filter struct {
+	vm *bpf.VM
+}
+
+// NewFilter creates a filter from a compiled BPF program.
+func NewFilter(program []bpf.RawInstruction) (*Filter, error) {
+	instructions, allDecoded := bpf.Disassemble(program)
+	if !allDecoded {
+		return nil, fmt.Errorf("Filter contains unknown BPF instructions")
+	}
+
+	vm, err := bpf.NewVM(instructions)
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{vm: vm}, nil
+}
+
+// Matches returns true if the packet data passes the filter.
+func (filter *Filter) Matches(data []byte) bool {
+	accepted, err := filter.vm.Run(data)
+	return err == nil && accepted > 0
+}
@@ -0,0 +1,265 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func newTestPacket(seq uint32, flags uint8, payload string) []byte {
+	tcp := make([]byte, 20)
+	binary.BigEndian.PutUint16(tcp[0:], 40000)
+	binary.BigEndian.PutUint16(tcp[2:], 80)
+	binary.BigEndian.PutUint32(tcp[4:], seq)
+	tcp[12] = 5 << 4
+	tcp[13] = flags
+	tcp = append(tcp, payload...)
+
+	ip := make([]byte, 20)
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:], uint16(20+len(tcp)))
+	ip[8] = 64
+	ip[9] = ProtocolTCP
+	copy(ip[12:], net.IPv4(10, 0, 0, 1).To4())
+	copy(ip[16:], net.IPv4(10, 0, 0, 2).To4())
+
+	ether := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 0x08, 0x00}
+	packet := append(ether, ip...)
+	packet = append(packet, tcp...)
+
+	// Ethernet padding has to be ignored
+	for len(packet) < 60 {
+		packet = append(packet, 0)
+	}
+	return packet
+}
+
+func newTestPcap(packets ...[]byte) []byte {
+	buffer := new(bytes.Buffer)
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:], pcapMagicNano)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], 65535)
+	binary.LittleEndian.PutUint32(header[20:], uint32(LinkTypeEthernet))
+	buffer.Write(header)
+
+	for i, packet := range packets {
+		record := make([]byte, 16)
+		binary.LittleEndian.PutUint32(record[0:], 1500000000)
+		binary.LittleEndian.PutUint32(record[4:], uint32(i*1000))
+		binary.LittleEndian.PutUint32(record[8:], uint32(len(packet)))
+		binary.LittleEndian.PutUint32(record[12:], uint32(len(packet)))
+		buffer.Write(record)
+		buffer.Write(packet)
+	}
+	return buffer.Bytes()
+}
+
+func newTestPcapng(packet []byte) []byte {
+	buffer := new(bytes.Buffer)
+	block := func(blockType uint32, body []byte) {
+		length := uint32(12 + len(body))
+		binary.Write(buffer, binary.BigEndian, blockType)
+		binary.Write(buffer, binary.BigEndian, length)
+		buffer.Write(body)
+		binary.Write(buffer, binary.BigEndian, length)
+	}
+
+	section := []byte{0x1a, 0x2b, 0x3c, 0x4d, 0, 1, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	block(pcapngBlockSection, section)
+
+	iface := []byte{0, byte(LinkTypeEthernet), 0, 0, 0, 0, 0xff, 0xff}
+	iface = append(iface, 0, pcapngOptionIfName, 0, 4, 'e', 't', 'h', '0')
+	iface = append(iface, 0, pcapngOptionIfTsresol, 0, 1, 9, 0, 0, 0)
+	iface = append(iface, 0, 0, 0, 0)
+	block(pcapngBlockInterface, iface)
+
+	timestamp := uint64(1500000000)*1000000000 + 42
+	epb := make([]byte, 20)
+	binary.BigEndian.PutUint32(epb[4:], uint32(timestamp>>32))
+	binary.BigEndian.PutUint32(epb[8:], uint32(timestamp))
+	binary.BigEndian.PutUint32(epb[12:], uint32(len(packet)))
+	binary.BigEndian.PutUint32(epb[16:], uint32(len(packet)))
+	epb = append(epb, packet...)
+	for len(epb)%4 != 0 {
+		epb = append(epb, 0)
+	}
+	block(pcapngBlockEnhanced, epb)
+
+	return buffer.Bytes()
+}
+
+func TestPcapReader(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	packet := newTestPacket(1, FlagACK|FlagPSH, "hello")
+	reader, err := NewFileReader(bytes.NewReader(newTestPcap(packet, packet)))
+	expect.NoError(err)
+
+	first, err := reader.ReadPacket()
+	expect.NoError(err)
+	expect.Equal(LinkTypeEthernet, first.LinkType)
+	expect.Equal(len(packet), len(first.Data))
+
+	second, err := reader.ReadPacket()
+	expect.NoError(err)
+	expect.Equal(int64(1500000000000001000), second.Timestamp.UnixNano())
+
+	_, err = reader.ReadPacket()
+	expect.Equal(io.EOF, err)
+}
+
+func TestPcapngReader(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	packet := newTestPacket(1, FlagACK, "hello")
+	reader, err := NewFileReader(bytes.NewReader(newTestPcapng(packet)))
+	expect.NoError(err)
+
+	captured, err := reader.ReadPacket()
+	expect.NoError(err)
+	expect.Equal("eth0", captured.Interface)
+	expect.Equal(int64(1500000000000000042), captured.Timestamp.UnixNano())
+	expect.Equal(packet, captured.Data)
+
+	_, err = reader.ReadPacket()
+	expect.Equal(io.EOF, err)
+}
+
+func TestPcapngTimestampResolution(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	addInterface := func(tsresol byte) error {
+		reader := &pcapngReader{order: binary.BigEndian}
+		iface := []byte{0, byte(LinkTypeEthernet), 0, 0, 0, 0, 0xff, 0xff}
+		iface = append(iface, 0, pcapngOptionIfTsresol, 0, 1, tsresol, 0, 0, 0)
+		return reader.addInterface(iface)
+	}
+
+	expect.NoError(addInterface(19))
+	expect.NoError(addInterface(0x80 | 63))
+	expect.NotNil(addInterface(20))
+	expect.NotNil(addInterface(0x80 | 64))
+	expect.NotNil(addInterface(0xff))
+}
+
+func TestDecode(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	decoded, err := Decode(LinkTypeEthernet, newTestPacket(7, FlagSYN|FlagACK, "hello"))
+	expect.NoError(err)
+	expect.Equal(4, decoded.IPVersion)
+	expect.Equal("10.0.0.1", decoded.SrcIP.String())
+	expect.Equal("10.0.0.2", decoded.DstIP.String())
+	expect.Equal("06:07:08:09:0a:0b", decoded.SrcMAC.String())
+	expect.Equal("tcp", decoded.ProtocolName())
+	expect.Equal(uint16(40000), decoded.SrcPort)
+	expect.Equal(uint16(80), decoded.DstPort)
+	expect.Equal(uint32(7), decoded.Seq)
+	expect.Equal("S.", decoded.FlagNames())
+	expect.Equal("hello", string(decoded.Payload))
+
+	_, err = Decode(LinkTypeEthernet, []byte{1, 2, 3})
+	expect.NotNil(err)
+}
+
+func TestStreamAssembler(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	assembler := NewStreamAssembler(time.Second, 16)
+	now := time.Now()
+
+	add := func(seq uint32, flags uint8, payload string) []Stream {
+		decoded, err := Decode(LinkTypeEthernet, newTestPacket(seq, flags, payload))
+		expect.NoError(err)
+		return assembler.Add(decoded, now)
+	}
+
+	expect.Equal(0, len(add(99, FlagSYN, "")))
+	expect.Equal(0, len(add(100, FlagACK, "GET ")))
+	expect.Equal(0, len(add(106, FlagACK, "\r\n"))) // out of order
+	expect.Equal(0, len(add(100, FlagACK, "GET "))) // retransmission
+	expect.Equal(0, len(add(104, FlagACK, "/x")))
+
+	streams := add(108, FlagACK|FlagPSH, "\r\n")
+	expect.Equal(1, len(streams))
+	expect.Equal("GET /x\r\n\r\n", string(streams[0].Payload))
+	expect.Equal(uint16(80), streams[0].Header.DstPort)
+
+	streams = add(110, FlagACK, "0123456789abcdefXYZ")
+	expect.Equal(1, len(streams))
+	expect.Equal("0123456789abcdef", string(streams[0].Payload))
+
+	expect.Equal(0, len(assembler.Expire(now)))
+	streams = assembler.Expire(now.Add(time.Second))
+	expect.Equal(1, len(streams))
+	expect.Equal("XYZ", string(streams[0].Payload))
+
+	expect.Equal(0, len(add(200, FlagACK, "new")))
+	streams = add(203, FlagFIN|FlagACK, "")
+	expect.Equal(1, len(streams))
+	expect.Equal("new", string(streams[0].Payload))
+}
+
+func TestFilter(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	// tcpdump -ddd "tcp"
+	program, err := ParseFilter(`9
+40 0 0 12
+21 0 2 34525
+48 0 0 20
+21 3 4 6
+21 0 3 2048
+48 0 0 23
+21 0 1 6
+6 0 0 262144
+6 0 0 0`)
+	expect.NoError(err)
+	expect.Equal(9, len(program))
+
+	// tcpdump -dd "tcp"
+	programC, err := ParseFilter(`{ 0x28, 0, 0, 0x0000000c },
+{ 0x15, 0, 2, 0x000086dd },
+{ 0x30, 0, 0, 0x00000014 },
+{ 0x15, 3, 4, 0x00000006 },
+{ 0x15, 0, 3, 0x00000800 },
+{ 0x30, 0, 0, 0x00000017 },
+{ 0x15, 0, 1, 0x00000006 },
+{ 0x6, 0, 0, 0x00040000 },
+{ 0x6, 0, 0, 0x00000000 },`)
+	expect.NoError(err)
+	expect.Equal(program, programC)
+
+	filter, err := NewFilter(program)
+	if !expect.NoError(err) {
+		return
+	}
+
+	packet := newTestPacket(1, FlagACK, "hello")
+	expect.True(filter.Matches(packet))
+	packet[23] = ProtocolUDP
+	expect.False(filter.Matches(packet))
+
+	_, err = ParseFilter("1 2 3")
+	expect.NotNil(err)
+}
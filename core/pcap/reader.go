@@ -0,0 +1,362 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pcap contains pure go helpers to read pcap and pcapng files, decode
+// captured packets and reassemble TCP streams. It is used by consumer.Pcap.
+package pcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"time"
+)
+
+// LinkType defines the link layer header type of a captured packet.
+type LinkType uint32
+
+const (
+	// LinkTypeNull is used for BSD loopback devices
+	LinkTypeNull = LinkType(0)
+	// LinkTypeEthernet is used for Ethernet devices
+	LinkTypeEthernet = LinkType(1)
+	// LinkTypeRaw is used for captures starting with an IPv4 or IPv6 header
+	LinkTypeRaw = LinkType(101)
+	// LinkTypeLoop is used for OpenBSD loopback devices
+	LinkTypeLoop = LinkType(108)
+	// LinkTypeLinuxSLL is used for captures on the Linux "any" device
+	LinkTypeLinuxSLL = LinkType(113)
+	// LinkTypeIPv4 is used for captures starting with an IPv4 header
+	LinkTypeIPv4 = LinkType(228)
+	// LinkTypeIPv6 is used for captures starting with an IPv6 header
+	LinkTypeIPv6 = LinkType(229)
+)
+
+const (
+	pcapMagicMicro        = 0xa1b2c3d4
+	pcapMagicNano         = 0xa1b23c4d
+	pcapngBlockSection    = 0x0a0d0d0a
+	pcapngBlockInterface  = 0x00000001
+	pcapngBlockPacket     = 0x00000002
+	pcapngBlockSimple     = 0x00000003
+	pcapngBlockEnhanced   = 0x00000006
+	pcapngByteOrderMagic  = 0x1a2b3c4d
+	pcapngOptionEnd       = 0
+	pcapngOptionIfName    = 2
+	pcapngOptionIfTsresol = 9
+	maxBlockSize          = 16 * 1024 * 1024
+)
+
+// Packet is a captured packet including its link layer header.
+type Packet struct {
+	Timestamp      time.Time
+	LinkType       LinkType
+	Interface      string
+	Data           []byte
+	OriginalLength int
+}
+
+// Reader returns packets from a capture source. io.EOF is returned after the
+// last packet.
+type Reader interface {
+	ReadPacket() (*Packet, error)
+}
+
+// NewFileReader returns a reader for pcap or pcapng formatted data. The format
+// is detected by the magic number at the start of the data.
+func NewFileReader(source io.Reader) (Reader, error) {
+	buffered := bufio.NewReader(source)
+	magic, err := buffered.Peek(4)
+	if err != nil {
+		return nil, err
+	}
+
+	if binary.BigEndian.Uint32(magic) == pcapngBlockSection {
+		return newPcapngReader(buffered)
+	}
+	return newPcapReader(buffered)
+}
+
+// pcapReader reads the classic libpcap file format.
+type pcapReader struct {
+	source    io.Reader
+	order     binary.ByteOrder
+	nanos     bool
+	linkType  LinkType
+	snapLen   uint32
+	recHeader []byte
+}
+
+func newPcapReader(source io.Reader) (*pcapReader, error) {
+	header := make([]byte, 24)
+	if _, err := io.ReadFull(source, header); err != nil {
+		return nil, err
+	}
+
+	reader := &pcapReader{
+		source:    source,
+		recHeader: make([]byte, 16),
+	}
+
+	switch {
+	case binary.LittleEndian.Uint32(header) == pcapMagicMicro:
+		reader.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(header) == pcapMagicMicro:
+		reader.order = binary.BigEndian
+	case binary.LittleEndian.Uint32(header) == pcapMagicNano:
+		reader.order, reader.nanos = binary.LittleEndian, true
+	case binary.BigEndian.Uint32(header) == pcapMagicNano:
+		reader.order, reader.nanos = binary.BigEndian, true
+	default:
+		return nil, fmt.Errorf("Unknown capture file format")
+	}
+
+	reader.snapLen = reader.order.Uint32(header[16:])
+	reader.linkType = LinkType(reader.order.Uint32(header[20:]) & 0x0fffffff)
+	return reader, nil
+}
+
+// ReadPacket returns the next packet of the capture file.
+func (reader *pcapReader) ReadPacket() (*Packet, error) {
+	if _, err := io.ReadFull(reader.source, reader.recHeader); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+
+	seconds := int64(reader.order.Uint32(reader.recHeader[0:]))
+	fraction := int64(reader.order.Uint32(reader.recHeader[4:]))
+	capLen := reader.order.Uint32(reader.recHeader[8:])
+	origLen := reader.order.Uint32(reader.recHeader[12:])
+
+	if capLen > maxBlockSize {
+		return nil, fmt.Errorf("Packet of %d bytes exceeds maximum size", capLen)
+	}
+
+	data := make([]byte, capLen)
+	if _, err := io.ReadFull(reader.source, data); err != nil {
+		return nil, err
+	}
+
+	if !reader.nanos {
+		fraction *= 1000
+	}
+
+	return &Packet{
+		Timestamp:      time.Unix(seconds, fraction),
+		LinkType:       reader.linkType,
+		Data:           data,
+		OriginalLength: int(origLen),
+	}, nil
+}
+
+// pcapngInterface holds the properties of an interface description block.
+type pcapngInterface struct {
+	linkType       LinkType
+	name           string
+	unitsPerSecond uint64
+}
+
+// pcapngReader reads the pcapng file format.
+type pcapngReader struct {
+	source     io.Reader
+	order      binary.ByteOrder
+	interfaces []pcapngInterface
+}
+
+func newPcapngReader(source io.Reader) (*pcapngReader, error) {
+	reader := &pcapngReader{source: source}
+	if _, _, err := reader.readBlock(); err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+// readBlock reads the next block and returns its type and body. Section
+// header blocks are processed directly.
+func (reader *pcapngReader) readBlock() (uint32, []byte, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(reader.source, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return 0, nil, io.EOF
+		}
+		return 0, nil, err
+	}
+
+	blockType := binary.BigEndian.Uint32(header)
+	if blockType == pcapngBlockSection {
+		// The byte order magic defines the byte order of this section
+		bom := make([]byte, 4)
+		if _, err := io.ReadFull(reader.source, bom); err != nil {
+			return 0, nil, err
+		}
+		switch {
+		case binary.LittleEndian.Uint32(bom) == pcapngByteOrderMagic:
+			reader.order = binary.LittleEndian
+		case binary.BigEndian.Uint32(bom) == pcapngByteOrderMagic:
+			reader.order = binary.BigEndian
+		default:
+			return 0, nil, fmt.Errorf("Invalid pcapng byte order magic")
+		}
+		reader.interfaces = reader.interfaces[:0]
+
+		blockLen := reader.order.Uint32(header[4:])
+		if blockLen < 16 || blockLen > maxBlockSize {
+			return 0, nil, fmt.Errorf("Invalid pcapng block length %d", blockLen)
+		}
+		// Skip the remaining section header including the trailing length
+		_, err := io.CopyN(ioutil.Discard, reader.source, int64(blockLen-12))
+		return blockType, nil, err
+	}
+
+	if reader.order == nil {
+		return 0, nil, fmt.Errorf("pcapng block without section header")
+	}
+
+	blockType = reader.order.Uint32(header)
+	blockLen := reader.order.Uint32(header[4:])
+	if blockLen < 12 || blockLen > maxBlockSize {
+		return 0, nil, fmt.Errorf("Invalid pcapng block length %d", blockLen)
+	}
+
+	body := make([]byte, blockLen-8)
+	if _, err := io.ReadFull(reader.source, body); err != nil {
+		return 0, nil, err
+	}
+	return blockType, body[:len(body)-4], nil
+}
+
+// ReadPacket returns the next packet of the capture file.
+func (reader *pcapngReader) ReadPacket() (*Packet, error) {
+	for {
+		blockType, body, err := reader.readBlock()
+		if err != nil {
+			return nil, err
+		}
+
+		switch blockType {
+		case pcapngBlockInterface:
+			if err := reader.addInterface(body); err != nil {
+				return nil, err
+			}
+
+		case pcapngBlockEnhanced:
+			if len(body) < 20 {
+				return nil, fmt.Errorf("Truncated enhanced packet block")
+			}
+			timestamp := uint64(reader.order.Uint32(body[4:]))<<32 | uint64(reader.order.Uint32(body[8:]))
+			return reader.newPacket(reader.order.Uint32(body), timestamp,
+				reader.order.Uint32(body[12:]), reader.order.Uint32(body[16:]), body[20:])
+
+		case pcapngBlockPacket:
+			if len(body) < 20 {
+				return nil, fmt.Errorf("Truncated packet block")
+			}
+			timestamp := uint64(reader.order.Uint32(body[4:]))<<32 | uint64(reader.order.Uint32(body[8:]))
+			return reader.newPacket(uint32(reader.order.Uint16(body)), timestamp,
+				reader.order.Uint32(body[12:]), reader.order.Uint32(body[16:]), body[20:])
+
+		case pcapngBlockSimple:
+			if len(body) < 4 {
+				return nil, fmt.Errorf("Truncated simple packet block")
+			}
+			origLen := reader.order.Uint32(body)
+			capLen := origLen
+			if int(capLen) > len(body)-4 {
+				capLen = uint32(len(body) - 4)
+			}
+			return reader.newPacket(0, 0, capLen, origLen, body[4:])
+		}
+	}
+}
+
+func (reader *pcapngReader) addInterface(body []byte) error {
+	if len(body) < 8 {
+		return fmt.Errorf("Truncated interface description block")
+	}
+
+	iface := pcapngInterface{
+		linkType:       LinkType(reader.order.Uint16(body)),
+		unitsPerSecond: 1000000,
+	}
+
+	options := body[8:]
+	for len(options) >= 4 {
+		code := reader.order.Uint16(options)
+		length := int(reader.order.Uint16(options[2:]))
+		if code == pcapngOptionEnd || len(options) < 4+length {
+			break
+		}
+		value := options[4 : 4+length]
+
+		switch code {
+		case pcapngOptionIfName:
+			iface.name = string(value)
+		case pcapngOptionIfTsresol:
+			if length == 1 {
+				// Resolutions beyond 10^19 or 2^63 units do not fit into 64 bit
+				if exponent := value[0] & 0x7f; value[0]&0x80 == 0 {
+					if exponent > 19 {
+						return fmt.Errorf("Unsupported timestamp resolution 10^-%d", exponent)
+					}
+					iface.unitsPerSecond = uint64(math.Pow10(int(exponent)))
+				} else {
+					if exponent > 63 {
+						return fmt.Errorf("Unsupported timestamp resolution 2^-%d", exponent)
+					}
+					iface.unitsPerSecond = uint64(1) << exponent
+				}
+			}
+		}
+
+		// Options are padded to 32 bit
+		next := 4 + (length+3)&^3
+		if next > len(options) {
+			break
+		}
+		options = options[next:]
+	}
+
+	reader.interfaces = append(reader.interfaces, iface)
+	return nil
+}
+
+func (reader *pcapngReader) newPacket(ifaceID uint32, timestamp uint64, capLen uint32, origLen uint32, data []byte) (*Packet, error) {
+	if int(ifaceID) >= len(reader.interfaces) {
+		return nil, fmt.Errorf("Packet references unknown interface %d", ifaceID)
+	}
+	if int(capLen) > len(data) {
+		return nil, fmt.Errorf("Truncated packet data")
+	}
+
+	iface := reader.interfaces[ifaceID]
+	seconds := timestamp / iface.unitsPerSecond
+	fraction := timestamp % iface.unitsPerSecond
+	nanos := int64(float64(fraction) * 1e9 / float64(iface.unitsPerSecond))
+
+	packet := &Packet{
+		LinkType:       iface.linkType,
+		Interface:      iface.name,
+		Data:           append([]byte(nil), data[:capLen]...),
+		OriginalLength: int(origLen),
+	}
+	if timestamp != 0 {
+		packet.Timestamp = time.Unix(int64(seconds), nanos)
+	}
+	return packet, nil
+}
@@ -0,0 +1,237 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"time"
+)
+
+// maxPendingSegments is the number of out of order segments kept per flow
+// before missing data is skipped.
+const maxPendingSegments = 64
+
+// Stream is a chunk of reassembled payload. Header holds the headers of the
+// first packet contributing to the chunk.
+type Stream struct {
+	Header    Decoded
+	Timestamp time.Time
+	Payload   []byte
+}
+
+type flowKey struct {
+	srcIP   [16]byte
+	dstIP   [16]byte
+	srcPort uint16
+	dstPort uint16
+}
+
+type tcpFlow struct {
+	nextSeq  uint32
+	header   Decoded
+	last     Decoded
+	started  time.Time
+	lastSeen time.Time
+	data     []byte
+	pending  map[uint32][]byte
+}
+
+// StreamAssembler reassembles TCP payloads per connection and direction.
+// Data is emitted when the sender sets the PSH flag, the connection is closed,
+// MaxSize bytes are buffered or no data arrived within the timeout. UDP
+// payloads are passed through as-is. StreamAssembler is not threadsafe.
+type StreamAssembler struct {
+	timeout time.Duration
+	maxSize int
+	flows   map[flowKey]*tcpFlow
+}
+
+// NewStreamAssembler creates a new assembler emitting chunks of at most
+// maxSize bytes and closing idle flows after timeout.
+func NewStreamAssembler(timeout time.Duration, maxSize int) *StreamAssembler {
+	return &StreamAssembler{
+		timeout: timeout,
+		maxSize: maxSize,
+		flows:   make(map[flowKey]*tcpFlow),
+	}
+}
+
+func newFlowKey(packet Decoded) flowKey {
+	key := flowKey{srcPort: packet.SrcPort, dstPort: packet.DstPort}
+	copy(key.srcIP[:], packet.SrcIP.To16())
+	copy(key.dstIP[:], packet.DstIP.To16())
+	return key
+}
+
+// seqDiff returns a-b respecting sequence number wrap around.
+func seqDiff(a, b uint32) int32 {
+	return int32(a - b)
+}
+
+// Add processes a decoded packet captured at the given time and returns all
+// chunks that are complete.
+func (assembler *StreamAssembler) Add(packet Decoded, timestamp time.Time) []Stream {
+	if packet.Fragment {
+		return nil
+	}
+
+	switch packet.Protocol {
+	case ProtocolUDP:
+		if len(packet.Payload) == 0 {
+			return nil
+		}
+		return []Stream{{Header: packet, Timestamp: timestamp, Payload: packet.Payload}}
+	case ProtocolTCP:
+	default:
+		return nil
+	}
+
+	key := newFlowKey(packet)
+	flow, known := assembler.flows[key]
+	isSYN := packet.Flags&FlagSYN != 0
+
+	var streams []Stream
+	if known && isSYN && seqDiff(packet.Seq+1, flow.nextSeq) != 0 {
+		// A new connection reuses the same ports
+		streams = assembler.close(key, flow)
+		known = false
+	}
+
+	if !known {
+		flow = &tcpFlow{
+			nextSeq: packet.Seq,
+			pending: make(map[uint32][]byte),
+		}
+		if isSYN {
+			flow.nextSeq++
+		}
+		assembler.flows[key] = flow
+	}
+	flow.lastSeen = timestamp
+	flow.last = packet
+
+	if len(packet.Payload) > 0 {
+		streams = append(streams, assembler.addSegment(flow, packet, timestamp)...)
+	}
+
+	switch {
+	case packet.Flags&(FlagFIN|FlagRST) != 0:
+		streams = append(streams, assembler.close(key, flow)...)
+	case packet.Flags&FlagPSH != 0 && len(flow.pending) == 0:
+		streams = append(streams, flow.flush()...)
+	}
+	return streams
+}
+
+func (assembler *StreamAssembler) addSegment(flow *tcpFlow, packet Decoded, timestamp time.Time) []Stream {
+	seq, data := packet.Seq, packet.Payload
+
+	// Remove retransmitted data
+	if diff := seqDiff(flow.nextSeq, seq); diff > 0 {
+		if int(diff) >= len(data) {
+			return nil
+		}
+		seq, data = flow.nextSeq, data[diff:]
+	}
+
+	if seq != flow.nextSeq {
+		flow.pending[seq] = append([]byte(nil), data...)
+		if len(flow.pending) <= maxPendingSegments {
+			return nil // ### return, wait for missing segments ###
+		}
+		// Give up on the missing data and continue with the oldest segment
+		seq = flow.oldestPending()
+		data = flow.pending[seq]
+		delete(flow.pending, seq)
+		flow.nextSeq = seq
+	}
+
+	var streams []Stream
+	for data != nil {
+		if len(flow.data) == 0 {
+			flow.header = packet
+			flow.started = timestamp
+		}
+		flow.data = append(flow.data, data...)
+		flow.nextSeq += uint32(len(data))
+
+		for assembler.maxSize > 0 && len(flow.data) >= assembler.maxSize {
+			chunk := flow.data[:assembler.maxSize]
+			flow.data = append([]byte(nil), flow.data[assembler.maxSize:]...)
+			streams = append(streams, Stream{Header: flow.header, Timestamp: flow.started, Payload: chunk})
+		}
+
+		data = flow.pending[flow.nextSeq]
+		delete(flow.pending, flow.nextSeq)
+	}
+	return streams
+}
+
+func (flow *tcpFlow) oldestPending() uint32 {
+	first := true
+	var oldest uint32
+	for seq := range flow.pending {
+		if first || seqDiff(seq, oldest) < 0 {
+			oldest, first = seq, false
+		}
+	}
+	return oldest
+}
+
+func (flow *tcpFlow) flush() []Stream {
+	if len(flow.data) == 0 {
+		return nil
+	}
+	stream := Stream{Header: flow.header, Timestamp: flow.started, Payload: flow.data}
+	flow.data = nil
+	return []Stream{stream}
+}
+
+// close flushes all data of a flow, including out of order segments, and
+// removes the flow.
+func (assembler *StreamAssembler) close(key flowKey, flow *tcpFlow) []Stream {
+	delete(assembler.flows, key)
+	streams := flow.flush()
+	for len(flow.pending) > 0 {
+		seq := flow.oldestPending()
+		flow.nextSeq = seq
+		segment := flow.last
+		segment.Seq, segment.Payload = seq, flow.pending[seq]
+		delete(flow.pending, seq)
+		streams = append(streams, assembler.addSegment(flow, segment, flow.lastSeen)...)
+		streams = append(streams, flow.flush()...)
+	}
+	return streams
+}
+
+// Expire returns the buffered data of all flows that did not receive packets
+// since the timeout relative to now and removes these flows.
+func (assembler *StreamAssembler) Expire(now time.Time) []Stream {
+	var streams []Stream
+	for key, flow := range assembler.flows {
+		if now.Sub(flow.lastSeen) >= assembler.timeout {
+			streams = append(streams, assembler.close(key, flow)...)
+		}
+	}
+	return streams
+}
+
+// Flush returns the buffered data of all flows and removes all flows.
+func (assembler *StreamAssembler) Flush() []Stream {
+	var streams []Stream
+	for key, flow := range assembler.flows {
+		streams = append(streams, assembler.close(key, flow)...)
+	}
+	return streams
+}
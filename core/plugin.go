@@ -40,6 +40,11 @@ const (
 	PluginControlStopConsumer = PluginControl(iota)
 	// PluginControlRoll notifies the consumer/producer about a reconnect or reopen request
 	PluginControlRoll = PluginControl(iota)
+	// PluginControlPause notifies the consumer/producer to suspend processing
+	PluginControlPause = PluginControl(iota)
+	// PluginControlResume notifies the consumer/producer to continue processing
+	// after PluginControlPause
+	PluginControlResume = PluginControl(iota)
 )
 
 const (
@@ -136,6 +141,20 @@ func (state *PluginRunState) SetState(nextState PluginState) {
 	}
 }
 
+// CompareAndSetState sets nextState only if the current state is prevState.
+// True is returned if the state has been changed.
+func (state *PluginRunState) CompareAndSetState(prevState PluginState, nextState PluginState) bool {
+	if !atomic.CompareAndSwapInt32(&state.state, int32(prevState), int32(nextState)) {
+		return false
+	}
+
+	if nextState != prevState {
+		stateToMetric[prevState].Dec(1)
+		stateToMetric[nextState].Inc(1)
+	}
+	return true
+}
+
 // SetWorkerWaitGroup sets the WaitGroup used to manage workers
 func (state *PluginRunState) SetWorkerWaitGroup(workers *sync.WaitGroup) {
 	state.workers = workers
@@ -41,6 +41,11 @@ func TestPluginRunState(t *testing.T) {
 	pluginState.SetState(PluginStateStopping)
 	expect.Equal(PluginStateStopping, pluginState.GetState())
 
+	expect.False(pluginState.CompareAndSetState(PluginStateWaiting, PluginStateActive))
+	expect.Equal(PluginStateStopping, pluginState.GetState())
+	expect.True(pluginState.CompareAndSetState(PluginStateStopping, PluginStateDead))
+	expect.Equal(PluginStateDead, pluginState.GetState())
+
 	var wg sync.WaitGroup
 	pluginState.SetWorkerWaitGroup(&wg)
 
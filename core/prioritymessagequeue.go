@@ -0,0 +1,222 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/trivago/tgo/tsync"
+)
+
+// PriorityMessageQueue is a message queue with one level per message
+// priority. Messages of a higher priority are always popped first. All levels
+// share the same capacity. If the queue is full, messages of a higher
+// priority can optionally replace messages of a lower priority.
+type PriorityMessageQueue struct {
+	levels [numMessagePriorities]MessageQueue
+	slots  chan struct{}
+	shed   bool
+	closed int32
+}
+
+// NewPriorityMessageQueue creates a new priority queue of the given total
+// capacity. If shed is true, messages of a higher priority will replace
+// messages of the lowest queued priority if the queue is full.
+func NewPriorityMessageQueue(capacity int, shed bool) *PriorityMessageQueue {
+	queue := &PriorityMessageQueue{
+		slots: make(chan struct{}, capacity),
+		shed:  shed,
+	}
+	for i := range queue.levels {
+		queue.levels[i] = NewMessageQueue(capacity)
+	}
+	return queue
+}
+
+// Push adds a message to the queue level matching its priority. The timeout
+// behaves like the timeout of MessageQueue.Push. If the queue is full and
+// shedding is enabled, the oldest message of the lowest queued priority below
+// the priority of msg is removed from the queue and returned as second value.
+// The caller is responsible for discarding that message.
+func (queue *PriorityMessageQueue) Push(msg *Message, timeout time.Duration) (state MessageQueueResult, shed *Message) {
+	defer func() {
+		// Treat closed channels like timeouts
+		if recover() != nil {
+			state = MessageQueueTimeout
+		}
+	}()
+
+	if atomic.LoadInt32(&queue.closed) != 0 {
+		return MessageQueueTimeout, nil // ### return, closed ###
+	}
+
+	level := queue.levels[msg.GetPriority().index()]
+
+	// A shed message frees a slot that is directly used by msg
+	select {
+	case queue.slots <- struct{}{}:
+	default:
+		if shed = queue.tryShed(msg.GetPriority()); shed != nil {
+			level <- msg
+			return MessageQueueOk, shed // ### return, replaced lower priority ###
+		}
+		if state = queue.waitForSlot(timeout); state != MessageQueueOk {
+			return state, nil // ### return, no slot available ###
+		}
+	}
+
+	level <- msg
+	return MessageQueueOk, nil
+}
+
+func (queue *PriorityMessageQueue) waitForSlot(timeout time.Duration) MessageQueueResult {
+	if timeout == 0 {
+		queue.slots <- struct{}{}
+		return MessageQueueOk // ### return, done ###
+	}
+
+	if timeout < 0 {
+		return MessageQueueDiscard // ### return, discard and ignore ###
+	}
+
+	start := time.Now()
+	spin := tsync.NewSpinner(tsync.SpinPriorityHigh)
+	for {
+		select {
+		case queue.slots <- struct{}{}:
+			return MessageQueueOk // ### return, done ###
+
+		default:
+			if time.Since(start) > timeout {
+				return MessageQueueTimeout // ### return, fallback ###
+			}
+			spin.Yield()
+		}
+	}
+}
+
+// tryShed removes the oldest message of the lowest queued priority that is
+// lower than the given priority.
+func (queue *PriorityMessageQueue) tryShed(priority MessagePriority) *Message {
+	if !queue.shed {
+		return nil
+	}
+
+	for i := 0; i < priority.index(); i++ {
+		select {
+		case msg := <-queue.levels[i]:
+			msg.GetPriority().GetMetric().Shed.Inc(1)
+			return msg
+		default:
+		}
+	}
+	return nil
+}
+
+// IsEmpty returns true if no element is currently stored in the queue.
+// Please note that this information can be extremely volatile in multithreaded
+// environments.
+func (queue *PriorityMessageQueue) IsEmpty() bool {
+	return queue.GetNumQueued() == 0
+}
+
+// GetNumQueued returns the number of queued messages over all priorities.
+// Please note that this information can be extremely volatile in multithreaded
+// environments.
+func (queue *PriorityMessageQueue) GetNumQueued() int {
+	numQueued := 0
+	for _, level := range queue.levels {
+		numQueued += len(level)
+	}
+	return numQueued
+}
+
+// GetNumQueuedWithPriority returns the number of queued messages of the given
+// priority.
+func (queue *PriorityMessageQueue) GetNumQueuedWithPriority(priority MessagePriority) int {
+	return len(queue.levels[priority.index()])
+}
+
+// Pop returns the message with the highest priority from the queue. If the
+// queue is empty, this function blocks until a message is available. If the
+// queue has been closed and is empty, the second return value is false.
+func (queue *PriorityMessageQueue) Pop() (*Message, bool) {
+	return queue.pop(nil)
+}
+
+// PopWithTimeout works like Pop but returns after maxDuration if no message
+// is available. In that case the second return value is false.
+func (queue *PriorityMessageQueue) PopWithTimeout(maxDuration time.Duration) (*Message, bool) {
+	timeout := time.NewTimer(maxDuration)
+	defer timeout.Stop()
+	return queue.pop(timeout.C)
+}
+
+func (queue *PriorityMessageQueue) pop(timeout <-chan time.Time) (*Message, bool) {
+	for {
+		if msg := queue.tryPop(); msg != nil {
+			return msg, true // ### return, message available ###
+		}
+
+		if atomic.LoadInt32(&queue.closed) != 0 {
+			return nil, false // ### return, closed and empty ###
+		}
+
+		// Wait for any level to receive a message. As the queue was empty
+		// before, this is the message with the highest priority unless
+		// multiple messages arrived at the same time.
+		var msg *Message
+		var more bool
+		select {
+		case msg, more = <-queue.levels[3]:
+		case msg, more = <-queue.levels[2]:
+		case msg, more = <-queue.levels[1]:
+		case msg, more = <-queue.levels[0]:
+		case <-timeout:
+			return nil, false // ### return, timed out ###
+		}
+
+		if more {
+			<-queue.slots
+			return msg, true // ### return, message available ###
+		}
+	}
+}
+
+// tryPop returns the queued message of the highest priority or nil if the
+// queue is empty.
+func (queue *PriorityMessageQueue) tryPop() *Message {
+	for i := len(queue.levels) - 1; i >= 0; i-- {
+		select {
+		case msg, more := <-queue.levels[i]:
+			if more {
+				<-queue.slots
+				return msg
+			}
+		default:
+		}
+	}
+	return nil
+}
+
+// Close stops the queue from being able to receive messages
+func (queue *PriorityMessageQueue) Close() {
+	if atomic.CompareAndSwapInt32(&queue.closed, 0, 1) {
+		for _, level := range queue.levels {
+			level.Close()
+		}
+	}
+}
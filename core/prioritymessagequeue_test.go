@@ -0,0 +1,145 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func newPriorityTestMessage(payload string, priority MessagePriority) *Message {
+	msg := NewMessage(nil, []byte(payload), nil, InvalidStreamID)
+	msg.SetPriority(priority)
+	return msg
+}
+
+func TestParseMessagePriority(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	priority, err := ParseMessagePriority("Critical")
+	expect.NoError(err)
+	expect.Equal(MessagePriorityCritical, priority)
+	expect.Equal("critical", priority.String())
+
+	priority, err = ParseMessagePriority("low")
+	expect.NoError(err)
+	expect.Equal(MessagePriorityLow, priority)
+
+	_, err = ParseMessagePriority("urgent")
+	expect.NotNil(err)
+}
+
+func TestPriorityMessageQueueOrder(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	queue := NewPriorityMessageQueue(4, false)
+
+	queue.Push(newPriorityTestMessage("low", MessagePriorityLow), 0)
+	queue.Push(newPriorityTestMessage("normal", MessagePriorityNormal), 0)
+	queue.Push(newPriorityTestMessage("critical", MessagePriorityCritical), 0)
+	queue.Push(newPriorityTestMessage("high", MessagePriorityHigh), 0)
+	expect.Equal(4, queue.GetNumQueued())
+	expect.Equal(1, queue.GetNumQueuedWithPriority(MessagePriorityHigh))
+
+	for _, expected := range []string{"critical", "high", "normal", "low"} {
+		msg, more := queue.Pop()
+		expect.True(more)
+		expect.Equal(expected, msg.String())
+	}
+
+	expect.True(queue.IsEmpty())
+	_, more := queue.PopWithTimeout(10 * time.Millisecond)
+	expect.False(more)
+}
+
+func TestPriorityMessageQueueFull(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	queue := NewPriorityMessageQueue(1, false)
+
+	state, shed := queue.Push(newPriorityTestMessage("low", MessagePriorityLow), 0)
+	expect.Equal(MessageQueueOk, state)
+	expect.Nil(shed)
+
+	state, shed = queue.Push(newPriorityTestMessage("critical", MessagePriorityCritical), -1)
+	expect.Equal(MessageQueueDiscard, state)
+	expect.Nil(shed)
+
+	state, _ = queue.Push(newPriorityTestMessage("critical", MessagePriorityCritical), 10*time.Millisecond)
+	expect.Equal(MessageQueueTimeout, state)
+}
+
+func TestPriorityMessageQueueShedding(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	queue := NewPriorityMessageQueue(2, true)
+
+	queue.Push(newPriorityTestMessage("normal", MessagePriorityNormal), 0)
+	queue.Push(newPriorityTestMessage("low", MessagePriorityLow), 0)
+
+	// Messages of the same or lower priority are not shed
+	state, shed := queue.Push(newPriorityTestMessage("low2", MessagePriorityLow), -1)
+	expect.Equal(MessageQueueDiscard, state)
+	expect.Nil(shed)
+
+	// The lowest priority is shed first
+	shedCount := MessagePriorityLow.GetMetric().Shed.Count()
+	state, shed = queue.Push(newPriorityTestMessage("critical", MessagePriorityCritical), -1)
+	expect.Equal(MessageQueueOk, state)
+	expect.NotNil(shed)
+	expect.Equal("low", shed.String())
+	expect.Equal(shedCount+1, MessagePriorityLow.GetMetric().Shed.Count())
+
+	state, shed = queue.Push(newPriorityTestMessage("high", MessagePriorityHigh), -1)
+	expect.Equal(MessageQueueOk, state)
+	expect.Equal("normal", shed.String())
+	expect.Equal(2, queue.GetNumQueued())
+
+	msg, _ := queue.Pop()
+	expect.Equal("critical", msg.String())
+	msg, _ = queue.Pop()
+	expect.Equal("high", msg.String())
+}
+
+func TestPriorityMessageQueueClose(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	queue := NewPriorityMessageQueue(2, true)
+
+	queue.Push(newPriorityTestMessage("high", MessagePriorityHigh), 0)
+	queue.Close()
+
+	state, _ := queue.Push(newPriorityTestMessage("normal", MessagePriorityNormal), 0)
+	expect.Equal(MessageQueueTimeout, state)
+
+	msg, more := queue.Pop()
+	expect.True(more)
+	expect.Equal("high", msg.String())
+
+	_, more = queue.Pop()
+	expect.False(more)
+}
+
+func TestPriorityMessageQueueBlockingPop(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	queue := NewPriorityMessageQueue(2, true)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		queue.Push(newPriorityTestMessage("normal", MessagePriorityNormal), 0)
+	}()
+
+	msg, more := queue.PopWithTimeout(time.Second)
+	expect.True(more)
+	expect.Equal("normal", msg.String())
+}
@@ -0,0 +1,222 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: prompb/remote.proto
+
+package prompb
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type WriteRequest struct {
+	Timeseries           []*TimeSeries `protobuf:"bytes,1,rep,name=timeseries,proto3" json:"timeseries,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
+	XXX_unrecognized     []byte        `json:"-"`
+	XXX_sizecache        int32         `json:"-"`
+}
+
+func (m *WriteRequest) Reset()         { *m = WriteRequest{} }
+func (m *WriteRequest) String() string { return proto.CompactTextString(m) }
+func (*WriteRequest) ProtoMessage()    {}
+func (*WriteRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_remote_5dbcb7b8d93405b1, []int{0}
+}
+func (m *WriteRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_WriteRequest.Unmarshal(m, b)
+}
+func (m *WriteRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_WriteRequest.Marshal(b, m, deterministic)
+}
+func (dst *WriteRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_WriteRequest.Merge(dst, src)
+}
+func (m *WriteRequest) XXX_Size() int {
+	return xxx_messageInfo_WriteRequest.Size(m)
+}
+func (m *WriteRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_WriteRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_WriteRequest proto.InternalMessageInfo
+
+func (m *WriteRequest) GetTimeseries() []*TimeSeries {
+	if m != nil {
+		return m.Timeseries
+	}
+	return nil
+}
+
+type TimeSeries struct {
+	Labels               []*Label  `protobuf:"bytes,1,rep,name=labels,proto3" json:"labels,omitempty"`
+	Samples              []*Sample `protobuf:"bytes,2,rep,name=samples,proto3" json:"samples,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
+	XXX_unrecognized     []byte    `json:"-"`
+	XXX_sizecache        int32     `json:"-"`
+}
+
+func (m *TimeSeries) Reset()         { *m = TimeSeries{} }
+func (m *TimeSeries) String() string { return proto.CompactTextString(m) }
+func (*TimeSeries) ProtoMessage()    {}
+func (*TimeSeries) Descriptor() ([]byte, []int) {
+	return fileDescriptor_remote_5dbcb7b8d93405b1, []int{1}
+}
+func (m *TimeSeries) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TimeSeries.Unmarshal(m, b)
+}
+func (m *TimeSeries) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TimeSeries.Marshal(b, m, deterministic)
+}
+func (dst *TimeSeries) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TimeSeries.Merge(dst, src)
+}
+func (m *TimeSeries) XXX_Size() int {
+	return xxx_messageInfo_TimeSeries.Size(m)
+}
+func (m *TimeSeries) XXX_DiscardUnknown() {
+	xxx_messageInfo_TimeSeries.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TimeSeries proto.InternalMessageInfo
+
+func (m *TimeSeries) GetLabels() []*Label {
+	if m != nil {
+		return m.Labels
+	}
+	return nil
+}
+
+func (m *TimeSeries) GetSamples() []*Sample {
+	if m != nil {
+		return m.Samples
+	}
+	return nil
+}
+
+type Label struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Value                string   `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Label) Reset()         { *m = Label{} }
+func (m *Label) String() string { return proto.CompactTextString(m) }
+func (*Label) ProtoMessage()    {}
+func (*Label) Descriptor() ([]byte, []int) {
+	return fileDescriptor_remote_5dbcb7b8d93405b1, []int{2}
+}
+func (m *Label) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Label.Unmarshal(m, b)
+}
+func (m *Label) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Label.Marshal(b, m, deterministic)
+}
+func (dst *Label) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Label.Merge(dst, src)
+}
+func (m *Label) XXX_Size() int {
+	return xxx_messageInfo_Label.Size(m)
+}
+func (m *Label) XXX_DiscardUnknown() {
+	xxx_messageInfo_Label.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Label proto.InternalMessageInfo
+
+func (m *Label) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Label) GetValue() string {
+	if m != nil {
+		return m.Value
+	}
+	return ""
+}
+
+type Sample struct {
+	Value                float64  `protobuf:"fixed64,1,opt,name=value,proto3" json:"value,omitempty"`
+	Timestamp            int64    `protobuf:"varint,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Sample) Reset()         { *m = Sample{} }
+func (m *Sample) String() string { return proto.CompactTextString(m) }
+func (*Sample) ProtoMessage()    {}
+func (*Sample) Descriptor() ([]byte, []int) {
+	return fileDescriptor_remote_5dbcb7b8d93405b1, []int{3}
+}
+func (m *Sample) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Sample.Unmarshal(m, b)
+}
+func (m *Sample) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Sample.Marshal(b, m, deterministic)
+}
+func (dst *Sample) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Sample.Merge(dst, src)
+}
+func (m *Sample) XXX_Size() int {
+	return xxx_messageInfo_Sample.Size(m)
+}
+func (m *Sample) XXX_DiscardUnknown() {
+	xxx_messageInfo_Sample.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Sample proto.InternalMessageInfo
+
+func (m *Sample) GetValue() float64 {
+	if m != nil {
+		return m.Value
+	}
+	return 0
+}
+
+func (m *Sample) GetTimestamp() int64 {
+	if m != nil {
+		return m.Timestamp
+	}
+	return 0
+}
+
+func init() {
+	proto.RegisterType((*WriteRequest)(nil), "prometheus.WriteRequest")
+	proto.RegisterType((*TimeSeries)(nil), "prometheus.TimeSeries")
+	proto.RegisterType((*Label)(nil), "prometheus.Label")
+	proto.RegisterType((*Sample)(nil), "prometheus.Sample")
+}
+
+func init() { proto.RegisterFile("prompb/remote.proto", fileDescriptor_remote_5dbcb7b8d93405b1) }
+
+var fileDescriptor_remote_5dbcb7b8d93405b1 = []byte{
+	// 223 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x4c, 0x90, 0xb1, 0x4b, 0xc4, 0x30,
+	0x14, 0xc6, 0xe9, 0x9d, 0x57, 0xbd, 0xa7, 0x8b, 0x4f, 0x91, 0x0e, 0x0e, 0x47, 0xa7, 0x13, 0xa4,
+	0xa2, 0x82, 0x93, 0x93, 0x83, 0x93, 0x53, 0x4e, 0x10, 0xdc, 0x52, 0xf8, 0xc0, 0x40, 0x62, 0x62,
+	0x92, 0xfa, 0xf7, 0x1f, 0x7d, 0xbd, 0x23, 0xdd, 0xda, 0xef, 0xf7, 0xfb, 0x3e, 0xc8, 0xa3, 0xab,
+	0x10, 0xbd, 0x0b, 0xfd, 0x43, 0x84, 0xf3, 0x19, 0x5d, 0x88, 0x3e, 0x7b, 0xa6, 0x31, 0x44, 0xfe,
+	0xc1, 0x90, 0xda, 0x77, 0xba, 0xf8, 0x8a, 0x26, 0x43, 0xe1, 0x6f, 0x40, 0xca, 0xfc, 0x42, 0x94,
+	0x8d, 0x43, 0x42, 0x34, 0x48, 0x4d, 0xb5, 0x59, 0x6e, 0xcf, 0x9f, 0x6e, 0xba, 0x52, 0xe8, 0x3e,
+	0x8d, 0xc3, 0x4e, 0xa8, 0x9a, 0x99, 0x2d, 0x88, 0x0a, 0xe1, 0x3b, 0xaa, 0xad, 0xee, 0x61, 0x8f,
+	0x0b, 0x97, 0xf3, 0x85, 0x8f, 0x91, 0xa8, 0x83, 0xc0, 0xf7, 0x74, 0x9a, 0xb4, 0x0b, 0x16, 0xa9,
+	0x59, 0x88, 0xcb, 0x73, 0x77, 0x27, 0x48, 0x1d, 0x95, 0xf6, 0x91, 0x56, 0x52, 0x67, 0xa6, 0x93,
+	0x5f, 0xed, 0xd0, 0x54, 0x9b, 0x6a, 0xbb, 0x56, 0xf2, 0xcd, 0xd7, 0xb4, 0xfa, 0xd7, 0x76, 0x40,
+	0xb3, 0x90, 0x70, 0xfa, 0x69, 0x5f, 0xa9, 0x9e, 0x56, 0x0a, 0x1f, 0x4b, 0xd5, 0x81, 0xf3, 0x2d,
+	0xad, 0xe5, 0x1d, 0x59, 0xbb, 0x20, 0xcd, 0xa5, 0x2a, 0xc1, 0xdb, 0xd9, 0x77, 0x3d, 0x9d, 0xb0,
+	0xaf, 0xe5, 0x78, 0xcf, 0xfb, 0x01, 0x00, 0xd3, 0xd8, 0x2b, 0x8e, 0x53, 0x01, 0x00, 0x00,
+}
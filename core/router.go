@@ -46,7 +46,8 @@ type Router interface {
 }
 
 // Route tries to enqueue a message to the given stream. This function also
-// handles redirections enforced by formatters.
+// handles redirections enforced by formatters. Messages that cannot be routed
+// are released by this call.
 func Route(msg *Message, router Router) error {
 	if router == nil {
 		DiscardMessage(msg, "nil", fmt.Sprintf("Router for stream %s is nil", msg.GetStreamID().GetName()))
@@ -73,6 +74,7 @@ func Route(msg *Message, router Router) error {
 		if msg.GetStreamID() == router.GetStreamID() {
 
 			prevStreamName := StreamRegistry.GetStreamName(msg.GetPrevStreamID())
+			msg.Release()
 			return NewModulateResultError("Routing loop detected for router %s (from %s)", streamName, prevStreamName)
 		}
 
@@ -84,6 +86,7 @@ func Route(msg *Message, router Router) error {
 		return Route(msg, msg.GetRouter())
 	}
 
+	msg.Release()
 	return NewModulateResultError("Unknown ModulateResult action: %d", action)
 }
 
@@ -94,8 +97,10 @@ func RouteOriginal(msg *Message, router Router) error {
 }
 
 // DiscardMessage increases the discard statistic and discards the given
-// message.
+// message. Pooled messages are released by this call.
 func DiscardMessage(msg *Message, pluginID string, comment string) {
 	GetStreamMetric(msg.GetStreamID()).Discarded.Inc(1)
+	msg.GetPriority().GetMetric().Discarded.Inc(1)
 	MessageTrace(msg, pluginID, comment)
+	msg.Release()
 }
@@ -58,6 +58,12 @@ import (
 // before they are fetched by the next free modulator go routine. If the
 // ModulatorRoutines parameter is set to 0 this parameter is ignored.
 // By default this parameter is set to 1024.
+//
+// - Priority: Defines the priority of all messages created by this consumer.
+// Valid values are "low", "normal", "high" and "critical". Producers process
+// messages of a higher priority first. The priority can be changed by
+// modulators, e.g. format.Priority.
+// By default this parameter is set to "normal".
 type SimpleConsumer struct {
 	id              string
 	control         chan PluginControl
@@ -65,10 +71,13 @@ type SimpleConsumer struct {
 	routers         []Router       `config:"Streams"`
 	modulators      ModulatorArray `config:"Modulators"`
 	onRoll          func()
+	onPause         func()
+	onResume        func()
 	onPrepareStop   func()
 	onStop          func()
 	enqueueMessage  func(*Message)
 	modulatorQueue  MessageQueue
+	priority        MessagePriority
 	Logger          logrus.FieldLogger
 	shutdownTimeout time.Duration `config:"ShutdownTimeoutMs" default:"1000" metric:"ms"`
 }
@@ -80,6 +89,10 @@ func (cons *SimpleConsumer) Configure(conf PluginConfigReader) {
 	cons.runState = NewPluginRunState()
 	cons.control = make(chan PluginControl, 1)
 
+	priority, err := ParseMessagePriority(conf.GetString("Priority", "normal"))
+	conf.Errors.Push(err)
+	cons.priority = priority
+
 	numRoutines := conf.GetInt("ModulatorRoutines", 0)
 	queueSize := conf.GetInt("ModulatorQueueSize", 1024)
 
@@ -164,6 +177,16 @@ func (cons *SimpleConsumer) SetRollCallback(onRoll func()) {
 	cons.onRoll = onRoll
 }
 
+// SetPauseCallback sets the function to be called upon PluginControlPause
+func (cons *SimpleConsumer) SetPauseCallback(onPause func()) {
+	cons.onPause = onPause
+}
+
+// SetResumeCallback sets the function to be called upon PluginControlResume
+func (cons *SimpleConsumer) SetResumeCallback(onResume func()) {
+	cons.onResume = onResume
+}
+
 // SetPrepareStopCallback sets the function to be called upon PluginControlPrepareStop
 func (cons *SimpleConsumer) SetPrepareStopCallback(onPrepareStop func()) {
 	cons.onPrepareStop = onPrepareStop
@@ -206,6 +229,53 @@ func (cons *SimpleConsumer) Enqueue(data []byte) {
 // EnqueueWithMetadata works like EnqueueWithSequence and allows to set meta data directly
 func (cons *SimpleConsumer) EnqueueWithMetadata(data []byte, metaData Metadata) {
 	msg := NewMessage(cons, data, metaData, InvalidStreamID)
+	msg.SetPriority(cons.priority)
+	cons.enqueueMessage(msg)
+}
+
+// EnqueueWithReleaseCallback works like EnqueueWithMetadata and calls
+// onRelease once the message and all its copies have been released by the
+// producers (see Message.SetReleaseCallback). This can be used to acknowledge
+// messages to the source after they have been processed.
+func (cons *SimpleConsumer) EnqueueWithReleaseCallback(data []byte, metaData Metadata, onRelease func()) {
+	msg := NewMessage(cons, data, metaData, InvalidStreamID)
+	msg.SetPriority(cons.priority)
+	msg.SetReleaseCallback(onRelease)
+	cons.enqueueMessage(msg)
+}
+
+// EnqueuePooled works like EnqueueWithMetadata but takes the message from the
+// message pool. Data is copied to the message. This should be preferred by
+// consumers generating a large number of small messages.
+func (cons *SimpleConsumer) EnqueuePooled(data []byte, metaData Metadata) {
+	msg := NewPooledMessage(cons, data, metaData, InvalidStreamID)
+	msg.SetPriority(cons.priority)
+	cons.enqueueMessage(msg)
+}
+
+// EnqueueBuffer works like EnqueuePooled but does not copy the given buffer.
+// The buffer must not be modified by the consumer until it is passed back via
+// recycle. See NewPooledMessageWithBuffer.
+func (cons *SimpleConsumer) EnqueueBuffer(buffer []byte, metaData Metadata, recycle func([]byte)) {
+	msg := NewPooledMessageWithBuffer(cons, buffer, metaData, InvalidStreamID, recycle)
+	msg.SetPriority(cons.priority)
+	cons.enqueueMessage(msg)
+}
+
+// EnqueueWithStream works like EnqueueWithMetadata but sends the message to
+// the given stream only, instead of the streams configured for this consumer.
+func (cons *SimpleConsumer) EnqueueWithStream(data []byte, metaData Metadata, streamID MessageStreamID) {
+	msg := NewMessage(cons, data, metaData, streamID)
+	msg.SetPriority(cons.priority)
+	cons.enqueueMessage(msg)
+}
+
+// EnqueueMessage passes an existing message, e.g. one created by
+// DeserializeMessage, to the modulators of this consumer. The message is sent
+// to the stream it is currently assigned to. Stream IDs, priority and
+// timestamp of the message are preserved.
+func (cons *SimpleConsumer) EnqueueMessage(msg *Message) {
+	msg.source = cons
 	cons.enqueueMessage(msg)
 }
 
@@ -222,6 +292,9 @@ loop:
 }
 
 func (cons *SimpleConsumer) directEnqueue(msg *Message) {
+	// Messages created for a specific stream are not sent to all streams
+	targetStreamID := msg.GetStreamID()
+
 	// Execute configured modulators
 	switch cons.modulators.Modulate(msg) {
 	case ModulateResultDiscard:
@@ -232,12 +305,20 @@ func (cons *SimpleConsumer) directEnqueue(msg *Message) {
 		if err := RouteOriginal(msg, msg.GetRouter()); err != nil {
 			cons.Logger.Error(err)
 		}
+		msg.Release()
 		return
 	}
 
 	MetricMessagesEnqued.Inc(1)
 	MessageTrace(msg, cons.GetID(), "Enqueued by consumer")
 
+	if targetStreamID != InvalidStreamID {
+		if err := Route(msg, msg.GetRouter()); err != nil {
+			cons.Logger.Error(err)
+		}
+		return // ### return, sent to target stream ###
+	}
+
 	// Send message to all routers registered to this consumer
 	// Last message will not be cloned.
 	numRouters := len(cons.routers)
@@ -304,6 +385,18 @@ func (cons *SimpleConsumer) ControlLoop() {
 			if cons.onRoll != nil {
 				cons.onRoll()
 			}
+
+		case PluginControlPause:
+			cons.Logger.Debug("Received pause command")
+			if cons.onPause != nil {
+				cons.onPause()
+			}
+
+		case PluginControlResume:
+			cons.Logger.Debug("Received resume command")
+			if cons.onResume != nil {
+				cons.onResume()
+			}
 		}
 	}
 }
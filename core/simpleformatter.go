@@ -34,10 +34,12 @@ import (
 // that is empty or - in case of metadata - not existing.
 // By default this parameter is set to false
 type SimpleFormatter struct {
-	Logger            logrus.FieldLogger
-	GetAppliedContent GetAppliedContent
-	SetAppliedContent SetAppliedContent
-	SkipIfEmpty       bool `config:"SkipIfEmpty"`
+	Logger             logrus.FieldLogger
+	GetAppliedContent  GetAppliedContent
+	SetAppliedContent  SetAppliedContent
+	GetAppliedDocument GetAppliedDocument
+	SetAppliedDocument SetAppliedDocument
+	SkipIfEmpty        bool `config:"SkipIfEmpty"`
 }
 
 // Configure sets up all values required by SimpleFormatter.
@@ -47,6 +49,8 @@ func (format *SimpleFormatter) Configure(conf PluginConfigReader) {
 	applyTo := conf.GetString("ApplyTo", "")
 	format.GetAppliedContent = GetAppliedContentGetFunction(applyTo)
 	format.SetAppliedContent = GetAppliedContentSetFunction(applyTo)
+	format.GetAppliedDocument = GetAppliedDocumentGetFunction(applyTo)
+	format.SetAppliedDocument = GetAppliedDocumentSetFunction(applyTo)
 }
 
 // CanBeApplied returns true if the formatter can be applied to this message
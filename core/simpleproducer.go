@@ -196,6 +196,15 @@ func (prod *SimpleProducer) Modulate(msg *Message) ModulateResult {
 	return ModulateResultContinue
 }
 
+// detach returns a message that may be modified by the modulators of this
+// producer. Shared messages are copied if modulators are configured.
+func (prod *SimpleProducer) detach(msg *Message) *Message {
+	if len(prod.modulators) == 0 {
+		return msg
+	}
+	return msg.Detach()
+}
+
 // HasContinueAfterModulate applies all modulators by Modulate, handle the ModulateResult
 // and return if you have to continue the message process.
 // This method is a default producer modulate handling.
@@ -221,11 +230,20 @@ func (prod *SimpleProducer) HasContinueAfterModulate(msg *Message) bool {
 	}
 }
 
-// TryFallback routes the message to the configured fallback stream.
+// TryFallback routes the message to the configured fallback stream. The
+// message is released by this call.
 func (prod *SimpleProducer) TryFallback(msg *Message) {
 	if err := RouteOriginal(msg, prod.fallbackStream); err != nil {
 		prod.Logger.WithError(err).Error("Failed to route to fallback")
 	}
+	msg.Release()
+}
+
+// TryFallbackAll calls TryFallback for each of the given messages.
+func (prod *SimpleProducer) TryFallbackAll(messages []*Message) {
+	for _, msg := range messages {
+		prod.TryFallback(msg)
+	}
 }
 
 // ControlLoop listens to the control channel and triggers callbacks for these
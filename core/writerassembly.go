@@ -77,6 +77,7 @@ func (asm *WriterAssembly) getWriter() io.Writer {
 // a MessageBatch to an io.Writer.
 // Messages are formatted using a given formatter. If the io.Writer fails to
 // write the assembled buffer all messages are passed to the FLush() method.
+// Pooled messages are released after they have been written successfully.
 func (asm *WriterAssembly) Write(messages []*Message) {
 	writer := asm.getWriter()
 
@@ -112,6 +113,12 @@ func (asm *WriterAssembly) Write(messages []*Message) {
 	// Data sent, flush if validation is required and fails
 	if asm.validate != nil && !asm.validate() {
 		asm.Flush(messages)
+		return // ### return, not validated ###
+	}
+
+	// Messages have been written and are not required anymore
+	for _, msg := range messages {
+		msg.Release()
 	}
 }
 
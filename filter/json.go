@@ -15,7 +15,6 @@
 package filter
 
 import (
-	"encoding/json"
 	"github.com/trivago/gollum/core"
 	"github.com/trivago/tgo/tcontainer"
 	"regexp"
@@ -62,7 +61,7 @@ type JSON struct {
 	core.SimpleFilter `gollumdoc:"embed_type"`
 	rejectValues      map[string]*regexp.Regexp
 	acceptValues      map[string]*regexp.Regexp
-	getAppliedContent core.GetAppliedContent
+	getAppliedDocument core.GetAppliedDocument
 }
 
 func init() {
@@ -93,7 +92,7 @@ func (filter *JSON) Configure(conf core.PluginConfigReader) {
 	}
 
 	applyTo := conf.GetString("ApplyTo", "")
-	filter.getAppliedContent = core.GetAppliedContentGetFunction(applyTo)
+	filter.getAppliedDocument = core.GetAppliedDocumentGetFunction(applyTo)
 }
 
 func (filter *JSON) getValue(key string, values tcontainer.MarshalMap) (string, bool) {
@@ -115,8 +114,8 @@ func (filter *JSON) getValue(key string, values tcontainer.MarshalMap) (string,
 
 // ApplyFilter check if all Filter wants to reject the message
 func (filter *JSON) ApplyFilter(msg *core.Message) (core.FilterResult, error) {
-	values := tcontainer.NewMarshalMap()
-	if err := json.Unmarshal(filter.getAppliedContent(msg), &values); err != nil {
+	values, err := filter.getAppliedDocument(msg)
+	if err != nil {
 		return filter.GetFilterResultMessageReject(), err
 	}
 
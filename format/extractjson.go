@@ -15,7 +15,6 @@
 package format
 
 import (
-	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
@@ -71,26 +70,19 @@ func (format *ExtractJSON) Configure(conf core.PluginConfigReader) {
 
 // ApplyFormatter update message payload
 func (format *ExtractJSON) ApplyFormatter(msg *core.Message) error {
-	content := format.GetAppliedContent(msg)
-
-	value, err := format.extractJSON(content)
+	values, err := format.GetAppliedDocument(msg)
 	if err != nil {
+		format.Logger.Warning("ExtractJSON failed to unmarshal a message: ", err)
 		return err
 	}
 
+	value := format.extractJSON(values)
+
 	format.SetAppliedContent(msg, value)
 	return nil
 }
 
-func (format *ExtractJSON) extractJSON(content []byte) ([]byte, error) {
-	values := tcontainer.NewMarshalMap()
-
-	err := json.Unmarshal(content, &values)
-	if err != nil {
-		format.Logger.Warning("ExtractJSON failed to unmarshal a message: ", err)
-		return nil, err
-	}
-
+func (format *ExtractJSON) extractJSON(values tcontainer.MarshalMap) []byte {
 	var strValue string
 
 	if value, exists := values[format.field]; exists {
@@ -111,11 +103,11 @@ func (format *ExtractJSON) extractJSON(content []byte) ([]byte, error) {
 		}
 
 		if format.trimValues {
-			return []byte(strings.TrimSpace(strValue)), nil
+			return []byte(strings.TrimSpace(strValue))
 		}
 	}
 
 	format.Logger.Warning("ExtractJSON field not exists: ", format.field)
 
-	return nil, nil
+	return nil
 }
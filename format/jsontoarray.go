@@ -15,7 +15,6 @@
 package format
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/trivago/gollum/core"
 	"github.com/trivago/tgo/tcontainer"
@@ -67,23 +66,17 @@ func (format *JSONToArray) Configure(conf core.PluginConfigReader) {
 
 // ApplyFormatter update message payload
 func (format *JSONToArray) ApplyFormatter(msg *core.Message) error {
-	content, err := format.getCsvContent(format.GetAppliedContent(msg))
+	values, err := format.GetAppliedDocument(msg)
 	if err != nil {
+		format.Logger.Error("Json parsing error: ", err)
 		return err
 	}
 
-	format.SetAppliedContent(msg, content)
+	format.SetAppliedContent(msg, format.getCsvContent(values))
 	return nil
 }
 
-func (format *JSONToArray) getCsvContent(content []byte) ([]byte, error) {
-	values := make(tcontainer.MarshalMap)
-	err := json.Unmarshal(content, &values)
-	if err != nil {
-		format.Logger.Error("Json parsing error: ", err)
-		return nil, err
-	}
-
+func (format *JSONToArray) getCsvContent(values tcontainer.MarshalMap) []byte {
 	csv := ""
 	for _, field := range format.fields {
 		if value, exists := values.Value(field); exists {
@@ -110,5 +103,5 @@ func (format *JSONToArray) getCsvContent(content []byte) ([]byte, error) {
 		csv = csv[:len(csv)-len(format.separator)]
 	}
 
-	return []byte(csv), nil
+	return []byte(csv)
 }
@@ -15,14 +15,12 @@
 package format
 
 import (
-	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/trivago/gollum/core"
-	"github.com/trivago/tgo/tcontainer"
 )
 
 // JSONToInflux10 formatter
@@ -142,13 +140,9 @@ func (format *JSONToInflux10) toUnixTime(timeString string) (int64, error) {
 
 // ApplyFormatter updates the message payload
 func (format *JSONToInflux10) ApplyFormatter(msg *core.Message) error {
-	content := format.GetAppliedContent(msg)
-
-	values := make(tcontainer.MarshalMap)
-	err := json.Unmarshal(content, &values)
-
+	values, err := format.GetAppliedDocument(msg)
 	if err != nil {
-		format.Logger.Warningf("JSON parser error: %s, Message: %s", err, content)
+		format.Logger.Warningf("JSON parser error: %s, Message: %s", err, format.GetAppliedContent(msg))
 		return err
 	}
 
@@ -158,7 +152,6 @@ func (format *JSONToInflux10) ApplyFormatter(msg *core.Message) error {
 		if err != nil {
 			format.Logger.Error("Invalid time format in message:", err)
 		}
-		delete(values, format.timeField)
 	} else {
 		timestamp = time.Now().Unix()
 	}
@@ -168,11 +161,14 @@ func (format *JSONToInflux10) ApplyFormatter(msg *core.Message) error {
 		return fmt.Errorf("Required field for measurement (%s) not found in payload", format.measurement)
 	}
 
-	delete(values, format.measurement)
-
+	// The document may be shared with other formatters so it must not be
+	// modified. Time and measurement fields are skipped instead of removed.
 	fields := make(map[string]interface{})
 	tags := make(map[string]interface{})
 	for k, v := range values {
+		if k == format.timeField || k == format.measurement {
+			continue
+		}
 		if _, ignore := format.ignore[k]; ignore {
 			continue
 		}
@@ -29,7 +29,8 @@ import (
 //
 // - Key: Defines the key to copy, i.e. the "source". ApplyTo will define
 // the target of the copy, i.e. the "destination". An empty string will
-// use the message payload as source.
+// use the message payload as source. When copying from one metadata field to
+// another in mode "replace", typed values (e.g. numbers) keep their type.
 // By default this parameter is set to an empty string (i.e. payload).
 //
 // - Mode: Defines the copy mode to use. This can be one of "append",
@@ -66,6 +67,7 @@ type MetadataCopy struct {
 	separator            []byte   `config:"Separator"`
 	metaDataKeys         []string `config:"CopyToKeys"` // deprecated
 	mode                 metadataCopyMode
+	applyTo              string
 }
 
 type metadataCopyMode int
@@ -82,6 +84,8 @@ func init() {
 
 // Configure initializes this formatter with values from a plugin config.
 func (format *MetadataCopy) Configure(conf core.PluginConfigReader) {
+	format.applyTo = conf.GetString("ApplyTo", "")
+
 	mode := conf.GetString("Mode", "replace")
 	switch strings.ToLower(mode) {
 	case "replace":
@@ -102,8 +106,14 @@ func (format *MetadataCopy) ApplyFormatter(msg *core.Message) error {
 		// DEPRECATED
 		// This codepath will be removed in 0.6
 		meta := msg.GetMetadata()
-		data := format.GetAppliedContent(msg)
+		if _, isSet := meta.TryGet(format.applyTo); format.applyTo != "" && isSet {
+			for _, key := range format.metaDataKeys {
+				meta.CopyValue(format.applyTo, key)
+			}
+			return nil
+		}
 
+		data := format.GetAppliedContent(msg)
 		for _, key := range format.metaDataKeys {
 			bufferCopy := make([]byte, len(data))
 			copy(bufferCopy, data)
@@ -112,6 +122,12 @@ func (format *MetadataCopy) ApplyFormatter(msg *core.Message) error {
 		return nil
 	}
 
+	if format.mode == metadataCopyModeReplace && format.key != "" && format.applyTo != "" {
+		if meta := msg.TryGetMetadata(); meta != nil && meta.CopyValue(format.key, format.applyTo) {
+			return nil
+		}
+	}
+
 	getSourceData := core.GetAppliedContentGetFunction(format.key)
 	srcData := getSourceData(msg)
 
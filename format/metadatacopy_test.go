@@ -189,3 +189,27 @@ func TestMetadataCopyPayloadIntegrity(t *testing.T) {
 	expect.Equal("metadata", msg.String())
 	expect.Equal("xxx", msg.GetMetadata().GetValueString("foo"))
 }
+
+func TestMetadataCopyTyped(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.MetadataCopy")
+	config.Override("Key", "foo")
+	config.Override("ApplyTo", "bar")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*MetadataCopy)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("test"), core.Metadata{"foo": int64(42)}, core.InvalidStreamID)
+
+	err = formatter.ApplyFormatter(msg)
+	expect.NoError(err)
+
+	value, isInt := msg.GetMetadata().TryGet("bar")
+	expect.True(isInt)
+	expect.Equal(int64(42), value)
+	expect.Equal("test", msg.String())
+}
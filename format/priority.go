@@ -0,0 +1,88 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"github.com/trivago/gollum/core"
+)
+
+// Priority formatter
+//
+// This formatter sets the priority of a message. Producers process queued
+// messages of a higher priority first and drop messages of the lowest
+// priority first if their queue is full.
+//
+// Parameters
+//
+// - Priority: Defines the priority to set. Valid values are "low", "normal",
+// "high" and "critical".
+// By default this parameter is set to "normal".
+//
+// - Source: Defines a metadata field to read the priority from. If the field
+// is not set or does not contain a valid priority, the Priority parameter is
+// used instead. Set to "" to always use the Priority parameter.
+// By default this parameter is set to "".
+//
+// Examples
+//
+// This example marks all messages of the oil pressure channel as critical
+// and all IMU samples as low priority.
+//
+//  oilPressure:
+//    Type: router.Broadcast
+//    Stream: oilpressure
+//    Modulators:
+//      - format.Priority:
+//        Priority: critical
+//
+//  imu:
+//    Type: router.Broadcast
+//    Stream: imu
+//    Modulators:
+//      - format.Priority:
+//        Priority: low
+type Priority struct {
+	core.SimpleFormatter `gollumdoc:"embed_type"`
+	source               string `config:"Source"`
+	priority             core.MessagePriority
+}
+
+func init() {
+	core.TypeRegistry.Register(Priority{})
+}
+
+// Configure initializes this formatter with values from a plugin config.
+func (format *Priority) Configure(conf core.PluginConfigReader) {
+	priority, err := core.ParseMessagePriority(conf.GetString("Priority", "normal"))
+	conf.Errors.Push(err)
+	format.priority = priority
+}
+
+// ApplyFormatter update message priority
+func (format *Priority) ApplyFormatter(msg *core.Message) error {
+	if format.source != "" {
+		if metadata := msg.TryGetMetadata(); metadata != nil {
+			if value, isSet := metadata.TryGetValueString(format.source); isSet {
+				if priority, err := core.ParseMessagePriority(value); err == nil {
+					msg.SetPriority(priority)
+					return nil // ### return, priority from metadata ###
+				}
+			}
+		}
+	}
+
+	msg.SetPriority(format.priority)
+	return nil
+}
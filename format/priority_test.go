@@ -0,0 +1,73 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"testing"
+
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestPriority(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Priority")
+	config.Override("Priority", "critical")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Priority)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("test"), nil, core.InvalidStreamID)
+
+	err = formatter.ApplyFormatter(msg)
+	expect.NoError(err)
+	expect.Equal(core.MessagePriorityCritical, msg.GetPriority())
+}
+
+func TestPrioritySource(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Priority")
+	config.Override("Priority", "low")
+	config.Override("Source", "prio")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Priority)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("test"), core.Metadata{"prio": []byte("high")}, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal(core.MessagePriorityHigh, msg.GetPriority())
+
+	msg = core.NewMessage(nil, []byte("test"), core.Metadata{"prio": []byte("unknown")}, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal(core.MessagePriorityLow, msg.GetPriority())
+}
+
+func TestPriorityInvalid(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Priority")
+	config.Override("Priority", "urgent")
+
+	_, err := core.NewPluginWithConfig(config)
+	expect.NotNil(err)
+}
@@ -15,7 +15,6 @@
 package format
 
 import (
-	"encoding/json"
 	"net"
 	"strconv"
 	"strings"
@@ -466,8 +465,8 @@ func (format *ProcessJSON) ApplyFormatter(msg *core.Message) error {
 		return nil // ### return, no directives ###
 	}
 
-	values := make(tcontainer.MarshalMap)
-	if err := json.Unmarshal(format.GetAppliedContent(msg), &values); err != nil {
+	values, err := format.GetAppliedDocument(msg)
+	if err != nil {
 		format.Logger.Warning("ProcessJSON failed to unmarshal a message: ", err)
 		return err
 	}
@@ -485,12 +484,10 @@ func (format *ProcessJSON) ApplyFormatter(msg *core.Message) error {
 		}
 	}
 
-	jsonData, err := json.Marshal(values)
-	if err != nil {
+	if err := format.SetAppliedDocument(msg, values); err != nil {
 		format.Logger.Warning("ProcessJSON failed to marshal a message: ", err)
 		return err
 	}
 
-	format.SetAppliedContent(msg, jsonData)
 	return nil
 }
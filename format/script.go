@@ -0,0 +1,372 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/trivago/gollum/core"
+	"github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// Script formatter plugin
+//
+// Script runs a user defined Lua function against each message. The function
+// is called with a message object and can read and modify payload, metadata
+// and stream of that message. The return value of the function decides how
+// the message proceeds.
+//
+// The message object passed to the function provides the following methods:
+//
+//  - msg:payload() returns the payload as a string.
+//  - msg:set_payload(string) replaces the payload.
+//  - msg:metadata(key) returns a metadata value as string or nil if not set.
+//  - msg:set_metadata(key, string) sets a metadata value.
+//  - msg:delete_metadata(key) removes a metadata value.
+//  - msg:stream() returns the name of the current stream.
+//  - msg:set_stream(name) routes the message to another stream.
+//
+// The function may return one of the globals CONTINUE, DISCARD or FALLBACK.
+// Returning nothing is equal to returning CONTINUE. When returning FALLBACK,
+// no further modulators are called and the message is routed again. Routers
+// and producers route the modified message to its current stream, so a
+// stream set via msg:set_stream is used. Consumers route the original,
+// unmodified message to the stream it was received on.
+//
+// Each Lua interpreter is used by one go routine at a time. Interpreters are
+// kept in a pool so that multiple messages can be processed in parallel.
+//
+// Parameters
+//
+// - Script: Defines the Lua source code to load. If neither this parameter nor
+// ScriptFile is set, messages pass unchanged.
+// By default this parameter is set to "".
+//
+// - ScriptFile: Defines a file to load the Lua source code from. This
+// parameter is ignored if Script is set.
+// By default this parameter is set to "".
+//
+// - Function: Defines the name of the global Lua function to call for each
+// message.
+// By default this parameter is set to "modulate".
+//
+// - TimeoutMs: Defines the maximum time in milliseconds a single function
+// call may take. Calls exceeding this budget are aborted and treated as an
+// error. Set to 0 to disable the time budget.
+// By default this parameter is set to 10.
+//
+// - PoolSize: Defines the number of Lua interpreters kept for parallel
+// processing. Set to 0 to use one interpreter per CPU.
+// By default this parameter is set to 0.
+//
+// - OnError: Defines what to do with a message if the script fails or times
+// out. This can be one of "discard", "fallback" or "continue".
+// By default this parameter is set to "discard".
+//
+// Examples
+//
+// This example calculates the current gear from rpm and speed metadata fields
+// and drops all messages that were recorded while standing still.
+//
+//  exampleConsumer:
+//    Type: consumer.Console
+//    Streams: "*"
+//    Modulators:
+//      - format.Script:
+//        Script: |
+//          function modulate(msg)
+//            local speed = tonumber(msg:metadata("speed")) or 0
+//            if speed == 0 then
+//              return DISCARD
+//            end
+//            local rpm = tonumber(msg:metadata("rpm")) or 0
+//            msg:set_metadata("ratio", string.format("%.2f", rpm / speed))
+//            return CONTINUE
+//          end
+//
+type Script struct {
+	Logger   logrus.FieldLogger
+	function string        `config:"Function" default:"modulate"`
+	timeout  time.Duration `config:"TimeoutMs" default:"10" metric:"ms"`
+	poolSize int           `config:"PoolSize" default:"0"`
+	onError  core.ModulateResult
+	proto    *lua.FunctionProto
+	pool     chan *scriptState
+}
+
+// scriptState bundles a Lua interpreter with the objects required to call
+// the configured function.
+type scriptState struct {
+	lua      *lua.LState
+	function lua.LValue
+	metatype lua.LValue
+}
+
+const scriptMessageType = "gollum.message"
+
+var scriptMessageMethods = map[string]lua.LGFunction{
+	"payload":         scriptGetPayload,
+	"set_payload":     scriptSetPayload,
+	"metadata":        scriptGetMetadata,
+	"set_metadata":    scriptSetMetadata,
+	"delete_metadata": scriptDeleteMetadata,
+	"stream":          scriptGetStream,
+	"set_stream":      scriptSetStream,
+}
+
+func init() {
+	core.TypeRegistry.Register(Script{})
+}
+
+// Configure initializes this formatter with values from a plugin config.
+func (format *Script) Configure(conf core.PluginConfigReader) {
+	format.Logger = conf.GetSubLogger("Formatter")
+
+	switch onError := strings.ToLower(conf.GetString("OnError", "discard")); onError {
+	case "discard":
+		format.onError = core.ModulateResultDiscard
+	case "fallback":
+		format.onError = core.ModulateResultFallback
+	case "continue":
+		format.onError = core.ModulateResultContinue
+	default:
+		conf.Errors.Pushf("OnError must be one of discard, fallback or continue")
+	}
+
+	source := conf.GetString("Script", "")
+	scriptFile := conf.GetString("ScriptFile", "")
+	chunkName := conf.GetID() + ".Script"
+	if source == "" {
+		if scriptFile == "" {
+			format.Logger.Warning("Neither Script nor ScriptFile is set. Messages will pass unchanged")
+			return
+		}
+		data, err := ioutil.ReadFile(scriptFile)
+		if err != nil {
+			conf.Errors.Push(err)
+			return
+		}
+		source = string(data)
+		chunkName = scriptFile
+	}
+
+	chunk, err := parse.Parse(strings.NewReader(source), chunkName)
+	if err != nil {
+		conf.Errors.Push(err)
+		return
+	}
+
+	if format.proto, err = lua.Compile(chunk, chunkName); err != nil {
+		conf.Errors.Push(err)
+		return
+	}
+
+	if format.poolSize <= 0 {
+		format.poolSize = runtime.NumCPU()
+	}
+
+	format.pool = make(chan *scriptState, format.poolSize)
+	for i := 0; i < format.poolSize; i++ {
+		state, err := format.newState()
+		if err != nil {
+			conf.Errors.Push(err)
+			return
+		}
+		format.pool <- state
+	}
+}
+
+// SetLogger sets the scoped logger to be used for this formatter
+func (format *Script) SetLogger(logger logrus.FieldLogger) {
+	format.Logger = logger
+}
+
+// GetLogger returns the scoped logger of this plugin
+func (format *Script) GetLogger() logrus.FieldLogger {
+	return format.Logger
+}
+
+func (format *Script) newState() (*scriptState, error) {
+	state := &scriptState{
+		lua: lua.NewState(),
+	}
+
+	L := state.lua
+	L.SetGlobal("CONTINUE", lua.LNumber(core.ModulateResultContinue))
+	L.SetGlobal("FALLBACK", lua.LNumber(core.ModulateResultFallback))
+	L.SetGlobal("DISCARD", lua.LNumber(core.ModulateResultDiscard))
+
+	metatype := L.NewTypeMetatable(scriptMessageType)
+	L.SetField(metatype, "__index", L.SetFuncs(L.NewTable(), scriptMessageMethods))
+	state.metatype = metatype
+
+	L.Push(L.NewFunctionFromProto(format.proto))
+	if err := L.PCall(0, lua.MultRet, nil); err != nil {
+		L.Close()
+		return nil, err
+	}
+
+	state.function = L.GetGlobal(format.function)
+	if state.function.Type() != lua.LTFunction {
+		L.Close()
+		return nil, fmt.Errorf("Script does not define a function named '%s'", format.function)
+	}
+
+	return state, nil
+}
+
+// Modulate calls the configured Lua function for the given message.
+func (format *Script) Modulate(msg *core.Message) core.ModulateResult {
+	if format.pool == nil {
+		return core.ModulateResultContinue // ### return, no script loaded ###
+	}
+
+	state := <-format.pool
+	if state == nil {
+		// A previous attempt to replace a broken interpreter failed.
+		var err error
+		if state, err = format.newState(); err != nil {
+			format.Logger.WithError(err).Error("Failed to recreate script interpreter")
+			format.pool <- nil
+			return format.onError // ### return, interpreter still lost ###
+		}
+	}
+
+	result, err := format.call(state, msg)
+
+	if err != nil {
+		format.Logger.WithError(err).Warning("Script failed")
+
+		// An aborted interpreter might be left in an undefined state so we
+		// replace it with a fresh one. If that fails, an empty slot is put
+		// back into the pool so that the next call tries again.
+		state.lua.Close()
+		if state, err = format.newState(); err != nil {
+			format.Logger.WithError(err).Error("Failed to recreate script interpreter")
+		}
+		format.pool <- state
+		return format.onError
+	}
+
+	format.pool <- state
+	return result
+}
+
+func (format *Script) call(state *scriptState, msg *core.Message) (core.ModulateResult, error) {
+	L := state.lua
+	if format.timeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), format.timeout)
+		defer cancel()
+		L.SetContext(ctx)
+		defer L.RemoveContext()
+	}
+
+	userData := L.NewUserData()
+	userData.Value = msg
+	userData.Metatable = state.metatype
+
+	// Do not allow the script to keep a reference to the message
+	defer func() { userData.Value = nil }()
+
+	L.Push(state.function)
+	L.Push(userData)
+	if err := L.PCall(1, 1, nil); err != nil {
+		return format.onError, err
+	}
+
+	ret := L.Get(-1)
+	L.Pop(1)
+
+	switch ret.Type() {
+	case lua.LTNil:
+		return core.ModulateResultContinue, nil
+	case lua.LTNumber:
+		switch result := core.ModulateResult(lua.LVAsNumber(ret)); result {
+		case core.ModulateResultContinue, core.ModulateResultFallback, core.ModulateResultDiscard:
+			return result, nil
+		}
+	}
+
+	return format.onError, fmt.Errorf("Script returned unknown result '%s'", ret.String())
+}
+
+func scriptCheckMessage(L *lua.LState) *core.Message {
+	userData := L.CheckUserData(1)
+	if msg, isMessage := userData.Value.(*core.Message); isMessage {
+		return msg
+	}
+	L.ArgError(1, "message expected")
+	return nil
+}
+
+func scriptGetPayload(L *lua.LState) int {
+	msg := scriptCheckMessage(L)
+	L.Push(lua.LString(msg.GetPayload()))
+	return 1
+}
+
+func scriptSetPayload(L *lua.LState) int {
+	msg := scriptCheckMessage(L)
+	msg.StorePayload([]byte(L.CheckString(2)))
+	return 0
+}
+
+func scriptGetMetadata(L *lua.LState) int {
+	msg := scriptCheckMessage(L)
+	key := L.CheckString(2)
+
+	if metadata := msg.TryGetMetadata(); metadata != nil {
+		if value, isSet := metadata.TryGetValue(key); isSet {
+			L.Push(lua.LString(value))
+			return 1
+		}
+	}
+
+	L.Push(lua.LNil)
+	return 1
+}
+
+func scriptSetMetadata(L *lua.LState) int {
+	msg := scriptCheckMessage(L)
+	msg.GetMetadata().SetValue(L.CheckString(2), []byte(L.CheckString(3)))
+	return 0
+}
+
+func scriptDeleteMetadata(L *lua.LState) int {
+	msg := scriptCheckMessage(L)
+	if metadata := msg.TryGetMetadata(); metadata != nil {
+		metadata.Delete(L.CheckString(2))
+	}
+	return 0
+}
+
+func scriptGetStream(L *lua.LState) int {
+	msg := scriptCheckMessage(L)
+	L.Push(lua.LString(msg.GetStreamID().GetName()))
+	return 1
+}
+
+func scriptSetStream(L *lua.LState) int {
+	msg := scriptCheckMessage(L)
+	msg.SetStreamID(core.GetStreamID(L.CheckString(2)))
+	return 0
+}
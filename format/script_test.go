@@ -0,0 +1,157 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func newScriptTestFormatter(expect ttesting.Expect, script string, settings map[string]interface{}) *Script {
+	config := core.NewPluginConfig("", "format.Script")
+	config.Override("Script", script)
+	config.Override("PoolSize", 1)
+	for key, value := range settings {
+		config.Override(key, value)
+	}
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Script)
+	expect.True(casted)
+	return formatter
+}
+
+func TestScriptPayloadAndMetadata(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	formatter := newScriptTestFormatter(expect, `
+function modulate(msg)
+  local rpm = tonumber(msg:metadata("rpm"))
+  local speed = tonumber(msg:metadata("speed"))
+  msg:set_metadata("ratio", tostring(rpm / speed))
+  msg:delete_metadata("rpm")
+  msg:set_payload(msg:payload() .. " modified")
+  return CONTINUE
+end`, nil)
+
+	msg := core.NewMessage(nil, []byte("test"), core.Metadata{
+		"rpm":   []byte("3000"),
+		"speed": []byte("100"),
+	}, core.InvalidStreamID)
+
+	result := formatter.Modulate(msg)
+	expect.Equal(core.ModulateResultContinue, result)
+	expect.Equal("test modified", msg.String())
+	expect.Equal("30", msg.GetMetadata().GetValueString("ratio"))
+
+	_, exists := msg.GetMetadata().TryGetValue("rpm")
+	expect.False(exists)
+}
+
+func TestScriptResults(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	formatter := newScriptTestFormatter(expect, `
+function modulate(msg)
+  if msg:payload() == "discard" then
+    return DISCARD
+  end
+  if msg:payload() == "fallback" then
+    msg:set_stream("scriptFallback")
+    return FALLBACK
+  end
+end`, nil)
+
+	msg := core.NewMessage(nil, []byte("test"), nil, core.InvalidStreamID)
+	expect.Equal(core.ModulateResultContinue, formatter.Modulate(msg))
+
+	msg = core.NewMessage(nil, []byte("discard"), nil, core.InvalidStreamID)
+	expect.Equal(core.ModulateResultDiscard, formatter.Modulate(msg))
+
+	msg = core.NewMessage(nil, []byte("fallback"), nil, core.InvalidStreamID)
+	expect.Equal(core.ModulateResultFallback, formatter.Modulate(msg))
+	expect.Equal("scriptFallback", msg.GetStreamID().GetName())
+}
+
+func TestScriptTimeout(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	formatter := newScriptTestFormatter(expect, `
+function modulate(msg)
+  if msg:payload() == "loop" then
+    while true do end
+  end
+  msg:set_payload("done")
+end`, map[string]interface{}{
+		"TimeoutMs": 10,
+		"OnError":   "fallback",
+	})
+
+	msg := core.NewMessage(nil, []byte("loop"), nil, core.InvalidStreamID)
+	expect.Equal(core.ModulateResultFallback, formatter.Modulate(msg))
+
+	// The interpreter has to be usable after a timeout
+	msg = core.NewMessage(nil, []byte("test"), nil, core.InvalidStreamID)
+	expect.Equal(core.ModulateResultContinue, formatter.Modulate(msg))
+	expect.Equal("done", msg.String())
+}
+
+func TestScriptRecreateFailure(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	guard, err := ioutil.TempFile("", "gollum-script")
+	expect.NoError(err)
+	guard.Close()
+	defer os.Remove(guard.Name())
+
+	// Loading the script fails as long as the guard file is missing
+	formatter := newScriptTestFormatter(expect, fmt.Sprintf(`
+assert(io.open(%q), "guard missing")
+function modulate(msg)
+  if msg:payload() == "fail" then
+    error("failed")
+  end
+end`, guard.Name()), nil)
+
+	expect.NoError(os.Remove(guard.Name()))
+
+	msg := core.NewMessage(nil, []byte("fail"), nil, core.InvalidStreamID)
+	expect.Equal(core.ModulateResultDiscard, formatter.Modulate(msg))
+
+	// The pool must not run empty while the interpreter cannot be recreated
+	msg = core.NewMessage(nil, []byte("test"), nil, core.InvalidStreamID)
+	expect.Equal(core.ModulateResultDiscard, formatter.Modulate(msg))
+
+	expect.NoError(ioutil.WriteFile(guard.Name(), nil, 0644))
+	msg = core.NewMessage(nil, []byte("test"), nil, core.InvalidStreamID)
+	expect.Equal(core.ModulateResultContinue, formatter.Modulate(msg))
+}
+
+func TestScriptMissingFunction(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Script")
+	config.Override("Script", "function other(msg) end")
+
+	_, err := core.NewPluginWithConfig(config)
+	expect.NotNil(err)
+}
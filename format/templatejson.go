@@ -16,9 +16,7 @@ package format
 
 import (
 	"bytes"
-	"encoding/json"
 	"github.com/trivago/gollum/core"
-	"github.com/trivago/tgo/tcontainer"
 	"text/template"
 )
 
@@ -66,8 +64,7 @@ func (format *TemplateJSON) Configure(conf core.PluginConfigReader) {
 
 // ApplyFormatter update message payload
 func (format *TemplateJSON) ApplyFormatter(msg *core.Message) error {
-	values := tcontainer.NewMarshalMap()
-	err := json.Unmarshal(format.GetAppliedContent(msg), &values)
+	values, err := format.GetAppliedDocument(msg)
 	if err != nil {
 		format.Logger.Warning("TemplateJSON failed to unmarshal a message: ", err)
 		return err
@@ -2,8 +2,7 @@ module github.com/trivago/gollum
 
 require (
 	github.com/MeteoGroup/go-metrics-prometheus v0.0.0-20170102121754-1d412ec2ed4f
-	github.com/Shopify/sarama v1.17.0
-	github.com/Shopify/toxiproxy v2.1.3+incompatible // indirect
+	github.com/Shopify/sarama v1.29.1
 	github.com/abbot/go-http-auth v0.4.0
 	github.com/alecthomas/units v0.0.0-20190924025748-f65c72e2690d // indirect
 	github.com/arbovm/levenshtein v0.0.0-20160628152529-48b4e1c0c4d0
@@ -13,60 +12,62 @@ require (
 	github.com/aws/aws-sdk-go v1.15.22
 	github.com/beorn7/perks v0.0.0-20180321164747-3a771d992973 // indirect
 	github.com/brutella/can v0.0.0-20180117080637-818f1bc3aba8
-	github.com/bsm/sarama-cluster v2.1.15+incompatible
 	github.com/coreos/go-systemd v0.0.0-20180705093442-88bfeed483d3
 	github.com/coreos/pkg v0.0.0-20180108230652-97fdf19511ea // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/eapache/go-resiliency v1.1.0 // indirect
 	github.com/eapache/go-xerial-snappy v0.0.0-20180814174437-776d5712da21 // indirect
 	github.com/eapache/queue v1.1.0 // indirect
+	github.com/eclipse/paho.mqtt.golang v1.2.0
 	github.com/fsnotify/fsnotify v1.4.7
 	github.com/go-redis/redis v6.14.0+incompatible
 	github.com/golang/protobuf v1.2.0
-	github.com/golang/snappy v0.0.0-20180518054509-2e65f85255db // indirect
+	github.com/golang/snappy v0.0.3
 	github.com/google/shlex v0.0.0-20191202100458-e7afc7fbc510 // indirect
 	github.com/gopherjs/gopherjs v0.0.0-20181017120253-0766667cb4d1 // indirect
 	github.com/gorilla/websocket v1.3.0
 	github.com/jtolds/gls v4.2.1+incompatible // indirect
+	github.com/klauspost/compress v1.12.2
+	github.com/lib/pq v1.10.2
 	github.com/mattn/go-colorable v0.0.9 // indirect
 	github.com/mattn/go-isatty v0.0.3 // indirect
+	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/mattn/goveralls v0.0.6 // indirect
 	github.com/matttproud/golang_protobuf_extensions v1.0.1 // indirect
 	github.com/mgutz/ansi v0.0.0-20170206155736-9520e82c474b // indirect
 	github.com/miekg/pcap v0.0.0-20170124221734-51d9d986bf8d
 	github.com/mmcloughlin/geohash v0.0.0-20180625052535-3b756d8ac3d9
 	github.com/mssola/user_agent v0.4.1
+	github.com/nats-io/nats.go v1.11.0
 	github.com/nicksnyder/go-i18n v1.10.1 // indirect
 	github.com/onsi/gomega v1.4.2 // indirect
 	github.com/oschwald/maxminddb-golang v1.3.0 // indirect
 	github.com/pelletier/go-toml v1.8.0 // indirect
-	github.com/pierrec/lz4 v2.0.3+incompatible // indirect
 	github.com/pkg/errors v0.8.0
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/prometheus/client_golang v0.8.0
 	github.com/prometheus/client_model v0.0.0-20180712105110-5c3871d89910 // indirect
-	github.com/prometheus/common v0.0.0-20180801064454-c7de2306084e // indirect
+	github.com/prometheus/common v0.0.0-20180801064454-c7de2306084e
 	github.com/prometheus/procfs v0.0.0-20180725123919-05ee40e3a273 // indirect
 	github.com/quipo/statsd v0.0.0-20180118161217-3d6a5565f314
-	github.com/rcrowley/go-metrics v0.0.0-20180503174638-e2704e165165
+	github.com/rcrowley/go-metrics v0.0.0-20201227073835-cf1acfcdf475
 	github.com/sirupsen/logrus v1.0.6
 	github.com/smartystreets/assertions v0.0.0-20180927180507-b2de0cb4f26d // indirect
 	github.com/smartystreets/goconvey v0.0.0-20180222194500-ef6db91d284a // indirect
 	github.com/trivago/grok v1.0.0
 	github.com/trivago/tgo v1.0.5
 	github.com/x-cray/logrus-prefixed-formatter v0.5.2
-	golang.org/x/crypto v0.0.0-20200820211705-5c72a883971a
+	github.com/yuin/gopher-lua v0.0.0-20200816102855-ee81675732da
+	golang.org/x/crypto v0.0.0-20210616213533-5ff15b29337e
 	golang.org/x/lint v0.0.0-20200302205851-738671d3881b // indirect
-	golang.org/x/net v0.0.0-20200904194848-62affa334b73 // indirect
-	golang.org/x/sys v0.0.0-20200905004654-be1d3432aa8f // indirect
-	golang.org/x/text v0.3.3 // indirect
+	golang.org/x/net v0.0.0-20210614182718-04defd469f4e
+	golang.org/x/sys v0.0.0-20210615035016-665e8c7367d1
 	golang.org/x/tools v0.0.0-20200904185747-39188db58858 // indirect
+	google.golang.org/grpc v1.18.0
 	gopkg.in/airbrake/gobrake.v2 v2.0.9 // indirect
 	gopkg.in/alecthomas/gometalinter.v2 v2.0.12 // indirect
 	gopkg.in/alecthomas/kingpin.v3-unstable v3.0.0-20191105091915-95d230a53780 // indirect
 	gopkg.in/gemnasium/logrus-airbrake-hook.v2 v2.1.2 // indirect
 	gopkg.in/mcuadros/go-syslog.v2 v2.2.1
-	gopkg.in/olivere/elastic.v5 v5.0.74
 	gopkg.in/oschwald/geoip2-golang.v1 v1.2.1
 	gopkg.in/yaml.v2 v2.3.0
 	periph.io/x/periph v3.4.0+incompatible
@@ -15,21 +15,24 @@
 package producer
 
 import (
-	"github.com/trivago/gollum/core"
 	"io"
 	"sync"
+	"time"
+
+	"github.com/trivago/gollum/core"
 )
 
 // InfluxDB producer
 //
 // This producer writes data to an influxDB endpoint. Data is not converted to
-// the correct influxDB format automatically. Proper formatting might be
-// required.
+// the correct influxDB format automatically unless ConvertJSON is set. Proper
+// formatting might be required.
 //
 // Parameters
 //
 // - Version: Defines the InfluxDB protocol version to use. This can either be
-// 80-89 for 0.8.x, 90 for 0.9.0 or 91-100 for 0.9.1 or later.
+// 80-89 for 0.8.x, 90 for 0.9.0, 91-199 for 0.9.1 up to 1.x or 200 or higher
+// for 2.x.
 // Be default this parameter is set to 100.
 //
 // - Host: Defines the host (and port) of the InfluxDB master.
@@ -54,6 +57,58 @@ import (
 // InfluxDB retention policy allowed with this protocol version.
 // By default this parameter is set to "".
 //
+// - Organization: Only available for Version 200 or higher. Defines the
+// organization owning the bucket to write to. This parameter is required
+// for InfluxDB 2.x.
+// By default this parameter is set to "".
+//
+// - Bucket: Only available for Version 200 or higher. Defines the bucket to
+// write to.
+// By default this parameter is set to "default".
+//
+// - Token: Only available for Version 200 or higher. Defines the API token
+// used for authentication. If this is empty, no token is sent.
+// By default this parameter is set to "".
+//
+// - Gzip: Only available for Version 200 or higher. When set to true,
+// requests are sent gzip compressed.
+// By default this parameter is set to true.
+//
+// - RetryCount: Only available for Version 200 or higher. Defines how often
+// a batch is retried if the write failed because of connection problems,
+// server errors or rate limiting. Batches that still fail are sent to the
+// fallback stream.
+// By default this parameter is set to 3.
+//
+// - RetryDelayMs: Only available for Version 200 or higher. Defines the
+// delay in milliseconds before the first retry. The delay is doubled for
+// each further retry. A Retry-After header sent by the server is respected.
+// By default this parameter is set to 500.
+//
+// - RetryMaxDelayMs: Only available for Version 200 or higher. Defines the
+// maximum delay in milliseconds between two retries.
+// By default this parameter is set to 10000.
+//
+// - TimeoutMs: Only available for Version 200 or higher. Defines the timeout
+// in milliseconds for a single request.
+// By default this parameter is set to 10000.
+//
+// - ConvertJSON: When set to true, JSON payloads are converted to line
+// protocol before being sent. All numeric JSON fields are written as fields.
+// Metadata values are written as tags. The timestamp is set to the creation
+// time of the message. Messages that cannot be converted are discarded. This
+// requires Version to be 91 or higher.
+// By default this parameter is set to false.
+//
+// - MeasurementField: Only used if ConvertJSON is set. Defines the JSON field
+// holding the measurement name. If the field is not set, the name of the
+// stream is used as measurement.
+// By default this parameter is set to "measurement".
+//
+// - Tags: Only used if ConvertJSON is set. Defines the list of metadata keys
+// to write as tags. If this list is empty, all metadata keys are used.
+// By default this parameter is set to an empty list.
+//
 // Examples
 //
 //  metricsToInflux:
@@ -66,10 +121,26 @@ import (
 //      MaxCount: 2000
 //      FlushCount: 100
 //      TimeoutSec: 5
+//
+// This example converts JSON sensor data and writes it to InfluxDB 2.x. The
+// car metadata field is written as tag.
+//
+//  sensorsToInflux:
+//    Type: producer.InfluxDB
+//    Streams: sensors
+//    Version: 200
+//    Host: "https://influx.example.com"
+//    Organization: racing
+//    Bucket: telemetry
+//    Token: "secret"
+//    ConvertJSON: true
+//    Tags:
+//      - car
 type InfluxDB struct {
 	core.BatchedProducer `gollumdoc:"embed_type"`
 	writer               influxDBWriter
 	assembly             core.WriterAssembly
+	converter            *influxDBLineProtocol
 }
 
 type influxDBWriter interface {
@@ -86,6 +157,8 @@ func init() {
 func (prod *InfluxDB) Configure(conf core.PluginConfigReader) {
 	version := conf.GetInt("Version", 100)
 
+	precision := time.Millisecond
+
 	switch {
 	case version < 90:
 		prod.Logger.Debug("Using InfluxDB 0.8.x protocol")
@@ -93,9 +166,20 @@ func (prod *InfluxDB) Configure(conf core.PluginConfigReader) {
 	case version == 90:
 		prod.Logger.Debug("Using InfluxDB 0.9.0 protocol")
 		prod.writer = new(influxDBWriter09)
-	default:
+	case version < 200:
 		prod.Logger.Debug("Using InfluxDB 1.0.0 protocol")
 		prod.writer = new(influxDBWriter10)
+	default:
+		prod.Logger.Debug("Using InfluxDB 2.0.0 protocol")
+		prod.writer = new(influxDBWriter20)
+		precision = time.Nanosecond
+	}
+
+	if conf.GetBool("ConvertJSON", false) {
+		if version <= 90 {
+			conf.Errors.Pushf("ConvertJSON requires Version 91 or higher")
+		}
+		prod.converter = newInfluxDBLineProtocol(conf, precision)
 	}
 
 	if err := prod.writer.configure(conf, prod); conf.Errors.Push(err) {
@@ -103,11 +187,18 @@ func (prod *InfluxDB) Configure(conf core.PluginConfigReader) {
 	}
 
 	prod.assembly = core.NewWriterAssembly(prod.writer, prod.TryFallback, prod)
+	prod.assembly.SetErrorHandler(func(err error) bool {
+		prod.Logger.WithError(err).Error("Failed to write batch")
+		return false
+	})
 }
 
 // sendBatch returns core.AssemblyFunc to flush batch
 func (prod *InfluxDB) sendBatch() core.AssemblyFunc {
 	if prod.writer.isConnectionUp() {
+		if prod.converter != nil {
+			return prod.convertAndWrite
+		}
 		return prod.assembly.Write
 	} else if prod.IsStopping() {
 		return prod.assembly.Flush
@@ -116,6 +207,27 @@ func (prod *InfluxDB) sendBatch() core.AssemblyFunc {
 	return nil
 }
 
+// convertAndWrite converts all messages to line protocol and passes them to
+// the writer assembly. Messages that cannot be converted are discarded.
+func (prod *InfluxDB) convertAndWrite(messages []*core.Message) {
+	converted := make([]*core.Message, 0, len(messages))
+	for _, msg := range messages {
+		// Fallback should receive the unconverted message
+		msg = msg.Detach()
+		msg.FreezeOriginal()
+		if err := prod.converter.convert(msg); err != nil {
+			prod.Logger.WithError(err).Warning("Failed to convert message to line protocol")
+			core.DiscardMessage(msg, prod.GetID(), "Conversion to line protocol failed")
+			continue
+		}
+		converted = append(converted, msg)
+	}
+
+	if len(converted) > 0 {
+		prod.assembly.Write(converted)
+	}
+}
+
 // Produce starts a bulk producer which will collect datapoints until either the buffer is full or a timeout has been reached.
 // The buffer limit does not describe the number of messages received from kafka but the size of the buffer content in KB.
 func (prod *InfluxDB) Produce(workers *sync.WaitGroup) {
@@ -0,0 +1,119 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/trivago/gollum/core"
+)
+
+var (
+	influxDBMeasurementEscape = strings.NewReplacer(",", "\\,", " ", "\\ ", "\n", "\\n")
+	influxDBKeyEscape         = strings.NewReplacer(",", "\\,", "=", "\\=", " ", "\\ ", "\n", "\\n")
+)
+
+// influxDBLineProtocol converts JSON payloads to InfluxDB line protocol.
+type influxDBLineProtocol struct {
+	measurementField string
+	tags             []string
+	precision        time.Duration
+}
+
+func newInfluxDBLineProtocol(conf core.PluginConfigReader, precision time.Duration) *influxDBLineProtocol {
+	converter := &influxDBLineProtocol{
+		measurementField: conf.GetString("MeasurementField", "measurement"),
+		tags:             conf.GetStringArray("Tags", []string{}),
+		precision:        precision,
+	}
+
+	// Tags have to be sorted by key for best performance on the server side
+	sort.Strings(converter.tags)
+	return converter
+}
+
+// convert replaces the payload of the given message with a single line of
+// line protocol. The measurement is read from the measurement field or the
+// stream name is used. All numeric JSON fields are written as float fields,
+// metadata values are written as tags.
+func (converter *influxDBLineProtocol) convert(msg *core.Message) error {
+	document, err := msg.GetDocument()
+	if err != nil {
+		return err
+	}
+
+	measurement, isString := document[converter.measurementField].(string)
+	if !isString || measurement == "" {
+		measurement = msg.GetStreamID().GetName()
+	}
+
+	fieldKeys := make([]string, 0, len(document))
+	for key, value := range document {
+		if _, isNumber := value.(float64); isNumber {
+			fieldKeys = append(fieldKeys, key)
+		}
+	}
+	if len(fieldKeys) == 0 {
+		return fmt.Errorf("Message does not contain any numeric fields")
+	}
+	sort.Strings(fieldKeys)
+
+	line := make([]byte, 0, 64+len(msg.GetPayload()))
+	line = append(line, influxDBMeasurementEscape.Replace(measurement)...)
+
+	if metadata := msg.TryGetMetadata(); metadata != nil {
+		tagKeys := converter.tags
+		if len(tagKeys) == 0 {
+			tagKeys = make([]string, 0, len(metadata))
+			for key := range metadata {
+				tagKeys = append(tagKeys, key)
+			}
+			sort.Strings(tagKeys)
+		}
+
+		for _, key := range tagKeys {
+			value, isSet := metadata.TryGetValueString(key)
+			if !isSet || value == "" {
+				continue // tags must not be empty
+			}
+			line = append(line, ',')
+			line = append(line, influxDBKeyEscape.Replace(key)...)
+			line = append(line, '=')
+			line = append(line, influxDBKeyEscape.Replace(value)...)
+		}
+	}
+
+	for i, key := range fieldKeys {
+		if i == 0 {
+			line = append(line, ' ')
+		} else {
+			line = append(line, ',')
+		}
+		line = append(line, influxDBKeyEscape.Replace(key)...)
+		line = append(line, '=')
+		line = strconv.AppendFloat(line, document[key].(float64), 'f', -1, 64)
+	}
+
+	line = append(line, ' ')
+	line = strconv.AppendInt(line, msg.GetCreationTime().UnixNano()/int64(converter.precision), 10)
+	line = append(line, '\n')
+
+	msg.StorePayload(line)
+	return nil
+}
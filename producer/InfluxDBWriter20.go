@@ -0,0 +1,233 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/trivago/gollum/core"
+)
+
+// influxDBWriter20 implements the io.Writer interface for InfluxDB 2.x
+// connections using the /api/v2/write endpoint.
+type influxDBWriter20 struct {
+	client        http.Client
+	writeURL      string
+	pingURL       string
+	host          string
+	token         string
+	useGzip       bool
+	retryCount    int
+	retryDelay    time.Duration
+	retryMaxDelay time.Duration
+	connectionUp  bool
+	buffer        bytes.Buffer
+	logger        logrus.FieldLogger
+	isActive      func() bool
+}
+
+// influxDBRetryPollInterval defines how often the producer state is checked
+// while waiting for a retry.
+const influxDBRetryPollInterval = 100 * time.Millisecond
+
+// influxDBRetryError is returned by post if a request failed but may
+// succeed when being retried.
+type influxDBRetryError struct {
+	err        error
+	retryAfter time.Duration
+}
+
+func (err influxDBRetryError) Error() string {
+	return err.err.Error()
+}
+
+// Configure sets the database connection values
+func (writer *influxDBWriter20) configure(conf core.PluginConfigReader, prod *InfluxDB) error {
+	writer.host = conf.GetString("Host", "localhost:8086")
+	writer.token = conf.GetString("Token", "")
+	writer.useGzip = conf.GetBool("Gzip", true)
+	writer.retryCount = int(conf.GetInt("RetryCount", 3))
+	writer.retryDelay = time.Duration(conf.GetInt("RetryDelayMs", 500)) * time.Millisecond
+	writer.retryMaxDelay = time.Duration(conf.GetInt("RetryMaxDelayMs", 10000)) * time.Millisecond
+	writer.client.Timeout = time.Duration(conf.GetInt("TimeoutMs", 10000)) * time.Millisecond
+	writer.logger = prod.Logger
+	writer.isActive = prod.IsActive
+
+	organization := conf.GetString("Organization", "")
+	bucket := conf.GetString("Bucket", "default")
+	if organization == "" {
+		conf.Errors.Pushf("Organization must be set when using InfluxDB 2.x")
+	}
+
+	baseURL := writer.host
+	if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
+		baseURL = "http://" + baseURL
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	query := url.Values{}
+	query.Set("org", organization)
+	query.Set("bucket", bucket)
+	query.Set("precision", "ns")
+
+	writer.writeURL = baseURL + "/api/v2/write?" + query.Encode()
+	writer.pingURL = baseURL + "/ping"
+	return conf.Errors.OrNil()
+}
+
+func (writer *influxDBWriter20) isConnectionUp() bool {
+	if writer.connectionUp {
+		return true // ### return, connection not reported to be down ###
+	}
+
+	if response, err := writer.client.Get(writer.pingURL); err == nil && response != nil {
+		defer response.Body.Close()
+		switch response.StatusCode {
+		case http.StatusOK, http.StatusNoContent:
+			writer.connectionUp = true
+			writer.logger.Debug("Connected to " + writer.host)
+		}
+	}
+
+	return writer.connectionUp
+}
+
+func (writer *influxDBWriter20) newRequest() (*http.Request, error) {
+	request, err := http.NewRequest(http.MethodPost, writer.writeURL, bytes.NewReader(writer.buffer.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if writer.useGzip {
+		request.Header.Set("Content-Encoding", "gzip")
+	}
+	if writer.token != "" {
+		request.Header.Set("Authorization", "Token "+writer.token)
+	}
+	return request, nil
+}
+
+func (writer *influxDBWriter20) post() error {
+	request, err := writer.newRequest()
+	if err != nil {
+		return err // ### return, invalid request ###
+	}
+
+	response, err := writer.client.Do(request)
+	if err != nil {
+		writer.connectionUp = false
+		return influxDBRetryError{err: err} // ### return, failed to connect ###
+	}
+
+	defer response.Body.Close()
+	body, _ := ioutil.ReadAll(response.Body)
+
+	switch {
+	case response.StatusCode == http.StatusOK || response.StatusCode == http.StatusNoContent:
+		return nil // ### return, OK ###
+
+	case response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500:
+		retryErr := influxDBRetryError{
+			err: fmt.Errorf("%s returned %s: %s", writer.writeURL, response.Status, string(body)),
+		}
+		if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil {
+			retryErr.retryAfter = time.Duration(seconds) * time.Second
+		}
+		return retryErr
+
+	default:
+		// Client errors like malformed data will not succeed when retried
+		return fmt.Errorf("%s returned %s: %s", writer.writeURL, response.Status, string(body))
+	}
+}
+
+func (writer *influxDBWriter20) compress(data []byte) error {
+	writer.buffer.Reset()
+	if !writer.useGzip {
+		_, err := writer.buffer.Write(data)
+		return err
+	}
+
+	compressor := gzip.NewWriter(&writer.buffer)
+	if _, err := compressor.Write(data); err != nil {
+		return err
+	}
+	return compressor.Close()
+}
+
+// wait blocks for the given duration or until the producer is not active
+// anymore. False is returned in the latter case.
+func (writer *influxDBWriter20) wait(duration time.Duration) bool {
+	for end := time.Now().Add(duration); writer.isActive(); {
+		remaining := time.Until(end)
+		if remaining <= 0 {
+			return true
+		}
+		if remaining > influxDBRetryPollInterval {
+			remaining = influxDBRetryPollInterval
+		}
+		time.Sleep(remaining)
+	}
+	return false
+}
+
+// Write sends the given line protocol data to InfluxDB. Requests that failed
+// because of connection problems, server errors or rate limiting are retried
+// with an exponential backoff bounded by RetryMaxDelayMs. Retries stop as soon
+// as the producer is not active anymore so that the data is passed to the
+// fallback instead of delaying shutdown.
+func (writer *influxDBWriter20) Write(data []byte) (int, error) {
+	if err := writer.compress(data); err != nil {
+		return 0, err
+	}
+
+	delay := writer.retryDelay
+	for retry := 0; ; retry++ {
+		err := writer.post()
+		if err == nil {
+			writer.connectionUp = true
+			return len(data), nil // ### return, OK ###
+		}
+
+		retryErr, canRetry := err.(influxDBRetryError)
+		if !canRetry || retry >= writer.retryCount || !writer.isActive() {
+			return 0, err // ### return, failed ###
+		}
+
+		wait := delay
+		if retryErr.retryAfter > wait {
+			wait = retryErr.retryAfter
+		}
+		if wait > writer.retryMaxDelay {
+			wait = writer.retryMaxDelay
+		}
+
+		writer.logger.WithError(err).Warningf("Write failed, retrying in %s", wait)
+		if !writer.wait(wait) {
+			return 0, err // ### return, producer stopped ###
+		}
+		delay *= 2
+	}
+}
@@ -159,6 +159,14 @@ func (prod *AwsCloudwatchLogs) processBatch(messages []*core.Message) []*core.Me
 // Put log events and update sequence token.
 // Possible errors http://docs.aws.amazon.com/AmazonCloudWatchLogs/latest/APIReference/API_PutLogEvents.html
 func (prod *AwsCloudwatchLogs) upload(messages []*core.Message) {
+	// Log events copy the payload and failed batches are not retried, so no
+	// message is required after this call.
+	defer func(batch []*core.Message) {
+		for _, msg := range batch {
+			msg.Release()
+		}
+	}(messages)
+
 	messages = prod.processBatch(messages)
 	if len(messages) == 0 {
 		return
@@ -242,6 +242,10 @@ func (prod *AwsKinesis) transformMessages(messages []*core.Message) {
 				for _, msg := range records.original[msgIdx] {
 					prod.TryFallback(msg)
 				}
+				continue
+			}
+			for _, msg := range records.original[msgIdx] {
+				msg.Release()
 			}
 		}
 	}
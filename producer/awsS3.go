@@ -17,6 +17,7 @@ package producer
 import (
 	"fmt"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -29,6 +30,8 @@ import (
 
 const defaultAwsEndpoint = "s3.amazonaws.com"
 
+var s3KeyTimePlaceholder = regexp.MustCompile(`\$\{time:([^}]*)\}`)
+
 // AwsS3 producer plugin
 //
 // This producer sends messages to Amazon S3.
@@ -38,15 +41,62 @@ const defaultAwsEndpoint = "s3.amazonaws.com"
 //
 // Please keep in mind that Amazon S3 does not support appending to
 // existing objects. Therefore rotation is mandatory in this producer.
+// Rotation is also forced shortly before a multipart upload reaches the S3
+// limit of 10000 parts. Objects that are due for rotation but have no buffered
+// messages are completed when a message for a new object arrives, so objects
+// of keys that are not used anymore do not stay open.
+//
+// S3 compatible stores like MinIO can be used by setting "Endpoint" to the
+// address of the store and enabling "PathStyle".
 //
 // Parameters
 //
-// - Bucket: The S3 bucket to upload to
+// - Bucket: The S3 bucket to upload to. A folder inside the bucket can be
+// given by "bucket/folder".
 //
 // - File: This value is used as a template for final file names. The string
-// " * " will replaced with the active stream name.
+// " * " will replaced with the active stream name. The rotation timestamp
+// is appended to the file name. This parameter is ignored if "Key" is set.
 // By default this parameter is set to "gollum_*.log"
 //
+// - Key: This value is used as a template for object keys. A "*" is replaced
+// by the stream name, "${key}" by the value of the metadata field "key" and
+// "${time:layout}" by the time the object was started, formatted by the given
+// Go time layout, e.g. "${time:2006/01/02/150405}". Messages resulting in
+// different keys are written to different objects. No timestamp is appended,
+// so the key should contain a time placeholder if rotation is used.
+// By default this parameter is set to "" which uses "File" instead.
+//
+// - PathStyle: Set to true to address buckets by path (endpoint/bucket/key)
+// instead of by virtual host (bucket.endpoint/key). This is required by most
+// S3 compatible stores.
+// By default this parameter is set to false.
+//
+// - PartSizeMB: The amount of buffered data in MB that triggers the upload of
+// a multipart upload part. S3 requires at least 5 MB. Larger parts allow
+// larger objects as an upload is limited to 10000 parts.
+// By default this parameter is set to 5.
+//
+// - Encryption: Server side encryption used for new objects. Can be set to
+// "AES256" or "aws:kms".
+// By default this parameter is set to "" (no encryption).
+//
+// - EncryptionKeyId: The KMS key id used if "Encryption" is set to "aws:kms".
+// If not set, the default key of the account is used.
+// By default this parameter is set to "".
+//
+// - StatePath: A directory used to store the state of unfinished multipart
+// uploads and the data not yet uploaded. Uploads interrupted by a restart
+// or a failing S3 connection are resumed and completed when the producer is
+// started again. State is not stored if this parameter is empty.
+// By default this parameter is set to "".
+//
+// - RetryDelaySec: The minimum number of seconds between two attempts to
+// upload a part after an error. Data stays buffered until the upload succeeds.
+// Uploads that cannot be completed after rotation are retried in the same
+// interval.
+// By default this parameter is set to 10.
+//
 // Examples
 //
 // This example sends all received messages from all streams to S3, creating
@@ -74,6 +124,26 @@ const defaultAwsEndpoint = "s3.amazonaws.com"
 //      - format.Envelope:
 //        Postfix: "\n"
 //
+// This example writes sessions to a MinIO server using one object per car
+// and day. Unfinished uploads are resumed after a restart:
+//
+//  S3Out:
+//    Type: producer.AwsS3
+//    Streams: telemetry
+//    Endpoint: "http://pit-server:9000"
+//    PathStyle: true
+//    Credential:
+//      Type: static
+//      Id: minio
+//      Secret: minio-secret
+//    Bucket: sessions
+//    Key: "${car}/${time:2006-01-02}/*_${time:150405}.log"
+//    PartSizeMB: 16
+//    StatePath: /var/lib/gollum/s3
+//    Rotation:
+//      TimeoutMin: 1440
+//      SizeMB: 4096
+//
 type AwsS3 struct {
 	core.DirectProducer `gollumdoc:"embed_type"`
 
@@ -85,14 +155,25 @@ type AwsS3 struct {
 	BatchConfig    components.BatchedWriterConfig `gollumdoc:"embed_type"`
 
 	// configurations
-	bucket          string `config:"Bucket" default:""`
-	fileNamePattern string `config:"File" default:"gollum_*.log"`
+	bucket          string        `config:"Bucket" default:""`
+	fileNamePattern string        `config:"File" default:"gollum_*.log"`
+	keyTemplate     string        `config:"Key" default:""`
+	pathStyle       bool          `config:"PathStyle" default:"false"`
+	partSizeMB      int           `config:"PartSizeMB" default:"5"`
+	encryption      string        `config:"Encryption" default:""`
+	kmsKeyID        string        `config:"EncryptionKeyId" default:""`
+	statePath       string        `config:"StatePath" default:""`
+	retryDelay      time.Duration `config:"RetryDelaySec" default:"10" metric:"sec"`
 
 	// properties
-	filesByStream    map[core.MessageStreamID]*components.BatchedWriterAssembly
 	files            map[string]*components.BatchedWriterAssembly
+	fileTemplates    map[string]*core.Message
 	hasWildcard      bool
+	uploadConfig     awss3.UploadConfig
 	batchedFileGuard *sync.RWMutex
+	failedUploads    []components.BatchedWriter
+	lastUploadRetry  time.Time
+	uploadGuard      *sync.Mutex
 	s3Client         *s3.S3
 }
 
@@ -105,18 +186,43 @@ func (prod *AwsS3) Configure(conf core.PluginConfigReader) {
 	prod.SetRollCallback(prod.rotateTargetFiles)
 	prod.SetStopCallback(prod.close)
 
-	prod.filesByStream = make(map[core.MessageStreamID]*components.BatchedWriterAssembly)
 	prod.files = make(map[string]*components.BatchedWriterAssembly)
+	prod.fileTemplates = make(map[string]*core.Message)
 
 	prod.hasWildcard = strings.IndexByte(prod.fileNamePattern, '*') != -1
 	prod.Rotate.Enabled = true // force rotation
 
+	partSize := int64(prod.partSizeMB) * 1024 * 1024
+	if partSize < awss3.MinUploadPartSize || partSize > awss3.MaxUploadPartSize {
+		conf.Errors.Pushf("PartSizeMB must be between 5 and 5120")
+	}
+
+	switch prod.encryption {
+	case "", s3.ServerSideEncryptionAes256, s3.ServerSideEncryptionAwsKms:
+	default:
+		conf.Errors.Pushf("Unknown Encryption '%s', expected AES256 or aws:kms", prod.encryption)
+	}
+
+	if prod.kmsKeyID != "" && prod.encryption != s3.ServerSideEncryptionAwsKms {
+		conf.Errors.Pushf("EncryptionKeyId requires Encryption to be set to aws:kms")
+	}
+
+	prod.uploadConfig = awss3.UploadConfig{
+		PartSize:             int(partSize),
+		ServerSideEncryption: prod.encryption,
+		KMSKeyID:             prod.kmsKeyID,
+		StatePath:            prod.statePath,
+		RetryDelay:           prod.retryDelay,
+	}
+
 	prod.batchedFileGuard = new(sync.RWMutex)
+	prod.uploadGuard = new(sync.Mutex)
 }
 
 // Produce writes to a buffer that is send to S3 as a multipart upload.
 func (prod *AwsS3) Produce(workers *sync.WaitGroup) {
 	prod.initS3Client()
+	prod.resumeUploads()
 
 	prod.AddMainWorker(workers)
 	prod.TickerMessageControlLoop(prod.writeMessage, prod.BatchConfig.BatchTimeout, prod.writeBatchOnTimeOut)
@@ -139,13 +245,64 @@ func (prod *AwsS3) initS3Client() {
 		}
 	}
 
+	if prod.pathStyle {
+		awsConfig.WithS3ForcePathStyle(true)
+	}
+
 	prod.s3Client = s3.New(sess, awsConfig)
 }
 
-func (prod *AwsS3) getBatchedFile(streamID core.MessageStreamID, forceRotate bool) (*components.BatchedWriterAssembly, error) {
-	// get batchedFile from filesByStream[streamID] map
+// resumeUploads completes all uploads left unfinished by a previous run
+func (prod *AwsS3) resumeUploads() {
+	for _, writer := range awss3.ResumeUploads(prod.s3Client, prod.uploadConfig, prod.Logger) {
+		if prod.closeWriter(writer) {
+			prod.Logger.Info("Completed resumed upload ", writer.Name())
+		}
+	}
+}
+
+// closeWriter completes the upload of the given writer. Failed uploads are
+// retried by retryFailedUploads. True is returned if the upload is complete.
+func (prod *AwsS3) closeWriter(writer components.BatchedWriter) bool {
+	if err := writer.Close(); err != nil {
+		prod.Logger.WithError(err).Errorf("Can't complete upload %s, retrying in %s", writer.Name(), prod.retryDelay)
+		prod.uploadGuard.Lock()
+		prod.failedUploads = append(prod.failedUploads, writer)
+		prod.uploadGuard.Unlock()
+		return false
+	}
+	return true
+}
+
+// retryFailedUploads tries to complete failed uploads again if RetryDelaySec
+// has passed since the last attempt. Uploads are completed in the background.
+func (prod *AwsS3) retryFailedUploads() {
+	prod.uploadGuard.Lock()
+	defer prod.uploadGuard.Unlock()
+
+	if len(prod.failedUploads) == 0 || time.Since(prod.lastUploadRetry) < prod.retryDelay {
+		return // ### return, nothing to do ###
+	}
+
+	writers := prod.failedUploads
+	prod.failedUploads = nil
+	prod.lastUploadRetry = time.Now()
+
+	go func() {
+		for _, writer := range writers {
+			if prod.closeWriter(writer) {
+				prod.Logger.Info("Completed upload ", writer.Name())
+			}
+		}
+	}()
+}
+
+func (prod *AwsS3) getBatchedFile(msg *core.Message, forceRotate bool) (*components.BatchedWriterAssembly, error) {
+	baseFileName := prod.getBaseFileName(msg)
+
+	// get batchedFile from files[baseFileName] map
 	prod.batchedFileGuard.RLock()
-	batchedFile, fileExists := prod.filesByStream[streamID]
+	batchedFile, fileExists := prod.files[baseFileName]
 	prod.batchedFileGuard.RUnlock()
 	if fileExists {
 		if rotate, err := prod.needsRotate(batchedFile, forceRotate); !rotate {
@@ -157,17 +314,18 @@ func (prod *AwsS3) getBatchedFile(streamID core.MessageStreamID, forceRotate boo
 	defer prod.batchedFileGuard.Unlock()
 
 	// check again to avoid race conditions
-	if batchedFile, fileExists = prod.filesByStream[streamID]; fileExists {
+	if batchedFile, fileExists = prod.files[baseFileName]; fileExists {
 		if rotate, err := prod.needsRotate(batchedFile, forceRotate); !rotate {
 			return batchedFile, err // ### return, already open or error ###
 		}
 	}
 
-	baseFileName := prod.getBaseFileName(streamID)
-
-	// get batchedFile from files[path] and assure the file is correctly mapped
-	batchedFile, fileExists = prod.files[baseFileName]
 	if !fileExists {
+		if forceRotate {
+			return nil, nil // ### return, evicted ###
+		}
+		prod.evictIdleFiles()
+
 		batchedFile = components.NewBatchedWriterAssembly(
 			prod.BatchConfig,
 			prod,
@@ -175,8 +333,10 @@ func (prod *AwsS3) getBatchedFile(streamID core.MessageStreamID, forceRotate boo
 			prod.Logger,
 		)
 
-		prod.filesByStream[streamID] = batchedFile
+		// keep stream and metadata to name objects created by rotation
+		template := core.NewMessage(nil, nil, msg.TryGetMetadata().Clone(), msg.GetStreamID())
 		prod.files[baseFileName] = batchedFile
+		prod.fileTemplates[baseFileName] = template
 	}
 
 	// Close existing batchedFile.writer
@@ -184,37 +344,72 @@ func (prod *AwsS3) getBatchedFile(streamID core.MessageStreamID, forceRotate boo
 		oldAwsWriter := batchedFile.GetWriterAndUnset()
 
 		prod.Logger.Info("Rotated ", oldAwsWriter.Name(), " -> ", baseFileName)
-		go oldAwsWriter.Close() // close in subroutine for eventually compression in the background
+		go prod.closeWriter(oldAwsWriter) // complete the upload in the background
 	}
 
 	// Update BatchedWriterAssembly writer
-	writer := awss3.NewBatchedFileWriter(prod.s3Client, prod.bucket, prod.getFinalFileName(baseFileName), prod.Logger)
+	writer := awss3.NewBatchedFileWriter(prod.s3Client, prod.bucket, prod.getFinalFileName(baseFileName, msg, time.Now()), prod.uploadConfig, prod.Logger)
 	batchedFile.SetWriter(&writer)
 
 	return batchedFile, nil
 }
 
+// evictIdleFiles removes all objects that are due for rotation and have no
+// buffered messages. Their uploads are completed in the background and the next
+// message for such an object starts a new one. This keeps the list of objects
+// from growing with each new key. The caller has to hold batchedFileGuard.
+func (prod *AwsS3) evictIdleFiles() {
+	for baseFileName, batchedFile := range prod.files {
+		if !batchedFile.Batch.IsEmpty() {
+			continue
+		}
+		if rotate, err := batchedFile.NeedsRotate(prod.Rotate, false); !rotate || err != nil {
+			continue
+		}
+
+		delete(prod.files, baseFileName)
+		delete(prod.fileTemplates, baseFileName)
+		if !batchedFile.HasWriter() {
+			continue
+		}
+
+		writer := batchedFile.GetWriterAndUnset()
+		prod.Logger.Info("Closing idle ", writer.Name())
+		go func(batchedFile *components.BatchedWriterAssembly) {
+			batchedFile.Batch.WaitForFlush(prod.BatchConfig.BatchFlushTimeout)
+			prod.closeWriter(writer)
+		}(batchedFile)
+	}
+}
+
 func (prod *AwsS3) needsRotate(batchedFile *components.BatchedWriterAssembly, forceRotate bool) (bool, error) {
 	// run default rotation checks
 	if needUpload, err := batchedFile.NeedsRotate(prod.Rotate, forceRotate); needUpload {
 		return true, err
 	}
 
-	// check if max multipart uploads of 1000 reached
-	// @see: http://docs.aws.amazon.com/AmazonS3/latest/dev/mpuoverview.html
-	// we use 995 to have a small buffer to the limit and need at least +1 upload part for the last flush
+	// check if max multipart uploads of 10000 reached
+	// @see: http://docs.aws.amazon.com/AmazonS3/latest/dev/qfacts.html
+	// we keep a small buffer to the limit and need at least +1 upload part for the last flush
 	writer, ok := batchedFile.GetWriter().(awss3.BatchedFileWriterInterface)
-	if ok && writer.GetUploadCount() > 995 {
-		prod.Logger.Debug("Rotate true: ", "upload count reached limit of 1000")
+	if ok && writer.GetUploadCount() > awss3.MaxUploadParts-5 {
+		prod.Logger.Debug("Rotate true: ", "upload count reached limit of ", awss3.MaxUploadParts)
 		return true, nil
 	}
 
 	return false, nil
 }
 
-func (prod *AwsS3) getBaseFileName(streamID core.MessageStreamID) string {
+// getBaseFileName returns the name identifying the object a message is
+// written to. Time placeholders of the key template are left out as they
+// only change on rotation.
+func (prod *AwsS3) getBaseFileName(msg *core.Message) string {
+	if prod.keyTemplate != "" {
+		return expandTopicTemplate(s3KeyTimePlaceholder.ReplaceAllString(prod.keyTemplate, ""), msg)
+	}
+
 	if prod.hasWildcard {
-		streamName := core.StreamRegistry.GetStreamName(streamID)
+		streamName := core.StreamRegistry.GetStreamName(msg.GetStreamID())
 		return strings.Replace(prod.fileNamePattern, "*", streamName, -1)
 	}
 
@@ -222,11 +417,19 @@ func (prod *AwsS3) getBaseFileName(streamID core.MessageStreamID) string {
 }
 
 //todo: introduce padding functionality (get list from aws)
-func (prod *AwsS3) getFinalFileName(baseFileName string) string {
+func (prod *AwsS3) getFinalFileName(baseFileName string, msg *core.Message, now time.Time) string {
+	if prod.keyTemplate != "" {
+		key := s3KeyTimePlaceholder.ReplaceAllStringFunc(prod.keyTemplate, func(placeholder string) string {
+			layout := s3KeyTimePlaceholder.FindStringSubmatch(placeholder)[1]
+			return now.Format(layout)
+		})
+		return expandTopicTemplate(key, msg)
+	}
+
 	fileExt := filepath.Ext(baseFileName)
 	fileName := baseFileName[:len(baseFileName)-len(fileExt)]
 
-	timestamp := time.Now().Format(prod.Rotate.Timestamp)
+	timestamp := now.Format(prod.Rotate.Timestamp)
 	signature := fmt.Sprintf("%s_%s", fileName, timestamp)
 
 	return fmt.Sprintf("%s%s", signature, fileExt)
@@ -234,7 +437,7 @@ func (prod *AwsS3) getFinalFileName(baseFileName string) string {
 }
 
 func (prod *AwsS3) writeMessage(msg *core.Message) {
-	batchedFile, err := prod.getBatchedFile(msg.GetStreamID(), false)
+	batchedFile, err := prod.getBatchedFile(msg, false)
 	if err != nil {
 		prod.Logger.Error("Write error: ", err)
 		prod.TryFallback(msg)
@@ -245,14 +448,24 @@ func (prod *AwsS3) writeMessage(msg *core.Message) {
 }
 
 func (prod *AwsS3) writeBatchOnTimeOut() {
+	prod.batchedFileGuard.RLock()
 	for _, batchedFile := range prod.files {
 		batchedFile.FlushOnTimeOut()
 	}
+	prod.batchedFileGuard.RUnlock()
+	prod.retryFailedUploads()
 }
 
 func (prod *AwsS3) rotateTargetFiles() {
-	for streamID := range prod.filesByStream {
-		if _, err := prod.getBatchedFile(streamID, true); err != nil {
+	prod.batchedFileGuard.RLock()
+	templates := make([]*core.Message, 0, len(prod.fileTemplates))
+	for _, template := range prod.fileTemplates {
+		templates = append(templates, template)
+	}
+	prod.batchedFileGuard.RUnlock()
+
+	for _, template := range templates {
+		if _, err := prod.getBatchedFile(template, true); err != nil {
 			prod.Logger.Error("Rotate error: ", err)
 		}
 	}
@@ -264,4 +477,20 @@ func (prod *AwsS3) close() {
 	for _, batchedFile := range prod.files {
 		batchedFile.Close()
 	}
+
+	// Last attempt to complete uploads that failed before
+	prod.uploadGuard.Lock()
+	writers := prod.failedUploads
+	prod.failedUploads = nil
+	prod.uploadGuard.Unlock()
+
+	for _, writer := range writers {
+		if err := writer.Close(); err != nil {
+			if prod.statePath != "" {
+				prod.Logger.WithError(err).Errorf("Can't complete upload %s, it is resumed on the next start", writer.Name())
+			} else {
+				prod.Logger.WithError(err).Errorf("Can't complete upload %s", writer.Name())
+			}
+		}
+	}
 }
@@ -0,0 +1,173 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/components"
+	"github.com/trivago/tgo/ttesting"
+)
+
+// awsS3TestWriter fails to close a given number of times
+type awsS3TestWriter struct {
+	components.BatchedWriter
+	failures int
+	closed   chan struct{}
+}
+
+func (writer *awsS3TestWriter) Name() string {
+	return "test.log"
+}
+
+func (writer *awsS3TestWriter) IsAccessible() bool {
+	return true
+}
+
+func (writer *awsS3TestWriter) Size() int64 {
+	return 0
+}
+
+func (writer *awsS3TestWriter) Close() error {
+	if writer.failures > 0 {
+		writer.failures--
+		return fmt.Errorf("connection refused")
+	}
+	close(writer.closed)
+	return nil
+}
+
+func TestAwsS3KeyTemplate(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	prod := newTestPlugin(expect, "producer.AwsS3", "s3Key", map[string]interface{}{
+		"Bucket":     "sessions",
+		"Key":        "${car}/${time:2006-01-02}/*_${time:150405}.log",
+		"PartSizeMB": 16,
+		"PathStyle":  true,
+	}).(*AwsS3)
+	expect.Equal(16*1024*1024, prod.uploadConfig.PartSize)
+	expect.True(prod.pathStyle)
+
+	streamID := core.GetStreamID("s3KeyStream")
+	msg := core.NewMessage(nil, []byte("lap"), nil, streamID)
+	msg.GetMetadata().SetValue("car", []byte("lr24"))
+
+	now := time.Date(2024, 5, 18, 14, 30, 5, 0, time.UTC)
+	baseFileName := prod.getBaseFileName(msg)
+	expect.Equal("lr24//s3KeyStream_.log", baseFileName)
+	expect.Equal("lr24/2024-05-18/s3KeyStream_143005.log", prod.getFinalFileName(baseFileName, msg, now))
+
+	other := core.NewMessage(nil, []byte("lap"), nil, streamID)
+	other.GetMetadata().SetValue("car", []byte("lr23"))
+	expect.Neq(baseFileName, prod.getBaseFileName(other))
+}
+
+func TestAwsS3FileTemplate(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	prod := newTestPlugin(expect, "producer.AwsS3", "s3File", map[string]interface{}{
+		"Bucket":             "sessions",
+		"File":               "gollum_*.log",
+		"Rotation/Timestamp": "2006-01-02",
+	}).(*AwsS3)
+
+	msg := core.NewMessage(nil, []byte("lap"), nil, core.GetStreamID("s3FileStream"))
+	now := time.Date(2024, 5, 18, 14, 30, 5, 0, time.UTC)
+
+	baseFileName := prod.getBaseFileName(msg)
+	expect.Equal("gollum_s3FileStream.log", baseFileName)
+	expect.Equal("gollum_s3FileStream_2024-05-18.log", prod.getFinalFileName(baseFileName, msg, now))
+}
+
+func TestAwsS3ConfigErrors(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	settings := []map[string]interface{}{
+		{"PartSizeMB": 1},
+		{"Encryption": "rot13"},
+		{"EncryptionKeyId": "key", "Encryption": "AES256"},
+	}
+
+	for i, setting := range settings {
+		_, err := tryNewTestPlugin("producer.AwsS3", fmt.Sprintf("s3Error%d", i), setting)
+		expect.NotNil(err)
+	}
+}
+
+func TestAwsS3RetryFailedUploads(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	prod := newTestPlugin(expect, "producer.AwsS3", "s3Retry", map[string]interface{}{
+		"RetryDelaySec": 0,
+	}).(*AwsS3)
+
+	writer := &awsS3TestWriter{failures: 2, closed: make(chan struct{})}
+	expect.False(prod.closeWriter(writer))
+	expect.Equal(1, len(prod.failedUploads))
+
+	completed := false
+	for i := 0; i < 100 && !completed; i++ {
+		prod.retryFailedUploads()
+		select {
+		case <-writer.closed:
+			completed = true
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	expect.True(completed)
+
+	prod.uploadGuard.Lock()
+	expect.Equal(0, len(prod.failedUploads))
+	prod.uploadGuard.Unlock()
+}
+
+func TestAwsS3EvictIdleFiles(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	prod := newTestPlugin(expect, "producer.AwsS3", "s3Evict").(*AwsS3)
+	prod.Rotate.Timeout = 0
+
+	newBatchedFile := func(name string, writer components.BatchedWriter) *components.BatchedWriterAssembly {
+		batchedFile := components.NewBatchedWriterAssembly(prod.BatchConfig, prod, prod.TryFallback, prod.Logger)
+		batchedFile.SetWriter(writer)
+		prod.files[name] = batchedFile
+		prod.fileTemplates[name] = core.NewMessage(nil, nil, nil, core.InvalidStreamID)
+		return batchedFile
+	}
+
+	idle := &awsS3TestWriter{closed: make(chan struct{})}
+	newBatchedFile("idle.log", idle)
+	busy := newBatchedFile("busy.log", &awsS3TestWriter{closed: make(chan struct{})})
+	busy.Batch.Append(core.NewMessage(nil, []byte("lap"), nil, core.InvalidStreamID))
+
+	prod.batchedFileGuard.Lock()
+	prod.evictIdleFiles()
+	prod.batchedFileGuard.Unlock()
+
+	expect.MapNotSet(prod.files, "idle.log")
+	expect.MapNotSet(prod.fileTemplates, "idle.log")
+	expect.MapSet(prod.files, "busy.log")
+	expect.MapSet(prod.fileTemplates, "busy.log")
+
+	select {
+	case <-idle.closed:
+	case <-time.After(time.Second):
+		t.Error("Idle upload has not been completed")
+	}
+}
@@ -16,15 +16,46 @@ package awss3
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/sirupsen/logrus"
 	"github.com/trivago/gollum/core/components"
 )
 
-const minUploadPartSize = 5 * 1024 * 1024
+const (
+	// MinUploadPartSize is the smallest part size accepted by S3 for all but
+	// the last part of a multipart upload.
+	// @see http://docs.aws.amazon.com/AmazonS3/latest/API/mpUploadComplete.html
+	MinUploadPartSize = 5 * 1024 * 1024
+
+	// MaxUploadPartSize is the largest part size accepted by S3
+	MaxUploadPartSize = 5 * 1024 * 1024 * 1024
+
+	// MaxUploadParts is the maximum number of parts of a multipart upload
+	// @see http://docs.aws.amazon.com/AmazonS3/latest/dev/qfacts.html
+	MaxUploadParts = 10000
+)
+
+// UploadConfig contains the multipart upload settings shared by all writers
+type UploadConfig struct {
+	// PartSize is the buffer size that triggers a part upload
+	PartSize int
+	// ServerSideEncryption is passed to CreateMultipartUpload if not empty
+	ServerSideEncryption string
+	// KMSKeyID is passed to CreateMultipartUpload if not empty
+	KMSKeyID string
+	// StatePath is a directory used to persist unfinished uploads.
+	// Persistence is disabled if empty.
+	StatePath string
+	// RetryDelay is the minimum time between two attempts to upload a part
+	RetryDelay time.Duration
+}
 
 // BatchedFileWriterInterface extends the components.BatchedWriter interface for rotation checks
 type BatchedFileWriterInterface interface {
@@ -34,16 +65,19 @@ type BatchedFileWriterInterface interface {
 
 // BatchedFileWriter is the file producer core.BatchedWriter implementation for the core.BatchedWriterAssembly
 type BatchedFileWriter struct {
-	s3Client    *s3.S3
+	s3Client    s3iface.S3API
 	s3Bucket    string
 	s3SubFolder string
 	fileName    string
+	config      UploadConfig
 	logger      logrus.FieldLogger
 
-	currentMultiPart int64               // current multipart count
+	currentMultiPart int64               // part number of the last uploaded part
 	s3UploadID       *string             // upload id from s3 for active file
 	totalSize        int                 // total size off all writes to this writer (need for rotations)
 	completedParts   []*s3.CompletedPart // collection of uploaded parts
+	retryAfter       time.Time           // no part upload before this time after an error
+	state            *uploadStateFile    // nil if persistence is disabled
 
 	// need separate byte buffer for min 5mb part uploads.
 	// @see http://docs.aws.amazon.com/AmazonS3/latest/API/mpUploadComplete.html
@@ -51,7 +85,7 @@ type BatchedFileWriter struct {
 }
 
 // NewBatchedFileWriter returns a BatchedFileWriter instance
-func NewBatchedFileWriter(s3Client *s3.S3, bucket string, fileName string, logger logrus.FieldLogger) BatchedFileWriter {
+func NewBatchedFileWriter(s3Client s3iface.S3API, bucket string, fileName string, config UploadConfig, logger logrus.FieldLogger) BatchedFileWriter {
 	var s3Bucket, s3SubFolder string
 
 	if strings.Contains(bucket, "/") {
@@ -62,11 +96,16 @@ func NewBatchedFileWriter(s3Client *s3.S3, bucket string, fileName string, logge
 		s3SubFolder = ""
 	}
 
+	if config.PartSize < MinUploadPartSize {
+		config.PartSize = MinUploadPartSize
+	}
+
 	batchedFileWriter := BatchedFileWriter{
 		s3Client:    s3Client,
 		s3Bucket:    s3Bucket,
 		s3SubFolder: s3SubFolder,
 		fileName:    fileName,
+		config:      config,
 		logger:      logger,
 	}
 
@@ -81,22 +120,34 @@ func (w *BatchedFileWriter) init() {
 	w.completedParts = []*s3.CompletedPart{}
 	w.activeBuffer = newS3ByteBuffer()
 
-	w.createMultipartUpload()
+	if err := w.createMultipartUpload(); err == nil {
+		w.openState()
+	}
 }
 
 // Write is part of the BatchedWriter interface and wraps the file.Write() implementation
 func (w *BatchedFileWriter) Write(p []byte) (n int, err error) {
 	w.activeBuffer.Write(p)
+	if w.state != nil {
+		if err := w.state.appendBuffer(p); err != nil {
+			w.logger.WithError(err).Warning("Can't write upload buffer to disk")
+		}
+	}
 
-	if size, _ := w.activeBuffer.Size(); size >= minUploadPartSize {
+	length := len(p)
+	w.totalSize += length
+
+	size, _ := w.activeBuffer.Size()
+	switch {
+	case size < w.config.PartSize:
+		w.logger.WithField("size", size).Debug("Buffer size not big enough vor request")
+	case time.Now().Before(w.retryAfter):
+		w.logger.WithField("size", size).Debug("Delaying part upload after error")
+	default:
 		w.logger.WithField("size", size).Debug("Buffer size ready for request")
 		w.uploadPartInput()
-	} else {
-		w.logger.WithField("size", size).Debug("Buffer size not big enough vor request")
 	}
 
-	length := len(p)
-	w.totalSize += length
 	return length, nil
 }
 
@@ -115,14 +166,24 @@ func (w *BatchedFileWriter) IsAccessible() bool {
 	return w.s3UploadID != nil
 }
 
-// Close is part of the Close interface and handle the file close or compression call
+// Close is part of the Close interface and handle the file close or compression call.
+// If the upload cannot be completed, Close can be called again to retry. If a
+// state path is configured, the state is kept on disk so that the upload can
+// also be resumed by ResumeUploads.
 func (w *BatchedFileWriter) Close() error {
 	// flush upload buffer
-	err := w.uploadPartInput()
-
-	w.completeMultipartUpload()
+	if err := w.uploadPartInput(); err != nil {
+		return err
+	}
+	if err := w.completeMultipartUpload(); err != nil {
+		return err
+	}
 
-	return err
+	if w.state != nil {
+		w.state.remove()
+		w.state = nil
+	}
+	return nil
 }
 
 // GetUploadCount returns the count of completed part uploads
@@ -138,68 +199,93 @@ func (w *BatchedFileWriter) getS3Path() string {
 	return w.Name()
 }
 
-func (w *BatchedFileWriter) uploadPartInput() (err error) {
+func (w *BatchedFileWriter) uploadPartInput() error {
 	if size, _ := w.activeBuffer.Size(); size < 1 {
-		w.logger.Warning("uploadPartInput(): empty buffer - no upload necessary")
-		return
+		w.logger.Debug("uploadPartInput(): empty buffer - no upload necessary")
+		return nil
 	}
 
-	// increase and get currentMultiPart count
-	w.currentMultiPart++
-	currentMultiPart := w.currentMultiPart
+	if w.s3UploadID == nil {
+		if err := w.createMultipartUpload(); err != nil {
+			return err
+		}
+		w.openState()
+	}
 
-	// get and reset active buffer
+	partNumber := w.currentMultiPart + 1
 	buffer := w.activeBuffer
-	w.activeBuffer = newS3ByteBuffer()
+	buffer.Seek(0, io.SeekStart)
 
 	input := &s3.UploadPartInput{
 		Body:       buffer,
 		Bucket:     aws.String(w.s3Bucket),
 		Key:        aws.String(w.getS3Path()),
-		PartNumber: aws.Int64(currentMultiPart),
+		PartNumber: aws.Int64(partNumber),
 		UploadId:   w.s3UploadID,
 	}
 
 	result, err := w.s3Client.UploadPart(input)
 	if err != nil {
-		w.logger.WithError(err).WithField("input", input).Errorf("Can't upload part '%d'", currentMultiPart)
-		return
+		// keep the buffer so the part is sent again with the next attempt
+		buffer.Seek(0, io.SeekEnd)
+		w.retryAfter = time.Now().Add(w.config.RetryDelay)
+		w.logger.WithError(err).
+			WithField("file", w.Name()).
+			Errorf("Can't upload part '%d'", partNumber)
+		return err
 	}
 
 	w.logger.
-		WithField("part", currentMultiPart).
+		WithField("part", partNumber).
 		WithField("result", result).
 		Debug("upload part successfully send")
 
 	completedPart := s3.CompletedPart{}
-	completedPart.SetETag(*result.ETag)
-	completedPart.SetPartNumber(currentMultiPart)
+	completedPart.SetETag(aws.StringValue(result.ETag))
+	completedPart.SetPartNumber(partNumber)
 
 	w.completedParts = append(w.completedParts, &completedPart)
+	w.currentMultiPart = partNumber
+	w.activeBuffer = newS3ByteBuffer()
+	w.retryAfter = time.Time{}
 
-	return
+	if w.state != nil {
+		if err := w.state.resetBuffer(); err != nil {
+			w.logger.WithError(err).Warning("Can't reset upload buffer on disk")
+		}
+		w.saveState()
+	}
+	return nil
 }
 
-func (w *BatchedFileWriter) createMultipartUpload() {
+func (w *BatchedFileWriter) createMultipartUpload() error {
 	input := &s3.CreateMultipartUploadInput{
 		Bucket: aws.String(w.s3Bucket),
 		Key:    aws.String(w.getS3Path()),
 	}
+	if w.config.ServerSideEncryption != "" {
+		input.SetServerSideEncryption(w.config.ServerSideEncryption)
+	}
+	if w.config.KMSKeyID != "" {
+		input.SetSSEKMSKeyId(w.config.KMSKeyID)
+	}
 
 	result, err := w.s3Client.CreateMultipartUpload(input)
 	if err != nil {
 		w.logger.WithError(err).WithField("file", w.Name()).Error("Can't create multipart upload")
-		return
+		return err
 	}
 
 	w.s3UploadID = result.UploadId
-	w.logger.WithField("uploadId", result.UploadId).Debug("successfully created multipart upload")
+	w.logger.WithField("uploadId", aws.StringValue(result.UploadId)).Debug("successfully created multipart upload")
+	return nil
 }
 
-func (w *BatchedFileWriter) completeMultipartUpload() {
-	if w.currentMultiPart < 1 {
-		w.logger.Warning("No completeMultipartUpload request necessary for zero parts")
-		return
+func (w *BatchedFileWriter) completeMultipartUpload() error {
+	if len(w.completedParts) < 1 {
+		w.logger.Debug("No completeMultipartUpload request necessary for zero parts")
+		w.abortMultipartUpload()
+		return nil
 	}
 
 	input := &s3.CompleteMultipartUploadInput{
@@ -214,15 +300,182 @@ func (w *BatchedFileWriter) completeMultipartUpload() {
 	result, err := w.s3Client.CompleteMultipartUpload(input)
 	if err != nil {
 		w.logger.WithError(err).
-			WithField("input", input).
+			WithField("file", w.Name()).
 			WithField("response", result).
 			Error("Can't complete multipart upload")
-		return
+		return err
 	}
 
 	w.logger.
-		WithField("location", *result.Location).
+		WithField("location", aws.StringValue(result.Location)).
 		WithField("parts", len(w.completedParts)).
 		Debug("successfully completed MultipartUpload")
 	w.s3UploadID = nil // reset upload id
+	return nil
+}
+
+func (w *BatchedFileWriter) abortMultipartUpload() {
+	if w.s3UploadID == nil {
+		return
+	}
+
+	_, err := w.s3Client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(w.s3Bucket),
+		Key:      aws.String(w.getS3Path()),
+		UploadId: w.s3UploadID,
+	})
+	if err != nil {
+		w.logger.WithError(err).WithField("file", w.Name()).Warning("Can't abort empty multipart upload")
+	}
+	w.s3UploadID = nil
+}
+
+// openState creates the state files for a newly created upload
+func (w *BatchedFileWriter) openState() {
+	if w.config.StatePath == "" {
+		return
+	}
+
+	state, err := openUploadStateFile(w.config.StatePath, w.s3Bucket, w.getS3Path(), aws.StringValue(w.s3UploadID), false)
+	if err != nil {
+		w.logger.WithError(err).Error("Can't create upload state, upload will not be resumable")
+		return
+	}
+
+	w.state = state
+	w.saveState()
+}
+
+// saveState stores the upload together with the number of the part the
+// buffered data is uploaded as.
+func (w *BatchedFileWriter) saveState() {
+	err := w.state.save(uploadState{
+		Bucket:               w.s3Bucket,
+		Key:                  w.getS3Path(),
+		UploadID:             aws.StringValue(w.s3UploadID),
+		BufferPart:           w.currentMultiPart + 1,
+		ServerSideEncryption: w.config.ServerSideEncryption,
+		KMSKeyID:             w.config.KMSKeyID,
+		SavedAt:              time.Now(),
+	})
+	if err != nil {
+		w.logger.WithError(err).Warning("Can't save upload state")
+	}
+}
+
+// ResumeUploads loads all unfinished uploads stored in config.StatePath and
+// returns writers continuing them. Parts already stored on S3 are taken from
+// S3, data that was not yet uploaded is read from the buffer stored next to
+// the state. A buffer that has been uploaded before the state could be updated
+// is dropped. Uploads that do not exist on S3 anymore are dropped, too.
+func ResumeUploads(s3Client s3iface.S3API, config UploadConfig, logger logrus.FieldLogger) []*BatchedFileWriter {
+	if config.StatePath == "" {
+		return nil
+	}
+
+	if config.PartSize < MinUploadPartSize {
+		config.PartSize = MinUploadPartSize
+	}
+
+	files, err := listUploadStateFiles(config.StatePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.WithError(err).Error("Can't read upload states")
+		}
+		return nil
+	}
+
+	writers := []*BatchedFileWriter{}
+	for _, file := range files {
+		writer, err := resumeUpload(s3Client, file, config, logger)
+		if err != nil {
+			logger.WithError(err).WithField("state", file).Error("Can't resume upload")
+			continue
+		}
+		writers = append(writers, writer)
+	}
+	return writers
+}
+
+func resumeUpload(s3Client s3iface.S3API, stateFileName string, config UploadConfig, logger logrus.FieldLogger) (*BatchedFileWriter, error) {
+	state, err := loadUploadState(stateFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	if state.ServerSideEncryption != config.ServerSideEncryption || state.KMSKeyID != config.KMSKeyID {
+		logger.WithField("file", state.Key).
+			WithField("encryption", state.ServerSideEncryption).
+			Warning("Resumed upload keeps the server side encryption it was created with")
+	}
+
+	w := &BatchedFileWriter{
+		s3Client:     s3Client,
+		s3Bucket:     state.Bucket,
+		fileName:     state.Key,
+		config:       config,
+		logger:       logger,
+		s3UploadID:   aws.String(state.UploadID),
+		activeBuffer: newS3ByteBuffer(),
+	}
+	partSizes := make(map[int64]int64)
+
+	input := &s3.ListPartsInput{
+		Bucket:   aws.String(state.Bucket),
+		Key:      aws.String(state.Key),
+		UploadId: aws.String(state.UploadID),
+	}
+	err = s3Client.ListPartsPages(input, func(page *s3.ListPartsOutput, lastPage bool) bool {
+		for _, part := range page.Parts {
+			partNumber := aws.Int64Value(part.PartNumber)
+			partSizes[partNumber] = aws.Int64Value(part.Size)
+			w.totalSize += int(aws.Int64Value(part.Size))
+			w.completedParts = append(w.completedParts, &s3.CompletedPart{
+				ETag:       part.ETag,
+				PartNumber: aws.Int64(partNumber),
+			})
+			if partNumber > w.currentMultiPart {
+				w.currentMultiPart = partNumber
+			}
+		}
+		return true
+	})
+	if err != nil {
+		if isNoSuchUpload(err) {
+			removeUploadState(stateFileName)
+			return nil, fmt.Errorf("upload %s of %s does not exist anymore: %s", state.UploadID, state.Key, err)
+		}
+		return nil, err
+	}
+
+	w.state, err = openUploadStateFile(config.StatePath, state.Bucket, state.Key, state.UploadID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	buffer, err := w.state.readBuffer()
+	if err != nil {
+		return nil, err
+	}
+
+	// The buffer is kept until its part has been uploaded, so a crash in
+	// between leaves a buffer behind that is already stored on S3.
+	if size, uploaded := partSizes[state.BufferPart]; uploaded && len(buffer) > 0 && size == int64(len(buffer)) {
+		logger.WithField("file", state.Key).
+			WithField("part", state.BufferPart).
+			Info("Buffer has already been uploaded")
+		if err := w.state.resetBuffer(); err != nil {
+			return nil, err
+		}
+		w.saveState()
+		buffer = nil
+	}
+	w.activeBuffer.Write(buffer)
+	w.totalSize += len(buffer)
+
+	logger.WithField("file", state.Key).
+		WithField("parts", len(w.completedParts)).
+		WithField("buffered", len(buffer)).
+		Info("Resumed multipart upload")
+	return w, nil
 }
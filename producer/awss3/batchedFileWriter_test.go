@@ -0,0 +1,305 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package awss3
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/sirupsen/logrus"
+	"github.com/trivago/tgo/ttesting"
+)
+
+// s3TestClient is an in memory multipart upload implementation
+type s3TestClient struct {
+	s3iface.S3API
+	uploads   map[string]map[int64][]byte
+	keys      map[string]string
+	objects   map[string][]byte
+	encrypted map[string]string
+	failParts int
+	nextID    int
+}
+
+func newS3TestClient() *s3TestClient {
+	return &s3TestClient{
+		uploads:   make(map[string]map[int64][]byte),
+		keys:      make(map[string]string),
+		objects:   make(map[string][]byte),
+		encrypted: make(map[string]string),
+	}
+}
+
+func (client *s3TestClient) CreateMultipartUpload(input *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error) {
+	client.nextID++
+	uploadID := fmt.Sprintf("upload-%d", client.nextID)
+	client.uploads[uploadID] = make(map[int64][]byte)
+	client.keys[uploadID] = *input.Bucket + "/" + *input.Key
+	client.encrypted[uploadID] = aws.StringValue(input.ServerSideEncryption)
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String(uploadID)}, nil
+}
+
+func (client *s3TestClient) UploadPart(input *s3.UploadPartInput) (*s3.UploadPartOutput, error) {
+	if client.failParts > 0 {
+		client.failParts--
+		return nil, fmt.Errorf("connection refused")
+	}
+
+	parts, exists := client.uploads[*input.UploadId]
+	if !exists {
+		return nil, awserr.New(s3.ErrCodeNoSuchUpload, "no such upload", nil)
+	}
+
+	data, err := ioutil.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	parts[*input.PartNumber] = data
+	return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprintf("etag-%d", *input.PartNumber))}, nil
+}
+
+func (client *s3TestClient) ListPartsPages(input *s3.ListPartsInput, fn func(*s3.ListPartsOutput, bool) bool) error {
+	parts, exists := client.uploads[*input.UploadId]
+	if !exists {
+		return awserr.New(s3.ErrCodeNoSuchUpload, "no such upload", nil)
+	}
+
+	output := &s3.ListPartsOutput{}
+	for number := range parts {
+		output.Parts = append(output.Parts, &s3.Part{
+			PartNumber: aws.Int64(number),
+			ETag:       aws.String(fmt.Sprintf("etag-%d", number)),
+			Size:       aws.Int64(int64(len(parts[number]))),
+		})
+	}
+	sort.Slice(output.Parts, func(i, j int) bool {
+		return *output.Parts[i].PartNumber < *output.Parts[j].PartNumber
+	})
+	fn(output, true)
+	return nil
+}
+
+func (client *s3TestClient) CompleteMultipartUpload(input *s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, error) {
+	parts, exists := client.uploads[*input.UploadId]
+	if !exists {
+		return nil, awserr.New(s3.ErrCodeNoSuchUpload, "no such upload", nil)
+	}
+
+	object := []byte{}
+	for _, part := range input.MultipartUpload.Parts {
+		object = append(object, parts[*part.PartNumber]...)
+	}
+
+	key := client.keys[*input.UploadId]
+	client.objects[key] = object
+	delete(client.uploads, *input.UploadId)
+	return &s3.CompleteMultipartUploadOutput{Location: aws.String(key)}, nil
+}
+
+func (client *s3TestClient) AbortMultipartUpload(input *s3.AbortMultipartUploadInput) (*s3.AbortMultipartUploadOutput, error) {
+	delete(client.uploads, *input.UploadId)
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func newTestLogger() logrus.FieldLogger {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	return logger
+}
+
+func TestBatchedFileWriterParts(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	client := newS3TestClient()
+
+	config := UploadConfig{PartSize: MinUploadPartSize, ServerSideEncryption: s3.ServerSideEncryptionAes256}
+	writer := NewBatchedFileWriter(client, "bucket/folder", "test.log", config, newTestLogger())
+	expect.True(writer.IsAccessible())
+	expect.Equal(s3.ServerSideEncryptionAes256, client.encrypted["upload-1"])
+
+	part := []byte(strings.Repeat("a", MinUploadPartSize))
+	writer.Write(part)
+	expect.Equal(1, writer.GetUploadCount())
+	expect.Equal(part, client.uploads["upload-1"][1])
+
+	writer.Write([]byte("tail"))
+	expect.NoError(writer.Close())
+	expect.Equal(append(part, []byte("tail")...), client.objects["bucket/folder/test.log"])
+}
+
+func TestBatchedFileWriterRetry(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	client := newS3TestClient()
+	client.failParts = 1
+
+	writer := NewBatchedFileWriter(client, "bucket", "test.log", UploadConfig{}, newTestLogger())
+
+	part := []byte(strings.Repeat("a", MinUploadPartSize))
+	writer.Write(part)
+	expect.Equal(0, writer.GetUploadCount())
+
+	writer.Write([]byte("b"))
+	expect.Equal(1, writer.GetUploadCount())
+	expect.Equal(append(part, 'b'), client.uploads["upload-1"][1])
+
+	expect.NoError(writer.Close())
+	expect.Equal(MinUploadPartSize+1, len(client.objects["bucket/test.log"]))
+}
+
+func TestBatchedFileWriterResume(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	client := newS3TestClient()
+
+	statePath, err := ioutil.TempDir("", "gollum-s3")
+	expect.NoError(err)
+	defer os.RemoveAll(statePath)
+
+	config := UploadConfig{StatePath: statePath}
+	writer := NewBatchedFileWriter(client, "bucket", "test.log", config, newTestLogger())
+
+	part := []byte(strings.Repeat("a", MinUploadPartSize))
+	writer.Write(part)
+	writer.Write([]byte("pending"))
+	expect.Equal(1, writer.GetUploadCount())
+
+	// simulate a restart without closing the writer
+	writer.state.buffer.Close()
+
+	writers := ResumeUploads(client, config, newTestLogger())
+	expect.Equal(1, len(writers))
+
+	resumed := writers[0]
+	expect.Equal("test.log", resumed.Name())
+	expect.Equal(1, resumed.GetUploadCount())
+	expect.Equal(MinUploadPartSize+len("pending"), int(resumed.Size()))
+
+	expect.NoError(resumed.Close())
+	expect.Equal(append(part, []byte("pending")...), client.objects["bucket/test.log"])
+
+	states, _ := filepath.Glob(filepath.Join(statePath, "*"))
+	expect.Equal(0, len(states))
+}
+
+func TestBatchedFileWriterResumeMissingUpload(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	client := newS3TestClient()
+
+	statePath, err := ioutil.TempDir("", "gollum-s3")
+	expect.NoError(err)
+	defer os.RemoveAll(statePath)
+
+	config := UploadConfig{StatePath: statePath}
+	writer := NewBatchedFileWriter(client, "bucket", "test.log", config, newTestLogger())
+	writer.Write([]byte("pending"))
+	writer.state.buffer.Close()
+
+	client.uploads = make(map[string]map[int64][]byte)
+	expect.Equal(0, len(ResumeUploads(client, config, newTestLogger())))
+
+	states, _ := filepath.Glob(filepath.Join(statePath, "*"))
+	expect.Equal(0, len(states))
+}
+
+func TestBatchedFileWriterRotateState(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	client := newS3TestClient()
+
+	statePath, err := ioutil.TempDir("", "gollum-s3")
+	expect.NoError(err)
+	defer os.RemoveAll(statePath)
+
+	// The old writer is closed after the new one has been created for the
+	// same key, like on rotation.
+	config := UploadConfig{StatePath: statePath}
+	oldWriter := NewBatchedFileWriter(client, "bucket", "test.log", config, newTestLogger())
+	oldWriter.Write([]byte("old"))
+
+	newWriter := NewBatchedFileWriter(client, "bucket", "test.log", config, newTestLogger())
+	newWriter.Write([]byte("new"))
+	expect.NoError(oldWriter.Close())
+	expect.Equal("old", string(client.objects["bucket/test.log"]))
+
+	newWriter.state.buffer.Close()
+	writers := ResumeUploads(client, config, newTestLogger())
+	expect.Equal(1, len(writers))
+	expect.NoError(writers[0].Close())
+	expect.Equal("new", string(client.objects["bucket/test.log"]))
+}
+
+func TestBatchedFileWriterResumeUploadedBuffer(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	client := newS3TestClient()
+
+	statePath, err := ioutil.TempDir("", "gollum-s3")
+	expect.NoError(err)
+	defer os.RemoveAll(statePath)
+
+	config := UploadConfig{StatePath: statePath}
+	writer := NewBatchedFileWriter(client, "bucket", "test.log", config, newTestLogger())
+	writer.Write([]byte("pending"))
+
+	// simulate a restart after the buffer has been uploaded but before the
+	// buffer on disk has been cleared
+	_, err = client.UploadPart(&s3.UploadPartInput{
+		Body:       strings.NewReader("pending"),
+		Bucket:     aws.String("bucket"),
+		Key:        aws.String("test.log"),
+		PartNumber: aws.Int64(1),
+		UploadId:   writer.s3UploadID,
+	})
+	expect.NoError(err)
+	writer.state.buffer.Close()
+
+	writers := ResumeUploads(client, config, newTestLogger())
+	expect.Equal(1, len(writers))
+
+	resumed := writers[0]
+	expect.Equal(1, resumed.GetUploadCount())
+	expect.Equal(len("pending"), int(resumed.Size()))
+
+	expect.NoError(resumed.Close())
+	expect.Equal("pending", string(client.objects["bucket/test.log"]))
+}
+
+func TestBatchedFileWriterCloseRetry(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	client := newS3TestClient()
+
+	statePath, err := ioutil.TempDir("", "gollum-s3")
+	expect.NoError(err)
+	defer os.RemoveAll(statePath)
+
+	config := UploadConfig{StatePath: statePath}
+	writer := NewBatchedFileWriter(client, "bucket", "test.log", config, newTestLogger())
+	writer.Write([]byte("pending"))
+
+	client.failParts = 1
+	expect.NotNil(writer.Close())
+	states, _ := filepath.Glob(filepath.Join(statePath, "*"))
+	expect.Equal(2, len(states))
+
+	expect.NoError(writer.Close())
+	expect.Equal("pending", string(client.objects["bucket/test.log"]))
+	states, _ = filepath.Glob(filepath.Join(statePath, "*"))
+	expect.Equal(0, len(states))
+}
@@ -0,0 +1,150 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package awss3
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	uploadStateExt  = ".json"
+	uploadBufferExt = ".buffer"
+)
+
+// uploadState is the persisted state of an unfinished multipart upload
+type uploadState struct {
+	Bucket               string    `json:"bucket"`
+	Key                  string    `json:"key"`
+	UploadID             string    `json:"uploadId"`
+	BufferPart           int64     `json:"bufferPart"`
+	ServerSideEncryption string    `json:"serverSideEncryption,omitempty"`
+	KMSKeyID             string    `json:"kmsKeyId,omitempty"`
+	SavedAt              time.Time `json:"savedAt"`
+}
+
+// uploadStateFile stores the state of an upload and the data not yet sent
+// to S3 inside a state directory.
+type uploadStateFile struct {
+	basePath string
+	buffer   *os.File
+}
+
+// openUploadStateFile opens the state of the given upload. State files are
+// named after the upload id, so uploads replacing each other on rotation never
+// share their state. The buffer file is truncated unless keepBuffer is set.
+func openUploadStateFile(dir, bucket, key, uploadID string, keepBuffer bool) (*uploadStateFile, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	hash := sha1.Sum([]byte(bucket + "/" + key + "/" + uploadID))
+	basePath := filepath.Join(dir, hex.EncodeToString(hash[:]))
+
+	flags := os.O_CREATE | os.O_RDWR | os.O_APPEND
+	if !keepBuffer {
+		flags |= os.O_TRUNC
+	}
+
+	buffer, err := os.OpenFile(basePath+uploadBufferExt, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &uploadStateFile{
+		basePath: basePath,
+		buffer:   buffer,
+	}, nil
+}
+
+// save writes the given state. The state is written to a temporary file first
+// so that a crash does not leave a broken state behind.
+func (file *uploadStateFile) save(state uploadState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tmpFileName := file.basePath + uploadStateExt + ".tmp"
+	if err := ioutil.WriteFile(tmpFileName, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFileName, file.basePath+uploadStateExt)
+}
+
+func (file *uploadStateFile) appendBuffer(data []byte) error {
+	_, err := file.buffer.Write(data)
+	return err
+}
+
+func (file *uploadStateFile) resetBuffer() error {
+	return file.buffer.Truncate(0)
+}
+
+func (file *uploadStateFile) readBuffer() ([]byte, error) {
+	return ioutil.ReadFile(file.basePath + uploadBufferExt)
+}
+
+// remove closes the buffer file and removes state and buffer once the upload
+// is done.
+func (file *uploadStateFile) remove() {
+	file.buffer.Close()
+	removeUploadState(file.basePath + uploadStateExt)
+}
+
+func loadUploadState(stateFileName string) (uploadState, error) {
+	state := uploadState{}
+	data, err := ioutil.ReadFile(stateFileName)
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(data, &state)
+	return state, err
+}
+
+func removeUploadState(stateFileName string) {
+	basePath := strings.TrimSuffix(stateFileName, uploadStateExt)
+	os.Remove(basePath + uploadStateExt)
+	os.Remove(basePath + uploadBufferExt)
+}
+
+func listUploadStateFiles(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), uploadStateExt) {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return files, nil
+}
+
+func isNoSuchUpload(err error) bool {
+	awsErr, isAwsErr := err.(awserr.Error)
+	return isAwsErr && awsErr.Code() == s3.ErrCodeNoSuchUpload
+}
@@ -39,6 +39,7 @@ func init() {
 }
 
 func (prod *Benchmark) null(msg *core.Message) {
+	msg.Release()
 }
 
 // Produce writes to stdout or stderr.
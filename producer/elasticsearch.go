@@ -15,29 +15,36 @@
 package producer
 
 import (
-	"context"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"strings"
 	"sync"
-	"syscall"
 	"time"
 
-	"github.com/pkg/errors"
-	"github.com/sirupsen/logrus"
 	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/components"
 	"github.com/trivago/tgo"
 	"github.com/trivago/tgo/tcontainer"
-	"gopkg.in/olivere/elastic.v5"
 )
 
 // ElasticSearch producer plugin
 //
-// The ElasticSearch producer sends messages to elastic search using the bulk
-// http API. The producer expects a json payload.
+// The ElasticSearch producer sends messages to Elasticsearch or OpenSearch
+// using the bulk http API. The producer expects a json payload.
+// Each document of a bulk request is checked separately so that only
+// documents rejected by the server are passed to the fallback stream.
+// Messages from streams without StreamProperties are passed to the fallback
+// stream, too.
 //
 // Parameters
 //
 // - Retry/Count: Set the amount of retries before a Elasticsearch request
-// fail finally.
+// fail finally. Requests are retried on connection errors, server errors and
+// if the server rejected documents because of too many requests.
 // By default this parameter is set to "3".
 //
 // - Retry/TimeToWaitSec: This value denotes the time in seconds after which a
@@ -45,11 +52,12 @@ import (
 // By default this parameter is set to "3".
 //
 // - SetGzip: This value enables or disables gzip compression for Elasticsearch
-// requests (disabled by default). This option is used one to one for the library
-// package. See http://godoc.org/gopkg.in/olivere/elastic.v5#SetGzip
+// requests.
 // By default this parameter is set to "false".
 //
-// - Servers: This value defines a list of servers to connect to.
+// - Servers: This value defines a list of servers to connect to. If a server
+// fails, the next one is used for the following requests.
+// By default this parameter is set to "http://127.0.0.1:9200".
 //
 // - User: This value used as the username for the elasticsearch server.
 // By default this parameter is set to "".
@@ -57,33 +65,63 @@ import (
 // - Password: This value used as the password for the elasticsearch server.
 // By default this parameter is set to "".
 //
+// - APIKey: Defines a base64 encoded API key sent as "Authorization: ApiKey"
+// header. If set, User and Password are ignored.
+// By default this parameter is set to "".
+//
+// - IDFrom: Defines a metadata key whose value is used as document ID. Setting
+// an ID makes retries idempotent as a document is not indexed twice. If the
+// key is not set for a message, an ID is generated by the server.
+// By default this parameter is set to "".
+//
+// - TimeoutMs: Defines the timeout for a single request.
+// By default this parameter is set to "10000".
+//
 // - StreamProperties: This value defines the mapping and settings for each stream.
 // As index use the stream name here.
 //
 // - StreamProperties/<streamName>/Index: The value defines the Elasticsearch
-// index used for the stream.
+// index, data stream or rollover alias used for the stream.
 //
 // - StreamProperties/<streamName>/Type: This value defines the document type
-// used for the stream.
+// used for the stream. Document types have been removed with Elasticsearch 7
+// and should only be set for older servers.
+// By default this parameter is set to "".
+//
+// - StreamProperties/<streamName>/DataStream: If set to "true" Index refers to
+// a data stream. Documents are written using the "create" operation and the
+// data stream is not created by this producer but by a matching index
+// template. Documents require a "@timestamp" field.
+// By default this parameter is set to "false".
+//
+// - StreamProperties/<streamName>/RolloverAlias: If set to "true" Index refers
+// to a write alias managed by index lifecycle management. If the alias does
+// not exist, the index "<Index>-000001" is created as its write index.
+// By default this parameter is set to "false".
+//
+// - StreamProperties/<streamName>/ILMPolicy: Defines the lifecycle policy
+// assigned to the first index when bootstrapping a RolloverAlias.
+// By default this parameter is set to "".
 //
 // - StreamProperties/<streamName>/TimeBasedIndex: This value can be set to "true"
 // to append the date of the message to the index as in "<index>_<TimeBasedFormat>".
+// This setting is ignored for data streams and rollover aliases.
 // NOTE: This setting incurs a performance penalty because it is necessary to
-// check if an index exists for each message!
+// check if an index exists for each new index name!
 // By default this parameter is set to "false".
 //
 // - StreamProperties/<streamName>/TimeBasedFormat: This value can be set to a valid
-// go time format string to be used with DayBasedIndex.
+// go time format string to be used with TimeBasedIndex.
 // By default this parameter is set to "2006-01-02".
 //
 // - StreamProperties/<streamName>/Mapping: This value is a map which is used
-// for the document field mapping. As document type, the already defined type is
-// reused for the field mapping. See
-// https://www.elastic.co/guide/en/elasticsearch/reference/5.4/indices-create-index.html#mappings
+// for the document field mapping. If Type is set, the mapping is created for
+// this type. See
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/indices-create-index.html#mappings
 //
 // - StreamProperties/<streamName>/Settings: This value is a map which is used
 // for the index settings. See
-// https://www.elastic.co/guide/en/elasticsearch/reference/5.4/indices-create-index.html#mappings
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/indices-create-index.html#create-index-settings
 //
 // Examples
 //
@@ -98,8 +136,7 @@ import (
 //    StreamProperties:
 //      tweets_stream:
 //        Index: twitter
-//        DayBasedIndex: true
-//        Type: tweet
+//        TimeBasedIndex: true
 //        Mapping:
 //          # index mapping for payload
 //          user: keyword
@@ -107,18 +144,51 @@ import (
 //        Settings:
 //          number_of_shards: 1
 //          number_of_replicas: 1
+//
+// This example writes telemetry to a data stream using an API key. The
+// "id" metadata field is used as document ID so retried documents are not
+// stored twice.
+//
+//  producerTelemetry:
+//    Type: producer.ElasticSearch
+//    Streams: telemetry
+//    APIKey: "VnVhQ2ZHY0JDZGJrUW0tZTVhT3g6dWkybHAyYXhUTm1zeWFrdzl0dk5udw=="
+//    IDFrom: id
+//    Servers:
+//      - https://elastic:9200
+//    TlsEnable: true
+//    StreamProperties:
+//      telemetry:
+//        Index: logs-telemetry-default
+//        DataStream: true
+//
 type ElasticSearch struct {
 	core.BatchedProducer `gollumdoc:"embed_type"`
-	connection           elasticConnection
+	TLS                  components.TLSConfig `gollumdoc:"embed_type"`
+	servers              []string             `config:"Servers" default:"http://127.0.0.1:9200"`
+	user                 string               `config:"User"`
+	password             string               `config:"Password"`
+	apiKey               string               `config:"APIKey"`
+	setGzip              bool                 `config:"SetGzip" default:"false"`
+	retryCount           int                  `config:"Retry/Count" default:"3"`
+	retryWait            time.Duration        `config:"Retry/TimeToWaitSec" default:"3" metric:"sec"`
+	idFrom               string               `config:"IDFrom"`
+	timeout              time.Duration        `config:"TimeoutMs" default:"10000" metric:"ms"`
 	indexMap             map[core.MessageStreamID]*indexMapItem
+	knownIndices         map[string]bool
+	client               http.Client
+	activeServer         int
 }
 
 type indexMapItem struct {
-	name         string
-	typeName     string
-	settings     *elasticIndex
-	useTimeIndex bool
-	timeFormat   string
+	name          string
+	typeName      string
+	settings      *elasticIndex
+	useTimeIndex  bool
+	timeFormat    string
+	dataStream    bool
+	rolloverAlias bool
+	ilmPolicy     string
 }
 
 func newIndexMapItem() *indexMapItem {
@@ -128,15 +198,17 @@ func newIndexMapItem() *indexMapItem {
 }
 
 func (item *indexMapItem) GetIndexName(t time.Time) string {
-	if item.useTimeIndex {
+	if item.useTimeIndex && !item.dataStream && !item.rolloverAlias {
 		return item.name + t.Format(item.timeFormat)
 	}
 	return item.name
 }
 
+// elasticIndex is the request body used to create an index
 type elasticIndex struct {
-	Settings map[string]interface{}    `json:"settings,omitempty"`
-	Mappings map[string]elasticMapping `json:"mappings,omitempty"`
+	Settings map[string]interface{} `json:"settings,omitempty"`
+	Mappings interface{}            `json:"mappings,omitempty"`
+	Aliases  map[string]interface{} `json:"aliases,omitempty"`
 }
 
 type elasticMapping struct {
@@ -152,49 +224,118 @@ func newElasticIndex(property tcontainer.MarshalMap) *elasticIndex {
 	mapping, _ := property.MarshalMap("Mapping")
 	settings, _ := property.MarshalMap("Settings")
 
-	elMappings := elasticMapping{
-		Properties: make(map[string]elasticType),
+	elIndex := elasticIndex{
+		Settings: make(map[string]interface{}),
 	}
 
-	for fieldName := range mapping {
-		typeName, _ := mapping.String(fieldName)
-		elMappings.Properties[fieldName] = elasticType{TypeName: typeName}
+	for key, value := range settings {
+		elIndex.Settings[key] = toJSONValue(value)
 	}
 
-	// init elasticIndex instance
-	elIndex := elasticIndex{
-		Settings: make(map[string]interface{}),
-		Mappings: make(map[string]elasticMapping),
-	}
+	if len(mapping) > 0 {
+		elMapping := elasticMapping{
+			Properties: make(map[string]elasticType),
+		}
+		for fieldName := range mapping {
+			typeName, _ := mapping.String(fieldName)
+			elMapping.Properties[fieldName] = elasticType{TypeName: typeName}
+		}
 
-	elIndex.Mappings[elType] = elMappings
-	elIndex.Settings = settings
+		// Typed mappings are only supported by Elasticsearch < 7
+		if elType != "" {
+			elIndex.Mappings = map[string]elasticMapping{elType: elMapping}
+		} else {
+			elIndex.Mappings = elMapping
+		}
+	}
 
 	return &elIndex
 }
 
+// toJSONValue converts maps read from the configuration file to types that
+// can be serialized by encoding/json.
+func toJSONValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(typed))
+		for key, item := range typed {
+			converted[fmt.Sprintf("%v", key)] = toJSONValue(item)
+		}
+		return converted
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(typed))
+		for key, item := range typed {
+			converted[key] = toJSONValue(item)
+		}
+		return converted
+	case tcontainer.MarshalMap:
+		return toJSONValue(map[string]interface{}(typed))
+	case []interface{}:
+		converted := make([]interface{}, len(typed))
+		for i, item := range typed {
+			converted[i] = toJSONValue(item)
+		}
+		return converted
+	default:
+		return value
+	}
+}
+
+// elasticBulkResponse is the part of a bulk API response evaluated by the
+// producer. Each item contains exactly one entry, keyed by the operation.
+type elasticBulkResponse struct {
+	Errors bool                                 `json:"errors"`
+	Items  []map[string]elasticBulkResponseItem `json:"items"`
+}
+
+type elasticBulkResponseItem struct {
+	Index  string `json:"_index"`
+	Status int    `json:"status"`
+	Error  *struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+// elasticRetryError is returned by request if a request failed but may
+// succeed when being retried.
+type elasticRetryError struct {
+	err error
+}
+
+func (err elasticRetryError) Error() string {
+	return err.err.Error()
+}
+
+// elasticDocument is a single document of a bulk request
+type elasticDocument struct {
+	msg    *core.Message
+	action []byte
+	source []byte
+}
+
 func init() {
 	core.TypeRegistry.Register(ElasticSearch{})
 }
 
 // Configure initializes this producer with values from a plugin config.
 func (prod *ElasticSearch) Configure(conf core.PluginConfigReader) {
-	prod.connection.servers = conf.GetStringArray("Servers", []string{"http://127.0.0.1:9200"})
-	prod.connection.user = conf.GetString("User", "")
-	prod.connection.password = conf.GetString("Password", "")
-	prod.connection.setGzip = conf.GetBool("SetGzip", false)
-	prod.connection.isConnectedStatus = false
+	prod.SetStopCallback(prod.close)
 
-	prod.configureIndexSettings(conf.GetMap("StreamProperties", tcontainer.NewMarshalMap()), conf.Errors)
-	prod.configureRetrySettings(conf.GetInt("Retry/Count", 3), conf.GetInt("Retry/TimeToWaitSec", 3))
-}
+	prod.knownIndices = make(map[string]bool)
+	prod.client.Timeout = prod.timeout
+	if tlsConfig := prod.TLS.GetConfig(); tlsConfig != nil {
+		prod.client.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+	}
 
-func (prod *ElasticSearch) configureRetrySettings(retry, timeToWaitSec int64) {
-	prod.connection.retrier.retry = int(retry)
-	prod.connection.retrier.backoff = elastic.NewConstantBackoff(time.Duration(timeToWaitSec) * time.Second)
-	prod.connection.retrier.logger = prod.Logger.WithField("Scope", "connection.retrier")
+	if len(prod.servers) == 0 {
+		conf.Errors.Pushf("No servers configured")
+	}
+	for i, server := range prod.servers {
+		prod.servers[i] = strings.TrimRight(server, "/")
+	}
 
-	prod.Logger.Debugf("Using retrier with a retry count of '%d' and a time to wait of '%d' sec", retry, timeToWaitSec)
+	prod.configureIndexSettings(conf.GetMap("StreamProperties", tcontainer.NewMarshalMap()), conf.Errors)
 }
 
 func (prod *ElasticSearch) configureIndexSettings(properties tcontainer.MarshalMap, errors *tgo.ErrorStack) {
@@ -230,9 +371,18 @@ func (prod *ElasticSearch) configureIndexSettings(properties tcontainer.MarshalM
 		}
 		indexMapItem.timeFormat = "_" + timeFormat
 
-		indexMapItem.typeName, err = property.String("Type")
-		if err != nil {
-			prod.Logger.Errorf("no data type configured for stream '%s'. Please check your config.", streamName)
+		indexMapItem.typeName, _ = property.String("Type")
+		indexMapItem.dataStream, _ = property.Bool("DataStream")
+		indexMapItem.rolloverAlias, _ = property.Bool("RolloverAlias")
+		indexMapItem.ilmPolicy, _ = property.String("ILMPolicy")
+
+		if indexMapItem.dataStream && indexMapItem.rolloverAlias {
+			errors.Pushf("Stream '%s' cannot use DataStream and RolloverAlias at the same time", streamName)
+			continue
+		}
+		if indexMapItem.dataStream && indexMapItem.typeName != "" {
+			errors.Pushf("Stream '%s' cannot use Type with DataStream", streamName)
+			continue
 		}
 
 		indexMapItem.settings = newElasticIndex(property)
@@ -240,203 +390,317 @@ func (prod *ElasticSearch) configureIndexSettings(properties tcontainer.MarshalM
 	}
 }
 
-func (prod *ElasticSearch) getClient() *elastic.Client {
-	if prod.connection.isConnected() {
-		return prod.connection.client
+// request sends a request to the currently active server. If the server
+// cannot be reached or returns a server error, the next server is used for
+// the following request and an elasticRetryError is returned.
+func (prod *ElasticSearch) request(method, path string, body []byte, contentType string) (int, []byte, error) {
+	server := prod.servers[prod.activeServer]
+
+	var reader *bytes.Reader
+	compressed := false
+	if len(body) > 0 && prod.setGzip {
+		buffer := bytes.Buffer{}
+		writer := gzip.NewWriter(&buffer)
+		writer.Write(body)
+		writer.Close()
+		reader = bytes.NewReader(buffer.Bytes())
+		compressed = true
+	} else {
+		reader = bytes.NewReader(body)
 	}
 
-	if err := prod.connection.connect(); err != nil {
-		prod.Logger.WithError(err).Error("Error during connection")
-		return nil
+	request, err := http.NewRequest(method, server+path, reader)
+	if err != nil {
+		return 0, nil, err // ### return, invalid request ###
 	}
 
-	return prod.connection.client
-}
+	request.Header.Set("User-Agent", "gollum/"+core.GetVersionString())
+	if len(body) > 0 {
+		request.Header.Set("Content-Type", contentType)
+	}
+	if compressed {
+		request.Header.Set("Content-Encoding", "gzip")
+	}
+	switch {
+	case prod.apiKey != "":
+		request.Header.Set("Authorization", "ApiKey "+prod.apiKey)
+	case prod.user != "":
+		request.SetBasicAuth(prod.user, prod.password)
+	}
 
-func (prod *ElasticSearch) indexExists(client *elastic.Client, indexName string) bool {
-	exists, err := client.IndexExists(indexName).Do(context.Background())
+	response, err := prod.client.Do(request)
 	if err != nil {
-		prod.Logger.WithError(err).Error("Error during index check")
-		return false
+		prod.activeServer = (prod.activeServer + 1) % len(prod.servers)
+		return 0, nil, elasticRetryError{err: err} // ### return, failed to connect ###
+	}
+
+	defer response.Body.Close()
+	responseBody, _ := ioutil.ReadAll(response.Body)
+
+	switch {
+	case response.StatusCode == http.StatusTooManyRequests:
+		return response.StatusCode, responseBody, elasticRetryError{
+			err: fmt.Errorf("%s returned %s: %s", server, response.Status, string(responseBody)),
+		}
+
+	case response.StatusCode >= 500:
+		prod.activeServer = (prod.activeServer + 1) % len(prod.servers)
+		return response.StatusCode, responseBody, elasticRetryError{
+			err: fmt.Errorf("%s returned %s: %s", server, response.Status, string(responseBody)),
+		}
 	}
-	return exists
+
+	return response.StatusCode, responseBody, nil
 }
 
-func (prod *ElasticSearch) createIndexIfRequired(indexName string, settings *elasticIndex) bool {
-	client := prod.getClient()
-	if client == nil {
-		return false
+// indexExists checks if an index, data stream or alias with the given name
+// exists.
+func (prod *ElasticSearch) indexExists(indexName string) (bool, error) {
+	status, _, err := prod.request(http.MethodHead, "/"+indexName, nil, "")
+	switch {
+	case err != nil:
+		return false, err
+	case status == http.StatusNotFound:
+		return false, nil
+	case status >= 200 && status <= 299:
+		return true, nil
+	default:
+		return false, fmt.Errorf("checking index %s returned status %d", indexName, status)
 	}
+}
 
-	if !prod.indexExists(client, indexName) {
-		if _, err := client.CreateIndex(indexName).Do(context.Background()); err != nil {
-			prod.Logger.WithError(err).Errorln("Failed to create index")
-			return false
-		}
+// createIndex creates an index with the given settings. If the index has been
+// created in the meantime, e.g. by another producer, no error is returned.
+func (prod *ElasticSearch) createIndex(indexName string, settings *elasticIndex) error {
+	body, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+
+	status, response, err := prod.request(http.MethodPut, "/"+indexName, body, "application/json")
+	switch {
+	case err != nil:
+		return err
+	case status >= 200 && status <= 299:
 		prod.Logger.Debugf("Created index %s", indexName)
+		return nil
+	case bytes.Contains(response, []byte("resource_already_exists_exception")):
+		return nil
+	default:
+		return fmt.Errorf("creating index %s returned status %d: %s", indexName, status, string(response))
 	}
+}
 
-	if settings == nil {
-		prod.Logger.Debugf("No settings for index %s", indexName)
+// createIndexIfRequired makes sure the given index exists. Data streams are
+// expected to be created by an index template. Rollover aliases are
+// bootstrapped by creating the first index as write index.
+func (prod *ElasticSearch) createIndexIfRequired(indexName string, item *indexMapItem) bool {
+	if prod.knownIndices[indexName] || item.dataStream {
 		return true
 	}
 
-	for typeName, properties := range settings.Mappings {
-		mapping := client.PutMapping()
-		mapping.Index(indexName)
-		mapping.Type(typeName)
+	exists, err := prod.indexExists(indexName)
+	if err != nil {
+		prod.Logger.WithError(err).Error("Error during index check")
+		return false
+	}
 
-		json := map[string]interface{}{typeName: properties}
-		mapping.BodyJson(json)
+	if !exists {
+		if item.rolloverAlias {
+			settings := *item.settings
+			settings.Settings = make(map[string]interface{}, len(item.settings.Settings)+2)
+			for key, value := range item.settings.Settings {
+				settings.Settings[key] = value
+			}
+			if item.ilmPolicy != "" {
+				settings.Settings["index.lifecycle.name"] = item.ilmPolicy
+				settings.Settings["index.lifecycle.rollover_alias"] = indexName
+			}
+			settings.Aliases = map[string]interface{}{
+				indexName: map[string]interface{}{"is_write_index": true},
+			}
+			err = prod.createIndex(indexName+"-000001", &settings)
+		} else {
+			err = prod.createIndex(indexName, item.settings)
+		}
 
-		_, err := mapping.Do(context.Background())
 		if err != nil {
-			prod.Logger.WithError(err).Errorf("Error creating mapping for type %s.%s", indexName, typeName)
+			prod.Logger.WithError(err).Errorln("Failed to create index")
+			return false
 		}
 	}
 
+	prod.knownIndices[indexName] = true
 	return true
 }
 
-func (prod *ElasticSearch) submitMessages(messages []*core.Message) {
-	client := prod.getClient()
-	if client == nil {
-		prod.Logger.Error("Failed to get client. Cannot send messages")
+// newDocument creates the bulk request lines for a message. Payloads are
+// compacted as the bulk API requires one document per line.
+func (prod *ElasticSearch) newDocument(msg *core.Message, item *indexMapItem, indexName string) (elasticDocument, error) {
+	source := bytes.Buffer{}
+	if err := json.Compact(&source, msg.GetPayload()); err != nil {
+		return elasticDocument{}, err
 	}
 
-	// Handle time based index creation
-	timeBasedIndexes := make(map[string]*elasticIndex)
-	for _, msg := range messages {
-		if item, isSet := prod.indexMap[msg.GetStreamID()]; isSet && item.useTimeIndex {
-			timeBasedIndexes[item.GetIndexName(msg.GetCreationTime())] = item.settings
+	meta := map[string]string{"_index": indexName}
+	if item.typeName != "" {
+		meta["_type"] = item.typeName
+	}
+	if prod.idFrom != "" {
+		if id := msg.TryGetMetadata().GetValueString(prod.idFrom); id != "" {
+			meta["_id"] = id
 		}
 	}
 
-	for indexName, settings := range timeBasedIndexes {
-		prod.createIndexIfRequired(indexName, settings)
+	operation := "index"
+	if item.dataStream {
+		operation = "create"
 	}
 
-	// Send messages
-	bulkRequest := client.Bulk()
-	for _, msg := range messages {
-		indexMapItem, isSet := prod.indexMap[msg.GetStreamID()]
-		if !isSet {
-			prod.Logger.Warningf("No index setting for stream %s", msg.GetStreamID().GetName())
-			continue
-		}
+	action, err := json.Marshal(map[string]interface{}{operation: meta})
+	if err != nil {
+		return elasticDocument{}, err
+	}
 
-		bulkIndexRequest := elastic.NewBulkIndexRequest()
-		bulkIndexRequest.Index(indexMapItem.GetIndexName(msg.GetCreationTime())).
-			Type(indexMapItem.typeName).
-			Doc(msg.String())
+	return elasticDocument{
+		msg:    msg,
+		action: action,
+		source: source.Bytes(),
+	}, nil
+}
 
-		bulkRequest.Add(bulkIndexRequest)
+// sendBulk sends the given documents in one bulk request. If an error is
+// returned, the returned documents have not been stored. They are retried if
+// the error is an elasticRetryError and passed to the fallback otherwise.
+// Single documents rejected by the server are passed to the fallback
+// directly.
+func (prod *ElasticSearch) sendBulk(documents []elasticDocument) ([]elasticDocument, error) {
+	body := bytes.Buffer{}
+	for _, doc := range documents {
+		body.Write(doc.action)
+		body.WriteByte('\n')
+		body.Write(doc.source)
+		body.WriteByte('\n')
 	}
 
-	// NumberOfActions contains the number of requests in a bulk
-	prod.Logger.Debugf("bulkRequest.NumberOfActions: %d", bulkRequest.NumberOfActions())
-
-	// Do sends the bulk requests to Elasticsearch
-	bulkResponse, err := bulkRequest.Do(context.Background())
+	status, response, err := prod.request(http.MethodPost, "/_bulk", body.Bytes(), "application/x-ndjson")
 	if err != nil {
-		prod.Logger.Error(err)
+		return documents, err // ### return, request failed ###
 	}
-
-	// Bulk request actions get cleared
-	numberOfActionsAfter := bulkRequest.NumberOfActions()
-	if numberOfActionsAfter != 0 {
-		prod.Logger.Errorf("Could not send '%d' messages to Elasticsearch", numberOfActionsAfter)
+	if status < 200 || status > 299 {
+		return documents, fmt.Errorf("bulk request returned status %d: %s", status, string(response)) // ### return, request rejected ###
 	}
 
-	if bulkResponse != nil {
-		// Indexed returns information abount indexed documents
-		indexed := bulkResponse.Indexed()
-		prod.Logger.Debugf("%d messages indexed successfully in Elasticsearch", len(indexed))
-
-		// Created returns information about created documents
-		created := bulkResponse.Created()
-		prod.Logger.Debugf("%d messages created successfully in Elasticsearch", len(created))
+	// If the result is unknown, all documents are treated as failed. They are
+	// not retried as this would store documents twice if no IDs are given.
+	result := elasticBulkResponse{}
+	if err := json.Unmarshal(response, &result); err != nil {
+		return documents, fmt.Errorf("unexpected bulk response: %s", err.Error()) // ### return, result unknown ###
+	}
+	if len(result.Items) != len(documents) {
+		return documents, fmt.Errorf("bulk response contains %d results for %d documents", len(result.Items), len(documents)) // ### return, result unknown ###
 	}
-}
-
-// Produce starts the producer
-func (prod *ElasticSearch) Produce(workers *sync.WaitGroup) {
-	defer prod.WorkerDone()
 
-	// create all indexes that are not time based
-	for _, item := range prod.indexMap {
-		if !item.useTimeIndex {
-			prod.createIndexIfRequired(item.name, item.settings)
+	if !result.Errors {
+		for _, doc := range documents {
+			doc.msg.Release()
 		}
+		return nil, nil // ### return, all documents stored ###
 	}
 
-	prod.AddMainWorker(workers)
-	prod.BatchMessageLoop(workers, func() core.AssemblyFunc { return prod.submitMessages })
-}
-
-// -- elasticConnection --
+	retry := []elasticDocument{}
+	for i, responseItem := range result.Items {
+		for operation, itemResult := range responseItem {
+			switch {
+			case itemResult.Status >= 200 && itemResult.Status <= 299:
+				// stored
+				documents[i].msg.Release()
+
+			case itemResult.Status == http.StatusConflict && operation == "create":
+				// A document with the same ID has been stored by an earlier try
+				documents[i].msg.Release()
+
+			case itemResult.Status == http.StatusTooManyRequests:
+				retry = append(retry, documents[i])
+
+			default:
+				reason := ""
+				if itemResult.Error != nil {
+					reason = itemResult.Error.Type + ": " + itemResult.Error.Reason
+				}
+				prod.Logger.Warningf("Document rejected by %s with status %d: %s", itemResult.Index, itemResult.Status, reason)
+				prod.TryFallback(documents[i].msg)
+			}
+		}
+	}
 
-type elasticConnection struct {
-	retrier           retrier
-	client            *elastic.Client
-	servers           []string
-	user              string
-	password          string
-	setGzip           bool
-	isConnectedStatus bool
+	if len(retry) > 0 {
+		return retry, elasticRetryError{err: fmt.Errorf("%d documents rejected because of too many requests", len(retry))}
+	}
+	return nil, nil
 }
 
-func (conn *elasticConnection) isConnected() bool {
-	return conn.isConnectedStatus
-}
+func (prod *ElasticSearch) submitMessages(messages []*core.Message) {
+	documents := make([]elasticDocument, 0, len(messages))
+	checkedIndices := make(map[string]bool)
+	for _, msg := range messages {
+		item, isSet := prod.indexMap[msg.GetStreamID()]
+		if !isSet {
+			prod.Logger.Warningf("No index setting for stream %s", msg.GetStreamID().GetName())
+			prod.TryFallback(msg)
+			continue
+		}
 
-func (conn *elasticConnection) connect() error {
-	conf := []elastic.ClientOptionFunc{elastic.SetURL(conn.servers...), elastic.SetSniff(false), elastic.SetGzip(conn.setGzip)}
-	if len(conn.user) > 0 {
-		conf = append(conf, elastic.SetBasicAuth(conn.user, conn.password))
-	}
+		// Index creation is tried once per batch. If it fails, the documents
+		// are sent anyway as the server may create the index automatically.
+		indexName := item.GetIndexName(msg.GetCreationTime())
+		if !checkedIndices[indexName] {
+			prod.createIndexIfRequired(indexName, item)
+			checkedIndices[indexName] = true
+		}
 
-	if conn.retrier.retry > 0 {
-		conf = append(conf, elastic.SetRetrier(&conn.retrier))
+		doc, err := prod.newDocument(msg, item, indexName)
+		if err != nil {
+			prod.Logger.WithError(err).Warningf("Message from stream %s is not valid JSON", msg.GetStreamID().GetName())
+			prod.TryFallback(msg)
+			continue
+		}
+		documents = append(documents, doc)
 	}
 
-	client, err := elastic.NewClient(conf...)
-	if err != nil {
-		return err
-	}
+	for retry := 0; len(documents) > 0; retry++ {
+		var err error
+		documents, err = prod.sendBulk(documents)
+		if err == nil {
+			return // ### return, done ###
+		}
 
-	conn.client = client
-	conn.isConnectedStatus = true
+		if _, canRetry := err.(elasticRetryError); !canRetry || retry >= prod.retryCount || !prod.IsActiveOrStopping() {
+			prod.Logger.WithError(err).Errorf("Could not send %d messages to Elasticsearch", len(documents))
+			for _, doc := range documents {
+				prod.TryFallback(doc.msg)
+			}
+			return // ### return, failed ###
+		}
 
-	return nil
+		prod.Logger.WithError(err).Warningf("Bulk request failed, retrying in %s", prod.retryWait)
+		time.Sleep(prod.retryWait)
+	}
 }
 
-// -- retrier --
-
-type retrier struct {
-	logger  logrus.FieldLogger
-	backoff elastic.Backoff
-	retry   int
+func (prod *ElasticSearch) close() {
+	defer prod.WorkerDone()
+	prod.Batch.Close(prod.submitMessages, prod.GetShutdownTimeout())
 }
 
-// Retry implements type Retrier interface
-// see: https://github.com/olivere/elastic/wiki/Retrier-and-Backoff
-func (r *retrier) Retry(ctx context.Context, retry int, req *http.Request, resp *http.Response, err error) (time.Duration, bool, error) {
-	// Fail hard on a specific error
-	if err == syscall.ECONNREFUSED {
-		err = errors.New("Elasticsearch or network down")
-		r.logger.Error(err)
-		return 0, false, err
-	}
-
-	// Stop after n retries
-	if retry >= r.retry {
-		r.logger.Debugf("Stop retrying after '%d' retries", retry)
-		return 0, false, nil
+// Produce starts the producer
+func (prod *ElasticSearch) Produce(workers *sync.WaitGroup) {
+	// create all indexes that are not time based
+	for _, item := range prod.indexMap {
+		if !item.useTimeIndex || item.rolloverAlias {
+			prod.createIndexIfRequired(item.name, item)
+		}
 	}
 
-	// Let the backoff strategy decide how long to wait and whether to stop
-	r.logger.Debugln("Retry to connect to Elasticsearch")
-	wait, stop := r.backoff.Next(retry)
-	return wait, stop, nil
+	prod.BatchMessageLoop(workers, func() core.AssemblyFunc { return prod.submitMessages })
 }
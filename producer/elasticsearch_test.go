@@ -0,0 +1,217 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestElasticSearchIndexSettings(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	prod := newTestPlugin(expect, "producer.ElasticSearch", "elasticIndexSettings", map[string]interface{}{
+		"StreamProperties": map[string]interface{}{
+			"typeless": map[string]interface{}{
+				"Index":   "laps",
+				"Mapping": map[string]interface{}{"driver": "keyword"},
+				"Settings": map[interface{}]interface{}{
+					"index": map[interface{}]interface{}{"number_of_shards": 1},
+				},
+			},
+			"typed": map[string]interface{}{
+				"Index":          "legacy",
+				"Type":           "lap",
+				"TimeBasedIndex": true,
+				"Mapping":        map[string]interface{}{"driver": "keyword"},
+			},
+		},
+	}).(*ElasticSearch)
+
+	item := prod.indexMap[core.GetStreamID("typeless")]
+	body, err := json.Marshal(item.settings)
+	expect.NoError(err)
+	expect.Equal(`{"settings":{"index":{"number_of_shards":1}},"mappings":{"properties":{"driver":{"type":"keyword"}}}}`, string(body))
+
+	item = prod.indexMap[core.GetStreamID("typed")]
+	body, err = json.Marshal(item.settings)
+	expect.NoError(err)
+	expect.Equal(`{"mappings":{"lap":{"properties":{"driver":{"type":"keyword"}}}}}`, string(body))
+
+	msg := core.NewMessage(nil, []byte(`{}`), nil, core.InvalidStreamID)
+	expect.Equal("legacy_"+msg.GetCreationTime().Format("2006-01-02"), item.GetIndexName(msg.GetCreationTime()))
+}
+
+func TestElasticSearchBulk(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	bulkRequests := 0
+	actions := []string{}
+	var created []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expect.Equal("ApiKey secret", r.Header.Get("Authorization"))
+
+		switch {
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusNotFound)
+
+		case r.Method == http.MethodPut:
+			expect.Equal("/telemetry-000001", r.URL.Path)
+			created, _ = ioutil.ReadAll(r.Body)
+			w.Write([]byte(`{"acknowledged":true}`))
+
+		case r.URL.Path == "/_bulk":
+			bulkRequests++
+			expect.Equal("application/x-ndjson", r.Header.Get("Content-Type"))
+
+			lines := []string{}
+			scanner := bufio.NewScanner(r.Body)
+			for scanner.Scan() {
+				lines = append(lines, scanner.Text())
+			}
+
+			items := []string{}
+			for i := 0; i < len(lines); i += 2 {
+				actions = append(actions, lines[i])
+				switch {
+				case strings.Contains(lines[i+1], "busy") && bulkRequests == 1:
+					items = append(items, `{"index":{"_index":"telemetry","status":429}}`)
+				case strings.Contains(lines[i+1], "invalid"):
+					items = append(items, `{"index":{"_index":"telemetry","status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse"}}}`)
+				default:
+					items = append(items, `{"index":{"_index":"telemetry","status":201}}`)
+				}
+			}
+			w.Write([]byte(`{"errors":true,"items":[` + strings.Join(items, ",") + `]}`))
+
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	prod := newTestPlugin(expect, "producer.ElasticSearch", "elasticBulk", map[string]interface{}{
+		"Servers":             []string{server.URL},
+		"APIKey":              "secret",
+		"IDFrom":              "id",
+		"Retry/TimeToWaitSec": 0,
+		"StreamProperties": map[string]interface{}{
+			"telemetry": map[string]interface{}{
+				"Index":         "telemetry",
+				"RolloverAlias": true,
+				"ILMPolicy":     "weekly",
+			},
+		},
+	}).(*ElasticSearch)
+
+	streamID := core.GetStreamID("telemetry")
+	messages := []*core.Message{
+		core.NewMessage(nil, []byte("{\n  \"rpm\": 3000\n}"), core.Metadata{"id": []byte("lap-1")}, streamID),
+		core.NewMessage(nil, []byte(`{"status":"busy"}`), nil, streamID),
+		core.NewMessage(nil, []byte(`{"status":"invalid"}`), nil, streamID),
+		core.NewMessage(nil, []byte(`not json`), nil, streamID),
+		core.NewMessage(nil, []byte(`{"rpm":3000}`), nil, core.GetStreamID("unknown")),
+	}
+	prod.submitMessages(messages)
+
+	expect.Equal(`{"aliases":{"telemetry":{"is_write_index":true}},"settings":{"index.lifecycle.name":"weekly","index.lifecycle.rollover_alias":"telemetry"}}`, normalizeJSON(expect, created))
+	expect.Equal(2, bulkRequests)
+	expect.Equal(4, len(actions))
+	expect.Equal(`{"index":{"_id":"lap-1","_index":"telemetry"}}`, actions[0])
+	expect.Equal(`{"index":{"_index":"telemetry"}}`, actions[1])
+	expect.Equal(actions[1], actions[3])
+}
+
+func TestElasticSearchBulkFailures(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	responses := []struct {
+		status int
+		body   string
+	}{
+		{http.StatusBadRequest, `{"error":"invalid"}`},
+		{http.StatusOK, `not json`},
+		{http.StatusOK, `{"errors":false,"items":[]}`},
+	}
+
+	current := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(responses[current].status)
+		w.Write([]byte(responses[current].body))
+	}))
+	defer server.Close()
+
+	prod := newTestPlugin(expect, "producer.ElasticSearch", "elasticBulkFailures", map[string]interface{}{
+		"Servers": []string{server.URL},
+	}).(*ElasticSearch)
+
+	documents := []elasticDocument{{
+		msg:    core.NewMessage(nil, []byte(`{"rpm":3000}`), nil, core.InvalidStreamID),
+		action: []byte(`{"index":{}}`),
+		source: []byte(`{"rpm":3000}`),
+	}}
+
+	for current = range responses {
+		failed, err := prod.sendBulk(documents)
+		expect.NotNil(err)
+		expect.Equal(1, len(failed))
+
+		_, canRetry := err.(elasticRetryError)
+		expect.False(canRetry)
+	}
+}
+
+func TestElasticSearchDataStream(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expect.Equal("/_bulk", r.URL.Path)
+		body, _ = ioutil.ReadAll(r.Body)
+		w.Write([]byte(`{"errors":true,"items":[{"create":{"_index":"logs-lr-default","status":409}}]}`))
+	}))
+	defer server.Close()
+
+	prod := newTestPlugin(expect, "producer.ElasticSearch", "elasticDataStream", map[string]interface{}{
+		"Servers": []string{server.URL},
+		"IDFrom":  "id",
+		"StreamProperties": map[string]interface{}{
+			"logs": map[string]interface{}{
+				"Index":      "logs-lr-default",
+				"DataStream": true,
+			},
+		},
+	}).(*ElasticSearch)
+
+	msg := core.NewMessage(nil, []byte(`{"@timestamp":"2018-05-01T12:00:00Z"}`), core.Metadata{"id": []byte("1")}, core.GetStreamID("logs"))
+	prod.submitMessages([]*core.Message{msg})
+
+	expect.Equal("{\"create\":{\"_id\":\"1\",\"_index\":\"logs-lr-default\"}}\n{\"@timestamp\":\"2018-05-01T12:00:00Z\"}\n", string(body))
+}
+
+func normalizeJSON(expect ttesting.Expect, data []byte) string {
+	var value interface{}
+	expect.NoError(json.Unmarshal(data, &value))
+	normalized, _ := json.Marshal(value)
+	return string(normalized)
+}
@@ -0,0 +1,286 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/components"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// GRPC producer
+//
+// This producer forwards messages to another gollum instance running
+// consumer.GRPC. Messages are sent in batches over a streaming gRPC call in
+// their serialized form so that stream IDs, metadata, priority and timestamp
+// are preserved. Each batch is acknowledged by the receiver. Batches that are
+// not acknowledged in time or that failed to be sent are passed to the
+// fallback stream.
+//
+// Parameters
+//
+// - Address: Defines the address of the consumer.GRPC to connect to.
+// By default this parameter is set to "localhost:5890".
+//
+// - MaxInFlight: Defines the maximum number of batches that have been sent
+// but not yet acknowledged. If this limit is reached, sending blocks until a
+// batch has been acknowledged or AckTimeoutMs has passed.
+// By default this parameter is set to 4.
+//
+// - AckTimeoutMs: Defines the maximum time to wait for a free in-flight slot.
+// If this timeout is reached, the stream is reconnected and all unacknowledged
+// batches are sent to the fallback stream.
+// By default this parameter is set to 10000.
+//
+// - MaxMessageSizeKB: Defines the maximum size of a batch that can be sent.
+// This must not be larger than the MaxMessageSizeKB setting of the receiver.
+// By default this parameter is set to 16384.
+//
+// Examples
+//
+// This example forwards all messages to a pit server using mutual TLS.
+//
+//  GrpcOut:
+//    Type: producer.GRPC
+//    Streams: "*"
+//    Address: "pit-server:5890"
+//    TlsEnable: true
+//    TlsCaLocation: /etc/gollum/ca.crt
+//    TlsCertificateLocation: /etc/gollum/car.crt
+//    TlsKeyLocation: /etc/gollum/car.key
+//    Batch:
+//      MaxCount: 1024
+//      FlushCount: 256
+//      TimeoutSec: 1
+//
+type GRPC struct {
+	core.BatchedProducer `gollumdoc:"embed_type"`
+	TLS                  components.TLSConfig `gollumdoc:"embed_type"`
+	address              string               `config:"Address" default:"localhost:5890"`
+	maxInFlight          int                  `config:"MaxInFlight" default:"4"`
+	ackTimeout           time.Duration        `config:"AckTimeoutMs" default:"10000" metric:"ms"`
+	maxMessageSize       int                  `config:"MaxMessageSizeKB" default:"16384" metric:"kb"`
+	conn                 *grpc.ClientConn
+	stream               core.MessageService_ForwardClient
+	cancelStream         context.CancelFunc
+	sequence             uint64
+	pending              map[uint64][]*core.Message
+	streamGuard          sync.Mutex
+	slots                chan struct{}
+}
+
+func init() {
+	core.TypeRegistry.Register(GRPC{})
+}
+
+// Configure initializes this producer with values from a plugin config.
+func (prod *GRPC) Configure(conf core.PluginConfigReader) {
+	prod.SetStopCallback(prod.close)
+
+	if prod.maxInFlight < 1 {
+		conf.Errors.Pushf("MaxInFlight must be at least 1")
+		prod.maxInFlight = 1
+	}
+
+	prod.pending = make(map[uint64][]*core.Message)
+	prod.slots = make(chan struct{}, prod.maxInFlight)
+}
+
+func (prod *GRPC) dial() error {
+	options := []grpc.DialOption{
+		grpc.WithDefaultCallOptions(grpc.MaxCallSendMsgSize(prod.maxMessageSize)),
+	}
+	if tlsConfig := prod.TLS.GetConfig(); tlsConfig != nil {
+		options = append(options, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	} else {
+		options = append(options, grpc.WithInsecure())
+	}
+
+	conn, err := grpc.Dial(prod.address, options...)
+	if err != nil {
+		return err
+	}
+	prod.conn = conn
+	return nil
+}
+
+// getStream returns the current stream or opens a new one
+func (prod *GRPC) getStream() (core.MessageService_ForwardClient, error) {
+	prod.streamGuard.Lock()
+	defer prod.streamGuard.Unlock()
+
+	if prod.stream != nil {
+		return prod.stream, nil // ### return, connected ###
+	}
+	if prod.conn == nil {
+		return nil, fmt.Errorf("No connection to %s", prod.address)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := core.NewMessageServiceClient(prod.conn).Forward(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	prod.stream = stream
+	prod.cancelStream = cancel
+	go prod.receiveAcks(stream)
+	return stream, nil
+}
+
+// resetStream closes the given stream if it is still active. All messages
+// waiting for an acknowledgement are sent to the fallback.
+func (prod *GRPC) resetStream(stream core.MessageService_ForwardClient) {
+	prod.streamGuard.Lock()
+	if prod.stream != stream || stream == nil {
+		prod.streamGuard.Unlock()
+		return // ### return, already reset ###
+	}
+
+	prod.cancelStream()
+	prod.stream = nil
+	pending := prod.pending
+	prod.pending = make(map[uint64][]*core.Message)
+	for range pending {
+		<-prod.slots
+	}
+	prod.streamGuard.Unlock()
+
+	for _, messages := range pending {
+		prod.TryFallbackAll(messages)
+	}
+}
+
+func (prod *GRPC) receiveAcks(stream core.MessageService_ForwardClient) {
+	for {
+		ack, err := stream.Recv()
+		if err != nil {
+			if prod.IsActive() {
+				prod.Logger.WithError(err).Warning("Stream to ", prod.address, " closed")
+			}
+			prod.resetStream(stream)
+			return // ### return, stream closed ###
+		}
+
+		prod.streamGuard.Lock()
+		messages, isPending := prod.pending[ack.GetSequence()]
+		if isPending {
+			delete(prod.pending, ack.GetSequence())
+			<-prod.slots
+		}
+		prod.streamGuard.Unlock()
+
+		if ack.GetError() != "" {
+			prod.Logger.Errorf("Batch %d was rejected: %s", ack.GetSequence(), ack.GetError())
+			prod.TryFallbackAll(messages)
+			continue
+		}
+		for _, msg := range messages {
+			msg.Release()
+		}
+	}
+}
+
+func (prod *GRPC) forward(messages []*core.Message) {
+	// The batch buffer is reused after this call so we have to copy the
+	// messages that have to wait for an acknowledgement.
+	batchMessages := make([]*core.Message, len(messages))
+	copy(batchMessages, messages)
+
+	stream, err := prod.getStream()
+	if err != nil {
+		prod.Logger.WithError(err).Error("Failed to connect to ", prod.address)
+		prod.TryFallbackAll(batchMessages)
+		return // ### return, not connected ###
+	}
+
+	batch := &core.SerializedMessageBatch{
+		Messages: make([]*core.SerializedMessage, len(batchMessages)),
+	}
+	for idx, msg := range batchMessages {
+		batch.Messages[idx] = msg.ToSerializedMessage()
+	}
+
+	// Wait for the receiver to acknowledge older batches
+	select {
+	case prod.slots <- struct{}{}:
+	case <-time.After(prod.ackTimeout):
+		prod.Logger.Errorf("No acknowledgement received from %s within %s", prod.address, prod.ackTimeout)
+		prod.resetStream(stream)
+		prod.TryFallbackAll(batchMessages)
+		return // ### return, receiver not responding ###
+	}
+
+	prod.streamGuard.Lock()
+	if prod.stream != stream {
+		prod.streamGuard.Unlock()
+		<-prod.slots
+		prod.TryFallbackAll(batchMessages)
+		return // ### return, stream has been reset ###
+	}
+	prod.sequence++
+	batch.Sequence = proto.Uint64(prod.sequence)
+	prod.pending[prod.sequence] = batchMessages
+	prod.streamGuard.Unlock()
+
+	if err := stream.Send(batch); err != nil {
+		prod.Logger.WithError(err).Error("Failed to send batch to ", prod.address)
+		prod.resetStream(stream)
+	}
+}
+
+// getNumPending returns the number of batches waiting for an acknowledgement
+func (prod *GRPC) getNumPending() int {
+	prod.streamGuard.Lock()
+	defer prod.streamGuard.Unlock()
+	return len(prod.pending)
+}
+
+func (prod *GRPC) close() {
+	defer prod.WorkerDone()
+	prod.Batch.Close(prod.forward, prod.GetShutdownTimeout())
+
+	// Give the receiver time to acknowledge the remaining batches
+	deadline := time.Now().Add(prod.GetShutdownTimeout())
+	for prod.getNumPending() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	prod.streamGuard.Lock()
+	stream := prod.stream
+	prod.streamGuard.Unlock()
+	prod.resetStream(stream)
+
+	if prod.conn != nil {
+		prod.conn.Close()
+	}
+}
+
+// Produce connects to the receiver and forwards messages in batches
+func (prod *GRPC) Produce(workers *sync.WaitGroup) {
+	if err := prod.dial(); err != nil {
+		prod.Logger.WithError(err).Errorf("Failed to create connection to %s", prod.address)
+	}
+
+	prod.BatchMessageLoop(workers, func() core.AssemblyFunc { return prod.forward })
+}
@@ -0,0 +1,111 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/tgo/ttesting"
+	"google.golang.org/grpc"
+)
+
+// grpcTestService receives batches and acknowledges them. Batches containing
+// a message with the payload "reject" are rejected.
+type grpcTestService struct {
+	batches chan *core.SerializedMessageBatch
+}
+
+func (service *grpcTestService) Forward(stream core.MessageService_ForwardServer) error {
+	for {
+		batch, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		ack := &core.SerializedMessageBatchAck{Sequence: batch.Sequence}
+		for _, msg := range batch.GetMessages() {
+			if string(msg.GetData().GetData()) == "reject" {
+				ack.Error = &[]string{"rejected"}[0]
+			}
+		}
+		service.batches <- batch
+		if err := stream.Send(ack); err != nil {
+			return err
+		}
+	}
+}
+
+func TestGRPCForward(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	expect.NoError(err)
+
+	service := &grpcTestService{batches: make(chan *core.SerializedMessageBatch, 4)}
+	server := grpc.NewServer()
+	core.RegisterMessageServiceServer(server, service)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	prod := newTestPlugin(expect, "producer.GRPC", "grpcForward", map[string]interface{}{
+		"Address":     listener.Addr().String(),
+		"MaxInFlight": 1,
+	}).(*GRPC)
+	expect.NoError(prod.dial())
+	defer prod.conn.Close()
+
+	engineStreamID := core.GetStreamID("engine")
+	msg := core.NewMessage(nil, []byte("3000"), core.Metadata{"sensor": []byte("rpm")}, engineStreamID)
+	msg.SetPriority(core.MessagePriorityHigh)
+	prod.forward([]*core.Message{msg, msg.Clone()})
+
+	select {
+	case batch := <-service.batches:
+		expect.Equal(uint64(1), batch.GetSequence())
+		expect.Equal(2, len(batch.GetMessages()))
+
+		received := core.NewMessageFromSerialized(batch.GetMessages()[0])
+		expect.Equal(engineStreamID, received.GetStreamID())
+		expect.Equal(core.MessagePriorityHigh, received.GetPriority())
+		expect.Equal("3000", received.String())
+		expect.Equal("rpm", received.GetMetadata().GetValueString("sensor"))
+		expect.Equal(msg.GetCreationTime(), received.GetCreationTime())
+
+	case <-time.After(time.Second):
+		t.Fatal("Batch not received")
+	}
+
+	// A second batch can only be sent after the first one has been acknowledged
+	prod.forward([]*core.Message{core.NewMessage(nil, []byte("reject"), nil, engineStreamID)})
+
+	select {
+	case batch := <-service.batches:
+		expect.Equal(uint64(2), batch.GetSequence())
+	case <-time.After(time.Second):
+		t.Fatal("Batch not received")
+	}
+
+	for start := time.Now(); prod.getNumPending() > 0 && time.Since(start) < time.Second; {
+		time.Sleep(10 * time.Millisecond)
+	}
+	expect.Equal(0, prod.getNumPending())
+}
@@ -200,6 +200,7 @@ func (prod *HTTPRequest) sendReq(msg *core.Message) {
 		}
 		// Success
 		// TBD: health check? (ex-fuse breaker)
+		msg.Release()
 	}()
 }
 
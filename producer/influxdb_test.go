@@ -0,0 +1,153 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestInfluxDBLineProtocol(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	prod := newTestPlugin(expect, "producer.InfluxDB", "influxLineProtocol", map[string]interface{}{
+		"ConvertJSON": true,
+		"Tags":        []string{"car", "driver"},
+	}).(*InfluxDB)
+
+	msg := core.NewMessage(nil, []byte(`{"measurement":"engine","rpm":3000,"oil temp":92.5,"gear":"3"}`),
+		core.Metadata{"car": []byte("LR 19"), "session": []byte("practice")}, core.InvalidStreamID)
+
+	expect.NoError(prod.converter.convert(msg))
+
+	timestamp := strconv.FormatInt(msg.GetCreationTime().UnixNano()/1000000, 10)
+	expect.Equal(`engine,car=LR\ 19 oil\ temp=92.5,rpm=3000 `+timestamp+"\n", msg.String())
+
+	msg = core.NewMessage(nil, []byte(`{"status":"ok"}`), nil, core.InvalidStreamID)
+	expect.NotNil(prod.converter.convert(msg))
+}
+
+func TestInfluxDBWriter20(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	requests := 0
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		expect.Equal("/api/v2/write", r.URL.Path)
+		expect.Equal("racing", r.URL.Query().Get("org"))
+		expect.Equal("telemetry", r.URL.Query().Get("bucket"))
+		expect.Equal("ns", r.URL.Query().Get("precision"))
+		expect.Equal("Token secret", r.Header.Get("Authorization"))
+		expect.Equal("gzip", r.Header.Get("Content-Encoding"))
+
+		reader, err := gzip.NewReader(r.Body)
+		expect.NoError(err)
+		body, _ = ioutil.ReadAll(reader)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	prod := newTestPlugin(expect, "producer.InfluxDB", "influxWriter20", map[string]interface{}{
+		"Version":      200,
+		"Host":         server.URL,
+		"Organization": "racing",
+		"Bucket":       "telemetry",
+		"Token":        "secret",
+		"RetryDelayMs": 1,
+		"ConvertJSON":  true,
+	}).(*InfluxDB)
+
+	msg := core.NewMessage(nil, []byte(`{"rpm":3000}`), nil, core.InvalidStreamID)
+	msg.SetStreamID(core.GetStreamID("engine"))
+	prod.convertAndWrite([]*core.Message{msg})
+
+	timestamp := strconv.FormatInt(msg.GetCreationTime().UnixNano(), 10)
+	expect.Equal(2, requests)
+	expect.Equal("engine rpm=3000 "+timestamp+"\n", string(body))
+}
+
+func TestInfluxDBWriter20ClientError(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	prod := newTestPlugin(expect, "producer.InfluxDB", "influxWriter20Error", map[string]interface{}{
+		"Version":      200,
+		"Host":         server.URL,
+		"Organization": "racing",
+		"RetryDelayMs": 1,
+	}).(*InfluxDB)
+
+	_, err := prod.writer.Write([]byte("engine rpm=3000\n"))
+	expect.NotNil(err)
+	expect.Equal(1, requests)
+}
+
+func TestInfluxDBWriter20StopsRetrying(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	active := int32(1)
+	requests := int32(0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		atomic.StoreInt32(&active, 0)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	prod := newTestPlugin(expect, "producer.InfluxDB", "influxWriter20Stop", map[string]interface{}{
+		"Version":      200,
+		"Host":         server.URL,
+		"Organization": "racing",
+		"RetryDelayMs": 5000,
+	}).(*InfluxDB)
+
+	writer := prod.writer.(*influxDBWriter20)
+	writer.isActive = func() bool { return atomic.LoadInt32(&active) == 1 }
+
+	// The producer stops while the first request fails, so the error is
+	// returned without retrying.
+	start := time.Now()
+	_, err := writer.Write([]byte("engine rpm=3000\n"))
+	expect.NotNil(err)
+	expect.Equal(int32(1), atomic.LoadInt32(&requests))
+	expect.True(time.Since(start) < time.Second)
+
+	// A producer stopping during the backoff aborts the wait
+	atomic.StoreInt32(&active, 1)
+	time.AfterFunc(50*time.Millisecond, func() { atomic.StoreInt32(&active, 0) })
+	expect.False(writer.wait(5 * time.Second))
+	expect.True(time.Since(start) < time.Second)
+}
@@ -35,6 +35,8 @@ const (
 	compressNone   = "none"
 	compressGZIP   = "zip"
 	compressSnappy = "snappy"
+	compressLZ4    = "lz4"
+	compressZSTD   = "zstd"
 )
 
 // Kafka producer
@@ -43,6 +45,17 @@ const (
 // the sarama library (https://github.com/Shopify/sarama) so most settings
 // directly relate to the settings of that library.
 //
+// In idempotent mode the brokers discard duplicates caused by retries, so each
+// message is written exactly once per partition. If TransactionalId is set,
+// all messages collected within Batch/TimeoutMs are written in one
+// transaction. Consumers reading committed messages only will see either all
+// or none of the messages of a batch. If a transaction fails, all of its
+// messages are sent to the fallback. If the commit request has been sent but
+// its result could not be determined, the request is repeated until the
+// outcome is known or the producer shuts down. Messages of transactions with an
+// unknown outcome are discarded and not sent to the fallback, as they might
+// have been committed.
+//
 // Parameters
 //
 // - Servers: Defines a list of ideally all brokers in the cluster. At least one
@@ -50,9 +63,10 @@ const (
 // By default this parameter is set to an empty list.
 //
 // - Version: Defines the kafka protocol version to use. Common values are 0.8.2,
-// 0.9.0 or 0.10.0. Values of the form "A.B" are allowed as well as "A.B.C"
-// and "A.B.C.D". If the version given is not known, the closest possible
-// version is chosen. If GroupId is set to a value < "0.9", "0.9.0.1" will be used.
+// 0.9.0, 0.10.0 or 2.0.0. Values of the form "A.B" are allowed as well as
+// "A.B.C" and "A.B.C.D". If the version given is not known, the closest
+// possible version is chosen. If Idempotent, TransactionalId or HeadersFrom
+// is set to a value < "0.11", "0.11.0.0" will be used.
 // By default this parameter is set to "0.8.2".
 //
 // - Topics: Defines a stream to topic mapping. If a stream is not mapped the
@@ -75,10 +89,34 @@ const (
 // the key passed to kafka. When set to an empty string no key is used.
 // By default this parameter is set to "".
 //
+// - HeadersFrom: Defines a list of metadata fields that are sent as kafka
+// record headers. The metadata key is used as header key. Fields not set for
+// a message are skipped.
+// By default this parameter is set to an empty list.
+//
 // - Compression: Defines the compression algorithm to use.
-// Possible values are "none", "zip" and "snappy".
+// Possible values are "none", "zip", "snappy", "lz4" and "zstd". "zstd"
+// requires Version 2.1 or newer.
 // By default this parameter is set to "none".
 //
+// - TopicCompression: Defines a topic to compression algorithm mapping for
+// topics that should not use the default Compression.
+// By default this parameter is set to an empty map.
+//
+// - Idempotent: Enables the idempotent producer. This forces RequiredAcks to -1
+// and MaxOpenRequests to 1.
+// By default this parameter is set to false.
+//
+// - TransactionalId: Enables transactions when set. The id has to be unique
+// for each producer writing to the cluster and should stay the same when
+// gollum is restarted, so that transactions left open are aborted.
+// Transactions imply Idempotent.
+// By default this parameter is set to "".
+//
+// - TransactionTimeoutMs: Defines the number of milliseconds after which the
+// cluster aborts a transaction that has not been completed.
+// By default this parameter is set to 60000.
+//
 // - RequiredAcks: Defines the numbers of acknowledgements required until a
 // message is marked as "sent". When set to -1 all replicas must acknowledge a
 // message.
@@ -132,7 +170,10 @@ const (
 // By default this parameter is set to 1024.
 //
 // - Batch/TimeoutMs: Defines the maximum time in milliseconds after which a
-// new request will be sent, ignoring of Batch/MinCount and Batch/MinSizeByte
+// new request will be sent, ignoring of Batch/MinCount and Batch/MinSizeByte.
+// When using TransactionalId this is the interval in which transactions are
+// committed. A transaction is committed earlier if it contains Batch/MaxCount
+// messages.
 // By default this parameter is set to 3.
 //
 // - ElectRetries: Defines how many times a metadata request is to be retried
@@ -193,6 +234,25 @@ const (
 //      - "kafka02:9092"
 //      - "kafka03:9092"
 //      - "kafka04:9092"
+//
+// This config writes lap timing events in transactions of up to 100 messages.
+// The driver and lap number are passed as record headers.
+//
+//  lapWriter:
+//    Type: producer.Kafka
+//    Streams: laps
+//    Version: "2.1.0"
+//    TransactionalId: pit-laps-1
+//    HeadersFrom:
+//      - driver
+//      - lap
+//    Batch:
+//      MaxCount: 100
+//      TimeoutMs: 500
+//    TopicCompression:
+//      laps: zstd
+//    Servers:
+//      - "kafka01:9092"
 type Kafka struct {
 	core.BufferedProducer `gollumdoc:"embed_type"`
 	topicGuard            *sync.RWMutex
@@ -205,8 +265,18 @@ type Kafka struct {
 	client                kafka.Client
 	config                *kafka.Config
 	producer              kafka.AsyncProducer
-	nilValueAllowed       bool   `config:"AllowNilValue" default:"false"`
-	keyField              string `config:"KeyFrom"`
+	codecProducers        map[kafka.CompressionCodec]kafka.AsyncProducer
+	successes             chan *kafka.ProducerMessage
+	errors                chan *kafka.ProducerError
+	transaction           *kafkaTransaction
+	transactionGuard      *sync.Mutex
+	compression           kafka.CompressionCodec
+	topicCompression      map[string]kafka.CompressionCodec
+	nilValueAllowed       bool     `config:"AllowNilValue" default:"false"`
+	keyField              string   `config:"KeyFrom"`
+	headerFields          []string `config:"HeadersFrom"`
+	idempotent            bool     `config:"Idempotent" default:"false"`
+	transactionalID       string   `config:"TransactionalId"`
 	metricsRegistry       metrics.Registry
 }
 
@@ -253,6 +323,10 @@ func (prod *Kafka) Configure(conf core.PluginConfigReader) {
 	case "0.10", "0.10.0", "0.10.0.0":
 		prod.config.Version = kafka.V0_10_0_0
 	default:
+		if version, err := kafka.ParseKafkaVersion(ver); err == nil {
+			prod.config.Version = version
+			break
+		}
 		prod.Logger.Warning("Unknown kafka version given: ", ver)
 		parts := strings.Split(ver, ".")
 		if len(parts) < 2 {
@@ -340,19 +414,52 @@ func (prod *Kafka) Configure(conf core.PluginConfigReader) {
 
 	prod.config.Producer.Return.Successes = true
 	prod.config.Producer.Return.Errors = true
-	prod.config.Producer.Return.Successes = true
 
-	switch strings.ToLower(conf.GetString("Compression", compressNone)) {
-	default:
-		fallthrough
-	case compressNone:
-		prod.config.Producer.Compression = kafka.CompressionNone
-	case compressGZIP:
-		prod.config.Producer.Compression = kafka.CompressionGZIP
-	case compressSnappy:
-		prod.config.Producer.Compression = kafka.CompressionSnappy
+	compression := conf.GetString("Compression", compressNone)
+	if codec, known := parseKafkaCompression(compression); known {
+		prod.compression = codec
+	} else {
+		prod.Logger.Warningf("Unknown compression '%s'. Using none", compression)
+	}
+	prod.config.Producer.Compression = prod.compression
+
+	prod.topicCompression = make(map[string]kafka.CompressionCodec)
+	for topic, compression := range conf.GetStringMap("TopicCompression", map[string]string{}) {
+		if codec, known := parseKafkaCompression(compression); known {
+			prod.topicCompression[topic] = codec
+		} else {
+			conf.Errors.Pushf("Unknown compression '%s' for topic %s", compression, topic)
+		}
+	}
+
+	if prod.transactionalID != "" {
+		prod.idempotent = true
 	}
 
+	if (prod.idempotent || len(prod.headerFields) > 0) && !prod.config.Version.IsAtLeast(kafka.V0_11_0_0) {
+		prod.Logger.Warningf("Invalid kafka version %s given, minimum is 0.11 for idempotence, transactions and headers, defaulting to 0.11.0.0", prod.config.Version)
+		prod.config.Version = kafka.V0_11_0_0
+	}
+
+	if prod.idempotent {
+		prod.config.Producer.Idempotent = true
+		prod.config.Producer.RequiredAcks = kafka.WaitForAll
+		prod.config.Net.MaxOpenRequests = 1
+		if prod.config.Producer.Retry.Max < 1 {
+			prod.config.Producer.Retry.Max = 1
+		}
+	}
+
+	if prod.transactionalID != "" {
+		timeout := time.Duration(conf.GetInt("TransactionTimeoutMs", 60000)) * time.Millisecond
+		prod.transaction = newKafkaTransaction(prod.transactionalID, timeout, prod.config, prod.codecFor, prod.IsActive)
+		prod.transactionGuard = new(sync.Mutex)
+	}
+
+	prod.codecProducers = make(map[kafka.CompressionCodec]kafka.AsyncProducer)
+	prod.successes = make(chan *kafka.ProducerMessage, prod.config.ChannelBufferSize)
+	prod.errors = make(chan *kafka.ProducerError, prod.config.ChannelBufferSize)
+
 	switch strings.ToLower(conf.GetString("Partitioner", partRoundrobin)) {
 	case partRandom:
 		prod.config.Producer.Partitioner = kafka.NewRandomPartitioner
@@ -374,6 +481,70 @@ func (prod *Kafka) Configure(conf core.PluginConfigReader) {
 	}
 }
 
+func parseKafkaCompression(name string) (kafka.CompressionCodec, bool) {
+	switch strings.ToLower(name) {
+	case compressNone:
+		return kafka.CompressionNone, true
+	case compressGZIP, "gzip":
+		return kafka.CompressionGZIP, true
+	case compressSnappy:
+		return kafka.CompressionSnappy, true
+	case compressLZ4:
+		return kafka.CompressionLZ4, true
+	case compressZSTD:
+		return kafka.CompressionZSTD, true
+	default:
+		return kafka.CompressionNone, false
+	}
+}
+
+func (prod *Kafka) codecFor(topic string) kafka.CompressionCodec {
+	if codec, exists := prod.topicCompression[topic]; exists {
+		return codec
+	}
+	return prod.compression
+}
+
+// forwardResults passes successes and errors of the given producer to the
+// result channels polled by pollResults.
+func (prod *Kafka) forwardResults(producer kafka.AsyncProducer) {
+	go func() {
+		for result := range producer.Successes() {
+			prod.successes <- result
+		}
+	}()
+	go func() {
+		for err := range producer.Errors() {
+			prod.errors <- err
+		}
+	}()
+}
+
+// producerFor returns the producer used for the given topic. As sarama
+// applies compression per producer, a separate producer is created for each
+// compression algorithm used by TopicCompression.
+func (prod *Kafka) producerFor(topic string) (kafka.AsyncProducer, error) {
+	codec := prod.codecFor(topic)
+	if codec == prod.compression {
+		return prod.producer, nil
+	}
+
+	if producer, exists := prod.codecProducers[codec]; exists {
+		return producer, nil
+	}
+
+	config := *prod.config
+	config.Producer.Compression = codec
+	producer, err := kafka.NewAsyncProducer(prod.servers, &config)
+	if err != nil {
+		return nil, err
+	}
+
+	prod.forwardResults(producer)
+	prod.codecProducers[codec] = producer
+	return producer, nil
+}
+
 func (prod *Kafka) onMsgReturned(msg *core.Message) {
 	prod.topicGuard.RLock()
 	topic := prod.topic[msg.GetStreamID()]
@@ -385,28 +556,33 @@ func (prod *Kafka) onMsgReturned(msg *core.Message) {
 
 func (prod *Kafka) pollResults() {
 	// Check for results
+	if prod.transaction != nil {
+		prod.transactionGuard.Lock()
+		defer prod.transactionGuard.Unlock()
+		prod.commitTransaction()
+		return
+	}
+
 	keepPolling := true
 	timeout := time.NewTimer(prod.config.Producer.Flush.Frequency / 2)
-	for keepPolling && prod.producer != nil {
+	for keepPolling {
 		select {
-		case result, hasMore := <-prod.producer.Successes():
-			if hasMore {
-				if msg, hasMsg := result.Metadata.(core.Message); hasMsg {
-					prod.onMsgReturned(&msg)
-				}
+		case result := <-prod.successes:
+			if msg, hasMsg := result.Metadata.(*core.Message); hasMsg {
+				prod.onMsgReturned(msg)
+				msg.Release()
 			}
 
-		case err, hasMore := <-prod.producer.Errors():
-			if hasMore {
-				if msg, hasMsg := err.Msg.Metadata.(core.Message); hasMsg {
-					prod.Logger.WithError(err).Warning("Kafka producer error on return: ")
-					prod.onMsgReturned(&msg)
-					if err == kafka.ErrMessageTooLarge {
-						prod.Logger.Error("Message discarded as too large.")
-						core.MetricMessagesDiscarded.Inc(1)
-					} else {
-						prod.TryFallback(&msg)
-					}
+		case err := <-prod.errors:
+			if msg, hasMsg := err.Msg.Metadata.(*core.Message); hasMsg {
+				prod.Logger.WithError(err).Warning("Kafka producer error on return: ")
+				prod.onMsgReturned(msg)
+				if err.Err == kafka.ErrMessageSizeTooLarge {
+					prod.Logger.Error("Message discarded as too large.")
+					core.MetricMessagesDiscarded.Inc(1)
+					msg.Release()
+				} else {
+					prod.TryFallback(msg)
 				}
 			}
 
@@ -449,6 +625,7 @@ func (prod *Kafka) produceMessage(msg *core.Message) {
 		streamName := core.StreamRegistry.GetStreamName(msg.GetStreamID())
 		prod.Logger.Errorf("0 byte message detected on %s. Discarded", streamName)
 		core.MetricMessagesDiscarded.Inc(1)
+		msg.Release()
 		return // ### return, invalid data ###
 	}
 
@@ -467,6 +644,13 @@ func (prod *Kafka) produceMessage(msg *core.Message) {
 		topic = prod.registerNewTopic(topicName, msg.GetStreamID())
 	}
 
+	if prod.transaction != nil {
+		// Transactions are also committed by the ticker and on close. The
+		// guard covers the connection, too, as commits may reconnect.
+		prod.transactionGuard.Lock()
+		defer prod.transactionGuard.Unlock()
+	}
+
 	if isConnected, err := prod.isConnected(topic.name); !isConnected {
 		prod.TryFallback(msg)
 		if err != nil {
@@ -479,7 +663,8 @@ func (prod *Kafka) produceMessage(msg *core.Message) {
 	kafkaMsg := &kafka.ProducerMessage{
 		Topic:    topic.name,
 		Value:    kafka.ByteEncoder(msg.GetPayload()),
-		Metadata: &msg,
+		Headers:  prod.getKafkaMsgHeaders(msg),
+		Metadata: msg,
 	}
 
 	kafkaKey := prod.getKafkaMsgKey(msg)
@@ -487,11 +672,27 @@ func (prod *Kafka) produceMessage(msg *core.Message) {
 		kafkaMsg.Key = kafka.ByteEncoder(kafkaKey)
 	}
 
+	if prod.transaction != nil {
+		topic.metricsSent.Inc(1)
+		maxCount := prod.config.Producer.Flush.MaxMessages
+		if numPending := prod.transaction.add(kafkaMsg); maxCount > 0 && numPending >= maxCount {
+			prod.commitTransaction()
+		}
+		return // ### return, sent with next commit ###
+	}
+
+	producer, err := prod.producerFor(topic.name)
+	if err != nil {
+		prod.Logger.WithError(err).Errorf("Failed to create producer for topic %s", topic.name)
+		prod.TryFallback(msg)
+		return // ### return, no producer ###
+	}
+
 	// Sarama can block on single messages if all buffers are full.
 	// So we stop trying after a few milliseconds
 	timeout := time.NewTimer(prod.gracePeriod)
 	select {
-	case prod.producer.Input() <- kafkaMsg:
+	case producer.Input() <- kafkaMsg:
 		timeout.Stop()
 		topic.metricsSent.Inc(1)
 
@@ -513,8 +714,76 @@ func (prod *Kafka) getKafkaMsgKey(msg *core.Message) []byte {
 
 }
 
+func (prod *Kafka) getKafkaMsgHeaders(msg *core.Message) []kafka.RecordHeader {
+	if len(prod.headerFields) == 0 {
+		return nil
+	}
+
+	metadata := msg.TryGetMetadata()
+	if metadata == nil {
+		return nil
+	}
+
+	headers := make([]kafka.RecordHeader, 0, len(prod.headerFields))
+	for _, field := range prod.headerFields {
+		if value, exists := metadata.TryGetValue(field); exists {
+			headers = append(headers, kafka.RecordHeader{Key: []byte(field), Value: value})
+		}
+	}
+	return headers
+}
+
+// commitTransaction writes all pending messages in one transaction. The
+// caller has to hold transactionGuard.
+func (prod *Kafka) commitTransaction() {
+	messages := prod.transaction.takePending()
+	if len(messages) == 0 {
+		return
+	}
+
+	if prod.client == nil && !prod.tryOpenConnection() {
+		prod.fallbackTransaction(messages)
+		return
+	}
+
+	if err := prod.transaction.commit(messages); err != nil {
+		if _, isUnknown := err.(kafkaTransactionUnknownError); isUnknown {
+			// Sending the messages to the fallback might duplicate them
+			prod.Logger.WithError(err).Errorf("Transaction of %d messages might have been committed", len(messages))
+			prod.discardTransaction(messages, "Outcome of transaction is unknown")
+			return
+		}
+		prod.Logger.WithError(err).Errorf("Failed to commit transaction of %d messages", len(messages))
+		prod.fallbackTransaction(messages)
+		return
+	}
+
+	for _, kafkaMsg := range messages {
+		if msg, hasMsg := kafkaMsg.Metadata.(*core.Message); hasMsg {
+			prod.onMsgReturned(msg)
+			msg.Release()
+		}
+	}
+}
+
+func (prod *Kafka) fallbackTransaction(messages []*kafka.ProducerMessage) {
+	for _, kafkaMsg := range messages {
+		if msg, hasMsg := kafkaMsg.Metadata.(*core.Message); hasMsg {
+			prod.TryFallback(msg)
+		}
+	}
+}
+
+func (prod *Kafka) discardTransaction(messages []*kafka.ProducerMessage, reason string) {
+	for _, kafkaMsg := range messages {
+		if msg, hasMsg := kafkaMsg.Metadata.(*core.Message); hasMsg {
+			core.DiscardMessage(msg, prod.GetID(), reason)
+		}
+	}
+}
+
 func (prod *Kafka) isConnected(topic string) (bool, error) {
-	if prod.client == nil || prod.producer == nil {
+	if prod.client == nil || (prod.producer == nil && prod.transaction == nil) {
 		if !prod.tryOpenConnection() {
 			return false, nil // ### return, error ###
 		}
@@ -573,10 +842,17 @@ func (prod *Kafka) tryOpenConnection() bool {
 		}
 	}
 
+	// Transactions are written without sarama's producer
+	if prod.transaction != nil {
+		prod.transaction.client = prod.client
+		return true
+	}
+
 	// Make sure we have a producer up and running
 	if prod.producer == nil {
 		if producer, err := kafka.NewAsyncProducerFromClient(prod.client); err == nil {
 			prod.producer = producer
+			prod.forwardResults(producer)
 		} else {
 			prod.Logger.WithError(err).Error("Producer initialization error")
 			return false // ### return, connection failed ###
@@ -590,6 +866,12 @@ func (prod *Kafka) closeConnection() {
 	if prod.producer != nil {
 		prod.producer.Close()
 	}
+	for _, producer := range prod.codecProducers {
+		producer.Close()
+	}
+	if prod.transaction != nil {
+		prod.transaction.closeCoordinator()
+	}
 	if prod.client != nil {
 		prod.client.Close()
 	}
@@ -598,6 +880,11 @@ func (prod *Kafka) closeConnection() {
 func (prod *Kafka) close() {
 	defer prod.WorkerDone()
 	prod.DefaultClose()
+	if prod.transaction != nil {
+		prod.transactionGuard.Lock()
+		defer prod.transactionGuard.Unlock()
+		prod.commitTransaction()
+	}
 	prod.closeConnection()
 }
 
@@ -0,0 +1,280 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"testing"
+	"time"
+
+	kafka "github.com/Shopify/sarama"
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestKafkaConfigure(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	prod := newTestPlugin(expect, "producer.Kafka", "kafkaIdempotent", map[string]interface{}{
+		"Idempotent":  true,
+		"Compression": "snappy",
+		"TopicCompression": map[string]string{
+			"laps": "zstd",
+		},
+	}).(*Kafka)
+
+	expect.True(prod.config.Producer.Idempotent)
+	expect.Equal(kafka.WaitForAll, prod.config.Producer.RequiredAcks)
+	expect.Equal(1, prod.config.Net.MaxOpenRequests)
+	expect.Equal(kafka.V0_11_0_0, prod.config.Version)
+	expect.Equal(kafka.CompressionSnappy, prod.codecFor("telemetry"))
+	expect.Equal(kafka.CompressionZSTD, prod.codecFor("laps"))
+	expect.Nil(prod.transaction)
+
+	prod = newTestPlugin(expect, "producer.Kafka", "kafkaTransactional", map[string]interface{}{
+		"TransactionalId": "pit-laps-1",
+		"Version":         "2.1.0",
+	}).(*Kafka)
+	expect.True(prod.config.Producer.Idempotent)
+	expect.Equal(kafka.V2_1_0_0, prod.config.Version)
+	expect.NotNil(prod.transaction)
+
+	_, err := tryNewTestPlugin("producer.Kafka", "kafkaInvalidCompression", map[string]interface{}{
+		"TopicCompression": map[string]string{"laps": "brotli"},
+	})
+	expect.NotNil(err)
+}
+
+func TestKafkaHeaders(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	prod := newTestPlugin(expect, "producer.Kafka", "kafkaHeaders", map[string]interface{}{
+		"HeadersFrom": []string{"driver", "lap"},
+	}).(*Kafka)
+
+	msg := core.NewMessage(nil, []byte("1:42.137"), core.Metadata{}, core.InvalidStreamID)
+	msg.GetMetadata().SetValue("driver", []byte("44"))
+	msg.GetMetadata().SetValue("sector", []byte("3"))
+
+	headers := prod.getKafkaMsgHeaders(msg)
+	expect.Equal(1, len(headers))
+	expect.Equal("driver", string(headers[0].Key))
+	expect.Equal("44", string(headers[0].Value))
+}
+
+func newKafkaTestBroker(t *testing.T, produceResponse *kafka.MockProduceResponse) *kafka.MockBroker {
+	broker := kafka.NewMockBroker(t, 1)
+	broker.SetHandlerByMap(kafkaTestHandlers(t, broker, produceResponse))
+	return broker
+}
+
+func kafkaTestHandlers(t *testing.T, broker *kafka.MockBroker, produceResponse *kafka.MockProduceResponse) map[string]kafka.MockResponse {
+	coordinator := kafka.NewBroker(broker.Addr())
+
+	return map[string]kafka.MockResponse{
+		"MetadataRequest": kafka.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetController(broker.BrokerID()).
+			SetLeader("laps", 0, broker.BrokerID()),
+		"FindCoordinatorRequest": kafka.NewMockWrapper(&kafka.FindCoordinatorResponse{
+			Version:     1,
+			Coordinator: coordinator,
+		}),
+		"InitProducerIDRequest": kafka.NewMockWrapper(&kafka.InitProducerIDResponse{
+			ProducerID: 7,
+		}),
+		"AddPartitionsToTxnRequest": kafka.NewMockWrapper(&kafka.AddPartitionsToTxnResponse{}),
+		"ProduceRequest":            produceResponse,
+		"EndTxnRequest":             kafka.NewMockWrapper(&kafka.EndTxnResponse{}),
+	}
+}
+
+func newKafkaTestTransaction(expect ttesting.Expect, broker *kafka.MockBroker) *kafkaTransaction {
+	config := kafka.NewConfig()
+	config.Version = kafka.V0_11_0_0
+	config.Producer.Retry.Backoff = time.Millisecond
+
+	client, err := kafka.NewClient([]string{broker.Addr()}, config)
+	expect.NoError(err)
+
+	txn := newKafkaTransaction("pit-laps-1", time.Minute, config, func(string) kafka.CompressionCodec {
+		return kafka.CompressionNone
+	}, func() bool { return false })
+	txn.client = client
+	return txn
+}
+
+func kafkaTestEndTxnRequests(broker *kafka.MockBroker) []*kafka.EndTxnRequest {
+	requests := []*kafka.EndTxnRequest{}
+	for _, entry := range broker.History() {
+		if req, isEndTxn := entry.Request.(*kafka.EndTxnRequest); isEndTxn {
+			requests = append(requests, req)
+		}
+	}
+	return requests
+}
+
+// Configure sets sarama's global logger, so this test has to run before tests
+// closing sarama clients in the background.
+func TestKafkaTransactionConcurrentCommit(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	broker := newKafkaTestBroker(t, kafka.NewMockProduceResponse(t).SetVersion(3))
+	defer broker.Close()
+
+	prod := newTestPlugin(expect, "producer.Kafka", "kafkaConcurrentCommit", map[string]interface{}{
+		"Servers":         []string{broker.Addr()},
+		"TransactionalId": "pit-laps-1",
+		"Version":         "0.11.0.0",
+		"Batch/MaxCount":  7,
+	}).(*Kafka)
+	defer prod.closeConnection()
+
+	// The ticker commits while the message loop adds and commits messages
+	const numMessages = 100
+	streamID := core.GetStreamID("laps")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < numMessages; i++ {
+			prod.produceMessage(core.NewMessage(nil, []byte("lap"), nil, streamID))
+		}
+	}()
+
+	for polling := true; polling; {
+		select {
+		case <-done:
+			polling = false
+		default:
+			prod.pollResults()
+		}
+	}
+	prod.pollResults()
+
+	expect.Equal(0, len(prod.transaction.pending))
+	expect.Equal(int64(numMessages), prod.topic[streamID].metricsDelivered.Count())
+}
+
+func TestKafkaTransactionCommit(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	broker := newKafkaTestBroker(t, kafka.NewMockProduceResponse(t).SetVersion(3))
+	defer broker.Close()
+
+	txn := newKafkaTestTransaction(expect, broker)
+	defer txn.client.Close()
+
+	messages := []*kafka.ProducerMessage{
+		{Topic: "laps", Value: kafka.StringEncoder("lap 1"), Headers: []kafka.RecordHeader{{Key: []byte("driver"), Value: []byte("44")}}},
+		{Topic: "laps", Value: kafka.StringEncoder("lap 2")},
+	}
+
+	expect.NoError(txn.commit(messages))
+	expect.Equal(int64(7), txn.producerID)
+	expect.Equal(int32(2), txn.sequences["laps"][0])
+
+	produced := false
+	for _, entry := range broker.History() {
+		if req, isProduce := entry.Request.(*kafka.ProduceRequest); isProduce {
+			expect.Equal("pit-laps-1", *req.TransactionalID)
+			expect.Equal(kafka.WaitForAll, req.RequiredAcks)
+			produced = true
+		}
+	}
+	expect.True(produced)
+
+	endRequests := kafkaTestEndTxnRequests(broker)
+	expect.Equal(1, len(endRequests))
+	expect.True(endRequests[0].TransactionResult)
+}
+
+func TestKafkaTransactionAbort(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	broker := newKafkaTestBroker(t, kafka.NewMockProduceResponse(t).SetVersion(3).
+		SetError("laps", 0, kafka.ErrNotEnoughReplicas))
+	defer broker.Close()
+
+	txn := newKafkaTestTransaction(expect, broker)
+	defer txn.client.Close()
+
+	err := txn.commit([]*kafka.ProducerMessage{{Topic: "laps", Value: kafka.StringEncoder("lap 1")}})
+	expect.NotNil(err)
+	expect.Equal(int64(-1), txn.producerID)
+
+	endRequests := kafkaTestEndTxnRequests(broker)
+	expect.Equal(1, len(endRequests))
+	expect.False(endRequests[0].TransactionResult)
+}
+
+func TestKafkaTransactionCommitResponseLost(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	produceResponse := kafka.NewMockProduceResponse(t).SetVersion(3)
+	broker := newKafkaTestBroker(t, produceResponse)
+	defer broker.Close()
+
+	txn := newKafkaTestTransaction(expect, broker)
+	txn.config.Net.ReadTimeout = 100 * time.Millisecond
+	defer txn.client.Close()
+
+	// The first response is lost, the repeated request reports the commit
+	handlers := kafkaTestHandlers(t, broker, produceResponse)
+	handlers["EndTxnRequest"] = kafka.NewMockSequence(kafka.NewMockWrapper(nil), &kafka.EndTxnResponse{})
+	broker.SetHandlerByMap(handlers)
+
+	expect.NoError(txn.commit([]*kafka.ProducerMessage{{Topic: "laps", Value: kafka.StringEncoder("lap 1")}}))
+	expect.Equal(int64(7), txn.producerID)
+
+	endRequests := kafkaTestEndTxnRequests(broker)
+	expect.Equal(2, len(endRequests))
+	for _, req := range endRequests {
+		expect.True(req.TransactionResult)
+		expect.Equal(int64(7), req.ProducerID)
+		expect.Equal(endRequests[0].ProducerEpoch, req.ProducerEpoch)
+	}
+}
+
+func TestKafkaTransactionCommitUnknown(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	produceResponse := kafka.NewMockProduceResponse(t).SetVersion(3)
+	broker := newKafkaTestBroker(t, produceResponse)
+	defer broker.Close()
+
+	txn := newKafkaTestTransaction(expect, broker)
+	txn.config.Net.ReadTimeout = 100 * time.Millisecond
+	defer txn.client.Close()
+
+	messages := []*kafka.ProducerMessage{{Topic: "laps", Value: kafka.StringEncoder("lap 1")}}
+
+	// The first response is lost and the producer has been fenced since
+	handlers := kafkaTestHandlers(t, broker, produceResponse)
+	handlers["EndTxnRequest"] = kafka.NewMockSequence(kafka.NewMockWrapper(nil),
+		&kafka.EndTxnResponse{Err: kafka.ErrInvalidProducerEpoch})
+	broker.SetHandlerByMap(handlers)
+
+	err := txn.commit(messages)
+	_, isUnknown := err.(kafkaTransactionUnknownError)
+	expect.True(isUnknown)
+	expect.Equal(int64(-1), txn.producerID)
+
+	// A transaction aborted in the meantime is reported as failed
+	handlers["EndTxnRequest"] = kafka.NewMockSequence(kafka.NewMockWrapper(nil),
+		&kafka.EndTxnResponse{Err: kafka.ErrInvalidTxnState})
+	broker.SetHandlerByMap(handlers)
+
+	err = txn.commit(messages)
+	expect.Equal(kafka.ErrInvalidTxnState, err)
+}
@@ -0,0 +1,464 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"fmt"
+	"time"
+
+	kafka "github.com/Shopify/sarama"
+)
+
+const kafkaTransactionRetries = 10
+
+// kafkaTransaction writes batches of messages to kafka using the transactional
+// producer protocol (KIP-98). Sarama's AsyncProducer does not support
+// transactions, so requests are built and sent directly to the brokers.
+type kafkaTransaction struct {
+	id           string
+	timeout      time.Duration
+	client       kafka.Client
+	config       *kafka.Config
+	codecFor     func(topic string) kafka.CompressionCodec
+	isActive     func() bool
+	coordinator  *kafka.Broker
+	producerID   int64
+	epoch        int16
+	sequences    map[string]map[int32]int32
+	partitioners map[string]kafka.Partitioner
+	pending      []*kafka.ProducerMessage
+}
+
+type kafkaTransactionBatches map[string]map[int32]*kafka.RecordBatch
+
+// kafkaTransactionUnknownError is returned by commit if the commit request
+// might have been processed by the coordinator, but the outcome could not be
+// determined. The messages of such a transaction might have been committed.
+type kafkaTransactionUnknownError struct {
+	err error
+}
+
+func (err kafkaTransactionUnknownError) Error() string {
+	return fmt.Sprintf("outcome of transaction is unknown: %s", err.err)
+}
+
+// newKafkaTransaction creates a new transaction writer. isActive is used to
+// stop retrying commits with an unknown outcome once the producer shuts down.
+func newKafkaTransaction(id string, timeout time.Duration, config *kafka.Config, codecFor func(string) kafka.CompressionCodec, isActive func() bool) *kafkaTransaction {
+	txn := &kafkaTransaction{
+		id:           id,
+		timeout:      timeout,
+		config:       config,
+		codecFor:     codecFor,
+		isActive:     isActive,
+		partitioners: make(map[string]kafka.Partitioner),
+	}
+	txn.reset()
+	return txn
+}
+
+// reset discards the current producer id. The next transaction requests a
+// new producer epoch, which aborts any transaction left open by this id.
+func (txn *kafkaTransaction) reset() {
+	txn.producerID = -1
+	txn.epoch = -1
+	txn.sequences = make(map[string]map[int32]int32)
+}
+
+func (txn *kafkaTransaction) add(msg *kafka.ProducerMessage) int {
+	txn.pending = append(txn.pending, msg)
+	return len(txn.pending)
+}
+
+// takePending returns all messages added since the last call and clears the
+// list of pending messages.
+func (txn *kafkaTransaction) takePending() []*kafka.ProducerMessage {
+	messages := txn.pending
+	txn.pending = nil
+	return messages
+}
+
+func isRetriableTransactionError(err error) bool {
+	switch err {
+	case kafka.ErrConcurrentTransactions,
+		kafka.ErrOffsetsLoadInProgress,
+		kafka.ErrConsumerCoordinatorNotAvailable,
+		kafka.ErrNotCoordinatorForConsumer,
+		kafka.ErrRequestTimedOut:
+		return true
+	}
+	return false
+}
+
+func (txn *kafkaTransaction) retry(action func() error) (err error) {
+	for i := 0; i < kafkaTransactionRetries; i++ {
+		if err = action(); err == nil || !isRetriableTransactionError(err) {
+			return err
+		}
+		time.Sleep(txn.config.Producer.Retry.Backoff)
+	}
+	return err
+}
+
+func (txn *kafkaTransaction) findCoordinator() (*kafka.Broker, error) {
+	if txn.coordinator != nil {
+		return txn.coordinator, nil
+	}
+
+	broker, err := txn.client.Controller()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := broker.FindCoordinator(&kafka.FindCoordinatorRequest{
+		Version:         1,
+		CoordinatorKey:  txn.id,
+		CoordinatorType: kafka.CoordinatorTransaction,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Err != kafka.ErrNoError {
+		return nil, resp.Err
+	}
+
+	if err := resp.Coordinator.Open(txn.config); err != nil && err != kafka.ErrAlreadyConnected {
+		return nil, err
+	}
+	txn.coordinator = resp.Coordinator
+	return txn.coordinator, nil
+}
+
+// checkCoordinatorError closes and forgets the current coordinator if err
+// indicates that the connection failed or that the coordinator has moved to
+// another broker.
+func (txn *kafkaTransaction) checkCoordinatorError(err error) error {
+	if _, isKafkaError := err.(kafka.KError); err != nil && (!isKafkaError || err == kafka.ErrNotCoordinatorForConsumer) {
+		txn.closeCoordinator()
+	}
+	return err
+}
+
+// closeCoordinator closes the connection to the current coordinator.
+func (txn *kafkaTransaction) closeCoordinator() {
+	if txn.coordinator != nil {
+		txn.coordinator.Close()
+		txn.coordinator = nil
+	}
+}
+
+func (txn *kafkaTransaction) initProducerID() error {
+	if txn.producerID >= 0 {
+		return nil
+	}
+
+	coordinator, err := txn.findCoordinator()
+	if err != nil {
+		return err
+	}
+
+	resp, err := coordinator.InitProducerID(&kafka.InitProducerIDRequest{
+		TransactionalID:    &txn.id,
+		TransactionTimeout: txn.timeout,
+	})
+	if err != nil {
+		return txn.checkCoordinatorError(err)
+	}
+	if resp.Err != kafka.ErrNoError {
+		return txn.checkCoordinatorError(resp.Err)
+	}
+
+	txn.producerID = resp.ProducerID
+	txn.epoch = resp.ProducerEpoch
+	txn.sequences = make(map[string]map[int32]int32)
+	return nil
+}
+
+func (txn *kafkaTransaction) partitioner(topic string) kafka.Partitioner {
+	partitioner, exists := txn.partitioners[topic]
+	if !exists {
+		partitioner = txn.config.Producer.Partitioner(topic)
+		txn.partitioners[topic] = partitioner
+	}
+	return partitioner
+}
+
+func encodeKafkaValue(encoder kafka.Encoder) ([]byte, error) {
+	if encoder == nil {
+		return nil, nil
+	}
+	return encoder.Encode()
+}
+
+// buildBatches assigns a partition to each message and groups the messages
+// into one record batch per partition.
+func (txn *kafkaTransaction) buildBatches(messages []*kafka.ProducerMessage) (kafkaTransactionBatches, error) {
+	batches := make(kafkaTransactionBatches)
+	now := time.Now()
+
+	for _, msg := range messages {
+		partitions, err := txn.client.Partitions(msg.Topic)
+		if err != nil {
+			return nil, err
+		}
+		if len(partitions) == 0 {
+			return nil, kafka.ErrLeaderNotAvailable
+		}
+
+		choice, err := txn.partitioner(msg.Topic).Partition(msg, int32(len(partitions)))
+		if err != nil {
+			return nil, err
+		}
+		if choice < 0 || int(choice) >= len(partitions) {
+			return nil, kafka.ErrInvalidPartition
+		}
+		msg.Partition = partitions[choice]
+
+		key, err := encodeKafkaValue(msg.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := encodeKafkaValue(msg.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		if batches[msg.Topic] == nil {
+			batches[msg.Topic] = make(map[int32]*kafka.RecordBatch)
+		}
+		batch := batches[msg.Topic][msg.Partition]
+		if batch == nil {
+			batch = &kafka.RecordBatch{
+				Version:          2,
+				Codec:            txn.codecFor(msg.Topic),
+				CompressionLevel: txn.config.Producer.CompressionLevel,
+				FirstTimestamp:   now,
+				MaxTimestamp:     now,
+				ProducerID:       txn.producerID,
+				ProducerEpoch:    txn.epoch,
+				IsTransactional:  true,
+			}
+			batches[msg.Topic][msg.Partition] = batch
+		}
+
+		record := &kafka.Record{
+			Key:         key,
+			Value:       value,
+			OffsetDelta: int64(len(batch.Records)),
+		}
+		for i := range msg.Headers {
+			record.Headers = append(record.Headers, &msg.Headers[i])
+		}
+		batch.Records = append(batch.Records, record)
+		batch.LastOffsetDelta = int32(len(batch.Records) - 1)
+	}
+
+	return batches, nil
+}
+
+func (txn *kafkaTransaction) addPartitions(batches kafkaTransactionBatches) error {
+	coordinator, err := txn.findCoordinator()
+	if err != nil {
+		return err
+	}
+
+	topicPartitions := make(map[string][]int32, len(batches))
+	for topic, partitions := range batches {
+		for partition := range partitions {
+			topicPartitions[topic] = append(topicPartitions[topic], partition)
+		}
+	}
+
+	resp, err := coordinator.AddPartitionsToTxn(&kafka.AddPartitionsToTxnRequest{
+		TransactionalID: txn.id,
+		ProducerID:      txn.producerID,
+		ProducerEpoch:   txn.epoch,
+		TopicPartitions: topicPartitions,
+	})
+	if err != nil {
+		return txn.checkCoordinatorError(err)
+	}
+
+	for _, partitionErrors := range resp.Errors {
+		for _, partitionError := range partitionErrors {
+			if partitionError.Err != kafka.ErrNoError {
+				return txn.checkCoordinatorError(partitionError.Err)
+			}
+		}
+	}
+	return nil
+}
+
+// produce sends all batches to the partition leaders. Sequence numbers are
+// only advanced if all batches have been written.
+func (txn *kafkaTransaction) produce(batches kafkaTransactionBatches) error {
+	requests := make(map[*kafka.Broker]*kafka.ProduceRequest)
+	leaders := make(map[string]map[int32]*kafka.Broker)
+
+	for topic, partitions := range batches {
+		leaders[topic] = make(map[int32]*kafka.Broker)
+		for partition, batch := range partitions {
+			leader, err := txn.client.Leader(topic, partition)
+			if err != nil {
+				return err
+			}
+			leaders[topic][partition] = leader
+
+			req, exists := requests[leader]
+			if !exists {
+				req = &kafka.ProduceRequest{
+					TransactionalID: &txn.id,
+					RequiredAcks:    kafka.WaitForAll,
+					Timeout:         int32(txn.config.Producer.Timeout / time.Millisecond),
+					Version:         3,
+				}
+				requests[leader] = req
+			}
+			if batch.Codec == kafka.CompressionZSTD {
+				req.Version = 7
+			}
+
+			batch.FirstSequence = txn.sequences[topic][partition]
+			req.AddBatch(topic, partition, batch)
+		}
+	}
+
+	responses := make(map[*kafka.Broker]*kafka.ProduceResponse, len(requests))
+	for broker, req := range requests {
+		resp, err := broker.Produce(req)
+		if err != nil {
+			return err
+		}
+		responses[broker] = resp
+	}
+
+	for topic, partitions := range batches {
+		for partition := range partitions {
+			block := responses[leaders[topic][partition]].GetBlock(topic, partition)
+			if block == nil {
+				return kafka.ErrIncompleteResponse
+			}
+			if block.Err != kafka.ErrNoError {
+				return fmt.Errorf("failed to write to %s/%d: %s", topic, partition, block.Err)
+			}
+		}
+	}
+
+	for topic, partitions := range batches {
+		if txn.sequences[topic] == nil {
+			txn.sequences[topic] = make(map[int32]int32)
+		}
+		for partition, batch := range partitions {
+			txn.sequences[topic][partition] += int32(len(batch.Records))
+		}
+	}
+	return nil
+}
+
+// end completes the current transaction. sent is false if the request did
+// not reach the coordinator.
+func (txn *kafkaTransaction) end(commit bool) (sent bool, err error) {
+	coordinator, err := txn.findCoordinator()
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := coordinator.EndTxn(&kafka.EndTxnRequest{
+		TransactionalID:   txn.id,
+		ProducerID:        txn.producerID,
+		ProducerEpoch:     txn.epoch,
+		TransactionResult: commit,
+	})
+	if err != nil {
+		return true, txn.checkCoordinatorError(err)
+	}
+	if resp.Err != kafka.ErrNoError {
+		return true, txn.checkCoordinatorError(resp.Err)
+	}
+	return true, nil
+}
+
+// endCommit commits the current transaction. If a request might have been
+// processed without the response reaching us, the request is repeated with
+// the same producer id and epoch until the outcome is known. A coordinator
+// that already committed the transaction answers a repeated request with
+// success, one that aborted the transaction answers with ErrInvalidTxnState.
+func (txn *kafkaTransaction) endCommit() error {
+	unknown := false
+	for attempt := 1; ; attempt++ {
+		sent, err := txn.end(true)
+		if err == nil {
+			return nil // ### return, committed ###
+		}
+
+		_, isKafkaError := err.(kafka.KError)
+		switch {
+		case !isKafkaError || err == kafka.ErrRequestTimedOut:
+			// The coordinator might have processed the request
+			unknown = unknown || sent
+
+		case !isRetriableTransactionError(err):
+			if unknown && err != kafka.ErrInvalidTxnState {
+				return kafkaTransactionUnknownError{err}
+			}
+			return err // ### return, not committed ###
+		}
+
+		if attempt >= kafkaTransactionRetries && (!unknown || !txn.isActive()) {
+			if unknown {
+				return kafkaTransactionUnknownError{err}
+			}
+			return err
+		}
+		time.Sleep(txn.config.Producer.Retry.Backoff)
+	}
+}
+
+// commit writes all given messages within one transaction. If a
+// kafkaTransactionUnknownError is returned, the messages might have been
+// committed. For all other errors none of the messages has been made visible
+// to consumers reading committed messages only.
+func (txn *kafkaTransaction) commit(messages []*kafka.ProducerMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	if err := txn.retry(txn.initProducerID); err != nil {
+		txn.reset()
+		return err
+	}
+
+	batches, err := txn.buildBatches(messages)
+	if err != nil {
+		return err // ### return, transaction not started ###
+	}
+
+	err = txn.retry(func() error { return txn.addPartitions(batches) })
+	if err == nil {
+		err = txn.produce(batches)
+	}
+	if err != nil {
+		txn.end(false)
+		txn.reset()
+		return err
+	}
+
+	if err := txn.endCommit(); err != nil {
+		// A new epoch completes or aborts the transaction on the coordinator
+		txn.reset()
+		return err
+	}
+	return nil
+}
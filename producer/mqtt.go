@@ -0,0 +1,137 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/components"
+)
+
+// MQTT producer
+//
+// This producer publishes messages to an MQTT broker. The topic of each
+// message is generated from a template that may contain the name of the
+// stream and metadata values of the message.
+//
+// Parameters
+//
+// - Topic: Defines the topic template to publish to. A "*" is replaced by the
+// name of the stream the message is sent on. Placeholders in the form of
+// "${key}" are replaced by the value of the metadata field "key". Missing
+// metadata fields are replaced by an empty string.
+// By default this parameter is set to "gollum/*".
+//
+// - QoS: Defines the quality of service level to publish with. Valid values
+// are 0 (at most once), 1 (at least once) and 2 (exactly once).
+// By default this parameter is set to 1.
+//
+// - Retain: When set to true, the broker retains the last message of each
+// topic and sends it to new subscribers.
+// By default this parameter is set to false.
+//
+// - TimeoutMs: Defines the maximum time to wait for the broker to acknowledge
+// a message. Messages that are not acknowledged in time are sent to the
+// fallback stream. If set to 0, the producer waits forever.
+// By default this parameter is set to 5000.
+//
+// Examples
+//
+// This example publishes messages to a topic per sensor, read from the
+// metadata field "sensor" and retains the last value.
+//
+//  MqttOut:
+//    Type: producer.MQTT
+//    Streams: sensors
+//    Address: "tcp://broker:1883"
+//    Topic: "gollum/*/${sensor}"
+//    QoS: 1
+//    Retain: true
+//    WillTopic: "gollum/status"
+//    WillMessage: "offline"
+//    WillRetain: true
+//
+type MQTT struct {
+	core.BufferedProducer `gollumdoc:"embed_type"`
+	Client                components.MQTTClient `gollumdoc:"embed_type"`
+	topic                 string                `config:"Topic" default:"gollum/*"`
+	qos                   int                   `config:"QoS" default:"1"`
+	retain                bool                  `config:"Retain" default:"false"`
+	timeout               time.Duration         `config:"TimeoutMs" default:"5000" metric:"ms"`
+	client                mqtt.Client
+}
+
+func init() {
+	core.TypeRegistry.Register(MQTT{})
+}
+
+// Configure initializes this producer with values from a plugin config.
+func (prod *MQTT) Configure(conf core.PluginConfigReader) {
+	prod.SetStopCallback(prod.close)
+	conf.Errors.Push(components.ValidateMQTTQoS(prod.qos))
+
+	options := prod.Client.GetClientOptions()
+	options.SetOnConnectHandler(func(mqtt.Client) {
+		prod.Logger.Debug("Connected to ", prod.Client.GetAddress())
+	})
+	options.SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+		prod.Logger.WithError(err).Warning("Connection to broker lost")
+	})
+}
+
+func (prod *MQTT) publish(msg *core.Message) {
+	topic := expandTopicTemplate(prod.topic, msg)
+	token := prod.client.Publish(topic, byte(prod.qos), prod.retain, msg.GetPayload())
+
+	if err := components.WaitMQTTToken(token, prod.timeout); err != nil {
+		prod.Logger.WithError(err).Errorf("Failed to publish to %s", topic)
+		prod.TryFallback(msg)
+		return // ### return, not published ###
+	}
+	msg.Release()
+}
+
+func (prod *MQTT) connect() {
+	if prod.IsStopping() {
+		return // ### return, shutting down ###
+	}
+
+	token := prod.client.Connect()
+	if err := components.WaitMQTTToken(token, 0); err != nil {
+		prod.Logger.WithError(err).Error("Failed to connect to ", prod.Client.GetAddress())
+		time.AfterFunc(prod.GetShutdownTimeout()*10, prod.connect)
+	}
+}
+
+func (prod *MQTT) close() {
+	defer prod.WorkerDone()
+	prod.DefaultClose()
+
+	if prod.client.IsConnected() {
+		prod.client.Disconnect(uint(prod.GetShutdownTimeout() / time.Millisecond))
+	}
+}
+
+// Produce connects to the broker and publishes messages
+func (prod *MQTT) Produce(workers *sync.WaitGroup) {
+	prod.client = mqtt.NewClient(prod.Client.GetClientOptions())
+	prod.connect()
+
+	prod.AddMainWorker(workers)
+	prod.MessageControlLoop(prod.publish)
+}
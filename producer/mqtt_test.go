@@ -0,0 +1,96 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/components"
+	"github.com/trivago/gollum/core/components/mqtttest"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestMQTTTopic(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	prod := newTestPlugin(expect, "producer.MQTT", "mqttTopic", map[string]interface{}{
+		"Topic": "car/*/${sensor}",
+	}).(*MQTT)
+
+	msg := core.NewMessage(nil, []byte("3000"), core.Metadata{"sensor": []byte("rpm")}, core.GetStreamID("engine"))
+	expect.Equal("car/engine/rpm", expandTopicTemplate(prod.topic, msg))
+
+	msg = core.NewMessage(nil, []byte("3000"), nil, core.GetStreamID("engine"))
+	expect.Equal("car/engine/", expandTopicTemplate(prod.topic, msg))
+
+	prod = newTestPlugin(expect, "producer.MQTT", "mqttTopicDefault", map[string]interface{}{}).(*MQTT)
+	expect.Equal("gollum/engine", expandTopicTemplate(prod.topic, msg))
+}
+
+func TestMQTTInvalidQoS(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	_, err := tryNewTestPlugin("producer.MQTT", "mqttInvalidQoS", map[string]interface{}{
+		"QoS": 3,
+	})
+	expect.NotNil(err)
+}
+
+func TestMQTTPublish(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	broker := mqtttest.NewBroker(expect)
+	defer broker.Close()
+
+	for qos := 0; qos <= 2; qos++ {
+		prod := newTestPlugin(expect, "producer.MQTT", "mqttPublish"+string('0'+rune(qos)), map[string]interface{}{
+			"Address": broker.Address(),
+			"Topic":   "car/*/${sensor}",
+			"QoS":     qos,
+			"Retain":  true,
+		}).(*MQTT)
+
+		prod.client = mqtt.NewClient(prod.Client.GetClientOptions())
+		expect.NoError(components.WaitMQTTToken(prod.client.Connect(), time.Second))
+
+		msg := core.NewMessage(nil, []byte("data"+string('0'+rune(qos))), core.Metadata{"sensor": []byte("rpm")}, core.GetStreamID("engine"))
+		prod.publish(msg)
+		prod.client.Disconnect(0)
+	}
+
+	// The last message has been retained and is sent on subscribe
+	received := make(chan mqtt.Message, 1)
+	options := mqtt.NewClientOptions().AddBroker(broker.Address()).SetClientID("mqttSubscriber")
+	client := mqtt.NewClient(options)
+	expect.NoError(components.WaitMQTTToken(client.Connect(), time.Second))
+	defer client.Disconnect(0)
+
+	token := client.Subscribe("car/+/rpm", 0, func(_ mqtt.Client, msg mqtt.Message) {
+		received <- msg
+	})
+	expect.NoError(components.WaitMQTTToken(token, time.Second))
+
+	select {
+	case msg := <-received:
+		expect.Equal("car/engine/rpm", msg.Topic())
+		expect.Equal("data2", string(msg.Payload()))
+		expect.True(msg.Retained())
+	case <-time.After(time.Second):
+		t.Error("Retained message not received")
+	}
+}
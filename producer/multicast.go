@@ -0,0 +1,232 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/components"
+	"github.com/trivago/tgo/tnet"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// Multicast producer plugin
+//
+// The multicast producer sends messages as UDP datagrams to a multicast group
+// or a broadcast address. It is the counterpart of consumer.Multicast and
+// allows several receivers to get the same data without a server in between.
+//
+// If Framing is set to "sequence", a header containing a sender id and a
+// sequence number is prepended to each datagram. Messages larger than
+// MaxDatagramSize are split into several datagrams which are reassembled by
+// consumer.Multicast.
+//
+// Parameters
+//
+// - Address: Defines the multicast group or broadcast address to send to.
+// By default this parameter is set to "239.255.0.1:5880".
+//
+// - Interface: Defines the name of the network interface used for sending
+// multicast datagrams. If empty, the system default is used.
+// By default this parameter is set to "".
+//
+// - TTL: Defines the number of hops multicast datagrams may pass. A value of 1
+// keeps the datagrams inside the local network.
+// By default this parameter is set to 1.
+//
+// - Loopback: If set to true, multicast datagrams are delivered to receivers
+// on the sending host, too.
+// By default this parameter is set to true.
+//
+// - Framing: Set to "sequence" to prepend the header read by
+// consumer.Multicast or to "none" to send messages as-is. Messages larger than
+// MaxDatagramSize are passed to the fallback if Framing is "none".
+// By default this parameter is set to "sequence".
+//
+// - MaxDatagramSize: Defines the maximum size of a datagram in bytes including
+// the header. The default fits into a standard ethernet frame.
+// By default this parameter is set to 1400.
+//
+// Examples
+//
+// This example sends live telemetry to all pit laptops listening to the
+// multicast group.
+//
+//  TelemetryOut:
+//    Type: producer.Multicast
+//    Streams: telemetry
+//    Address: "239.255.0.1:5880"
+//    Interface: wlan0
+//    TTL: 1
+//
+type Multicast struct {
+	core.BufferedProducer `gollumdoc:"embed_type"`
+	address               string `config:"Address" default:"239.255.0.1:5880"`
+	interfaceName         string `config:"Interface"`
+	ttl                   int    `config:"TTL" default:"1"`
+	loopback              bool   `config:"Loopback" default:"true"`
+	framing               string `config:"Framing" default:"sequence"`
+	maxDatagramSize       int    `config:"MaxDatagramSize" default:"1400"`
+	udpAddress            *net.UDPAddr
+	networkInterface      *net.Interface
+	conn                  *net.UDPConn
+	sender                uint32
+	sequence              uint64
+}
+
+func init() {
+	core.TypeRegistry.Register(Multicast{})
+}
+
+// Configure initializes this producer with values from a plugin config.
+func (prod *Multicast) Configure(conf core.PluginConfigReader) {
+	prod.SetStopCallback(prod.close)
+
+	switch prod.framing {
+	case "sequence", "none":
+	default:
+		conf.Errors.Pushf("Unknown framing '%s'", prod.framing)
+	}
+
+	if prod.maxDatagramSize <= components.DatagramHeaderSize {
+		conf.Errors.Pushf("MaxDatagramSize must be larger than %d", components.DatagramHeaderSize)
+	}
+
+	_, address := tnet.ParseAddress(prod.address, "udp")
+	udpAddress, err := net.ResolveUDPAddr("udp", address)
+	if conf.Errors.Push(err) {
+		return
+	}
+	prod.udpAddress = udpAddress
+
+	if prod.interfaceName != "" {
+		prod.networkInterface, err = net.InterfaceByName(prod.interfaceName)
+		conf.Errors.Push(err)
+	}
+
+	// A random sender id allows receivers to detect restarts
+	prod.sender = rand.New(rand.NewSource(time.Now().UnixNano())).Uint32()
+}
+
+func (prod *Multicast) connect() error {
+	if prod.conn != nil {
+		return nil // ### return, already connected ###
+	}
+
+	conn, err := net.DialUDP("udp", nil, prod.udpAddress)
+	if err != nil {
+		return err
+	}
+
+	if prod.udpAddress.IP.IsMulticast() {
+		if prod.udpAddress.IP.To4() != nil {
+			err = prod.setIPv4Options(ipv4.NewPacketConn(conn))
+		} else {
+			err = prod.setIPv6Options(ipv6.NewPacketConn(conn))
+		}
+		if err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	prod.conn = conn
+	return nil
+}
+
+func (prod *Multicast) setIPv4Options(conn *ipv4.PacketConn) error {
+	if err := conn.SetMulticastTTL(prod.ttl); err != nil {
+		return err
+	}
+	if err := conn.SetMulticastLoopback(prod.loopback); err != nil {
+		return err
+	}
+	if prod.networkInterface != nil {
+		return conn.SetMulticastInterface(prod.networkInterface)
+	}
+	return nil
+}
+
+func (prod *Multicast) setIPv6Options(conn *ipv6.PacketConn) error {
+	if err := conn.SetMulticastHopLimit(prod.ttl); err != nil {
+		return err
+	}
+	if err := conn.SetMulticastLoopback(prod.loopback); err != nil {
+		return err
+	}
+	if prod.networkInterface != nil {
+		return conn.SetMulticastInterface(prod.networkInterface)
+	}
+	return nil
+}
+
+func (prod *Multicast) send(msg *core.Message) {
+	payload := msg.GetPayload()
+
+	var datagrams [][]byte
+	if prod.framing == "none" {
+		if len(payload) > prod.maxDatagramSize {
+			prod.Logger.Warningf("Message of %d bytes exceeds MaxDatagramSize", len(payload))
+			prod.TryFallback(msg)
+			return // ### return, too large ###
+		}
+		datagrams = [][]byte{payload}
+	} else {
+		var err error
+		if datagrams, err = components.NewDatagrams(prod.sender, prod.sequence, payload, prod.maxDatagramSize); err != nil {
+			prod.Logger.WithError(err).Warning("Failed to split message")
+			prod.TryFallback(msg)
+			return // ### return, too large ###
+		}
+		prod.sequence++
+	}
+
+	if err := prod.connect(); err != nil {
+		prod.Logger.WithError(err).Error("Failed to connect to ", prod.address)
+		prod.TryFallback(msg)
+		return // ### return, no connection ###
+	}
+
+	for _, datagram := range datagrams {
+		if _, err := prod.conn.Write(datagram); err != nil {
+			prod.Logger.WithError(err).Error("Failed to send to ", prod.address)
+			prod.conn.Close()
+			prod.conn = nil
+			prod.TryFallback(msg)
+			return // ### return, write failed ###
+		}
+	}
+	msg.Release()
+}
+
+func (prod *Multicast) close() {
+	defer prod.WorkerDone()
+	prod.DefaultClose()
+
+	if prod.conn != nil {
+		prod.conn.Close()
+	}
+}
+
+// Produce sends messages as datagrams
+func (prod *Multicast) Produce(workers *sync.WaitGroup) {
+	prod.AddMainWorker(workers)
+	prod.MessageControlLoop(prod.send)
+}
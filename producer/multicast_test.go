@@ -0,0 +1,70 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/components"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestMulticastChunking(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	listener, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	expect.NoError(err)
+	defer listener.Close()
+
+	prod := newTestPlugin(expect, "producer.Multicast", "multicastChunking", map[string]interface{}{
+		"Address":         listener.LocalAddr().String(),
+		"MaxDatagramSize": components.DatagramHeaderSize + 4,
+	}).(*Multicast)
+
+	prod.send(core.NewMessage(nil, []byte("0123456789"), nil, core.InvalidStreamID))
+	prod.send(core.NewMessage(nil, []byte("next"), nil, core.InvalidStreamID))
+	if !expect.NotNil(prod.conn) {
+		return
+	}
+	defer prod.conn.Close()
+
+	assembler := components.NewDatagramAssembler(time.Second)
+	buffer := make([]byte, 1500)
+	messages := []string{}
+
+	for len(messages) < 2 {
+		listener.SetReadDeadline(time.Now().Add(time.Second))
+		size, err := listener.Read(buffer)
+		if !expect.NoError(err) {
+			return
+		}
+
+		header, chunk, err := components.ParseDatagram(buffer[:size])
+		expect.NoError(err)
+		expect.Equal(prod.sender, header.Sender)
+
+		if payload, gap, complete := assembler.Add(header, chunk); complete {
+			expect.Equal(uint64(len(messages)), header.Sequence)
+			expect.Equal(uint64(0), gap)
+			messages = append(messages, string(payload))
+		}
+	}
+
+	expect.Equal("0123456789", messages[0])
+	expect.Equal("next", messages[1])
+}
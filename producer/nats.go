@@ -0,0 +1,176 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/components"
+)
+
+// NATS producer
+//
+// This producer publishes messages to a NATS server. The subject of each
+// message is generated from a template that may contain the name of the
+// stream and metadata values of the message. Metadata can be sent as NATS
+// message headers which requires NATS server 2.2 or later.
+//
+// Parameters
+//
+// - Subject: Defines the subject template to publish to. A "*" is replaced by
+// the name of the stream the message is sent on. Placeholders in the form of
+// "${key}" are replaced by the value of the metadata field "key".
+// By default this parameter is set to "gollum.*".
+//
+// - Headers: Defines the metadata fields sent as message headers. If this is
+// empty, all metadata fields are sent. Set "SendHeaders" to false to disable
+// headers.
+// By default this parameter is set to an empty list.
+//
+// - SendHeaders: When set to true, metadata fields are sent as headers.
+// By default this parameter is set to true.
+//
+// - JetStream: When set to true, messages are published via JetStream and the
+// producer waits for the server to acknowledge that the message has been
+// stored. Messages that are not acknowledged are sent to the fallback stream.
+// A JetStream stream has to be configured for the subjects used.
+// By default this parameter is set to false.
+//
+// - TimeoutMs: Defines the maximum time to wait for a JetStream
+// acknowledgement.
+// By default this parameter is set to 5000.
+//
+// Examples
+//
+// This example publishes messages to a subject per sensor and waits for
+// JetStream to store them.
+//
+//  NatsOut:
+//    Type: producer.NATS
+//    Streams: sensors
+//    Address: "nats://pit-laptop:4222"
+//    Subject: "car.*.${sensor}"
+//    JetStream: true
+//    Headers:
+//      - sensor
+//
+type NATS struct {
+	core.BufferedProducer `gollumdoc:"embed_type"`
+	Client                components.NATSClient `gollumdoc:"embed_type"`
+	subject               string                `config:"Subject" default:"gollum.*"`
+	headers               []string              `config:"Headers"`
+	sendHeaders           bool                  `config:"SendHeaders" default:"true"`
+	jetStream             bool                  `config:"JetStream" default:"false"`
+	timeout               time.Duration         `config:"TimeoutMs" default:"5000" metric:"ms"`
+	conn                  *nats.Conn
+	js                    nats.JetStreamContext
+	lastConnect           time.Time
+}
+
+func init() {
+	core.TypeRegistry.Register(NATS{})
+}
+
+// Configure initializes this producer with values from a plugin config.
+func (prod *NATS) Configure(conf core.PluginConfigReader) {
+	prod.SetStopCallback(prod.close)
+}
+
+func (prod *NATS) newMsg(msg *core.Message) *nats.Msg {
+	natsMsg := &nats.Msg{
+		Subject: expandTopicTemplate(prod.subject, msg),
+		Data:    msg.GetPayload(),
+	}
+	if prod.sendHeaders {
+		natsMsg.Header = components.MetadataToNATSHeader(msg.TryGetMetadata(), prod.headers)
+	}
+	return natsMsg
+}
+
+func (prod *NATS) publish(msg *core.Message) {
+	if prod.conn == nil {
+		prod.TryFallback(msg)
+		return // ### return, not connected ###
+	}
+
+	natsMsg := prod.newMsg(msg)
+
+	var err error
+	if prod.jetStream {
+		_, err = prod.js.PublishMsg(natsMsg, nats.AckWait(prod.timeout))
+	} else {
+		err = prod.conn.PublishMsg(natsMsg)
+	}
+
+	if err != nil {
+		prod.Logger.WithError(err).Errorf("Failed to publish to %s", natsMsg.Subject)
+		prod.TryFallback(msg)
+		return // ### return, not published ###
+	}
+	msg.Release()
+}
+
+func (prod *NATS) connect() error {
+	if time.Since(prod.lastConnect) < prod.Client.GetReconnectDelay() {
+		return nil // ### return, wait before retrying ###
+	}
+	prod.lastConnect = time.Now()
+
+	conn, err := prod.Client.Connect(prod.Logger)
+	if err != nil {
+		return err
+	}
+
+	if prod.jetStream {
+		if prod.js, err = conn.JetStream(); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	prod.conn = conn
+	prod.Logger.Debug("Connected to ", conn.ConnectedUrl())
+	return nil
+}
+
+func (prod *NATS) close() {
+	defer prod.WorkerDone()
+	prod.DefaultClose()
+
+	if prod.conn != nil {
+		prod.conn.Flush()
+		prod.conn.Close()
+	}
+}
+
+// Produce connects to the server and publishes messages
+func (prod *NATS) Produce(workers *sync.WaitGroup) {
+	if err := prod.connect(); err != nil {
+		prod.Logger.WithError(err).Error("Failed to connect to ", prod.Client.GetAddress())
+	}
+
+	prod.AddMainWorker(workers)
+	prod.MessageControlLoop(func(msg *core.Message) {
+		if prod.conn == nil {
+			if err := prod.connect(); err != nil {
+				prod.Logger.WithError(err).Error("Failed to connect to ", prod.Client.GetAddress())
+			}
+		}
+		prod.publish(msg)
+	})
+}
@@ -0,0 +1,216 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/tgo/ttesting"
+)
+
+// natsTestServer is a minimal NATS server supporting headers. Published
+// messages are sent to a channel. Requests are answered with a JetStream
+// acknowledgement.
+type natsTestServer struct {
+	listener  net.Listener
+	published chan *nats.Msg
+}
+
+type natsTestConn struct {
+	conn  net.Conn
+	guard sync.Mutex
+	subs  map[string]string // sid -> subject
+}
+
+func newNATSTestServer(expect ttesting.Expect) *natsTestServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	expect.NoError(err)
+
+	server := &natsTestServer{
+		listener:  listener,
+		published: make(chan *nats.Msg, 16),
+	}
+	go server.accept()
+	return server
+}
+
+func (server *natsTestServer) address() string {
+	return "nats://" + server.listener.Addr().String()
+}
+
+func (server *natsTestServer) accept() {
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+		go server.serve(&natsTestConn{conn: conn, subs: make(map[string]string)})
+	}
+}
+
+func (conn *natsTestConn) write(data string) {
+	conn.guard.Lock()
+	defer conn.guard.Unlock()
+	conn.conn.Write([]byte(data))
+}
+
+// reply sends data to the subscription matching the given inbox
+func (conn *natsTestConn) reply(inbox string, data string) {
+	conn.guard.Lock()
+	defer conn.guard.Unlock()
+	for sid, subject := range conn.subs {
+		if subject == inbox || (strings.HasSuffix(subject, ".*") && strings.HasPrefix(inbox, strings.TrimSuffix(subject, "*"))) {
+			fmt.Fprintf(conn.conn, "MSG %s %s %d\r\n%s\r\n", inbox, sid, len(data), data)
+		}
+	}
+}
+
+func (server *natsTestServer) serve(conn *natsTestConn) {
+	defer conn.conn.Close()
+	conn.write(`INFO {"server_id":"test","version":"2.2.0","proto":1,"headers":true,"max_payload":1048576}` + "\r\n")
+
+	reader := bufio.NewReader(conn.conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+
+		switch strings.ToUpper(args[0]) {
+		case "PING":
+			conn.write("PONG\r\n")
+
+		case "SUB":
+			conn.guard.Lock()
+			conn.subs[args[len(args)-1]] = args[1]
+			conn.guard.Unlock()
+
+		case "PUB", "HPUB":
+			headerSize := 0
+			if args[0] == "HPUB" {
+				headerSize, _ = strconv.Atoi(args[len(args)-2])
+			}
+			totalSize, _ := strconv.Atoi(args[len(args)-1])
+			data := make([]byte, totalSize+2)
+			if _, err := io.ReadFull(reader, data); err != nil {
+				return
+			}
+
+			msg := &nats.Msg{
+				Subject: args[1],
+				Data:    data[headerSize:totalSize],
+				Header:  nats.Header{},
+			}
+			for _, header := range strings.Split(string(data[:headerSize]), "\r\n")[1:] {
+				if keyValue := strings.SplitN(header, ":", 2); len(keyValue) == 2 {
+					msg.Header.Add(keyValue[0], strings.TrimSpace(keyValue[1]))
+				}
+			}
+
+			hasReply := len(args) == 4 && args[0] == "PUB" || len(args) == 5
+			switch {
+			case hasReply && strings.HasPrefix(msg.Subject, "$JS.API."):
+				conn.reply(args[2], `{"type":"io.nats.jetstream.api.v1.account_info_response"}`)
+			case hasReply:
+				conn.reply(args[2], `{"stream":"TELEMETRY","seq":1}`)
+				server.published <- msg
+			default:
+				server.published <- msg
+			}
+		}
+	}
+}
+
+func (server *natsTestServer) close() {
+	server.listener.Close()
+}
+
+func newNATSTestProducer(expect ttesting.Expect, server *natsTestServer, id string, settings map[string]interface{}) *NATS {
+	prod := newTestPlugin(expect, "producer.NATS", id, map[string]interface{}{
+		"Address": server.address(),
+	}, settings).(*NATS)
+	expect.NoError(prod.connect())
+	return prod
+}
+
+func receiveNATSTestMsg(t *testing.T, server *natsTestServer) *nats.Msg {
+	select {
+	case msg := <-server.published:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("Message not published")
+		return nil
+	}
+}
+
+func TestNATSPublish(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	server := newNATSTestServer(expect)
+	defer server.close()
+
+	prod := newNATSTestProducer(expect, server, "natsPublish", map[string]interface{}{
+		"Subject": "car.*.${sensor}",
+	})
+	defer prod.conn.Close()
+
+	prod.publish(core.NewMessage(nil, []byte("3000"), core.Metadata{"sensor": []byte("rpm")}, core.GetStreamID("engine")))
+	expect.NoError(prod.conn.Flush())
+
+	msg := receiveNATSTestMsg(t, server)
+	expect.Equal("car.engine.rpm", msg.Subject)
+	expect.Equal("3000", string(msg.Data))
+	expect.Equal("rpm", msg.Header.Get("sensor"))
+
+	prod.publish(core.NewMessage(nil, []byte("3000"), nil, core.GetStreamID("engine")))
+	expect.NoError(prod.conn.Flush())
+
+	msg = receiveNATSTestMsg(t, server)
+	expect.Equal("car.engine.", msg.Subject)
+	expect.Equal(0, len(msg.Header))
+}
+
+func TestNATSPublishJetStream(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	server := newNATSTestServer(expect)
+	defer server.close()
+
+	prod := newNATSTestProducer(expect, server, "natsJetStream", map[string]interface{}{
+		"Subject":   "car.*",
+		"JetStream": true,
+		"Headers":   []string{"lap"},
+	})
+	defer prod.conn.Close()
+
+	prod.publish(core.NewMessage(nil, []byte("3000"), core.Metadata{"sensor": []byte("rpm"), "lap": []byte("12")}, core.GetStreamID("engine")))
+
+	msg := receiveNATSTestMsg(t, server)
+	expect.Equal("car.engine", msg.Subject)
+	expect.Equal("12", msg.Header.Get("lap"))
+	expect.Equal("", msg.Header.Get("sensor"))
+}
@@ -0,0 +1,407 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/components"
+	"github.com/trivago/gollum/core/otlp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	otlpModeAuto    = "auto"
+	otlpModeLogs    = "logs"
+	otlpModeMetrics = "metrics"
+)
+
+// OTLP producer
+//
+// This producer exports messages as OpenTelemetry logs or metrics via OTLP
+// over gRPC or HTTP. Messages are sent in batches. If a batch can not be
+// exported, all of its messages are sent to the fallback stream.
+//
+// Messages exported as logs use the payload as body and the message creation
+// time as timestamp. Messages exported as metrics are sent as gauge data
+// points, using the payload as value.
+//
+// Parameters
+//
+// - Protocol: Defines the OTLP transport to use. Can be "grpc" or "http".
+// By default this parameter is set to "grpc".
+//
+// - Address: Defines the address of the OTLP receiver. When using HTTP this
+// is the base URL, the paths "/v1/logs" and "/v1/metrics" are appended.
+// By default this parameter is set to "localhost:4317" for gRPC and to
+// "http://localhost:4318" for HTTP.
+//
+// - Mode: Defines how messages are exported. When set to "logs", all messages
+// are exported as log records. When set to "metrics", all messages are
+// exported as metric data points and messages with a non-numeric payload are
+// sent to the fallback. When set to "auto", messages with a numeric payload
+// are exported as metrics, all other messages as logs.
+// By default this parameter is set to "auto".
+//
+// - MetricName: Defines the name of exported metrics. A "*" is replaced by
+// the name of the stream of the message. Placeholders in the form of
+// "${key}" are replaced by the value of the metadata field "key".
+// By default this parameter is set to "*".
+//
+// - Attributes: Defines a list of metadata keys exported as attributes.
+// If this list is empty, all metadata fields are exported.
+// By default this parameter is set to an empty list.
+//
+// - SeverityFrom: Defines the metadata key to read the severity of log records
+// from. Common names like "info", "warning" or "error" are mapped to the
+// matching OTLP severity number.
+// By default this parameter is set to "severity".
+//
+// - Resource: Defines a map of resource attributes sent with each batch.
+// By default this parameter is set to an empty map.
+//
+// - ScopeName: Defines the name of the instrumentation scope.
+// By default this parameter is set to "gollum".
+//
+// - TimeoutMs: Defines the maximum time to wait for an export to finish.
+// By default this parameter is set to 10000.
+//
+// Examples
+//
+// This example exports all messages to a local OpenTelemetry collector.
+//
+//  OtlpOut:
+//    Type: producer.OTLP
+//    Streams: "*"
+//    Protocol: http
+//    Address: "http://collector:4318"
+//    Resource:
+//      service.name: gollum
+//      host.name: car-19
+//
+type OTLP struct {
+	core.BatchedProducer `gollumdoc:"embed_type"`
+	TLS                  components.TLSConfig `gollumdoc:"embed_type"`
+	protocol             string               `config:"Protocol" default:"grpc"`
+	mode                 string               `config:"Mode" default:"auto"`
+	metricName           string               `config:"MetricName" default:"*"`
+	attributes           []string             `config:"Attributes"`
+	severityFrom         string               `config:"SeverityFrom" default:"severity"`
+	scopeName            string               `config:"ScopeName" default:"gollum"`
+	timeout              time.Duration        `config:"TimeoutMs" default:"10000" metric:"ms"`
+	address              string
+	resource             *otlp.Resource
+	conn                 *grpc.ClientConn
+	client               http.Client
+}
+
+func init() {
+	core.TypeRegistry.Register(OTLP{})
+}
+
+// Configure initializes this producer with values from a plugin config.
+func (prod *OTLP) Configure(conf core.PluginConfigReader) {
+	prod.SetStopCallback(prod.close)
+
+	prod.protocol = strings.ToLower(prod.protocol)
+	switch prod.protocol {
+	case "grpc":
+		prod.address = conf.GetString("Address", "localhost:4317")
+	case "http":
+		prod.address = strings.TrimSuffix(conf.GetString("Address", "http://localhost:4318"), "/")
+		prod.client.Timeout = prod.timeout
+		if tlsConfig := prod.TLS.GetConfig(); tlsConfig != nil {
+			prod.client.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+		}
+	default:
+		conf.Errors.Pushf("Unknown protocol '%s'", prod.protocol)
+	}
+
+	prod.mode = strings.ToLower(prod.mode)
+	switch prod.mode {
+	case otlpModeAuto, otlpModeLogs, otlpModeMetrics:
+	default:
+		conf.Errors.Pushf("Unknown mode '%s'", prod.mode)
+	}
+
+	resource := conf.GetStringMap("Resource", map[string]string{})
+	prod.resource = &otlp.Resource{
+		Attributes: make([]*otlp.KeyValue, 0, len(resource)),
+	}
+	for key, value := range resource {
+		prod.resource.Attributes = append(prod.resource.Attributes, &otlp.KeyValue{
+			Key:   key,
+			Value: otlp.NewAnyValue(value),
+		})
+	}
+}
+
+func (prod *OTLP) dial() error {
+	if prod.protocol != "grpc" {
+		return nil // ### return, no connection required ###
+	}
+
+	var options []grpc.DialOption
+	if tlsConfig := prod.TLS.GetConfig(); tlsConfig != nil {
+		options = append(options, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	} else {
+		options = append(options, grpc.WithInsecure())
+	}
+
+	conn, err := grpc.Dial(prod.address, options...)
+	if err != nil {
+		return err
+	}
+	prod.conn = conn
+	return nil
+}
+
+// parseMetricValue returns the payload as numeric data point value
+func parseMetricValue(payload []byte, point *otlp.NumberDataPoint) bool {
+	value := strings.TrimSpace(string(payload))
+	if intValue, err := strconv.ParseInt(value, 10, 64); err == nil {
+		point.Value = &otlp.NumberDataPoint_AsInt{AsInt: intValue}
+		return true
+	}
+	if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+		point.Value = &otlp.NumberDataPoint_AsDouble{AsDouble: floatValue}
+		return true
+	}
+	return false
+}
+
+func (prod *OTLP) getAttributes(msg *core.Message) []*otlp.KeyValue {
+	metadata := msg.TryGetMetadata()
+	if metadata == nil {
+		return nil
+	}
+	return otlp.MetadataToAttributes(metadata, prod.attributes)
+}
+
+func (prod *OTLP) newLogRecord(msg *core.Message) *otlp.LogRecord {
+	record := &otlp.LogRecord{
+		TimeUnixNano:         uint64(msg.GetCreationTime().UnixNano()),
+		ObservedTimeUnixNano: uint64(time.Now().UnixNano()),
+		Body:                 otlp.NewAnyValue(msg.String()),
+		Attributes:           prod.getAttributes(msg),
+	}
+
+	if metadata := msg.TryGetMetadata(); metadata != nil {
+		if severity, isSet := metadata.TryGetValueString(prod.severityFrom); isSet {
+			record.SeverityText = severity
+			record.SeverityNumber = otlp.ParseSeverity(severity)
+		}
+	}
+	return record
+}
+
+// newNumberDataPoint returns the message as data point or nil if the
+// payload is not numeric.
+func (prod *OTLP) newNumberDataPoint(msg *core.Message) *otlp.NumberDataPoint {
+	point := &otlp.NumberDataPoint{
+		TimeUnixNano: uint64(msg.GetCreationTime().UnixNano()),
+		Attributes:   prod.getAttributes(msg),
+	}
+	if !parseMetricValue(msg.GetPayload(), point) {
+		return nil
+	}
+	return point
+}
+
+func (prod *OTLP) export(messages []*core.Message) {
+	var (
+		logMessages    []*core.Message
+		metricMessages []*core.Message
+		records        []*otlp.LogRecord
+		metrics        []*otlp.Metric
+	)
+	metricsByName := make(map[string]*otlp.Metric)
+
+	for _, msg := range messages {
+		if prod.mode != otlpModeLogs {
+			if point := prod.newNumberDataPoint(msg); point != nil {
+				name := expandTopicTemplate(prod.metricName, msg)
+				metric, exists := metricsByName[name]
+				if !exists {
+					metric = &otlp.Metric{
+						Name: name,
+						Data: &otlp.Metric_Gauge{Gauge: &otlp.Gauge{}},
+					}
+					metricsByName[name] = metric
+					metrics = append(metrics, metric)
+				}
+				gauge := metric.GetGauge()
+				gauge.DataPoints = append(gauge.DataPoints, point)
+				metricMessages = append(metricMessages, msg)
+				continue
+			}
+
+			if prod.mode == otlpModeMetrics {
+				prod.Logger.Warningf("Payload of message from stream %s is not numeric", msg.GetStreamID().GetName())
+				prod.TryFallback(msg)
+				continue
+			}
+		}
+
+		records = append(records, prod.newLogRecord(msg))
+		logMessages = append(logMessages, msg)
+	}
+
+	if len(records) > 0 {
+		request := &otlp.ExportLogsServiceRequest{
+			ResourceLogs: []*otlp.ResourceLogs{{
+				Resource: prod.resource,
+				ScopeLogs: []*otlp.ScopeLogs{{
+					Scope:      &otlp.InstrumentationScope{Name: prod.scopeName},
+					LogRecords: records,
+				}},
+			}},
+		}
+		if err := prod.exportLogs(request); err != nil {
+			prod.Logger.WithError(err).Error("Failed to export logs")
+			prod.TryFallbackAll(logMessages)
+		} else {
+			for _, msg := range logMessages {
+				msg.Release()
+			}
+		}
+	}
+
+	if len(metrics) > 0 {
+		request := &otlp.ExportMetricsServiceRequest{
+			ResourceMetrics: []*otlp.ResourceMetrics{{
+				Resource: prod.resource,
+				ScopeMetrics: []*otlp.ScopeMetrics{{
+					Scope:   &otlp.InstrumentationScope{Name: prod.scopeName},
+					Metrics: metrics,
+				}},
+			}},
+		}
+		if err := prod.exportMetrics(request); err != nil {
+			prod.Logger.WithError(err).Error("Failed to export metrics")
+			prod.TryFallbackAll(metricMessages)
+		} else {
+			for _, msg := range metricMessages {
+				msg.Release()
+			}
+		}
+	}
+}
+
+func (prod *OTLP) exportLogs(request *otlp.ExportLogsServiceRequest) error {
+	response := new(otlp.ExportLogsServiceResponse)
+	if prod.protocol == "http" {
+		if err := prod.post("/v1/logs", request, response); err != nil {
+			return err
+		}
+	} else {
+		if prod.conn == nil {
+			return fmt.Errorf("No connection to %s", prod.address)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), prod.timeout)
+		defer cancel()
+
+		var err error
+		if response, err = otlp.NewLogsServiceClient(prod.conn).Export(ctx, request); err != nil {
+			return err
+		}
+	}
+
+	if partial := response.GetPartialSuccess(); partial.GetRejectedLogRecords() > 0 {
+		prod.Logger.Warningf("%d log records were rejected: %s", partial.GetRejectedLogRecords(), partial.GetErrorMessage())
+	}
+	return nil
+}
+
+func (prod *OTLP) exportMetrics(request *otlp.ExportMetricsServiceRequest) error {
+	response := new(otlp.ExportMetricsServiceResponse)
+	if prod.protocol == "http" {
+		if err := prod.post("/v1/metrics", request, response); err != nil {
+			return err
+		}
+	} else {
+		if prod.conn == nil {
+			return fmt.Errorf("No connection to %s", prod.address)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), prod.timeout)
+		defer cancel()
+
+		var err error
+		if response, err = otlp.NewMetricsServiceClient(prod.conn).Export(ctx, request); err != nil {
+			return err
+		}
+	}
+
+	if partial := response.GetPartialSuccess(); partial.GetRejectedDataPoints() > 0 {
+		prod.Logger.Warningf("%d data points were rejected: %s", partial.GetRejectedDataPoints(), partial.GetErrorMessage())
+	}
+	return nil
+}
+
+// post sends an OTLP/HTTP request using binary protobuf encoding
+func (prod *OTLP) post(path string, request proto.Message, response proto.Message) error {
+	data, err := proto.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	resp, err := prod.client.Post(prod.address+path, "application/x-protobuf", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", prod.address+path, resp.Status)
+	}
+
+	// The response body is optional, so decoding errors are ignored
+	proto.Unmarshal(body, response)
+	return nil
+}
+
+func (prod *OTLP) close() {
+	defer prod.WorkerDone()
+	prod.Batch.Close(prod.export, prod.GetShutdownTimeout())
+
+	if prod.conn != nil {
+		prod.conn.Close()
+	}
+}
+
+// Produce exports messages in batches
+func (prod *OTLP) Produce(workers *sync.WaitGroup) {
+	if err := prod.dial(); err != nil {
+		prod.Logger.WithError(err).Errorf("Failed to create connection to %s", prod.address)
+	}
+
+	prod.BatchMessageLoop(workers, func() core.AssemblyFunc { return prod.export })
+}
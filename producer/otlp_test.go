@@ -0,0 +1,131 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/otlp"
+	"github.com/trivago/tgo/ttesting"
+	"google.golang.org/grpc"
+)
+
+type otlpTestMetricsService struct {
+	requests []*otlp.ExportMetricsServiceRequest
+}
+
+func (service *otlpTestMetricsService) Export(ctx context.Context, req *otlp.ExportMetricsServiceRequest) (*otlp.ExportMetricsServiceResponse, error) {
+	service.requests = append(service.requests, req)
+	return &otlp.ExportMetricsServiceResponse{}, nil
+}
+
+func TestOTLPExportHTTP(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	logs := new(otlp.ExportLogsServiceRequest)
+	metrics := new(otlp.ExportMetricsServiceRequest)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expect.Equal("application/x-protobuf", r.Header.Get("Content-Type"))
+		body, _ := ioutil.ReadAll(r.Body)
+
+		switch r.URL.Path {
+		case "/v1/logs":
+			expect.NoError(proto.Unmarshal(body, logs))
+		case "/v1/metrics":
+			expect.NoError(proto.Unmarshal(body, metrics))
+		default:
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	prod := newTestPlugin(expect, "producer.OTLP", "otlpExportHTTP", map[string]interface{}{
+		"Protocol":   "http",
+		"Address":    server.URL + "/",
+		"MetricName": "car.${signal}",
+		"Resource":   map[string]string{"service.name": "telemetry"},
+	}).(*OTLP)
+
+	streamID := core.GetStreamID("engine")
+	prod.export([]*core.Message{
+		core.NewMessage(nil, []byte("3000"), core.Metadata{"signal": []byte("rpm")}, streamID),
+		core.NewMessage(nil, []byte("92.5\n"), core.Metadata{"signal": []byte("oil_temp")}, streamID),
+		core.NewMessage(nil, []byte("3500"), core.Metadata{"signal": []byte("rpm")}, streamID),
+		core.NewMessage(nil, []byte("oil temperature high"), core.Metadata{"severity": []byte("warning")}, streamID),
+	})
+
+	expect.Equal(1, len(logs.GetResourceLogs()))
+	resource := logs.GetResourceLogs()[0]
+	expect.Equal("service.name", resource.GetResource().GetAttributes()[0].GetKey())
+	expect.Equal("gollum", resource.GetScopeLogs()[0].GetScope().GetName())
+
+	records := resource.GetScopeLogs()[0].GetLogRecords()
+	expect.Equal(1, len(records))
+	expect.Equal("oil temperature high", records[0].GetBody().GetStringValue())
+	expect.Equal("warning", records[0].GetSeverityText())
+	expect.Equal(otlp.SeverityNumber_SEVERITY_NUMBER_WARN, records[0].GetSeverityNumber())
+
+	expect.Equal(1, len(metrics.GetResourceMetrics()))
+	metricList := metrics.GetResourceMetrics()[0].GetScopeMetrics()[0].GetMetrics()
+	expect.Equal(2, len(metricList))
+	expect.Equal("car.rpm", metricList[0].GetName())
+	expect.Equal(2, len(metricList[0].GetGauge().GetDataPoints()))
+	expect.Equal(int64(3500), metricList[0].GetGauge().GetDataPoints()[1].GetAsInt())
+	expect.Equal("car.oil_temp", metricList[1].GetName())
+	expect.Equal(92.5, metricList[1].GetGauge().GetDataPoints()[0].GetAsDouble())
+
+	attributes := metricList[1].GetGauge().GetDataPoints()[0].GetAttributes()
+	expect.Equal(1, len(attributes))
+	expect.Equal("oil_temp", attributes[0].GetValue().GetStringValue())
+}
+
+func TestOTLPExportGRPC(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	expect.NoError(err)
+
+	service := new(otlpTestMetricsService)
+	server := grpc.NewServer()
+	otlp.RegisterMetricsServiceServer(server, service)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	prod := newTestPlugin(expect, "producer.OTLP", "otlpExportGRPC", map[string]interface{}{
+		"Address": listener.Addr().String(),
+		"Mode":    "metrics",
+	}).(*OTLP)
+	expect.NoError(prod.dial())
+	defer prod.conn.Close()
+
+	prod.export([]*core.Message{
+		core.NewMessage(nil, []byte("3000"), nil, core.GetStreamID("rpm")),
+		core.NewMessage(nil, []byte("not a number"), nil, core.GetStreamID("rpm")),
+	})
+
+	expect.Equal(1, len(service.requests))
+	metricList := service.requests[0].GetResourceMetrics()[0].GetScopeMetrics()[0].GetMetrics()
+	expect.Equal(1, len(metricList))
+	expect.Equal("rpm", metricList[0].GetName())
+	expect.Equal(int64(3000), metricList[0].GetGauge().GetDataPoints()[0].GetAsInt())
+}
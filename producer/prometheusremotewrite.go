@@ -0,0 +1,501 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/components"
+	"github.com/trivago/gollum/core/prompb"
+)
+
+// PrometheusRemoteWrite producer
+//
+// This producer converts messages to Prometheus samples and sends them in
+// batches to an endpoint implementing the Prometheus remote write protocol,
+// e.g. Prometheus itself, Thanos, Cortex, Mimir or VictoriaMetrics.
+// Requests are sent as snappy compressed protobuf. Messages that do not
+// contain any numeric value or that could not be sent are passed to the
+// fallback stream.
+//
+// Each sample is labeled with the name of the stream the message is coming
+// from and with metadata values. The message creation time is used as sample
+// timestamp.
+//
+// Parameters
+//
+// - URL: Defines the remote write endpoint to send samples to.
+// By default this parameter is set to "http://localhost:9090/api/v1/write".
+//
+// - Source: Defines where sample values are read from. When set to "json",
+// the payload is parsed as JSON object and each numeric field is converted to
+// a sample. Payloads consisting of a single number are converted to a single
+// sample. When set to "metadata", each numeric metadata field is converted to
+// a sample.
+// By default this parameter is set to "json".
+//
+// - Fields: Defines the list of JSON or metadata fields to convert to samples.
+// If this list is empty, all numeric fields are converted.
+// By default this parameter is set to an empty list.
+//
+// - MetricName: Defines the metric name prefix. A "*" is replaced by the name
+// of the stream of the message. Placeholders in the form of "${key}" are
+// replaced by the value of the metadata field "key". The name of the field a
+// value has been read from is appended, separated by "_". Characters not valid
+// in Prometheus metric names are replaced by "_".
+// By default this parameter is set to "*".
+//
+// - Labels: Defines the list of metadata fields to use as labels. If this
+// list is empty, all metadata fields not used as sample values are used.
+// Fields starting with "__" are reserved by Prometheus and skipped. A field
+// named like the stream label is renamed to "exported_<name>".
+// By default this parameter is set to an empty list.
+//
+// - StreamLabel: Defines the name of the label holding the stream name. Set
+// to "" to disable this label.
+// By default this parameter is set to "stream".
+//
+// - ExternalLabels: Defines a map of labels added to all samples. Labels
+// read from metadata take precedence.
+// By default this parameter is set to an empty map.
+//
+// - BearerToken: Defines a token sent in the Authorization header.
+// By default this parameter is set to "".
+//
+// - Username: Defines the user name for HTTP basic authentication. Basic
+// authentication is only used if this parameter is set.
+// By default this parameter is set to "".
+//
+// - Password: Defines the password for HTTP basic authentication.
+// By default this parameter is set to "".
+//
+// - RetryCount: Defines how often a request is retried after a connection
+// error, a server error or rate limiting. Other errors are not retried.
+// By default this parameter is set to 3.
+//
+// - RetryDelayMs: Defines the delay before the first retry. The delay is
+// doubled for each consecutive retry.
+// By default this parameter is set to 500.
+//
+// - RetryMaxDelayMs: Defines the maximum delay between two retries.
+// By default this parameter is set to 10000.
+//
+// - TimeoutMs: Defines the timeout for a single request.
+// By default this parameter is set to 10000.
+//
+// Examples
+//
+// This example sends the numeric fields of JSON telemetry messages to
+// Prometheus. A message {"rpm":3000} on the stream "engine" results in the
+// sample engine_rpm{stream="engine",car="19"} 3000.
+//
+//  PrometheusOut:
+//    Type: producer.PrometheusRemoteWrite
+//    Streams: engine
+//    URL: "http://prometheus:9090/api/v1/write"
+//    Labels:
+//      - car
+//    Batch:
+//      MaxCount: 8192
+//      FlushCount: 1024
+//      TimeoutSec: 5
+//
+type PrometheusRemoteWrite struct {
+	core.BatchedProducer `gollumdoc:"embed_type"`
+	TLS                  components.TLSConfig `gollumdoc:"embed_type"`
+	url                  string               `config:"URL" default:"http://localhost:9090/api/v1/write"`
+	source               string               `config:"Source" default:"json"`
+	fields               []string             `config:"Fields"`
+	metricName           string               `config:"MetricName" default:"*"`
+	labels               []string             `config:"Labels"`
+	streamLabel          string               `config:"StreamLabel" default:"stream"`
+	bearerToken          string               `config:"BearerToken"`
+	username             string               `config:"Username"`
+	password             string               `config:"Password"`
+	retryCount           int                  `config:"RetryCount" default:"3"`
+	retryDelay           time.Duration        `config:"RetryDelayMs" default:"500" metric:"ms"`
+	retryMaxDelay        time.Duration        `config:"RetryMaxDelayMs" default:"10000" metric:"ms"`
+	timeout              time.Duration        `config:"TimeoutMs" default:"10000" metric:"ms"`
+	externalLabels       map[string]string
+	client               http.Client
+}
+
+// prometheusRetryError is returned by post if a request failed but may
+// succeed when being retried.
+type prometheusRetryError struct {
+	err        error
+	retryAfter time.Duration
+}
+
+func (err prometheusRetryError) Error() string {
+	return err.err.Error()
+}
+
+// prometheusSample is a single value read from a message
+type prometheusSample struct {
+	field string
+	value float64
+}
+
+func init() {
+	core.TypeRegistry.Register(PrometheusRemoteWrite{})
+}
+
+// Configure initializes this producer with values from a plugin config.
+func (prod *PrometheusRemoteWrite) Configure(conf core.PluginConfigReader) {
+	prod.SetStopCallback(prod.close)
+
+	prod.source = strings.ToLower(prod.source)
+	if prod.source != "json" && prod.source != "metadata" {
+		conf.Errors.Pushf("Unknown source '%s'", prod.source)
+	}
+
+	prod.externalLabels = conf.GetStringMap("ExternalLabels", map[string]string{})
+	prod.client.Timeout = prod.timeout
+	if tlsConfig := prod.TLS.GetConfig(); tlsConfig != nil {
+		prod.client.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+	}
+}
+
+// sanitizePrometheusName replaces all characters not valid in a metric or
+// label name with "_". Colons are only kept if allowColon is set.
+func sanitizePrometheusName(name string, allowColon bool) string {
+	sanitized := []byte(name)
+	for i, char := range sanitized {
+		switch {
+		case char >= 'a' && char <= 'z', char >= 'A' && char <= 'Z', char == '_':
+		case char >= '0' && char <= '9' && i > 0:
+		case char == ':' && allowColon:
+		default:
+			sanitized[i] = '_'
+		}
+	}
+	return string(sanitized)
+}
+
+// getSamples returns all numeric values of the given message
+func (prod *PrometheusRemoteWrite) getSamples(msg *core.Message) []prometheusSample {
+	if prod.source == "metadata" {
+		metadata := msg.TryGetMetadata()
+		if metadata == nil {
+			return nil
+		}
+
+		fields := prod.fields
+		if len(fields) == 0 {
+			fields = make([]string, 0, len(metadata))
+			for key := range metadata {
+				fields = append(fields, key)
+			}
+			sort.Strings(fields)
+		}
+
+		samples := make([]prometheusSample, 0, len(fields))
+		for _, field := range fields {
+			if value, isNumeric := metadata.TryGetFloat(field); isNumeric {
+				samples = append(samples, prometheusSample{field, value})
+			}
+		}
+		return samples
+	}
+
+	document, err := msg.GetDocument()
+	if err != nil {
+		value, err := strconv.ParseFloat(strings.TrimSpace(msg.String()), 64)
+		if err != nil {
+			return nil
+		}
+		return []prometheusSample{{"", value}}
+	}
+
+	fields := prod.fields
+	if len(fields) == 0 {
+		fields = make([]string, 0, len(document))
+		for key := range document {
+			fields = append(fields, key)
+		}
+		sort.Strings(fields)
+	}
+
+	samples := make([]prometheusSample, 0, len(fields))
+	for _, field := range fields {
+		if value, isNumeric := document[field].(float64); isNumeric {
+			samples = append(samples, prometheusSample{field, value})
+		}
+	}
+	return samples
+}
+
+// getLabels returns the labels of the given message without the metric name.
+// Fields used as sample values are not used as labels.
+func (prod *PrometheusRemoteWrite) getLabels(msg *core.Message, samples []prometheusSample) map[string]string {
+	labels := make(map[string]string, len(prod.externalLabels)+len(prod.labels)+1)
+	for name, value := range prod.externalLabels {
+		if labelName, valid := prod.getLabelName(name); valid {
+			labels[labelName] = value
+		}
+	}
+
+	if metadata := msg.TryGetMetadata(); metadata != nil {
+		keys := prod.labels
+		if len(keys) == 0 {
+			keys = make([]string, 0, len(metadata))
+			for key, value := range metadata {
+				if _, isMap := value.(core.Metadata); !isMap {
+					keys = append(keys, key)
+				}
+			}
+			if prod.source == "metadata" {
+				isValue := make(map[string]bool, len(samples))
+				for _, sample := range samples {
+					isValue[sample.field] = true
+				}
+				filtered := keys[:0]
+				for _, key := range keys {
+					if !isValue[key] {
+						filtered = append(filtered, key)
+					}
+				}
+				keys = filtered
+			}
+		}
+
+		for _, key := range keys {
+			if value := metadata.GetValueString(key); value != "" {
+				if labelName, valid := prod.getLabelName(key); valid {
+					labels[labelName] = value
+				}
+			}
+		}
+	}
+
+	if prod.streamLabel != "" {
+		labels[prod.streamLabel] = msg.GetStreamID().GetName()
+	}
+	return labels
+}
+
+// getLabelName returns the label name used for the given metadata field or
+// external label. Names reserved by Prometheus (starting with "__") are not
+// valid. A name equal to the stream label is prefixed by "exported_" in the
+// same way Prometheus handles conflicting labels.
+func (prod *PrometheusRemoteWrite) getLabelName(key string) (string, bool) {
+	name := sanitizePrometheusName(key, false)
+	switch {
+	case strings.HasPrefix(name, "__"):
+		return "", false
+	case prod.streamLabel != "" && name == prod.streamLabel:
+		return "exported_" + name, true
+	default:
+		return name, true
+	}
+}
+
+// newWriteRequest converts the given messages to a write request. Messages
+// that do not contain any numeric value are returned as rejected, all other
+// messages are returned as accepted.
+func (prod *PrometheusRemoteWrite) newWriteRequest(messages []*core.Message) (request *prompb.WriteRequest, accepted []*core.Message, rejected []*core.Message) {
+	var series []*prompb.TimeSeries
+	seriesByKey := make(map[string]*prompb.TimeSeries)
+
+	for _, msg := range messages {
+		samples := prod.getSamples(msg)
+		if len(samples) == 0 {
+			rejected = append(rejected, msg)
+			continue
+		}
+		accepted = append(accepted, msg)
+
+		labels := prod.getLabels(msg, samples)
+		labelNames := make([]string, 0, len(labels)+1)
+		for name := range labels {
+			labelNames = append(labelNames, name)
+		}
+		labelNames = append(labelNames, "__name__")
+		sort.Strings(labelNames)
+
+		prefix := sanitizePrometheusName(expandTopicTemplate(prod.metricName, msg), true)
+		timestamp := msg.GetCreationTime().UnixNano() / int64(time.Millisecond)
+
+		for _, sample := range samples {
+			name := prefix
+			switch {
+			case sample.field == "":
+			case name == "":
+				name = sanitizePrometheusName(sample.field, true)
+			default:
+				name += "_" + sanitizePrometheusName(sample.field, true)
+			}
+
+			labels["__name__"] = name
+
+			key := bytes.NewBuffer(nil)
+			seriesLabels := make([]*prompb.Label, len(labelNames))
+			for i, labelName := range labelNames {
+				seriesLabels[i] = &prompb.Label{Name: labelName, Value: labels[labelName]}
+				key.WriteString(labelName)
+				key.WriteByte(0)
+				key.WriteString(labels[labelName])
+				key.WriteByte(0)
+			}
+
+			timeSeries, exists := seriesByKey[key.String()]
+			if !exists {
+				timeSeries = &prompb.TimeSeries{Labels: seriesLabels}
+				seriesByKey[key.String()] = timeSeries
+				series = append(series, timeSeries)
+			}
+			timeSeries.Samples = append(timeSeries.Samples, &prompb.Sample{
+				Value:     sample.value,
+				Timestamp: timestamp,
+			})
+		}
+	}
+
+	// Samples of a series have to be sent in chronological order
+	for _, timeSeries := range series {
+		samples := timeSeries.Samples
+		sort.SliceStable(samples, func(i, j int) bool {
+			return samples[i].Timestamp < samples[j].Timestamp
+		})
+	}
+
+	return &prompb.WriteRequest{Timeseries: series}, accepted, rejected
+}
+
+func (prod *PrometheusRemoteWrite) post(body []byte) error {
+	request, err := http.NewRequest(http.MethodPost, prod.url, bytes.NewReader(body))
+	if err != nil {
+		return err // ### return, invalid request ###
+	}
+
+	request.Header.Set("Content-Type", "application/x-protobuf")
+	request.Header.Set("Content-Encoding", "snappy")
+	request.Header.Set("User-Agent", "gollum/"+core.GetVersionString())
+	request.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	switch {
+	case prod.bearerToken != "":
+		request.Header.Set("Authorization", "Bearer "+prod.bearerToken)
+	case prod.username != "":
+		request.SetBasicAuth(prod.username, prod.password)
+	}
+
+	response, err := prod.client.Do(request)
+	if err != nil {
+		return prometheusRetryError{err: err} // ### return, failed to connect ###
+	}
+
+	defer response.Body.Close()
+	responseBody, _ := ioutil.ReadAll(response.Body)
+
+	switch {
+	case response.StatusCode >= 200 && response.StatusCode <= 299:
+		return nil // ### return, OK ###
+
+	case response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500:
+		retryErr := prometheusRetryError{
+			err: fmt.Errorf("%s returned %s: %s", prod.url, response.Status, string(responseBody)),
+		}
+		if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil {
+			retryErr.retryAfter = time.Duration(seconds) * time.Second
+		}
+		return retryErr
+
+	default:
+		// Client errors like out of order samples will not succeed when retried
+		return fmt.Errorf("%s returned %s: %s", prod.url, response.Status, string(responseBody))
+	}
+}
+
+// write sends the given request. Requests that failed because of connection
+// problems, server errors or rate limiting are retried with an exponential
+// backoff bounded by RetryMaxDelayMs.
+func (prod *PrometheusRemoteWrite) write(request *prompb.WriteRequest) error {
+	data, err := proto.Marshal(request)
+	if err != nil {
+		return err
+	}
+	body := snappy.Encode(nil, data)
+
+	delay := prod.retryDelay
+	for retry := 0; ; retry++ {
+		err := prod.post(body)
+		if err == nil {
+			return nil // ### return, OK ###
+		}
+
+		retryErr, canRetry := err.(prometheusRetryError)
+		if !canRetry || retry >= prod.retryCount || !prod.IsActiveOrStopping() {
+			return err // ### return, failed ###
+		}
+
+		wait := delay
+		if retryErr.retryAfter > wait {
+			wait = retryErr.retryAfter
+		}
+		if wait > prod.retryMaxDelay {
+			wait = prod.retryMaxDelay
+		}
+
+		prod.Logger.WithError(err).Warningf("Remote write failed, retrying in %s", wait)
+		time.Sleep(wait)
+		delay *= 2
+	}
+}
+
+func (prod *PrometheusRemoteWrite) send(messages []*core.Message) {
+	request, accepted, rejected := prod.newWriteRequest(messages)
+	for _, msg := range rejected {
+		prod.Logger.Warningf("Message from stream %s does not contain numeric values", msg.GetStreamID().GetName())
+		prod.TryFallback(msg)
+	}
+
+	if len(request.Timeseries) == 0 {
+		return // ### return, nothing to send ###
+	}
+
+	if err := prod.write(request); err != nil {
+		prod.Logger.WithError(err).Error("Failed to send samples")
+		for _, msg := range accepted {
+			prod.TryFallback(msg)
+		}
+		return // ### return, not sent ###
+	}
+
+	for _, msg := range accepted {
+		msg.Release()
+	}
+}
+
+func (prod *PrometheusRemoteWrite) close() {
+	defer prod.WorkerDone()
+	prod.Batch.Close(prod.send, prod.GetShutdownTimeout())
+}
+
+// Produce sends messages in batches
+func (prod *PrometheusRemoteWrite) Produce(workers *sync.WaitGroup) {
+	prod.BatchMessageLoop(workers, func() core.AssemblyFunc { return prod.send })
+}
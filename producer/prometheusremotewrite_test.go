@@ -0,0 +1,165 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/prompb"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func getPrometheusTestLabels(series *prompb.TimeSeries) map[string]string {
+	labels := make(map[string]string)
+	for _, label := range series.GetLabels() {
+		labels[label.GetName()] = label.GetValue()
+	}
+	return labels
+}
+
+func TestPrometheusRemoteWriteJSON(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	prod := newTestPlugin(expect, "producer.PrometheusRemoteWrite", "prometheusJSON", map[string]interface{}{
+		"ExternalLabels": map[string]string{"team": "lr", "car": "unknown"},
+	}).(*PrometheusRemoteWrite)
+
+	streamID := core.GetStreamID("engine.front")
+	first := core.NewMessage(nil, []byte(`{"rpm":3000,"oil temp":92.5,"gear":"3"}`), core.Metadata{"car": []byte("19")}, streamID)
+	second := core.NewMessage(nil, []byte(`{"rpm":3500}`), core.Metadata{"car": []byte("19")}, streamID)
+	plain := core.NewMessage(nil, []byte("12.5\n"), nil, core.GetStreamID("fuel"))
+	invalid := core.NewMessage(nil, []byte("pit stop"), nil, streamID)
+
+	request, accepted, rejected := prod.newWriteRequest([]*core.Message{first, second, plain, invalid})
+	expect.Equal(3, len(accepted))
+	expect.Equal(1, len(rejected))
+	expect.Equal(invalid, rejected[0])
+
+	series := request.GetTimeseries()
+	expect.Equal(3, len(series))
+
+	// Fields are sorted by name, labels are sorted by name
+	expect.Equal("__name__", series[0].GetLabels()[0].GetName())
+	expect.Equal(map[string]string{
+		"__name__": "engine_front_oil_temp",
+		"car":      "19",
+		"stream":   "engine.front",
+		"team":     "lr",
+	}, getPrometheusTestLabels(series[0]))
+	expect.Equal(92.5, series[0].GetSamples()[0].GetValue())
+	expect.Equal(first.GetCreationTime().UnixNano()/int64(time.Millisecond), series[0].GetSamples()[0].GetTimestamp())
+
+	expect.Equal("engine_front_rpm", getPrometheusTestLabels(series[1])["__name__"])
+	expect.Equal(2, len(series[1].GetSamples()))
+	expect.Equal(3500.0, series[1].GetSamples()[1].GetValue())
+
+	expect.Equal("fuel", getPrometheusTestLabels(series[2])["__name__"])
+	expect.Equal("unknown", getPrometheusTestLabels(series[2])["car"])
+	expect.Equal(12.5, series[2].GetSamples()[0].GetValue())
+}
+
+func TestPrometheusRemoteWriteMetadata(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	prod := newTestPlugin(expect, "producer.PrometheusRemoteWrite", "prometheusMetadata", map[string]interface{}{
+		"Source":      "metadata",
+		"MetricName":  "car",
+		"StreamLabel": "",
+	}).(*PrometheusRemoteWrite)
+
+	msg := core.NewMessage(nil, []byte("ignored"), core.Metadata{
+		"speed":  81.5,
+		"lap":    int64(3),
+		"driver": []byte("lr"),
+	}, core.GetStreamID("telemetry"))
+
+	request, _, rejected := prod.newWriteRequest([]*core.Message{msg})
+	expect.Equal(0, len(rejected))
+
+	series := request.GetTimeseries()
+	expect.Equal(2, len(series))
+	expect.Equal(map[string]string{"__name__": "car_lap", "driver": "lr"}, getPrometheusTestLabels(series[0]))
+	expect.Equal(3.0, series[0].GetSamples()[0].GetValue())
+	expect.Equal(map[string]string{"__name__": "car_speed", "driver": "lr"}, getPrometheusTestLabels(series[1]))
+}
+
+func TestPrometheusRemoteWriteLabelCollisions(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	prod := newTestPlugin(expect, "producer.PrometheusRemoteWrite", "prometheusCollisions", map[string]interface{}{
+		"ExternalLabels": map[string]string{"__tenant__": "lr"},
+	}).(*PrometheusRemoteWrite)
+
+	msg := core.NewMessage(nil, []byte("3000"), core.Metadata{
+		"__name__": []byte("evil"),
+		"stream":   []byte("can0"),
+	}, core.GetStreamID("engine"))
+
+	request, _, _ := prod.newWriteRequest([]*core.Message{msg})
+	series := request.GetTimeseries()
+	expect.Equal(1, len(series))
+	expect.Equal(3, len(series[0].GetLabels()))
+	expect.Equal(map[string]string{
+		"__name__":        "engine",
+		"exported_stream": "can0",
+		"stream":          "engine",
+	}, getPrometheusTestLabels(series[0]))
+}
+
+func TestPrometheusRemoteWriteSend(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	requests := 0
+	received := new(prompb.WriteRequest)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		expect.Equal("snappy", r.Header.Get("Content-Encoding"))
+		expect.Equal("application/x-protobuf", r.Header.Get("Content-Type"))
+		expect.Equal("0.1.0", r.Header.Get("X-Prometheus-Remote-Write-Version"))
+		expect.Equal("Bearer secret", r.Header.Get("Authorization"))
+
+		compressed, _ := ioutil.ReadAll(r.Body)
+		data, err := snappy.Decode(nil, compressed)
+		expect.NoError(err)
+		expect.NoError(proto.Unmarshal(data, received))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	prod := newTestPlugin(expect, "producer.PrometheusRemoteWrite", "prometheusSend", map[string]interface{}{
+		"URL":          server.URL,
+		"BearerToken":  "secret",
+		"RetryDelayMs": 1,
+	}).(*PrometheusRemoteWrite)
+
+	request, _, _ := prod.newWriteRequest([]*core.Message{
+		core.NewMessage(nil, []byte(`{"rpm":3000}`), nil, core.GetStreamID("engine")),
+	})
+	expect.NoError(prod.write(request))
+	expect.Equal(2, requests)
+	expect.True(proto.Equal(request, received))
+}
@@ -16,6 +16,7 @@ package producer
 
 import (
 	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/components"
 	"github.com/trivago/tgo/tio"
 	"github.com/trivago/tgo/tnet"
 	"github.com/trivago/tgo/tstrings"
@@ -31,6 +32,7 @@ import (
 // Responses to messages sent to the given address are sent back to the original
 // consumer of it is a compatible message source. As with consumer.proxy the
 // returned messages are partitioned by common message length algorithms.
+// Connections can be secured by TLS.
 //
 // Parameters
 //
@@ -86,8 +88,21 @@ import (
 //    Partitioner: binary
 //    Size: 8
 //
+// This example does the same using TLS with a client certificate.
+//
+//  proxyTlsOut:
+//    Type: producer.Proxy
+//    Address: "pit.example.com:5880"
+//    Partitioner: binary
+//    Size: 8
+//    TlsEnable: true
+//    TlsCertificateLocation: /etc/gollum/car.crt
+//    TlsKeyLocation: /etc/gollum/car.key
+//    TlsCaLocation: /etc/gollum/pit-ca.pem
+//
 type Proxy struct {
 	core.BufferedProducer `gollumdoc:"embed_type"`
+	TLS                   components.TLSConfig `gollumdoc:"embed_type"`
 	connection            net.Conn
 	protocol              string
 	address               string
@@ -151,15 +166,24 @@ func (prod *Proxy) Configure(conf core.PluginConfigReader) {
 }
 
 func (prod *Proxy) sendMessage(msg *core.Message) {
+	// Messages are not passed to the fallback by this producer
+	defer msg.Release()
+
 	// If we have not yet connected or the connection sent to the fallback: connect.
 	for prod.connection == nil {
 		conn, err := net.DialTimeout(prod.protocol, prod.address, prod.timeout)
 
+		if err == nil {
+			if bufConn, isBuffered := conn.(bufferedConn); isBuffered {
+				bufConn.SetWriteBuffer(prod.bufferSizeKB << 10)
+			}
+			conn, err = prod.TLS.Client(conn, prod.address, prod.timeout)
+		}
+
 		if err != nil {
 			prod.Logger.Error("Connection error - ", err)
 			<-time.After(time.Second)
 		} else {
-			conn.(bufferedConn).SetWriteBuffer(prod.bufferSizeKB << 10)
 			prod.connection = conn
 		}
 	}
@@ -15,6 +15,7 @@
 package producer
 
 import (
+	"encoding/json"
 	"github.com/go-redis/redis"
 	"github.com/trivago/gollum/core"
 	"github.com/trivago/tgo/tnet"
@@ -39,20 +40,41 @@ import (
 // - Database: Defines the redis database to connect to.
 //
 // - Key: Defines the redis key to store the values in.
-// This field is ignored when "KeyFormatter" is set.
+// This field is used when "KeyFrom" is not set or the metadata field is empty.
+// When using "pubsub" storage this is the channel to publish to.
 // By default this is set to "default".
 //
 // - Storage: Defines the type of the storage to use. Valid values are: "hash",
-// "list", "set", "sortedset", "string". By default this is set to "hash".
+// "list", "set", "sortedset", "string", "stream" and "pubsub".
+// By default this is set to "hash".
 //
 // - KeyFrom: Defines the name of the metadata field used as a key for messages
-// sent to redis. If the name is an empty string no key is sent. By default
-// this value is set to an empty string.
+// sent to redis. If the name is an empty string or the metadata field is not
+// set, "Key" is used. By default this value is set to an empty string.
 //
 // - FieldFrom: Defines the name of the metadata field used as a field for messages
 // sent to redis. If the name is an empty string no key is sent. By default
 // this value is set to an empty string.
 //
+// - StreamFields: Defines how the fields of a redis stream entry are created
+// when using "stream" storage. Valid values are "payload", "json" and
+// "metadata". "payload" stores the payload in the field set by "PayloadField".
+// "json" stores each top level field of a JSON payload as a separate field.
+// "metadata" stores all metadata fields and the payload in "PayloadField".
+// By default this is set to "payload".
+//
+// - PayloadField: Defines the name of the stream entry field used to store
+// the payload when "StreamFields" is set to "payload" or "metadata".
+// By default this is set to "payload".
+//
+// - MaxLen: Defines the maximum number of entries a redis stream is trimmed
+// to when adding entries. If set to 0 the stream is not trimmed.
+// By default this is set to 0.
+//
+// - MaxLenApprox: When set to true, streams are trimmed to approximately
+// "MaxLen" entries which is much more efficient.
+// By default this is set to true.
+//
 // Examples
 //
 // .
@@ -63,6 +85,17 @@ import (
 //     Key: "mykey"
 //     Storage: "hash"
 //
+// This example adds JSON messages to a redis stream holding about 100000
+// entries, e.g. to buffer data until it is read by a consumer.Redis.
+//
+//   RedisStream:
+//     Type: producer.Redis
+//     Address: ":6379"
+//     Key: "telemetry"
+//     Storage: "stream"
+//     StreamFields: "json"
+//     MaxLen: 100000
+//
 type Redis struct {
 	core.BufferedProducer `gollumdoc:"embed_type"`
 	address               string
@@ -70,7 +103,12 @@ type Redis struct {
 	password              string `config:"Password"`
 	database              int    `config:"Database" default:"0"`
 	key                   string `config:"KeyFrom"`
+	defaultKey            string `config:"Key" default:"default"`
 	field                 string `config:"FieldFrom"`
+	payloadField          string `config:"PayloadField" default:"payload"`
+	maxLen                int64  `config:"MaxLen" default:"0"`
+	maxLenApprox          bool   `config:"MaxLenApprox" default:"true"`
+	streamFields          func(msg *core.Message) (map[string]interface{}, error)
 	client                *redis.Client
 	store                 func(msg *core.Message)
 }
@@ -94,23 +132,44 @@ func (prod *Redis) Configure(conf core.PluginConfigReader) {
 		prod.store = prod.storeSet
 	case "sortedset":
 		prod.store = prod.storeSortedSet
+	case "stream":
+		prod.store = prod.storeStream
+	case "pubsub":
+		prod.store = prod.storePublish
 	default:
 		fallthrough
 	case "string":
 		prod.store = prod.storeString
 	}
+
+	switch strings.ToLower(conf.GetString("StreamFields", "payload")) {
+	case "payload":
+		prod.streamFields = prod.getPayloadFields
+	case "json":
+		prod.streamFields = prod.getJSONFields
+	case "metadata":
+		prod.streamFields = prod.getMetadataFields
+	default:
+		conf.Errors.Pushf("StreamFields must be one of payload, json or metadata")
+	}
 }
 
-func (prod *Redis) getValueAndKey(msg *core.Message) (v, k []byte) {
-	meta := msg.GetMetadata()
-	key := meta.GetValue(prod.key)
+func (prod *Redis) getKey(msg *core.Message) []byte {
+	if prod.key != "" {
+		if key := msg.GetMetadata().GetValue(prod.key); len(key) > 0 {
+			return key
+		}
+	}
+	return []byte(prod.defaultKey)
+}
 
-	return msg.GetPayload(), key
+func (prod *Redis) getValueAndKey(msg *core.Message) (v, k []byte) {
+	return msg.GetPayload(), prod.getKey(msg)
 }
 
 func (prod *Redis) getValueFieldAndKey(msg *core.Message) (v, f, k []byte) {
 	meta := msg.GetMetadata()
-	key := meta.GetValue(prod.key)
+	key := prod.getKey(msg)
 	field := meta.GetValue(prod.field)
 
 	return msg.GetPayload(), field, key
@@ -122,7 +181,9 @@ func (prod *Redis) storeHash(msg *core.Message) {
 	if result.Err() != nil {
 		prod.Logger.Error("Redis: ", result.Err())
 		prod.TryFallback(msg)
+		return // ### return, not stored ###
 	}
+	msg.Release()
 }
 
 func (prod *Redis) storeList(msg *core.Message) {
@@ -132,7 +193,9 @@ func (prod *Redis) storeList(msg *core.Message) {
 	if result.Err() != nil {
 		prod.Logger.Error("Redis: ", result.Err())
 		prod.TryFallback(msg)
+		return // ### return, not stored ###
 	}
+	msg.Release()
 }
 
 func (prod *Redis) storeSet(msg *core.Message) {
@@ -142,7 +205,9 @@ func (prod *Redis) storeSet(msg *core.Message) {
 	if result.Err() != nil {
 		prod.Logger.Error("Redis: ", result.Err())
 		prod.TryFallback(msg)
+		return // ### return, not stored ###
 	}
+	msg.Release()
 }
 
 func (prod *Redis) storeSortedSet(msg *core.Message) {
@@ -150,6 +215,7 @@ func (prod *Redis) storeSortedSet(msg *core.Message) {
 	score, err := strconv.ParseFloat(string(scoreValue), 64)
 	if err != nil {
 		prod.Logger.Error("Redis: ", err)
+		core.DiscardMessage(msg, prod.GetID(), "No valid score")
 		return // ### return, no valid score ###
 	}
 
@@ -162,7 +228,9 @@ func (prod *Redis) storeSortedSet(msg *core.Message) {
 	if result.Err() != nil {
 		prod.Logger.Error("Redis: ", result.Err())
 		prod.TryFallback(msg)
+		return // ### return, not stored ###
 	}
+	msg.Release()
 }
 
 func (prod *Redis) storeString(msg *core.Message) {
@@ -172,7 +240,84 @@ func (prod *Redis) storeString(msg *core.Message) {
 	if result.Err() != nil {
 		prod.Logger.Error("Redis: ", result.Err())
 		prod.TryFallback(msg)
+		return // ### return, not stored ###
+	}
+	msg.Release()
+}
+
+func (prod *Redis) getPayloadFields(msg *core.Message) (map[string]interface{}, error) {
+	return map[string]interface{}{
+		prod.payloadField: msg.GetPayload(),
+	}, nil
+}
+
+func (prod *Redis) getJSONFields(msg *core.Message) (map[string]interface{}, error) {
+	document, err := msg.GetDocument()
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]interface{}, len(document))
+	for key, value := range document {
+		if stringValue, isString := value.(string); isString {
+			fields[key] = stringValue
+			continue
+		}
+		// Redis only stores strings so nested values are stored as JSON
+		if fields[key], err = json.Marshal(value); err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+func (prod *Redis) getMetadataFields(msg *core.Message) (map[string]interface{}, error) {
+	metadata := msg.TryGetMetadata()
+	fields := make(map[string]interface{}, len(metadata)+1)
+	for key := range metadata {
+		fields[key] = metadata.GetValue(key)
+	}
+	fields[prod.payloadField] = msg.GetPayload()
+	return fields, nil
+}
+
+func (prod *Redis) storeStream(msg *core.Message) {
+	fields, err := prod.streamFields(msg)
+	if err != nil {
+		prod.Logger.Error("Redis: ", err)
+		core.DiscardMessage(msg, prod.GetID(), "No valid fields")
+		return // ### return, no valid fields ###
+	}
+
+	args := &redis.XAddArgs{
+		Stream: string(prod.getKey(msg)),
+		Values: fields,
+	}
+	if prod.maxLenApprox {
+		args.MaxLenApprox = prod.maxLen
+	} else {
+		args.MaxLen = prod.maxLen
+	}
+
+	result := prod.client.XAdd(args)
+	if result.Err() != nil {
+		prod.Logger.Error("Redis: ", result.Err())
+		prod.TryFallback(msg)
+		return // ### return, not stored ###
+	}
+	msg.Release()
+}
+
+func (prod *Redis) storePublish(msg *core.Message) {
+	value, channel := prod.getValueAndKey(msg)
+
+	result := prod.client.Publish(string(channel), value)
+	if result.Err() != nil {
+		prod.Logger.Error("Redis: ", result.Err())
+		prod.TryFallback(msg)
+		return // ### return, not stored ###
 	}
+	msg.Release()
 }
 
 func (prod *Redis) close() {
@@ -0,0 +1,183 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-redis/redis"
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/tgo/ttesting"
+)
+
+// redisTestServer accepts redis commands and sends them to a channel. All
+// commands are answered with a reply matching their expected type.
+type redisTestServer struct {
+	listener net.Listener
+	commands chan []string
+}
+
+func newRedisTestServer(expect ttesting.Expect) *redisTestServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	expect.NoError(err)
+
+	server := &redisTestServer{
+		listener: listener,
+		commands: make(chan []string, 16),
+	}
+	go server.accept()
+	return server
+}
+
+func (server *redisTestServer) accept() {
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+		go server.serve(conn)
+	}
+}
+
+func (server *redisTestServer) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		numArgs, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+
+		command := make([]string, 0, numArgs)
+		for i := 0; i < numArgs; i++ {
+			line, err = reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			length, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+			arg := make([]byte, length+2)
+			if _, err := io.ReadFull(reader, arg); err != nil {
+				return
+			}
+			command = append(command, string(arg[:length]))
+		}
+
+		switch strings.ToLower(command[0]) {
+		case "xadd":
+			conn.Write([]byte("$3\r\n1-0\r\n"))
+		case "publish":
+			conn.Write([]byte(":1\r\n"))
+		default:
+			conn.Write([]byte("+OK\r\n"))
+		}
+		server.commands <- command
+	}
+}
+
+func (server *redisTestServer) close() {
+	server.listener.Close()
+}
+
+func newRedisTestProducer(expect ttesting.Expect, server *redisTestServer, id string, settings map[string]interface{}) *Redis {
+	prod := newTestPlugin(expect, "producer.Redis", id, settings).(*Redis)
+	prod.client = redis.NewClient(&redis.Options{Addr: server.listener.Addr().String()})
+	return prod
+}
+
+// getStreamFields returns the fields of an XADD command as map
+func getStreamFields(command []string, start int) map[string]string {
+	fields := make(map[string]string)
+	for i := start; i+1 < len(command); i += 2 {
+		fields[command[i]] = command[i+1]
+	}
+	return fields
+}
+
+func TestRedisStream(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	server := newRedisTestServer(expect)
+	defer server.close()
+
+	prod := newRedisTestProducer(expect, server, "redisStream", map[string]interface{}{
+		"Storage": "stream",
+		"Key":     "telemetry",
+		"MaxLen":  1000,
+	})
+
+	msg := core.NewMessage(nil, []byte("3000"), core.Metadata{"sensor": []byte("rpm")}, core.InvalidStreamID)
+	prod.store(msg)
+
+	command := <-server.commands
+	expect.Equal([]string{"xadd", "telemetry", "maxlen", "~", "1000", "*"}, command[:6])
+	expect.Equal(map[string]string{"payload": "3000"}, getStreamFields(command, 6))
+
+	prod = newRedisTestProducer(expect, server, "redisStreamJSON", map[string]interface{}{
+		"Storage":      "stream",
+		"KeyFrom":      "car",
+		"StreamFields": "json",
+		"MaxLen":       1000,
+		"MaxLenApprox": false,
+	})
+
+	msg = core.NewMessage(nil, []byte(`{"rpm":3000,"gear":"3","gps":{"lat":40.6}}`), core.Metadata{"car": []byte("lr19")}, core.InvalidStreamID)
+	prod.store(msg)
+
+	command = <-server.commands
+	expect.Equal([]string{"xadd", "lr19", "maxlen", "1000", "*"}, command[:5])
+	expect.Equal(map[string]string{"rpm": "3000", "gear": "3", "gps": `{"lat":40.6}`}, getStreamFields(command, 5))
+
+	prod = newRedisTestProducer(expect, server, "redisStreamMetadata", map[string]interface{}{
+		"Storage":      "stream",
+		"StreamFields": "metadata",
+		"PayloadField": "value",
+	})
+
+	msg = core.NewMessage(nil, []byte("3000"), core.Metadata{"sensor": []byte("rpm")}, core.InvalidStreamID)
+	prod.store(msg)
+
+	command = <-server.commands
+	expect.Equal([]string{"xadd", "default", "*"}, command[:3])
+	expect.Equal(map[string]string{"sensor": "rpm", "value": "3000"}, getStreamFields(command, 3))
+}
+
+func TestRedisPublish(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	server := newRedisTestServer(expect)
+	defer server.close()
+
+	prod := newRedisTestProducer(expect, server, "redisPublish", map[string]interface{}{
+		"Storage": "pubsub",
+		"Key":     "telemetry",
+	})
+
+	prod.store(core.NewMessage(nil, []byte("3000"), nil, core.InvalidStreamID))
+	expect.Equal([]string{"publish", "telemetry", "3000"}, <-server.commands)
+}
+
+func TestRedisInvalidStreamFields(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	_, err := tryNewTestPlugin("producer.Redis", "redisInvalidFields", map[string]interface{}{
+		"StreamFields": "xml",
+	})
+	expect.NotNil(err)
+}
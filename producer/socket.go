@@ -20,6 +20,7 @@ import (
 	"time"
 
 	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/components"
 	"github.com/trivago/tgo/tmath"
 	"github.com/trivago/tgo/tnet"
 )
@@ -27,7 +28,7 @@ import (
 // Socket producer plugin
 //
 // The socket producer connects to a service over TCP, UDP or a UNIX domain
-// socket.
+// socket. TCP and unix sockets can be secured by TLS.
 //
 // Parameters
 //
@@ -61,6 +62,10 @@ import (
 // server. After this timeout the send is marked as failed.
 // By default this parameter is set to "2000".
 //
+// - ConnectTimeoutMs: This value defines the time in milliseconds to wait for a connection
+// to be established. If TLS is enabled, the same timeout applies to the TLS handshake.
+// By default this parameter is set to "2000".
+//
 // Examples
 //
 // This example starts a socket producer on localhost port 5880:
@@ -74,14 +79,29 @@ import (
 //      TimeoutSec: 3
 //    AckTimeoutMs: 1000
 //
+// This example sends messages via TLS and authenticates with a client
+// certificate:
+//
+//  SocketTlsOut:
+//    Type: producer.Socket
+//    Address: "pit.example.com:5880"
+//    Acknowledge: "OK"
+//    TlsEnable: true
+//    TlsCertificateLocation: /etc/gollum/car.crt
+//    TlsKeyLocation: /etc/gollum/car.key
+//    TlsCaLocation: /etc/gollum/pit-ca.pem
+//    TlsMinVersion: "1.2"
+//
 type Socket struct {
 	core.BufferedProducer `gollumdoc:"embed_type"`
+	TLS                   components.TLSConfig `gollumdoc:"embed_type"`
 	connection            net.Conn
 	batch                 core.MessageBatch
 	assembly              core.WriterAssembly
 	protocol              string
 	address               string
 	ackTimeout            time.Duration `config:"AckTimeoutMs" default:"2000" metric:"ms"`
+	connectTimeout        time.Duration `config:"ConnectTimeoutMs" default:"2000" metric:"ms"`
 	bufferSizeByte        int           `config:"ConnectionBufferSizeKB" default:"1024" metric:"kb"`
 	acknowledge           string        `config:"Acknowledge"`
 	batchTimeout          time.Duration `config:"Batch/TimeoutSec" default:"5" metric:"sec"`
@@ -106,8 +126,8 @@ func (prod *Socket) Configure(conf core.PluginConfigReader) {
 
 	switch prod.protocol {
 	case "udp":
-		if prod.acknowledge != "" {
-			prod.Logger.Warning("Acknowledge is only supported for TCP connections. TCP connection forced.")
+		if prod.acknowledge != "" || prod.TLS.Enabled {
+			prod.Logger.Warning("Acknowledge and TLS are only supported for TCP connections. TCP connection forced.")
 			prod.protocol = "tcp"
 		}
 	case "unix", "tcp":
@@ -127,14 +147,22 @@ func (prod *Socket) tryConnect() bool {
 		return true // ### return, connection active ###
 	}
 
-	conn, err := net.DialTimeout(prod.protocol, prod.address, prod.ackTimeout)
+	conn, err := net.DialTimeout(prod.protocol, prod.address, prod.connectTimeout)
 	if err != nil {
 		prod.Logger.Error("Connection error: ", err)
 		prod.closeConnection()
 		return false // ### return, connection failed ###
 	}
 
-	conn.(bufferedConn).SetWriteBuffer(prod.bufferSizeByte)
+	if bufConn, isBuffered := conn.(bufferedConn); isBuffered {
+		bufConn.SetWriteBuffer(prod.bufferSizeByte)
+	}
+
+	if conn, err = prod.TLS.Client(conn, prod.address, prod.connectTimeout); err != nil {
+		prod.Logger.Error("TLS handshake error: ", err)
+		return false // ### return, handshake failed ###
+	}
+
 	prod.assembly.SetWriter(conn)
 	prod.connection = conn
 	return true
@@ -156,6 +156,7 @@ func (prod *Spooling) Modulate(msg *core.Message) core.ModulateResult {
 // TryFallback reverts the message stream before dropping
 func (prod *Spooling) TryFallback(msg *core.Message) {
 	if prod.revertOnDrop {
+		msg = msg.Detach()
 		msg.SetStreamID(msg.GetPrevStreamID())
 	}
 	prod.BufferedProducer.TryFallback(msg)
@@ -0,0 +1,206 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/tgo/ttesting"
+)
+
+// sqlTestDriver records all statements executed via database/sql
+type sqlTestDriver struct {
+	guard      sync.Mutex
+	statements []string
+	rows       [][]driver.Value
+	commits    int
+	rollbacks  int
+}
+
+type sqlTestConn struct {
+	driver *sqlTestDriver
+}
+
+type sqlTestStmt struct {
+	conn  *sqlTestConn
+	query string
+}
+
+var sqlTestRecorder = new(sqlTestDriver)
+
+func init() {
+	sql.Register("gollumtest", sqlTestRecorder)
+}
+
+func (drv *sqlTestDriver) reset() {
+	drv.guard.Lock()
+	defer drv.guard.Unlock()
+	drv.statements = nil
+	drv.rows = nil
+	drv.commits = 0
+	drv.rollbacks = 0
+}
+
+func (drv *sqlTestDriver) Open(name string) (driver.Conn, error) {
+	return &sqlTestConn{drv}, nil
+}
+
+func (conn *sqlTestConn) Prepare(query string) (driver.Stmt, error) {
+	return &sqlTestStmt{conn, query}, nil
+}
+
+func (conn *sqlTestConn) Close() error {
+	return nil
+}
+
+func (conn *sqlTestConn) Begin() (driver.Tx, error) {
+	return conn, nil
+}
+
+func (conn *sqlTestConn) Commit() error {
+	conn.driver.guard.Lock()
+	defer conn.driver.guard.Unlock()
+	conn.driver.commits++
+	return nil
+}
+
+func (conn *sqlTestConn) Rollback() error {
+	conn.driver.guard.Lock()
+	defer conn.driver.guard.Unlock()
+	conn.driver.rollbacks++
+	return nil
+}
+
+func (stmt *sqlTestStmt) Close() error {
+	return nil
+}
+
+func (stmt *sqlTestStmt) NumInput() int {
+	return -1
+}
+
+func (stmt *sqlTestStmt) Exec(args []driver.Value) (driver.Result, error) {
+	drv := stmt.conn.driver
+	drv.guard.Lock()
+	defer drv.guard.Unlock()
+
+	drv.statements = append(drv.statements, stmt.query)
+	for _, arg := range args {
+		if arg == "fail" {
+			return nil, fmt.Errorf("constraint violation")
+		}
+	}
+	if len(args) > 0 {
+		drv.rows = append(drv.rows, args)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (stmt *sqlTestStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+func newSQLTestProducer(expect ttesting.Expect, id string, settings map[string]interface{}) *SQL {
+	return newTestPlugin(expect, "producer.SQL", id, map[string]interface{}{
+		"Driver": "gollumtest",
+	}, settings).(*SQL)
+}
+
+func TestSQLWriteBatch(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	sqlTestRecorder.reset()
+
+	prod := newSQLTestProducer(expect, "sqlWriteBatch", map[string]interface{}{
+		"StreamColumn":    "stream",
+		"Columns":         map[string]string{"rpm": "rpm", "oil_temp": "oil/temperature", "gear": "gear"},
+		"MetadataColumns": map[string]string{"car": "car", "lap": "lap"},
+		"ColumnTypes":     map[string]string{"rpm": "INTEGER", "gear": "TEXT"},
+	})
+
+	engine := core.GetStreamID("engine")
+	first := core.NewMessage(nil, []byte(`{"rpm":3000,"oil":{"temperature":92.5},"gear":"3"}`),
+		core.Metadata{"car": []byte("19"), "lap": int64(3)}, engine)
+	second := core.NewMessage(nil, []byte(`{"rpm":3500}`), nil, engine)
+	invalid := core.NewMessage(nil, []byte("not json"), nil, engine)
+
+	prod.writeBatch([]*core.Message{first, invalid, second})
+
+	expect.Equal(`CREATE TABLE IF NOT EXISTS "engine" ("time" TIMESTAMP, "stream" TEXT, "gear" TEXT, "oil_temp" DOUBLE PRECISION, "rpm" INTEGER, "car" TEXT, "lap" TEXT)`,
+		sqlTestRecorder.statements[0])
+	expect.Equal(`INSERT INTO "engine" ("time", "stream", "gear", "oil_temp", "rpm", "car", "lap") VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		sqlTestRecorder.statements[1])
+
+	expect.Equal(2, len(sqlTestRecorder.rows))
+	expect.Equal(1, sqlTestRecorder.commits)
+
+	row := sqlTestRecorder.rows[0]
+	expect.Equal(first.GetCreationTime().UTC(), row[0].(time.Time))
+	expect.Equal("engine", row[1])
+	expect.Equal("3", row[2])
+	expect.Equal(92.5, row[3])
+	expect.Equal(3000.0, row[4])
+	expect.Equal("19", row[5])
+	expect.Equal(int64(3), row[6])
+
+	row = sqlTestRecorder.rows[1]
+	expect.Nil(row[2])
+	expect.Equal(3500.0, row[4])
+	expect.Nil(row[5])
+
+	// Tables are only created once
+	prod.writeBatch([]*core.Message{second})
+	expect.Equal(4, len(sqlTestRecorder.statements))
+	expect.Equal(2, sqlTestRecorder.commits)
+}
+
+func TestSQLWriteBatchFailed(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	sqlTestRecorder.reset()
+
+	prod := newSQLTestProducer(expect, "sqlWriteBatchFailed", map[string]interface{}{
+		"Table":        "${car}",
+		"TimeColumn":   "",
+		"CreateTables": false,
+		"Columns":      map[string]string{"state": "state"},
+	})
+
+	streamID := core.GetStreamID("state")
+	prod.writeBatch([]*core.Message{
+		core.NewMessage(nil, []byte(`{"state":"ok"}`), core.Metadata{"car": []byte("car19")}, streamID),
+		core.NewMessage(nil, []byte(`{"state":"fail"}`), core.Metadata{"car": []byte("car20")}, streamID),
+	})
+
+	expect.Equal(`INSERT INTO "car19" ("state") VALUES (?)`, sqlTestRecorder.statements[0])
+	expect.Equal(`INSERT INTO "car20" ("state") VALUES (?)`, sqlTestRecorder.statements[1])
+	expect.Equal(1, sqlTestRecorder.commits)
+	expect.Equal(1, sqlTestRecorder.rollbacks)
+}
+
+func TestSQLPostgresPlaceholders(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	prod := newTestPlugin(expect, "producer.SQL", "sqlPostgres", map[string]interface{}{
+		"Table":   `evil"table`,
+		"Columns": map[string]string{"rpm": "rpm"},
+	}).(*SQL)
+
+	expect.Equal(`INSERT INTO "evil""table" ("time", "rpm") VALUES ($1, $2)`, prod.getInsertStatement(`evil"table`))
+}
@@ -148,6 +148,7 @@ func (prod *StatsdMetrics) transformMessages(messages []*core.Message) {
 		} else {
 			metricValues[metricName] += int64(1)
 		}
+		msg.Release()
 	}
 
 	if prod.useGauge {
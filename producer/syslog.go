@@ -0,0 +1,329 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/components"
+	"github.com/trivago/tgo/tnet"
+)
+
+// Syslog producer plugin
+//
+// The syslog producer sends messages as RFC5424 formatted syslog messages over
+// UDP, TCP or TLS. Messages sent via TCP or TLS are framed using octet
+// counting as described in RFC6587. Header fields are taken from the metadata
+// set by consumer.Syslogd with SetMetadata enabled, so that received syslog
+// messages can be forwarded without changes.
+//
+// If the server cannot be reached, the producer reconnects in the given
+// interval and keeps the messages buffered in its channel. Messages that do
+// not fit into the channel are treated as configured by ChannelTimeoutMs.
+//
+// Metadata
+//
+// - severity: Read as severity of the message. This can be a number from 0 to 7
+// or a name like "err" or "warning". If not set, Severity is used.
+//
+// - facility: Read as facility of the message. This can be a number from 0 to
+// 23 or a name like "daemon" or "local0". If not set, Facility is used.
+//
+// - hostname: Read as hostname of the message. If not set, Hostname is used.
+//
+// - app_name: Read as application name of the message. If not set, the
+// RFC3164 field "tag" is used. If both are not set, AppName is used.
+//
+// - proc_id: Read as process id of the message.
+//
+// - msg_id: Read as message id of the message.
+//
+// - timestamp: Read as time of the message using TimestampFormat. If not set
+// or not parseable, the creation time of the message is used.
+//
+// Parameters
+//
+// - Address: Defines the address to send to in the form
+// "[udp|tcp]://<host>:<port>". If no protocol is given, udp is used.
+// TLS is enabled via TlsEnable and requires tcp.
+// By default this parameter is set to "udp://localhost:514".
+//
+// - Facility: Defines the default facility.
+// By default this parameter is set to "user".
+//
+// - Severity: Defines the default severity.
+// By default this parameter is set to "info".
+//
+// - Hostname: Defines the default hostname. If empty, the hostname of the
+// system is used.
+// By default this parameter is set to "".
+//
+// - AppName: Defines the default application name.
+// By default this parameter is set to "gollum".
+//
+// - TimestampFormat: Defines the go time format used to parse the "timestamp"
+// metadata field. This should match the TimestampFormat of consumer.Syslogd.
+// By default this parameter is set to "2006-01-02T15:04:05.000 MST".
+//
+// - TimeoutMs: Defines the timeout for connecting and writing.
+// By default this parameter is set to "5000".
+//
+// - ReconnectDelayMs: Defines the time to wait before reconnecting after a
+// connection or write error.
+// By default this parameter is set to "1000".
+//
+// Examples
+//
+// This example forwards all messages received by a local syslog consumer to a
+// remote server using TLS.
+//
+//  SyslogIn:
+//    Type: consumer.Syslogd
+//    Streams: syslog
+//    Address: "unix:///dev/log"
+//    Format: RFC3164
+//    SetMetadata: true
+//
+//  SyslogOut:
+//    Type: producer.Syslog
+//    Streams: syslog
+//    Address: "tcp://logs.example.com:6514"
+//    TlsEnable: true
+//    TlsCaLocation: /etc/ssl/logs-ca.pem
+//
+type Syslog struct {
+	core.BufferedProducer `gollumdoc:"embed_type"`
+	TLS                   components.TLSConfig `gollumdoc:"embed_type"`
+	facilityName          string               `config:"Facility" default:"user"`
+	severityName          string               `config:"Severity" default:"info"`
+	hostname              string               `config:"Hostname"`
+	appName               string               `config:"AppName" default:"gollum"`
+	timestampFormat       string               `config:"TimestampFormat" default:"2006-01-02T15:04:05.000 MST"`
+	timeout               time.Duration        `config:"TimeoutMs" default:"5000" metric:"ms"`
+	reconnectDelay        time.Duration        `config:"ReconnectDelayMs" default:"1000" metric:"ms"`
+	protocol              string
+	address               string
+	facility              int
+	severity              int
+	connection            net.Conn
+}
+
+var syslogSeverities = map[string]int{
+	"emerg": 0, "emergency": 0, "panic": 0, "alert": 1, "crit": 2,
+	"critical": 2, "fatal": 2, "err": 3, "error": 3, "warning": 4, "warn": 4,
+	"notice": 5, "info": 6, "informational": 6, "debug": 7, "trace": 7,
+}
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"ntp": 12, "security": 13, "console": 14, "solaris-cron": 15,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// parseSyslogValue converts a numeric or named severity or facility.
+func parseSyslogValue(value string, names map[string]int, max int) (int, bool) {
+	if number, err := strconv.Atoi(value); err == nil {
+		return number, number >= 0 && number <= max
+	}
+	// Severity names may carry a level suffix like "WARN2"
+	number, known := names[strings.ToLower(strings.TrimRight(value, "0123456789"))]
+	if !known {
+		number, known = names[strings.ToLower(value)]
+	}
+	return number, known
+}
+
+func init() {
+	core.TypeRegistry.Register(Syslog{})
+}
+
+// Configure initializes this producer with values from a plugin config.
+func (prod *Syslog) Configure(conf core.PluginConfigReader) {
+	prod.SetStopCallback(prod.close)
+
+	prod.protocol, prod.address = tnet.ParseAddress(conf.GetString("Address", "udp://localhost:514"), "udp")
+	switch prod.protocol {
+	case "udp":
+		if prod.TLS.Enabled {
+			conf.Errors.Pushf("TLS requires the tcp protocol")
+		}
+	case "tcp":
+	default:
+		conf.Errors.Pushf("Unknown protocol type %s", prod.protocol)
+	}
+
+	var valid bool
+	if prod.facility, valid = parseSyslogValue(prod.facilityName, syslogFacilities, 23); !valid {
+		conf.Errors.Pushf("Unknown facility '%s'", prod.facilityName)
+	}
+	if prod.severity, valid = parseSyslogValue(prod.severityName, syslogSeverities, 7); !valid {
+		conf.Errors.Pushf("Unknown severity '%s'", prod.severityName)
+	}
+
+	if prod.hostname == "" {
+		prod.hostname, _ = os.Hostname()
+	}
+}
+
+// syslogHeaderField returns a header field value as required by RFC5424,
+// i.e. printable ASCII of a given maximum length or "-" if empty.
+func syslogHeaderField(value string, maxLength int) string {
+	field := make([]byte, 0, len(value))
+	for i := 0; i < len(value) && len(field) < maxLength; i++ {
+		if value[i] > 32 && value[i] < 127 {
+			field = append(field, value[i])
+		}
+	}
+	if len(field) == 0 {
+		return "-"
+	}
+	return string(field)
+}
+
+// format creates an RFC5424 message from the given message.
+func (prod *Syslog) format(msg *core.Message) []byte {
+	meta := msg.TryGetMetadata()
+
+	facility, severity := prod.facility, prod.severity
+	if value := meta.GetValueString("facility"); value != "" {
+		if parsed, valid := parseSyslogValue(value, syslogFacilities, 23); valid {
+			facility = parsed
+		}
+	}
+	if value := meta.GetValueString("severity"); value != "" {
+		if parsed, valid := parseSyslogValue(value, syslogSeverities, 7); valid {
+			severity = parsed
+		}
+	}
+
+	timestamp := msg.GetCreationTime()
+	if value := meta.GetValueString("timestamp"); value != "" {
+		if parsed, err := time.Parse(prod.timestampFormat, value); err == nil && !parsed.IsZero() {
+			timestamp = parsed
+		}
+	}
+
+	hostname := meta.GetValueString("hostname")
+	if hostname == "" {
+		hostname = prod.hostname
+	}
+
+	appName := meta.GetValueString("app_name")
+	if appName == "" {
+		appName = meta.GetValueString("tag")
+	}
+	if appName == "" {
+		appName = prod.appName
+	}
+
+	frame := bytes.Buffer{}
+	frame.WriteByte('<')
+	frame.WriteString(strconv.Itoa(facility*8 + severity))
+	frame.WriteString(">1 ")
+	frame.WriteString(timestamp.Format("2006-01-02T15:04:05.000000Z07:00"))
+	frame.WriteByte(' ')
+	frame.WriteString(syslogHeaderField(hostname, 255))
+	frame.WriteByte(' ')
+	frame.WriteString(syslogHeaderField(appName, 48))
+	frame.WriteByte(' ')
+	frame.WriteString(syslogHeaderField(meta.GetValueString("proc_id"), 128))
+	frame.WriteByte(' ')
+	frame.WriteString(syslogHeaderField(meta.GetValueString("msg_id"), 32))
+	frame.WriteString(" - ")
+	frame.Write(bytes.TrimRight(msg.GetPayload(), "\r\n"))
+
+	if prod.protocol == "udp" {
+		return frame.Bytes()
+	}
+
+	// Octet counting framing, see RFC6587 section 3.4.1
+	return append([]byte(strconv.Itoa(frame.Len())+" "), frame.Bytes()...)
+}
+
+func (prod *Syslog) connect() error {
+	if prod.connection != nil {
+		return nil // ### return, connection active ###
+	}
+
+	dialer := net.Dialer{Timeout: prod.timeout}
+	var err error
+	if tlsConfig := prod.TLS.GetConfig(); tlsConfig != nil {
+		prod.connection, err = tls.DialWithDialer(&dialer, prod.protocol, prod.address, tlsConfig)
+	} else {
+		prod.connection, err = dialer.Dial(prod.protocol, prod.address)
+	}
+
+	if err != nil {
+		prod.connection = nil
+		return err
+	}
+	return nil
+}
+
+func (prod *Syslog) closeConnection() {
+	if prod.connection != nil {
+		prod.connection.Close()
+		prod.connection = nil
+	}
+}
+
+// send writes a message to the server. Connection or write errors cause the
+// connection to be reestablished until the message has been sent or the
+// producer is stopped.
+func (prod *Syslog) send(msg *core.Message) {
+	frame := prod.format(msg)
+	for {
+		err := prod.connect()
+		if err == nil {
+			prod.connection.SetWriteDeadline(time.Now().Add(prod.timeout))
+			if _, err = prod.connection.Write(frame); err == nil {
+				msg.Release()
+				return // ### return, sent ###
+			}
+			prod.closeConnection()
+		}
+
+		if prod.IsStopping() {
+			prod.Logger.WithError(err).Error("Failed to send message")
+			prod.TryFallback(msg)
+			return // ### return, shutting down ###
+		}
+
+		prod.Logger.WithError(err).Warningf("Failed to send to %s://%s, retrying in %s", prod.protocol, prod.address, prod.reconnectDelay)
+		time.Sleep(prod.reconnectDelay)
+	}
+}
+
+func (prod *Syslog) close() {
+	defer prod.WorkerDone()
+	prod.DefaultClose()
+	prod.closeConnection()
+}
+
+// Produce sends messages to a syslog server
+func (prod *Syslog) Produce(workers *sync.WaitGroup) {
+	prod.AddMainWorker(workers)
+	prod.MessageControlLoop(prod.send)
+}
@@ -0,0 +1,118 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestSyslogFormat(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	prod := newTestPlugin(expect, "producer.Syslog", "syslogFormat", map[string]interface{}{
+		"Hostname": "beaglebone",
+		"Facility": "local0",
+	}).(*Syslog)
+
+	msg := core.NewMessage(nil, []byte("engine started\n"), nil, core.InvalidStreamID)
+	timestamp := msg.GetCreationTime().Format("2006-01-02T15:04:05.000000Z07:00")
+	expect.Equal("<134>1 "+timestamp+" beaglebone gollum - - - engine started", string(prod.format(msg)))
+
+	msg = core.NewMessage(nil, []byte("disk full"), core.Metadata{
+		"facility":  []byte("3"),
+		"severity":  []byte("err"),
+		"hostname":  []byte("pit wall"),
+		"tag":       []byte("monitor"),
+		"proc_id":   []byte("42"),
+		"timestamp": []byte("2018-05-01T12:00:00.123 UTC"),
+	}, core.InvalidStreamID)
+	expect.Equal("<27>1 2018-05-01T12:00:00.123000Z pitwall monitor 42 - - disk full", string(prod.format(msg)))
+
+	msg.GetMetadata().SetValue("app_name", []byte("telemetry"))
+	msg.GetMetadata().SetValue("severity", []byte("WARN2"))
+	expect.Equal("<28>1 2018-05-01T12:00:00.123000Z pitwall telemetry 42 - - disk full", string(prod.format(msg)))
+}
+
+func TestSyslogConfigure(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	_, err := tryNewTestPlugin("producer.Syslog", "syslogUnknownSeverity", map[string]interface{}{
+		"Severity": "loud",
+	})
+	expect.NotNil(err)
+
+	_, err = tryNewTestPlugin("producer.Syslog", "syslogTLSOverUDP", map[string]interface{}{
+		"TlsEnable": true,
+	})
+	expect.NotNil(err)
+}
+
+func TestSyslogTCP(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	expect.NoError(err)
+	defer listener.Close()
+
+	frames := make(chan string, 2)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			reader := bufio.NewReader(conn)
+			for {
+				length, err := reader.ReadString(' ')
+				if err != nil {
+					break
+				}
+				size, _ := strconv.Atoi(length[:len(length)-1])
+				frame := make([]byte, size)
+				if _, err := io.ReadFull(reader, frame); err != nil {
+					break
+				}
+				frames <- string(frame)
+			}
+			conn.Close()
+		}
+	}()
+
+	prod := newTestPlugin(expect, "producer.Syslog", "syslogTCP", map[string]interface{}{
+		"Address":          "tcp://" + listener.Addr().String(),
+		"Hostname":         "beaglebone",
+		"ReconnectDelayMs": 1,
+	}).(*Syslog)
+	defer prod.closeConnection()
+
+	for _, payload := range []string{"first", "second"} {
+		prod.send(core.NewMessage(nil, []byte(payload), core.Metadata{"timestamp": []byte("2018-05-01T12:00:00.000 UTC")}, core.InvalidStreamID))
+
+		select {
+		case frame := <-frames:
+			expect.Equal("<14>1 2018-05-01T12:00:00.000000Z beaglebone gollum - - - "+payload, frame)
+		case <-time.After(time.Second):
+			t.Error("Timeout while waiting for frame")
+		}
+	}
+}
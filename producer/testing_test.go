@@ -0,0 +1,40 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/tgo/ttesting"
+)
+
+// tryNewTestPlugin creates a plugin of the given type. The given settings are
+// applied in order, so later settings overwrite earlier ones.
+func tryNewTestPlugin(typeName string, id string, settings ...map[string]interface{}) (core.Plugin, error) {
+	config := core.NewPluginConfig(id, typeName)
+	for _, values := range settings {
+		for key, value := range values {
+			config.Override(key, value)
+		}
+	}
+	return core.NewPluginWithConfig(config)
+}
+
+// newTestPlugin works like tryNewTestPlugin but expects the plugin to be
+// created without errors.
+func newTestPlugin(expect ttesting.Expect, typeName string, id string, settings ...map[string]interface{}) core.Plugin {
+	plugin, err := tryNewTestPlugin(typeName, id, settings...)
+	expect.NoError(err)
+	return plugin
+}
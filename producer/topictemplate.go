@@ -0,0 +1,41 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"os"
+	"strings"
+
+	"github.com/trivago/gollum/core"
+)
+
+// expandTopicTemplate returns the topic or subject to send the given message
+// to. A "*" in template is replaced by the name of the stream of the message.
+// Placeholders in the form of "${key}" are replaced by the value of the
+// metadata field "key" or an empty string if this field is not set.
+func expandTopicTemplate(template string, msg *core.Message) string {
+	topic := strings.Replace(template, "*", msg.GetStreamID().GetName(), -1)
+	if !strings.Contains(topic, "$") {
+		return topic // ### return, no metadata placeholders ###
+	}
+
+	metadata := msg.TryGetMetadata()
+	return os.Expand(topic, func(key string) string {
+		if metadata == nil {
+			return ""
+		}
+		return metadata.GetValueString(key)
+	})
+}
@@ -149,6 +149,7 @@ func (prod *Websocket) pushMessage(msg *core.Message) {
 			i--
 		}
 	}
+	msg.Release()
 }
 
 func (prod *Websocket) upgrade(w http.ResponseWriter, r *http.Request) {
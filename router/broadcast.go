@@ -21,7 +21,10 @@ import (
 // Broadcast router
 //
 // This router implements the default behavior of routing all messages to all
-// producers registered to the configured stream.
+// producers registered to the configured stream. All producers share the same
+// message, which is released as soon as the last producer released it.
+// Producers modifying the message (e.g. by using modulators) work on their
+// own copy.
 //
 // Examples
 //
@@ -52,18 +55,20 @@ func (router *Broadcast) Start() error {
 func (router *Broadcast) Enqueue(msg *core.Message) error {
 	producers := router.GetProducers()
 	if len(producers) == 0 {
+		msg.Release()
 		return core.NewModulateResultError(
 			"Router %s: no producers configured", router.GetID())
 	}
 
-	timeout := router.GetTimeout()
-	lastProdIdx := len(producers) - 1
-	for _, prod := range producers[:lastProdIdx] {
-		prod.Enqueue(msg.Clone(), timeout)
+	// Every producer owns a reference to the message. All references have to
+	// be acquired before the first producer may release the message.
+	for i := 1; i < len(producers); i++ {
+		msg.Acquire()
 	}
 
-	// Cloning is a rather expensive operation, so skip cloning for the last
-	// message (not required)
-	producers[lastProdIdx].Enqueue(msg, timeout)
+	timeout := router.GetTimeout()
+	for _, prod := range producers {
+		prod.Enqueue(msg, timeout)
+	}
 	return nil
 }
@@ -84,6 +84,7 @@ func (router *Distribute) route(msg *core.Message, targetRouter core.Router) err
 func (router *Distribute) Enqueue(msg *core.Message) error {
 	routers := router.routers
 	if len(routers) == 0 {
+		msg.Release()
 		return core.NewModulateResultError(
 			"Router %s: no streams configured", router.GetID())
 	}
@@ -67,6 +67,7 @@ func (router *Random) Start() error {
 func (router *Random) Enqueue(msg *core.Message) error {
 	producers := router.GetProducers()
 	if len(producers) == 0 {
+		msg.Release()
 		return core.NewModulateResultError("No producers configured for stream %s", router.GetID())
 	}
 
@@ -77,6 +77,7 @@ func (router *RoundRobin) Start() error {
 func (router *RoundRobin) Enqueue(msg *core.Message) error {
 	producers := router.GetProducers()
 	if len(producers) == 0 {
+		msg.Release()
 		return core.NewModulateResultError("No producers configured for stream %s", router.GetID())
 	}
 	index := atomic.AddInt32(&router.index, 1) % int32(len(producers))
@@ -18,10 +18,21 @@ import (
 	"github.com/trivago/gollum/core"
 	_ "github.com/trivago/gollum/filter"
 	_ "github.com/trivago/gollum/format"
+	"github.com/trivago/tgo/ttesting"
 	"runtime/debug"
 	"testing"
+	"time"
 )
 
+type routerTestProducer struct {
+	core.Producer
+	messages []*core.Message
+}
+
+func (prod *routerTestProducer) Enqueue(msg *core.Message, timeout time.Duration) {
+	prod.messages = append(prod.messages, msg)
+}
+
 func TestStreamInterface(t *testing.T) {
 	router := core.TypeRegistry.GetRegistered("router.")
 
@@ -44,3 +55,29 @@ func TestStreamInterface(t *testing.T) {
 		}
 	}
 }
+
+func TestBroadcastSharesMessage(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	plugin, err := core.NewPluginWithConfig(core.NewPluginConfig("", "router.Broadcast"))
+	expect.NoError(err)
+	router := plugin.(*Broadcast)
+
+	producers := []*routerTestProducer{{}, {}, {}}
+	for _, prod := range producers {
+		router.AddProducer(prod)
+	}
+
+	msg := core.NewPooledMessage(nil, []byte("test"), nil, 1)
+	expect.NoError(router.Enqueue(msg))
+
+	// Every producer owns a reference to the same message
+	for i, prod := range producers {
+		expect.Equal(1, len(prod.messages))
+		expect.Equal(msg, prod.messages[0])
+		expect.True(msg.IsPooled())
+
+		prod.messages[0].Release()
+		expect.Equal(i < len(producers)-1, msg.IsPooled())
+	}
+}
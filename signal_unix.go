@@ -25,7 +25,7 @@ import (
 
 func newSignalHandler() chan os.Signal {
 	signalHandler := make(chan os.Signal, 1)
-	signal.Notify(signalHandler, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGHUP)
+	signal.Notify(signalHandler, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGHUP)
 	return signalHandler
 }
 
@@ -37,6 +37,9 @@ func translateSignal(sig os.Signal) signalType {
 
 	case syscall.SIGHUP:
 		return signalRoll
+
+	case syscall.SIGUSR2:
+		return signalPause
 	}
 
 	return signalNone
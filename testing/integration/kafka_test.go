@@ -0,0 +1,81 @@
+// +build integration
+
+package integration
+
+import (
+	"testing"
+	"time"
+
+	kafka "github.com/Shopify/sarama"
+	"github.com/trivago/tgo/ttesting"
+)
+
+const (
+	testKafkaTransactionConfig = "test_kafka_transaction.conf"
+	testKafkaServer            = "127.0.0.1:9092"
+	testKafkaTopic             = "gollum_test_transactions"
+)
+
+// newKafkaTestClient connects to a local broker. The test is skipped if no
+// broker is running.
+func newKafkaTestClient(t *testing.T) kafka.Client {
+	config := kafka.NewConfig()
+	config.Version = kafka.V0_11_0_0
+	config.Consumer.IsolationLevel = kafka.ReadCommitted
+
+	client, err := kafka.NewClient([]string{testKafkaServer}, config)
+	if err != nil {
+		t.Skipf("No kafka broker at %s: %s", testKafkaServer, err)
+	}
+
+	admin, err := kafka.NewClusterAdminFromClient(client)
+	if err != nil {
+		client.Close()
+		t.Fatal(err)
+	}
+	err = admin.CreateTopic(testKafkaTopic, &kafka.TopicDetail{NumPartitions: 1, ReplicationFactor: 1}, false)
+	if topicErr, isTopicErr := err.(*kafka.TopicError); err != nil && (!isTopicErr || topicErr.Err != kafka.ErrTopicAlreadyExists) {
+		client.Close()
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestKafkaTransaction(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	client := newKafkaTestClient(t)
+	defer client.Close()
+
+	offset, err := client.GetOffset(testKafkaTopic, 0, kafka.OffsetNewest)
+	expect.NoError(err)
+
+	// execute gollum
+	cmd, err := StartGollum(testKafkaTransactionConfig, DefaultStartIndicator, "-ll=2")
+	expect.NoError(err)
+
+	// Two full transactions and a partial one committed on shutdown
+	laps := []string{"lap 1", "lap 2", "lap 3", "lap 4", "lap 5"}
+	err = cmd.SendStdIn(time.Second, laps...)
+	expect.NoError(err)
+
+	err = cmd.Stop()
+	expect.NoError(err)
+
+	consumer, err := kafka.NewConsumerFromClient(client)
+	expect.NoError(err)
+	defer consumer.Close()
+
+	partition, err := consumer.ConsumePartition(testKafkaTopic, 0, offset)
+	expect.NoError(err)
+	defer partition.Close()
+
+	for _, lap := range laps {
+		select {
+		case msg := <-partition.Messages():
+			expect.Equal(lap, string(msg.Value))
+		case <-time.After(maxFetchResultTime):
+			t.Fatalf("Timed out waiting for %q", lap)
+		}
+	}
+}